@@ -15,31 +15,79 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"slowfs/slowfs"
+	"slowfs/slowfs/control"
+	"slowfs/slowfs/ctl"
+	"slowfs/slowfs/decisionlog"
+	"slowfs/slowfs/faults"
 	"slowfs/slowfs/fuselayer"
+	"slowfs/slowfs/hazards"
+	"slowfs/slowfs/isolation"
+	"slowfs/slowfs/metrics"
+	"slowfs/slowfs/mounts"
+	"slowfs/slowfs/nbd"
+	"slowfs/slowfs/quota"
+	"slowfs/slowfs/rules"
 	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/server"
+	"slowfs/slowfs/trace"
 	"slowfs/slowfs/units"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
-
-	"github.com/hanwen/go-fuse/fuse/nodefs"
-	"github.com/hanwen/go-fuse/fuse/pathfs"
 )
 
+// latencyBuckets are the bucket bounds of latency histograms, from 50us to about 13s.
+var latencyBuckets = metrics.ExponentialBuckets(50e-6, 4, 10)
+
+// ruleCheckInterval is how often rules are checked, which bounds how quickly they react.
+const ruleCheckInterval = 100 * time.Millisecond
+
 func main() {
-	configs := map[string]*slowfs.DeviceConfig{
-		slowfs.HDD7200RpmDeviceConfig.Name: &slowfs.HDD7200RpmDeviceConfig,
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		runCtl(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cost" {
+		runCost(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check-determinism" {
+		runCheckDeterminism(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "mount" {
+		runMount(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "nbd" {
+		runNBD(os.Args[2:])
+		return
 	}
 
 	backingDir := flag.String("backing-dir", "", "directory to use as storage")
 	mountDir := flag.String("mount-dir", "", "directory to mount at")
+	forceCleanup := flag.Bool("force-cleanup", false, "unmount a stale mount left at mount-dir by a crashed slowfs")
+	var extraSpecs mountSpecs
+	flag.Var(&extraSpecs, "mount", "another mount to serve alongside mount-dir, with its own device, as backing:mount:config, e.g. /srv/logs:/mnt/logs:hdd7200rpm; may be repeated")
 
-	configFile := flag.String("config-file", "", "path to config file listing device configurations")
-	configName := flag.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm)")
+	configFile := flag.String("config-file", "", "path to config file listing device configurations, in JSON, or YAML if it ends in .yaml or .yml")
+	configName := flag.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm, ssd, nvme, pmem, nfs)")
 
 	// Flags for overriding any subset of the config. These are all strings (even the durations)
 	// because we need to differentiate between the flag not being specified, and being set to the
@@ -53,6 +101,100 @@ func main() {
 	fsyncStrategy := flag.String("fsync-strategy", "", "choice of none/no, dumb, writebackcache/wbc")
 	writeStrategy := flag.String("write-strategy", "", "choice of fast, simulate")
 	metadataOpTime := flag.String("metadata-op-time", "", "duration value (e.g. 10ms)")
+	readRepairProbability := flag.String("read-repair-probability", "", "fraction of reads, between 0 and 1, which need repairing")
+	readRepairSeeks := flag.String("read-repair-seeks", "", "how many extra seeks a repaired read costs")
+	metadataBytesPerSecond := flag.String("metadata-bytes-per-second", "", "how many bytes of directory entries can be listed per second (0 for flat cost)")
+	metadataStrategy := flag.String("metadata-strategy", "", "choice of sync, journaled")
+	metadataCommitInterval := flag.String("metadata-commit-interval", "", "how often journaled metadata is committed (e.g. 5s)")
+	flushOnClose := flag.String("flush-on-close", "", "whether closing a file waits for its cached writes (true, false)")
+	readWriteBackCache := flag.String("read-write-back-cache", "", "whether reads of data still in the write back cache take no time (true, false)")
+	metadataDevice := flag.String("metadata-device", "", "config to simulate a separate device for metadata operations with")
+	freeBytesPerSecond := flag.String("free-bytes-per-second", "", "how many bytes truncating can free per second, e.g. 20GB")
+	zeroFillBytesPerSecond := flag.String("zero-fill-bytes-per-second", "", "how many bytes extending a file can zero per second, e.g. 150MB")
+	reclaimBytesPerSecond := flag.String("reclaim-bytes-per-second", "", "how many bytes of unlinked files' space becomes free per second, e.g. 1GB")
+	deletedRetention := flag.String("deleted-retention", "", "how long unlinked files' space stays in use before being reclaimed, e.g. 1h")
+	uploadBytesPerSecond := flag.String("upload-bytes-per-second", "", "how many bytes of written data a cloud gateway uploads per second, e.g. 10MB")
+	fsyncWaitsForUpload := flag.String("fsync-waits-for-upload", "", "whether fsync waits for the file's data to be uploaded (true, false)")
+	closeWaitsForUpload := flag.String("close-waits-for-upload", "", "whether closing a file waits for its data to be uploaded (true, false)")
+	networkLatency := flag.String("network-latency", "", "round trip time of the network to a remote device, e.g. 500us")
+	networkBytesPerSecond := flag.String("network-bytes-per-second", "", "bandwidth of the network to a remote device, e.g. 110MB (0 for unlimited)")
+	seekTimeDistribution := flag.String("seek-time-distribution", "", "distribution seek times are drawn from, e.g. lognormal(8ms,4ms), or p99(8ms,30ms) for a mean and 99th percentile")
+	metadataOpDistribution := flag.String("metadata-op-distribution", "", "distribution metadata operation times are drawn from, e.g. uniform(5ms,15ms)")
+	baseLatency := flag.String("base-latency", "", "distribution of a latency every request pays, e.g. pareto(50us,1.5)")
+	randomReadBytesPerSecond := flag.String("random-read-bytes-per-second", "", "how many bytes per second reads which seek run at, e.g. 2MB (0 for the sequential rate)")
+	randomWriteBytesPerSecond := flag.String("random-write-bytes-per-second", "", "how many bytes per second writes which seek run at, e.g. 1MB (0 for the sequential rate)")
+	fsyncGroupWindow := flag.String("fsync-group-window", "", "how long an fsync waits for others to share a group commit with, e.g. 2ms")
+	directoryLockTime := flag.String("directory-lock-time", "", "how long creating or removing a directory entry holds the directory's lock, e.g. 1ms")
+	actuators := flag.String("actuators", "", "number of independent actuators, e.g. 2 for a dual actuator hard disk")
+	queueDepth := flag.String("queue-depth", "", "how many requests the device accepts at once, e.g. 32 (0 for unbounded)")
+	readCacheBytes := flag.String("read-cache-bytes", "", "how much read data is cached in memory, like the page cache, e.g. 1GiB")
+	readCacheEviction := flag.String("read-cache-eviction", "", "which data a full read cache drops: choice of lru, fifo")
+	readCacheHitTime := flag.String("read-cache-hit-time", "", "how long reading cached data takes, e.g. 5us")
+	journalCommitTime := flag.String("journal-commit-time", "", "how long committing the journal takes, which every fsync does, e.g. 5ms")
+	fsyncFlushesAllData := flag.String("fsync-flushes-all-data", "", "whether an fsync writes back every file's cached data, like ext4 data=ordered (true, false)")
+	noOpStrategy := flag.String("no-op-strategy", "", "how writes and truncates which change nothing are charged: choice of default, free/none, metadata")
+	alignmentBytes := flag.String("alignment-bytes", "", "boundary reads and writes should be aligned to, like the device's sector size, e.g. 4KiB")
+	misalignmentPenalty := flag.String("misalignment-penalty", "", "how much longer reads and writes not aligned to --alignment-bytes take, e.g. 1ms")
+	directoryEntryTime := flag.String("directory-entry-time", "", "how long scanning each directory entry takes, so that operations on large directories are slower, e.g. 10us")
+	readAheadBytes := flag.String("read-ahead-bytes", "", "how much data past a sequential read is prefetched with it, like the kernel's read-ahead, e.g. 128KiB")
+	verifyWrites := flag.String("verify-writes", "", "whether data written to the device is read back to verify it, as on archival configurations (true, false)")
+	fdatasyncStrategy := flag.String("fdatasync-strategy", "", "strategy for fdatasync, if not the fsync strategy: choice of none/no, dumb, writebackcache/wbc")
+
+	timeoutMode := flag.String("timeout-mode", "hard", "choice of hard, soft; SIGUSR1 toggles between them at runtime")
+	opTimeout := flag.Duration("op-timeout", 0, "how long operations may take before timing out (0 disables timeouts)")
+	timingTick := flag.Duration("timing-tick", 0, "start and finish operations on multiples of this, e.g. 1ms, so runs on different machines have matching timelines (0 disables)")
+	pinCPUs := flag.String("pin-cpus", "", "CPUs to run slowfs's threads on, so other processes' scheduling doesn't delay them, e.g. 2-3")
+	nice := flag.Int("nice", 0, "nice value for slowfs's threads, negative to run them ahead of other processes, e.g. -10")
+	mlock := flag.Bool("mlock", false, "lock slowfs's memory so it is never paged out")
+	compensateDrift := flag.Bool("compensate-drift", false, "wake operations early by the drift measured so far, so delivered latencies match the modeled ones on noisy hosts")
+	virtualClock := flag.Bool("virtual-clock", false, "advance a simulated clock instead of sleeping, so operations complete at once while still modeling their order and latencies; simulated time is reported by the stats file and the clock control command")
+	spin := flag.Duration("spin", 0, "how long before each operation completes to stop sleeping and spin instead, for sub-millisecond accuracy at the cost of CPU time, e.g. 200us")
+	consistency := flag.String("consistency", "local", "when writes become visible to other opens: choice of local, cto (on close or fsync), strict-cto (on close)")
+	writesBlockReads := flag.Bool("writes-block-reads", false, "make reads of a file wait for writes to it in progress, instead of interleaving with them")
+	timestampGranularity := flag.Duration("timestamp-granularity", 0, "round file timestamps down to a multiple of this, e.g. 2s like FAT (0 keeps the backing directory's)")
+	semantics := flag.String("semantics", "posix", "which filesystem's rules to follow: choice of posix, fat (case insensitive, 2s timestamps, no permissions or links, 4GiB files)")
+	maxFileSize := flag.String("max-file-size", "", "size past which files can't grow, failing with EFBIG, e.g. 2GiB")
+	noAtime := flag.Bool("noatime", false, "open files without updating their access times, as if mounted with noatime")
+	mountOptions := flag.String("o", "", "comma separated mount options, as for mount -o, e.g. ro,noatime,sync; options which make no difference to slowfs are ignored")
+	maxOpenFiles := flag.Int("max-open-files", 0, "how many files may be open at once, past which opens fail with EMFILE, like a file server out of descriptors (0 for unlimited)")
+	blockOpens := flag.Bool("block-opens", false, "make opens past --max-open-files wait for another file to be closed instead of failing")
+	mountBytesPerSecond := flag.String("mount-bytes-per-second", "", "how many bytes per second can be read and written across the whole mount, whatever each request costs, e.g. 100MB")
+	mountBurstBytes := flag.String("mount-burst-bytes", "", "how many bytes can go through at once under --mount-bytes-per-second, e.g. 8MB (default one second's worth)")
+	ioPriorities := flag.String("io-priorities", "", "comma separated kind:value=priority rules giving requests for matching paths, from matching users, or of matching types an IO priority of high, normal or idle, e.g. path:db/compaction=idle,uid:0=high,op:fsync=high")
+	scanAfter := flag.Duration("scan-after", 0, "read files through this long after they were last created or modified, like an antivirus or indexing service, e.g. 5s (0 disables)")
+	scanOpenDelay := flag.Duration("scan-open-delay", 0, "how long an on-access scanner holds up every open, e.g. 2ms")
+	primaryDir := flag.String("primary-dir", "", "directory in the mount whose changes are replicated to --replica-dir")
+	replicaDir := flag.String("replica-dir", "", "read-only directory in the mount reflecting --primary-dir after --replica-lag, like an asynchronous replica")
+	replicaLag := flag.Duration("replica-lag", time.Second, "how long changes to --primary-dir take to reach --replica-dir")
+	startupDelay := flag.Duration("startup-delay", 0, "how long the mount takes to become ready, failing operations with ENOTCONN until then, e.g. 30s")
+	capacity := flag.String("capacity", "", "size of the simulated device, reported by statfs, past which writes fail with ENOSPC whatever the backing directory's free space, e.g. 10GiB")
+	quotaFile := flag.String("quotas", "", "path to a JSON file of per user, group or project directory limits, past which operations fail with EDQUOT")
+
+	journalConfigName := flag.String("journal-config-name", "", "config to simulate a separate journal device with")
+	journalPaths := flag.String("journal-paths", "", "comma separated glob patterns of paths on the journal device")
+	pathDevices := flag.String("path-devices", "", "comma separated pattern=config rules storing paths matching each glob pattern on a separate device with that config, e.g. fast=ssd,archive=hdd7200rpm")
+
+	faultSchedule := flag.String("fault-schedule", "", "path to a JSON file of faults to inject, timed from when the filesystem is mounted")
+	faultRamp := flag.String("fault-ramp", "", "fail operations at random, as op:error:ramp[:path], e.g. write:EIO:linear(0,0.05,1h)")
+	readdirFaultProbability := flag.Float64("readdir-fault-probability", 0, "probability that a directory listing skips, duplicates or restarts entries")
+	eintrProbability := flag.Float64("eintr-probability", 0, "fraction of reads and writes to fail with EINTR, as if interrupted by a signal, e.g. 0.01")
+	shortReadProbability := flag.Float64("short-read-probability", 0, "fraction of reads to cut short at random, returning a short count, e.g. 0.05; files are opened with direct IO so that short reads reach applications")
+	shortWriteProbability := flag.Float64("short-write-probability", 0, "fraction of writes to cut short at random, returning a short count, e.g. 0.05")
+	faultSeed := flag.Int64("fault-seed", time.Now().UnixNano(), "seed for random faults, to reproduce a run")
+
+	decisionLog := flag.String("decision-log", "", "path to record every scheduling decision to, for querying with slowfs-inspect")
+	replayFile := flag.String("replay", "", "path to a trace, as written by --trace, whose recorded latencies operations take instead of modeled ones, until it runs out")
+	traceFile := flag.String("trace", "", "path to record every operation to, as lines of JSON with its simulated latency and how long it actually took")
+	traceSampleEvery := flag.Int("trace-sample-every", 0, "only record one in this many operations to --trace, besides those --trace-slower-than records (0 records all, unless --trace-slower-than is set)")
+	hazardReportFile := flag.String("hazard-report", "", "path to write, on exit, a report of each file's reads of data written but not yet synced, which may depend on it being cached")
+	traceSlowerThan := flag.Duration("trace-slower-than", 0, "always record operations taking at least this long to --trace, and others only as --trace-sample-every says, e.g. 10ms")
+	rulesFile := flag.String("rules", "", "path to a JSON file of rules, which act when a metric like backlog crosses a threshold")
+
+	controlAddr := flag.String("control-addr", "", "address to serve the control API on, either unix:/path/to/socket or host:port")
+	controlFile := flag.Bool("control-file", false, "run control API commands written to "+fuselayer.ControlFileName+" in the root of the mount")
+	controlPolicy := flag.String("control-policy", "", "path to a JSON file granting control API roles; without one, anyone who can connect may do anything")
+	compareCommand := flag.String("compare-command", "", "shell command to run in the mount twice, without and then with the simulation, reporting how much slower each type of operation was; slowfs unmounts afterwards")
+	metricsAddr := flag.String("metrics-addr", "", "address (e.g. localhost:9100) to serve metrics on at /metrics")
 	flag.Parse()
 
 	if *backingDir == "" || *mountDir == "" {
@@ -75,24 +217,27 @@ func main() {
 		log.Fatalf("backing directory may not be the same as mount directory.")
 	}
 
-	if *configFile != "" {
-		data, err := ioutil.ReadFile(*configFile)
-		if err != nil {
-			log.Fatalf("couldn't read config file %s: %s", *configFile, err)
-		}
-		dcs, err := slowfs.ParseDeviceConfigsFromJSON(data)
-		if err != nil {
-			log.Fatalf("couldn't parse config file %s: %s", *configFile, err)
+	if mounts.IsStale(*mountDir) {
+		if !*forceCleanup {
+			log.Fatalf("mount directory %s has a stale mount, probably left by a crashed slowfs. "+
+				"Rerun with --force-cleanup, or run fusermount -u %s", *mountDir, *mountDir)
 		}
-		for _, dc := range dcs {
-			if _, ok := configs[dc.Name]; ok {
-				log.Fatalf("duplicate device config with name '%s'", dc.Name)
-			}
-			configs[dc.Name] = dc
+		if err := mounts.Unmount(*mountDir); err != nil {
+			log.Fatalf("couldn't clean up stale mount at %s: %s", *mountDir, err)
 		}
+		log.Printf("cleaned up stale mount at %s", *mountDir)
+	}
+
+	mountTable, err := mounts.ReadMountInfo()
+	if err != nil {
+		log.Printf("couldn't read mount table, skipping some mount checks: %s", err)
+	}
+	if err := mounts.CheckMountDirs(*backingDir, *mountDir, mountTable); err != nil {
+		log.Fatalf("%s", err)
 	}
 
-	config, ok := configs[*configName]
+	configs := loadDeviceConfigs(*configFile)
+	config, ok := deviceConfig(configs, *configName)
 
 	if !ok {
 		log.Fatalf("unknown config %s", *configName)
@@ -172,6 +317,316 @@ func main() {
 		}
 	}
 
+	if *readRepairProbability != "" {
+		config.ReadRepairProbability, err = strconv.ParseFloat(*readRepairProbability, 64)
+		if err != nil {
+			log.Printf("flag read-repair-probability: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *readRepairSeeks != "" {
+		config.ReadRepairSeeks, err = strconv.Atoi(*readRepairSeeks)
+		if err != nil {
+			log.Printf("flag read-repair-seeks: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *metadataBytesPerSecond != "" {
+		config.MetadataBytesPerSecond, err = units.ParseNumBytesFromString(*metadataBytesPerSecond)
+		if err != nil {
+			log.Printf("flag metadata-bytes-per-second: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *metadataStrategy != "" {
+		config.MetadataStrategy, err = slowfs.ParseMetadataStrategyFromString(*metadataStrategy)
+		if err != nil {
+			log.Printf("flag metadata-strategy: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *metadataCommitInterval != "" {
+		config.MetadataCommitInterval, err = time.ParseDuration(*metadataCommitInterval)
+		if err != nil {
+			log.Printf("flag metadata-commit-interval: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *readWriteBackCache != "" {
+		config.ReadWriteBackCache, err = strconv.ParseBool(*readWriteBackCache)
+		if err != nil {
+			log.Printf("flag read-write-back-cache: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *flushOnClose != "" {
+		config.FlushOnClose, err = strconv.ParseBool(*flushOnClose)
+		if err != nil {
+			log.Printf("flag flush-on-close: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *metadataDevice != "" {
+		config.MetadataDevice = *metadataDevice
+	}
+
+	if *freeBytesPerSecond != "" {
+		config.FreeBytesPerSecond, err = units.ParseNumBytesFromString(*freeBytesPerSecond)
+		if err != nil {
+			log.Printf("flag free-bytes-per-second: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *zeroFillBytesPerSecond != "" {
+		config.ZeroFillBytesPerSecond, err = units.ParseNumBytesFromString(*zeroFillBytesPerSecond)
+		if err != nil {
+			log.Printf("flag zero-fill-bytes-per-second: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *reclaimBytesPerSecond != "" {
+		config.ReclaimBytesPerSecond, err = units.ParseNumBytesFromString(*reclaimBytesPerSecond)
+		if err != nil {
+			log.Printf("flag reclaim-bytes-per-second: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *deletedRetention != "" {
+		config.DeletedRetention, err = time.ParseDuration(*deletedRetention)
+		if err != nil {
+			log.Printf("flag deleted-retention: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *uploadBytesPerSecond != "" {
+		config.UploadBytesPerSecond, err = units.ParseNumBytesFromString(*uploadBytesPerSecond)
+		if err != nil {
+			log.Printf("flag upload-bytes-per-second: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *fsyncWaitsForUpload != "" {
+		config.FsyncWaitsForUpload, err = strconv.ParseBool(*fsyncWaitsForUpload)
+		if err != nil {
+			log.Printf("flag fsync-waits-for-upload: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *closeWaitsForUpload != "" {
+		config.CloseWaitsForUpload, err = strconv.ParseBool(*closeWaitsForUpload)
+		if err != nil {
+			log.Printf("flag close-waits-for-upload: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *networkLatency != "" {
+		config.NetworkLatency, err = time.ParseDuration(*networkLatency)
+		if err != nil {
+			log.Printf("flag network-latency: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *networkBytesPerSecond != "" {
+		config.NetworkBytesPerSecond, err = units.ParseNumBytesFromString(*networkBytesPerSecond)
+		if err != nil {
+			log.Printf("flag network-bytes-per-second: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *fsyncGroupWindow != "" {
+		config.FsyncGroupWindow, err = time.ParseDuration(*fsyncGroupWindow)
+		if err != nil {
+			log.Printf("flag fsync-group-window: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *seekTimeDistribution != "" {
+		config.SeekTimeDistribution, err = slowfs.ParseDistributionFromString(*seekTimeDistribution)
+		if err != nil {
+			log.Printf("flag seek-time-distribution: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *metadataOpDistribution != "" {
+		config.MetadataOpDistribution, err = slowfs.ParseDistributionFromString(*metadataOpDistribution)
+		if err != nil {
+			log.Printf("flag metadata-op-distribution: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *baseLatency != "" {
+		config.BaseLatency, err = slowfs.ParseDistributionFromString(*baseLatency)
+		if err != nil {
+			log.Printf("flag base-latency: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *randomReadBytesPerSecond != "" {
+		config.RandomReadBytesPerSecond, err = units.ParseNumBytesFromString(*randomReadBytesPerSecond)
+		if err != nil {
+			log.Printf("flag random-read-bytes-per-second: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *randomWriteBytesPerSecond != "" {
+		config.RandomWriteBytesPerSecond, err = units.ParseNumBytesFromString(*randomWriteBytesPerSecond)
+		if err != nil {
+			log.Printf("flag random-write-bytes-per-second: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *directoryLockTime != "" {
+		config.DirectoryLockTime, err = time.ParseDuration(*directoryLockTime)
+		if err != nil {
+			log.Printf("flag directory-lock-time: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *actuators != "" {
+		config.Actuators, err = strconv.Atoi(*actuators)
+		if err != nil {
+			log.Printf("flag actuators: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *queueDepth != "" {
+		config.QueueDepth, err = strconv.Atoi(*queueDepth)
+		if err != nil {
+			log.Printf("flag queue-depth: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *readCacheBytes != "" {
+		config.ReadCacheBytes, err = units.ParseNumBytesFromString(*readCacheBytes)
+		if err != nil {
+			log.Printf("flag read-cache-bytes: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *readCacheEviction != "" {
+		config.ReadCacheEviction, err = slowfs.ParseEvictionPolicyFromString(*readCacheEviction)
+		if err != nil {
+			log.Printf("flag read-cache-eviction: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *readCacheHitTime != "" {
+		config.ReadCacheHitTime, err = time.ParseDuration(*readCacheHitTime)
+		if err != nil {
+			log.Printf("flag read-cache-hit-time: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *journalCommitTime != "" {
+		config.JournalCommitTime, err = time.ParseDuration(*journalCommitTime)
+		if err != nil {
+			log.Printf("flag journal-commit-time: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *fsyncFlushesAllData != "" {
+		config.FsyncFlushesAllData, err = strconv.ParseBool(*fsyncFlushesAllData)
+		if err != nil {
+			log.Printf("flag fsync-flushes-all-data: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *readAheadBytes != "" {
+		config.ReadAheadBytes, err = units.ParseNumBytesFromString(*readAheadBytes)
+		if err != nil {
+			log.Printf("flag read-ahead-bytes: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *alignmentBytes != "" {
+		config.AlignmentBytes, err = units.ParseNumBytesFromString(*alignmentBytes)
+		if err != nil {
+			log.Printf("flag alignment-bytes: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *misalignmentPenalty != "" {
+		config.MisalignmentPenalty, err = time.ParseDuration(*misalignmentPenalty)
+		if err != nil {
+			log.Printf("flag misalignment-penalty: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *directoryEntryTime != "" {
+		config.DirectoryEntryTime, err = time.ParseDuration(*directoryEntryTime)
+		if err != nil {
+			log.Printf("flag directory-entry-time: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *capacity != "" {
+		config.DeviceCapacity, err = units.ParseNumBytesFromString(*capacity)
+		if err != nil {
+			log.Printf("flag capacity: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *noOpStrategy != "" {
+		config.NoOpStrategy, err = slowfs.ParseNoOpStrategyFromString(*noOpStrategy)
+		if err != nil {
+			log.Printf("flag no-op-strategy: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *verifyWrites != "" {
+		config.VerifyWrites, err = strconv.ParseBool(*verifyWrites)
+		if err != nil {
+			log.Printf("flag verify-writes: %s", err)
+			flagsHadError = true
+		}
+	}
+
+	if *fdatasyncStrategy != "" {
+		var strategy slowfs.FsyncStrategy
+		strategy, err = slowfs.ParseFsyncStrategyFromString(*fdatasyncStrategy)
+		if err != nil {
+			log.Printf("flag fdatasync-strategy: %s", err)
+			flagsHadError = true
+		}
+		config.FdatasyncStrategy = &strategy
+	}
+
 	if flagsHadError {
 		log.Fatalf("flags had error(s), exiting")
 	}
@@ -181,13 +636,1350 @@ func main() {
 		log.Fatalf("error validating config: %s", err)
 	}
 
+	mode, err := slowfs.ParseTimeoutModeFromString(*timeoutMode)
+	if err != nil {
+		log.Fatalf("flag timeout-mode: %s", err)
+	}
+	if *opTimeout < 0 {
+		log.Fatalf("flag op-timeout: cannot be negative")
+	}
+	consistencyModel, err := slowfs.ParseConsistencyFromString(*consistency)
+	if err != nil {
+		log.Fatalf("flag consistency: %s", err)
+	}
+	semanticsModel, err := slowfs.ParseSemanticsFromString(*semantics)
+	if err != nil {
+		log.Fatalf("flag semantics: %s", err)
+	}
+	var maxFileSizeBytes units.NumBytes
+	if *maxFileSize != "" {
+		maxFileSizeBytes, err = units.ParseNumBytesFromString(*maxFileSize)
+		if err != nil {
+			log.Fatalf("flag max-file-size: %s", err)
+		}
+	}
+
+	var journalConfig *slowfs.DeviceConfig
+	if *journalConfigName != "" {
+		var ok bool
+		if journalConfig, ok = deviceConfig(configs, *journalConfigName); !ok {
+			log.Fatalf("unknown journal config %s", *journalConfigName)
+		}
+		if *journalPaths == "" {
+			log.Fatalf("journal-paths is required with journal-config-name")
+		}
+		if err := journalConfig.Validate(); err != nil {
+			log.Fatalf("error validating journal config: %s", err)
+		}
+	}
+
+	var pathRules []slowfs.PathRule
+	pathConfigs := make(map[string]*slowfs.DeviceConfig)
+	if *pathDevices != "" {
+		var err error
+		if pathRules, err = slowfs.ParsePathRulesFromString(*pathDevices); err != nil {
+			log.Fatalf("flag path-devices: %s", err)
+		}
+		for _, rule := range pathRules {
+			if _, ok := pathConfigs[rule.Device]; ok {
+				continue
+			}
+			pathConfig, ok := deviceConfig(configs, rule.Device)
+			if !ok {
+				log.Fatalf("unknown path device config %s", rule.Device)
+			}
+			if err := pathConfig.Validate(); err != nil {
+				log.Fatalf("error validating path device config %s: %s", pathConfig.Name, err)
+			}
+			pathConfigs[rule.Device] = pathConfig
+		}
+	}
+
+	var metadataConfig *slowfs.DeviceConfig
+	if config.MetadataDevice != "" {
+		if metadataConfig, err = metadataDeviceConfig(configs, config.MetadataDevice); err != nil {
+			log.Fatalf("%s", err)
+		}
+	}
+
+	mountDirs := map[string]bool{*mountDir: true}
+	var extraMounts []*extraMount
+	for _, spec := range extraSpecs {
+		m, err := newExtraMount(spec, configs, mountTable, *forceCleanup)
+		if err != nil {
+			log.Fatalf("flag mount %s: %s", spec, err)
+		}
+		if mountDirs[m.spec.MountDir] {
+			log.Fatalf("flag mount %s: %s is mounted more than once", spec, m.spec.MountDir)
+		}
+		mountDirs[m.spec.MountDir] = true
+		extraMounts = append(extraMounts, m)
+	}
+
 	fmt.Printf("using config: %s\n", config)
-	scheduler := scheduler.New(config)
-	fs := pathfs.NewPathNodeFs(fuselayer.NewSlowFs(*backingDir, scheduler), nil)
-	server, _, err := nodefs.MountRoot(*mountDir, fs.Root(), nil)
+	fsServer, err := server.New(*backingDir, *mountDir, config)
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
+	deviceScheduler := fsServer.Scheduler()
+	slowFs := fsServer.SlowFs()
+
+	// Every device, on every mount, tells the time with the same clock.
+	var clock *scheduler.VirtualClock
+	if *virtualClock {
+		clock = scheduler.NewVirtualClock(time.Now())
+		deviceScheduler.SetClock(clock)
+		slowFs.SetVirtualClock(clock)
+		for _, m := range extraMounts {
+			m.Scheduler().SetClock(clock)
+			m.SlowFs().SetVirtualClock(clock)
+		}
+	}
+	newScheduler := func(config *slowfs.DeviceConfig) *scheduler.Scheduler {
+		s := scheduler.New(config)
+		if clock != nil {
+			s.SetClock(clock)
+		}
+		return s
+	}
 
-	server.Serve()
+	slowFs.SetTimeout(mode, *opTimeout)
+	for _, m := range extraMounts {
+		m.SlowFs().SetTimeout(mode, *opTimeout)
+	}
+	slowFs.SetConsistency(consistencyModel)
+	slowFs.SetWritesBlockReads(*writesBlockReads)
+	slowFs.SetSemantics(semanticsModel)
+	if *timestampGranularity != 0 {
+		slowFs.SetTimestampGranularity(*timestampGranularity)
+	}
+	if *maxFileSize != "" {
+		slowFs.SetMaxFileSize(maxFileSizeBytes)
+	}
+	mountOpts, err := slowfs.ParseMountOptionsFromString(*mountOptions)
+	if err != nil {
+		log.Fatalf("flag o: %s", err)
+	}
+	slowFs.SetNoAtime(*noAtime || mountOpts.NoAtime)
+	slowFs.SetSync(mountOpts.Sync)
+	slowFs.SetDirSync(mountOpts.DirSync)
+	slowFs.SetDriftCompensation(*compensateDrift)
+	if *spin < 0 {
+		log.Fatalf("flag spin: cannot be negative")
+	}
+	slowFs.SetSpin(*spin)
+	for _, m := range extraMounts {
+		m.SlowFs().SetSpin(*spin)
+	}
+	if *timingTick < 0 {
+		log.Fatalf("flag timing-tick: cannot be negative")
+	}
+	isolateFromHost(*pinCPUs, *nice, *mlock)
+	slowFs.SetTimingTick(*timingTick)
+	if *scanAfter < 0 || *scanOpenDelay < 0 {
+		log.Fatalf("flags scan-after and scan-open-delay: cannot be negative")
+	}
+	slowFs.SetScanning(*scanAfter, *scanOpenDelay)
+	if *maxOpenFiles < 0 {
+		log.Fatalf("flag max-open-files: cannot be negative")
+	}
+	slowFs.SetMaxOpenFiles(*maxOpenFiles, *blockOpens)
+	if *mountBytesPerSecond != "" {
+		rate, err := units.ParseNumBytesFromString(*mountBytesPerSecond)
+		if err != nil {
+			log.Fatalf("flag mount-bytes-per-second: %s", err)
+		}
+		burst := rate
+		if *mountBurstBytes != "" {
+			burst, err = units.ParseNumBytesFromString(*mountBurstBytes)
+			if err != nil {
+				log.Fatalf("flag mount-burst-bytes: %s", err)
+			}
+		}
+		if rate < 0 || burst < 0 {
+			log.Fatalf("flags mount-bytes-per-second and mount-burst-bytes: cannot be negative")
+		}
+		slowFs.SetBandwidthLimit(rate, burst)
+	}
+	if *ioPriorities != "" {
+		rules, err := fuselayer.ParsePriorityRulesFromString(*ioPriorities)
+		if err != nil {
+			log.Fatalf("flag io-priorities: %s", err)
+		}
+		slowFs.SetPriorityRules(rules)
+	}
+	if (*primaryDir == "") != (*replicaDir == "") {
+		log.Fatalf("flags primary-dir and replica-dir must be given together")
+	}
+	if *primaryDir != "" {
+		if *replicaLag < 0 {
+			log.Fatalf("flag replica-lag: cannot be negative")
+		}
+		if err := slowFs.SetReplica(*primaryDir, *replicaDir, *replicaLag); err != nil {
+			log.Fatalf("couldn't set up replica %s: %s", *replicaDir, err)
+		}
+	}
+
+	var journalScheduler *scheduler.Scheduler
+	if journalConfig != nil {
+		fmt.Printf("using journal config: %s\n", journalConfig)
+		journalScheduler = newScheduler(journalConfig)
+		slowFs.RoutePaths("journal", strings.Split(*journalPaths, ","), journalScheduler)
+		if journalConfig.DirectoryEntryTime > 0 {
+			slowFs.SetCountEntries(true)
+		}
+	}
+
+	// Paths matching several rules go to the device of the first, and each config is one device
+	// however many rules name it.
+	var pathDeviceNames []string
+	pathSchedulers := make(map[string]*scheduler.Scheduler)
+	for _, rule := range pathRules {
+		s, ok := pathSchedulers[rule.Device]
+		if !ok {
+			fmt.Printf("using path device config: %s\n", pathConfigs[rule.Device])
+			s = newScheduler(pathConfigs[rule.Device])
+			pathSchedulers[rule.Device] = s
+			if pathConfigs[rule.Device].DirectoryEntryTime > 0 {
+				slowFs.SetCountEntries(true)
+			}
+			pathDeviceNames = append(pathDeviceNames, rule.Device)
+		}
+		slowFs.RoutePaths(rule.Device, []string{rule.Pattern}, s)
+	}
+
+	var metadataScheduler *scheduler.Scheduler
+	if metadataConfig != nil {
+		fmt.Printf("using metadata device config: %s\n", metadataConfig)
+		metadataScheduler = newScheduler(metadataConfig)
+		slowFs.RouteMetadata("metadata", metadataScheduler)
+		if metadataConfig.DirectoryEntryTime > 0 {
+			slowFs.SetCountEntries(true)
+		}
+	}
+
+	var replay *scheduler.Replay
+	if *replayFile != "" {
+		f, err := os.Open(*replayFile)
+		if err != nil {
+			log.Fatalf("couldn't open replay: %s", err)
+		}
+		records, err := trace.ReadRecords(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("couldn't read replay %s: %s", *replayFile, err)
+		}
+		if replay, err = trace.NewReplay(records); err != nil {
+			log.Fatalf("couldn't read replay %s: %s", *replayFile, err)
+		}
+		// The devices share the replay, so each recorded operation is replayed once.
+		deviceScheduler.SetReplay(replay)
+		if journalScheduler != nil {
+			journalScheduler.SetReplay(replay)
+		}
+		if metadataScheduler != nil {
+			metadataScheduler.SetReplay(replay)
+		}
+		for _, name := range pathDeviceNames {
+			pathSchedulers[name].SetReplay(replay)
+		}
+	}
+	go toggleTimeoutModeOnSignal(slowFs)
+
+	var decisions *decisionlog.Writer
+	if *decisionLog != "" {
+		f, err := os.Create(*decisionLog)
+		if err != nil {
+			log.Fatalf("couldn't create decision log: %s", err)
+		}
+		defer f.Close()
+		if decisions, err = decisionlog.NewWriter(f); err != nil {
+			log.Fatalf("couldn't write decision log: %s", err)
+		}
+		deviceScheduler.AddScheduleHook(decisions.Hook("main"))
+		if journalScheduler != nil {
+			journalScheduler.AddScheduleHook(decisions.Hook("journal"))
+		}
+		if metadataScheduler != nil {
+			metadataScheduler.AddScheduleHook(decisions.Hook("metadata"))
+		}
+		for _, name := range pathDeviceNames {
+			pathSchedulers[name].AddScheduleHook(decisions.Hook(name))
+		}
+		for _, m := range extraMounts {
+			m.Scheduler().AddScheduleHook(decisions.Hook(m.spec.MountDir))
+		}
+		go flushDecisionLog(decisions)
+	}
+
+	var traceWriter *trace.Writer
+	if *traceFile != "" {
+		if *traceSampleEvery < 0 || *traceSlowerThan < 0 {
+			log.Fatalf("flags trace-sample-every and trace-slower-than: cannot be negative")
+		}
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatalf("couldn't create trace: %s", err)
+		}
+		defer f.Close()
+		traceWriter = trace.NewWriter(f)
+		slowFs.AddOpHook(traceWriter.SampledHook(&trace.Sampler{Every: *traceSampleEvery, SlowerThan: *traceSlowerThan}))
+		go flushTrace(traceWriter)
+	}
+
+	var hazardTracker *hazards.Tracker
+	var hazardReport *os.File
+	if *hazardReportFile != "" {
+		hazardReport, err = os.Create(*hazardReportFile)
+		if err != nil {
+			log.Fatalf("couldn't create hazard report: %s", err)
+		}
+		defer hazardReport.Close()
+		hazardTracker = hazards.NewTracker()
+		slowFs.AddOpHook(hazardTracker.Hook())
+	}
+
+	if *quotaFile != "" {
+		data, err := ioutil.ReadFile(*quotaFile)
+		if err != nil {
+			log.Fatalf("couldn't read quotas %s: %s", *quotaFile, err)
+		}
+		limits, err := quota.ParseLimitsFromJSON(data)
+		if err != nil {
+			log.Fatalf("couldn't parse quotas %s: %s", *quotaFile, err)
+		}
+		quotas := quota.New(limits)
+		if err := quotas.Scan(*backingDir); err != nil {
+			log.Fatalf("couldn't add up quota usage in %s: %s", *backingDir, err)
+		}
+		slowFs.SetQuotas(quotas)
+	}
+
+	var schedule *faults.Schedule
+	if *faultSchedule != "" {
+		data, err := ioutil.ReadFile(*faultSchedule)
+		if err != nil {
+			log.Fatalf("couldn't read fault schedule %s: %s", *faultSchedule, err)
+		}
+		schedule, err = faults.ParseScheduleFromJSON(data)
+		if err != nil {
+			log.Fatalf("couldn't parse fault schedule %s: %s", *faultSchedule, err)
+		}
+	} else if *controlAddr != "" || *controlFile {
+		// Faults can still be injected through the control API.
+		schedule, _ = faults.NewSchedule(nil)
+	}
+	var injectors faults.Injectors
+	if schedule != nil {
+		injectors = append(injectors, schedule)
+	}
+	if *faultRamp != "" {
+		randomFaults, err := faults.ParseRandomFaultsFromString(*faultRamp, *faultSeed)
+		if err != nil {
+			log.Fatalf("flag fault-ramp: %s", err)
+		}
+		log.Printf("random faults seeded with %d", *faultSeed)
+		injectors = append(injectors, randomFaults)
+	}
+	interrupts := false
+	for _, p := range []float64{*eintrProbability, *shortReadProbability, *shortWriteProbability} {
+		if p < 0 || p > 1 {
+			log.Fatalf("flags eintr-probability, short-read-probability and short-write-probability: must be between 0 and 1")
+		}
+		interrupts = interrupts || p > 0
+	}
+	if interrupts {
+		if *faultRamp == "" {
+			log.Printf("random faults seeded with %d", *faultSeed)
+		}
+		injectors = append(injectors, faults.NewInterruptFaults(*eintrProbability, *shortReadProbability, *shortWriteProbability, *faultSeed))
+	}
+	slowFs.SetDirectIO(*shortReadProbability > 0)
+	if len(injectors) > 0 {
+		slowFs.SetFaultInjector(injectors)
+	}
+	if *readdirFaultProbability > 0 {
+		if *faultRamp == "" && !interrupts {
+			log.Printf("random faults seeded with %d", *faultSeed)
+		}
+		slowFs.SetListingFaults(faults.NewListingFaults(*readdirFaultProbability, *faultSeed))
+	}
+
+	var startTime time.Time
+	var ruleEngine *rules.Engine
+	if *rulesFile != "" {
+		data, err := ioutil.ReadFile(*rulesFile)
+		if err != nil {
+			log.Fatalf("couldn't read rules %s: %s", *rulesFile, err)
+		}
+		rs, err := rules.ParseRulesFromJSON(data)
+		if err != nil {
+			log.Fatalf("couldn't parse rules %s: %s", *rulesFile, err)
+		}
+		ruleEngine, err = rules.NewEngine(rs, map[string]func() float64{
+			"queued": func() float64 {
+				return float64(deviceScheduler.QueueStats().Queued)
+			},
+			"inflight": func() float64 {
+				return float64(deviceScheduler.QueueStats().InFlight)
+			},
+			"backlog": func() float64 {
+				stats := deviceScheduler.QueueStats()
+				return float64(stats.Queued + stats.InFlight)
+			},
+			"elapsed": func() float64 {
+				return slowFs.Now().Sub(startTime).Seconds()
+			},
+		}, deviceScheduler)
+		if err != nil {
+			log.Fatalf("invalid rules %s: %s", *rulesFile, err)
+		}
+	}
+
+	if *metricsAddr != "" {
+		registry := metrics.NewRegistry()
+		registerDeviceMetrics(registry, "slowfs_", "Requests", deviceScheduler)
+		if journalScheduler != nil {
+			registerDeviceMetrics(registry, "slowfs_journal_", "Journal device requests", journalScheduler)
+		}
+		if metadataScheduler != nil {
+			registerDeviceMetrics(registry, "slowfs_metadata_", "Metadata device requests", metadataScheduler)
+		}
+		for _, name := range pathDeviceNames {
+			registerDeviceMetrics(registry, "slowfs_"+metricName(name)+"_", fmt.Sprintf("Device %s requests", name), pathSchedulers[name])
+		}
+		for _, m := range extraMounts {
+			registerDeviceMetrics(registry, "slowfs_mount_"+metricName(strings.Trim(m.spec.MountDir, "/"))+"_", fmt.Sprintf("Mount %s requests", m.spec.MountDir), m.Scheduler())
+		}
+		registerDriftGauges(registry, slowFs)
+		if *maxOpenFiles > 0 {
+			registry.NewGaugeFunc("slowfs_open_files", "Files open, which --max-open-files limits.", func() float64 {
+				return float64(slowFs.OpenFiles())
+			})
+		}
+		delays := registry.NewHistogramVec("slowfs_delay_seconds", "How long operations were actually held back, by request type.", "type", latencyBuckets)
+		slowFs.AddDelayHook(func(req *scheduler.Request, delay time.Duration) {
+			delays.Observe(req.Type.String(), delay.Seconds())
+		})
+		http.Handle("/metrics", registry)
+		go func() {
+			log.Fatalf("serving metrics: %s", http.ListenAndServe(*metricsAddr, nil))
+		}()
+	}
+
+	if *controlAddr != "" || *controlFile {
+		controlServer := control.NewServer()
+		if *controlPolicy != "" {
+			data, err := ioutil.ReadFile(*controlPolicy)
+			if err != nil {
+				log.Fatalf("couldn't read control policy %s: %s", *controlPolicy, err)
+			}
+			policy, err := control.ParsePolicyFromJSON(data)
+			if err != nil {
+				log.Fatalf("couldn't parse control policy %s: %s", *controlPolicy, err)
+			}
+			controlServer.SetPolicy(policy)
+		}
+		controlled := []controlledMount{{slowFs, *mountDir}}
+		for _, m := range extraMounts {
+			controlled = append(controlled, controlledMount{m.SlowFs(), m.spec.MountDir})
+		}
+		registerControlCommands(controlServer, controlled, schedule)
+		if *controlFile {
+			slowFs.SetControlServer(controlServer)
+		}
+		if *controlAddr != "" {
+			l, err := control.Listen(*controlAddr)
+			if err != nil {
+				log.Fatalf("listening for control API: %s", err)
+			}
+			go func() {
+				log.Fatalf("serving control API: %s", controlServer.Serve(l))
+			}()
+		}
+	}
+
+	if err := fsServer.Mount(mountOpts.Kernel...); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if *startupDelay < 0 {
+		log.Fatalf("flag startup-delay: cannot be negative")
+	}
+	slowFs.SetStartupDelay(*startupDelay)
+	for i, m := range extraMounts {
+		if err := m.Mount(); err != nil {
+			// Don't leave the mounts made so far behind.
+			fsServer.Unmount()
+			for _, mounted := range extraMounts[:i] {
+				mounted.Unmount()
+			}
+			log.Fatalf("%v", err)
+		}
+		m.SlowFs().SetStartupDelay(*startupDelay)
+	}
+
+	// Faults are timed in simulated time, like the operations they're injected into.
+	startTime = slowFs.Now()
+	injectors.Start(startTime)
+	if ruleEngine != nil {
+		go ruleEngine.Run(ruleCheckInterval)
+	}
+	go unmountOnSignal(fsServer)
+	for _, m := range extraMounts {
+		go unmountOnSignal(m.Server)
+		go m.Serve()
+	}
+	if *compareCommand != "" {
+		go compare(fsServer, *compareCommand)
+	}
+	fsServer.Serve()
+	for _, m := range extraMounts {
+		m.unmount()
+	}
+
+	if decisions != nil {
+		if err := decisions.Flush(); err != nil {
+			log.Printf("couldn't write decision log: %s", err)
+		}
+	}
+	if replay != nil && replay.Remaining() > 0 {
+		log.Printf("%d recorded operations weren't replayed", replay.Remaining())
+	}
+	if traceWriter != nil {
+		if err := traceWriter.Flush(); err != nil {
+			log.Printf("couldn't write trace: %s", err)
+		}
+	}
+	if hazardTracker != nil {
+		if err := hazardTracker.WriteReport(hazardReport); err != nil {
+			log.Printf("couldn't write hazard report: %s", err)
+		}
+	}
+}
+
+// registerDeviceMetrics exports what the device simulated by s is doing: its queue, the requests
+// it costs and how long they take, and the data it hasn't written yet.
+func registerDeviceMetrics(registry *metrics.Registry, prefix, description string, s *scheduler.Scheduler) {
+	registry.NewGaugeFunc(prefix+"queued_requests", description+" waiting to be scheduled.", func() float64 {
+		return float64(s.QueueStats().Queued)
+	})
+	registry.NewGaugeFunc(prefix+"inflight_requests", description+" scheduled but not yet completed.", func() float64 {
+		return float64(s.QueueStats().InFlight)
+	})
+	registry.NewGaugeFunc(prefix+"device_queue_requests", description+" in the device's queue, which QueueDepth limits.", func() float64 {
+		return float64(s.State().DeviceQueue)
+	})
+	registry.NewGaugeFunc(prefix+"queue_waiting_requests", description+" waiting for a slot in the device's queue.", func() float64 {
+		return float64(s.State().QueueWaiting)
+	})
+	registry.NewGaugeFunc(prefix+"unwritten_bytes", "Bytes waiting in the write back cache.", func() float64 {
+		state := s.State()
+		total := state.OrphanedUnwrittenBytes
+		for _, n := range state.UnwrittenBytes {
+			total += n
+		}
+		return float64(total)
+	})
+	registry.NewGaugeFunc(prefix+"read_cache_bytes", "Bytes of read data cached in memory.", func() float64 {
+		return float64(s.State().ReadCacheBytes)
+	})
+	registry.NewGaugeFunc(prefix+"upload_backlog_bytes", "Bytes a cloud gateway has yet to upload.", func() float64 {
+		var total units.NumBytes
+		for _, n := range s.State().UploadBacklog {
+			total += n
+		}
+		return float64(total)
+	})
+
+	requests := registry.NewCounterVec(prefix+"requests_total", description+" scheduled, by type.", "type")
+	bytes := registry.NewCounterVec(prefix+"request_bytes_total", "Bytes read, written, listed or otherwise requested, by request type.", "type")
+	latencies := registry.NewHistogramVec(prefix+"request_duration_seconds", "Simulated time requests take, by type.", "type", latencyBuckets)
+	verify := registry.NewCounterVec(prefix+"verify_seconds_total", "Simulated time spent reading back written data to verify it, with VerifyWrites, by request type.", "type")
+	misaligned := registry.NewCounterVec(prefix+"misaligned_requests_total", "Reads and writes not aligned to AlignmentBytes which paid MisalignmentPenalty, by request type.", "type")
+	s.AddScheduleHook(func(c *scheduler.ScheduledRequest) {
+		t := c.Request.Type.String()
+		requests.Add(t, 1)
+		bytes.Add(t, float64(c.Request.Size))
+		latencies.Observe(t, c.Cost.Total().Seconds())
+		if c.Cost.Verify > 0 {
+			verify.Add(t, c.Cost.Verify.Seconds())
+		}
+		if c.Cost.Alignment > 0 {
+			misaligned.Add(t, 1)
+		}
+	})
+}
+
+// metricName turns a device config's name into something which can be part of a metric name.
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// registerDriftGauges exports how far the latencies slowFs delivers are from the modeled ones.
+func registerDriftGauges(registry *metrics.Registry, slowFs *fuselayer.SlowFs) {
+	registry.NewGaugeFunc("slowfs_drift_mean_seconds", "Mean time operations completed later than modeled.", func() float64 {
+		return slowFs.DriftStats().Mean.Seconds()
+	})
+	registry.NewGaugeFunc("slowfs_drift_max_seconds", "Longest time an operation completed later than modeled.", func() float64 {
+		return slowFs.DriftStats().Max.Seconds()
+	})
+	registry.NewGaugeFunc("slowfs_drift_compensation_seconds", "How much earlier than modeled operations are woken.", func() float64 {
+		return slowFs.DriftStats().Compensation.Seconds()
+	})
+}
+
+// registerControlCommands adds the commands for controlling the mounts to the control API. Commands
+// acting on a mount take mount=, its directory, defaulting to the first, the main mount. Quotas and
+// faults only apply to the main mount.
+func registerControlCommands(s *control.Server, controlled []controlledMount, schedule *faults.Schedule) {
+	s.HandleCommand("stats", "report statistics, as in the stats file", control.StatsRole, func(args url.Values) (string, error) {
+		m, err := findMount(controlled, args)
+		if err != nil {
+			return "", err
+		}
+		return string(m.slowFs.Stats()), nil
+	})
+
+	// Every mount shares the clock.
+	if clock := controlled[0].slowFs.VirtualClock(); clock != nil {
+		s.HandleCommand("clock", "report how much simulated time has passed", control.StatsRole, func(args url.Values) (string, error) {
+			elapsed := clock.Elapsed()
+			return fmt.Sprintf("elapsed %s\nelapsed_ns %d\n", elapsed, elapsed), nil
+		})
+	}
+
+	if q := controlled[0].slowFs.Quotas(); q != nil {
+		s.HandleCommand("quota", "report how much of each quota is used", control.StatsRole, func(args url.Values) (string, error) {
+			return q.Report(), nil
+		})
+	}
+
+	s.HandleCommand("drop-caches", "drop simulated caches; kernel=true also invalidates the kernel's caches", control.ConfigRole, func(args url.Values) (string, error) {
+		m, err := findMount(controlled, args)
+		if err != nil {
+			return "", err
+		}
+		kernel, err := control.ParseBool(args, "kernel")
+		if err != nil {
+			return "", err
+		}
+		m.slowFs.DropCaches()
+		if kernel {
+			if err := m.slowFs.InvalidateKernelCache(); err != nil {
+				return "", err
+			}
+		}
+		return "ok\n", nil
+	})
+
+	s.HandleCommand("warm-cache", "cache each path=file or directory; kernel=true also reads them into the kernel's cache", control.ConfigRole, func(args url.Values) (string, error) {
+		m, err := findMount(controlled, args)
+		if err != nil {
+			return "", err
+		}
+		kernel, err := control.ParseBool(args, "kernel")
+		if err != nil {
+			return "", err
+		}
+		warmed, err := m.slowFs.WarmCache(args["path"])
+		if err != nil {
+			return "", err
+		}
+		if kernel {
+			// The simulated cache is warm now, so reading through the mount is quick.
+			for _, p := range warmed {
+				if err := readFile(filepath.Join(m.mountDir, p)); err != nil {
+					return "", err
+				}
+			}
+		}
+		return fmt.Sprintf("warmed %d files\n", len(warmed)), nil
+	})
+
+	s.HandleCommand("config", "report the config of device= (default the main device)", control.StatsRole, func(args url.Values) (string, error) {
+		m, err := findMount(controlled, args)
+		if err != nil {
+			return "", err
+		}
+		device, err := m.slowFs.Device(args.Get("device"))
+		if err != nil {
+			return "", err
+		}
+		config := device.Config()
+		return config.String() + "\n", nil
+	})
+
+	s.HandleCommand("set-config", "set config fields of device= (default the main device), e.g. SeekTime=5ms FsyncStrategy=dumb", control.ConfigRole, func(args url.Values) (string, error) {
+		m, err := findMount(controlled, args)
+		if err != nil {
+			return "", err
+		}
+		device, err := m.slowFs.Device(args.Get("device"))
+		if err != nil {
+			return "", err
+		}
+		var names []string
+		for name := range args {
+			if name != "device" && name != "mount" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return "", errors.New("no fields given")
+		}
+		sort.Strings(names)
+		// Fields are all set at once, so that a sweep never runs with a half-updated config.
+		err = device.UpdateConfig(func(config *slowfs.DeviceConfig) error {
+			for _, name := range names {
+				if err := config.SetField(name, args.Get(name)); err != nil {
+					return fmt.Errorf("%s: %s", name, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return "ok\n", nil
+	})
+
+	s.HandleCommand("pause", "hold back every operation until resume, as if the device stopped responding", control.FaultRole, func(args url.Values) (string, error) {
+		m, err := findMount(controlled, args)
+		if err != nil {
+			return "", err
+		}
+		m.slowFs.Pause()
+		return "ok\n", nil
+	})
+
+	s.HandleCommand("resume", "let operations held back by pause continue", control.FaultRole, func(args url.Values) (string, error) {
+		m, err := findMount(controlled, args)
+		if err != nil {
+			return "", err
+		}
+		m.slowFs.Resume()
+		return "ok\n", nil
+	})
+
+	s.HandleCommand("stall-uplink", "stop cloud gateways uploading for duration=, e.g. 30s, as if their connection dropped", control.FaultRole, func(args url.Values) (string, error) {
+		m, err := findMount(controlled, args)
+		if err != nil {
+			return "", err
+		}
+		d, err := time.ParseDuration(args.Get("duration"))
+		if err != nil {
+			return "", fmt.Errorf("duration: %s", err)
+		}
+		if err := m.slowFs.StallUplink(d); err != nil {
+			return "", err
+		}
+		return "ok\n", nil
+	})
+
+	s.HandleCommand("inject-fault", "inject a fault as in fault schedules, with at= measured from now (default 0s)", control.FaultRole, func(args url.Values) (string, error) {
+		spec := faults.ScheduledFaultSpec{
+			At:         args.Get("at"),
+			Op:         args.Get("op"),
+			Path:       args.Get("path"),
+			Error:      args.Get("error"),
+			AfterBytes: args.Get("afterbytes"),
+			Duration:   args.Get("duration"),
+		}
+		if spec.At == "" {
+			spec.At = "0s"
+		}
+		var err error
+		if spec.Partial, err = control.ParseBool(args, "partial"); err != nil {
+			return "", err
+		}
+		if count := args.Get("count"); count != "" {
+			if spec.Count, err = strconv.Atoi(count); err != nil {
+				return "", fmt.Errorf("count: %s", err)
+			}
+		}
+		f, err := spec.Parse()
+		if err != nil {
+			return "", err
+		}
+		if err := schedule.Add(f, controlled[0].slowFs.Now()); err != nil {
+			return "", err
+		}
+		return "ok\n", nil
+	})
+}
+
+// controlledMount is a mount the control API acts on.
+type controlledMount struct {
+	slowFs   *fuselayer.SlowFs
+	mountDir string
+}
+
+// findMount returns the mount named by args' mount=, or the main mount if there is none.
+func findMount(controlled []controlledMount, args url.Values) (controlledMount, error) {
+	dir := args.Get("mount")
+	if dir == "" {
+		return controlled[0], nil
+	}
+	for _, m := range controlled {
+		if m.mountDir == filepath.Clean(dir) {
+			return m, nil
+		}
+	}
+	return controlledMount{}, fmt.Errorf("unknown mount %s", dir)
+}
+
+// flushDecisionLog writes buffered decisions out every second, so that little is lost if slowfs is
+// killed.
+func flushDecisionLog(w *decisionlog.Writer) {
+	for range time.Tick(time.Second) {
+		if err := w.Flush(); err != nil {
+			log.Printf("couldn't write decision log: %s", err)
+		}
+	}
+}
+
+// flushTrace writes buffered trace records out every second, like flushDecisionLog.
+func flushTrace(w *trace.Writer) {
+	for range time.Tick(time.Second) {
+		if err := w.Flush(); err != nil {
+			log.Printf("couldn't write trace: %s", err)
+		}
+	}
+}
+
+// loadDeviceConfigs returns the built-in device configs, and those in configFile if it is set,
+// by name.
+func loadDeviceConfigs(configFile string) map[string]*slowfs.DeviceConfig {
+	configs := map[string]*slowfs.DeviceConfig{
+		slowfs.HDD7200RpmDeviceConfig.Name: &slowfs.HDD7200RpmDeviceConfig,
+		slowfs.NFSDeviceConfig.Name:        &slowfs.NFSDeviceConfig,
+		slowfs.SSDDeviceConfig.Name:        &slowfs.SSDDeviceConfig,
+		slowfs.NVMeDeviceConfig.Name:       &slowfs.NVMeDeviceConfig,
+		slowfs.PMEMDeviceConfig.Name:       &slowfs.PMEMDeviceConfig,
+	}
+	if configFile != "" {
+		dcs, err := slowfs.LoadDeviceConfigsFromFile(configFile)
+		if err != nil {
+			log.Fatalf("couldn't load config file: %s", err)
+		}
+		for _, dc := range dcs {
+			if _, ok := configs[dc.Name]; ok {
+				log.Fatalf("duplicate device config with name '%s'", dc.Name)
+			}
+			configs[dc.Name] = dc
+		}
+	}
+	return configs
+}
+
+// deviceConfig returns a copy of the config called name in configs, so that overriding its
+// settings, as flags do for the main device, leaves other devices using the same config alone.
+func deviceConfig(configs map[string]*slowfs.DeviceConfig, name string) (*slowfs.DeviceConfig, bool) {
+	c, ok := configs[name]
+	if !ok {
+		return nil, false
+	}
+	config := *c
+	return &config, true
+}
+
+// metadataDeviceConfig returns a copy of the config called name in configs, for simulating a
+// device's metadata device with.
+func metadataDeviceConfig(configs map[string]*slowfs.DeviceConfig, name string) (*slowfs.DeviceConfig, error) {
+	config, ok := deviceConfig(configs, name)
+	if !ok {
+		return nil, fmt.Errorf("unknown metadata device config %s", name)
+	}
+	if config.MetadataDevice != "" {
+		return nil, fmt.Errorf("metadata device config %s can't have its own metadata device", config.Name)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("error validating metadata device config: %s", err)
+	}
+	return config, nil
+}
+
+// runCost runs "slowfs cost", which prints what a single request would cost on a freshly started
+// device, for test harnesses which can't use the scheduler package directly.
+func runCost(args []string) {
+	flags := flag.NewFlagSet("cost", flag.ExitOnError)
+	configFile := flags.String("config-file", "", "path to config file listing device configurations, as for slowfs")
+	configName := flags.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm, ssd, nvme, pmem, nfs)")
+	op := flags.String("op", "", "request type, e.g. read, write, fsync or metadata")
+	path := flags.String("path", "file", "path the request is for")
+	offset := flags.String("offset", "0", "offset of the request in bytes, or with units, e.g. 4KiB")
+	size := flags.String("bytes", "0", "size of the request in bytes, or with units, e.g. 1MiB")
+	flags.Parse(args)
+
+	if *op == "" {
+		log.Fatalf("argument op is required.")
+	}
+	config, ok := loadDeviceConfigs(*configFile)[*configName]
+	if !ok {
+		log.Fatalf("unknown config %s", *configName)
+	}
+	req := &scheduler.Request{Timestamp: time.Now(), Path: *path}
+	var err error
+	if req.Type, err = scheduler.ParseRequestTypeFromString(*op); err != nil {
+		log.Fatalf("flag op: %s", err)
+	}
+	if req.Start, err = parseByteCount(*offset); err != nil {
+		log.Fatalf("flag offset: %s", err)
+	}
+	if req.Size, err = parseByteCount(*size); err != nil {
+		log.Fatalf("flag bytes: %s", err)
+	}
+
+	cost, err := scheduler.New(config).ScheduleCost(context.Background(), req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("op %s\n%s", req.Type, cost.Breakdown())
+}
+
+// isolateFromHost pins slowfs's threads to cpus, if given, sets their nice value and locks its
+// memory, so that other processes add less noise to latencies. Each lacks privileges on many hosts,
+// in which case slowfs carries on without it.
+func isolateFromHost(cpus string, nice int, mlock bool) {
+	if cpus != "" {
+		list, err := isolation.ParseCPUListFromString(cpus)
+		if err != nil {
+			log.Fatalf("flag pin-cpus: %s", err)
+		}
+		if err := isolation.PinCPUs(list); err != nil {
+			log.Printf("couldn't pin threads to CPUs %s, continuing unpinned: %s", cpus, err)
+		}
+	}
+	if nice != 0 {
+		if err := isolation.SetNice(nice); err != nil {
+			log.Printf("couldn't set nice value to %d, continuing at the default priority: %s", nice, err)
+		}
+	}
+	if mlock {
+		if err := isolation.LockMemory(); err != nil {
+			log.Printf("couldn't lock memory, continuing unlocked: %s", err)
+		}
+	}
+}
+
+// runCheckDeterminism runs "slowfs check-determinism", which simulates a recorded trace several
+// times with the same config and seed, and reports any operations whose modeled costs differ, which
+// would mean the scheduler is nondeterministic.
+func runCheckDeterminism(args []string) {
+	flags := flag.NewFlagSet("check-determinism", flag.ExitOnError)
+	configFile := flags.String("config-file", "", "path to config file listing device configurations, as for slowfs")
+	configName := flags.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm, ssd, nvme, pmem, nfs)")
+	traceFile := flags.String("trace", "", "trace to simulate, as written by --trace")
+	seed := flags.Int64("seed", 1, "seed for the device's random choices, the same for every run")
+	runs := flags.Int("runs", 2, "how many times to simulate the trace")
+	maxDiffs := flags.Int("max-diffs", 10, "how many differing operations to print")
+	flags.Parse(args)
+
+	if *traceFile == "" {
+		log.Fatalf("argument trace is required.")
+	}
+	if *runs < 2 {
+		log.Fatalf("flag runs: must be at least 2")
+	}
+	config, ok := loadDeviceConfigs(*configFile)[*configName]
+	if !ok {
+		log.Fatalf("unknown config %s", *configName)
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("error validating config: %s", err)
+	}
+	f, err := os.Open(*traceFile)
+	if err != nil {
+		log.Fatalf("couldn't open trace: %s", err)
+	}
+	records, err := trace.ReadRecords(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("couldn't read trace %s: %s", *traceFile, err)
+	}
+
+	first, err := trace.Simulate(records, config, *seed)
+	if err != nil {
+		log.Fatalf("couldn't simulate trace: %s", err)
+	}
+	deterministic := true
+	for run := 2; run <= *runs; run++ {
+		steps, err := trace.Simulate(records, config, *seed)
+		if err != nil {
+			log.Fatalf("couldn't simulate trace: %s", err)
+		}
+		diffs := trace.Diff(first, steps)
+		if len(diffs) == 0 {
+			continue
+		}
+		deterministic = false
+		fmt.Printf("run %d: %d of %d operations differ from run 1\n", run, len(diffs), len(first))
+		for i := range diffs {
+			if i == *maxDiffs {
+				fmt.Printf("  ...\n")
+				break
+			}
+			fmt.Printf("  %s\n", &diffs[i])
+		}
+	}
+	if !deterministic {
+		os.Exit(1)
+	}
+	fmt.Printf("%d runs of %d operations matched\n", *runs, len(first))
+}
+
+// runNBD runs "slowfs nbd", which exports a file as a network block device simulating the
+// configured device, to be formatted with any filesystem.
+func runNBD(args []string) {
+	flags := flag.NewFlagSet("nbd", flag.ExitOnError)
+	configFile := flags.String("config-file", "", "path to config file listing device configurations, as for slowfs")
+	configName := flags.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm, ssd, nvme, pmem, nfs)")
+	file := flags.String("file", "", "file to store the block device's data in")
+	size := flags.String("size", "", "size to grow the file to first, if it is smaller, e.g. 10GiB")
+	name := flags.String("name", "disk", "name of the export")
+	listen := flags.String("listen", "", "address to serve NBD on, either unix:/path/to/socket or host:port")
+	spin := flags.Duration("spin", 0, "how long before each request completes to stop sleeping and spin instead, as for slowfs")
+	flags.Parse(args)
+
+	if *file == "" || *listen == "" {
+		log.Fatalf("arguments file and listen are required.")
+	}
+	config, ok := loadDeviceConfigs(*configFile)[*configName]
+	if !ok {
+		log.Fatalf("unknown config %s", *configName)
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("error validating config: %s", err)
+	}
+
+	f, err := os.OpenFile(*file, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		log.Fatalf("couldn't open file: %s", err)
+	}
+	defer f.Close()
+	if *size != "" {
+		n, err := units.ParseNumBytesFromString(*size)
+		if err != nil {
+			log.Fatalf("flag size: %s", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			log.Fatalf("couldn't stat file: %s", err)
+		}
+		if info.Size() < int64(n) {
+			if err := f.Truncate(int64(n)); err != nil {
+				log.Fatalf("couldn't grow file: %s", err)
+			}
+		}
+	}
+
+	s, err := nbd.NewServer(f, *name, scheduler.New(config))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *spin < 0 {
+		log.Fatalf("flag spin: cannot be negative")
+	}
+	s.SetSpin(*spin)
+	l, err := control.Listen(*listen)
+	if err != nil {
+		log.Fatalf("listening for NBD: %s", err)
+	}
+	fmt.Printf("using config: %s\n", config)
+	log.Printf("exporting %s as %s on %s", *file, *name, *listen)
+	log.Fatal(s.Serve(l))
+}
+
+// parseByteCount parses a plain number of bytes, as harnesses usually have, or a size with units.
+func parseByteCount(s string) (units.NumBytes, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n >= 0 {
+		return units.NumBytes(n), nil
+	}
+	return units.ParseNumBytesFromString(s)
+}
+
+// runCtl runs "slowfs ctl", which sends a single command to a running slowfs if one is given, and
+// starts an interactive shell otherwise.
+func runCtl(args []string) {
+	flags := flag.NewFlagSet("ctl", flag.ExitOnError)
+	addr := flags.String("addr", "", "control API address of the running slowfs, as given to --control-addr")
+	token := flags.String("token", "", "bearer token to authenticate with")
+	flags.Parse(args)
+
+	if *addr == "" {
+		log.Fatalf("argument addr is required.")
+	}
+	client := control.NewClient(*addr)
+	client.SetToken(*token)
+	shell := ctl.NewShell(client, os.Stdout)
+
+	if flags.NArg() > 0 {
+		if err := shell.RunLine(strings.Join(flags.Args(), " ")); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := shell.Run(os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runMount runs "slowfs mount", which mounts entries of an fstab style file, each with its own
+// slowfs process, and waits for them, passing on signals to unmount them all. Entries already
+// mounted are skipped, and stale mounts left by a crashed slowfs cleaned up, so it can be rerun to
+// bring back whichever mounts went away.
+func runMount(args []string) {
+	flags := flag.NewFlagSet("mount", flag.ExitOnError)
+	fstab := flags.String("fstab", slowfs.DefaultFstabPath, "path to the fstab style file listing mounts")
+	all := flags.Bool("a", false, "mount every entry without the noauto option")
+	flags.Parse(args)
+
+	if *all == (flags.NArg() > 0) {
+		log.Fatalf("give either -a or the mount directories to mount.")
+	}
+	entries, err := slowfs.LoadFstabFromFile(*fstab)
+	if err != nil {
+		log.Fatalf("couldn't load fstab: %s", err)
+	}
+	var selected []*slowfs.FstabEntry
+	if *all {
+		for _, e := range entries {
+			if e.Auto {
+				selected = append(selected, e)
+			}
+		}
+	}
+	for _, dir := range flags.Args() {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatalf("invalid mount directory: %s", err)
+		}
+		found := false
+		for _, e := range entries {
+			if e.MountDir == dir {
+				selected, found = append(selected, e), true
+			}
+		}
+		if !found {
+			log.Fatalf("%s isn't listed in %s", dir, *fstab)
+		}
+	}
+
+	mountTable, err := mounts.ReadMountInfo()
+	if err != nil {
+		log.Printf("couldn't read mount table, mounting over any existing mounts: %s", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("couldn't find slowfs executable: %s", err)
+	}
+	var cmds []*exec.Cmd
+	var mounted []*slowfs.FstabEntry
+	for _, e := range selected {
+		args := e.Args()
+		if mounts.IsStale(e.MountDir) {
+			args = append(args, "--force-cleanup")
+		} else if m := mounts.FindMount(mountTable, e.MountDir); m != nil && m.MountPoint == e.MountDir && m.IsFuse() {
+			log.Printf("%s is already mounted, skipping", e.MountDir)
+			continue
+		}
+		cmd := exec.Command(exe, args...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Start(); err != nil {
+			log.Fatalf("couldn't start slowfs for %s: %s", e.MountDir, err)
+		}
+		log.Printf("mounting %s at %s with %s", e.BackingDir, e.MountDir, e.ConfigName)
+		cmds, mounted = append(cmds, cmd), append(mounted, e)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range sigs {
+			for _, cmd := range cmds {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+	failed := false
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("slowfs for %s exited: %s", mounted[i].MountDir, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// compare runs command in s's mount directory in passthrough mode and then simulated, reports how
+// long each run's operations took, and then unmounts.
+func compare(s *server.Server, command string) {
+	if err := s.WaitMount(); err != nil {
+		log.Fatalf("waiting for mount: %s", err)
+	}
+	slowFs := s.SlowFs()
+	var c fuselayer.Comparison
+	for _, passthrough := range []bool{true, false} {
+		// Start both runs from the same cold caches.
+		slowFs.DropCaches()
+		if err := slowFs.InvalidateKernelCache(); err != nil {
+			log.Printf("couldn't invalidate kernel cache: %s", err)
+		}
+		slowFs.SetPassthrough(passthrough)
+		slowFs.TakeOpTimes()
+
+		cmd := exec.Command("/bin/sh", "-c", command)
+		cmd.Dir = s.MountDir()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		start := time.Now()
+		if err := cmd.Run(); err != nil {
+			log.Printf("compare-command failed: %s", err)
+		}
+		run := fuselayer.RunTimes{Wall: time.Since(start), Ops: slowFs.TakeOpTimes()}
+		if passthrough {
+			c.Passthrough = run
+		} else {
+			c.Simulated = run
+		}
+	}
+	if err := c.WriteReport(os.Stdout); err != nil {
+		log.Printf("couldn't write comparison: %s", err)
+	}
+
+	if err := s.Unmount(); err != nil {
+		log.Printf("couldn't unmount: %s", err)
+	}
+}
+
+func readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(ioutil.Discard, f)
+	return err
+}
+
+// mountSpecs collects the mounts given with --mount.
+type mountSpecs []slowfs.MountSpec
+
+func (m *mountSpecs) String() string {
+	var specs []string
+	for _, spec := range *m {
+		specs = append(specs, spec.String())
+	}
+	return strings.Join(specs, ",")
+}
+
+func (m *mountSpecs) Set(s string) error {
+	spec, err := slowfs.ParseMountSpecFromString(s)
+	if err != nil {
+		return err
+	}
+	*m = append(*m, spec)
+	return nil
+}
+
+// extraMount is a mount given with --mount, served alongside the main one with its own device.
+type extraMount struct {
+	spec slowfs.MountSpec
+	*server.Server
+}
+
+// newExtraMount checks a mount given with --mount, like the main mount, and sets up its device.
+// Its config is used as is, without the main device's overrides.
+func newExtraMount(spec slowfs.MountSpec, configs map[string]*slowfs.DeviceConfig, mountTable []*mounts.Mount, forceCleanup bool) (*extraMount, error) {
+	var err error
+	if spec.BackingDir, err = filepath.Abs(spec.BackingDir); err != nil {
+		return nil, fmt.Errorf("invalid backing directory: %s", err)
+	}
+	if spec.MountDir, err = filepath.Abs(spec.MountDir); err != nil {
+		return nil, fmt.Errorf("invalid mount directory: %s", err)
+	}
+	if mounts.IsStale(spec.MountDir) {
+		if !forceCleanup {
+			return nil, fmt.Errorf("mount directory %s has a stale mount, probably left by a crashed slowfs. "+
+				"Rerun with --force-cleanup, or run fusermount -u %s", spec.MountDir, spec.MountDir)
+		}
+		if err := mounts.Unmount(spec.MountDir); err != nil {
+			return nil, fmt.Errorf("couldn't clean up stale mount at %s: %s", spec.MountDir, err)
+		}
+		log.Printf("cleaned up stale mount at %s", spec.MountDir)
+	}
+	if err := mounts.CheckMountDirs(spec.BackingDir, spec.MountDir, mountTable); err != nil {
+		return nil, err
+	}
+
+	config, err := extraMountConfig(configs, spec.Config)
+	if err != nil {
+		return nil, err
+	}
+	s, err := server.New(spec.BackingDir, spec.MountDir, config)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("using config for %s: %s\n", spec.MountDir, config)
+	return &extraMount{spec: spec, Server: s}, nil
+}
+
+// extraMountConfig returns a copy of the config called name in configs, for a mount given with
+// --mount.
+func extraMountConfig(configs map[string]*slowfs.DeviceConfig, name string) (*slowfs.DeviceConfig, error) {
+	config, ok := deviceConfig(configs, name)
+	if !ok {
+		return nil, fmt.Errorf("unknown config %s", name)
+	}
+	if config.MetadataDevice != "" {
+		return nil, fmt.Errorf("config %s has a metadata device, which only the main mount supports", config.Name)
+	}
+	return config, nil
+}
+
+// unmount unmounts the filesystem, if it hasn't been already, and waits for it to stop serving,
+// unless it is busy.
+func (m *extraMount) unmount() {
+	if err := m.Stop(); err != nil {
+		log.Printf("couldn't unmount: %s", err)
+	}
+}
+
+// unmountOnSignal shuts slowfs down cleanly when interrupted or terminated: operations waiting for
+// the simulated device fail straight away, so that the mount isn't busy and can be unmounted,
+// rather than being left stale.
+func unmountOnSignal(s *server.Server) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range sigs {
+		log.Printf("received %s, unmounting", sig)
+		if err := s.Unmount(); err != nil {
+			log.Printf("couldn't unmount, send the signal again to retry: %s", err)
+			continue
+		}
+		return
+	}
+}
+
+// toggleTimeoutModeOnSignal switches between soft and hard timeouts each time SIGUSR1 is received.
+func toggleTimeoutModeOnSignal(slowFs *fuselayer.SlowFs) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	for range sigs {
+		mode, timeout := slowFs.Timeout()
+		if mode == slowfs.SoftTimeout {
+			mode = slowfs.HardTimeout
+		} else {
+			mode = slowfs.SoftTimeout
+		}
+		slowFs.SetTimeout(mode, timeout)
+		log.Printf("switched to %s (timeout %s)", mode, timeout)
+	}
 }
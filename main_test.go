@@ -0,0 +1,106 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"slowfs/slowfs"
+	"testing"
+	"time"
+)
+
+func TestDeviceConfig_JournalKeepsBuiltIn(t *testing.T) {
+	configs := loadDeviceConfigs("")
+	config, ok := deviceConfig(configs, slowfs.SSDDeviceConfig.Name)
+	if !ok {
+		t.Fatalf("deviceConfig(%s) found nothing", slowfs.SSDDeviceConfig.Name)
+	}
+	// Overrides for the main device don't reach a journal simulated with the same config.
+	config.SeekTime = time.Second
+	journal, ok := deviceConfig(configs, slowfs.SSDDeviceConfig.Name)
+	if !ok {
+		t.Fatalf("deviceConfig(%s) found nothing", slowfs.SSDDeviceConfig.Name)
+	}
+	if got, want := journal.SeekTime, 90*time.Microsecond; got != want {
+		t.Errorf("journal SeekTime = %s, want %s", got, want)
+	}
+	if got, want := slowfs.SSDDeviceConfig.SeekTime, 90*time.Microsecond; got != want {
+		t.Errorf("built-in SeekTime = %s, want %s", got, want)
+	}
+
+	if _, ok := deviceConfig(configs, "missing"); ok {
+		t.Errorf("deviceConfig(missing) found a config, want none")
+	}
+}
+
+func TestMetadataDeviceConfig_SameModel(t *testing.T) {
+	configs := loadDeviceConfigs("")
+	config, _ := deviceConfig(configs, slowfs.SSDDeviceConfig.Name)
+	// As with --config-name=ssd --metadata-device=ssd.
+	config.MetadataDevice = slowfs.SSDDeviceConfig.Name
+
+	metadata, err := metadataDeviceConfig(configs, config.MetadataDevice)
+	if err != nil {
+		t.Fatalf("metadataDeviceConfig(%s) = _, %v, want nil", config.MetadataDevice, err)
+	}
+	if got, want := metadata.MetadataDevice, ""; got != want {
+		t.Errorf("metadata device's MetadataDevice = %q, want %q", got, want)
+	}
+
+	// A config which has a metadata device of its own can't be one.
+	configs["nested"] = &slowfs.DeviceConfig{Name: "nested", MetadataDevice: slowfs.SSDDeviceConfig.Name}
+	if _, err := metadataDeviceConfig(configs, "nested"); err == nil {
+		t.Errorf("metadataDeviceConfig(nested) = _, nil, want an error")
+	}
+	if _, err := metadataDeviceConfig(configs, "missing"); err == nil {
+		t.Errorf("metadataDeviceConfig(missing) = _, nil, want an error")
+	}
+}
+
+func TestDeviceConfig_PathDevicesKeepBuiltIn(t *testing.T) {
+	configs := loadDeviceConfigs("")
+	config, _ := deviceConfig(configs, slowfs.HDD7200RpmDeviceConfig.Name)
+	config.ReadBytesPerSecond = 1
+
+	// A path device rule naming the main device's config gets it without the main device's
+	// overrides.
+	pathConfig, ok := deviceConfig(configs, slowfs.HDD7200RpmDeviceConfig.Name)
+	if !ok {
+		t.Fatalf("deviceConfig(%s) found nothing", slowfs.HDD7200RpmDeviceConfig.Name)
+	}
+	if got, want := pathConfig.ReadBytesPerSecond, slowfs.HDD7200RpmDeviceConfig.ReadBytesPerSecond; got != want {
+		t.Errorf("path device ReadBytesPerSecond = %d, want %d", got, want)
+	}
+}
+
+func TestExtraMountConfig_SharesMainConfig(t *testing.T) {
+	configs := loadDeviceConfigs("")
+	config, _ := deviceConfig(configs, slowfs.SSDDeviceConfig.Name)
+	// As with --config-name=ssd --metadata-device=nvme --seek-time=1s --mount=src:dst:ssd.
+	config.MetadataDevice = slowfs.NVMeDeviceConfig.Name
+	config.SeekTime = time.Second
+
+	extra, err := extraMountConfig(configs, slowfs.SSDDeviceConfig.Name)
+	if err != nil {
+		t.Fatalf("extraMountConfig(%s) = _, %v, want nil", slowfs.SSDDeviceConfig.Name, err)
+	}
+	if got, want := extra.SeekTime, 90*time.Microsecond; got != want {
+		t.Errorf("extra mount SeekTime = %s, want %s", got, want)
+	}
+
+	configs["split"] = &slowfs.DeviceConfig{Name: "split", MetadataDevice: slowfs.SSDDeviceConfig.Name}
+	if _, err := extraMountConfig(configs, "split"); err == nil {
+		t.Errorf("extraMountConfig(split) = _, nil, want an error")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command slowfs-inspect queries a decision log written by slowfs --decision-log, e.g. to find
+// out why a request took as long as it did.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slowfs/slowfs/decisionlog"
+	"slowfs/slowfs/scheduler"
+	"sort"
+	"strings"
+	"time"
+)
+
+// match is a decision selected by the filter, along with the decisions on the same device which
+// preceded it.
+type match struct {
+	decision *decisionlog.Decision
+	context  []*decisionlog.Decision
+}
+
+func main() {
+	device := flag.String("device", "", "only show requests to this device, e.g. main, journal or metadata")
+	path := flag.String("path", "", "only show requests for paths matching this glob pattern")
+	types := flag.String("type", "", "only show these comma-separated request types, e.g. read,fsync")
+	minTotal := flag.Duration("min-total", 0, "only show requests which took at least this long")
+	from := flag.String("from", "", "only show requests made at or after this RFC 3339 time")
+	to := flag.String("to", "", "only show requests made before this RFC 3339 time")
+	slowest := flag.Int("slowest", 0, "if set, show only this many of the slowest matching requests")
+	context := flag.Int("context", 0, "also show this many preceding requests to the same device, which a request may have waited for")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] decision-log\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	filter := decisionlog.Filter{
+		Device:   *device,
+		Path:     *path,
+		MinTotal: *minTotal,
+	}
+	if *types != "" {
+		for _, s := range strings.Split(*types, ",") {
+			t, err := scheduler.ParseRequestTypeFromString(s)
+			if err != nil {
+				log.Fatalf("flag type: %s", err)
+			}
+			filter.Types = append(filter.Types, t)
+		}
+	}
+	var err error
+	if *from != "" {
+		if filter.From, err = time.Parse(time.RFC3339Nano, *from); err != nil {
+			log.Fatalf("flag from: %s", err)
+		}
+	}
+	if *to != "" {
+		if filter.To, err = time.Parse(time.RFC3339Nano, *to); err != nil {
+			log.Fatalf("flag to: %s", err)
+		}
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	r, err := decisionlog.NewReader(f)
+	if err != nil {
+		log.Fatalf("%s: %s", flag.Arg(0), err)
+	}
+
+	var matches []match
+	recent := make(map[string][]*decisionlog.Decision)
+	for {
+		d, err := r.Next()
+		if err == io.ErrUnexpectedEOF {
+			log.Printf("%s ends part way through a record, probably because slowfs was killed", flag.Arg(0))
+			break
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("%s: %s", flag.Arg(0), err)
+		}
+
+		if filter.Matches(d) {
+			m := match{decision: d, context: append([]*decisionlog.Decision(nil), recent[d.Device]...)}
+			if *slowest > 0 {
+				matches = append(matches, m)
+			} else {
+				printMatch(m)
+			}
+		}
+		if *context > 0 {
+			prev := append(recent[d.Device], d)
+			if len(prev) > *context {
+				prev = prev[1:]
+			}
+			recent[d.Device] = prev
+		}
+	}
+
+	if *slowest > 0 {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].decision.Cost.Total() > matches[j].decision.Cost.Total()
+		})
+		if len(matches) > *slowest {
+			matches = matches[:*slowest]
+		}
+		for _, m := range matches {
+			printMatch(m)
+		}
+	}
+}
+
+func printMatch(m match) {
+	if len(m.context) > 0 {
+		fmt.Println("---")
+		for _, d := range m.context {
+			fmt.Printf("  %s\n", d)
+		}
+	}
+	fmt.Println(m.decision)
+}
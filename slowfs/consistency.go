@@ -0,0 +1,65 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Consistency indicates when data written through one file handle becomes visible to others.
+type Consistency int
+
+const (
+	// LocalConsistency means writes are visible to every handle immediately, as on local
+	// filesystems.
+	LocalConsistency Consistency = iota
+	// CloseToOpenConsistency means writes are only visible through the handle which made them until
+	// it is closed or fsynced, after which files opened later see them, as on NFS.
+	CloseToOpenConsistency
+	// StrictCloseToOpenConsistency is like CloseToOpenConsistency, except that only closing the
+	// handle makes its writes visible, as on filesystems which upload whole files when they are
+	// closed.
+	StrictCloseToOpenConsistency
+)
+
+func (c Consistency) String() string {
+	switch c {
+	case LocalConsistency:
+		return "LocalConsistency"
+	case CloseToOpenConsistency:
+		return "CloseToOpenConsistency"
+	case StrictCloseToOpenConsistency:
+		return "StrictCloseToOpenConsistency"
+	default:
+		return "unknown consistency"
+	}
+}
+
+// ParseConsistencyFromString parses a Consistency from the given string. This function is case
+// insensitive, and also accepts synonyms for each Consistency. For example, closetoopen and cto
+// both map to CloseToOpenConsistency.
+func ParseConsistencyFromString(s string) (Consistency, error) {
+	switch strings.ToLower(s) {
+	case "localconsistency", "local":
+		return LocalConsistency, nil
+	case "closetoopenconsistency", "closetoopen", "cto":
+		return CloseToOpenConsistency, nil
+	case "strictclosetoopenconsistency", "strictclosetoopen", "strict-cto":
+		return StrictCloseToOpenConsistency, nil
+	default:
+		return 0, fmt.Errorf("unknown consistency %s", s)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConsistency_String(t *testing.T) {
+	cases := []struct {
+		consistency Consistency
+		want        string
+	}{
+		{LocalConsistency, "LocalConsistency"},
+		{CloseToOpenConsistency, "CloseToOpenConsistency"},
+		{StrictCloseToOpenConsistency, "StrictCloseToOpenConsistency"},
+		{12345, "unknown consistency"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.consistency.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.consistency, got, want)
+		}
+	}
+}
+
+func TestParseConsistencyFromString(t *testing.T) {
+	cases := []struct {
+		strConsistency string
+		want           Consistency
+		shouldErr      bool
+	}{
+		{"Local", LocalConsistency, false},
+		{"CTO", CloseToOpenConsistency, false},
+		{"closeToOpen", CloseToOpenConsistency, false},
+		{"strict-cto", StrictCloseToOpenConsistency, false},
+		{"StrictCloseToOpenConsistency", StrictCloseToOpenConsistency, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseConsistencyFromString(c.strConsistency)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseConsistencyFromString(%s) = %s, want %s", c.strConsistency, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseConsistencyFromString(%s) = _, %v, want _, %v", c.strConsistency, err, expectedErr)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Role is a set of permissions to run commands. Each command requires one role.
+type Role uint
+
+const (
+	// StatsRole allows reading statistics, which can't change the simulation.
+	StatsRole Role = 1 << iota
+	// ConfigRole allows changing the simulation, e.g. dropping caches.
+	ConfigRole
+	// FaultRole allows injecting faults.
+	FaultRole
+
+	// AllRoles is every role.
+	AllRoles = StatsRole | ConfigRole | FaultRole
+)
+
+var roleNames = []struct {
+	role Role
+	name string
+}{{StatsRole, "stats"}, {ConfigRole, "config"}, {FaultRole, "faults"}}
+
+func (r Role) String() string {
+	var names []string
+	for _, rn := range roleNames {
+		if r&rn.role != 0 {
+			names = append(names, rn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseRolesFromString parses a comma separated list of roles, e.g. "stats,config". "all" means
+// AllRoles.
+func ParseRolesFromString(s string) (Role, error) {
+	var roles Role
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "all" {
+			roles |= AllRoles
+			continue
+		}
+		found := false
+		for _, rn := range roleNames {
+			if rn.name == name {
+				roles |= rn.role
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown role %q", name)
+		}
+	}
+	return roles, nil
+}
+
+// Caller identifies who sent a request.
+type Caller struct {
+	// Token is the bearer token the request was sent with, if any.
+	Token string
+
+	// UID is the user ID of the peer, if HasUID is set. It is only known for Unix sockets.
+	UID    int
+	HasUID bool
+}
+
+// Grant gives roles to callers which match it.
+type Grant struct {
+	// Token, if set, must match the caller's bearer token.
+	Token string
+
+	// UID, if not negative, must match the caller's user ID.
+	UID int
+
+	Roles Role
+}
+
+func (g *Grant) matches(c Caller) bool {
+	if g.Token != "" && subtle.ConstantTimeCompare([]byte(g.Token), []byte(c.Token)) != 1 {
+		return false
+	}
+	if g.UID >= 0 && (!c.HasUID || g.UID != c.UID) {
+		return false
+	}
+	return true
+}
+
+// Policy decides which roles callers have: the union of the roles of every grant they match. A
+// grant with neither a token nor a UID matches every caller.
+type Policy struct {
+	Grants []Grant
+}
+
+// Roles returns the roles the given caller has.
+func (p *Policy) Roles(c Caller) Role {
+	var roles Role
+	for i := range p.Grants {
+		if p.Grants[i].matches(c) {
+			roles |= p.Grants[i].Roles
+		}
+	}
+	return roles
+}
+
+// ParsePolicyFromJSON parses a policy from a JSON array of grants. Like device configs, all values
+// are strings. For example:
+//
+//	[{"Roles": "stats"},
+//	 {"UID": "1000", "Roles": "all"},
+//	 {"Token": "s3cret", "Roles": "config,faults"}]
+func ParsePolicyFromJSON(data []byte) (*Policy, error) {
+	var jsonGrants []struct {
+		Token string
+		UID   string
+		Roles string
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&jsonGrants); err != nil {
+		return nil, err
+	}
+
+	p := &Policy{}
+	for i, j := range jsonGrants {
+		g := Grant{Token: j.Token, UID: -1}
+		if j.UID != "" {
+			uid, err := strconv.Atoi(j.UID)
+			if err != nil || uid < 0 {
+				return nil, fmt.Errorf("grant %d: invalid UID %q", i, j.UID)
+			}
+			g.UID = uid
+		}
+		roles, err := ParseRolesFromString(j.Roles)
+		if err != nil {
+			return nil, fmt.Errorf("grant %d: %s", i, err)
+		}
+		g.Roles = roles
+		p.Grants = append(p.Grants, g)
+	}
+	return p, nil
+}
+
+type peerUIDKey struct{}
+
+// Serve serves the control API on l. Unlike http.Serve, this identifies the user at the other end
+// of Unix sockets, so that grants with a UID can match.
+func (s *Server) Serve(l net.Listener) error {
+	server := &http.Server{
+		Handler: s,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			if unixConn, ok := conn.(*net.UnixConn); ok {
+				if uid, err := peerUID(unixConn); err == nil {
+					return context.WithValue(ctx, peerUIDKey{}, uid)
+				}
+			}
+			return ctx
+		},
+	}
+	return server.Serve(l)
+}
+
+func callerOf(req *http.Request) Caller {
+	var c Caller
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		c.Token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	c.UID, c.HasUID = req.Context().Value(peerUIDKey{}).(int)
+	return c
+}
@@ -0,0 +1,208 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseRolesFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      Role
+		shouldErr bool
+	}{
+		{"stats", StatsRole, false},
+		{"Stats, config", StatsRole | ConfigRole, false},
+		{"faults,stats", StatsRole | FaultRole, false},
+		{"all", AllRoles, false},
+		{"admin", 0, true},
+		{"", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRolesFromString(c.s)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseRolesFromString(%q) = %s, %v, want %s, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestRole_String(t *testing.T) {
+	cases := []struct {
+		role Role
+		want string
+	}{
+		{0, "none"},
+		{ConfigRole, "config"},
+		{AllRoles, "stats,config,faults"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.role.String(), c.want; got != want {
+			t.Errorf("Role(%d).String() = %s, want %s", uint(c.role), got, want)
+		}
+	}
+}
+
+func TestPolicy_Roles(t *testing.T) {
+	p := &Policy{Grants: []Grant{
+		{UID: -1, Roles: StatsRole},
+		{UID: 1000, Roles: ConfigRole},
+		{Token: "s3cret", UID: -1, Roles: FaultRole},
+		{Token: "both", UID: 1001, Roles: AllRoles},
+	}}
+	cases := []struct {
+		caller Caller
+		want   Role
+	}{
+		{Caller{}, StatsRole},
+		{Caller{UID: 1000}, StatsRole},
+		{Caller{UID: 1000, HasUID: true}, StatsRole | ConfigRole},
+		{Caller{Token: "s3cret"}, StatsRole | FaultRole},
+		{Caller{Token: "s3cre"}, StatsRole},
+		{Caller{Token: "both", UID: 1000, HasUID: true}, StatsRole | ConfigRole},
+		{Caller{Token: "both", UID: 1001, HasUID: true}, AllRoles},
+	}
+
+	for _, c := range cases {
+		if got, want := p.Roles(c.caller), c.want; got != want {
+			t.Errorf("Roles(%+v) = %s, want %s", c.caller, got, want)
+		}
+	}
+}
+
+func TestParsePolicyFromJSON(t *testing.T) {
+	cases := []struct {
+		data      string
+		want      []Grant
+		shouldErr bool
+	}{
+		{`[{"Roles": "stats"}, {"UID": "1000", "Roles": "all"}, {"Token": "s3cret", "Roles": "config,faults"}]`,
+			[]Grant{{UID: -1, Roles: StatsRole}, {UID: 1000, Roles: AllRoles}, {Token: "s3cret", UID: -1, Roles: ConfigRole | FaultRole}}, false},
+		{`[{"UID": "root", "Roles": "all"}]`, nil, true},
+		{`[{"UID": "-1", "Roles": "all"}]`, nil, true},
+		{`[{"Roles": "admin"}]`, nil, true},
+		{`[{"User": "me", "Roles": "all"}]`, nil, true},
+		{`{`, nil, true},
+	}
+
+	for _, c := range cases {
+		p, err := ParsePolicyFromJSON([]byte(c.data))
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParsePolicyFromJSON(%s) = _, %v, want error %t", c.data, err, c.shouldErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := len(p.Grants), len(c.want); got != want {
+			t.Errorf("ParsePolicyFromJSON(%s) has %d grants, want %d", c.data, got, want)
+			continue
+		}
+		for i := range c.want {
+			if got, want := p.Grants[i], c.want[i]; got != want {
+				t.Errorf("ParsePolicyFromJSON(%s) grant %d = %+v, want %+v", c.data, i, got, want)
+			}
+		}
+	}
+}
+
+func TestServer_ServeHTTP_Policy(t *testing.T) {
+	cases := []struct {
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"/echo", "", http.StatusOK},
+		{"/fail", "", http.StatusForbidden},
+		{"/fail", "wrong", http.StatusForbidden},
+		{"/fail", "s3cret", http.StatusBadRequest},
+		{"/", "", http.StatusOK},
+	}
+
+	s := newTestServer()
+	s.SetPolicy(&Policy{Grants: []Grant{
+		{UID: -1, Roles: StatsRole},
+		{Token: "s3cret", UID: -1, Roles: ConfigRole},
+	}})
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", c.path, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if got, want := w.Code, c.wantStatus; got != want {
+			t.Errorf("POST %s with token %q: status %d, want %d", c.path, c.token, got, want)
+		}
+	}
+}
+
+func TestServer_Serve_PeerUID(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on Linux")
+	}
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := "unix:" + filepath.Join(dir, "sock")
+	l, err := Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := newTestServer()
+	s.SetPolicy(&Policy{Grants: []Grant{{UID: os.Getuid(), Roles: StatsRole}}})
+	go s.Serve(l)
+
+	c := NewClient(addr)
+	if got, err := c.Run("echo", url.Values{"text": {"hi"}}); got != "hi" || err != nil {
+		t.Errorf("Run(echo) = %q, %v, want \"hi\", nil", got, err)
+	}
+	if _, err := c.Run("fail", nil); err == nil || err.Error() != "fail: fail needs role config" {
+		t.Errorf("Run(fail) = _, %v, want error \"fail: fail needs role config\"", err)
+	}
+}
+
+func TestClient_SetToken(t *testing.T) {
+	l, err := Listen("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := newTestServer()
+	s.SetPolicy(&Policy{Grants: []Grant{{Token: "s3cret", UID: -1, Roles: StatsRole}}})
+	go s.Serve(l)
+
+	c := NewClient(l.Addr().String())
+	if _, err := c.Run("echo", nil); err == nil {
+		t.Errorf("Run(echo) without token = _, nil, want error")
+	}
+	c.SetToken("s3cret")
+	if got, err := c.Run("echo", url.Values{"text": {"hi"}}); got != "hi" || err != nil {
+		t.Errorf("Run(echo) with token = %q, %v, want \"hi\", nil", got, err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client runs commands on a slowfs control API, for example from an integration test which runs
+// slowfs in a container.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient creates a Client for the control API at the given address, which has the same form as
+// for Listen.
+func NewClient(addr string) *Client {
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		dialer := &net.Dialer{}
+		return &Client{
+			// The host is ignored, but must be valid.
+			baseURL: "http://slowfs",
+			httpClient: &http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						return dialer.DialContext(ctx, "unix", path)
+					},
+				},
+			},
+		}
+	}
+	return &Client{
+		baseURL:    "http://" + addr,
+		httpClient: &http.Client{},
+	}
+}
+
+// SetToken sets the bearer token sent with every command.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Run runs the named command with the given arguments, and returns its reply.
+func (c *Client) Run(name string, args url.Values) (string, error) {
+	req, err := http.NewRequest("POST", c.baseURL+"/"+name, strings.NewReader(args.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", name, strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
+
+// Help returns the list of commands slowfs supports, one per line, with the role each needs and a
+// description.
+func (c *Client) Help() (string, error) {
+	return c.Run("", nil)
+}
+
+// Quota returns how much of each quota is used, one quota per line.
+func (c *Client) Quota() (string, error) {
+	return c.Run("quota", nil)
+}
+
+// DropCaches drops the simulated caches, and the kernel's caches for the mount too if kernel is
+// true.
+func (c *Client) DropCaches(kernel bool) error {
+	_, err := c.Run("drop-caches", url.Values{"kernel": {fmt.Sprint(kernel)}})
+	return err
+}
+
+// StallUplink stops the simulated cloud gateways uploading for d, as if their connection to the
+// cloud had dropped.
+func (c *Client) StallUplink(d time.Duration) error {
+	_, err := c.Run("stall-uplink", url.Values{"duration": {d.String()}})
+	return err
+}
+
+// WarmCache caches the given files or directories, which are relative to the mount, and reads them
+// into the kernel's cache too if kernel is true.
+func (c *Client) WarmCache(kernel bool, paths ...string) error {
+	_, err := c.Run("warm-cache", url.Values{"kernel": {fmt.Sprint(kernel)}, "path": paths})
+	return err
+}
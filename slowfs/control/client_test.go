@@ -0,0 +1,119 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, addr := range []string{"unix:" + filepath.Join(dir, "sock"), "localhost:0"} {
+		l, err := Listen(addr)
+		if err != nil {
+			t.Fatalf("Listen(%s) = _, %s", addr, err)
+		}
+		go http.Serve(l, newTestServer())
+		if !strings.HasPrefix(addr, "unix:") {
+			addr = l.Addr().String()
+		}
+
+		c := NewClient(addr)
+		if got, err := c.Run("echo", url.Values{"text": {"hello"}}); got != "hello" || err != nil {
+			t.Errorf("%s: Run(echo) = %q, %v, want \"hello\", nil", addr, got, err)
+		}
+		if _, err := c.Run("fail", nil); err == nil || err.Error() != "fail: failed" {
+			t.Errorf("%s: Run(fail) = _, %v, want error \"fail: failed\"", addr, err)
+		}
+		l.Close()
+	}
+}
+
+func TestClient_WarmCache(t *testing.T) {
+	var got url.Values
+	s := NewServer()
+	s.HandleCommand("warm-cache", "", ConfigRole, func(args url.Values) (string, error) {
+		got = args
+		return "ok\n", nil
+	})
+	l, err := Listen("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, s)
+
+	if err := NewClient(l.Addr().String()).WarmCache(true, "db", "index.dat"); err != nil {
+		t.Fatalf("WarmCache() = %s", err)
+	}
+	if want := (url.Values{"kernel": {"true"}, "path": {"db", "index.dat"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("warm-cache got arguments %v, want %v", got, want)
+	}
+}
+
+func TestClient_StallUplink(t *testing.T) {
+	var got url.Values
+	s := NewServer()
+	s.HandleCommand("stall-uplink", "", FaultRole, func(args url.Values) (string, error) {
+		got = args
+		return "ok\n", nil
+	})
+	l, err := Listen("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, s)
+
+	if err := NewClient(l.Addr().String()).StallUplink(30 * time.Second); err != nil {
+		t.Fatalf("StallUplink() = %s", err)
+	}
+	if want := (url.Values{"duration": {"30s"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("stall-uplink got arguments %v, want %v", got, want)
+	}
+}
+
+func ExampleClient() {
+	// In an integration test, this would be the control address published by the slowfs container.
+	l, _ := Listen("localhost:0")
+	defer l.Close()
+	s := NewServer()
+	s.HandleCommand("drop-caches", "", ConfigRole, func(args url.Values) (string, error) {
+		return "ok\n", nil
+	})
+	go http.Serve(l, s)
+
+	c := NewClient(l.Addr().String())
+	fmt.Println(c.DropCaches(false))
+	_, err := c.Run("pause", nil)
+	fmt.Println(err)
+	// Output:
+	// <nil>
+	// pause: unknown command pause
+}
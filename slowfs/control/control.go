@@ -0,0 +1,188 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package control provides an HTTP API for controlling a running slowfs, served over either a
+// Unix socket or TCP. Each command is a path, taking its arguments as form values and replying with
+// plain text. For example, with curl:
+//
+//	curl --unix-socket /tmp/slowfs.sock -d kernel=true http://slowfs/drop-caches
+//
+// Each command needs a role, such as StatsRole or FaultRole. A Policy decides which roles callers
+// have, based on a bearer token or, over Unix sockets, their user ID, so that e.g. statistics can
+// be shared without letting anyone inject faults. Client runs the same commands from Go.
+package control
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CommandFunc runs a command with the given arguments, and returns text to reply with.
+type CommandFunc func(args url.Values) (string, error)
+
+type command struct {
+	help string
+	role Role
+	f    CommandFunc
+}
+
+// Server serves the control API.
+type Server struct {
+	mu       sync.RWMutex
+	commands map[string]*command
+	policy   *Policy
+}
+
+// NewServer creates a Server with no commands.
+func NewServer() *Server {
+	return &Server{
+		commands: make(map[string]*command),
+	}
+}
+
+// SetPolicy restricts which callers may run which commands. Without a policy, every caller may run
+// every command.
+func (s *Server) SetPolicy(p *Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = p
+}
+
+// HandleCommand registers a command with the given name, which callers need the given role to run.
+// Registering the same name twice panics.
+func (s *Server) HandleCommand(name, help string, role Role, f CommandFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.commands[name]; ok {
+		panic(fmt.Sprintf("command %s registered twice", name))
+	}
+	s.commands[name] = &command{help: help, role: role, f: f}
+}
+
+// Error is an error running a command, with the HTTP status it is reported with.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Run runs the named command for caller, as if it had been requested over HTTP, so that commands
+// can also be run in other ways. Errors are always an *Error.
+func (s *Server) Run(caller Caller, name string, args url.Values) (string, error) {
+	s.mu.RLock()
+	cmd, ok := s.commands[name]
+	policy := s.policy
+	s.mu.RUnlock()
+	if !ok {
+		return "", &Error{http.StatusNotFound, fmt.Sprintf("unknown command %s", name)}
+	}
+	if policy != nil && policy.Roles(caller)&cmd.role == 0 {
+		return "", &Error{http.StatusForbidden, fmt.Sprintf("%s needs role %s", name, cmd.role)}
+	}
+
+	out, err := cmd.f(args)
+	if err != nil {
+		return "", &Error{http.StatusBadRequest, err.Error()}
+	}
+	return out, nil
+}
+
+// ServeHTTP runs the command named by the request path. Requesting the root lists all commands.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := strings.Trim(req.URL.Path, "/")
+	if name == "" {
+		s.writeHelp(w)
+		return
+	}
+
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := s.Run(callerOf(req), name, req.Form)
+	if err != nil {
+		http.Error(w, err.Error(), err.(*Error).Status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, out)
+}
+
+func (s *Server) writeHelp(w http.ResponseWriter) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.commands))
+	for name := range s.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, name := range names {
+		cmd := s.commands[name]
+		fmt.Fprintf(w, "%-20s %-8s %s\n", name, cmd.role, cmd.help)
+	}
+}
+
+// ParseLine splits a command line, as typed into the shell, into the command name and its
+// name=value arguments. An empty line has an empty name.
+func ParseLine(line string) (string, url.Values, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil, nil
+	}
+	args := url.Values{}
+	for _, f := range fields[1:] {
+		i := strings.IndexByte(f, '=')
+		if i <= 0 {
+			return "", nil, fmt.Errorf("argument %q: want name=value", f)
+		}
+		args.Add(f[:i], f[i+1:])
+	}
+	return fields[0], args, nil
+}
+
+// Listen listens on the given address, which is either "unix:" followed by a socket path, or a
+// TCP host:port. Any stale socket left at the path is removed first.
+func Listen(addr string) (net.Listener, error) {
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ParseBool parses an optional boolean argument, which is false when absent.
+func ParseBool(args url.Values, name string) (bool, error) {
+	v := args.Get(name)
+	switch strings.ToLower(v) {
+	case "", "0", "false", "no":
+		return false, nil
+	case "1", "true", "yes":
+		return true, nil
+	default:
+		return false, fmt.Errorf("%s: want a boolean, got %q", name, v)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestServer() *Server {
+	s := NewServer()
+	s.HandleCommand("echo", "replies with its argument", StatsRole, func(args url.Values) (string, error) {
+		return args.Get("text"), nil
+	})
+	s.HandleCommand("fail", "always fails", ConfigRole, func(args url.Values) (string, error) {
+		return "", errors.New("failed")
+	})
+	return s
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	cases := []struct {
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/echo", "text=hello", http.StatusOK, "hello"},
+		{"/echo?text=query", "", http.StatusOK, "query"},
+		{"/fail", "", http.StatusBadRequest, "failed\n"},
+		{"/missing", "", http.StatusNotFound, "unknown command missing\n"},
+		{"/", "", http.StatusOK, "echo                 stats    replies with its argument\nfail                 config   always fails\n"},
+	}
+
+	s := newTestServer()
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", c.path, strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		body, _ := ioutil.ReadAll(w.Body)
+		if got, want := w.Code, c.wantStatus; got != want {
+			t.Errorf("POST %s: status %d, want %d", c.path, got, want)
+		}
+		if got, want := string(body), c.wantBody; got != want {
+			t.Errorf("POST %s: body %q, want %q", c.path, got, want)
+		}
+	}
+}
+
+func TestServer_Run(t *testing.T) {
+	cases := []struct {
+		caller     Caller
+		name       string
+		want       string
+		wantStatus int
+	}{
+		{Caller{UID: 1000, HasUID: true}, "echo", "hi", 0},
+		{Caller{UID: 1000, HasUID: true}, "fail", "", http.StatusBadRequest},
+		{Caller{UID: 1001, HasUID: true}, "fail", "", http.StatusForbidden},
+		{Caller{}, "echo", "hi", 0},
+		{Caller{}, "missing", "", http.StatusNotFound},
+	}
+
+	s := newTestServer()
+	s.SetPolicy(&Policy{Grants: []Grant{
+		{UID: -1, Roles: StatsRole},
+		{UID: 1000, Roles: AllRoles},
+	}})
+	for _, c := range cases {
+		got, err := s.Run(c.caller, c.name, url.Values{"text": {"hi"}})
+		gotStatus := 0
+		if err != nil {
+			gotStatus = err.(*Error).Status
+		}
+		if got != c.want || gotStatus != c.wantStatus {
+			t.Errorf("Run(%+v, %s) = %q, %v, want %q, status %d", c.caller, c.name, got, err, c.want, c.wantStatus)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line      string
+		wantName  string
+		wantArgs  url.Values
+		shouldErr bool
+	}{
+		{"", "", nil, false},
+		{"  stats ", "stats", url.Values{}, false},
+		{"set-speed write=10MB read=", "set-speed", url.Values{"write": {"10MB"}, "read": {""}}, false},
+		{"set-speed 10MB", "", nil, true},
+		{"set-speed =10MB", "", nil, true},
+	}
+
+	for _, c := range cases {
+		name, args, err := ParseLine(c.line)
+		if name != c.wantName || !reflect.DeepEqual(args, c.wantArgs) || c.shouldErr != (err != nil) {
+			t.Errorf("ParseLine(%q) = %q, %v, %v, want %q, %v, error %t", c.line, name, args, err, c.wantName, c.wantArgs, c.shouldErr)
+		}
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	cases := []struct {
+		value     string
+		want      bool
+		shouldErr bool
+	}{
+		{"", false, false},
+		{"true", true, false},
+		{"1", true, false},
+		{"no", false, false},
+		{"maybe", false, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseBool(url.Values{"b": {c.value}}, "b")
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseBool(%q) = %t, %v, want %t, error: %t", c.value, got, err, c.want, c.shouldErr)
+		}
+	}
+}
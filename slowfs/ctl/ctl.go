@@ -0,0 +1,244 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ctl implements an interactive shell for the control API, so that experiments can be
+// driven by hand.
+package ctl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"slowfs/slowfs/control"
+)
+
+const prompt = "slowfs> "
+
+// builtins are handled by the shell rather than sent to slowfs.
+var builtins = map[string]string{
+	"help": "list commands",
+	"tail": "print stats every interval (default 1s) until interrupted",
+	"quit": "leave the shell",
+}
+
+// Shell reads commands, runs them through a control API client, and prints their replies.
+type Shell struct {
+	client *control.Client
+	out    io.Writer
+
+	// Names of the commands slowfs and the shell support, for completion.
+	commands []string
+}
+
+// NewShell creates a Shell which runs commands with client, and writes replies to out.
+func NewShell(client *control.Client, out io.Writer) *Shell {
+	return &Shell{
+		client: client,
+		out:    out,
+	}
+}
+
+// loadCommands asks slowfs which commands it supports.
+func (s *Shell) loadCommands() error {
+	help, err := s.client.Help()
+	if err != nil {
+		return err
+	}
+	s.commands = s.commands[:0]
+	for name := range builtins {
+		s.commands = append(s.commands, name)
+	}
+	for _, line := range strings.Split(help, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			s.commands = append(s.commands, fields[0])
+		}
+	}
+	sort.Strings(s.commands)
+	return nil
+}
+
+// Run reads commands from in until it ends or quit is run. If in is a terminal, lines can be
+// edited and commands completed with tab.
+func (s *Shell) Run(in *os.File) error {
+	if err := s.loadCommands(); err != nil {
+		return err
+	}
+
+	lines := newLineReader(in, s.out, s.complete)
+	defer lines.close()
+	for {
+		line, err := lines.readLine(prompt)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.RunLine(line); err == errQuit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(s.out, "error: %s\n", err)
+		}
+	}
+}
+
+var errQuit = errors.New("quit")
+
+// RunLine runs a single command line, like "warm-cache path=db kernel=true".
+func (s *Shell) RunLine(line string) error {
+	name, args, err := parseLine(line)
+	if err != nil || name == "" {
+		return err
+	}
+
+	switch name {
+	case "quit", "exit":
+		return errQuit
+	case "help":
+		help, err := s.client.Help()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(s.out, help)
+		for _, name := range sortedKeys(builtins) {
+			fmt.Fprintf(s.out, "%-20s %-8s %s\n", name, "", builtins[name])
+		}
+		return nil
+	case "tail":
+		interval := time.Second
+		if v := args.Get("interval"); v != "" {
+			if interval, err = time.ParseDuration(v); err != nil {
+				return fmt.Errorf("interval: %s", err)
+			}
+		}
+		return s.tail(interval)
+	}
+
+	reply, err := s.client.Run(name, args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(s.out, reply)
+	return nil
+}
+
+// tail prints stats every interval until interrupted.
+func (s *Shell) tail(interval time.Duration) error {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := s.client.Run("stats", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "--- %s\n%s", time.Now().Format("15:04:05"), stats)
+		select {
+		case <-ticker.C:
+		case <-interrupts:
+			return nil
+		}
+	}
+}
+
+// parseLine splits a command line into the command name and its name=value arguments, as for
+// control.ParseLine. A bare argument to tail is its interval, as a shorthand.
+func parseLine(line string) (string, url.Values, error) {
+	fields := strings.Fields(line)
+	if len(fields) > 0 && fields[0] == "tail" {
+		for i, f := range fields[1:] {
+			if !strings.Contains(f, "=") {
+				fields[i+1] = "interval=" + f
+			}
+		}
+	}
+	return control.ParseLine(strings.Join(fields, " "))
+}
+
+// complete returns the possible completions of line, which the cursor is at the end of. Only
+// command names are completed.
+func (s *Shell) complete(line string) []string {
+	if strings.ContainsAny(line, " \t") {
+		return nil
+	}
+	var matches []string
+	for _, c := range s.commands {
+		if strings.HasPrefix(c, line) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// commonPrefix returns the longest prefix shared by all of ss.
+func commonPrefix(ss []string) string {
+	if len(ss) == 0 {
+		return ""
+	}
+	prefix := ss[0]
+	for _, s := range ss[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lineReader reads command lines, prompting for each.
+type lineReader interface {
+	readLine(prompt string) (string, error)
+	close()
+}
+
+// plainLineReader reads lines without editing, for input which isn't a terminal.
+type plainLineReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+	prompt  bool
+}
+
+func (r *plainLineReader) readLine(prompt string) (string, error) {
+	if r.prompt {
+		fmt.Fprint(r.out, prompt)
+	}
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *plainLineReader) close() {}
@@ -0,0 +1,134 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctl
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"slowfs/slowfs/control"
+)
+
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line     string
+		wantName string
+		wantArgs url.Values
+		wantErr  bool
+	}{
+		{"", "", nil, false},
+		{"   ", "", nil, false},
+		{"stats", "stats", url.Values{}, false},
+		{"warm-cache path=db path=log kernel=true", "warm-cache", url.Values{"path": {"db", "log"}, "kernel": {"true"}}, false},
+		{"inject-fault error=", "inject-fault", url.Values{"error": {""}}, false},
+		{"tail 5s", "tail", url.Values{"interval": {"5s"}}, false},
+		{"drop-caches kernel", "", nil, true},
+		{"drop-caches =true", "", nil, true},
+	}
+
+	for _, c := range cases {
+		gotName, gotArgs, err := parseLine(c.line)
+		if gotErr := err != nil; gotErr != c.wantErr {
+			t.Errorf("parseLine(%q) = _, _, %v, want error? %t", c.line, err, c.wantErr)
+			continue
+		}
+		if got, want := gotName, c.wantName; got != want {
+			t.Errorf("parseLine(%q) = %q, _, _, want %q", c.line, got, want)
+		}
+		if got, want := gotArgs, c.wantArgs; !reflect.DeepEqual(got, want) {
+			t.Errorf("parseLine(%q) = _, %v, _, want %v", c.line, got, want)
+		}
+	}
+}
+
+func TestShell_Complete(t *testing.T) {
+	s := &Shell{commands: []string{"drop-caches", "help", "inject-fault", "quit", "stats", "tail", "warm-cache"}}
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{"", s.commands},
+		{"st", []string{"stats"}},
+		{"d", []string{"drop-caches"}},
+		{"x", nil},
+		{"stats ", nil},
+	}
+
+	for _, c := range cases {
+		if got, want := s.complete(c.line), c.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("complete(%q) = %v, want %v", c.line, got, want)
+		}
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	cases := []struct {
+		ss   []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"stats"}, "stats"},
+		{[]string{"warm-cache", "warm-kernel"}, "warm-"},
+		{[]string{"stats", "tail"}, ""},
+	}
+
+	for _, c := range cases {
+		if got, want := commonPrefix(c.ss), c.want; got != want {
+			t.Errorf("commonPrefix(%q) = %q, want %q", c.ss, got, want)
+		}
+	}
+}
+
+func TestShell_RunLine(t *testing.T) {
+	server := control.NewServer()
+	server.HandleCommand("echo", "echo text", control.StatsRole, func(args url.Values) (string, error) {
+		return args.Get("text") + "\n", nil
+	})
+	server.HandleCommand("fail", "always fail", control.StatsRole, func(url.Values) (string, error) {
+		return "", errors.New("failed")
+	})
+	l, err := control.Listen("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, server)
+
+	var out bytes.Buffer
+	s := NewShell(control.NewClient(l.Addr().String()), &out)
+	if err := s.loadCommands(); err != nil {
+		t.Fatalf("loadCommands() = %s", err)
+	}
+	if got, want := s.commands, []string{"echo", "fail", "help", "quit", "tail"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %v, want %v", got, want)
+	}
+
+	if err := s.RunLine("echo text=hello"); err != nil {
+		t.Errorf("RunLine(echo) = %s", err)
+	}
+	if got, want := out.String(), "hello\n"; got != want {
+		t.Errorf("RunLine(echo) printed %q, want %q", got, want)
+	}
+	if err := s.RunLine("fail"); err == nil {
+		t.Errorf("RunLine(fail) = nil, want error")
+	}
+	if err := s.RunLine("quit"); err != errQuit {
+		t.Errorf("RunLine(quit) = %v, want errQuit", err)
+	}
+}
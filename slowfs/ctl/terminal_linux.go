@@ -0,0 +1,148 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+	"unsafe"
+)
+
+func ioctlTermios(fd int, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// newLineReader returns a terminalLineReader if in is a terminal, and a plainLineReader otherwise.
+func newLineReader(in *os.File, out io.Writer, complete func(string) []string) lineReader {
+	var t syscall.Termios
+	if err := ioctlTermios(int(in.Fd()), syscall.TCGETS, &t); err != nil {
+		return &plainLineReader{scanner: bufio.NewScanner(in), out: out}
+	}
+	return &terminalLineReader{
+		in:       in,
+		out:      out,
+		fd:       int(in.Fd()),
+		cooked:   t,
+		complete: complete,
+	}
+}
+
+// terminalLineReader edits lines in raw mode, completing them on tab. The terminal is only in raw
+// mode while a line is being read, so that commands run normally.
+type terminalLineReader struct {
+	in       *os.File
+	out      io.Writer
+	fd       int
+	cooked   syscall.Termios
+	complete func(string) []string
+}
+
+func (r *terminalLineReader) readLine(prompt string) (string, error) {
+	raw := r.cooked
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(r.fd, syscall.TCSETS, &raw); err != nil {
+		return "", err
+	}
+	defer r.close()
+
+	fmt.Fprint(r.out, prompt)
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := r.in.Read(b); err != nil {
+			return "", err
+		}
+		switch c := b[0]; {
+		case c == '\r' || c == '\n':
+			fmt.Fprint(r.out, "\r\n")
+			return string(line), nil
+		case c == 3: // Ctrl-C abandons the line.
+			fmt.Fprint(r.out, "^C\r\n"+prompt)
+			line = line[:0]
+		case c == 4: // Ctrl-D on an empty line ends input.
+			if len(line) == 0 {
+				fmt.Fprint(r.out, "\r\n")
+				return "", io.EOF
+			}
+		case c == 21: // Ctrl-U clears the line.
+			fmt.Fprint(r.out, "\r\033[K"+prompt)
+			line = line[:0]
+		case c == 127 || c == 8:
+			if len(line) > 0 {
+				_, size := utf8.DecodeLastRune(line)
+				line = line[:len(line)-size]
+				fmt.Fprint(r.out, "\b \b")
+			}
+		case c == '\t':
+			line = r.completeLine(prompt, line)
+		case c == 27:
+			// Ignore escape sequences, like arrow keys.
+			if err := r.skipEscapeSequence(); err != nil {
+				return "", err
+			}
+		case c >= 32:
+			line = append(line, c)
+			r.out.Write(b)
+		}
+	}
+}
+
+// completeLine completes as much of line as is unambiguous, or lists the possibilities.
+func (r *terminalLineReader) completeLine(prompt string, line []byte) []byte {
+	matches := r.complete(string(line))
+	switch {
+	case len(matches) == 1:
+		rest := matches[0][len(line):] + " "
+		fmt.Fprint(r.out, rest)
+		return append(line, rest...)
+	case len(matches) > 1:
+		if prefix := commonPrefix(matches); len(prefix) > len(line) {
+			fmt.Fprint(r.out, prefix[len(line):])
+			return append(line, prefix[len(line):]...)
+		}
+		fmt.Fprintf(r.out, "\r\n%s\r\n%s%s", strings.Join(matches, "  "), prompt, line)
+	}
+	return line
+}
+
+func (r *terminalLineReader) skipEscapeSequence() error {
+	b := make([]byte, 1)
+	if _, err := r.in.Read(b); err != nil || b[0] != '[' {
+		return err
+	}
+	// Control sequences end with a byte between @ and ~.
+	for {
+		if _, err := r.in.Read(b); err != nil {
+			return err
+		}
+		if b[0] >= '@' && b[0] <= '~' {
+			return nil
+		}
+	}
+}
+
+func (r *terminalLineReader) close() {
+	ioctlTermios(r.fd, syscall.TCSETS, &r.cooked)
+}
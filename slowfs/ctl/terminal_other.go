@@ -0,0 +1,29 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package ctl
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// newLineReader returns a plainLineReader, since line editing is only supported on Linux.
+func newLineReader(in *os.File, out io.Writer, complete func(string) []string) lineReader {
+	return &plainLineReader{scanner: bufio.NewScanner(in), out: out, prompt: true}
+}
@@ -0,0 +1,287 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package decisionlog records every decision the scheduler makes in a compact binary log, so that
+// questions like "why did this one read take 9 seconds" can be answered after the fact.
+//
+// A log starts with a header, followed by records. Each record starts with a kind byte: a string
+// record defines the next entry in a table of device names and paths, and a decision record refers
+// to strings by their index in that table. Numbers are varints, and timestamps are stored as the
+// difference from the previous decision's.
+package decisionlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"sync"
+	"time"
+)
+
+const header = "SLOWFSDL\x07"
+
+const (
+	stringRecord   = 0
+	decisionRecord = 1
+)
+
+// maxStringBytes is the longest string, like a path or device name, a log may hold. Longer ones
+// can only come from a corrupt log, and aren't read into memory.
+const maxStringBytes = 1 << 16
+
+// Decision is one scheduling decision: the request, on which device, what it cost, and what else
+// the device had outstanding at the time.
+type Decision struct {
+	Device  string
+	Request scheduler.Request
+	Cost    scheduler.Cost
+	Queue   scheduler.QueueStats
+}
+
+func (d *Decision) String() string {
+	return fmt.Sprintf("%s %s %s %s [%d+%d] took %s (queue %s, wait %s, lock %s, seek %s, transfer %s, repair %s, verify %s, alignment %s, fixed %s, upload %s, network %s) with %d queued and %d in flight",
+		d.Request.Timestamp.Format("15:04:05.000000"), d.Device, d.Request.Type, d.Request.Path,
+		d.Request.Start, d.Request.Size, d.Cost.Total(), d.Cost.Queue, d.Cost.Wait, d.Cost.Lock, d.Cost.Seek, d.Cost.Transfer,
+		d.Cost.Repair, d.Cost.Verify, d.Cost.Alignment, d.Cost.Fixed, d.Cost.Upload, d.Cost.Network, d.Queue.Queued, d.Queue.InFlight)
+}
+
+// Writer writes decisions to a log. It is safe for concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	strings map[string]uint64
+	last    time.Time
+	buf     []byte
+}
+
+// NewWriter starts a log written to w.
+func NewWriter(w io.Writer) (*Writer, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(header); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:       bw,
+		strings: make(map[string]uint64),
+		last:    time.Unix(0, 0),
+	}, nil
+}
+
+// Hook returns a schedule hook which records decisions made by the scheduler for the named
+// device. Errors writing the log are reported by Flush.
+func (w *Writer) Hook(device string) scheduler.ScheduleHook {
+	return func(c *scheduler.ScheduledRequest) {
+		w.Write(&Decision{
+			Device:  device,
+			Request: *c.Request,
+			Cost:    c.Cost,
+			Queue:   c.Queue,
+		})
+	}
+}
+
+// Write records a decision. Decisions may be written slightly out of order, since they're recorded
+// by the goroutines which made the requests.
+func (w *Writer) Write(d *Decision) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	device := w.intern(d.Device)
+	path := w.intern(d.Request.Path)
+	w.buf = append(w.buf[:0], decisionRecord)
+	w.putVarint(d.Request.Timestamp.Sub(w.last).Nanoseconds())
+	w.putUvarint(device)
+	w.putUvarint(uint64(d.Request.Type))
+	w.putUvarint(path)
+	w.putVarint(int64(d.Request.Start))
+	w.putVarint(int64(d.Request.Size))
+	for _, t := range []time.Duration{d.Cost.Queue, d.Cost.Wait, d.Cost.Lock, d.Cost.Seek, d.Cost.Transfer, d.Cost.Repair, d.Cost.Verify, d.Cost.Alignment, d.Cost.Fixed, d.Cost.Upload, d.Cost.Network} {
+		w.putVarint(int64(t))
+	}
+	w.putVarint(d.Queue.Queued)
+	w.putVarint(d.Queue.InFlight)
+	w.last = d.Request.Timestamp
+
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+func (w *Writer) putVarint(x int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutVarint(b[:], x)]...)
+}
+
+func (w *Writer) putUvarint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutUvarint(b[:], x)]...)
+}
+
+// intern returns the index of s in the string table, writing a string record first if it isn't
+// there yet.
+func (w *Writer) intern(s string) uint64 {
+	if i, ok := w.strings[s]; ok {
+		return i
+	}
+	i := uint64(len(w.strings))
+	w.strings[s] = i
+	w.buf = append(w.buf[:0], stringRecord)
+	w.putUvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+	w.w.Write(w.buf)
+	return i
+}
+
+// Flush writes any buffered decisions to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Flush()
+}
+
+// Reader reads decisions back from a log.
+type Reader struct {
+	r       *bufio.Reader
+	strings []string
+	last    time.Time
+}
+
+// NewReader reads a log from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	got := make([]byte, len(header))
+	if _, err := io.ReadFull(br, got); err != nil || string(got) != header {
+		return nil, errors.New("not a slowfs decision log")
+	}
+	return &Reader{r: br, last: time.Unix(0, 0)}, nil
+}
+
+// Next returns the next decision in the log, or io.EOF at the end. A log cut off part way through
+// a record, e.g. because slowfs was killed, ends with io.ErrUnexpectedEOF.
+func (r *Reader) Next() (*Decision, error) {
+	for {
+		kind, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case stringRecord:
+			if err := r.readString(); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		case decisionRecord:
+			d, err := r.readDecision()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			return d, nil
+		default:
+			return nil, fmt.Errorf("corrupt decision log: unknown record kind %d", kind)
+		}
+	}
+}
+
+func (r *Reader) readString() error {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return err
+	}
+	if n > maxStringBytes {
+		return fmt.Errorf("corrupt decision log: %d byte string", n)
+	}
+	s := make([]byte, n)
+	if _, err := io.ReadFull(r.r, s); err != nil {
+		return err
+	}
+	r.strings = append(r.strings, string(s))
+	return nil
+}
+
+// fieldReader reads a sequence of varints, remembering the first error.
+type fieldReader struct {
+	r   io.ByteReader
+	err error
+}
+
+func (f *fieldReader) varint() int64 {
+	if f.err != nil {
+		return 0
+	}
+	var x int64
+	x, f.err = binary.ReadVarint(f.r)
+	return x
+}
+
+func (f *fieldReader) uvarint() uint64 {
+	if f.err != nil {
+		return 0
+	}
+	var x uint64
+	x, f.err = binary.ReadUvarint(f.r)
+	return x
+}
+
+func (f *fieldReader) duration() time.Duration {
+	return time.Duration(f.varint())
+}
+
+func (r *Reader) readDecision() (*Decision, error) {
+	f := &fieldReader{r: r.r}
+	delta := f.duration()
+	device := f.uvarint()
+	var d Decision
+	d.Request.Type = scheduler.RequestType(f.uvarint())
+	path := f.uvarint()
+	d.Request.Start = units.NumBytes(f.varint())
+	d.Request.Size = units.NumBytes(f.varint())
+	d.Cost = scheduler.Cost{
+		Queue:     f.duration(),
+		Wait:      f.duration(),
+		Lock:      f.duration(),
+		Seek:      f.duration(),
+		Transfer:  f.duration(),
+		Repair:    f.duration(),
+		Verify:    f.duration(),
+		Alignment: f.duration(),
+		Fixed:     f.duration(),
+		Upload:    f.duration(),
+		Network:   f.duration(),
+	}
+	d.Queue = scheduler.QueueStats{
+		Queued:   f.varint(),
+		InFlight: f.varint(),
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	if device >= uint64(len(r.strings)) || path >= uint64(len(r.strings)) {
+		return nil, errors.New("corrupt decision log: undefined string")
+	}
+
+	r.last = r.last.Add(delta)
+	d.Device = r.strings[device]
+	d.Request.Path = r.strings[path]
+	d.Request.Timestamp = r.last
+	return &d, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
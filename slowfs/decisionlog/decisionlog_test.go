@@ -0,0 +1,151 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decisionlog
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"slowfs/slowfs/scheduler"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testDecisions = []*Decision{
+	{
+		Device:  "main",
+		Request: scheduler.Request{Type: scheduler.ReadRequest, Timestamp: time.Unix(1500000000, 123), Path: "db/index", Start: 4096, Size: 8192},
+		Cost:    scheduler.Cost{Queue: time.Second, Wait: 8 * time.Second, Seek: 10 * time.Millisecond, Transfer: 80 * time.Millisecond, Network: time.Millisecond},
+		Queue:   scheduler.QueueStats{Queued: 3, InFlight: 1},
+	},
+	{
+		Device:  "journal",
+		Request: scheduler.Request{Type: scheduler.DirEntryRequest, Timestamp: time.Unix(1500000001, 0), Path: "db/log"},
+		Cost:    scheduler.Cost{Lock: 3 * time.Millisecond, Fixed: 10 * time.Millisecond},
+	},
+	{
+		// Decisions can be recorded slightly out of order.
+		Device:  "main",
+		Request: scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Unix(1500000000, 999), Path: "db/index"},
+		Cost:    scheduler.Cost{Fixed: 80 * time.Millisecond},
+	},
+	{
+		Device:  "main",
+		Request: scheduler.Request{Type: scheduler.FsyncRequest, Timestamp: time.Unix(1500000002, 0), Path: "db/index"},
+		Cost:    scheduler.Cost{Seek: 10 * time.Millisecond, Transfer: time.Second, Verify: time.Second, Alignment: time.Millisecond, Upload: 2 * time.Second},
+	},
+}
+
+func writeTestLog(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter() = _, %s", err)
+	}
+	for _, d := range testDecisions {
+		if err := w.Write(d); err != nil {
+			t.Fatalf("Write(%s) = %s", d, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() = %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriterAndReader(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(writeTestLog(t)))
+	if err != nil {
+		t.Fatalf("NewReader() = _, %s", err)
+	}
+	for _, want := range testDecisions {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next() = _, %s, want %s", err, want)
+		}
+		if !got.Request.Timestamp.Equal(want.Request.Timestamp) {
+			t.Errorf("Next() timestamp = %s, want %s", got.Request.Timestamp, want.Request.Timestamp)
+		}
+		got.Request.Timestamp = want.Request.Timestamp
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Next() = %s, want %s", got, want)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next() at end = _, %v, want io.EOF", err)
+	}
+}
+
+func TestReader_Truncated(t *testing.T) {
+	data := writeTestLog(t)
+	r, err := NewReader(bytes.NewReader(data[:len(data)-2]))
+	if err != nil {
+		t.Fatalf("NewReader() = _, %s", err)
+	}
+	for i := 0; i < len(testDecisions)-1; i++ {
+		if _, err := r.Next(); err != nil {
+			t.Fatalf("Next() = _, %s", err)
+		}
+	}
+	if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Next() on truncated record = _, %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReader_HugeString(t *testing.T) {
+	// A string record claiming to be far longer than any path is rejected rather than read.
+	data := append([]byte(header), stringRecord, 0xff, 0xff, 0xff, 0xff, 0x0f)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader() = _, %s", err)
+	}
+	if _, err := r.Next(); err == nil || !strings.Contains(err.Error(), "corrupt decision log") {
+		t.Errorf("Next() on a huge string = _, %v, want a corrupt decision log error", err)
+	}
+}
+
+func TestNewReader_NotALog(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("hello world"))); err == nil {
+		t.Errorf("NewReader(hello world) = _, nil, want error")
+	}
+}
+
+func TestFilter_Matches(t *testing.T) {
+	d := testDecisions[0]
+	cases := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{Device: "main"}, true},
+		{Filter{Device: "journal"}, false},
+		{Filter{Path: "db"}, true},
+		{Filter{Path: "*.log"}, false},
+		{Filter{Types: []scheduler.RequestType{scheduler.WriteRequest, scheduler.ReadRequest}}, true},
+		{Filter{Types: []scheduler.RequestType{scheduler.WriteRequest}}, false},
+		{Filter{MinTotal: 9 * time.Second}, true},
+		{Filter{MinTotal: 10 * time.Second}, false},
+		{Filter{From: time.Unix(1500000000, 0), To: time.Unix(1500000001, 0)}, true},
+		{Filter{From: time.Unix(1500000000, 124)}, false},
+		{Filter{To: time.Unix(1500000000, 123)}, false},
+	}
+
+	for _, c := range cases {
+		if got, want := c.filter.Matches(d), c.want; got != want {
+			t.Errorf("%+v.Matches(%s) = %t, want %t", c.filter, d, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decisionlog
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"time"
+)
+
+// Filter selects decisions from a log. Zero fields match every decision.
+type Filter struct {
+	// Device is the name of the device the request was scheduled on.
+	Device string
+
+	// Path is a glob pattern matching the request's path, as for slowfs.MatchesPath.
+	Path string
+
+	// Types are which types of request match. If empty, all types match.
+	Types []scheduler.RequestType
+
+	// MinTotal is how long a request must have taken in total to match.
+	MinTotal time.Duration
+
+	// From and To limit matching requests to those made in [From, To).
+	From, To time.Time
+}
+
+// Matches returns whether d is selected by the filter.
+func (f *Filter) Matches(d *Decision) bool {
+	if f.Device != "" && d.Device != f.Device {
+		return false
+	}
+	if f.Path != "" && !slowfs.MatchesPath(f.Path, d.Request.Path) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsType(f.Types, d.Request.Type) {
+		return false
+	}
+	if d.Cost.Total() < f.MinTotal {
+		return false
+	}
+	if !f.From.IsZero() && d.Request.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !d.Request.Timestamp.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+func containsType(types []scheduler.RequestType, t scheduler.RequestType) bool {
+	for _, u := range types {
+		if u == t {
+			return true
+		}
+	}
+	return false
+}
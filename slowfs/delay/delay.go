@@ -0,0 +1,50 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package delay waits until the times operations are modeled to complete. Timers alone can't
+// deliver sub-millisecond latencies faithfully, as they fire anywhere from tens of microseconds to a
+// millisecond late depending on the host, which swamps the latencies of fast devices like NVMe
+// drives and persistent memory. So the last stretch of each wait can be spun instead, trading CPU
+// time for precision.
+package delay
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// Until waits until t, or until ctx is done, in which case it returns ctx's error. It sleeps on a
+// timer until spin before t, then spins the rest of the way, yielding the processor between looks
+// at the clock so that other goroutines still run. A spin of zero relies on the timer alone.
+func Until(ctx context.Context, t time.Time, spin time.Duration) error {
+	if d := time.Until(t) - spin; d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	for time.Now().Before(t) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		runtime.Gosched()
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delay
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUntil(t *testing.T) {
+	cases := []struct {
+		wait, spin time.Duration
+	}{
+		{0, 0},
+		{-time.Millisecond, time.Millisecond},
+		{2 * time.Millisecond, 0},
+		{2 * time.Millisecond, 500 * time.Microsecond},
+		// Spinning longer than the wait spins the whole way.
+		{500 * time.Microsecond, time.Millisecond},
+	}
+
+	for _, c := range cases {
+		target := time.Now().Add(c.wait)
+		if err := Until(context.Background(), target, c.spin); err != nil {
+			t.Errorf("Until(now+%s, %s) = %v, want nil", c.wait, c.spin, err)
+		}
+		if now := time.Now(); now.Before(target) {
+			t.Errorf("Until(now+%s, %s) returned %s early", c.wait, c.spin, target.Sub(now))
+		}
+	}
+}
+
+func TestUntil_Canceled(t *testing.T) {
+	for _, spin := range []time.Duration{0, time.Hour} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		err := Until(ctx, time.Now().Add(time.Hour), spin)
+		cancel()
+		if got, want := err, context.DeadlineExceeded; got != want {
+			t.Errorf("Until(now+1h, %s) with a 1ms deadline = %v, want %v", spin, got, want)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"log"
 	"slowfs/slowfs/units"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -106,6 +107,124 @@ func ParseWriteStrategyFromString(s string) (WriteStrategy, error) {
 	}
 }
 
+// MetadataStrategy indicates how changes to file attributes (chmod, chown and utimens) are made
+// durable.
+type MetadataStrategy int
+
+const (
+	// SyncMetadata means attribute changes are written synchronously, taking MetadataOpTime each, as
+	// on filesystems mounted with strict synchronous metadata.
+	SyncMetadata MetadataStrategy = iota
+	// JournaledMetadata means attribute changes take no time, but only become durable when the
+	// journal is next committed, every MetadataCommitInterval or when the file is fsynced, as on
+	// ext4.
+	JournaledMetadata
+)
+
+func (m MetadataStrategy) String() string {
+	switch m {
+	case SyncMetadata:
+		return "SyncMetadata"
+	case JournaledMetadata:
+		return "JournaledMetadata"
+	default:
+		return "unknown metadata strategy"
+	}
+}
+
+// ParseMetadataStrategyFromString parses a MetadataStrategy from the given string. This function is
+// case insensitive, and also accepts synonyms for each MetadataStrategy. For example,
+// journaledmetadata, journaled and journal all map to the JournaledMetadata strategy.
+func ParseMetadataStrategyFromString(s string) (MetadataStrategy, error) {
+	switch strings.ToLower(s) {
+	case "syncmetadata", "sync":
+		return SyncMetadata, nil
+	case "journaledmetadata", "journaled", "journal":
+		return JournaledMetadata, nil
+	default:
+		return 0, fmt.Errorf("unknown metadata strategy %s", s)
+	}
+}
+
+// EvictionPolicy indicates which data a full read cache drops to make room for newly read data.
+type EvictionPolicy int
+
+const (
+	// LRUEviction drops the least recently read data, as the kernel's page cache roughly does.
+	LRUEviction EvictionPolicy = iota
+	// FIFOEviction drops the data which was cached first, however often it has been read since.
+	FIFOEviction
+)
+
+func (e EvictionPolicy) String() string {
+	switch e {
+	case LRUEviction:
+		return "LRUEviction"
+	case FIFOEviction:
+		return "FIFOEviction"
+	default:
+		return "unknown eviction policy"
+	}
+}
+
+// ParseEvictionPolicyFromString parses an EvictionPolicy from the given string. This function is
+// case insensitive, and also accepts synonyms for each EvictionPolicy. For example, lrueviction and
+// lru both map to LRUEviction.
+func ParseEvictionPolicyFromString(s string) (EvictionPolicy, error) {
+	switch strings.ToLower(s) {
+	case "lrueviction", "lru":
+		return LRUEviction, nil
+	case "fifoeviction", "fifo":
+		return FIFOEviction, nil
+	default:
+		return 0, fmt.Errorf("unknown eviction policy %s", s)
+	}
+}
+
+// NoOpStrategy indicates how operations which change nothing are charged, like zero-length writes
+// and truncates which leave a file's size alone. Real filesystems differ on whether these update
+// timestamps.
+type NoOpStrategy int
+
+const (
+	// DefaultNoOps charges no-ops like any other operation of their type, which for most means
+	// little more than seeking.
+	DefaultNoOps NoOpStrategy = iota
+	// FreeNoOps charges nothing for no-ops, as if they never reached the device.
+	FreeNoOps
+	// MetadataNoOps charges no-ops MetadataOpTime, as if they only updated timestamps.
+	MetadataNoOps
+)
+
+func (n NoOpStrategy) String() string {
+	switch n {
+	case DefaultNoOps:
+		return "DefaultNoOps"
+	case FreeNoOps:
+		return "FreeNoOps"
+	case MetadataNoOps:
+		return "MetadataNoOps"
+	default:
+		return "unknown no-op strategy"
+	}
+}
+
+// ParseNoOpStrategyFromString parses a NoOpStrategy from the given string. This function is case
+// insensitive, and also accepts synonyms for each NoOpStrategy. For example, freenoops and free
+// both map to FreeNoOps.
+func ParseNoOpStrategyFromString(s string) (NoOpStrategy, error) {
+	switch strings.ToLower(s) {
+	case "defaultnoops", "default":
+		return DefaultNoOps, nil
+	case "freenoops", "free", "none":
+		return FreeNoOps, nil
+	case "metadatanoops", "metadata":
+		return MetadataNoOps, nil
+	default:
+		return 0, fmt.Errorf("unknown no-op strategy %s", s)
+	}
+}
+
 // DeviceConfig is used to describe how a physical medium acts (e.g. rotational hard drive).
 type DeviceConfig struct {
 	// Name is the name of this configuration. This is used for selecting on the command line which
@@ -141,23 +260,263 @@ type DeviceConfig struct {
 
 	// MetadataOpTime denotes how long metadata operations (like chmod, chown, etc) should take.
 	MetadataOpTime time.Duration
+
+	// ReadRepairProbability denotes the fraction of reads, between 0 and 1, which hit marginal media
+	// and have to be retried before returning the correct data.
+	ReadRepairProbability float64
+
+	// ReadRepairSeeks denotes how many extra seeks a read which needs repairing costs.
+	ReadRepairSeeks int
+
+	// MetadataBytesPerSecond denotes how many bytes of directory entries we can list per second, on
+	// top of MetadataOpTime. If zero, listing a directory takes MetadataOpTime however large it is.
+	MetadataBytesPerSecond units.NumBytes
+
+	// MetadataStrategy denotes which algorithm to use for modeling attribute changes.
+	MetadataStrategy MetadataStrategy
+
+	// MetadataCommitInterval denotes how often the journal is committed, making attribute changes
+	// durable, with JournaledMetadata.
+	MetadataCommitInterval time.Duration
+
+	// FlushOnClose denotes whether closing a file waits for its data in the write back cache to be
+	// written, as on network filesystems with close-to-open consistency, rather than being free.
+	FlushOnClose bool
+
+	// ReadWriteBackCache denotes whether reads of data still waiting in the write back cache are
+	// served from memory, taking no time, rather than from the device. Data is written back in the
+	// order it was written, and forgotten once written back or once its file is closed.
+	ReadWriteBackCache bool
+
+	// MetadataDevice, if set, is the name of another configuration which simulates a separate
+	// device that metadata operations run on, with its own queue, like a fast SSD holding the
+	// metadata for a slow hard disk.
+	MetadataDevice string
+
+	// Actuators denotes how many independent actuators the device has, like on dual actuator hard
+	// disks. Each serves a share of the files with its own seek state, so requests to files on
+	// different actuators can run in parallel. Zero means one.
+	Actuators int
+
+	// FreeBytesPerSecond denotes how many bytes truncating or unlinking a file can free per second,
+	// on top of MetadataOpTime. If zero, they take MetadataOpTime however much they free.
+	FreeBytesPerSecond units.NumBytes
+
+	// ZeroFillBytesPerSecond denotes how many bytes extending a file can zero per second, on top of
+	// MetadataOpTime, for filesystems which zero new blocks rather than leaving the file sparse. If
+	// zero, extending takes MetadataOpTime however much it adds.
+	ZeroFillBytesPerSecond units.NumBytes
+
+	// DirectoryLockTime denotes how long operations adding or removing directory entries, like
+	// create and unlink, hold the directory's lock. Other such operations on the same directory
+	// wait for it, so heavily parallel creates in one directory contend. If zero, directories
+	// aren't locked.
+	DirectoryLockTime time.Duration
+
+	// ReclaimBytesPerSecond denotes how many bytes of unlinked files' space the device makes free
+	// again per second, in the background. Until then, the space isn't reported as free. If zero,
+	// it's free as soon as the unlink completes.
+	ReclaimBytesPerSecond units.NumBytes
+
+	// DeletedRetention denotes how long unlinked files' space stays in use before the device starts
+	// reclaiming it, as on filesystems which keep deleted files in snapshots or a trash for a while.
+	DeletedRetention time.Duration
+
+	// UploadBytesPerSecond denotes how many bytes per second data written to the device is uploaded
+	// at, as on cloud gateways which write locally first and upload in the background. Data is
+	// uploaded in the order it was written, however busy the device is. If zero, nothing is uploaded.
+	UploadBytesPerSecond units.NumBytes
+
+	// FsyncWaitsForUpload denotes whether fsync waits for the file's data to be uploaded, rather than
+	// only for it to be on the device.
+	FsyncWaitsForUpload bool
+
+	// CloseWaitsForUpload denotes whether closing a file waits for its data to be uploaded.
+	CloseWaitsForUpload bool
+
+	// NetworkLatency denotes the round trip time of the network between clients and a remote
+	// device, like an NFS server's disk, which every request pays on top of the device's time.
+	NetworkLatency time.Duration
+
+	// NetworkBytesPerSecond denotes the bandwidth of the network, which the data of reads, writes
+	// and directory listings shares, one request at a time. If zero, it is unlimited.
+	NetworkBytesPerSecond units.NumBytes
+
+	// FsyncGroupWindow denotes how long an fsync waits for others to join it in a group commit.
+	// Fsyncs arriving within the window share one device flush, paying only for their own data,
+	// while an fsync arriving alone waits out the window for nothing. If zero, fsyncs aren't grouped.
+	FsyncGroupWindow time.Duration
+
+	// SeekTimeDistribution, if set, is the distribution each seek's time is drawn from, instead of
+	// always taking SeekTime. Background write back still takes SeekTime per seek.
+	SeekTimeDistribution *Distribution
+
+	// MetadataOpDistribution, if set, is the distribution each metadata operation's time is drawn
+	// from, instead of always taking MetadataOpTime.
+	MetadataOpDistribution *Distribution
+
+	// BaseLatency, if set, is the distribution of a latency every request pays on top of its other
+	// costs, like command overhead. Requests are drawn their own, so that tail latencies can be
+	// exercised.
+	BaseLatency *Distribution
+
+	// RandomReadBytesPerSecond denotes how many bytes we can read per second when a read has to
+	// seek, since small scattered accesses are much slower than streaming on most devices. If zero,
+	// it is ReadBytesPerSecond.
+	RandomReadBytesPerSecond units.NumBytes
+
+	// RandomWriteBytesPerSecond is like RandomReadBytesPerSecond, but for writes.
+	RandomWriteBytesPerSecond units.NumBytes
+
+	// QueueDepth denotes how many requests the device accepts at once, like a disk's NCQ depth.
+	// Requests beyond that wait for an earlier one to complete before the device sees them. If zero,
+	// the queue is unbounded.
+	QueueDepth int
+
+	// ReadCacheBytes denotes how much read data is kept in memory, like the kernel's page cache, so
+	// that reading it again doesn't touch the device. If zero, only data explicitly warmed is cached.
+	ReadCacheBytes units.NumBytes
+
+	// ReadCacheEviction denotes which data the read cache drops when it is full.
+	ReadCacheEviction EvictionPolicy
+
+	// ReadCacheHitTime denotes how long reading data from memory takes, instead of the device.
+	ReadCacheHitTime time.Duration
+
+	// JournalCommitTime denotes how long committing the filesystem's journal takes, which every
+	// fsync does, unless it joins a group commit, making all metadata changes so far durable too.
+	// If zero, fsyncs only commit the journal when their own file's metadata is uncommitted, taking
+	// MetadataOpTime.
+	JournalCommitTime time.Duration
+
+	// FsyncFlushesAllData denotes whether, with WriteBackCachedFsync, an fsync writes back every
+	// file's data in the write back cache rather than just its own, as with ext4's data=ordered
+	// journaling, where committing the journal first writes out all data it refers to.
+	FsyncFlushesAllData bool
+
+	// FdatasyncStrategy, if set, denotes which algorithm to use for modeling fdatasync, instead of
+	// FsyncStrategy. Either way, fdatasync only makes a file's data durable, so it never pays for
+	// committing metadata or the journal, nor joins group commits.
+	FdatasyncStrategy *FsyncStrategy
+
+	// VerifyWrites denotes whether data written to the device is read back to verify it, as on
+	// archival configurations, costing a read of it on top of each write, write back and flush.
+	VerifyWrites bool
+
+	// ReadAheadBytes denotes how much data past a sequential read of a file is prefetched with it,
+	// like the kernel's read-ahead, so that reads of it which follow don't touch the device. Reads
+	// are sequential if they start at the beginning of the file, or where the last one ended. If
+	// zero, nothing is prefetched.
+	ReadAheadBytes units.NumBytes
+
+	// NoOpStrategy denotes how operations which change nothing are charged: zero-length writes and
+	// fallocates, and truncates which leave a file's size alone.
+	NoOpStrategy NoOpStrategy
+
+	// AlignmentBytes denotes the boundary reads and writes should be aligned to, like a device's 512
+	// byte or 4KiB sectors. Requests whose offset or size isn't a multiple of it take
+	// MisalignmentPenalty longer. If zero, alignment doesn't matter.
+	AlignmentBytes units.NumBytes
+
+	// MisalignmentPenalty denotes how much longer a misaligned read or write takes, for the device
+	// to read the partial sectors at its ends and, for writes, merge them with the new data.
+	MisalignmentPenalty time.Duration
+
+	// DirectoryEntryTime denotes how long scanning each entry of a directory takes, so that
+	// operations on large directories are slower than on small ones. Listing a directory scans all
+	// of its entries, while looking up, adding or removing one scans half of its parent's on
+	// average. Either way, the directory is sought first. If zero, directory size doesn't matter.
+	DirectoryEntryTime time.Duration
+
+	// DeviceCapacity denotes the size of the device, which statfs reports and past which writes
+	// fail with ENOSPC, whatever the backing directory's free space. If zero, the device is as big
+	// as the backing directory's file system.
+	DeviceCapacity units.NumBytes
 }
 
 func (dc *DeviceConfig) String() string {
 	return fmt.Sprintf(`%s:
-  %-22s %s
-  %-22s %s
-  %-22s %s
-  %-22s %s
-  %-22s %s
-  %-22s %s
-  %-22s %s
-  %-22s %s
-  %-22s %s`,
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %g
+  %-25s %d
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %t
+  %-25s %s
+  %-25s %d
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %t
+  %-25s %s
+  %-25s %t
+  %-25s %t
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %d
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %t
+  %-25s %s
+  %-25s %t
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s
+  %-25s %s`,
 		dc.Name, "SeekWindow", dc.SeekWindow, "SeekTime", dc.SeekTime,
 		"ReadBytesPerSecond", dc.ReadBytesPerSecond, "WriteBytesPerSecond", dc.WriteBytesPerSecond,
 		"AllocateBytesPerSecond", dc.AllocateBytesPerSecond, "RequestReorderMaxDelay", dc.RequestReorderMaxDelay,
-		"FsyncStrategy", dc.FsyncStrategy, "WriteStrategy", dc.WriteStrategy, "MetadataOpTime", dc.MetadataOpTime)
+		"FsyncStrategy", dc.FsyncStrategy, "WriteStrategy", dc.WriteStrategy, "MetadataOpTime", dc.MetadataOpTime,
+		"ReadRepairProbability", dc.ReadRepairProbability, "ReadRepairSeeks", dc.ReadRepairSeeks,
+		"MetadataBytesPerSecond", dc.MetadataBytesPerSecond, "MetadataStrategy", dc.MetadataStrategy,
+		"MetadataCommitInterval", dc.MetadataCommitInterval, "FlushOnClose", dc.FlushOnClose,
+		"MetadataDevice", dc.MetadataDevice, "Actuators", dc.Actuators,
+		"FreeBytesPerSecond", dc.FreeBytesPerSecond, "ZeroFillBytesPerSecond", dc.ZeroFillBytesPerSecond,
+		"DirectoryLockTime", dc.DirectoryLockTime, "ReclaimBytesPerSecond", dc.ReclaimBytesPerSecond,
+		"DeletedRetention", dc.DeletedRetention, "ReadWriteBackCache", dc.ReadWriteBackCache,
+		"UploadBytesPerSecond", dc.UploadBytesPerSecond, "FsyncWaitsForUpload", dc.FsyncWaitsForUpload,
+		"CloseWaitsForUpload", dc.CloseWaitsForUpload, "NetworkLatency", dc.NetworkLatency,
+		"NetworkBytesPerSecond", dc.NetworkBytesPerSecond, "FsyncGroupWindow", dc.FsyncGroupWindow,
+		"SeekTimeDistribution", dc.SeekTimeDistribution, "MetadataOpDistribution", dc.MetadataOpDistribution,
+		"BaseLatency", dc.BaseLatency, "RandomReadBytesPerSecond", dc.RandomReadBytesPerSecond,
+		"RandomWriteBytesPerSecond", dc.RandomWriteBytesPerSecond, "QueueDepth", dc.QueueDepth,
+		"ReadCacheBytes", dc.ReadCacheBytes, "ReadCacheEviction", dc.ReadCacheEviction,
+		"ReadCacheHitTime", dc.ReadCacheHitTime, "JournalCommitTime", dc.JournalCommitTime,
+		"FsyncFlushesAllData", dc.FsyncFlushesAllData, "FdatasyncStrategy", dc.EffectiveFdatasyncStrategy(),
+		"VerifyWrites", dc.VerifyWrites, "ReadAheadBytes", dc.ReadAheadBytes,
+		"NoOpStrategy", dc.NoOpStrategy, "AlignmentBytes", dc.AlignmentBytes,
+		"MisalignmentPenalty", dc.MisalignmentPenalty, "DirectoryEntryTime", dc.DirectoryEntryTime,
+		"DeviceCapacity", dc.DeviceCapacity)
+}
+
+// EffectiveFdatasyncStrategy returns which algorithm to use for modeling fdatasync: its own, if
+// FdatasyncStrategy is set, or else FsyncStrategy.
+func (dc *DeviceConfig) EffectiveFdatasyncStrategy() FsyncStrategy {
+	if dc.FdatasyncStrategy != nil {
+		return *dc.FdatasyncStrategy
+	}
+	return dc.FsyncStrategy
 }
 
 func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
@@ -176,8 +535,54 @@ func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
 		"MetadataOpTime":         {},
 	}
 
+	// Fields added after the config file format was introduced are optional, so that existing
+	// config files keep working. They default to their zero value.
+	optionalFields := map[string]struct{}{
+		"ReadRepairProbability":     {},
+		"ReadRepairSeeks":           {},
+		"MetadataBytesPerSecond":    {},
+		"MetadataStrategy":          {},
+		"MetadataCommitInterval":    {},
+		"FlushOnClose":              {},
+		"MetadataDevice":            {},
+		"Actuators":                 {},
+		"FreeBytesPerSecond":        {},
+		"ZeroFillBytesPerSecond":    {},
+		"DirectoryLockTime":         {},
+		"ReclaimBytesPerSecond":     {},
+		"DeletedRetention":          {},
+		"ReadWriteBackCache":        {},
+		"UploadBytesPerSecond":      {},
+		"FsyncWaitsForUpload":       {},
+		"CloseWaitsForUpload":       {},
+		"NetworkLatency":            {},
+		"NetworkBytesPerSecond":     {},
+		"FsyncGroupWindow":          {},
+		"SeekTimeDistribution":      {},
+		"MetadataOpDistribution":    {},
+		"BaseLatency":               {},
+		"RandomReadBytesPerSecond":  {},
+		"RandomWriteBytesPerSecond": {},
+		"QueueDepth":                {},
+		"ReadCacheBytes":            {},
+		"ReadCacheEviction":         {},
+		"ReadCacheHitTime":          {},
+		"JournalCommitTime":         {},
+		"FsyncFlushesAllData":       {},
+		"FdatasyncStrategy":         {},
+		"VerifyWrites":              {},
+		"ReadAheadBytes":            {},
+		"NoOpStrategy":              {},
+		"AlignmentBytes":            {},
+		"MisalignmentPenalty":       {},
+		"DirectoryEntryTime":        {},
+		"DeviceCapacity":            {},
+	}
+
 	for k, v := range obj {
-		if _, ok := missingFields[k]; !ok {
+		_, required := missingFields[k]
+		_, optional := optionalFields[k]
+		if !required && !optional {
 			return nil, fmt.Errorf("spurious field %s", k)
 		}
 		delete(missingFields, k)
@@ -187,36 +592,9 @@ func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
 			return nil, fmt.Errorf("%s: want string type, got %v", k, v)
 		}
 
-		var err error
-		switch k {
-		case "Name":
-			dc.Name = strVal
-		case "SeekWindow":
-			dc.SeekWindow, err = units.ParseNumBytesFromString(strVal)
-		case "SeekTime":
-			dc.SeekTime, err = time.ParseDuration(strVal)
-		case "ReadBytesPerSecond":
-			dc.ReadBytesPerSecond, err = units.ParseNumBytesFromString(strVal)
-		case "WriteBytesPerSecond":
-			dc.WriteBytesPerSecond, err = units.ParseNumBytesFromString(strVal)
-		case "AllocateBytesPerSecond":
-			dc.AllocateBytesPerSecond, err = units.ParseNumBytesFromString(strVal)
-		case "RequestReorderMaxDelay":
-			dc.RequestReorderMaxDelay, err = time.ParseDuration(strVal)
-		case "FsyncStrategy":
-			dc.FsyncStrategy, err = ParseFsyncStrategyFromString(strVal)
-		case "WriteStrategy":
-			dc.WriteStrategy, err = ParseWriteStrategyFromString(strVal)
-		case "MetadataOpTime":
-			dc.MetadataOpTime, err = time.ParseDuration(strVal)
-		default:
-			panic("bug")
+		if err := dc.SetField(k, strVal); err != nil {
+			return nil, err
 		}
-
-		if err != nil {
-			return nil, fmt.Errorf("%s: %s", k, err)
-		}
-
 	}
 
 	if len(missingFields) != 0 {
@@ -230,6 +608,121 @@ func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
 	return &dc, nil
 }
 
+// SetField sets the field with the given name, as it would be written in a config file, from its
+// string form.
+func (dc *DeviceConfig) SetField(name, value string) error {
+	var err error
+	switch name {
+	case "Name":
+		dc.Name = value
+	case "SeekWindow":
+		dc.SeekWindow, err = units.ParseNumBytesFromString(value)
+	case "SeekTime":
+		dc.SeekTime, err = time.ParseDuration(value)
+	case "ReadBytesPerSecond":
+		dc.ReadBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "WriteBytesPerSecond":
+		dc.WriteBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "AllocateBytesPerSecond":
+		dc.AllocateBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "RequestReorderMaxDelay":
+		dc.RequestReorderMaxDelay, err = time.ParseDuration(value)
+	case "FsyncStrategy":
+		dc.FsyncStrategy, err = ParseFsyncStrategyFromString(value)
+	case "WriteStrategy":
+		dc.WriteStrategy, err = ParseWriteStrategyFromString(value)
+	case "MetadataOpTime":
+		dc.MetadataOpTime, err = time.ParseDuration(value)
+	case "ReadRepairProbability":
+		dc.ReadRepairProbability, err = strconv.ParseFloat(value, 64)
+	case "ReadRepairSeeks":
+		dc.ReadRepairSeeks, err = strconv.Atoi(value)
+	case "MetadataBytesPerSecond":
+		dc.MetadataBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "MetadataStrategy":
+		dc.MetadataStrategy, err = ParseMetadataStrategyFromString(value)
+	case "MetadataCommitInterval":
+		dc.MetadataCommitInterval, err = time.ParseDuration(value)
+	case "FlushOnClose":
+		dc.FlushOnClose, err = strconv.ParseBool(value)
+	case "MetadataDevice":
+		dc.MetadataDevice = value
+	case "Actuators":
+		dc.Actuators, err = strconv.Atoi(value)
+	case "FreeBytesPerSecond":
+		dc.FreeBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "ZeroFillBytesPerSecond":
+		dc.ZeroFillBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "DirectoryLockTime":
+		dc.DirectoryLockTime, err = time.ParseDuration(value)
+	case "ReclaimBytesPerSecond":
+		dc.ReclaimBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "DeletedRetention":
+		dc.DeletedRetention, err = time.ParseDuration(value)
+	case "ReadWriteBackCache":
+		dc.ReadWriteBackCache, err = strconv.ParseBool(value)
+	case "UploadBytesPerSecond":
+		dc.UploadBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "FsyncWaitsForUpload":
+		dc.FsyncWaitsForUpload, err = strconv.ParseBool(value)
+	case "CloseWaitsForUpload":
+		dc.CloseWaitsForUpload, err = strconv.ParseBool(value)
+	case "NetworkLatency":
+		dc.NetworkLatency, err = time.ParseDuration(value)
+	case "NetworkBytesPerSecond":
+		dc.NetworkBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "FsyncGroupWindow":
+		dc.FsyncGroupWindow, err = time.ParseDuration(value)
+	case "SeekTimeDistribution":
+		dc.SeekTimeDistribution, err = ParseDistributionFromString(value)
+	case "MetadataOpDistribution":
+		dc.MetadataOpDistribution, err = ParseDistributionFromString(value)
+	case "BaseLatency":
+		dc.BaseLatency, err = ParseDistributionFromString(value)
+	case "RandomReadBytesPerSecond":
+		dc.RandomReadBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "RandomWriteBytesPerSecond":
+		dc.RandomWriteBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "QueueDepth":
+		dc.QueueDepth, err = strconv.Atoi(value)
+	case "ReadCacheBytes":
+		dc.ReadCacheBytes, err = units.ParseNumBytesFromString(value)
+	case "ReadCacheEviction":
+		dc.ReadCacheEviction, err = ParseEvictionPolicyFromString(value)
+	case "ReadCacheHitTime":
+		dc.ReadCacheHitTime, err = time.ParseDuration(value)
+	case "JournalCommitTime":
+		dc.JournalCommitTime, err = time.ParseDuration(value)
+	case "FsyncFlushesAllData":
+		dc.FsyncFlushesAllData, err = strconv.ParseBool(value)
+	case "FdatasyncStrategy":
+		var strategy FsyncStrategy
+		if strategy, err = ParseFsyncStrategyFromString(value); err == nil {
+			dc.FdatasyncStrategy = &strategy
+		}
+	case "VerifyWrites":
+		dc.VerifyWrites, err = strconv.ParseBool(value)
+	case "ReadAheadBytes":
+		dc.ReadAheadBytes, err = units.ParseNumBytesFromString(value)
+	case "NoOpStrategy":
+		dc.NoOpStrategy, err = ParseNoOpStrategyFromString(value)
+	case "AlignmentBytes":
+		dc.AlignmentBytes, err = units.ParseNumBytesFromString(value)
+	case "MisalignmentPenalty":
+		dc.MisalignmentPenalty, err = time.ParseDuration(value)
+	case "DirectoryEntryTime":
+		dc.DirectoryEntryTime, err = time.ParseDuration(value)
+	case "DeviceCapacity":
+		dc.DeviceCapacity, err = units.ParseNumBytesFromString(value)
+	default:
+		return fmt.Errorf("unknown field %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return nil
+}
+
 // ParseDeviceConfigsFromJSON parses json containing an array of device configs.
 func ParseDeviceConfigsFromJSON(data []byte) ([]*DeviceConfig, error) {
 	// We can't set required fields or similar, so check for missing fields or spurious fields
@@ -283,12 +776,127 @@ func (dc *DeviceConfig) Validate() error {
 	if dc.MetadataOpTime < 0 {
 		return errors.New("MetadataOpTime cannot be negative.")
 	}
+	if dc.ReadRepairProbability < 0 || dc.ReadRepairProbability > 1 {
+		return errors.New("ReadRepairProbability must be between 0 and 1.")
+	}
+	if dc.ReadRepairSeeks < 0 {
+		return errors.New("ReadRepairSeeks cannot be negative.")
+	}
+	if dc.MetadataBytesPerSecond < 0 {
+		return errors.New("MetadataBytesPerSecond cannot be negative.")
+	}
+	if dc.FreeBytesPerSecond < 0 {
+		return errors.New("FreeBytesPerSecond cannot be negative.")
+	}
+	if dc.ZeroFillBytesPerSecond < 0 {
+		return errors.New("ZeroFillBytesPerSecond cannot be negative.")
+	}
+	if dc.DirectoryLockTime < 0 {
+		return errors.New("DirectoryLockTime cannot be negative.")
+	}
+	if dc.ReclaimBytesPerSecond < 0 {
+		return errors.New("ReclaimBytesPerSecond cannot be negative.")
+	}
+	if dc.DeletedRetention < 0 {
+		return errors.New("DeletedRetention cannot be negative.")
+	}
+	if dc.UploadBytesPerSecond < 0 {
+		return errors.New("UploadBytesPerSecond cannot be negative.")
+	}
+	if dc.NetworkLatency < 0 {
+		return errors.New("NetworkLatency cannot be negative.")
+	}
+	if dc.NetworkBytesPerSecond < 0 {
+		return errors.New("NetworkBytesPerSecond cannot be negative.")
+	}
+	if dc.FsyncGroupWindow < 0 {
+		return errors.New("FsyncGroupWindow cannot be negative.")
+	}
+	if dc.RandomReadBytesPerSecond < 0 {
+		return errors.New("RandomReadBytesPerSecond cannot be negative.")
+	}
+	if dc.RandomWriteBytesPerSecond < 0 {
+		return errors.New("RandomWriteBytesPerSecond cannot be negative.")
+	}
+	for _, d := range []struct {
+		name         string
+		distribution *Distribution
+	}{
+		{"SeekTimeDistribution", dc.SeekTimeDistribution},
+		{"MetadataOpDistribution", dc.MetadataOpDistribution},
+		{"BaseLatency", dc.BaseLatency},
+	} {
+		if d.distribution == nil {
+			continue
+		}
+		if err := d.distribution.Validate(); err != nil {
+			return fmt.Errorf("%s: %s.", d.name, err)
+		}
+	}
+	if dc.Actuators < 0 {
+		return errors.New("Actuators cannot be negative.")
+	}
+	if dc.QueueDepth < 0 {
+		return errors.New("QueueDepth cannot be negative.")
+	}
+	if dc.ReadCacheBytes < 0 {
+		return errors.New("ReadCacheBytes cannot be negative.")
+	}
+	if dc.ReadCacheHitTime < 0 {
+		return errors.New("ReadCacheHitTime cannot be negative.")
+	}
+	if dc.JournalCommitTime < 0 {
+		return errors.New("JournalCommitTime cannot be negative.")
+	}
+	if dc.ReadAheadBytes < 0 {
+		return errors.New("ReadAheadBytes cannot be negative.")
+	}
+	if dc.AlignmentBytes < 0 {
+		return errors.New("AlignmentBytes cannot be negative.")
+	}
+	if dc.MisalignmentPenalty < 0 {
+		return errors.New("MisalignmentPenalty cannot be negative.")
+	}
+	if dc.DirectoryEntryTime < 0 {
+		return errors.New("DirectoryEntryTime cannot be negative.")
+	}
+	if dc.DeviceCapacity < 0 {
+		return errors.New("DeviceCapacity cannot be negative.")
+	}
+	if dc.EffectiveFdatasyncStrategy() == WriteBackCachedFsync && dc.FsyncStrategy != WriteBackCachedFsync {
+		return errors.New("FdatasyncStrategy cannot be WriteBackCachedFsync unless FsyncStrategy is, since nothing is cached otherwise.")
+	}
+	if dc.MetadataCommitInterval < 0 {
+		return errors.New("MetadataCommitInterval cannot be negative.")
+	}
+	if dc.MetadataStrategy == JournaledMetadata && dc.MetadataCommitInterval == 0 {
+		return errors.New("MetadataCommitInterval must be set with JournaledMetadata.")
+	}
 
 	if dc.WriteStrategy == SimulateWrite && dc.FsyncStrategy == WriteBackCachedFsync {
 		log.Println("setting both simulated writes and write back cache is probably not what you want. " +
 			"Write back cache is meant to simulate writes being cached in memory and taking minimal time, " +
 			"then being written back to disk later, either during spare IO time or at an fsync.")
 	}
+	if dc.MetadataDevice == dc.Name && dc.Name != "" {
+		return errors.New("MetadataDevice cannot be the device itself.")
+	}
+
+	if dc.FlushOnClose && dc.FsyncStrategy != WriteBackCachedFsync {
+		log.Println("FlushOnClose has no effect without the write back cache fsync strategy, since nothing is cached")
+	}
+	if dc.ReadWriteBackCache && dc.FsyncStrategy != WriteBackCachedFsync {
+		log.Println("ReadWriteBackCache has no effect without the write back cache fsync strategy, since nothing is cached")
+	}
+	if dc.FsyncFlushesAllData && dc.FsyncStrategy != WriteBackCachedFsync {
+		log.Println("FsyncFlushesAllData has no effect without the write back cache fsync strategy, since nothing is cached")
+	}
+	if (dc.FsyncWaitsForUpload || dc.CloseWaitsForUpload) && dc.UploadBytesPerSecond == 0 {
+		log.Println("FsyncWaitsForUpload and CloseWaitsForUpload have no effect without UploadBytesPerSecond, since nothing is uploaded")
+	}
+	if dc.FsyncGroupWindow > 0 && dc.FsyncStrategy == NoFsync {
+		log.Println("FsyncGroupWindow has no effect with the no fsync strategy, since there is no flush to share")
+	}
 
 	return nil
 }
@@ -303,14 +911,101 @@ func (dc *DeviceConfig) ReadTime(numBytes units.NumBytes) time.Duration {
 	return computeTimeFromThroughput(numBytes, dc.ReadBytesPerSecond)
 }
 
+// RandomWriteTime computes how long writing numBytes will take after seeking.
+func (dc *DeviceConfig) RandomWriteTime(numBytes units.NumBytes) time.Duration {
+	if dc.RandomWriteBytesPerSecond == 0 {
+		return dc.WriteTime(numBytes)
+	}
+	return computeTimeFromThroughput(numBytes, dc.RandomWriteBytesPerSecond)
+}
+
+// RandomReadTime computes how long reading numBytes will take after seeking.
+func (dc *DeviceConfig) RandomReadTime(numBytes units.NumBytes) time.Duration {
+	if dc.RandomReadBytesPerSecond == 0 {
+		return dc.ReadTime(numBytes)
+	}
+	return computeTimeFromThroughput(numBytes, dc.RandomReadBytesPerSecond)
+}
+
 // AllocateTime computes how long allocating numBytes will take.
 func (dc *DeviceConfig) AllocateTime(numBytes units.NumBytes) time.Duration {
 	return computeTimeFromThroughput(numBytes, dc.AllocateBytesPerSecond)
 }
 
-// WritableBytes computes how many bytes can be written in the given duration.
+// MetadataTime computes how long listing numBytes of directory entries will take, on top of
+// MetadataOpTime.
+func (dc *DeviceConfig) MetadataTime(numBytes units.NumBytes) time.Duration {
+	if dc.MetadataBytesPerSecond == 0 {
+		return 0
+	}
+	return computeTimeFromThroughput(numBytes, dc.MetadataBytesPerSecond)
+}
+
+// FreeTime computes how long truncating a file will take to free numBytes, on top of
+// MetadataOpTime.
+func (dc *DeviceConfig) FreeTime(numBytes units.NumBytes) time.Duration {
+	if dc.FreeBytesPerSecond == 0 {
+		return 0
+	}
+	return computeTimeFromThroughput(numBytes, dc.FreeBytesPerSecond)
+}
+
+// ZeroFillTime computes how long extending a file by numBytes will take, on top of MetadataOpTime.
+func (dc *DeviceConfig) ZeroFillTime(numBytes units.NumBytes) time.Duration {
+	if dc.ZeroFillBytesPerSecond == 0 {
+		return 0
+	}
+	return computeTimeFromThroughput(numBytes, dc.ZeroFillBytesPerSecond)
+}
+
+// NetworkTime computes how long sending numBytes over the network will take, on top of
+// NetworkLatency.
+func (dc *DeviceConfig) NetworkTime(numBytes units.NumBytes) time.Duration {
+	if dc.NetworkBytesPerSecond == 0 {
+		return 0
+	}
+	return computeTimeFromThroughput(numBytes, dc.NetworkBytesPerSecond)
+}
+
+// UploadTime computes how long uploading numBytes will take.
+func (dc *DeviceConfig) UploadTime(numBytes units.NumBytes) time.Duration {
+	return computeTimeFromThroughput(numBytes, dc.UploadBytesPerSecond)
+}
+
+// VerifyTime computes how long reading back numBytes just written takes, if VerifyWrites is set.
+func (dc *DeviceConfig) VerifyTime(numBytes units.NumBytes) time.Duration {
+	if !dc.VerifyWrites {
+		return 0
+	}
+	return dc.ReadTime(numBytes)
+}
+
+// MisalignmentTime computes the extra time a read or write of size bytes at offset start takes, which
+// is MisalignmentPenalty if either isn't a multiple of AlignmentBytes.
+func (dc *DeviceConfig) MisalignmentTime(start, size units.NumBytes) time.Duration {
+	if dc.AlignmentBytes <= 0 || (start%dc.AlignmentBytes == 0 && size%dc.AlignmentBytes == 0) {
+		return 0
+	}
+	return dc.MisalignmentPenalty
+}
+
+// DirectoryScanTime computes how long scanning the given number of directory entries takes.
+func (dc *DeviceConfig) DirectoryScanTime(entries int64) time.Duration {
+	return units.DurationMul(dc.DirectoryEntryTime, entries)
+}
+
+// WritableBytes computes how many bytes can be written in the given duration, including reading
+// them back if VerifyWrites is set.
 func (dc *DeviceConfig) WritableBytes(duration time.Duration) units.NumBytes {
-	return computeBytesFromTime(duration, dc.WriteBytesPerSecond)
+	if !dc.VerifyWrites {
+		return computeBytesFromTime(duration, dc.WriteBytesPerSecond)
+	}
+	if duration <= 0 || dc.WriteBytesPerSecond <= 0 || dc.ReadBytesPerSecond <= 0 {
+		return 0
+	}
+	// Each byte takes its write time plus its read time.
+	perSecond := 1 / (1/float64(dc.WriteBytesPerSecond) + 1/float64(dc.ReadBytesPerSecond))
+	return units.NumBytesFromFloat(float64(duration) / float64(time.Second) * perSecond)
 }
 
 // ReadableBytes computes how many bytes can be read in the given duration.
@@ -318,15 +1013,31 @@ func (dc *DeviceConfig) ReadableBytes(duration time.Duration) units.NumBytes {
 	return computeBytesFromTime(duration, dc.ReadBytesPerSecond)
 }
 
+// UploadableBytes computes how many bytes can be uploaded in the given duration.
+func (dc *DeviceConfig) UploadableBytes(duration time.Duration) units.NumBytes {
+	return computeBytesFromTime(duration, dc.UploadBytesPerSecond)
+}
+
+// computeTimeFromThroughput computes how long moving numBytes at bytesPerSecond takes, saturating at
+// units.MaxDuration for enormous byte counts. A device which can't move any bytes never finishes, so
+// a rate of 0 also gives units.MaxDuration, unless there is nothing to move.
 func computeTimeFromThroughput(numBytes, bytesPerSecond units.NumBytes) time.Duration {
-	return time.Duration(float64(numBytes) / float64(bytesPerSecond) * float64(time.Second))
+	if numBytes <= 0 {
+		return 0
+	}
+	if bytesPerSecond <= 0 {
+		return units.MaxDuration
+	}
+	return units.DurationFromFloat(float64(numBytes) / float64(bytesPerSecond) * float64(time.Second))
 }
 
+// computeBytesFromTime computes how many bytes can be moved at bytesPerSecond in duration,
+// saturating at units.MaxNumBytes.
 func computeBytesFromTime(duration time.Duration, bytesPerSecond units.NumBytes) units.NumBytes {
-	if duration <= 0 {
+	if duration <= 0 || bytesPerSecond <= 0 {
 		return 0
 	}
-	return units.NumBytes(float64(duration) / float64(time.Second) * float64(bytesPerSecond))
+	return units.NumBytesFromFloat(float64(duration) / float64(time.Second) * float64(bytesPerSecond))
 }
 
 // Below follows the list of preset device configurations. If you add configurations, please
@@ -347,3 +1058,73 @@ var HDD7200RpmDeviceConfig = DeviceConfig{
 	WriteStrategy:          FastWrite,
 	MetadataOpTime:         10 * time.Millisecond,
 }
+
+// NFSDeviceConfig is a basic model of a 7200rpm hard disk exported over NFS on gigabit ethernet.
+var NFSDeviceConfig = DeviceConfig{
+	Name:                   "nfs",
+	SeekWindow:             4 * units.Kibibyte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Mebibyte,
+	WriteBytesPerSecond:    100 * units.Mebibyte,
+	AllocateBytesPerSecond: 4096 * 100 * units.Mebibyte,
+	RequestReorderMaxDelay: 100 * time.Microsecond,
+	FsyncStrategy:          WriteBackCachedFsync,
+	WriteStrategy:          FastWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	FlushOnClose:           true,
+	NetworkLatency:         500 * time.Microsecond,
+	NetworkBytesPerSecond:  110 * units.Megabyte,
+}
+
+// SSDDeviceConfig is a basic model of a SATA SSD. Flash has no heads to move, but every access
+// which isn't sequential still pays for a command round trip and a flash page read, which the seek
+// time stands in for, and moves data slower than a stream, since it can't be read ahead or striped
+// across dies as well. So small random reads manage around ten thousand per second, a fraction of
+// the sequential throughput.
+var SSDDeviceConfig = DeviceConfig{
+	Name:                      "ssd",
+	SeekWindow:                128 * units.Kibibyte,
+	SeekTime:                  90 * time.Microsecond,
+	ReadBytesPerSecond:        530 * units.Megabyte,
+	WriteBytesPerSecond:       480 * units.Megabyte,
+	RandomReadBytesPerSecond:  350 * units.Megabyte,
+	RandomWriteBytesPerSecond: 300 * units.Megabyte,
+	AllocateBytesPerSecond:    4096 * 480 * units.Megabyte,
+	RequestReorderMaxDelay:    20 * time.Microsecond,
+	FsyncStrategy:             WriteBackCachedFsync,
+	WriteStrategy:             FastWrite,
+	MetadataOpTime:            100 * time.Microsecond,
+}
+
+// NVMeDeviceConfig is a basic model of a PCIe NVMe SSD. Random accesses cost less than on SATA
+// SSDs, and the device serves several queues in parallel, which actuators stand in for, so
+// requests to different files don't wait for each other.
+var NVMeDeviceConfig = DeviceConfig{
+	Name:                      "nvme",
+	SeekWindow:                128 * units.Kibibyte,
+	SeekTime:                  20 * time.Microsecond,
+	ReadBytesPerSecond:        3 * units.Gigabyte,
+	WriteBytesPerSecond:       2 * units.Gigabyte,
+	RandomReadBytesPerSecond:  1500 * units.Megabyte,
+	RandomWriteBytesPerSecond: 1200 * units.Megabyte,
+	AllocateBytesPerSecond:    4096 * 2 * units.Gigabyte,
+	RequestReorderMaxDelay:    10 * time.Microsecond,
+	FsyncStrategy:             WriteBackCachedFsync,
+	WriteStrategy:             FastWrite,
+	MetadataOpTime:            20 * time.Microsecond,
+	Actuators:                 4,
+}
+
+// PMEMDeviceConfig is a basic model of byte-addressable persistent memory, like Optane DC PMem,
+// under a DAX filesystem. Nothing moves and nothing is queued, so there are no seeks, and writes are
+// stores which cost next to nothing until fsync flushes the cache lines they dirtied, at the rate
+// the write back cache writes at.
+var PMEMDeviceConfig = DeviceConfig{
+	Name:                   "pmem",
+	ReadBytesPerSecond:     6600 * units.Megabyte,
+	WriteBytesPerSecond:    2300 * units.Megabyte,
+	AllocateBytesPerSecond: 4096 * 2300 * units.Megabyte,
+	FsyncStrategy:          WriteBackCachedFsync,
+	WriteStrategy:          FastWrite,
+	MetadataOpTime:         2 * time.Microsecond,
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"flag"
+	"math/rand"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+var (
+	propertySeed   = flag.Int64("property_seed", 0, "seed for property tests, or 0 to pick one from the clock")
+	propertyRounds = flag.Int("property_rounds", 10000, "how many random values property tests try")
+)
+
+// propertyRand returns a random source for property tests, logging its seed so that a failure can
+// be reproduced with --property_seed.
+func propertyRand(t *testing.T) *rand.Rand {
+	seed := *propertySeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("using --property_seed=%d", seed)
+	return rand.New(rand.NewSource(seed))
+}
+
+func TestComputeTimeFromThroughput_Properties(t *testing.T) {
+	r := propertyRand(t)
+	for i := 0; i < *propertyRounds; i++ {
+		// Up to a tebibyte at a byte per second and more still fits in a time.Duration.
+		numBytes := units.NumBytes(r.Int63n(int64(units.Tebibyte)))
+		bytesPerSecond := 1 + units.NumBytes(r.Int63n(int64(10*units.Gibibyte)))
+		more := numBytes + units.NumBytes(r.Int63n(int64(units.Gibibyte)))
+
+		d := computeTimeFromThroughput(numBytes, bytesPerSecond)
+		if d < 0 {
+			t.Errorf("computeTimeFromThroughput(%d, %d) = %s, want >= 0", numBytes, bytesPerSecond, d)
+		}
+		if got := computeTimeFromThroughput(more, bytesPerSecond); got < d {
+			t.Errorf("computeTimeFromThroughput(%d, %d) = %s, less than %s for %d bytes",
+				more, bytesPerSecond, got, d, numBytes)
+		}
+
+		// Converting back loses at most what rounding to a nanosecond and to a byte does.
+		back := computeBytesFromTime(d, bytesPerSecond)
+		slack := 1 + bytesPerSecond/units.NumBytes(time.Second) + numBytes/(1<<40)
+		if back < 0 || back > numBytes || numBytes-back > slack {
+			t.Errorf("computeBytesFromTime(computeTimeFromThroughput(%d, %d)) = %d, want within %d of %d",
+				numBytes, bytesPerSecond, back, slack, numBytes)
+		}
+	}
+}
+
+func TestComputeBytesFromTime_Properties(t *testing.T) {
+	r := propertyRand(t)
+	for i := 0; i < *propertyRounds; i++ {
+		// Negative durations happen when a request arrives before the device is free.
+		duration := time.Duration(r.Int63n(int64(200*time.Hour))) - 100*time.Hour
+		bytesPerSecond := units.NumBytes(r.Int63n(int64(10 * units.Gibibyte)))
+		longer := duration + time.Duration(r.Int63n(int64(time.Hour)))
+
+		n := computeBytesFromTime(duration, bytesPerSecond)
+		if n < 0 {
+			t.Errorf("computeBytesFromTime(%s, %d) = %d, want >= 0", duration, bytesPerSecond, n)
+		}
+		if duration <= 0 && n != 0 {
+			t.Errorf("computeBytesFromTime(%s, %d) = %d, want 0", duration, bytesPerSecond, n)
+		}
+		if got := computeBytesFromTime(longer, bytesPerSecond); got < n {
+			t.Errorf("computeBytesFromTime(%s, %d) = %d, less than %d in %s",
+				longer, bytesPerSecond, got, n, duration)
+		}
+	}
+}
+
+func TestComputeTimeFromThroughput_ExtremeProperties(t *testing.T) {
+	r := propertyRand(t)
+	for i := 0; i < *propertyRounds; i++ {
+		// Anything goes, including byte counts and rates no device has, and rates of 0.
+		numBytes := units.NumBytes(r.Int63())
+		bytesPerSecond := units.NumBytes(r.Int63n(int64(units.Gibibyte))) - units.Mebibyte
+		more := units.NumBytesAdd(numBytes, units.NumBytes(r.Int63()))
+
+		d := computeTimeFromThroughput(numBytes, bytesPerSecond)
+		if d < 0 {
+			t.Errorf("computeTimeFromThroughput(%d, %d) = %s, want >= 0", numBytes, bytesPerSecond, d)
+		}
+		if got := computeTimeFromThroughput(more, bytesPerSecond); got < d {
+			t.Errorf("computeTimeFromThroughput(%d, %d) = %s, less than %s for %d bytes",
+				more, bytesPerSecond, got, d, numBytes)
+		}
+
+		duration := time.Duration(r.Int63()) - time.Duration(r.Int63())
+		longer := units.DurationAdd(duration, time.Duration(r.Int63()))
+		n := computeBytesFromTime(duration, bytesPerSecond)
+		if n < 0 {
+			t.Errorf("computeBytesFromTime(%s, %d) = %d, want >= 0", duration, bytesPerSecond, n)
+		}
+		if got := computeBytesFromTime(longer, bytesPerSecond); got < n {
+			t.Errorf("computeBytesFromTime(%s, %d) = %d, less than %d in %s",
+				longer, bytesPerSecond, got, n, duration)
+		}
+	}
+}
+
+func TestDeviceConfig_OptionalRatesProperties(t *testing.T) {
+	r := propertyRand(t)
+	for i := 0; i < *propertyRounds; i++ {
+		numBytes := units.NumBytes(r.Int63n(int64(units.Tebibyte)))
+		dc := &DeviceConfig{}
+		// Leaving optional rates at 0 turns their cost off, rather than dividing by zero.
+		for _, f := range []func(units.NumBytes) time.Duration{dc.MetadataTime, dc.FreeTime, dc.ZeroFillTime, dc.NetworkTime} {
+			if got := f(numBytes); got != 0 {
+				t.Errorf("with no rate set, time for %d bytes = %s, want 0", numBytes, got)
+			}
+		}
+	}
+}
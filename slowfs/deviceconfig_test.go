@@ -17,6 +17,7 @@ package slowfs
 import (
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"slowfs/slowfs/units"
 	"testing"
@@ -35,20 +36,60 @@ func ExampleDeviceConfig_String() {
 		FsyncStrategy:          WriteBackCachedFsync,
 		WriteStrategy:          FastWrite,
 		MetadataOpTime:         10 * time.Millisecond,
+		MetadataDevice:         "ssd",
 	}
 
 	fmt.Println(n.String())
 	// Output:
 	// example:
-	//   SeekWindow             4.10KB (4096)
-	//   SeekTime               10ms
-	//   ReadBytesPerSecond     104.86MB (104857600)
-	//   WriteBytesPerSecond    104.86MB (104857600)
-	//   AllocateBytesPerSecond 429.50GB (429496729600)
-	//   RequestReorderMaxDelay 100µs
-	//   FsyncStrategy          WriteBackCachedFsync
-	//   WriteStrategy          FastWrite
-	//   MetadataOpTime         10ms
+	//   SeekWindow                4.10KB (4096)
+	//   SeekTime                  10ms
+	//   ReadBytesPerSecond        104.86MB (104857600)
+	//   WriteBytesPerSecond       104.86MB (104857600)
+	//   AllocateBytesPerSecond    429.50GB (429496729600)
+	//   RequestReorderMaxDelay    100µs
+	//   FsyncStrategy             WriteBackCachedFsync
+	//   WriteStrategy             FastWrite
+	//   MetadataOpTime            10ms
+	//   ReadRepairProbability     0
+	//   ReadRepairSeeks           0
+	//   MetadataBytesPerSecond    0B (0)
+	//   MetadataStrategy          SyncMetadata
+	//   MetadataCommitInterval    0s
+	//   FlushOnClose              false
+	//   MetadataDevice            ssd
+	//   Actuators                 0
+	//   FreeBytesPerSecond        0B (0)
+	//   ZeroFillBytesPerSecond    0B (0)
+	//   DirectoryLockTime         0s
+	//   ReclaimBytesPerSecond     0B (0)
+	//   DeletedRetention          0s
+	//   ReadWriteBackCache        false
+	//   UploadBytesPerSecond      0B (0)
+	//   FsyncWaitsForUpload       false
+	//   CloseWaitsForUpload       false
+	//   NetworkLatency            0s
+	//   NetworkBytesPerSecond     0B (0)
+	//   FsyncGroupWindow          0s
+	//   SeekTimeDistribution      none
+	//   MetadataOpDistribution    none
+	//   BaseLatency               none
+	//   RandomReadBytesPerSecond  0B (0)
+	//   RandomWriteBytesPerSecond 0B (0)
+	//   QueueDepth                0
+	//   ReadCacheBytes            0B (0)
+	//   ReadCacheEviction         LRUEviction
+	//   ReadCacheHitTime          0s
+	//   JournalCommitTime         0s
+	//   FsyncFlushesAllData       false
+	//   FdatasyncStrategy         WriteBackCachedFsync
+	//   VerifyWrites              false
+	//   ReadAheadBytes            0B (0)
+	//   NoOpStrategy              DefaultNoOps
+	//   AlignmentBytes            0B (0)
+	//   MisalignmentPenalty       0s
+	//   DirectoryEntryTime        0s
+	//   DeviceCapacity            0B (0)
 
 }
 
@@ -63,6 +104,12 @@ func TestComputeTimeFromThroughput(t *testing.T) {
 		{1, 1000, 1 * time.Millisecond},
 		{1000, 1, 1000 * time.Second},
 		{3, 9, 333333333 * time.Nanosecond},
+		{-1, 1, 0},
+		{0, 0, 0},
+		{1, 0, units.MaxDuration},
+		{1, -1, units.MaxDuration},
+		{units.MaxNumBytes, 1, units.MaxDuration},
+		{units.Tebibyte * 1024, 1, units.MaxDuration},
 	}
 
 	for _, c := range cases {
@@ -84,6 +131,9 @@ func TestComputeBytesFromTime(t *testing.T) {
 		{-time.Second, 100, 0},
 		{-time.Second, 0, 0},
 		{1500 * time.Millisecond, 1000, 1500},
+		{time.Second, 0, 0},
+		{time.Second, -1, 0},
+		{units.MaxDuration, units.MaxNumBytes, units.MaxNumBytes},
 	}
 
 	for _, c := range cases {
@@ -93,6 +143,138 @@ func TestComputeBytesFromTime(t *testing.T) {
 	}
 }
 
+func TestDeviceConfig_MetadataTime(t *testing.T) {
+	cases := []struct {
+		numBytes               units.NumBytes
+		metadataBytesPerSecond units.NumBytes
+		want                   time.Duration
+	}{
+		{1000, 0, 0},
+		{0, 1000, 0},
+		{1000, 1000, time.Second},
+		{50, 1000, 50 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := &DeviceConfig{MetadataBytesPerSecond: c.metadataBytesPerSecond}
+		if got, want := dc.MetadataTime(c.numBytes), c.want; got != want {
+			t.Errorf("MetadataTime(%d) with MetadataBytesPerSecond %d = %s, want %s", c.numBytes, c.metadataBytesPerSecond, got, want)
+		}
+	}
+}
+
+func TestDeviceConfig_FreeAndZeroFillTime(t *testing.T) {
+	cases := []struct {
+		numBytes       units.NumBytes
+		bytesPerSecond units.NumBytes
+		want           time.Duration
+	}{
+		{1000, 0, 0},
+		{0, 1000, 0},
+		{1000, 1000, time.Second},
+		{50, 1000, 50 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := &DeviceConfig{FreeBytesPerSecond: c.bytesPerSecond, ZeroFillBytesPerSecond: c.bytesPerSecond}
+		if got, want := dc.FreeTime(c.numBytes), c.want; got != want {
+			t.Errorf("FreeTime(%d) with FreeBytesPerSecond %d = %s, want %s", c.numBytes, c.bytesPerSecond, got, want)
+		}
+		if got, want := dc.ZeroFillTime(c.numBytes), c.want; got != want {
+			t.Errorf("ZeroFillTime(%d) with ZeroFillBytesPerSecond %d = %s, want %s", c.numBytes, c.bytesPerSecond, got, want)
+		}
+	}
+}
+
+func TestDeviceConfig_RandomTime(t *testing.T) {
+	cases := []struct {
+		numBytes       units.NumBytes
+		bytesPerSecond units.NumBytes
+		want           time.Duration
+	}{
+		// Without a random rate, the sequential rate of 100 bytes per second applies.
+		{1000, 0, 10 * time.Second},
+		{0, 1000, 0},
+		{1000, 1000, time.Second},
+		{50, 1000, 50 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := &DeviceConfig{
+			ReadBytesPerSecond:        100,
+			WriteBytesPerSecond:       100,
+			RandomReadBytesPerSecond:  c.bytesPerSecond,
+			RandomWriteBytesPerSecond: c.bytesPerSecond,
+		}
+		if got, want := dc.RandomReadTime(c.numBytes), c.want; got != want {
+			t.Errorf("RandomReadTime(%d) with RandomReadBytesPerSecond %d = %s, want %s", c.numBytes, c.bytesPerSecond, got, want)
+		}
+		if got, want := dc.RandomWriteTime(c.numBytes), c.want; got != want {
+			t.Errorf("RandomWriteTime(%d) with RandomWriteBytesPerSecond %d = %s, want %s", c.numBytes, c.bytesPerSecond, got, want)
+		}
+	}
+}
+
+func TestDeviceConfig_VerifyWrites(t *testing.T) {
+	cases := []struct {
+		verify       bool
+		duration     time.Duration
+		wantVerify   time.Duration
+		wantWritable units.NumBytes
+	}{
+		{false, time.Second, 0, 100},
+		// Writing and reading back each byte takes 10ms and 40ms.
+		{true, time.Second, 400 * time.Millisecond, 20},
+		{true, 0, 400 * time.Millisecond, 0},
+	}
+
+	for _, c := range cases {
+		dc := &DeviceConfig{
+			ReadBytesPerSecond:  25,
+			WriteBytesPerSecond: 100,
+			VerifyWrites:        c.verify,
+		}
+		if got, want := dc.VerifyTime(10), c.wantVerify; got != want {
+			t.Errorf("VerifyTime(10) with VerifyWrites %t = %s, want %s", c.verify, got, want)
+		}
+		if got, want := dc.WritableBytes(c.duration), c.wantWritable; got != want {
+			t.Errorf("WritableBytes(%s) with VerifyWrites %t = %d, want %d", c.duration, c.verify, got, want)
+		}
+	}
+}
+
+func TestDeviceConfig_MisalignmentTime(t *testing.T) {
+	cases := []struct {
+		alignment   units.NumBytes
+		start, size units.NumBytes
+		want        time.Duration
+	}{
+		{0, 1, 1, 0},
+		{512, 0, 4096, 0},
+		{512, 1024, 512, 0},
+		{512, 100, 512, time.Millisecond},
+		{512, 512, 100, time.Millisecond},
+		{4096, 512, 4096, time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := &DeviceConfig{AlignmentBytes: c.alignment, MisalignmentPenalty: time.Millisecond}
+		if got, want := dc.MisalignmentTime(c.start, c.size), c.want; got != want {
+			t.Errorf("MisalignmentTime(%d, %d) with AlignmentBytes %d = %s, want %s", c.start, c.size, c.alignment, got, want)
+		}
+	}
+}
+
+func TestDeviceConfig_DirectoryScanTime(t *testing.T) {
+	dc := &DeviceConfig{DirectoryEntryTime: 10 * time.Microsecond}
+	if got, want := dc.DirectoryScanTime(1000), 10*time.Millisecond; got != want {
+		t.Errorf("DirectoryScanTime(1000) = %s, want %s", got, want)
+	}
+	if got, want := dc.DirectoryScanTime(math.MaxInt64), units.MaxDuration; got != want {
+		t.Errorf("DirectoryScanTime(MaxInt64) = %s, want %s", got, want)
+	}
+}
+
 func TestFsyncStrategy_String(t *testing.T) {
 	cases := []struct {
 		fsyncStrategy FsyncStrategy
@@ -191,7 +373,151 @@ func TestParseWriteStrategyFromString(t *testing.T) {
 	}
 }
 
+func TestMetadataStrategy_String(t *testing.T) {
+	cases := []struct {
+		metadataStrategy MetadataStrategy
+		want             string
+	}{
+		{SyncMetadata, "SyncMetadata"},
+		{JournaledMetadata, "JournaledMetadata"},
+		{12345, "unknown metadata strategy"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.metadataStrategy.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.metadataStrategy, got, want)
+		}
+	}
+}
+
+func TestParseMetadataStrategyFromString(t *testing.T) {
+	cases := []struct {
+		strMetadataStrategy string
+		want                MetadataStrategy
+		shouldErr           bool
+	}{
+		{"SyncMetadata", SyncMetadata, false},
+		{"sync", SyncMetadata, false},
+		{"JOURNALED", JournaledMetadata, false},
+		{"journal", JournaledMetadata, false},
+		{"journaledMetadata", JournaledMetadata, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseMetadataStrategyFromString(c.strMetadataStrategy)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseMetadataStrategyFromString(%s) = %s, %v, want %s, error %t", c.strMetadataStrategy, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestEvictionPolicy_String(t *testing.T) {
+	cases := []struct {
+		evictionPolicy EvictionPolicy
+		want           string
+	}{
+		{LRUEviction, "LRUEviction"},
+		{FIFOEviction, "FIFOEviction"},
+		{12345, "unknown eviction policy"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.evictionPolicy.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.evictionPolicy, got, want)
+		}
+	}
+}
+
+func TestParseEvictionPolicyFromString(t *testing.T) {
+	cases := []struct {
+		strEvictionPolicy string
+		want              EvictionPolicy
+		shouldErr         bool
+	}{
+		{"LRUEviction", LRUEviction, false},
+		{"lru", LRUEviction, false},
+		{"FIFO", FIFOEviction, false},
+		{"fifoEviction", FIFOEviction, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseEvictionPolicyFromString(c.strEvictionPolicy)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseEvictionPolicyFromString(%s) = %s, %v, want %s, error %t", c.strEvictionPolicy, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestNoOpStrategy_String(t *testing.T) {
+	cases := []struct {
+		noOpStrategy NoOpStrategy
+		want         string
+	}{
+		{DefaultNoOps, "DefaultNoOps"},
+		{FreeNoOps, "FreeNoOps"},
+		{MetadataNoOps, "MetadataNoOps"},
+		{12345, "unknown no-op strategy"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.noOpStrategy.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.noOpStrategy, got, want)
+		}
+	}
+}
+
+func TestParseNoOpStrategyFromString(t *testing.T) {
+	cases := []struct {
+		strNoOpStrategy string
+		want            NoOpStrategy
+		shouldErr       bool
+	}{
+		{"DefaultNoOps", DefaultNoOps, false},
+		{"default", DefaultNoOps, false},
+		{"FREE", FreeNoOps, false},
+		{"none", FreeNoOps, false},
+		{"metadataNoOps", MetadataNoOps, false},
+		{"metadata", MetadataNoOps, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseNoOpStrategyFromString(c.strNoOpStrategy)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseNoOpStrategyFromString(%s) = %s, %v, want %s, error %t", c.strNoOpStrategy, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestDeviceConfig_SetField(t *testing.T) {
+	cases := []struct {
+		name      string
+		value     string
+		want      DeviceConfig
+		shouldErr bool
+	}{
+		{"ReadBytesPerSecond", "10KiB", DeviceConfig{ReadBytesPerSecond: 10 * units.Kibibyte}, false},
+		{"SeekTime", "4ms", DeviceConfig{SeekTime: 4 * time.Millisecond}, false},
+		{"FsyncStrategy", "wbc", DeviceConfig{FsyncStrategy: WriteBackCachedFsync}, false},
+		{"FlushOnClose", "true", DeviceConfig{FlushOnClose: true}, false},
+		{"DeviceCapacity", "10GiB", DeviceConfig{DeviceCapacity: 10 * units.Gibibyte}, false},
+		{"SeekTime", "soon", DeviceConfig{}, true},
+		{"Colour", "blue", DeviceConfig{}, true},
+	}
+
+	for _, c := range cases {
+		var got DeviceConfig
+		err := got.SetField(c.name, c.value)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("SetField(%s, %s) = %v, giving %+v, want error %t, giving %+v", c.name, c.value, err, got, c.shouldErr, c.want)
+		}
+	}
+}
+
 func TestParseDeviceConfigsFromJSON(t *testing.T) {
+	dumbFsync := DumbFsync
 	cases := []struct {
 		jsonDeviceConfig string
 		want             []*DeviceConfig
@@ -314,6 +640,111 @@ func TestParseDeviceConfigsFromJSON(t *testing.T) {
 			},
 			false,
 		},
+		{
+			`[{
+			  "Name": "marginal",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s",
+			  "ReadRepairProbability": "0.25",
+			  "ReadRepairSeeks": "3",
+			  "MetadataBytesPerSecond": "1MB",
+			  "MetadataStrategy": "journaled",
+			  "MetadataCommitInterval": "5s",
+			  "FlushOnClose": "true",
+			  "MetadataDevice": "ssd",
+			  "Actuators": "2",
+			  "FreeBytesPerSecond": "1GB",
+			  "ZeroFillBytesPerSecond": "200MB",
+			  "DirectoryLockTime": "2ms",
+			  "ReclaimBytesPerSecond": "500MB",
+			  "DeletedRetention": "24h",
+			  "ReadWriteBackCache": "true",
+			  "UploadBytesPerSecond": "10MB",
+			  "FsyncWaitsForUpload": "true",
+			  "CloseWaitsForUpload": "true",
+			  "NetworkLatency": "200us",
+			  "NetworkBytesPerSecond": "1GB",
+			  "FsyncGroupWindow": "2ms",
+			  "SeekTimeDistribution": "lognormal(10ms, 5ms)",
+			  "MetadataOpDistribution": "uniform(1ms,3ms)",
+			  "BaseLatency": "pareto(50us,1.5)",
+			  "RandomReadBytesPerSecond": "2MB",
+			  "RandomWriteBytesPerSecond": "1MB",
+			  "QueueDepth": "32",
+			  "ReadCacheBytes": "1GiB",
+			  "ReadCacheEviction": "fifo",
+			  "ReadCacheHitTime": "5us",
+			  "JournalCommitTime": "3ms",
+			  "FsyncFlushesAllData": "true",
+			  "FdatasyncStrategy": "dumb",
+			  "VerifyWrites": "true",
+			  "ReadAheadBytes": "128KiB",
+			  "NoOpStrategy": "free",
+			  "AlignmentBytes": "4KiB",
+			  "MisalignmentPenalty": "2ms",
+			  "DirectoryEntryTime": "10us",
+			  "DeviceCapacity": "10GiB"
+			}]`,
+			[]*DeviceConfig{{
+				Name:                      "marginal",
+				SeekWindow:                4 * units.Kibibyte,
+				SeekTime:                  10 * time.Millisecond,
+				ReadBytesPerSecond:        100 * units.Mebibyte,
+				WriteBytesPerSecond:       123 * units.Kibibyte,
+				AllocateBytesPerSecond:    100 * units.Byte,
+				RequestReorderMaxDelay:    100 * time.Microsecond,
+				FsyncStrategy:             WriteBackCachedFsync,
+				WriteStrategy:             FastWrite,
+				MetadataOpTime:            123 * time.Second,
+				ReadRepairProbability:     0.25,
+				ReadRepairSeeks:           3,
+				MetadataBytesPerSecond:    1 * units.Megabyte,
+				MetadataStrategy:          JournaledMetadata,
+				MetadataCommitInterval:    5 * time.Second,
+				FlushOnClose:              true,
+				MetadataDevice:            "ssd",
+				Actuators:                 2,
+				FreeBytesPerSecond:        1 * units.Gigabyte,
+				ZeroFillBytesPerSecond:    200 * units.Megabyte,
+				DirectoryLockTime:         2 * time.Millisecond,
+				ReclaimBytesPerSecond:     500 * units.Megabyte,
+				DeletedRetention:          24 * time.Hour,
+				ReadWriteBackCache:        true,
+				UploadBytesPerSecond:      10 * units.Megabyte,
+				FsyncWaitsForUpload:       true,
+				CloseWaitsForUpload:       true,
+				NetworkLatency:            200 * time.Microsecond,
+				NetworkBytesPerSecond:     1 * units.Gigabyte,
+				FsyncGroupWindow:          2 * time.Millisecond,
+				SeekTimeDistribution:      &Distribution{Kind: LogNormalDistribution, A: 10 * time.Millisecond, B: 5 * time.Millisecond},
+				MetadataOpDistribution:    &Distribution{Kind: UniformDistribution, A: time.Millisecond, B: 3 * time.Millisecond},
+				BaseLatency:               &Distribution{Kind: ParetoDistribution, A: 50 * time.Microsecond, Alpha: 1.5},
+				RandomReadBytesPerSecond:  2 * units.Megabyte,
+				RandomWriteBytesPerSecond: 1 * units.Megabyte,
+				QueueDepth:                32,
+				ReadCacheBytes:            1 * units.Gibibyte,
+				ReadCacheEviction:         FIFOEviction,
+				ReadCacheHitTime:          5 * time.Microsecond,
+				JournalCommitTime:         3 * time.Millisecond,
+				FsyncFlushesAllData:       true,
+				FdatasyncStrategy:         &dumbFsync,
+				VerifyWrites:              true,
+				ReadAheadBytes:            128 * units.Kibibyte,
+				NoOpStrategy:              FreeNoOps,
+				AlignmentBytes:            4 * units.Kibibyte,
+				MisalignmentPenalty:       2 * time.Millisecond,
+				DirectoryEntryTime:        10 * time.Microsecond,
+				DeviceCapacity:            10 * units.Gibibyte,
+			}},
+			false,
+		},
 	}
 
 	for _, c := range cases {
@@ -332,6 +763,7 @@ func TestParseDeviceConfigsFromJSON(t *testing.T) {
 }
 
 func TestDeviceConfig_Validate(t *testing.T) {
+	writeBackCachedFsync := WriteBackCachedFsync
 	cases := []struct {
 		deviceConfig *DeviceConfig
 		shouldErr    bool
@@ -404,6 +836,288 @@ func TestDeviceConfig_Validate(t *testing.T) {
 			},
 			true,
 		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				ReadRepairProbability:  1.5,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				ReadRepairSeeks:        -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				MetadataBytesPerSecond: -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				MetadataCommitInterval: -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				MetadataStrategy:       JournaledMetadata,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				MetadataStrategy:       JournaledMetadata,
+				MetadataCommitInterval: 5 * time.Second,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				Name:                   "hybrid",
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				MetadataDevice:         "hybrid",
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Actuators:              -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				FreeBytesPerSecond:     -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				ZeroFillBytesPerSecond: -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				DirectoryLockTime:      -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				ReclaimBytesPerSecond:  -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				DeletedRetention:       -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				UploadBytesPerSecond:   -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				NetworkLatency:         -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				NetworkBytesPerSecond:  -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				FsyncGroupWindow:       -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				SeekTimeDistribution:   &Distribution{Kind: UniformDistribution, A: 2, B: 1},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				BaseLatency:            &Distribution{Kind: ConstantDistribution, A: -1},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:       1 * units.Byte,
+				WriteBytesPerSecond:      1 * units.Byte,
+				AllocateBytesPerSecond:   1 * units.Byte,
+				RandomReadBytesPerSecond: -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:        1 * units.Byte,
+				WriteBytesPerSecond:       1 * units.Byte,
+				AllocateBytesPerSecond:    1 * units.Byte,
+				RandomWriteBytesPerSecond: -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				QueueDepth:             -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				ReadCacheBytes:         -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				ReadAheadBytes:         -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				AlignmentBytes:         -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				MisalignmentPenalty:    -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				DirectoryEntryTime:     -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				DeviceCapacity:         -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				ReadCacheHitTime:       -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				JournalCommitTime:      -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				FsyncStrategy:          DumbFsync,
+				FdatasyncStrategy:      &writeBackCachedFsync,
+			},
+			true,
+		},
 	}
 
 	for _, c := range cases {
@@ -419,8 +1133,20 @@ func TestDeviceConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestFlashPresetsRandomThroughput(t *testing.T) {
+	// Flash serves scattered accesses slower than streams, but not nearly as much slower as disks.
+	for _, c := range []DeviceConfig{SSDDeviceConfig, NVMeDeviceConfig} {
+		if c.RandomReadBytesPerSecond <= 0 || c.RandomReadBytesPerSecond >= c.ReadBytesPerSecond {
+			t.Errorf("%s: RandomReadBytesPerSecond = %d, want between 0 and ReadBytesPerSecond %d", c.Name, c.RandomReadBytesPerSecond, c.ReadBytesPerSecond)
+		}
+		if c.RandomWriteBytesPerSecond <= 0 || c.RandomWriteBytesPerSecond >= c.WriteBytesPerSecond {
+			t.Errorf("%s: RandomWriteBytesPerSecond = %d, want between 0 and WriteBytesPerSecond %d", c.Name, c.RandomWriteBytesPerSecond, c.WriteBytesPerSecond)
+		}
+	}
+}
+
 func TestDeviceConfigLiteralsValid(t *testing.T) {
-	cases := []DeviceConfig{HDD7200RpmDeviceConfig}
+	cases := []DeviceConfig{HDD7200RpmDeviceConfig, SSDDeviceConfig, NVMeDeviceConfig, PMEMDeviceConfig, NFSDeviceConfig}
 
 	for _, c := range cases {
 		if c.Validate() != nil {
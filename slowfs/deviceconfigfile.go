@@ -0,0 +1,168 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// LoadDeviceConfigsFromFile reads the device configs listed in a config file. Files ending in
+// .yaml or .yml are parsed as YAML, and anything else as JSON. Every config is validated, so that
+// a broken profile is reported when the file is loaded rather than when it's first used.
+func LoadDeviceConfigsFromFile(path string) ([]*DeviceConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var dcs []*DeviceConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dcs, err = ParseDeviceConfigsFromYAML(data)
+	default:
+		dcs, err = ParseDeviceConfigsFromJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	names := make(map[string]struct{}, len(dcs))
+	for _, dc := range dcs {
+		if _, ok := names[dc.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate device config with name '%s'", path, dc.Name)
+		}
+		names[dc.Name] = struct{}{}
+		if err := dc.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: device config '%s': %s", path, dc.Name, err)
+		}
+	}
+
+	return dcs, nil
+}
+
+// ParseDeviceConfigsFromYAML parses yaml containing a list of device configs, like
+//
+//   - Name: fast
+//     SeekWindow: 16KiB
+//     SeekTime: 8ms
+//
+// Only the subset of YAML needed for this is supported: a list of mappings from field names to
+// scalars, which may be quoted, with comments. Fields are named and written as in JSON config
+// files.
+func ParseDeviceConfigsFromYAML(data []byte) ([]*DeviceConfig, error) {
+	type yamlObj struct {
+		line   int
+		fields map[string]interface{}
+	}
+	var objs []*yamlObj
+	var cur *yamlObj
+	indent := -1
+
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNum := i + 1
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || (trimmed == "---" && len(objs) == 0) {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs can't be used for indentation", lineNum)
+		}
+		lineIndent := len(line) - len(trimmed)
+
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if lineIndent != 0 {
+				return nil, fmt.Errorf("line %d: list items must not be indented", lineNum)
+			}
+			cur = &yamlObj{line: lineNum, fields: make(map[string]interface{})}
+			objs = append(objs, cur)
+			trimmed = strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+			if trimmed == "" {
+				indent = -1
+				continue
+			}
+			lineIndent = len(line) - len(trimmed)
+			indent = lineIndent
+		} else if cur == nil {
+			return nil, fmt.Errorf("line %d: expected list containing device configs", lineNum)
+		} else if indent == -1 && lineIndent > 0 {
+			indent = lineIndent
+		} else if lineIndent != indent {
+			return nil, fmt.Errorf("line %d: inconsistent indentation", lineNum)
+		}
+
+		sep := strings.Index(trimmed, ":")
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected 'Field: value', got '%s'", lineNum, trimmed)
+		}
+		key := strings.TrimSpace(trimmed[:sep])
+		value, err := parseYAMLScalar(strings.TrimSpace(trimmed[sep+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %s", lineNum, key, err)
+		}
+		if _, ok := cur.fields[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate field %s", lineNum, key)
+		}
+		cur.fields[key] = value
+	}
+
+	dcs := make([]*DeviceConfig, 0, len(objs))
+	for _, obj := range objs {
+		dc, err := parseDeviceConfig(obj.fields)
+		if err != nil {
+			return nil, fmt.Errorf("error validating device config at line %d: %s", obj.line, err)
+		}
+		dcs = append(dcs, dc)
+	}
+
+	return dcs, nil
+}
+
+// stripYAMLComment removes a trailing comment from a line, leaving #s inside quotes alone.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseYAMLScalar unquotes a scalar value. Unquoted values are taken as they are, so numbers and
+// booleans stay strings, as config file fields expect.
+func parseYAMLScalar(s string) (string, error) {
+	if s == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	quote := s[0]
+	if quote != '"' && quote != '\'' {
+		return s, nil
+	}
+	if len(s) < 2 || s[len(s)-1] != quote {
+		return "", fmt.Errorf("unterminated quoted value %s", s)
+	}
+	return s[1 : len(s)-1], nil
+}
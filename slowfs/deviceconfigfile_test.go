@@ -0,0 +1,179 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slowfs/slowfs/units"
+	"strings"
+	"testing"
+	"time"
+)
+
+const yamlDeviceConfigs = `---
+# Profiles for the integration tests.
+- Name: fast
+  SeekWindow: 16KiB
+  SeekTime: 8ms
+  ReadBytesPerSecond: 100MiB
+  WriteBytesPerSecond: "100MiB"
+  AllocateBytesPerSecond: '4GiB'
+  RequestReorderMaxDelay: 100us  # as measured
+  FsyncStrategy: wbc
+  WriteStrategy: fastwrite
+  MetadataOpTime: 500us
+  FlushOnClose: true
+-
+  Name: "slow #2"
+  SeekWindow: 4KiB
+  SeekTime: 10ms
+  ReadBytesPerSecond: 1MiB
+  WriteBytesPerSecond: 1MiB
+  AllocateBytesPerSecond: 1MiB
+  RequestReorderMaxDelay: 0s
+  FsyncStrategy: dumb
+  WriteStrategy: simulate
+  MetadataOpTime: 1ms
+`
+
+func TestParseDeviceConfigsFromYAML(t *testing.T) {
+	cases := []struct {
+		yamlDeviceConfig string
+		want             []*DeviceConfig
+		shouldErr        bool
+	}{
+		{"", []*DeviceConfig{}, false},
+		{"Name: fast", nil, true},
+		{"- Name fast", nil, true},
+		{"- Name: fast\n  Name: slow", nil, true},
+		{"- Name: fast\n    SeekTime: 8ms", nil, true},
+		{"- Name: \"fast", nil, true},
+		{"- Name: fast\n\tSeekTime: 8ms", nil, true},
+		{"- Name:", nil, true},
+		{"- Name: fast", nil, true},
+		{
+			yamlDeviceConfigs,
+			[]*DeviceConfig{
+				&DeviceConfig{
+					Name:                   "fast",
+					SeekWindow:             16 * units.Kibibyte,
+					SeekTime:               8 * time.Millisecond,
+					ReadBytesPerSecond:     100 * units.Mebibyte,
+					WriteBytesPerSecond:    100 * units.Mebibyte,
+					AllocateBytesPerSecond: 4 * units.Gibibyte,
+					RequestReorderMaxDelay: 100 * time.Microsecond,
+					FsyncStrategy:          WriteBackCachedFsync,
+					WriteStrategy:          FastWrite,
+					MetadataOpTime:         500 * time.Microsecond,
+					FlushOnClose:           true,
+				},
+				&DeviceConfig{
+					Name:                   "slow #2",
+					SeekWindow:             4 * units.Kibibyte,
+					SeekTime:               10 * time.Millisecond,
+					ReadBytesPerSecond:     1 * units.Mebibyte,
+					WriteBytesPerSecond:    1 * units.Mebibyte,
+					AllocateBytesPerSecond: 1 * units.Mebibyte,
+					FsyncStrategy:          DumbFsync,
+					WriteStrategy:          SimulateWrite,
+					MetadataOpTime:         1 * time.Millisecond,
+				},
+			},
+			false,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := ParseDeviceConfigsFromYAML([]byte(c.yamlDeviceConfig))
+
+		if c.shouldErr && err == nil {
+			t.Errorf("ParseDeviceConfigsFromYAML(%q) = %s, should error", c.yamlDeviceConfig, got)
+		} else if !c.shouldErr {
+			if err != nil {
+				t.Errorf("ParseDeviceConfigsFromYAML(%q) error: %s, want %s", c.yamlDeviceConfig, err, c.want)
+			} else if want := c.want; !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseDeviceConfigsFromYAML(%q) = %s, want %s", c.yamlDeviceConfig, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadDeviceConfigsFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deviceconfigfile_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	jsonConfig := `[{
+	  "Name": "fast",
+	  "SeekWindow": "16KiB",
+	  "SeekTime": "8ms",
+	  "ReadBytesPerSecond": "100MiB",
+	  "WriteBytesPerSecond": "100MiB",
+	  "AllocateBytesPerSecond": "4GiB",
+	  "RequestReorderMaxDelay": "100us",
+	  "FsyncStrategy": "wbc",
+	  "WriteStrategy": "fastwrite",
+	  "MetadataOpTime": "500us"
+	}]`
+	invalidConfig := strings.Replace(yamlDeviceConfigs, "SeekTime: 10ms", "SeekTime: -10ms", 1)
+	duplicateConfig := strings.Replace(yamlDeviceConfigs, `"slow #2"`, "fast", 1)
+
+	cases := []struct {
+		name, contents string
+		wantNames      []string
+		wantErr        string
+	}{
+		{"configs.json", jsonConfig, []string{"fast"}, ""},
+		{"configs.yaml", yamlDeviceConfigs, []string{"fast", "slow #2"}, ""},
+		{"configs.YML", yamlDeviceConfigs, []string{"fast", "slow #2"}, ""},
+		{"yaml.json", yamlDeviceConfigs, nil, "yaml.json"},
+		{"invalid.yaml", invalidConfig, nil, "device config 'slow #2': SeekTime cannot be negative"},
+		{"duplicate.yaml", duplicateConfig, nil, "duplicate device config with name 'fast'"},
+		{"missing.yaml", "", nil, "missing.yaml"},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name)
+		if c.name != "missing.yaml" {
+			if err := ioutil.WriteFile(path, []byte(c.contents), 0644); err != nil {
+				t.Fatalf("WriteFile error: %s", err)
+			}
+		}
+
+		dcs, err := LoadDeviceConfigsFromFile(path)
+		if c.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("LoadDeviceConfigsFromFile(%s) error = %v, want error containing %q", c.name, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("LoadDeviceConfigsFromFile(%s) error: %s", c.name, err)
+			continue
+		}
+		var gotNames []string
+		for _, dc := range dcs {
+			gotNames = append(gotNames, dc.Name)
+		}
+		if got, want := gotNames, c.wantNames; !reflect.DeepEqual(got, want) {
+			t.Errorf("LoadDeviceConfigsFromFile(%s) names = %v, want %v", c.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dirfs applies slowfs's latency model to a directory in process, without mounting
+// anything, for tests which run where FUSE isn't available. FS implements io/fs.FS, along with
+// fs.StatFS and fs.ReadDirFS, and can also create, write and remove files:
+//
+//	fsys, err := dirfs.New(t.TempDir(), &slowfs.HDD7200RpmDeviceConfig)
+//	...
+//	f, err := fsys.Create("data")
+//	...
+//	_, err = f.Write(data)
+//	err = f.Sync()
+//
+// Each operation waits as long as the simulated device says, like it would on a slowfs mount.
+// Operations through the os package directly aren't seen.
+package dirfs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/delay"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// FS is a directory whose operations take as long as a simulated device says.
+type FS struct {
+	dir       string
+	scheduler *scheduler.Scheduler
+	// How long before they complete operations stop sleeping and spin instead, for precision.
+	spin time.Duration
+	// The simulated time operations advance, or nil if they take real time.
+	clock *scheduler.VirtualClock
+}
+
+// New creates an FS for the files in dir, simulating a device described by config.
+func New(dir string, config *slowfs.DeviceConfig) (*FS, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("error validating config: %s", err)
+	}
+	return &FS{dir: dir, scheduler: scheduler.New(config)}, nil
+}
+
+// Scheduler returns the scheduler simulating the device, e.g. to add schedule hooks.
+func (f *FS) Scheduler() *scheduler.Scheduler {
+	return f.scheduler
+}
+
+// SetSpin makes operations spin for the last spin before they complete, rather than rely on a
+// timer, for precise sub-millisecond latencies at the cost of CPU time. A spin of zero disables
+// this.
+func (f *FS) SetSpin(spin time.Duration) {
+	f.spin = spin
+}
+
+// SetVirtualClock makes operations advance clock to when they're modeled to complete, instead of
+// sleeping until then, as with slowfs --virtual-clock. This must be called before any operations.
+func (f *FS) SetVirtualClock(clock *scheduler.VirtualClock) {
+	f.clock = clock
+	f.scheduler.SetClock(clock)
+}
+
+// now returns what time it is for the simulated device.
+func (f *FS) now() time.Time {
+	if f.clock != nil {
+		return f.clock.Now()
+	}
+	return time.Now()
+}
+
+// wait schedules req and sleeps until it should complete, or advances the virtual clock to then.
+func (f *FS) wait(req *scheduler.Request) {
+	d := f.scheduler.Schedule(req)
+	if f.clock != nil {
+		f.clock.AdvanceTo(req.Timestamp.Add(d))
+		return
+	}
+	delay.Until(context.Background(), req.Timestamp.Add(d), f.spin)
+}
+
+// path returns where the file called name is in the underlying directory. Names are slash
+// separated and relative, as for fs.FS.
+func (f *FS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(f.dir, filepath.FromSlash(name)), nil
+}
+
+// fsError makes err, if it names a file in the underlying directory, name the file called name
+// instead, as fs.FS errors should.
+func fsError(err error, name string) error {
+	if e, ok := err.(*fs.PathError); ok {
+		return &fs.PathError{Op: e.Op, Path: name, Err: e.Err}
+	}
+	return err
+}
+
+// Open opens the named file for reading.
+func (f *FS) Open(name string) (fs.File, error) {
+	file, err := f.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Create creates or truncates the named file, like os.Create.
+func (f *FS) Create(name string) (*File, error) {
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile opens the named file with the given flags, like os.OpenFile. Creating a file costs a
+// directory entry, and truncating one frees its blocks.
+func (f *FS) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	start := f.now()
+	p, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info, statErr := os.Stat(p)
+	file, err := os.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, fsError(err, name)
+	}
+
+	req := &scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: start, Path: name}
+	switch {
+	case statErr != nil:
+		req.Type = scheduler.DirEntryRequest
+	case flag&os.O_TRUNC != 0 && info.Mode().IsRegular() && info.Size() > 0:
+		req.Type = scheduler.TruncateRequest
+		req.Size = units.NumBytes(info.Size())
+	}
+	f.wait(req)
+	return &File{fsys: f, name: name, file: file, direct: writesDirect(flag)}, nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	start := f.now()
+	p, err := f.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, fsError(err, name)
+	}
+	f.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: start, Path: name})
+	return info, nil
+}
+
+// ReadDir reads the named directory, returning its entries sorted by filename.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	start := f.now()
+	p, err := f.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, fsError(err, name)
+	}
+	f.wait(&scheduler.Request{Type: scheduler.ReaddirRequest, Timestamp: start, Path: name, Size: direntBytes(entries), Entries: int64(len(entries))})
+	return entries, nil
+}
+
+// Mkdir creates a directory, like os.Mkdir.
+func (f *FS) Mkdir(name string, perm os.FileMode) error {
+	start := f.now()
+	p, err := f.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(p, perm); err != nil {
+		return fsError(err, name)
+	}
+	f.wait(&scheduler.Request{Type: scheduler.DirEntryRequest, Timestamp: start, Path: name})
+	return nil
+}
+
+// Remove removes the named file or empty directory, like os.Remove. Removing the last link to a
+// file frees its blocks.
+func (f *FS) Remove(name string) error {
+	start := f.now()
+	p, err := f.path("remove", name)
+	if err != nil {
+		return err
+	}
+	info, statErr := os.Lstat(p)
+	if err := os.Remove(p); err != nil {
+		return fsError(err, name)
+	}
+	req := &scheduler.Request{Type: scheduler.DirEntryRequest, Timestamp: start, Path: name}
+	if statErr == nil && info.Mode().IsRegular() && links(info) <= 1 {
+		req.Size = units.NumBytes(info.Size())
+	}
+	f.wait(req)
+	return nil
+}
+
+// Rename renames oldname to newname, like os.Rename.
+func (f *FS) Rename(oldname, newname string) error {
+	start := f.now()
+	oldPath, err := f.path("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newPath, err := f.path("rename", newname)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	f.wait(&scheduler.Request{Type: scheduler.DirEntryRequest, Timestamp: start, Path: oldname})
+	return nil
+}
+
+// Truncate changes the size of the named file, like os.Truncate.
+func (f *FS) Truncate(name string, size int64) error {
+	start := f.now()
+	p, err := f.path("truncate", name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return fsError(err, name)
+	}
+	if err := os.Truncate(p, size); err != nil {
+		return fsError(err, name)
+	}
+	f.wait(resizeRequest(start, name, info.Size(), size))
+	return nil
+}
+
+// resizeRequest creates a request for changing the size of the file called name from oldSize to
+// newSize, like a slowfs mount sends.
+func resizeRequest(start time.Time, name string, oldSize, newSize int64) *scheduler.Request {
+	req := &scheduler.Request{
+		Type:      scheduler.TruncateRequest,
+		Timestamp: start,
+		Path:      name,
+		Start:     units.NumBytes(newSize),
+	}
+	switch {
+	case newSize < oldSize:
+		req.Size = units.NumBytes(oldSize - newSize)
+	case newSize > oldSize:
+		req.Type = scheduler.ExtendRequest
+		req.Start = units.NumBytes(oldSize)
+		req.Size = units.NumBytes(newSize - oldSize)
+	}
+	return req
+}
+
+// direntBytes computes how many bytes the kernel would receive when listing the given entries.
+// Each entry has a 24 byte header followed by its name, padded to a multiple of 8 bytes.
+func direntBytes(entries []fs.DirEntry) units.NumBytes {
+	var n units.NumBytes
+	for _, e := range entries {
+		n += units.NumBytes((24 + len(e.Name()) + 7) &^ 7)
+	}
+	return n
+}
@@ -0,0 +1,34 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package dirfs
+
+import (
+	"io/fs"
+	"os"
+)
+
+// writesDirect returns whether files opened with flag write straight to the device. Only O_SYNC is
+// portable.
+func writesDirect(flag int) bool {
+	return flag&os.O_SYNC != 0
+}
+
+// links returns how many hard links the file described by info has, which is assumed to be 1.
+func links(info fs.FileInfo) uint64 {
+	return 1
+}
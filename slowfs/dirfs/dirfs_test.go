@@ -0,0 +1,192 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dirfs
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fastDeviceConfig describes a device quick enough not to slow tests down.
+var fastDeviceConfig = slowfs.DeviceConfig{
+	ReadBytesPerSecond:     units.Gibibyte,
+	WriteBytesPerSecond:    units.Gibibyte,
+	AllocateBytesPerSecond: units.Gibibyte,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+}
+
+func newTestFS(t *testing.T, config slowfs.DeviceConfig) *FS {
+	dir, err := ioutil.TempDir("", "dirfs_test")
+	if err != nil {
+		t.Fatalf("couldn't create temporary directory: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	fsys, err := New(dir, &config)
+	if err != nil {
+		t.Fatalf("New(%s) failed: %s", dir, err)
+	}
+	return fsys
+}
+
+func TestFS(t *testing.T) {
+	fsys := newTestFS(t, fastDeviceConfig)
+	if err := fsys.Mkdir("dir", 0755); err != nil {
+		t.Fatalf("Mkdir(dir) failed: %s", err)
+	}
+	for _, name := range []string{"a", "dir/b"} {
+		f, err := fsys.Create(name)
+		if err != nil {
+			t.Fatalf("Create(%s) failed: %s", name, err)
+		}
+		if _, err := f.Write([]byte("contents of " + name)); err != nil {
+			t.Fatalf("Write to %s failed: %s", name, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close of %s failed: %s", name, err)
+		}
+	}
+
+	if err := fstest.TestFS(fsys, "a", "dir/b"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFS_Latency(t *testing.T) {
+	config := fastDeviceConfig
+	config.MetadataOpTime = 50 * time.Millisecond
+	fsys := newTestFS(t, config)
+
+	cases := []struct {
+		desc string
+		op   func() error
+	}{
+		{"create", func() error {
+			f, err := fsys.Create("a")
+			if err == nil {
+				f.file.Close()
+			}
+			return err
+		}},
+		{"stat", func() error {
+			_, err := fsys.Stat("a")
+			return err
+		}},
+		{"rename", func() error { return fsys.Rename("a", "b") }},
+		{"remove", func() error { return fsys.Remove("b") }},
+	}
+
+	for _, c := range cases {
+		start := time.Now()
+		if err := c.op(); err != nil {
+			t.Fatalf("%s failed: %s", c.desc, err)
+		}
+		if got, want := time.Since(start), config.MetadataOpTime; got < want {
+			t.Errorf("%s took %s, want at least %s", c.desc, got, want)
+		}
+	}
+}
+
+func TestFS_VirtualClock(t *testing.T) {
+	config := fastDeviceConfig
+	config.MetadataOpTime = time.Hour
+	fsys := newTestFS(t, config)
+	clock := scheduler.NewVirtualClock(time.Unix(0, 0))
+	fsys.SetVirtualClock(clock)
+
+	// Each operation advances simulated time rather than sleeping.
+	began := time.Now()
+	if err := fsys.Mkdir("a", 0755); err != nil {
+		t.Fatalf("Mkdir failed: %s", err)
+	}
+	if _, err := fsys.Stat("a"); err != nil {
+		t.Fatalf("Stat failed: %s", err)
+	}
+	if got, max := time.Since(began), time.Second; got > max {
+		t.Errorf("operations took %s, want at most %s", got, max)
+	}
+	if got, want := clock.Elapsed(), 2*time.Hour; got != want {
+		t.Errorf("Elapsed() = %s, want %s", got, want)
+	}
+}
+
+func TestFS_InvalidPath(t *testing.T) {
+	fsys := newTestFS(t, fastDeviceConfig)
+	for _, name := range []string{"/a", "../a", "a/"} {
+		if _, err := fsys.Open(name); err == nil {
+			t.Errorf("Open(%s) succeeded, want error", name)
+		}
+	}
+}
+
+func TestFS_NotExist(t *testing.T) {
+	fsys := newTestFS(t, fastDeviceConfig)
+	f, err := fsys.Open("missing")
+	if f != nil {
+		t.Errorf("Open(missing) = %v, want nil", f)
+	}
+	_, statErr := fsys.Stat("missing")
+	_, readDirErr := fsys.ReadDir("missing")
+
+	// Errors name files as the FS does, not where they are in the underlying directory.
+	cases := []struct {
+		op   string
+		err  error
+		path string
+	}{
+		{"Open", err, "missing"},
+		{"Stat", statErr, "missing"},
+		{"ReadDir", readDirErr, "missing"},
+		{"Mkdir", fsys.Mkdir("missing/dir", 0755), "missing/dir"},
+		{"Remove", fsys.Remove("missing"), "missing"},
+	}
+	for _, c := range cases {
+		var pathErr *fs.PathError
+		if !errors.As(c.err, &pathErr) || !errors.Is(c.err, fs.ErrNotExist) {
+			t.Errorf("%s(%s) = %v, want a *fs.PathError for fs.ErrNotExist", c.op, c.path, c.err)
+			continue
+		}
+		if got, want := pathErr.Path, c.path; got != want {
+			t.Errorf("%s(%s) error path = %s, want %s", c.op, c.path, got, want)
+		}
+	}
+}
+
+func TestResizeRequest(t *testing.T) {
+	start := time.Now()
+	cases := []struct {
+		oldSize, newSize int64
+		want             scheduler.Request
+	}{
+		{100, 100, scheduler.Request{Type: scheduler.TruncateRequest, Timestamp: start, Path: "a", Start: 100}},
+		{100, 40, scheduler.Request{Type: scheduler.TruncateRequest, Timestamp: start, Path: "a", Start: 40, Size: 60}},
+		{100, 250, scheduler.Request{Type: scheduler.ExtendRequest, Timestamp: start, Path: "a", Start: 100, Size: 150}},
+	}
+
+	for _, c := range cases {
+		if got, want := *resizeRequest(start, "a", c.oldSize, c.newSize), c.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("resizeRequest(%d, %d) = %+v, want %+v", c.oldSize, c.newSize, got, want)
+		}
+	}
+}
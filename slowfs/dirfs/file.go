@@ -0,0 +1,170 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dirfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// File is an open file in an FS. It implements fs.File and fs.ReadDirFile, and can be written to
+// like an os.File.
+type File struct {
+	fsys *FS
+	name string
+	file *os.File
+	// Whether writes go straight to the device, because the file was opened with O_DIRECT or
+	// O_DSYNC.
+	direct bool
+}
+
+// Name returns the name of the file as given to OpenFile.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Stat returns a FileInfo describing the file.
+func (f *File) Stat() (fs.FileInfo, error) {
+	start := f.fsys.now()
+	info, err := f.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	f.fsys.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: start, Path: f.name})
+	return info, nil
+}
+
+// Read reads from the file's current offset.
+func (f *File) Read(b []byte) (int, error) {
+	off, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	start := f.fsys.now()
+	n, err := f.file.Read(b)
+	return n, f.waitRead(start, off, n, err)
+}
+
+// ReadAt reads from the file at off.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	start := f.fsys.now()
+	n, err := f.file.ReadAt(b, off)
+	return n, f.waitRead(start, off, n, err)
+}
+
+// waitRead waits for a read of n bytes at off which returned err, unless it failed.
+func (f *File) waitRead(start time.Time, off int64, n int, err error) error {
+	if err != nil && err != io.EOF {
+		return err
+	}
+	f.fsys.wait(&scheduler.Request{
+		Type:      scheduler.ReadRequest,
+		Timestamp: start,
+		Path:      f.name,
+		Start:     units.NumBytes(off),
+		Size:      units.NumBytes(n),
+	})
+	return err
+}
+
+// Write writes to the file's current offset.
+func (f *File) Write(b []byte) (int, error) {
+	off, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	start := f.fsys.now()
+	n, err := f.file.Write(b)
+	return n, f.waitWrite(start, off, n, err)
+}
+
+// WriteAt writes to the file at off.
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	start := f.fsys.now()
+	n, err := f.file.WriteAt(b, off)
+	return n, f.waitWrite(start, off, n, err)
+}
+
+// waitWrite waits for a write of n bytes at off which returned err, unless nothing was written.
+func (f *File) waitWrite(start time.Time, off int64, n int, err error) error {
+	if err != nil && n == 0 {
+		return err
+	}
+	f.fsys.wait(&scheduler.Request{
+		Type:      scheduler.WriteRequest,
+		Timestamp: start,
+		Path:      f.name,
+		Start:     units.NumBytes(off),
+		Size:      units.NumBytes(n),
+		Direct:    f.direct,
+	})
+	return err
+}
+
+// Seek sets the offset for the next Read or Write, which takes no time.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+// Sync commits the file's contents to stable storage, like fsync.
+func (f *File) Sync() error {
+	start := f.fsys.now()
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	f.fsys.wait(&scheduler.Request{Type: scheduler.FsyncRequest, Timestamp: start, Path: f.name})
+	return nil
+}
+
+// Truncate changes the size of the file.
+func (f *File) Truncate(size int64) error {
+	start := f.fsys.now()
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := f.file.Truncate(size); err != nil {
+		return err
+	}
+	f.fsys.wait(resizeRequest(start, f.name, info.Size(), size))
+	return nil
+}
+
+// ReadDir reads the contents of the directory, as for fs.ReadDirFile. The entries read are charged
+// each call.
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	start := f.fsys.now()
+	entries, err := f.file.ReadDir(n)
+	if err != nil && err != io.EOF {
+		return entries, err
+	}
+	f.fsys.wait(&scheduler.Request{Type: scheduler.ReaddirRequest, Timestamp: start, Path: f.name, Size: direntBytes(entries), Entries: int64(len(entries))})
+	return entries, err
+}
+
+// Close flushes and closes the file, like closing its last file descriptor on a slowfs mount.
+func (f *File) Close() error {
+	start := f.fsys.now()
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.fsys.wait(&scheduler.Request{Type: scheduler.FlushRequest, Timestamp: start, Path: f.name})
+	f.fsys.wait(&scheduler.Request{Type: scheduler.CloseRequest, Timestamp: f.fsys.now(), Path: f.name})
+	return nil
+}
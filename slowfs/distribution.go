@@ -0,0 +1,229 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slowfs/slowfs/units"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DistributionKind indicates which family a Distribution belongs to.
+type DistributionKind int
+
+const (
+	// ConstantDistribution always takes the same value, A.
+	ConstantDistribution DistributionKind = iota
+	// UniformDistribution takes values between A and B with equal probability.
+	UniformDistribution
+	// NormalDistribution takes values with mean A and standard deviation B, clamped at zero.
+	NormalDistribution
+	// LogNormalDistribution takes values with mean A and standard deviation B, skewed towards long
+	// values, like the latencies of most real devices.
+	LogNormalDistribution
+	// ParetoDistribution takes values of at least A, with a heavy tail whose shape is Alpha. The
+	// smaller Alpha, the more often values are far larger than A.
+	ParetoDistribution
+)
+
+func (k DistributionKind) String() string {
+	switch k {
+	case ConstantDistribution:
+		return "constant"
+	case UniformDistribution:
+		return "uniform"
+	case NormalDistribution:
+		return "normal"
+	case LogNormalDistribution:
+		return "lognormal"
+	case ParetoDistribution:
+		return "pareto"
+	default:
+		return "unknown distribution"
+	}
+}
+
+// Distribution describes how a duration varies from one request to the next.
+type Distribution struct {
+	Kind DistributionKind
+	// A and B are the distribution's parameters, as described by its Kind.
+	A, B time.Duration
+	// Alpha is the shape of a ParetoDistribution.
+	Alpha float64
+}
+
+func (d *Distribution) String() string {
+	if d == nil {
+		return "none"
+	}
+	switch d.Kind {
+	case ConstantDistribution:
+		return fmt.Sprintf("%s(%s)", d.Kind, d.A)
+	case ParetoDistribution:
+		return fmt.Sprintf("%s(%s,%g)", d.Kind, d.A, d.Alpha)
+	default:
+		return fmt.Sprintf("%s(%s,%s)", d.Kind, d.A, d.B)
+	}
+}
+
+// ParseDistributionFromString parses a Distribution written as its kind followed by its
+// parameters in brackets, like "constant(10ms)", "uniform(5ms,15ms)", "normal(10ms,2ms)",
+// "lognormal(10ms,5ms)" or "pareto(5ms,1.5)". "p99(5ms,40ms)" is the distribution FitDistribution
+// returns for a mean and 99th percentile. Kinds are case insensitive.
+func ParseDistributionFromString(s string) (*Distribution, error) {
+	open := strings.Index(s, "(")
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("distribution %s should look like kind(parameters)", s)
+	}
+	kind := strings.ToLower(strings.TrimSpace(s[:open]))
+	params := strings.Split(s[open+1:len(s)-1], ",")
+	for i := range params {
+		params[i] = strings.TrimSpace(params[i])
+	}
+
+	var d Distribution
+	var err error
+	switch kind {
+	case "constant":
+		d.Kind = ConstantDistribution
+		err = parseDistributionParams(params, &d.A)
+	case "uniform":
+		d.Kind = UniformDistribution
+		err = parseDistributionParams(params, &d.A, &d.B)
+	case "normal":
+		d.Kind = NormalDistribution
+		err = parseDistributionParams(params, &d.A, &d.B)
+	case "lognormal":
+		d.Kind = LogNormalDistribution
+		err = parseDistributionParams(params, &d.A, &d.B)
+	case "p99":
+		var mean, p99 time.Duration
+		if err = parseDistributionParams(params, &mean, &p99); err == nil {
+			var fitted *Distribution
+			if fitted, err = FitDistribution(mean, p99); err == nil {
+				d = *fitted
+			}
+		}
+	case "pareto":
+		d.Kind = ParetoDistribution
+		if len(params) != 2 {
+			return nil, fmt.Errorf("%s: want 2 parameters, got %d", s, len(params))
+		}
+		if err = parseDistributionParams(params[:1], &d.A); err == nil {
+			d.Alpha, err = strconv.ParseFloat(params[1], 64)
+		}
+	default:
+		return nil, fmt.Errorf("unknown distribution %s", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", s, err)
+	}
+	return &d, nil
+}
+
+func parseDistributionParams(params []string, durations ...*time.Duration) error {
+	if len(params) != len(durations) {
+		return fmt.Errorf("want %d parameters, got %d", len(durations), len(params))
+	}
+	for i, p := range params {
+		var err error
+		if *durations[i], err = time.ParseDuration(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// p99NormalQuantile is how many standard deviations the 99th percentile of a normal distribution is
+// above its mean.
+const p99NormalQuantile = 2.3263478740408408
+
+// FitDistribution returns a distribution with the given mean and 99th percentile, so that latencies
+// can be described by the goals they should meet, like "5ms on average and 40ms at p99", rather
+// than by a distribution's parameters. This is a LogNormalDistribution, which like most real
+// devices' latencies is skewed towards long times, and whose 99th percentile can be at most about
+// 15 times its mean.
+func FitDistribution(mean, p99 time.Duration) (*Distribution, error) {
+	if mean <= 0 {
+		return nil, errors.New("mean must be positive")
+	}
+	if p99 < mean {
+		return nil, errors.New("99th percentile cannot be less than the mean")
+	}
+	if p99 == mean {
+		return &Distribution{Kind: ConstantDistribution, A: mean}, nil
+	}
+	// With the underlying normal distribution's mean mu and standard deviation sigma, the mean is
+	// exp(mu + sigma^2/2) and the 99th percentile exp(mu + z*sigma), so sigma solves
+	// sigma^2/2 - z*sigma + log(p99/mean) = 0. The smaller root has the lighter tail.
+	z := p99NormalQuantile
+	disc := z*z - 2*math.Log(float64(p99)/float64(mean))
+	if disc < 0 {
+		return nil, fmt.Errorf("99th percentile can be at most %.1f times the mean", math.Exp(z*z/2))
+	}
+	sigma := z - math.Sqrt(disc)
+	stddev := float64(mean) * math.Sqrt(math.Expm1(sigma*sigma))
+	return &Distribution{Kind: LogNormalDistribution, A: mean, B: units.DurationFromFloat(stddev)}, nil
+}
+
+// Validate returns an error if the distribution's parameters don't make sense.
+func (d *Distribution) Validate() error {
+	if d.A < 0 || d.B < 0 {
+		return errors.New("parameters cannot be negative")
+	}
+	switch d.Kind {
+	case UniformDistribution:
+		if d.A > d.B {
+			return errors.New("minimum cannot be larger than maximum")
+		}
+	case ParetoDistribution:
+		if d.A == 0 {
+			return errors.New("minimum must be positive")
+		}
+		if d.Alpha <= 0 {
+			return errors.New("shape must be positive")
+		}
+	}
+	return nil
+}
+
+// Sample draws a random duration from the distribution, using r.
+func (d *Distribution) Sample(r *rand.Rand) time.Duration {
+	switch d.Kind {
+	case UniformDistribution:
+		return units.DurationAdd(d.A, units.DurationFromFloat(r.Float64()*float64(d.B-d.A)))
+	case NormalDistribution:
+		return units.DurationFromFloat(math.Max(0, float64(d.A)+r.NormFloat64()*float64(d.B)))
+	case LogNormalDistribution:
+		if d.A == 0 {
+			return 0
+		}
+		// Choose the underlying normal distribution so that the result has the given mean and
+		// standard deviation.
+		mean, stddev := float64(d.A), float64(d.B)
+		sigma := math.Sqrt(math.Log1p(stddev * stddev / (mean * mean)))
+		mu := math.Log(mean) - sigma*sigma/2
+		return units.DurationFromFloat(math.Exp(mu + sigma*r.NormFloat64()))
+	case ParetoDistribution:
+		return units.DurationFromFloat(float64(d.A) / math.Pow(1-r.Float64(), 1/d.Alpha))
+	default:
+		return d.A
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseDistributionFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      *Distribution
+		shouldErr bool
+	}{
+		{"constant(10ms)", &Distribution{Kind: ConstantDistribution, A: 10 * time.Millisecond}, false},
+		{"Uniform(5ms, 15ms)", &Distribution{Kind: UniformDistribution, A: 5 * time.Millisecond, B: 15 * time.Millisecond}, false},
+		{"normal(10ms,2ms)", &Distribution{Kind: NormalDistribution, A: 10 * time.Millisecond, B: 2 * time.Millisecond}, false},
+		{"lognormal(10ms,5ms)", &Distribution{Kind: LogNormalDistribution, A: 10 * time.Millisecond, B: 5 * time.Millisecond}, false},
+		{"pareto(5ms,1.5)", &Distribution{Kind: ParetoDistribution, A: 5 * time.Millisecond, Alpha: 1.5}, false},
+		{"p99(10ms,10ms)", &Distribution{Kind: ConstantDistribution, A: 10 * time.Millisecond}, false},
+		{"P99(10ms, 26.81ms)", &Distribution{Kind: LogNormalDistribution, A: 10 * time.Millisecond, B: 4992612}, false},
+		{"10ms", nil, true},
+		{"constant(10ms", nil, true},
+		{"constant(10ms,2ms)", nil, true},
+		{"uniform(5ms)", nil, true},
+		{"normal(10ms,2)", nil, true},
+		{"pareto(5ms,fast)", nil, true},
+		{"poisson(10ms)", nil, true},
+		{"p99(10ms,5ms)", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseDistributionFromString(c.s)
+		if c.shouldErr && err == nil {
+			t.Errorf("ParseDistributionFromString(%q) = %s, should error", c.s, got)
+		} else if !c.shouldErr {
+			if err != nil {
+				t.Errorf("ParseDistributionFromString(%q) error: %s, want %s", c.s, err, c.want)
+			} else if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("ParseDistributionFromString(%q) = %s, want %s", c.s, got, c.want)
+			} else if again, err := ParseDistributionFromString(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("ParseDistributionFromString(%q) = %s, %v, want %s", got.String(), again, err, got)
+			}
+		}
+	}
+}
+
+func TestDistribution_Validate(t *testing.T) {
+	cases := []struct {
+		d         Distribution
+		shouldErr bool
+	}{
+		{Distribution{Kind: ConstantDistribution}, false},
+		{Distribution{Kind: ConstantDistribution, A: -1}, true},
+		{Distribution{Kind: UniformDistribution, A: 1, B: 1}, false},
+		{Distribution{Kind: UniformDistribution, A: 2, B: 1}, true},
+		{Distribution{Kind: NormalDistribution, A: 1, B: -1}, true},
+		{Distribution{Kind: ParetoDistribution, A: 1, Alpha: 1}, false},
+		{Distribution{Kind: ParetoDistribution, A: 0, Alpha: 1}, true},
+		{Distribution{Kind: ParetoDistribution, A: 1, Alpha: 0}, true},
+	}
+
+	for _, c := range cases {
+		if err := c.d.Validate(); (err != nil) != c.shouldErr {
+			t.Errorf("%s.Validate() = %v, should error: %t", &c.d, err, c.shouldErr)
+		}
+	}
+}
+
+func TestDistribution_Sample(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const n = 100000
+	// The wanted mean and 99th percentile of each distribution, which samples should be within 5%
+	// of.
+	cases := []struct {
+		d              Distribution
+		wantMean, want time.Duration
+	}{
+		{Distribution{Kind: ConstantDistribution, A: 10 * time.Millisecond}, 10 * time.Millisecond, 10 * time.Millisecond},
+		{Distribution{Kind: UniformDistribution, A: 10 * time.Millisecond, B: 20 * time.Millisecond}, 15 * time.Millisecond, 19900 * time.Microsecond},
+		{Distribution{Kind: NormalDistribution, A: 10 * time.Millisecond, B: time.Millisecond}, 10 * time.Millisecond, 12326 * time.Microsecond},
+		{Distribution{Kind: LogNormalDistribution, A: 10 * time.Millisecond, B: 5 * time.Millisecond}, 10 * time.Millisecond, 26810 * time.Microsecond},
+		{Distribution{Kind: ParetoDistribution, A: time.Millisecond, Alpha: 3}, 1500 * time.Microsecond, 4642 * time.Microsecond},
+	}
+
+	for _, c := range cases {
+		samples := make([]float64, n)
+		var sum float64
+		for i := range samples {
+			samples[i] = float64(c.d.Sample(r))
+			sum += samples[i]
+		}
+		sort.Float64s(samples)
+		if got, want := sum/n, float64(c.wantMean); math.Abs(got-want) > want*0.05 {
+			t.Errorf("%s: mean of samples = %s, want %s", &c.d, time.Duration(got), c.wantMean)
+		}
+		if got, want := samples[n*99/100], float64(c.want); math.Abs(got-want) > want*0.05 {
+			t.Errorf("%s: 99th percentile of samples = %s, want %s", &c.d, time.Duration(got), c.want)
+		}
+	}
+}
+
+func TestFitDistribution(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const n = 100000
+	cases := []struct {
+		mean, p99 time.Duration
+		shouldErr bool
+	}{
+		{5 * time.Millisecond, 5 * time.Millisecond, false},
+		{5 * time.Millisecond, 6 * time.Millisecond, false},
+		{5 * time.Millisecond, 40 * time.Millisecond, false},
+		{100 * time.Microsecond, 1400 * time.Microsecond, false},
+		{5 * time.Millisecond, 4 * time.Millisecond, true},
+		{5 * time.Millisecond, 100 * time.Millisecond, true},
+		{0, time.Millisecond, true},
+	}
+
+	for _, c := range cases {
+		d, err := FitDistribution(c.mean, c.p99)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("FitDistribution(%s, %s) = %s, should error", c.mean, c.p99, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("FitDistribution(%s, %s) error: %s", c.mean, c.p99, err)
+			continue
+		}
+		if err := d.Validate(); err != nil {
+			t.Errorf("FitDistribution(%s, %s) = %s, which is invalid: %s", c.mean, c.p99, d, err)
+		}
+
+		samples := make([]float64, n)
+		var sum float64
+		for i := range samples {
+			samples[i] = float64(d.Sample(r))
+			sum += samples[i]
+		}
+		sort.Float64s(samples)
+		if got, want := sum/n, float64(c.mean); math.Abs(got-want) > want*0.05 {
+			t.Errorf("FitDistribution(%s, %s) = %s: mean of samples = %s", c.mean, c.p99, d, time.Duration(got))
+		}
+		if got, want := samples[n*99/100], float64(c.p99); math.Abs(got-want) > want*0.05 {
+			t.Errorf("FitDistribution(%s, %s) = %s: 99th percentile of samples = %s", c.mean, c.p99, d, time.Duration(got))
+		}
+	}
+}
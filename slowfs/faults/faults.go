@@ -0,0 +1,180 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faults decides when filesystem operations should fail, so that applications' error
+// handling can be tested as well as their tolerance of slowness.
+package faults
+
+import (
+	"fmt"
+	"slowfs/slowfs/units"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Op is a class of filesystem operation which faults can be injected into.
+type Op int
+
+const (
+	// AnyOp matches every class of operation.
+	AnyOp Op = iota
+	// ReadOp is reading file data.
+	ReadOp
+	// WriteOp is writing or allocating file data.
+	WriteOp
+	// FsyncOp is flushing file data to the device.
+	FsyncOp
+	// OpenOp is opening or creating files.
+	OpenOp
+	// MetadataOp is any other operation, like stat, chmod, rename or unlink.
+	MetadataOp
+)
+
+func (o Op) String() string {
+	switch o {
+	case AnyOp:
+		return "AnyOp"
+	case ReadOp:
+		return "ReadOp"
+	case WriteOp:
+		return "WriteOp"
+	case FsyncOp:
+		return "FsyncOp"
+	case OpenOp:
+		return "OpenOp"
+	case MetadataOp:
+		return "MetadataOp"
+	default:
+		return "unknown op"
+	}
+}
+
+// Matches returns whether a fault for this class of operation applies to an operation of class op.
+func (o Op) Matches(op Op) bool {
+	return o == AnyOp || o == op
+}
+
+// ParseOpFromString parses an Op from a string. This function is case insensitive, and accepts
+// synonyms, e.g. read and readop both mean ReadOp, and an empty string means AnyOp.
+func ParseOpFromString(s string) (Op, error) {
+	switch strings.ToLower(s) {
+	case "anyop", "any", "*", "":
+		return AnyOp, nil
+	case "readop", "read":
+		return ReadOp, nil
+	case "writeop", "write":
+		return WriteOp, nil
+	case "fsyncop", "fsync":
+		return FsyncOp, nil
+	case "openop", "open":
+		return OpenOp, nil
+	case "metadataop", "metadata":
+		return MetadataOp, nil
+	default:
+		return 0, fmt.Errorf("unknown op %s", s)
+	}
+}
+
+var errnos = map[string]syscall.Errno{
+	"EACCES":    syscall.EACCES,
+	"EAGAIN":    syscall.EAGAIN,
+	"EBUSY":     syscall.EBUSY,
+	"EDQUOT":    syscall.EDQUOT,
+	"EEXIST":    syscall.EEXIST,
+	"EFBIG":     syscall.EFBIG,
+	"EINTR":     syscall.EINTR,
+	"EIO":       syscall.EIO,
+	"EMFILE":    syscall.EMFILE,
+	"ENOENT":    syscall.ENOENT,
+	"ENOSPC":    syscall.ENOSPC,
+	"ENOTCONN":  syscall.ENOTCONN,
+	"EPERM":     syscall.EPERM,
+	"EROFS":     syscall.EROFS,
+	"ESTALE":    syscall.ESTALE,
+	"ETIMEDOUT": syscall.ETIMEDOUT,
+}
+
+// ParseErrnoFromString parses the name of an error, like EIO or ENOSPC. This function is case
+// insensitive.
+func ParseErrnoFromString(s string) (syscall.Errno, error) {
+	errno, ok := errnos[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown error %s", s)
+	}
+	return errno, nil
+}
+
+// Injector decides whether operations should fail. Implementations must be safe for concurrent
+// use.
+type Injector interface {
+	// Start sets the time faults are timed relative to. Nothing is injected before this is called.
+	Start(t time.Time)
+
+	// Inject returns the error an operation of the given class on the given path, relative to the
+	// root of the mount, should fail with at time now, or zero if it should proceed.
+	Inject(op Op, path string, now time.Time) syscall.Errno
+
+	// InjectRead is Inject for a read of n bytes from path, which can also be cut short. It returns
+	// how many of the bytes the read should read, or the error it should fail with instead.
+	InjectRead(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno)
+
+	// InjectWrite is Inject for a write of n bytes to path, which can also be cut short. It returns
+	// how many of the bytes the write should write, or the error it should fail with instead.
+	InjectWrite(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno)
+}
+
+// Injectors combines several injectors. An operation fails with the error of the first injector
+// which fails it.
+type Injectors []Injector
+
+// Start implements Injector.
+func (is Injectors) Start(t time.Time) {
+	for _, i := range is {
+		i.Start(t)
+	}
+}
+
+// Inject implements Injector.
+func (is Injectors) Inject(op Op, path string, now time.Time) syscall.Errno {
+	for _, i := range is {
+		if errno := i.Inject(op, path, now); errno != 0 {
+			return errno
+		}
+	}
+	return 0
+}
+
+// InjectRead implements Injector. A read cut short by one injector may be cut shorter by the next.
+func (is Injectors) InjectRead(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno) {
+	for _, i := range is {
+		var errno syscall.Errno
+		if n, errno = i.InjectRead(path, n, now); errno != 0 {
+			return 0, errno
+		}
+	}
+	return n, 0
+}
+
+// InjectWrite implements Injector. A write cut short by one injector may be cut shorter by the
+// next.
+func (is Injectors) InjectWrite(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno) {
+	for _, i := range is {
+		var errno syscall.Errno
+		if n, errno = i.InjectWrite(path, n, now); errno != 0 {
+			return 0, errno
+		}
+	}
+	return n, 0
+}
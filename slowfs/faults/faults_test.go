@@ -0,0 +1,85 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseOpFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      Op
+		shouldErr bool
+	}{
+		{"", AnyOp, false},
+		{"any", AnyOp, false},
+		{"Read", ReadOp, false},
+		{"writeop", WriteOp, false},
+		{"FSYNC", FsyncOp, false},
+		{"open", OpenOp, false},
+		{"metadata", MetadataOp, false},
+		{"seek", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseOpFromString(c.s)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseOpFromString(%q) = %s, %v, want %s, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestOp_Matches(t *testing.T) {
+	cases := []struct {
+		fault Op
+		op    Op
+		want  bool
+	}{
+		{AnyOp, ReadOp, true},
+		{AnyOp, MetadataOp, true},
+		{ReadOp, ReadOp, true},
+		{ReadOp, WriteOp, false},
+		{FsyncOp, AnyOp, false},
+	}
+
+	for _, c := range cases {
+		if got, want := c.fault.Matches(c.op), c.want; got != want {
+			t.Errorf("%s.Matches(%s) = %t, want %t", c.fault, c.op, got, want)
+		}
+	}
+}
+
+func TestParseErrnoFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      syscall.Errno
+		shouldErr bool
+	}{
+		{"EIO", syscall.EIO, false},
+		{"enospc", syscall.ENOSPC, false},
+		{"EDQUOT", syscall.EDQUOT, false},
+		{"EWHATEVER", 0, true},
+		{"", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseErrnoFromString(c.s)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseErrnoFromString(%q) = %d, %v, want %d, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"math/rand"
+	"slowfs/slowfs/units"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// InterruptFaults interrupts reads and writes at random, as signals do: some fail with EINTR, and
+// some are cut short and return a short count without an error, which POSIX allows. Applications
+// which assume IO either completes or fails outright get it wrong under these.
+type InterruptFaults struct {
+	// The probabilities of an operation failing with EINTR, and of a read or write being cut short.
+	eintr      float64
+	shortRead  float64
+	shortWrite float64
+
+	mu      sync.Mutex
+	started bool
+	rand    *rand.Rand
+}
+
+// NewInterruptFaults creates an InterruptFaults which fails reads and writes with EINTR with
+// probability eintr, and cuts reads and writes short with probabilities shortRead and shortWrite.
+// Its random numbers are generated from seed.
+func NewInterruptFaults(eintr, shortRead, shortWrite float64, seed int64) *InterruptFaults {
+	return &InterruptFaults{
+		eintr:      eintr,
+		shortRead:  shortRead,
+		shortWrite: shortWrite,
+		rand:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Start implements Injector.
+func (f *InterruptFaults) Start(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.started = true
+}
+
+// Inject implements Injector. Only reads and writes are interrupted.
+func (f *InterruptFaults) Inject(op Op, path string, now time.Time) syscall.Errno {
+	if op != ReadOp && op != WriteOp {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.started && f.rand.Float64() < f.eintr {
+		return syscall.EINTR
+	}
+	return 0
+}
+
+// InjectRead implements Injector.
+func (f *InterruptFaults) InjectRead(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno) {
+	if errno := f.Inject(ReadOp, path, now); errno != 0 {
+		return 0, errno
+	}
+	return f.cut(n, f.shortRead), 0
+}
+
+// InjectWrite implements Injector.
+func (f *InterruptFaults) InjectWrite(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno) {
+	if errno := f.Inject(WriteOp, path, now); errno != 0 {
+		return 0, errno
+	}
+	return f.cut(n, f.shortWrite), 0
+}
+
+// cut returns how many of n bytes a read or write transfers, when it is cut short with probability
+// p. One cut short transfers between 1 and n-1 bytes, so one of a single byte is never cut short.
+func (f *InterruptFaults) cut(n units.NumBytes, p float64) units.NumBytes {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.started && n >= 2 && f.rand.Float64() < p {
+		return 1 + units.NumBytes(f.rand.Int63n(int64(n-1)))
+	}
+	return n
+}
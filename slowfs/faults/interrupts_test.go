@@ -0,0 +1,82 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterruptFaults(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := NewInterruptFaults(1, 1, 1, 1)
+	if got, want := f.Inject(ReadOp, "a", start), syscall.Errno(0); got != want {
+		t.Errorf("Inject() before Start() = %d, want %d", got, want)
+	}
+
+	f.Start(start)
+	cases := []struct {
+		op   Op
+		want syscall.Errno
+	}{
+		{ReadOp, syscall.EINTR},
+		{WriteOp, syscall.EINTR},
+		{FsyncOp, 0},
+		{MetadataOp, 0},
+	}
+	for _, c := range cases {
+		if got, want := f.Inject(c.op, "a", start), c.want; got != want {
+			t.Errorf("Inject(%s) = %d, want %d", c.op, got, want)
+		}
+	}
+}
+
+func TestInterruptFaults_Short(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := NewInterruptFaults(0, 0.5, 0.25, 1)
+	f.Start(start)
+
+	shortReads, shortWrites := 0, 0
+	for i := 0; i < 10000; i++ {
+		n, errno := f.InjectRead("a", 100, start)
+		if errno != 0 || n < 1 || n > 100 {
+			t.Fatalf("InjectRead(100) = %d, %d, want between 1 and 100 bytes read", n, errno)
+		}
+		if n < 100 {
+			shortReads++
+		}
+		n, errno = f.InjectWrite("a", 100, start)
+		if errno != 0 || n < 1 || n > 100 {
+			t.Fatalf("InjectWrite(100) = %d, %d, want between 1 and 100 bytes written", n, errno)
+		}
+		if n < 100 {
+			shortWrites++
+		}
+	}
+	if shortReads < 4500 || shortReads > 5500 {
+		t.Errorf("InjectRead() cut %d of 10000 reads short at probability 0.5, want about 5000", shortReads)
+	}
+	if shortWrites < 2000 || shortWrites > 3000 {
+		t.Errorf("InjectWrite() cut %d of 10000 writes short at probability 0.25, want about 2500", shortWrites)
+	}
+
+	// A transfer of one byte can't be cut short.
+	f = NewInterruptFaults(0, 1, 1, 1)
+	f.Start(start)
+	if n, errno := f.InjectWrite("a", 1, start); n != 1 || errno != 0 {
+		t.Errorf("InjectWrite(1) = %d, %d, want 1, 0", n, errno)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Anomaly is a way a directory listing can go wrong while the directory is being modified. POSIX
+// allows these, and NFS exhibits them, so directory-scanning code should cope with all of them.
+type Anomaly int
+
+// Anomalies which ListingFaults inject.
+const (
+	NoAnomaly Anomaly = iota
+	// SkippedEntry leaves one entry out of the listing.
+	SkippedEntry
+	// DuplicatedEntry lists one entry twice.
+	DuplicatedEntry
+	// RestartedListing lists some entries from the start again, as if the listing restarted
+	// part way through.
+	RestartedListing
+)
+
+func (a Anomaly) String() string {
+	switch a {
+	case NoAnomaly:
+		return "NoAnomaly"
+	case SkippedEntry:
+		return "SkippedEntry"
+	case DuplicatedEntry:
+		return "DuplicatedEntry"
+	case RestartedListing:
+		return "RestartedListing"
+	default:
+		return "unknown Anomaly"
+	}
+}
+
+// ListingFaults perturbs directory listings at random.
+type ListingFaults struct {
+	probability float64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewListingFaults creates a ListingFaults which perturbs each listing with the given probability.
+// Its random numbers are generated from seed.
+func NewListingFaults(probability float64, seed int64) *ListingFaults {
+	return &ListingFaults{
+		probability: probability,
+		rand:        rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Perturb returns the order to list n entries in, as indexes into them, along with the anomaly it
+// contains. Usually this is every entry in order, with no anomaly.
+func (f *ListingFaults) Perturb(n int) ([]int, Anomaly) {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	if n == 0 {
+		return order, NoAnomaly
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rand.Float64() >= f.probability {
+		return order, NoAnomaly
+	}
+	i := f.rand.Intn(n)
+	switch anomaly := Anomaly(1 + f.rand.Intn(3)); anomaly {
+	case SkippedEntry:
+		return append(order[:i], order[i+1:]...), anomaly
+	case DuplicatedEntry:
+		return append(order[:i+1], order[i:]...), anomaly
+	default:
+		// Restart after listing the first i+1 entries.
+		return append(order[:i+1], order...), anomaly
+	}
+}
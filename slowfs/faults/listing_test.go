@@ -0,0 +1,63 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListingFaults_Perturb(t *testing.T) {
+	inOrder := []int{0, 1, 2, 3, 4}
+	if got, anomaly := NewListingFaults(0, 1).Perturb(5); !reflect.DeepEqual(got, inOrder) || anomaly != NoAnomaly {
+		t.Errorf("Perturb(5) with probability 0 = %v, %s, want %v, NoAnomaly", got, anomaly, inOrder)
+	}
+	if got, anomaly := NewListingFaults(1, 1).Perturb(0); len(got) != 0 || anomaly != NoAnomaly {
+		t.Errorf("Perturb(0) with probability 1 = %v, %s, want [], NoAnomaly", got, anomaly)
+	}
+
+	f := NewListingFaults(1, 1)
+	seen := make(map[Anomaly]bool)
+	for i := 0; i < 100; i++ {
+		got, anomaly := f.Perturb(5)
+		seen[anomaly] = true
+		counts := make(map[int]int)
+		for _, j := range got {
+			counts[j]++
+		}
+
+		switch anomaly {
+		case SkippedEntry:
+			if len(got) != 4 || len(counts) != 4 {
+				t.Errorf("Perturb(5) with SkippedEntry = %v, want 4 distinct entries", got)
+			}
+		case DuplicatedEntry:
+			if len(got) != 6 || len(counts) != 5 {
+				t.Errorf("Perturb(5) with DuplicatedEntry = %v, want 5 distinct entries and a duplicate", got)
+			}
+		case RestartedListing:
+			if len(got) < 6 || !reflect.DeepEqual(got[len(got)-5:], inOrder) {
+				t.Errorf("Perturb(5) with RestartedListing = %v, want some entries then all of them", got)
+			}
+		default:
+			t.Errorf("Perturb(5) with probability 1 gave anomaly %s", anomaly)
+		}
+	}
+	for _, a := range []Anomaly{SkippedEntry, DuplicatedEntry, RestartedListing} {
+		if !seen[a] {
+			t.Errorf("Perturb(5) never gave %s in 100 tries", a)
+		}
+	}
+}
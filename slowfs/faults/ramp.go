@@ -0,0 +1,214 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RampShape is how a Ramp moves from its initial to its final value.
+type RampShape int
+
+const (
+	// LinearRamp changes by the same amount every second.
+	LinearRamp RampShape = iota
+	// ExponentialRamp changes by the same factor every second, so it spends longer near small
+	// values, which is where thresholds usually are.
+	ExponentialRamp
+)
+
+// Ramp is a probability which changes over the run, from From at the start to To after Duration,
+// and then stays at To.
+type Ramp struct {
+	Shape    RampShape
+	From     float64
+	To       float64
+	Duration time.Duration
+}
+
+// At returns the probability elapsed after the start.
+func (r *Ramp) At(elapsed time.Duration) float64 {
+	if r.Duration <= 0 || elapsed >= r.Duration {
+		return r.To
+	}
+	if elapsed <= 0 {
+		return r.From
+	}
+	frac := float64(elapsed) / float64(r.Duration)
+	switch r.Shape {
+	case ExponentialRamp:
+		return r.From * math.Pow(r.To/r.From, frac)
+	default:
+		return r.From + (r.To-r.From)*frac
+	}
+}
+
+// ParseRampFromString parses a ramp. It is either a constant probability, like "0.01", or a shape
+// applied to the initial probability, the final probability and how long to take, like
+// "linear(0, 0.05, 1h)" or "exp(0.0001, 0.5, 2h)". Exponential ramps must start above zero.
+func ParseRampFromString(s string) (Ramp, error) {
+	s = strings.TrimSpace(s)
+	open := strings.IndexByte(s, '(')
+	if open < 0 {
+		p, err := parseProbability(s)
+		return Ramp{From: p, To: p}, err
+	}
+	if !strings.HasSuffix(s, ")") {
+		return Ramp{}, fmt.Errorf("ramp %q: missing )", s)
+	}
+
+	var r Ramp
+	switch strings.ToLower(strings.TrimSpace(s[:open])) {
+	case "linear", "lin":
+		r.Shape = LinearRamp
+	case "exponential", "exp":
+		r.Shape = ExponentialRamp
+	default:
+		return Ramp{}, fmt.Errorf("ramp %q: unknown shape %s", s, s[:open])
+	}
+	args := strings.Split(s[open+1:len(s)-1], ",")
+	if len(args) != 3 {
+		return Ramp{}, fmt.Errorf("ramp %q: want 3 arguments, got %d", s, len(args))
+	}
+	var err error
+	if r.From, err = parseProbability(args[0]); err != nil {
+		return Ramp{}, fmt.Errorf("ramp %q: %s", s, err)
+	}
+	if r.To, err = parseProbability(args[1]); err != nil {
+		return Ramp{}, fmt.Errorf("ramp %q: %s", s, err)
+	}
+	if r.Duration, err = time.ParseDuration(strings.TrimSpace(args[2])); err != nil {
+		return Ramp{}, fmt.Errorf("ramp %q: %s", s, err)
+	}
+	if r.Duration <= 0 {
+		return Ramp{}, fmt.Errorf("ramp %q: duration must be positive", s)
+	}
+	if r.Shape == ExponentialRamp && (r.From == 0 || r.To == 0) {
+		return Ramp{}, fmt.Errorf("ramp %q: exponential ramps can't start or end at zero", s)
+	}
+	return r, nil
+}
+
+func parseProbability(s string) (float64, error) {
+	p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 1 {
+		return 0, errors.New("probability must be between 0 and 1")
+	}
+	return p, nil
+}
+
+// RandomFaults fails matching operations at random, with a probability which follows a Ramp, e.g.
+// to find the fault rate at which an application falls over during a soak test.
+type RandomFaults struct {
+	op    Op
+	path  string
+	errno syscall.Errno
+	ramp  Ramp
+
+	mu    sync.Mutex
+	start time.Time
+	rand  *rand.Rand
+}
+
+// NewRandomFaults creates a RandomFaults which fails operations of class op on paths matching
+// path, as for ScheduledFault, with errno. Its random numbers are generated from seed.
+func NewRandomFaults(op Op, path string, errno syscall.Errno, ramp Ramp, seed int64) *RandomFaults {
+	return &RandomFaults{
+		op:    op,
+		path:  path,
+		errno: errno,
+		ramp:  ramp,
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// ParseRandomFaultsFromString parses a RandomFaults from a single expression of the form
+// op:error:ramp, optionally followed by :path. For example, "write:EIO:linear(0, 0.05, 1h)" or
+// "*:ENOSPC:0.01:db/*".
+func ParseRandomFaultsFromString(s string, seed int64) (*RandomFaults, error) {
+	parts := strings.SplitN(s, ":", 4)
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("random faults %q: want op:error:ramp[:path]", s)
+	}
+	op, err := ParseOpFromString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("random faults %q: %s", s, err)
+	}
+	errno, err := ParseErrnoFromString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("random faults %q: %s", s, err)
+	}
+	ramp, err := ParseRampFromString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("random faults %q: %s", s, err)
+	}
+	var path string
+	if len(parts) == 4 {
+		path = parts[3]
+	}
+	return NewRandomFaults(op, path, errno, ramp, seed), nil
+}
+
+// Start implements Injector.
+func (f *RandomFaults) Start(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.start = t
+}
+
+// Inject implements Injector.
+func (f *RandomFaults) Inject(op Op, path string, now time.Time) syscall.Errno {
+	if !f.op.Matches(op) || (f.path != "" && !slowfs.MatchesPath(f.path, path)) {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.start.IsZero() {
+		return 0
+	}
+	if f.rand.Float64() < f.ramp.At(now.Sub(f.start)) {
+		return f.errno
+	}
+	return 0
+}
+
+// InjectRead implements Injector. Reads are never cut short, only failed.
+func (f *RandomFaults) InjectRead(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno) {
+	if errno := f.Inject(ReadOp, path, now); errno != 0 {
+		return 0, errno
+	}
+	return n, 0
+}
+
+// InjectWrite implements Injector. Writes are never cut short, only failed.
+func (f *RandomFaults) InjectWrite(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno) {
+	if errno := f.Inject(WriteOp, path, now); errno != 0 {
+		return 0, errno
+	}
+	return n, 0
+}
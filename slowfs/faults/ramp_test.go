@@ -0,0 +1,163 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"math"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRamp_At(t *testing.T) {
+	cases := []struct {
+		ramp    Ramp
+		elapsed time.Duration
+		want    float64
+	}{
+		{Ramp{From: 0.1, To: 0.1}, time.Hour, 0.1},
+		{Ramp{LinearRamp, 0, 0.1, time.Hour}, -time.Second, 0},
+		{Ramp{LinearRamp, 0, 0.1, time.Hour}, 0, 0},
+		{Ramp{LinearRamp, 0, 0.1, time.Hour}, 30 * time.Minute, 0.05},
+		{Ramp{LinearRamp, 0, 0.1, time.Hour}, 2 * time.Hour, 0.1},
+		{Ramp{LinearRamp, 0.5, 0, time.Hour}, 15 * time.Minute, 0.375},
+		{Ramp{ExponentialRamp, 0.001, 0.1, time.Hour}, 0, 0.001},
+		{Ramp{ExponentialRamp, 0.001, 0.1, time.Hour}, 30 * time.Minute, 0.01},
+		{Ramp{ExponentialRamp, 0.001, 0.1, time.Hour}, time.Hour, 0.1},
+	}
+
+	for _, c := range cases {
+		if got, want := c.ramp.At(c.elapsed), c.want; math.Abs(got-want) > 1e-9 {
+			t.Errorf("%+v.At(%s) = %g, want %g", c.ramp, c.elapsed, got, want)
+		}
+	}
+}
+
+func TestParseRampFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      Ramp
+		shouldErr bool
+	}{
+		{"0.01", Ramp{From: 0.01, To: 0.01}, false},
+		{"linear(0, 0.05, 1h)", Ramp{LinearRamp, 0, 0.05, time.Hour}, false},
+		{" LIN(0.5,0,10m) ", Ramp{LinearRamp, 0.5, 0, 10 * time.Minute}, false},
+		{"exp(0.0001, 0.5, 2h)", Ramp{ExponentialRamp, 0.0001, 0.5, 2 * time.Hour}, false},
+		{"exp(0, 0.5, 2h)", Ramp{}, true},
+		{"linear(0, 0.05)", Ramp{}, true},
+		{"linear(0, 0.05, 1h", Ramp{}, true},
+		{"linear(0, 1.5, 1h)", Ramp{}, true},
+		{"linear(0, 0.5, 0s)", Ramp{}, true},
+		{"sine(0, 0.5, 1h)", Ramp{}, true},
+		{"often", Ramp{}, true},
+		{"-0.1", Ramp{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRampFromString(c.s)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseRampFromString(%q) = %+v, %v, want %+v, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestParseRandomFaultsFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		wantOp    Op
+		wantPath  string
+		wantErrno syscall.Errno
+		shouldErr bool
+	}{
+		{"write:EIO:linear(0, 0.05, 1h)", WriteOp, "", syscall.EIO, false},
+		{"*:ENOSPC:0.01:db/*", AnyOp, "db/*", syscall.ENOSPC, false},
+		{"write:EIO", 0, "", 0, true},
+		{"seek:EIO:0.1", 0, "", 0, true},
+		{"write:EOOPS:0.1", 0, "", 0, true},
+		{"write:EIO:2", 0, "", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRandomFaultsFromString(c.s, 1)
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseRandomFaultsFromString(%q) = _, %v, want error %t", c.s, err, c.shouldErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.op != c.wantOp || got.path != c.wantPath || got.errno != c.wantErrno {
+			t.Errorf("ParseRandomFaultsFromString(%q) = %s %q %d, want %s %q %d", c.s, got.op, got.path, got.errno, c.wantOp, c.wantPath, c.wantErrno)
+		}
+	}
+}
+
+func TestRandomFaults_Inject(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := NewRandomFaults(WriteOp, "db", syscall.EIO, Ramp{LinearRamp, 0, 1, time.Hour}, 1)
+	if got, want := f.Inject(WriteOp, "db", start.Add(2*time.Hour)), syscall.Errno(0); got != want {
+		t.Errorf("Inject() before Start() = %d, want %d", got, want)
+	}
+
+	f.Start(start)
+	cases := []struct {
+		op      Op
+		path    string
+		elapsed time.Duration
+		want    syscall.Errno
+	}{
+		{WriteOp, "db/a", 0, 0},
+		{WriteOp, "db/a", time.Hour, syscall.EIO},
+		{ReadOp, "db/a", time.Hour, 0},
+		{WriteOp, "log", time.Hour, 0},
+	}
+	for _, c := range cases {
+		if got, want := f.Inject(c.op, c.path, start.Add(c.elapsed)), c.want; got != want {
+			t.Errorf("Inject(%s, %q) after %s = %d, want %d", c.op, c.path, c.elapsed, got, want)
+		}
+	}
+
+	// Halfway through, about half of operations should fail.
+	failed := 0
+	for i := 0; i < 10000; i++ {
+		if f.Inject(WriteOp, "db", start.Add(30*time.Minute)) != 0 {
+			failed++
+		}
+	}
+	if failed < 4500 || failed > 5500 {
+		t.Errorf("Inject() failed %d of 10000 operations at probability 0.5, want about 5000", failed)
+	}
+}
+
+func TestInjectors(t *testing.T) {
+	start := time.Unix(1000, 0)
+	is := Injectors{
+		NewRandomFaults(ReadOp, "", syscall.EIO, Ramp{From: 1, To: 1}, 1),
+		NewRandomFaults(AnyOp, "", syscall.ENOSPC, Ramp{From: 1, To: 1}, 1),
+	}
+	is.Start(start)
+	cases := []struct {
+		op   Op
+		want syscall.Errno
+	}{
+		{ReadOp, syscall.EIO},
+		{WriteOp, syscall.ENOSPC},
+	}
+	for _, c := range cases {
+		if got, want := is.Inject(c.op, "a", start), c.want; got != want {
+			t.Errorf("Inject(%s) = %d, want %d", c.op, got, want)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ScheduledFault is a fault which becomes active at a fixed time after a Schedule starts.
+type ScheduledFault struct {
+	// At is when, relative to the start of the schedule, the fault becomes active.
+	At time.Duration
+
+	// Op is which class of operations fail.
+	Op Op
+
+	// Path is a glob pattern matching which paths fail, as for slowfs.MatchesPath. If empty, all
+	// paths fail.
+	Path string
+
+	// Errno is the error matching operations fail with.
+	Errno syscall.Errno
+
+	// Partial makes matching writes write only half their data and return a short count, as when
+	// a disk fills up part way through a write, rather than failing with Errno.
+	Partial bool
+
+	// AfterBytes is how many bytes must have been written to paths the fault matches before it
+	// becomes active, e.g. to fail fsyncs with ENOSPC once the data would have filled a disk.
+	AfterBytes units.NumBytes
+
+	// Duration is how long the fault stays active for. If zero, it stays active until Count
+	// operations have failed.
+	Duration time.Duration
+
+	// Count is how many operations fail before the fault becomes inactive. If zero, every matching
+	// operation fails while the fault is active; if Duration is also zero, only one fails.
+	Count int
+}
+
+func (f *ScheduledFault) validate() error {
+	if f.At < 0 {
+		return errors.New("At cannot be negative")
+	}
+	if f.Duration < 0 {
+		return errors.New("Duration cannot be negative")
+	}
+	if f.Count < 0 {
+		return errors.New("Count cannot be negative")
+	}
+	if f.AfterBytes < 0 {
+		return errors.New("AfterBytes cannot be negative")
+	}
+	if f.Partial {
+		if f.Errno != 0 {
+			return errors.New("Partial faults don't fail with an Error")
+		}
+		if !f.Op.Matches(WriteOp) {
+			return errors.New("Partial faults only apply to writes")
+		}
+	} else if f.Errno == 0 {
+		return errors.New("Error is required")
+	}
+	return nil
+}
+
+type scheduledFaultState struct {
+	ScheduledFault
+	remaining int
+	// How many bytes have been written to matching paths.
+	written units.NumBytes
+}
+
+// active returns whether the fault applies to an operation of class op on path, elapsed after the
+// start of the schedule.
+func (f *scheduledFaultState) active(op Op, path string, elapsed time.Duration) bool {
+	if elapsed < f.At || (f.Duration > 0 && elapsed >= f.At+f.Duration) {
+		return false
+	}
+	if (f.Count > 0 || f.Duration == 0) && f.remaining == 0 {
+		return false
+	}
+	return f.written >= f.AfterBytes && f.Op.Matches(op) && f.matchesPath(path)
+}
+
+func (f *scheduledFaultState) matchesPath(path string) bool {
+	return f.Path == "" || slowfs.MatchesPath(f.Path, path)
+}
+
+// use records that the fault has been injected.
+func (f *scheduledFaultState) use() {
+	if f.remaining > 0 {
+		f.remaining--
+	}
+}
+
+func newScheduledFaultState(f ScheduledFault) *scheduledFaultState {
+	remaining := f.Count
+	if remaining == 0 && f.Duration == 0 {
+		remaining = 1
+	}
+	return &scheduledFaultState{ScheduledFault: f, remaining: remaining}
+}
+
+// Schedule injects a precomputed timeline of faults, for example one produced by external tooling
+// so that the same fault timeline can be replayed against different systems under test.
+type Schedule struct {
+	mu     sync.Mutex
+	start  time.Time
+	faults []*scheduledFaultState
+}
+
+// NewSchedule creates a Schedule of the given faults. It injects nothing until it is started.
+func NewSchedule(faults []ScheduledFault) (*Schedule, error) {
+	s := &Schedule{}
+	for i, f := range faults {
+		if err := f.validate(); err != nil {
+			return nil, fmt.Errorf("fault %d: %s", i, err)
+		}
+		s.faults = append(s.faults, newScheduledFaultState(f))
+	}
+	return s, nil
+}
+
+// Start implements Injector.
+func (s *Schedule) Start(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = t
+}
+
+// Add schedules another fault, with f.At measured from now rather than from the start of the
+// schedule. The schedule must have been started.
+func (s *Schedule) Add(f ScheduledFault, now time.Time) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.start.IsZero() {
+		return errors.New("schedule hasn't started")
+	}
+	f.At += now.Sub(s.start)
+	s.faults = append(s.faults, newScheduledFaultState(f))
+	return nil
+}
+
+// Inject implements Injector.
+func (s *Schedule) Inject(op Op, path string, now time.Time) syscall.Errno {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.start.IsZero() {
+		return 0
+	}
+
+	elapsed := now.Sub(s.start)
+	for _, f := range s.faults {
+		if !f.Partial && f.active(op, path, elapsed) {
+			f.use()
+			return f.Errno
+		}
+	}
+	return 0
+}
+
+// InjectRead implements Injector. Reads are never cut short, only failed.
+func (s *Schedule) InjectRead(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno) {
+	if errno := s.Inject(ReadOp, path, now); errno != 0 {
+		return 0, errno
+	}
+	return n, 0
+}
+
+// InjectWrite implements Injector. The bytes written count towards the AfterBytes of faults
+// matching path.
+func (s *Schedule) InjectWrite(path string, n units.NumBytes, now time.Time) (units.NumBytes, syscall.Errno) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.start.IsZero() {
+		return n, 0
+	}
+
+	elapsed := now.Sub(s.start)
+	written, errno := n, syscall.Errno(0)
+	for _, f := range s.faults {
+		// A write of one byte can't be cut short, so leave the fault for the next write.
+		if !f.active(WriteOp, path, elapsed) || (f.Partial && n < 2) {
+			continue
+		}
+		f.use()
+		if f.Partial {
+			written = n / 2
+		} else {
+			written, errno = 0, f.Errno
+		}
+		break
+	}
+
+	for _, f := range s.faults {
+		if f.matchesPath(path) {
+			f.written = units.NumBytesAdd(f.written, written)
+		}
+	}
+	return written, errno
+}
+
+// ScheduledFaultSpec is how a ScheduledFault is written down, e.g. in JSON. Like device configs,
+// values are strings.
+type ScheduledFaultSpec struct {
+	At         string
+	Op         string
+	Path       string
+	Error      string
+	Partial    bool
+	AfterBytes string
+	Duration   string
+	Count      int
+}
+
+// Parse parses the fault the spec describes.
+func (j *ScheduledFaultSpec) Parse() (ScheduledFault, error) {
+	var f ScheduledFault
+	var err error
+	if f.At, err = time.ParseDuration(j.At); err != nil {
+		return f, fmt.Errorf("At: %s", err)
+	}
+	if f.Op, err = ParseOpFromString(j.Op); err != nil {
+		return f, fmt.Errorf("Op: %s", err)
+	}
+	if j.Error != "" || !j.Partial {
+		if f.Errno, err = ParseErrnoFromString(j.Error); err != nil {
+			return f, fmt.Errorf("Error: %s", err)
+		}
+	}
+	if j.AfterBytes != "" {
+		if f.AfterBytes, err = units.ParseNumBytesFromString(j.AfterBytes); err != nil {
+			return f, fmt.Errorf("AfterBytes: %s", err)
+		}
+	}
+	if j.Duration != "" {
+		if f.Duration, err = time.ParseDuration(j.Duration); err != nil {
+			return f, fmt.Errorf("Duration: %s", err)
+		}
+	}
+	f.Path = j.Path
+	f.Partial = j.Partial
+	f.Count = j.Count
+	return f, nil
+}
+
+// ParseScheduleFromJSON parses a fault schedule, either as a JSON array of faults or as one JSON
+// fault per line. For example:
+//
+//	[{"At": "10s", "Op": "write", "Path": "db/*", "Error": "EIO", "Count": 3},
+//	 {"At": "1m", "Op": "fsync", "Error": "ENOSPC", "Duration": "30s"},
+//	 {"Op": "write", "Partial": true, "AfterBytes": "1GB", "Count": 1}]
+func ParseScheduleFromJSON(data []byte) (*Schedule, error) {
+	var jsonFaults []ScheduledFaultSpec
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&jsonFaults); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var j ScheduledFaultSpec
+			dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&j); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			jsonFaults = append(jsonFaults, j)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	faults := make([]ScheduledFault, 0, len(jsonFaults))
+	for i, j := range jsonFaults {
+		f, err := j.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("fault %d: %s", i, err)
+		}
+		faults = append(faults, f)
+	}
+	return NewSchedule(faults)
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"slowfs/slowfs/units"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSchedule_Inject(t *testing.T) {
+	type injection struct {
+		at   time.Duration
+		op   Op
+		path string
+		want syscall.Errno
+	}
+	cases := []struct {
+		desc       string
+		faults     []ScheduledFault
+		injections []injection
+	}{
+		{
+			"one shot",
+			[]ScheduledFault{{At: time.Second, Op: WriteOp, Errno: syscall.EIO}},
+			[]injection{
+				{0, WriteOp, "a", 0},
+				{time.Second, ReadOp, "a", 0},
+				{time.Second, WriteOp, "a", syscall.EIO},
+				{2 * time.Second, WriteOp, "a", 0},
+			},
+		},
+		{
+			"count",
+			[]ScheduledFault{{Op: AnyOp, Path: "db", Errno: syscall.ENOSPC, Count: 2}},
+			[]injection{
+				{0, ReadOp, "log", 0},
+				{0, ReadOp, "db/a", syscall.ENOSPC},
+				{time.Hour, MetadataOp, "db", syscall.ENOSPC},
+				{time.Hour, MetadataOp, "db", 0},
+			},
+		},
+		{
+			"duration",
+			[]ScheduledFault{{At: time.Second, Op: FsyncOp, Errno: syscall.EIO, Duration: time.Second}},
+			[]injection{
+				{time.Second, FsyncOp, "a", syscall.EIO},
+				{1500 * time.Millisecond, FsyncOp, "b", syscall.EIO},
+				{2 * time.Second, FsyncOp, "a", 0},
+			},
+		},
+		{
+			"duration and count",
+			[]ScheduledFault{{Op: ReadOp, Errno: syscall.EIO, Duration: time.Second, Count: 1}},
+			[]injection{
+				{0, ReadOp, "a", syscall.EIO},
+				{time.Millisecond, ReadOp, "a", 0},
+			},
+		},
+		{
+			"first match wins",
+			[]ScheduledFault{
+				{Op: WriteOp, Errno: syscall.EDQUOT, Duration: time.Second},
+				{Op: AnyOp, Errno: syscall.EIO, Duration: 2 * time.Second},
+			},
+			[]injection{
+				{0, WriteOp, "a", syscall.EDQUOT},
+				{0, ReadOp, "a", syscall.EIO},
+				{time.Second, WriteOp, "a", syscall.EIO},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		s, err := NewSchedule(c.faults)
+		if err != nil {
+			t.Fatalf("fail (%s) NewSchedule() = _, %s", c.desc, err)
+		}
+		start := time.Unix(1000, 0)
+		if got, want := s.Inject(AnyOp, "a", start), syscall.Errno(0); got != want {
+			t.Errorf("fail (%s) Inject() before Start() = %d, want %d", c.desc, got, want)
+		}
+		s.Start(start)
+		for _, i := range c.injections {
+			if got, want := s.Inject(i.op, i.path, start.Add(i.at)), i.want; got != want {
+				t.Errorf("fail (%s) Inject(%s, %q) at %s = %d, want %d", c.desc, i.op, i.path, i.at, got, want)
+			}
+		}
+	}
+}
+
+func TestNewSchedule_Invalid(t *testing.T) {
+	cases := []ScheduledFault{
+		{At: -time.Second, Errno: syscall.EIO},
+		{Duration: -time.Second, Errno: syscall.EIO},
+		{Count: -1, Errno: syscall.EIO},
+		{AfterBytes: -1, Errno: syscall.EIO},
+		{Partial: true, Errno: syscall.EIO},
+		{Op: ReadOp, Partial: true},
+		{},
+	}
+
+	for _, c := range cases {
+		if _, err := NewSchedule([]ScheduledFault{c}); err == nil {
+			t.Errorf("NewSchedule(%+v) = _, nil, want error", c)
+		}
+	}
+}
+
+func TestParseScheduleFromJSON(t *testing.T) {
+	cases := []struct {
+		desc      string
+		data      string
+		shouldErr bool
+	}{
+		{"array", `[{"At": "10s", "Op": "write", "Path": "db/*", "Error": "EIO", "Count": 3},
+			{"At": "1m", "Op": "fsync", "Error": "ENOSPC", "Duration": "30s"}]`, false},
+		{"lines", "{\"At\": \"10s\", \"Error\": \"EIO\"}\n\n{\"At\": \"0s\", \"Op\": \"open\", \"Error\": \"EACCES\"}\n", false},
+		{"empty", "", false},
+		{"unknown field", `[{"At": "1s", "Error": "EIO", "Errno": 5}]`, true},
+		{"bad duration", `[{"At": "soon", "Error": "EIO"}]`, true},
+		{"bad op", `{"At": "1s", "Op": "seek", "Error": "EIO"}`, true},
+		{"bad error", `{"At": "1s", "Error": "EOOPS"}`, true},
+		{"missing error", `{"At": "1s"}`, true},
+		{"partial", `{"At": "1s", "Op": "write", "Partial": true, "AfterBytes": "1MB"}`, false},
+		{"partial with error", `{"At": "1s", "Op": "write", "Partial": true, "Error": "EIO"}`, true},
+		{"bad bytes", `{"At": "1s", "Error": "ENOSPC", "AfterBytes": "lots"}`, true},
+		{"bad json", `{"At": `, true},
+	}
+
+	for _, c := range cases {
+		_, err := ParseScheduleFromJSON([]byte(c.data))
+		if c.shouldErr != (err != nil) {
+			t.Errorf("fail (%s) ParseScheduleFromJSON() = _, %v, want error %t", c.desc, err, c.shouldErr)
+		}
+	}
+}
+
+func TestParseScheduleFromJSON_Inject(t *testing.T) {
+	s, err := ParseScheduleFromJSON([]byte(`[{"At": "1s", "Op": "write", "Path": "db/*", "Error": "EIO"}]`))
+	if err != nil {
+		t.Fatalf("ParseScheduleFromJSON() = _, %s", err)
+	}
+	start := time.Unix(1000, 0)
+	s.Start(start)
+	if got, want := s.Inject(WriteOp, "db/x/y", start.Add(time.Second)), syscall.EIO; got != want {
+		t.Errorf("Inject(WriteOp, \"db/x/y\") = %d, want %d", got, want)
+	}
+}
+
+func TestSchedule_Add(t *testing.T) {
+	s, err := NewSchedule(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1000, 0)
+	f := ScheduledFault{At: time.Second, Op: ReadOp, Errno: syscall.EIO}
+	if err := s.Add(f, start); err == nil {
+		t.Errorf("Add() before Start() = nil, want error")
+	}
+
+	s.Start(start)
+	if err := s.Add(ScheduledFault{}, start); err == nil {
+		t.Errorf("Add() of invalid fault = nil, want error")
+	}
+	if err := s.Add(f, start.Add(time.Minute)); err != nil {
+		t.Fatalf("Add() = %s", err)
+	}
+	if got, want := s.Inject(ReadOp, "a", start.Add(time.Minute)), syscall.Errno(0); got != want {
+		t.Errorf("Inject() before fault = %d, want %d", got, want)
+	}
+	if got, want := s.Inject(ReadOp, "a", start.Add(time.Minute+time.Second)), syscall.EIO; got != want {
+		t.Errorf("Inject() after fault = %d, want %d", got, want)
+	}
+}
+
+func TestSchedule_InjectWrite(t *testing.T) {
+	type write struct {
+		path                 string
+		n                    units.NumBytes
+		wantWritten          units.NumBytes
+		wantErrno            syscall.Errno
+		wantFsync, wantWrite syscall.Errno
+	}
+	cases := []struct {
+		desc   string
+		faults []ScheduledFault
+		writes []write
+	}{
+		{
+			"partial",
+			[]ScheduledFault{{Op: WriteOp, Partial: true, Count: 1}},
+			[]write{
+				{"a", 1, 1, 0, 0, 0},
+				{"a", 10, 5, 0, 0, 0},
+				{"a", 10, 10, 0, 0, 0},
+			},
+		},
+		{
+			"after bytes",
+			[]ScheduledFault{{Op: FsyncOp, Path: "db/*", Errno: syscall.ENOSPC, AfterBytes: 15, Duration: time.Hour}},
+			[]write{
+				{"db/a", 10, 10, 0, 0, 0},
+				{"log", 10, 10, 0, 0, 0},
+				{"db/b", 10, 10, 0, syscall.ENOSPC, 0},
+			},
+		},
+		{
+			"failed writes don't count",
+			[]ScheduledFault{
+				{Op: WriteOp, Errno: syscall.EIO, Count: 1},
+				{Op: WriteOp, Errno: syscall.ENOSPC, AfterBytes: 10, Duration: time.Hour},
+			},
+			[]write{
+				{"a", 10, 0, syscall.EIO, 0, 0},
+				{"a", 5, 5, 0, 0, 0},
+				{"a", 5, 5, 0, 0, syscall.ENOSPC},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		s, err := NewSchedule(c.faults)
+		if err != nil {
+			t.Fatalf("fail (%s) NewSchedule() = _, %s", c.desc, err)
+		}
+		start := time.Unix(1000, 0)
+		if got, errno := s.InjectWrite("a", 10, start); got != 10 || errno != 0 {
+			t.Errorf("fail (%s) InjectWrite() before Start() = %d, %d, want 10, 0", c.desc, got, errno)
+		}
+		s.Start(start)
+		for _, w := range c.writes {
+			written, errno := s.InjectWrite(w.path, w.n, start)
+			if written != w.wantWritten || errno != w.wantErrno {
+				t.Errorf("fail (%s) InjectWrite(%q, %d) = %d, %d, want %d, %d", c.desc, w.path, w.n, written, errno, w.wantWritten, w.wantErrno)
+			}
+			if got, want := s.Inject(FsyncOp, w.path, start), w.wantFsync; got != want {
+				t.Errorf("fail (%s) Inject(FsyncOp, %q) after write = %d, want %d", c.desc, w.path, got, want)
+			}
+			if got, want := s.Inject(WriteOp, w.path, start), w.wantWrite; got != want {
+				t.Errorf("fail (%s) Inject(WriteOp, %q) after write = %d, want %d", c.desc, w.path, got, want)
+			}
+		}
+	}
+}
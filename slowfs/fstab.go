@@ -0,0 +1,143 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultFstabPath is where "slowfs mount" looks for mounts if not told otherwise.
+const DefaultFstabPath = "/etc/slowfstab"
+
+// FstabEntry is a single mount listed in an fstab style file.
+type FstabEntry struct {
+	// BackingDir is the directory to use as storage.
+	BackingDir string
+
+	// MountDir is the directory to mount at.
+	MountDir string
+
+	// ConfigName is the device config to mount with.
+	ConfigName string
+
+	// Options is the mount -o style options to mount with, such as "ro,noatime".
+	Options string
+
+	// Flags is the slowfs flags to mount with, given as name=value options, such as
+	// "--config-file=/etc/slowfs/devices.json".
+	Flags []string
+
+	// Auto is whether "slowfs mount -a" mounts the entry. It's cleared by the "noauto" option.
+	Auto bool
+}
+
+// ParseFstab parses an fstab style file. Each line lists a backing directory, a mount directory, a
+// device config name and optionally a comma separated list of options, separated by whitespace,
+// e.g.
+//
+//	/srv/db    /mnt/slowdb    hdd7200rpm    noatime,config-file=/etc/slowfs/devices.json
+//
+// Options of the form name=value are passed on as slowfs flags, and the rest must be mount -o
+// style options. Blank lines and lines starting with # are ignored, and, as in fstab, spaces
+// within paths are written \040.
+func ParseFstab(r io.Reader) ([]*FstabEntry, error) {
+	var entries []*FstabEntry
+	mountDirs := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseFstabLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		if mountDirs[entry.MountDir] {
+			return nil, fmt.Errorf("line %d: %s is already listed", lineNumber, entry.MountDir)
+		}
+		mountDirs[entry.MountDir] = true
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func parseFstabLine(line string) (*FstabEntry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields) > 4 {
+		return nil, fmt.Errorf("want backing directory, mount directory, config name and options, got %d fields", len(fields))
+	}
+	for i, f := range fields {
+		fields[i] = strings.Replace(f, `\040`, " ", -1)
+	}
+	entry := &FstabEntry{
+		BackingDir: filepath.Clean(fields[0]),
+		MountDir:   filepath.Clean(fields[1]),
+		ConfigName: fields[2],
+		Auto:       true,
+	}
+	if !filepath.IsAbs(entry.BackingDir) || !filepath.IsAbs(entry.MountDir) {
+		return nil, fmt.Errorf("directories must be absolute")
+	}
+	if len(fields) < 4 {
+		return entry, nil
+	}
+
+	var options []string
+	for _, o := range strings.Split(fields[3], ",") {
+		switch {
+		case o == "noauto":
+			entry.Auto = false
+		case o == "auto":
+			entry.Auto = true
+		case strings.Contains(o, "=") && !strings.HasPrefix(o, "x-"):
+			entry.Flags = append(entry.Flags, "--"+o)
+		default:
+			options = append(options, o)
+		}
+	}
+	entry.Options = strings.Join(options, ",")
+	if _, err := ParseMountOptionsFromString(entry.Options); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// LoadFstabFromFile parses the fstab style file at path.
+func LoadFstabFromFile(path string) ([]*FstabEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseFstab(f)
+}
+
+// Args returns the arguments to run slowfs with to mount the entry.
+func (e *FstabEntry) Args() []string {
+	args := []string{"--backing-dir=" + e.BackingDir, "--mount-dir=" + e.MountDir, "--config-name=" + e.ConfigName}
+	if e.Options != "" {
+		args = append(args, "-o="+e.Options)
+	}
+	return append(args, e.Flags...)
+}
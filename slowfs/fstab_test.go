@@ -0,0 +1,72 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFstab(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      []*FstabEntry
+		shouldErr bool
+	}{
+		{"", nil, false},
+		{"# comment\n\n  /srv/db  /mnt/db/  ssd\n", []*FstabEntry{
+			{BackingDir: "/srv/db", MountDir: "/mnt/db", ConfigName: "ssd", Auto: true},
+		}, false},
+		{"/srv/a /mnt/a hdd7200rpm ro,noatime,config-file=/etc/devices.json,op-timeout=5s,x-owner=ci\n" +
+			`/srv/my\040b /mnt/b nfs noauto`, []*FstabEntry{
+			{
+				BackingDir: "/srv/a",
+				MountDir:   "/mnt/a",
+				ConfigName: "hdd7200rpm",
+				Options:    "ro,noatime,x-owner=ci",
+				Flags:      []string{"--config-file=/etc/devices.json", "--op-timeout=5s"},
+				Auto:       true,
+			},
+			{BackingDir: "/srv/my b", MountDir: "/mnt/b", ConfigName: "nfs"},
+		}, false},
+		{"/srv/a /mnt/a", nil, true},
+		{"/srv/a /mnt/a ssd ro extra", nil, true},
+		{"srv/a /mnt/a ssd", nil, true},
+		{"/srv/a /mnt/a ssd bogus", nil, true},
+		{"/srv/a /mnt/a ssd\n/srv/b /mnt/a ssd", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseFstab(strings.NewReader(c.s))
+		if !reflect.DeepEqual(got, c.want) || c.shouldErr != (err != nil) {
+			t.Errorf("ParseFstab(%q) = %+v, %v, want %+v, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestFstabEntry_Args(t *testing.T) {
+	e := &FstabEntry{
+		BackingDir: "/srv/a",
+		MountDir:   "/mnt/a",
+		ConfigName: "ssd",
+		Options:    "ro",
+		Flags:      []string{"--op-timeout=5s"},
+	}
+	got, want := e.Args(), []string{"--backing-dir=/srv/a", "--mount-dir=/mnt/a", "--config-name=ssd", "-o=ro", "--op-timeout=5s"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+)
+
+// Modes of fallocate, from linux/falloc.h, which the syscall package doesn't have. The mode is
+// passed to the backing file unchanged, so these only decide how the operation is charged.
+const (
+	fallocKeepSize    = 0x01
+	fallocPunchHole   = 0x02
+	fallocZeroRange   = 0x10
+	fallocWriteZeroes = 0x80
+)
+
+// allocateRequest returns the request for a fallocate of size bytes at off with mode. Punching a
+// hole only changes metadata, zeroing a range allocates it, like plain fallocate, and writing zeroes
+// writes them out to the device.
+func allocateRequest(off uint64, size uint64, mode uint32) *scheduler.Request {
+	req := &scheduler.Request{
+		Type:  scheduler.AllocateRequest,
+		Start: units.NumBytes(off),
+		Size:  units.NumBytes(size),
+	}
+	switch {
+	case mode&fallocPunchHole != 0:
+		req.Type = scheduler.PunchHoleRequest
+	case mode&fallocZeroRange != 0:
+		req.Type = scheduler.ZeroRangeRequest
+	case mode&fallocWriteZeroes != 0:
+		req.Type = scheduler.WriteRequest
+		req.Direct = true
+	}
+	return req
+}
+
+// allocateGrows returns whether a fallocate with mode may make the file longer, which it doesn't
+// with FALLOC_FL_KEEP_SIZE, as punching holes requires.
+func allocateGrows(mode uint32) bool {
+	return mode&(fallocKeepSize|fallocPunchHole) == 0
+}
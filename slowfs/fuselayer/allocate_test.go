@@ -0,0 +1,52 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/scheduler"
+	"testing"
+)
+
+func TestAllocateRequest(t *testing.T) {
+	cases := []struct {
+		mode       uint32
+		wantType   scheduler.RequestType
+		wantDirect bool
+		wantGrows  bool
+	}{
+		{0, scheduler.AllocateRequest, false, true},
+		{fallocKeepSize, scheduler.AllocateRequest, false, false},
+		{fallocPunchHole | fallocKeepSize, scheduler.PunchHoleRequest, false, false},
+		{fallocZeroRange, scheduler.ZeroRangeRequest, false, true},
+		{fallocZeroRange | fallocKeepSize, scheduler.ZeroRangeRequest, false, false},
+		{fallocWriteZeroes, scheduler.WriteRequest, true, true},
+	}
+
+	for _, c := range cases {
+		req := allocateRequest(10, 20, c.mode)
+		if got, want := req.Type, c.wantType; got != want {
+			t.Errorf("allocateRequest(10, 20, %#x).Type = %s, want %s", c.mode, got, want)
+		}
+		if got, want := req.Direct, c.wantDirect; got != want {
+			t.Errorf("allocateRequest(10, 20, %#x).Direct = %t, want %t", c.mode, got, want)
+		}
+		if req.Start != 10 || req.Size != 20 {
+			t.Errorf("allocateRequest(10, 20, %#x) = [%d+%d], want [10+20]", c.mode, req.Start, req.Size)
+		}
+		if got, want := allocateGrows(c.mode), c.wantGrows; got != want {
+			t.Errorf("allocateGrows(%#x) = %t, want %t", c.mode, got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"slowfs/slowfs/units"
+
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// OnMount records the PathNodeFs serving this filesystem, so that the kernel can later be told
+// about changes.
+func (sfs *SlowFs) OnMount(nodeFs *pathfs.PathNodeFs) {
+	sfs.nodeFsMu.Lock()
+	sfs.nodeFs = nodeFs
+	sfs.nodeFsMu.Unlock()
+	sfs.FileSystem.OnMount(nodeFs)
+}
+
+// DropCaches discards the simulated clean cached state of every simulated device, so that
+// experiments can start from a cold cache.
+func (sfs *SlowFs) DropCaches() {
+	sfs.scheduler.DropCaches()
+	for _, r := range sfs.routes {
+		r.scheduler.DropCaches()
+	}
+}
+
+// InvalidateKernelCache asks the kernel to drop the data and attributes it has cached for every
+// file in the mount, like echoing into /proc/sys/vm/drop_caches but only for this filesystem.
+func (sfs *SlowFs) InvalidateKernelCache() error {
+	sfs.nodeFsMu.Lock()
+	nodeFs := sfs.nodeFs
+	sfs.nodeFsMu.Unlock()
+	if nodeFs == nil {
+		return errors.New("filesystem is not mounted")
+	}
+
+	return filepath.Walk(sfs.root, func(path string, info os.FileInfo, err error) error {
+		// Files can disappear while we walk, and that's fine.
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(sfs.root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			rel = ""
+		}
+		// The kernel may not have anything cached for the path, which isn't an error.
+		nodeFs.Notify(rel)
+		return nil
+	})
+}
+
+// WarmCache marks the files at the given paths, relative to the root of the mount, as cached by
+// their simulated devices. Directories are warmed recursively. It returns the paths of the files
+// warmed, so that callers can also warm the kernel's cache by reading them through the mount.
+func (sfs *SlowFs) WarmCache(paths []string) ([]string, error) {
+	var warmed []string
+	for _, p := range paths {
+		p = strings.Trim(filepath.Clean(p), "/")
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return warmed, fmt.Errorf("path %s is outside the mount", p)
+		}
+
+		err := filepath.Walk(filepath.Join(sfs.root, p), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(sfs.root, path)
+			if err != nil {
+				return err
+			}
+			sfs.schedulerFor(rel).WarmCache(rel, units.NumBytes(info.Size()))
+			warmed = append(warmed, rel)
+			return nil
+		})
+		if err != nil {
+			return warmed, err
+		}
+	}
+	return warmed, nil
+}
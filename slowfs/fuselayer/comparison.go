@@ -0,0 +1,128 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"io"
+	"slowfs/slowfs/scheduler"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// OpTime is how many operations of some type completed, and how long they took in total, measured
+// from when slowfs received them to when it returned, including the backing directory's time.
+type OpTime struct {
+	Count int64
+	Total time.Duration
+}
+
+// Mean returns how long an operation took on average, or 0 if there were none.
+func (t OpTime) Mean() time.Duration {
+	if t.Count == 0 {
+		return 0
+	}
+	return t.Total / time.Duration(t.Count)
+}
+
+// opTimes accumulates OpTimes for each request type.
+type opTimes struct {
+	mu    sync.Mutex
+	times map[scheduler.RequestType]OpTime
+}
+
+func (o *opTimes) record(t scheduler.RequestType, d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.times == nil {
+		o.times = make(map[scheduler.RequestType]OpTime)
+	}
+	ot := o.times[t]
+	ot.Count++
+	ot.Total += d
+	o.times[t] = ot
+}
+
+// take returns the times accumulated so far, and starts accumulating afresh.
+func (o *opTimes) take() map[scheduler.RequestType]OpTime {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	times := o.times
+	o.times = nil
+	if times == nil {
+		times = make(map[scheduler.RequestType]OpTime)
+	}
+	return times
+}
+
+// SetPassthrough makes operations complete as soon as the backing directory is done with them,
+// without consulting the simulated device at all, or restores the simulation. Faults are still
+// injected. Comparing runs with and without passthrough shows how much of an application's
+// slowness comes from the simulation.
+func (sfs *SlowFs) SetPassthrough(passthrough bool) {
+	var v int32
+	if passthrough {
+		v = 1
+	}
+	atomic.StoreInt32(&sfs.passthrough, v)
+}
+
+func (sfs *SlowFs) isPassthrough() bool {
+	return atomic.LoadInt32(&sfs.passthrough) != 0
+}
+
+// TakeOpTimes returns how long operations of each type took since the last call, or since the
+// filesystem was created.
+func (sfs *SlowFs) TakeOpTimes() map[scheduler.RequestType]OpTime {
+	return sfs.opTimes.take()
+}
+
+// RunTimes is how long a run of a workload took, in total and for each type of operation.
+type RunTimes struct {
+	Wall time.Duration
+	Ops  map[scheduler.RequestType]OpTime
+}
+
+// Comparison compares a run of a workload in passthrough mode with a run of it simulated.
+type Comparison struct {
+	Passthrough RunTimes
+	Simulated   RunTimes
+}
+
+// WriteReport writes a table of how many times slower each type of operation, and the workload as a
+// whole, was when simulated.
+func (c *Comparison) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "op\tcount\tpassthrough mean\tsimulated mean\tslowdown\n")
+	for t := scheduler.ReadRequest; t <= scheduler.JournalCommitRequest; t++ {
+		p, s := c.Passthrough.Ops[t], c.Simulated.Ops[t]
+		if p.Count == 0 && s.Count == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", t, s.Count, p.Mean(), s.Mean(), slowdown(p.Mean(), s.Mean()))
+	}
+	fmt.Fprintf(tw, "total\t\t%s\t%s\t%s\n", c.Passthrough.Wall, c.Simulated.Wall, slowdown(c.Passthrough.Wall, c.Simulated.Wall))
+	return tw.Flush()
+}
+
+// slowdown formats how many times longer simulated is than passthrough.
+func slowdown(passthrough, simulated time.Duration) string {
+	if passthrough <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fx", float64(simulated)/float64(passthrough))
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"bytes"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"testing"
+	"time"
+)
+
+func TestSlowFs_Passthrough(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	config.MetadataOpTime = 20 * time.Millisecond
+	sfs := NewSlowFs("", scheduler.New(&config))
+
+	sfs.SetPassthrough(true)
+	start := time.Now()
+	sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: start, Path: "a"})
+	if got, limit := time.Since(start), config.MetadataOpTime; got >= limit {
+		t.Errorf("passthrough operation took %s, want less than %s", got, limit)
+	}
+	if got, want := sfs.TakeOpTimes()[scheduler.MetadataRequest].Count, int64(1); got != want {
+		t.Errorf("passthrough MetadataRequest count = %d, want %d", got, want)
+	}
+
+	sfs.SetPassthrough(false)
+	sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Now(), Path: "a"})
+	got := sfs.TakeOpTimes()[scheduler.MetadataRequest]
+	if got.Count != 1 || got.Total < config.MetadataOpTime {
+		t.Errorf("simulated MetadataRequest times = %+v, want 1 taking at least %s", got, config.MetadataOpTime)
+	}
+	if got, want := len(sfs.TakeOpTimes()), 0; got != want {
+		t.Errorf("len(TakeOpTimes()) after taking = %d, want %d", got, want)
+	}
+}
+
+func TestComparison_WriteReport(t *testing.T) {
+	c := &Comparison{
+		Passthrough: RunTimes{
+			Wall: time.Second,
+			Ops: map[scheduler.RequestType]OpTime{
+				scheduler.ReadRequest:     {Count: 2, Total: 2 * time.Millisecond},
+				scheduler.MetadataRequest: {Count: 4, Total: 0},
+			},
+		},
+		Simulated: RunTimes{
+			Wall: 5 * time.Second,
+			Ops: map[scheduler.RequestType]OpTime{
+				scheduler.ReadRequest:     {Count: 2, Total: 20 * time.Millisecond},
+				scheduler.MetadataRequest: {Count: 4, Total: 4 * time.Millisecond},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := c.WriteReport(&buf); err != nil {
+		t.Fatalf("WriteReport() = %s, want nil", err)
+	}
+	want := `op               count  passthrough mean  simulated mean  slowdown
+ReadRequest      2      1ms               10ms            10.00x
+MetadataRequest  4      0s                1ms             -
+total                   1s                5s              5.00x
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteReport() wrote\n%s\nwant\n%s", got, want)
+	}
+}
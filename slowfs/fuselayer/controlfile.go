@@ -0,0 +1,173 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"bytes"
+	"fmt"
+	"slowfs/slowfs/control"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+// ControlFileName is the name of a virtual file in the root of the mount which runs control API
+// commands written to it, one per line as in the interactive shell, for programs which can't reach
+// the control API. Replies are read back from the start of the same open file. Like the stats
+// file, it doesn't exist in the backing directory, isn't listed, and takes no simulated time.
+const ControlFileName = ".slowfs_control"
+
+// SetControlServer makes the control file run commands with server, as the user who opened it, so
+// that the server's policy applies as for callers over a Unix socket. Without a server there is
+// no control file. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetControlServer(server *control.Server) {
+	sfs.controlServer = server
+}
+
+func (sfs *SlowFs) isControlFile(name string) bool {
+	return sfs.controlServer != nil && name == ControlFileName
+}
+
+func (sfs *SlowFs) controlFileAttr() *fuse.Attr {
+	attr := &fuse.Attr{
+		Mode: syscall.S_IFREG | 0666,
+	}
+	now := time.Now()
+	attr.SetTimes(&now, &now, &now)
+	return attr
+}
+
+func (sfs *SlowFs) openControlFile(context *fuse.Context) (nodefs.File, fuse.Status) {
+	caller := control.Caller{}
+	if context != nil {
+		caller.UID, caller.HasUID = int(context.Uid), true
+	}
+	// Replies change with every command, so bypass the kernel's page cache.
+	return &nodefs.WithFlags{
+		File:      newControlFile(sfs.controlServer, caller),
+		FuseFlags: fuse.FOPEN_DIRECT_IO,
+	}, fuse.OK
+}
+
+// controlFile runs the commands written to it, and serves their replies.
+type controlFile struct {
+	nodefs.File
+	server *control.Server
+	caller control.Caller
+
+	mu sync.Mutex
+	// What has been written after the last complete line.
+	partial []byte
+	replies []byte
+}
+
+func newControlFile(server *control.Server, caller control.Caller) *controlFile {
+	return &controlFile{
+		File:   nodefs.NewDefaultFile(),
+		server: server,
+		caller: caller,
+	}
+}
+
+// Write runs each complete line written. If a command fails, the write fails with the error the
+// control API reported it with.
+func (f *controlFile) Write(data []byte, off int64) (uint32, fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.partial = append(f.partial, data...)
+	status := fuse.OK
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(f.partial[:i])
+		f.partial = f.partial[i+1:]
+		if s := f.run(line); s != fuse.OK {
+			status = s
+		}
+	}
+	if status != fuse.OK {
+		return 0, status
+	}
+	return uint32(len(data)), fuse.OK
+}
+
+// Flush runs the last line, if it wasn't terminated by a newline.
+func (f *controlFile) Flush() fuse.Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	line := string(f.partial)
+	f.partial = nil
+	return f.run(line)
+}
+
+// run runs a command line, and adds its reply to the replies.
+func (f *controlFile) run(line string) fuse.Status {
+	name, args, err := control.ParseLine(line)
+	if err != nil {
+		f.replies = append(f.replies, fmt.Sprintf("error: %s\n", err)...)
+		return fuse.EINVAL
+	}
+	if name == "" {
+		return fuse.OK
+	}
+	out, err := f.server.Run(f.caller, name, args)
+	if err != nil {
+		f.replies = append(f.replies, fmt.Sprintf("error: %s\n", err)...)
+		return controlErrorStatus(err.(*control.Error))
+	}
+	f.replies = append(f.replies, out...)
+	return fuse.OK
+}
+
+// controlErrorStatus returns the status a command failing with err fails writes with.
+func controlErrorStatus(err *control.Error) fuse.Status {
+	switch err.Status {
+	case 403:
+		return fuse.EACCES
+	case 404:
+		return fuse.ENOENT
+	default:
+		return fuse.EINVAL
+	}
+}
+
+func (f *controlFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if off >= int64(len(f.replies)) {
+		return fuse.ReadResultData(nil), fuse.OK
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(f.replies)) {
+		end = int64(len(f.replies))
+	}
+	return fuse.ReadResultData(append([]byte(nil), f.replies[off:end]...)), fuse.OK
+}
+
+// Truncate accepts truncating the file when it's opened for writing, which doesn't affect replies.
+func (f *controlFile) Truncate(size uint64) fuse.Status {
+	return fuse.OK
+}
+
+func (f *controlFile) GetAttr(out *fuse.Attr) fuse.Status {
+	out.Mode = syscall.S_IFREG | 0666
+	out.Size = 0
+	return fuse.OK
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"errors"
+	"net/url"
+	"slowfs/slowfs/control"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestControlFile(t *testing.T) {
+	server := control.NewServer()
+	server.HandleCommand("echo", "replies with its argument", control.StatsRole, func(args url.Values) (string, error) {
+		return args.Get("text") + "\n", nil
+	})
+	server.HandleCommand("fail", "always fails", control.ConfigRole, func(args url.Values) (string, error) {
+		return "", errors.New("failed")
+	})
+	server.SetPolicy(&control.Policy{Grants: []control.Grant{{UID: 1000, Roles: control.StatsRole}}})
+
+	cases := []struct {
+		writes     []string
+		wantStatus fuse.Status
+		want       string
+	}{
+		{[]string{"echo text=hi\n"}, fuse.OK, "hi\n"},
+		// Lines may be split across writes, and the last needn't end in a newline.
+		{[]string{"echo te", "xt=a\necho text=b"}, fuse.OK, "a\nb\n"},
+		{[]string{"\n\n"}, fuse.OK, ""},
+		{[]string{"missing\n"}, fuse.ENOENT, "error: unknown command missing\n"},
+		{[]string{"fail\n"}, fuse.EACCES, "error: fail needs role config\n"},
+		{[]string{"echo hi\n"}, fuse.EINVAL, "error: argument \"hi\": want name=value\n"},
+	}
+
+	for _, c := range cases {
+		f := newControlFile(server, control.Caller{UID: 1000, HasUID: true})
+		status := fuse.OK
+		for _, w := range c.writes {
+			if _, s := f.Write([]byte(w), 0); s != fuse.OK {
+				status = s
+			}
+		}
+		if s := f.Flush(); s != fuse.OK {
+			status = s
+		}
+		if status != c.wantStatus {
+			t.Errorf("writing %q: status %v, want %v", c.writes, status, c.wantStatus)
+		}
+		if got, want := string(f.replies), c.want; got != want {
+			t.Errorf("writing %q: replies %q, want %q", c.writes, got, want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs"
+	"sync"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+type pendingWrite struct {
+	off  int64
+	data []byte
+}
+
+func (w *pendingWrite) end() int64 {
+	return w.off + int64(len(w.data))
+}
+
+// ctoFile gives a file close-to-open consistency, by holding writes back from the underlying file
+// until they are published. Reads through the same handle see its own writes.
+type ctoFile struct {
+	nodefs.File
+
+	// Whether fsync publishes writes as well as close.
+	publishOnFsync bool
+
+	mu      sync.Mutex
+	pending []pendingWrite
+}
+
+func newCtoFile(file nodefs.File, consistency slowfs.Consistency) nodefs.File {
+	return &ctoFile{
+		File:           file,
+		publishOnFsync: consistency == slowfs.CloseToOpenConsistency,
+	}
+}
+
+// publish writes all pending writes to the underlying file. The caller must hold mu.
+func (f *ctoFile) publish() fuse.Status {
+	for len(f.pending) > 0 {
+		w := f.pending[0]
+		if _, status := f.File.Write(w.data, w.off); status != fuse.OK {
+			return status
+		}
+		f.pending = f.pending[1:]
+	}
+	return fuse.OK
+}
+
+// Write holds the data back until it is published.
+func (f *ctoFile) Write(data []byte, off int64) (uint32, fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// go-fuse reuses data's buffer once we return.
+	f.pending = append(f.pending, pendingWrite{off: off, data: append([]byte(nil), data...)})
+	return uint32(len(data)), fuse.OK
+}
+
+// Read reads from the underlying file, and then applies this handle's pending writes on top.
+func (f *ctoFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r, status := f.File.Read(dest, off)
+	if status != fuse.OK || len(f.pending) == 0 {
+		return r, status
+	}
+
+	data, status := r.Bytes(make([]byte, len(dest)))
+	if status != fuse.OK {
+		return nil, status
+	}
+	buf := make([]byte, len(dest))
+	n := overlayPendingWrites(buf, copy(buf, data), off, f.pending)
+	return fuse.ReadResultData(buf[:n]), fuse.OK
+}
+
+// overlayPendingWrites copies the parts of pending which fall within buf, which holds n bytes read
+// from offset off, into buf. It returns how many bytes of buf are now valid.
+func overlayPendingWrites(buf []byte, n int, off int64, pending []pendingWrite) int {
+	bufEnd := off + int64(len(buf))
+	for _, w := range pending {
+		start, end := w.off, w.end()
+		if start < off {
+			start = off
+		}
+		if end > bufEnd {
+			end = bufEnd
+		}
+		if start >= end {
+			continue
+		}
+		copy(buf[start-off:end-off], w.data[start-w.off:])
+		if int(end-off) > n {
+			n = int(end - off)
+		}
+	}
+	return n
+}
+
+// GetAttr reports the size including this handle's pending writes.
+func (f *ctoFile) GetAttr(out *fuse.Attr) fuse.Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := f.File.GetAttr(out)
+	if status != fuse.OK {
+		return status
+	}
+	for _, w := range f.pending {
+		if end := uint64(w.end()); end > out.Size {
+			out.Size = end
+		}
+	}
+	return fuse.OK
+}
+
+// Flush publishes pending writes, since it happens whenever a file descriptor is closed.
+func (f *ctoFile) Flush() fuse.Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if status := f.publish(); status != fuse.OK {
+		return status
+	}
+	return f.File.Flush()
+}
+
+func (f *ctoFile) Fsync(flags int) fuse.Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.publishOnFsync {
+		if status := f.publish(); status != fuse.OK {
+			return status
+		}
+	}
+	return f.File.Fsync(flags)
+}
+
+// Truncate publishes pending writes first, so that they are truncated too.
+func (f *ctoFile) Truncate(size uint64) fuse.Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if status := f.publish(); status != fuse.OK {
+		return status
+	}
+	return f.File.Truncate(size)
+}
+
+// Allocate publishes pending writes first, so that they are ordered before the allocation.
+func (f *ctoFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if status := f.publish(); status != fuse.OK {
+		return status
+	}
+	return f.File.Allocate(off, size, mode)
+}
+
+// Release publishes anything left, in case the file was never flushed.
+func (f *ctoFile) Release() {
+	f.mu.Lock()
+	f.publish()
+	f.mu.Unlock()
+	f.File.Release()
+}
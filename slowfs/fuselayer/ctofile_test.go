@@ -0,0 +1,47 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"testing"
+)
+
+func TestOverlayPendingWrites(t *testing.T) {
+	cases := []struct {
+		desc    string
+		read    string
+		size    int
+		off     int64
+		pending []pendingWrite
+		want    string
+	}{
+		{"nothing pending", "hello", 5, 0, nil, "hello"},
+		{"inside", "hello", 5, 0, []pendingWrite{{1, []byte("EL")}}, "hELlo"},
+		{"offset read", "llo", 3, 2, []pendingWrite{{1, []byte("EL")}}, "Llo"},
+		{"before read", "llo", 3, 2, []pendingWrite{{0, []byte("HE")}}, "llo"},
+		{"extends file", "hel", 5, 0, []pendingWrite{{2, []byte("LLO")}}, "heLLO"},
+		{"past buffer", "hello", 5, 0, []pendingWrite{{3, []byte("LO world")}}, "helLO"},
+		{"hole", "", 4, 0, []pendingWrite{{2, []byte("xy")}}, "\x00\x00xy"},
+		{"later wins", "hello", 5, 0, []pendingWrite{{0, []byte("ab")}, {1, []byte("c")}}, "acllo"},
+	}
+
+	for _, c := range cases {
+		buf := make([]byte, c.size)
+		n := overlayPendingWrites(buf, copy(buf, c.read), c.off, c.pending)
+		if got, want := string(buf[:n]), c.want; got != want {
+			t.Errorf("fail (%s) overlayPendingWrites() = %q, want %q", c.desc, got, want)
+		}
+	}
+}
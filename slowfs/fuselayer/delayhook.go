@@ -0,0 +1,37 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/scheduler"
+	"time"
+)
+
+// DelayHook is called once slowfs has finished delaying an operation's request, with how long it
+// actually held the operation back after the backing directory was done with it. This can be less
+// than the request's cost, when the backing directory was slow, or more, when timers fire late.
+type DelayHook func(req *scheduler.Request, delay time.Duration)
+
+// AddDelayHook registers a hook to be called after each operation is delayed. This must be called
+// before the filesystem is mounted.
+func (sfs *SlowFs) AddDelayHook(hook DelayHook) {
+	sfs.delayHooks = append(sfs.delayHooks, hook)
+}
+
+func (sfs *SlowFs) runDelayHooks(req *scheduler.Request, delay time.Duration) {
+	for _, hook := range sfs.delayHooks {
+		hook(req, delay)
+	}
+}
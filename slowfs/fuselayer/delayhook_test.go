@@ -0,0 +1,44 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"testing"
+	"time"
+)
+
+func TestSlowFs_DelayHook(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	config.MetadataOpTime = 5 * time.Millisecond
+	sfs := NewSlowFs("", scheduler.New(&config))
+
+	var gotReq *scheduler.Request
+	var gotDelay time.Duration
+	sfs.AddDelayHook(func(req *scheduler.Request, delay time.Duration) {
+		gotReq, gotDelay = req, delay
+	})
+
+	// The operation started a while ago, so only the rest of its time is left to wait.
+	req := &scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Now().Add(-2 * time.Millisecond), Path: "a"}
+	sfs.wait(req)
+	if gotReq != req {
+		t.Fatalf("hook called with %+v, want %+v", gotReq, req)
+	}
+	if gotDelay < time.Millisecond || gotDelay > 5*time.Millisecond {
+		t.Errorf("hook called with delay %s, want about 3ms", gotDelay)
+	}
+}
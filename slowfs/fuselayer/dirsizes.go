@@ -0,0 +1,168 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dirSizes remembers how many entries each directory has, so that devices with a
+// DirectoryEntryTime can charge for scanning them. Directories are counted in the backing directory
+// the first time they're needed, then kept up to date as entries are added and removed, and counted
+// afresh whenever they're listed.
+type dirSizes struct {
+	mu      sync.Mutex
+	entries map[string]int64
+}
+
+// get returns how many entries dir has, and whether it is known.
+func (d *dirSizes) get(dir string) (int64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n, ok := d.entries[dir]
+	return n, ok
+}
+
+// set remembers that dir has n entries.
+func (d *dirSizes) set(dir string, n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entries == nil {
+		d.entries = make(map[string]int64)
+	}
+	d.entries[dir] = n
+}
+
+// add adds delta to how many entries dir has, if it is known, and returns how many it had before.
+func (d *dirSizes) add(dir string, delta int64) (int64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n, ok := d.entries[dir]
+	if ok {
+		d.entries[dir] = n + delta
+	}
+	return n, ok
+}
+
+// forget drops what is remembered about dir and every directory in it, once it's been removed or
+// renamed.
+func (d *dirSizes) forget(dir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for p := range d.entries {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			delete(d.entries, p)
+		}
+	}
+}
+
+// SetCountEntries makes requests carry how many entries the directories they scan have, for devices
+// whose directory operations take longer the larger the directory. This must be called before the
+// filesystem is mounted.
+func (sfs *SlowFs) SetCountEntries(count bool) {
+	sfs.countEntries = count
+}
+
+// dirEntries returns how many entries dir has, counting them in the backing directory if they
+// aren't known yet. It returns zero if entries aren't counted, or dir can't be read.
+func (sfs *SlowFs) dirEntries(dir string) int64 {
+	if !sfs.countEntries {
+		return 0
+	}
+	if n, ok := sfs.dirSizes.get(dir); ok {
+		return n
+	}
+	n, err := countEntries(filepath.Join(sfs.root, dir))
+	if err != nil {
+		return 0
+	}
+	sfs.dirSizes.set(dir, n)
+	return n
+}
+
+// parentEntries returns how many entries the directory containing name had before delta entries
+// were added to it, once an entry has been added or removed there, or zero for the root.
+func (sfs *SlowFs) parentEntries(name string, delta int64) int64 {
+	if !sfs.countEntries || name == "" {
+		return 0
+	}
+	dir := parentDir(name)
+	if n, ok := sfs.dirSizes.add(dir, delta); ok {
+		return n
+	}
+	// Counting now sees the change already made.
+	return sfs.dirEntries(dir) - delta
+}
+
+// renameEntries returns how many entries renaming oldName to newName removes from oldName's
+// directory and adds to newName's. It must be called before the rename. Renaming over an entry
+// replaces it, adding none, and renaming onto another link to the same file changes nothing.
+func (sfs *SlowFs) renameEntries(oldName, newName string) (removed, added int64) {
+	if !sfs.countEntries {
+		return 1, 1
+	}
+	newInfo, err := os.Lstat(filepath.Join(sfs.root, newName))
+	if err != nil {
+		return 1, 1
+	}
+	oldInfo, err := os.Lstat(filepath.Join(sfs.root, oldName))
+	if err == nil && os.SameFile(oldInfo, newInfo) {
+		return 0, 0
+	}
+	return 1, 0
+}
+
+// listedEntries remembers that the directory name was just listed with n entries, and returns n.
+func (sfs *SlowFs) listedEntries(name string, n int) int64 {
+	if !sfs.countEntries {
+		return 0
+	}
+	sfs.dirSizes.set(name, int64(n))
+	return int64(n)
+}
+
+// parentDir returns the directory containing name, which is "" for the root.
+func parentDir(name string) string {
+	dir := filepath.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// countEntries counts the entries of the directory at path, a batch at a time so that huge
+// directories aren't read into memory at once.
+func countEntries(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var n int64
+	for {
+		names, err := f.Readdirnames(1024)
+		n += int64(len(names))
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
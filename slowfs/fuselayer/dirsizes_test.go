@@ -0,0 +1,127 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_DirEntries(t *testing.T) {
+	root, err := ioutil.TempDir("", "dirsizes_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "d"), 0755); err != nil {
+		t.Fatalf("Mkdir error: %s", err)
+	}
+	for i := 0; i < 3000; i++ {
+		if err := ioutil.WriteFile(filepath.Join(root, "d", fmt.Sprint(i)), nil, 0644); err != nil {
+			t.Fatalf("WriteFile error: %s", err)
+		}
+	}
+
+	sfs := &SlowFs{root: root}
+	if got, want := sfs.parentEntries("d/0", 0), int64(0); got != want {
+		t.Errorf("parentEntries() without counting = %d, want %d", got, want)
+	}
+
+	sfs.SetCountEntries(true)
+	if got, want := sfs.parentEntries("d/0", 0), int64(3000); got != want {
+		t.Errorf("parentEntries() = %d, want %d", got, want)
+	}
+	if got, want := sfs.parentEntries("d", 0), int64(1); got != want {
+		t.Errorf("parentEntries() of a top level entry = %d, want %d", got, want)
+	}
+	if got, want := sfs.parentEntries("", 0), int64(0); got != want {
+		t.Errorf("parentEntries() of the root = %d, want %d", got, want)
+	}
+
+	// Entries added and removed are counted without looking at the backing directory.
+	if got, want := sfs.parentEntries("d/new", 1), int64(3000); got != want {
+		t.Errorf("parentEntries() adding an entry = %d, want %d", got, want)
+	}
+	if got, want := sfs.dirEntries("d"), int64(3001); got != want {
+		t.Errorf("dirEntries() after adding an entry = %d, want %d", got, want)
+	}
+	sfs.parentEntries("d/0", -1)
+	sfs.parentEntries("d/1", -1)
+	if got, want := sfs.dirEntries("d"), int64(2999); got != want {
+		t.Errorf("dirEntries() after removing entries = %d, want %d", got, want)
+	}
+
+	// Listing a directory counts it afresh.
+	if got, want := sfs.listedEntries("d", 3000), int64(3000); got != want {
+		t.Errorf("listedEntries() = %d, want %d", got, want)
+	}
+	if got, want := sfs.dirEntries("d"), int64(3000); got != want {
+		t.Errorf("dirEntries() after listing = %d, want %d", got, want)
+	}
+
+	// Forgotten directories are counted again when they're next needed.
+	sfs.dirSizes.forget("d")
+	if _, ok := sfs.dirSizes.get("d"); ok {
+		t.Errorf("dirSizes.get() after forget() found it, want not")
+	}
+	if got, want := sfs.dirEntries("d"), int64(3000); got != want {
+		t.Errorf("dirEntries() after forget() = %d, want %d", got, want)
+	}
+
+	// Directories which can't be read have no known size.
+	if got, want := sfs.dirEntries("missing"), int64(0); got != want {
+		t.Errorf("dirEntries() of a missing directory = %d, want %d", got, want)
+	}
+}
+
+func TestSlowFs_RenameEntries(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	sfs.SetCountEntries(true)
+	if status := sfs.Mkdir("d", 0755, nil); status != fuse.OK {
+		t.Fatalf("Mkdir() = %v, want OK", status)
+	}
+	for _, name := range []string{"a", "d/b", "d/c"} {
+		createFile(t, sfs, name, nil)
+	}
+	if got, want := sfs.dirEntries("d"), int64(2); got != want {
+		t.Fatalf("dirEntries() = %d, want %d", got, want)
+	}
+
+	// Moving an entry into a directory adds one, but renaming over one replaces it.
+	cases := []struct {
+		oldName, newName string
+		root, d          int64
+	}{
+		{"a", "d/a", 1, 3},
+		{"d/a", "d/b", 1, 2},
+		{"d/b", "d/b", 1, 2},
+	}
+	for _, c := range cases {
+		if status := sfs.Rename(c.oldName, c.newName, nil); status != fuse.OK {
+			t.Fatalf("Rename(%s, %s) = %v, want OK", c.oldName, c.newName, status)
+		}
+		if got, want := sfs.dirEntries(""), c.root; got != want {
+			t.Errorf("dirEntries() of the root after Rename(%s, %s) = %d, want %d", c.oldName, c.newName, got, want)
+		}
+		if got, want := sfs.dirEntries("d"), c.d; got != want {
+			t.Errorf("dirEntries(d) after Rename(%s, %s) = %d, want %d", c.oldName, c.newName, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// driftGain is the fraction of each observed drift the compensation is corrected by. Small
+	// values keep one slow wakeup from throwing the compensation off, while still converging within
+	// a few dozen operations.
+	driftGain = 0.1
+
+	// maxDriftCompensation bounds how much earlier than modeled operations are woken, so that a
+	// stall of the whole host doesn't make every later operation complete early.
+	maxDriftCompensation = 5 * time.Millisecond
+)
+
+// DriftStats describes how far the latencies delivered to applications are from the modeled ones.
+// Drift is how much later than modeled operations actually completed, which is usually positive,
+// since timers fire late and threads take time to be scheduled, especially on busy machines.
+type DriftStats struct {
+	// Samples is how many operations were measured.
+	Samples int64
+	// Mean and Max are the mean and largest drift of the measured operations.
+	Mean, Max time.Duration
+	// Overruns is how many operations had already taken longer than modeled before they started
+	// waiting, like when the backing directory is slow, which compensation can't help.
+	Overruns int64
+	// Compensation is how much earlier than modeled operations are currently woken.
+	Compensation time.Duration
+}
+
+// driftCompensator measures drift and, if enabled, corrects for it by waking operations earlier,
+// by the drift it has seen so far.
+type driftCompensator struct {
+	mu           sync.Mutex
+	enabled      bool
+	compensation time.Duration
+	samples      int64
+	total        time.Duration
+	max          time.Duration
+	overruns     int64
+}
+
+// target returns when an operation modeled to complete at end should wake up.
+func (d *driftCompensator) target(end time.Time) time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return end.Add(-d.compensation)
+}
+
+// observe records that an operation modeled to complete at end, which started waiting at waited,
+// actually woke up at woke.
+func (d *driftCompensator) observe(end, waited, woke time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !waited.Before(end) {
+		d.overruns++
+		return
+	}
+
+	drift := woke.Sub(end)
+	d.samples++
+	d.total += drift
+	if drift > d.max {
+		d.max = drift
+	}
+
+	if d.enabled {
+		d.compensation += time.Duration(driftGain * float64(drift))
+		if d.compensation < 0 {
+			d.compensation = 0
+		}
+		if d.compensation > maxDriftCompensation {
+			d.compensation = maxDriftCompensation
+		}
+	}
+}
+
+func (d *driftCompensator) stats() DriftStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := DriftStats{
+		Samples:      d.samples,
+		Max:          d.max,
+		Overruns:     d.overruns,
+		Compensation: d.compensation,
+	}
+	if d.samples > 0 {
+		stats.Mean = d.total / time.Duration(d.samples)
+	}
+	return stats
+}
+
+// SetDriftCompensation changes whether operations are woken early to make up for the drift
+// measured so far, so that the latencies applications see match the modeled ones despite host
+// jitter. Drift is measured either way. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetDriftCompensation(compensate bool) {
+	sfs.drift.enabled = compensate
+}
+
+// SetSpin makes operations sleep until spin before they're modeled to complete, then spin the rest
+// of the way rather than rely on a timer, whose wakeups are too late for sub-millisecond latencies
+// to be faithful. Each operation waiting keeps a CPU busy for up to spin, so this suits fast devices
+// with low concurrency. A spin of zero disables this. This must be called before the filesystem is
+// mounted.
+func (sfs *SlowFs) SetSpin(spin time.Duration) {
+	sfs.spin = spin
+}
+
+// DriftStats returns how far the latencies delivered to applications are from the modeled ones.
+func (sfs *SlowFs) DriftStats() DriftStats {
+	return sfs.drift.stats()
+}
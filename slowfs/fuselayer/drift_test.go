@@ -0,0 +1,62 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDriftCompensator(t *testing.T) {
+	start := time.Unix(1000, 0)
+	cases := []struct {
+		desc             string
+		enabled          bool
+		lateness         time.Duration
+		wantCompensation time.Duration
+	}{
+		{"disabled", false, time.Millisecond, 0},
+		{"converges on the lateness", true, time.Millisecond, time.Millisecond},
+		{"bounded", true, time.Second, maxDriftCompensation},
+	}
+
+	for _, c := range cases {
+		d := &driftCompensator{enabled: c.enabled}
+		for i := 0; i < 200; i++ {
+			end := start.Add(time.Duration(i) * time.Second)
+			d.observe(end, end.Add(-time.Second), d.target(end).Add(c.lateness))
+		}
+		got := d.stats()
+		if diff := got.Compensation - c.wantCompensation; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%s: Compensation = %s, want %s", c.desc, got.Compensation, c.wantCompensation)
+		}
+		if got, want := got.Samples, int64(200); got != want {
+			t.Errorf("%s: Samples = %d, want %d", c.desc, got, want)
+		}
+		if got, want := got.Max, c.lateness; got != want {
+			t.Errorf("%s: Max = %s, want %s", c.desc, got, want)
+		}
+	}
+}
+
+func TestDriftCompensator_Overruns(t *testing.T) {
+	d := &driftCompensator{enabled: true}
+	end := time.Unix(1000, 0)
+	// Operations which were already late when they started waiting don't count towards drift.
+	d.observe(end, end.Add(time.Second), end.Add(time.Second))
+	if got, want := d.stats(), (DriftStats{Overruns: 1}); got != want {
+		t.Errorf("stats() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// fatPermissions are the permissions every file on a FAT filesystem reports, as when mounted with
+// the usual umask of 022.
+const fatPermissions = 0755
+
+// fatFs wraps a FileSystem to give it the rules of FAT filesystems: names are matched ignoring
+// case, and files can't have their permissions or owners changed, or be hard links, symlinks or
+// device nodes.
+type fatFs struct {
+	pathfs.FileSystem
+
+	// The backing directory, which names are looked up in.
+	root string
+}
+
+func newFatFs(fs pathfs.FileSystem, root string) *fatFs {
+	return &fatFs{
+		FileSystem: fs,
+		root:       root,
+	}
+}
+
+// resolve returns the name of the existing entry which name refers to when case is ignored. Parts
+// of name which don't exist are returned as given.
+func (fs *fatFs) resolve(name string) string {
+	if name == "" {
+		return name
+	}
+	components := strings.Split(name, "/")
+	dir := ""
+	for i, component := range components {
+		if _, err := os.Lstat(filepath.Join(fs.root, dir, component)); err != nil {
+			match, ok := fs.lookup(dir, component)
+			if !ok {
+				return filepath.Join(append([]string{dir}, components[i:]...)...)
+			}
+			component = match
+		}
+		dir = filepath.Join(dir, component)
+	}
+	return dir
+}
+
+// lookup finds an entry in dir whose name matches name when case is ignored.
+func (fs *fatFs) lookup(dir string, name string) (string, bool) {
+	f, err := os.Open(filepath.Join(fs.root, dir))
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range names {
+		if strings.EqualFold(entry, name) {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+func (fs *fatFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	attr, status := fs.FileSystem.GetAttr(fs.resolve(name), context)
+	if attr != nil {
+		attr.Mode = attr.Mode&^07777 | fatPermissions
+	}
+	return attr, status
+}
+
+func (fs *fatFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
+	return fuse.EPERM
+}
+
+func (fs *fatFs) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
+	return fuse.EPERM
+}
+
+func (fs *fatFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) fuse.Status {
+	return fs.FileSystem.Utimens(fs.resolve(name), Atime, Mtime, context)
+}
+
+func (fs *fatFs) Truncate(name string, size uint64, context *fuse.Context) fuse.Status {
+	return fs.FileSystem.Truncate(fs.resolve(name), size, context)
+}
+
+func (fs *fatFs) Access(name string, mode uint32, context *fuse.Context) fuse.Status {
+	return fs.FileSystem.Access(fs.resolve(name), mode, context)
+}
+
+func (fs *fatFs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
+	return fuse.EPERM
+}
+
+func (fs *fatFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	return fs.FileSystem.Mkdir(fs.resolve(name), mode, context)
+}
+
+func (fs *fatFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
+	return fuse.EPERM
+}
+
+func (fs *fatFs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
+	oldName = fs.resolve(oldName)
+	resolved := fs.resolve(newName)
+	if resolved == oldName {
+		// Renaming an entry to a name which only differs in case changes its case.
+		resolved = filepath.Join(filepath.Dir(resolved), filepath.Base(newName))
+	}
+	return fs.FileSystem.Rename(oldName, resolved, context)
+}
+
+func (fs *fatFs) Rmdir(name string, context *fuse.Context) fuse.Status {
+	return fs.FileSystem.Rmdir(fs.resolve(name), context)
+}
+
+func (fs *fatFs) Unlink(name string, context *fuse.Context) fuse.Status {
+	return fs.FileSystem.Unlink(fs.resolve(name), context)
+}
+
+func (fs *fatFs) GetXAttr(name string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
+	return fs.FileSystem.GetXAttr(fs.resolve(name), attribute, context)
+}
+
+func (fs *fatFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	return fs.FileSystem.ListXAttr(fs.resolve(name), context)
+}
+
+func (fs *fatFs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	return fs.FileSystem.RemoveXAttr(fs.resolve(name), attr, context)
+}
+
+func (fs *fatFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	return fs.FileSystem.SetXAttr(fs.resolve(name), attr, data, flags, context)
+}
+
+func (fs *fatFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	return fs.FileSystem.Open(fs.resolve(name), flags, context)
+}
+
+func (fs *fatFs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	return fs.FileSystem.Create(fs.resolve(name), flags, mode, context)
+}
+
+func (fs *fatFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
+	return fs.FileSystem.OpenDir(fs.resolve(name), context)
+}
+
+func (fs *fatFs) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
+	return fuse.EPERM
+}
+
+func (fs *fatFs) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
+	return fs.FileSystem.Readlink(fs.resolve(name), context)
+}
+
+func (fs *fatFs) StatFs(name string) *fuse.StatfsOut {
+	return fs.FileSystem.StatFs(fs.resolve(name))
+}
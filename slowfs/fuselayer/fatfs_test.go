@@ -0,0 +1,98 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+func TestFatFs_Resolve(t *testing.T) {
+	root, err := ioutil.TempDir("", "fatfs_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "DCIM", "Camera"), 0755); err != nil {
+		t.Fatalf("MkdirAll error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "DCIM", "Camera", "IMG_0001.JPG"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+
+	fs := newFatFs(nil, root)
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"", ""},
+		{"DCIM", "DCIM"},
+		{"dcim", "DCIM"},
+		{"dcim/camera/img_0001.jpg", "DCIM/Camera/IMG_0001.JPG"},
+		{"DCIM/Camera/IMG_0002.JPG", "DCIM/Camera/IMG_0002.JPG"},
+		{"dcim/new/img_0002.jpg", "DCIM/new/img_0002.jpg"},
+	}
+
+	for _, c := range cases {
+		if got := fs.resolve(c.name); got != c.want {
+			t.Errorf("resolve(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+type attrFs struct {
+	pathfs.FileSystem
+
+	attr fuse.Attr
+}
+
+func (fs *attrFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	attr := fs.attr
+	return &attr, fuse.OK
+}
+
+func TestFatFs_Permissions(t *testing.T) {
+	fs := newFatFs(&attrFs{attr: fuse.Attr{Mode: 0100600}}, "")
+
+	attr, status := fs.GetAttr("a", nil)
+	if status != fuse.OK {
+		t.Fatalf("GetAttr() = _, %v, want _, OK", status)
+	}
+	if got, want := attr.Mode, uint32(0100755); got != want {
+		t.Errorf("GetAttr().Mode = %o, want %o", got, want)
+	}
+
+	cases := []struct {
+		op     string
+		status fuse.Status
+	}{
+		{"Chmod", fs.Chmod("a", 0600, nil)},
+		{"Chown", fs.Chown("a", 1, 1, nil)},
+		{"Link", fs.Link("a", "b", nil)},
+		{"Mknod", fs.Mknod("a", 0600, 0, nil)},
+		{"Symlink", fs.Symlink("a", "b", nil)},
+	}
+
+	for _, c := range cases {
+		if got, want := c.status, fuse.EPERM; got != want {
+			t.Errorf("%s() = %v, want %v", c.op, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"log"
+
+	"slowfs/slowfs/faults"
+	"slowfs/slowfs/units"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+// SetFaultInjector makes operations fail, or reads and writes fall short, whenever injector says
+// they should. Faults are injected before the operation reaches the backing directory, so a failed
+// operation has no effect, and a short write only writes what it reports. This must be called
+// before the filesystem is mounted.
+func (sfs *SlowFs) SetFaultInjector(injector faults.Injector) {
+	sfs.faultInjector = injector
+}
+
+// SetDirectIO makes files be opened with direct IO, bypassing the kernel's page cache, or not. The
+// kernel takes a short read of a cached file to mean the file ends there, so short reads only reach
+// applications intact with direct IO. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetDirectIO(directIO bool) {
+	sfs.directIO = directIO
+}
+
+// withOpenFlags returns file with the flags files are opened with.
+func (sfs *SlowFs) withOpenFlags(file nodefs.File) nodefs.File {
+	if !sfs.directIO {
+		return file
+	}
+	return &nodefs.WithFlags{File: file, FuseFlags: fuse.FOPEN_DIRECT_IO}
+}
+
+// SetListingFaults makes directory listings skip, duplicate or restart entries whenever
+// listingFaults says they should. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetListingFaults(listingFaults *faults.ListingFaults) {
+	sfs.listingFaults = listingFaults
+}
+
+// perturbListing returns the listing of the directory at path, perturbed if listing faults are
+// set.
+func (sfs *SlowFs) perturbListing(path string, entries []fuse.DirEntry) []fuse.DirEntry {
+	if sfs.listingFaults == nil {
+		return entries
+	}
+	order, anomaly := sfs.listingFaults.Perturb(len(entries))
+	if anomaly == faults.NoAnomaly {
+		return entries
+	}
+	log.Printf("injecting %s into listing of %q", anomaly, path)
+	perturbed := make([]fuse.DirEntry, len(order))
+	for i, j := range order {
+		perturbed[i] = entries[j]
+	}
+	return perturbed
+}
+
+// injectFault returns the status an operation of the given class on path should fail with, or OK
+// if it should proceed. Every operation fails while the mount is starting up.
+func (sfs *SlowFs) injectFault(op faults.Op, path string) fuse.Status {
+	if status := sfs.checkReady(); status != fuse.OK {
+		return status
+	}
+	if sfs.faultInjector == nil {
+		return fuse.OK
+	}
+	errno := sfs.faultInjector.Inject(op, path, sfs.Now())
+	if errno == 0 {
+		return fuse.OK
+	}
+	log.Printf("injecting %s into %s on %q", errno, op, path)
+	return fuse.Status(errno)
+}
+
+// injectReadFault returns how many of the n bytes a read from path should read, or the status it
+// should fail with instead.
+func (sfs *SlowFs) injectReadFault(path string, n int) (int, fuse.Status) {
+	if status := sfs.checkReady(); status != fuse.OK {
+		return 0, status
+	}
+	if sfs.faultInjector == nil {
+		return n, fuse.OK
+	}
+	read, errno := sfs.faultInjector.InjectRead(path, units.NumBytes(n), sfs.Now())
+	if errno != 0 {
+		log.Printf("injecting %s into %s on %q", errno, faults.ReadOp, path)
+		return 0, fuse.Status(errno)
+	}
+	if int(read) < n {
+		log.Printf("injecting short read of %d of %d bytes on %q", read, n, path)
+	}
+	return int(read), fuse.OK
+}
+
+// injectWriteFault returns how many of the n bytes a write to path should write, or the status it
+// should fail with instead.
+func (sfs *SlowFs) injectWriteFault(path string, n int) (int, fuse.Status) {
+	if status := sfs.checkReady(); status != fuse.OK {
+		return 0, status
+	}
+	if sfs.faultInjector == nil {
+		return n, fuse.OK
+	}
+	written, errno := sfs.faultInjector.InjectWrite(path, units.NumBytes(n), sfs.Now())
+	if errno != 0 {
+		log.Printf("injecting %s into %s on %q", errno, faults.WriteOp, path)
+		return 0, fuse.Status(errno)
+	}
+	if int(written) < n {
+		log.Printf("injecting partial write of %d of %d bytes on %q", written, n, path)
+	}
+	return int(written), fuse.OK
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"os"
+	"slowfs/slowfs/faults"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+func TestSlowFs_WriteFaultsThroughCreate(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	schedule, err := faults.NewSchedule([]faults.ScheduledFault{
+		{Op: faults.WriteOp, Partial: true},
+		{Op: faults.WriteOp, Errno: syscall.EIO, AfterBytes: 50},
+		{Op: faults.ReadOp, Errno: syscall.EIO},
+	})
+	if err != nil {
+		t.Fatalf("NewSchedule error: %s", err)
+	}
+	schedule.Start(time.Unix(0, 0))
+	sfs.SetFaultInjector(schedule)
+
+	file, status := sfs.Create("a", uint32(os.O_RDWR|os.O_CREATE), 0644, nil)
+	if status != fuse.OK {
+		t.Fatalf("Create(a) = %v, want OK", status)
+	}
+	defer file.Release()
+
+	cases := []struct {
+		off        int64
+		size       int
+		wantN      uint32
+		wantStatus fuse.Status
+	}{
+		// The partial write fault cuts the first write in half.
+		{0, 100, 50, fuse.OK},
+		// Which makes the fault after 50 bytes active.
+		{50, 10, 0, fuse.EIO},
+		{50, 10, 10, fuse.OK},
+	}
+
+	for _, c := range cases {
+		n, status := file.Write(make([]byte, c.size), c.off)
+		if got, want := n, c.wantN; got != want {
+			t.Errorf("Write(%d bytes at %d) wrote %d bytes, want %d", c.size, c.off, got, want)
+		}
+		if got, want := status, c.wantStatus; got != want {
+			t.Errorf("Write(%d bytes at %d) = %v, want %v", c.size, c.off, got, want)
+		}
+	}
+
+	if _, got := file.Read(make([]byte, 10), 0); got != fuse.EIO {
+		t.Errorf("Read = %v, want %v", got, fuse.EIO)
+	}
+
+	attr, status := sfs.GetAttr("a", nil)
+	if status != fuse.OK {
+		t.Fatalf("GetAttr(a) = %v, want OK", status)
+	}
+	if got, want := attr.Size, uint64(60); got != want {
+		t.Errorf("size after faults = %d, want %d", got, want)
+	}
+}
+
+func TestSlowFs_InterruptsThroughCreate(t *testing.T) {
+	cases := []struct {
+		eintr, shortWrite float64
+		wantShort         bool
+		wantStatus        fuse.Status
+	}{
+		{0, 0, false, fuse.OK},
+		{1, 0, false, fuse.Status(syscall.EINTR)},
+		{0, 1, true, fuse.OK},
+	}
+
+	for _, c := range cases {
+		sfs := newLoopbackSlowFs(t)
+		interrupts := faults.NewInterruptFaults(c.eintr, 0, c.shortWrite, 1)
+		interrupts.Start(time.Unix(0, 0))
+		sfs.SetFaultInjector(interrupts)
+
+		file, status := sfs.Create("a", uint32(os.O_WRONLY|os.O_CREATE), 0644, nil)
+		if status != fuse.OK {
+			t.Fatalf("Create(a) = %v, want OK", status)
+		}
+		n, status := file.Write(make([]byte, 100), 0)
+		file.Release()
+		if got, want := status, c.wantStatus; got != want {
+			t.Errorf("Write with eintr %v, shortWrite %v = %v, want %v", c.eintr, c.shortWrite, got, want)
+		}
+		if got, want := status == fuse.OK && n < 100, c.wantShort; got != want {
+			t.Errorf("Write with eintr %v, shortWrite %v wrote %d of 100 bytes, want short %t", c.eintr, c.shortWrite, n, want)
+		}
+	}
+}
+
+func TestSlowFs_ShortReadsThroughCreate(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	sfs.SetDirectIO(true)
+	interrupts := faults.NewInterruptFaults(0, 1, 0, 1)
+	interrupts.Start(time.Unix(0, 0))
+	sfs.SetFaultInjector(interrupts)
+
+	file, status := sfs.Create("a", uint32(os.O_RDWR|os.O_CREATE), 0644, nil)
+	if status != fuse.OK {
+		t.Fatalf("Create(a) = %v, want OK", status)
+	}
+	defer file.Release()
+	if got, ok := file.(*nodefs.WithFlags); !ok || got.FuseFlags&fuse.FOPEN_DIRECT_IO == 0 {
+		t.Errorf("Create(a) returned %#v, want a file opened with direct IO", file)
+	}
+	if _, status := file.Write(make([]byte, 100), 0); status != fuse.OK {
+		t.Fatalf("Write to a = %v, want OK", status)
+	}
+
+	result, status := file.Read(make([]byte, 100), 0)
+	if status != fuse.OK {
+		t.Fatalf("Read from a = %v, want OK", status)
+	}
+	if got := result.Size(); got < 1 || got >= 100 {
+		t.Errorf("Read of 100 bytes from a read %d bytes, want a short read", got)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import "sync"
+
+// fileLocks holds a reader/writer lock for each file which is currently locked, so that writes to
+// a file can block reads of it, as on filesystems which take an exclusive inode lock for writes.
+// The zero value is ready to use.
+type fileLocks struct {
+	mu    sync.Mutex
+	locks map[string]*fileLock
+}
+
+type fileLock struct {
+	sync.RWMutex
+
+	// How many holders and waiters the lock has. It is forgotten once this reaches zero.
+	refs int
+}
+
+// lock locks the file at path, exclusively for writers and shared for readers, and returns a
+// function which unlocks it.
+func (l *fileLocks) lock(path string, exclusive bool) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*fileLock)
+	}
+	fl, ok := l.locks[path]
+	if !ok {
+		fl = &fileLock{}
+		l.locks[path] = fl
+	}
+	fl.refs++
+	l.mu.Unlock()
+
+	if exclusive {
+		fl.Lock()
+	} else {
+		fl.RLock()
+	}
+	return func() {
+		if exclusive {
+			fl.Unlock()
+		} else {
+			fl.RUnlock()
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if fl.refs--; fl.refs == 0 {
+			delete(l.locks, path)
+		}
+	}
+}
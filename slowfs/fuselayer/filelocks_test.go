@@ -0,0 +1,56 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileLocks(t *testing.T) {
+	var l fileLocks
+
+	// Readers share the lock, and other files are independent.
+	unlockRead := l.lock("a", false)
+	l.lock("a", false)()
+	l.lock("b", true)()
+
+	// A writer waits for the reader.
+	locked := make(chan struct{})
+	go func() {
+		unlock := l.lock("a", true)
+		close(locked)
+		unlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatalf("writer locked a while a reader held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlockRead()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatalf("writer didn't lock a once the reader released it")
+	}
+
+	// Locks are forgotten once released.
+	time.Sleep(10 * time.Millisecond)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if got, want := len(l.locks), 0; got != want {
+		t.Errorf("%d locks remembered after all were released, want %d", got, want)
+	}
+}
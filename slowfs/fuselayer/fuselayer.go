@@ -16,8 +16,18 @@
 package fuselayer
 
 import (
+	"context"
+	"log"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/control"
+	"slowfs/slowfs/delay"
+	"slowfs/slowfs/faults"
+	"slowfs/slowfs/quota"
 	"slowfs/slowfs/scheduler"
 	"slowfs/slowfs/units"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -25,17 +35,40 @@ import (
 	"github.com/hanwen/go-fuse/fuse/pathfs"
 )
 
+// fsyncFdatasync is the flag FUSE sets on an fsync made by fdatasync.
+const fsyncFdatasync = 1
+
 type slowFile struct {
 	nodefs.File
 
 	path string
 	sfs  *SlowFs
+
+	// Whether the file was opened with O_DIRECT or O_SYNC, so that writes to it go straight to the
+	// device.
+	direct bool
+	// Who opened the file, whose requests on it are made for.
+	caller *fuse.Caller
+}
+
+// writesDirect returns whether writes to a file opened with flags go straight to the device,
+// bypassing any cache: with O_DIRECT, or O_SYNC and O_DSYNC, which wait for the device. On Linux
+// O_SYNC includes O_DSYNC, but elsewhere, like macOS, they're separate bits.
+func writesDirect(flags uint32) bool {
+	return flags&(oDirect|syscall.O_SYNC|syscall.O_DSYNC) != 0
 }
 
 // Read performs a read, and then waits until the scheduled time.
 func (sf *slowFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	if sf.sfs.writesBlockReads {
+		defer sf.sfs.fileLocks.lock(sf.path, false)()
+	}
 	start := time.Now()
-	r, status := sf.File.Read(dest, off)
+	n, status := sf.sfs.injectReadFault(sf.path, len(dest))
+	if status != fuse.OK {
+		return nil, status
+	}
+	r, status := sf.File.Read(dest[:n], off)
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
 		return r, status
@@ -51,7 +84,7 @@ func (sf *slowFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status)
 	}
 	r = fuse.ReadResultData(buf)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	status = sf.sfs.waitAs(sf.caller, &scheduler.Request{
 		Type:      scheduler.ReadRequest,
 		Timestamp: start,
 		Path:      sf.path,
@@ -59,33 +92,47 @@ func (sf *slowFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status)
 		Size:      units.NumBytes(r.Size()),
 	})
 
-	time.Sleep(opTime - time.Since(start))
-
 	return r, status
 }
 
 // Write performs a write, and then waits until the scheduled time.
 func (sf *slowFile) Write(data []byte, off int64) (uint32, fuse.Status) {
+	if sf.sfs.writesBlockReads {
+		defer sf.sfs.fileLocks.lock(sf.path, true)()
+	}
 	start := time.Now()
+	n, status := sf.sfs.injectWriteFault(sf.path, len(data))
+	if status != fuse.OK {
+		return 0, status
+	}
+	data = data[:n]
+	if status := sf.sfs.checkFileSize(uint64(off) + uint64(len(data))); status != fuse.OK {
+		return 0, status
+	}
+	refund, status := sf.sfs.chargeGrowth(sf.path, sf.quotaAttr(), uint64(off)+uint64(len(data)))
+	if status != fuse.OK {
+		return 0, status
+	}
 	// Unlike Read, Write will immediately execute the syscall.
 	r, status := sf.File.Write(data, off)
 
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
+		refund()
 		return r, status
 	}
+	sf.sfs.scanModified(sf.path)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	status = sf.sfs.waitAs(sf.caller, &scheduler.Request{
 		Type:      scheduler.WriteRequest,
 		Timestamp: start,
 		Path:      sf.path,
 		Start:     units.NumBytes(off),
 		Size:      units.NumBytes(r),
+		Direct:    sf.direct,
 	})
 
-	time.Sleep(opTime - time.Since(start))
-
-	return r, status
+	return r, sf.sfs.syncWrite(sf.path, status)
 }
 
 // Release calls Release on the underlying file, and then waits until the scheduled time.
@@ -93,133 +140,202 @@ func (sf *slowFile) Release() {
 	start := time.Now()
 	sf.File.Release()
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	sf.sfs.waitAs(sf.caller, &scheduler.Request{
 		Type:      scheduler.CloseRequest,
 		Timestamp: start,
 		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
+}
+
+// Flush calls Flush on the underlying file, which happens each time a file descriptor is closed,
+// and then waits until the scheduled time.
+func (sf *slowFile) Flush() fuse.Status {
+	start := time.Now()
+	r := sf.File.Flush()
+	if r != fuse.OK {
+		return r
+	}
+
+	return sf.sfs.waitAs(sf.caller, &scheduler.Request{
+		Type:      scheduler.FlushRequest,
+		Timestamp: start,
+		Path:      sf.path,
+	})
 }
 
 func (sf *slowFile) Fsync(flags int) fuse.Status {
 	start := time.Now()
+	if status := sf.sfs.injectFault(faults.FsyncOp, sf.path); status != fuse.OK {
+		return status
+	}
 	r := sf.File.Fsync(flags)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.FsyncRequest,
+	// Databases often fdatasync, skipping the metadata commit an fsync pays for.
+	reqType := scheduler.FsyncRequest
+	if flags&fsyncFdatasync != 0 {
+		reqType = scheduler.FdatasyncRequest
+	}
+	r = sf.sfs.waitFsync(sf.caller, &scheduler.Request{
+		Type:      reqType,
 		Timestamp: start,
 		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Truncate(size uint64) fuse.Status {
 	start := time.Now()
+	if status := sf.sfs.injectFault(faults.WriteOp, sf.path); status != fuse.OK {
+		return status
+	}
+	if status := sf.sfs.checkFileSize(size); status != fuse.OK {
+		return status
+	}
+	oldSize := size
+	var attr fuse.Attr
+	if sf.File.GetAttr(&attr) == fuse.OK {
+		oldSize = attr.Size
+	}
+	refund, status := sf.sfs.chargeResize(sf.path, sf.quotaAttr(), size)
+	if status != fuse.OK {
+		return status
+	}
 	r := sf.File.Truncate(size)
-	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
+		refund()
 		return r
 	}
+	sf.sfs.scanModified(sf.path)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
-		Timestamp: start,
-	})
-	time.Sleep(opTime - time.Since(start))
+	r = sf.sfs.waitAs(sf.caller, resizeRequest(start, sf.path, oldSize, size))
 
 	return r
 }
 
 func (sf *slowFile) GetAttr(out *fuse.Attr) fuse.Status {
 	start := time.Now()
+	if status := sf.sfs.injectFault(faults.MetadataOp, sf.path); status != fuse.OK {
+		return status
+	}
 	r := sf.File.GetAttr(out)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
+	sf.sfs.coarsenAttr(out)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	r = sf.sfs.waitAs(sf.caller, &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Chown(uid uint32, gid uint32) fuse.Status {
 	start := time.Now()
+	if status := sf.sfs.injectFault(faults.MetadataOp, sf.path); status != fuse.OK {
+		return status
+	}
+	if sf.sfs.fixedOwnership {
+		return fuse.EPERM
+	}
+	refund, status := sf.sfs.chargeChown(sf.path, sf.quotaAttr(), uid, gid)
+	if status != fuse.OK {
+		return status
+	}
 	r := sf.File.Chown(uid, gid)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
+		refund()
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	r = sf.sfs.waitAs(sf.caller, &scheduler.Request{
+		Type:      scheduler.SetAttrRequest,
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Chmod(perms uint32) fuse.Status {
 	start := time.Now()
+	if status := sf.sfs.injectFault(faults.MetadataOp, sf.path); status != fuse.OK {
+		return status
+	}
+	if sf.sfs.fixedOwnership {
+		return fuse.EPERM
+	}
 	r := sf.File.Chmod(perms)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	r = sf.sfs.waitAs(sf.caller, &scheduler.Request{
+		Type:      scheduler.SetAttrRequest,
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Utimens(atime *time.Time, mtime *time.Time) fuse.Status {
 	start := time.Now()
-	r := sf.File.Utimens(atime, mtime)
+	if status := sf.sfs.injectFault(faults.MetadataOp, sf.path); status != fuse.OK {
+		return status
+	}
+	r := sf.File.Utimens(sf.sfs.coarsenTime(atime), sf.sfs.coarsenTime(mtime))
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	r = sf.sfs.waitAs(sf.caller, &scheduler.Request{
+		Type:      scheduler.SetAttrRequest,
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
 	start := time.Now()
+	if status := sf.sfs.injectFault(faults.WriteOp, sf.path); status != fuse.OK {
+		return status
+	}
+	refund := noRefund
+	if allocateGrows(mode) {
+		if status := sf.sfs.checkFileSize(off + size); status != fuse.OK {
+			return status
+		}
+		var status fuse.Status
+		if refund, status = sf.sfs.chargeGrowth(sf.path, sf.quotaAttr(), off+size); status != fuse.OK {
+			return status
+		}
+	}
 	r := sf.File.Allocate(off, size, mode)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
+		refund()
 		return r
 	}
+	sf.sfs.scanModified(sf.path)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.AllocateRequest,
-		Timestamp: start,
-		Size:      units.NumBytes(size),
-	})
-	time.Sleep(opTime - time.Since(start))
-
-	return r
+	req := allocateRequest(off, size, mode)
+	req.Timestamp = start
+	req.Path = sf.path
+	return sf.sfs.waitAs(sf.caller, req)
 }
 
 // SlowFs is a FileSystem whose operations take amounts of time determined by an associated
@@ -227,128 +343,435 @@ func (sf *slowFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
 type SlowFs struct {
 	pathfs.FileSystem
 
+	// The backing directory.
+	root string
+
 	scheduler *scheduler.Scheduler
+
+	// Requests for paths matching a route are sent to that route's scheduler instead.
+	routes []route
+
+	timeoutMu   sync.RWMutex
+	timeoutMode slowfs.TimeoutMode
+	timeout     time.Duration
+
+	// Done once the filesystem is shutting down, so that operations stop waiting.
+	ctx      context.Context
+	shutdown context.CancelFunc
+
+	// If set, decides which operations fail instead of reaching the backing directory.
+	faultInjector faults.Injector
+
+	// If set, perturbs directory listings.
+	listingFaults *faults.ListingFaults
+
+	// Whether files are opened with direct IO, so that short reads reach applications.
+	directIO bool
+
+	consistency slowfs.Consistency
+
+	// If set, writes to a file hold fileLocks exclusively until they complete, blocking reads.
+	writesBlockReads bool
+	fileLocks        fileLocks
+
+	// If non-zero, timestamps are stored and reported rounded down to a multiple of this.
+	timestampGranularity time.Duration
+	// If set, files are opened without updating their access times.
+	noAtime bool
+	// If set, writes and directory changes are made durable before they return.
+	sync    bool
+	dirSync bool
+	// If non-zero, files may not grow larger than this many bytes.
+	maxFileSize units.NumBytes
+	// If set, files' permissions and owners can't be changed, as on FAT filesystems.
+	fixedOwnership bool
+
+	// If set, limits how much space and how many files may be used.
+	quotas *quota.Quotas
+	// Who created entries through slowfs, for charging them against quotas.
+	owners entryOwners
+
+	// If set, the size of the device, past which files can't grow.
+	capacity *quota.Capacity
+
+	// If set, requests carry how many entries the directories they scan have.
+	countEntries bool
+	dirSizes     dirSizes
+
+	// Measures how late operations complete, and makes up for it.
+	drift driftCompensator
+	// How long before they complete operations stop sleeping and spin instead, for precision.
+	spin time.Duration
+	// If set, operations advance this instead of sleeping.
+	clock *scheduler.VirtualClock
+	// If non-zero, operations start and finish on multiples of this.
+	timingTick time.Duration
+
+	// The cost of the last operation on each path, for LastOpCostXAttr.
+	lastOps lastOps
+	// Holds operations back while IO is paused.
+	pause pauseGate
+	// Called after each operation is delayed.
+	delayHooks []DelayHook
+	// Called after each operation completes.
+	opHooks []OpHook
+	// If set, simulates an antivirus or indexing service scanning files.
+	scanner *scanner
+	// If set, limits how many files may be open at once.
+	handles *handleLimit
+	// If set, limits how fast data is read and written across the mount.
+	throttle *tokenBucket
+	// Decide the IO priority of requests, the first matching winning.
+	priorityRules []PriorityRule
+	// If set, when the mount becomes ready. Operations fail with ENOTCONN before then.
+	readyAt time.Time
+	// Set, atomically, if operations shouldn't be delayed at all.
+	passthrough int32
+	// How long operations of each type took, for comparing runs.
+	opTimes opTimes
+
+	// If set, runs the commands written to the control file.
+	controlServer *control.Server
+
+	nodeFsMu sync.Mutex
+	nodeFs   *pathfs.PathNodeFs
 }
 
 // NewSlowFs creates a new SlowFs using the specified scheduler at the given directory. The
 // directory must be empty.
 func NewSlowFs(directory string, scheduler *scheduler.Scheduler) *SlowFs {
+	ctx, shutdown := context.WithCancel(context.Background())
 	return &SlowFs{
 		FileSystem: pathfs.NewLoopbackFileSystem(directory),
+		root:       directory,
 		scheduler:  scheduler,
+		ctx:        ctx,
+		shutdown:   shutdown,
 	}
 }
 
+// Shutdown makes operations waiting for the simulated device, and any started later, fail with
+// EINTR straight away, so that the filesystem can be unmounted without waiting for them.
+func (sfs *SlowFs) Shutdown() {
+	sfs.shutdown()
+}
+
+// SetTimeout changes how operations which take longer than timeout behave. With SoftTimeout, they
+// fail with EIO once timeout has elapsed. With HardTimeout, they run for as long as they take. A
+// timeout of zero disables timeouts. This may be called while the filesystem is serving requests.
+func (sfs *SlowFs) SetTimeout(mode slowfs.TimeoutMode, timeout time.Duration) {
+	sfs.timeoutMu.Lock()
+	defer sfs.timeoutMu.Unlock()
+	sfs.timeoutMode = mode
+	sfs.timeout = timeout
+}
+
+// Timeout returns the current timeout mode and duration.
+func (sfs *SlowFs) Timeout() (slowfs.TimeoutMode, time.Duration) {
+	sfs.timeoutMu.RLock()
+	defer sfs.timeoutMu.RUnlock()
+	return sfs.timeoutMode, sfs.timeout
+}
+
+// SetConsistency changes when data written through one file handle becomes visible to others. This
+// must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetConsistency(consistency slowfs.Consistency) {
+	sfs.consistency = consistency
+}
+
+// SetWritesBlockReads changes whether reads of a file wait for writes to it in progress to complete,
+// as on filesystems which lock a file exclusively while writing, or interleave with them. This must
+// be called before the filesystem is mounted.
+func (sfs *SlowFs) SetWritesBlockReads(block bool) {
+	sfs.writesBlockReads = block
+}
+
+// wait schedules the given request and sleeps until it should complete. It returns the status the
+// operation should complete with, which is EIO if it timed out, EINTR if the filesystem is shutting
+// down and OK otherwise.
+func (sfs *SlowFs) wait(req *scheduler.Request) fuse.Status {
+	return sfs.waitAs(nil, req)
+}
+
+// waitAs is like wait, for a request made by caller, which priority rules by user may match. caller
+// is nil if unknown.
+func (sfs *SlowFs) waitAs(caller *fuse.Caller, req *scheduler.Request) fuse.Status {
+	req.Priority = sfs.priority(req, caller)
+	ctx := sfs.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// With a virtual clock, operations start whenever simulated time has got to.
+	if sfs.clock != nil {
+		req.Timestamp = sfs.clock.Now()
+	}
+	start := req.Timestamp
+	if sfs.isPassthrough() {
+		sfs.opTimes.record(req.Type, sfs.Now().Sub(start))
+		sfs.runOpHooks(req, scheduler.Cost{}, start, fuse.OK)
+		return fuse.OK
+	}
+	req.Timestamp = sfs.quantizeStart(req.Timestamp)
+
+	// With soft timeouts, each request has a deadline, which also applies to waiting for the
+	// scheduler to accept it. Deadlines are in real time, so simulated time can't meet them.
+	mode, timeout := sfs.Timeout()
+	deadline := ctx
+	if timeout > 0 && mode == slowfs.SoftTimeout && sfs.clock == nil {
+		var cancel context.CancelFunc
+		deadline, cancel = context.WithDeadline(ctx, req.Timestamp.Add(timeout))
+		defer cancel()
+	}
+
+	// Operations held back while paused start once IO resumes.
+	if paused, err := sfs.pause.wait(deadline); err != nil {
+		return contextStatus(err)
+	} else if paused {
+		req.Timestamp = sfs.quantizeStart(sfs.Now())
+	}
+
+	cost, err := sfs.schedulerForRequest(req).ScheduleCost(deadline, req)
+	if err != nil {
+		return contextStatus(err)
+	}
+	sfs.lastOps.record(req.Path, req.Type, cost)
+	opTime := sfs.quantizeDuration(cost.Total())
+	// However little the request costs, its data can't go faster than the mount's bandwidth limit.
+	if d := sfs.throttle.delay(req.Timestamp, throttledBytes(req, cost)); d > opTime {
+		opTime = sfs.quantizeDuration(d)
+	}
+
+	end, status := req.Timestamp.Add(opTime), fuse.OK
+	if timeout > 0 && opTime > timeout {
+		switch mode {
+		case slowfs.SoftTimeout:
+			end, status = req.Timestamp.Add(timeout), fuse.EIO
+		case slowfs.HardTimeout:
+			log.Printf("%s on %q is taking %s, longer than timeout %s, still trying", req.Type, req.Path, opTime, timeout)
+		}
+	}
+
+	waited, done := req.Timestamp, end
+	if sfs.clock != nil {
+		sfs.clock.AdvanceTo(end)
+	} else {
+		waited = time.Now()
+		if err := delay.Until(ctx, sfs.drift.target(end), sfs.spin); err != nil {
+			return contextStatus(err)
+		}
+		done = time.Now()
+		sfs.drift.observe(end, waited, done)
+	}
+	sfs.runDelayHooks(req, done.Sub(waited))
+	sfs.opTimes.record(req.Type, done.Sub(start))
+	sfs.runOpHooks(req, cost, start, status)
+	return status
+}
+
+// sleepUntil sleeps until t, or until ctx is done, in which case it returns ctx's error.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	return delay.Until(ctx, t, 0)
+}
+
+// contextStatus returns the status an operation fails with when its context is done with err.
+// Missing a deadline is a soft timeout, and anything else means the operation was interrupted.
+func contextStatus(err error) fuse.Status {
+	if err == context.DeadlineExceeded {
+		return fuse.EIO
+	}
+	return fuse.Status(syscall.EINTR)
+}
+
 // Open opens a file, and then waits until the scheduled time.
 func (sfs *SlowFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if name == StatsFileName {
+		return sfs.openStatsFile(flags)
+	}
+	if sfs.isControlFile(name) {
+		return sfs.openControlFile(context)
+	}
+	if status := sfs.handles.acquire(sfs.ctx); status != fuse.OK {
+		return nil, status
+	}
+	return sfs.handles.track(sfs.open(name, flags, context))
+}
+
+// open opens a file other than the stats and control files.
+func (sfs *SlowFs) open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
 	start := time.Now()
-	file, status := sfs.FileSystem.Open(name, flags, context)
+	if status := sfs.injectFault(faults.OpenOp, name); status != fuse.OK {
+		return nil, status
+	}
+	file, status := sfs.FileSystem.Open(name, sfs.openFlags(flags), context)
+	if status == fuse.EPERM && sfs.noAtime {
+		// Only the owner of a file may open it with O_NOATIME.
+		file, status = sfs.FileSystem.Open(name, flags&^oDirect, context)
+	}
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
 		return file, status
 	}
 
-	slowFile := &slowFile{
-		File: file,
-		sfs:  sfs,
-		path: name,
-	}
-
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	if status == fuse.OK {
+		status = sfs.holdOpen(name)
+	}
+	if status != fuse.OK {
+		file.Release()
+		return nil, status
+	}
+
+	return sfs.wrapFile(file, name, flags, context), status
+}
 
-	return slowFile, status
+// wrapFile wraps file, just opened or created at name with flags, so that operations on it are
+// delayed, charged against quotas and capacity, and fail when faults say they should.
+func (sfs *SlowFs) wrapFile(file nodefs.File, name string, flags uint32, context *fuse.Context) nodefs.File {
+	var wrapped nodefs.File = &slowFile{
+		File:   file,
+		sfs:    sfs,
+		path:   name,
+		direct: writesDirect(flags),
+		caller: callerOf(context),
+	}
+	if sfs.consistency != slowfs.LocalConsistency {
+		wrapped = newCtoFile(wrapped, sfs.consistency)
+	}
+	return sfs.withOpenFlags(wrapped)
 }
 
 // GetAttr calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if name == StatsFileName {
+		return sfs.statsFileAttr(), fuse.OK
+	}
+	if sfs.isControlFile(name) {
+		return sfs.controlFileAttr(), fuse.OK
+	}
+
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return nil, status
+	}
 	attr, status := sfs.FileSystem.GetAttr(name, context)
 	if status != fuse.OK {
 		return attr, status
 	}
+	sfs.coarsenAttr(attr)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Entries:   sfs.parentEntries(name, 0),
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return attr, status
 }
 
-// Chmod calls the underlying filesystem then sends a MetadataRequest and
+// Chmod calls the underlying filesystem then sends a SetAttrRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
 	status := sfs.FileSystem.Chmod(name, mode, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.SetAttrRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return status
 }
 
-// Chown calls the underlying filesystem then sends a MetadataRequest and
+// Chown calls the underlying filesystem then sends a SetAttrRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
-	status := sfs.FileSystem.Chown(name, uid, gid, context)
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
+	refund, status := sfs.chargeChown(name, sfs.quotaAttr(name, context), uid, gid)
 	if status != fuse.OK {
 		return status
 	}
+	status = sfs.FileSystem.Chown(name, uid, gid, context)
+	if status != fuse.OK {
+		refund()
+		return status
+	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.SetAttrRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return status
 }
 
-// Utimens calls the underlying filesystem then sends a MetadataRequest and
+// Utimens calls the underlying filesystem then sends a SetAttrRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) fuse.Status {
 	start := time.Now()
-	status := sfs.FileSystem.Utimens(name, Atime, Mtime, context)
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
+	status := sfs.FileSystem.Utimens(name, sfs.coarsenTime(Atime), sfs.coarsenTime(Mtime), context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.SetAttrRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return status
 }
 
-// Truncate calls the underlying filesystem then sends a MetadataRequest and
-// waits how long it is told to.
+// Truncate calls the underlying filesystem then sends a request costing however much it freed or
+// added, and waits how long it is told to.
 func (sfs *SlowFs) Truncate(name string, size uint64, context *fuse.Context) fuse.Status {
+	if sfs.isControlFile(name) {
+		return fuse.OK
+	}
 	start := time.Now()
-	status := sfs.FileSystem.Truncate(name, size, context)
+	if status := sfs.injectFault(faults.WriteOp, name); status != fuse.OK {
+		return status
+	}
+	if status := sfs.checkFileSize(size); status != fuse.OK {
+		return status
+	}
+	oldSize := size
+	if attr, status := sfs.FileSystem.GetAttr(name, context); status == fuse.OK {
+		oldSize = attr.Size
+	}
+	refund, status := sfs.chargeResize(name, sfs.quotaAttr(name, context), size)
 	if status != fuse.OK {
 		return status
 	}
+	status = sfs.FileSystem.Truncate(name, size, context)
+	if status != fuse.OK {
+		refund()
+		return status
+	}
+	sfs.scanModified(name)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
-		Timestamp: start,
-	})
-	time.Sleep(opTime - time.Since(start))
+	status = sfs.waitAs(callerOf(context), resizeRequest(start, name, oldSize, size))
 
 	return status
 }
@@ -357,142 +780,217 @@ func (sfs *SlowFs) Truncate(name string, size uint64, context *fuse.Context) fus
 // waits how long it is told to.
 func (sfs *SlowFs) Access(name string, mode uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
 	status := sfs.FileSystem.Access(name, mode, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return status
 }
 
-// Link calls the underlying filesystem then sends a MetadataRequest and
+// Link calls the underlying filesystem then sends a DirEntryRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, newName); status != fuse.OK {
+		return status
+	}
 	status := sfs.FileSystem.Link(oldName, newName, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.DirEntryRequest,
 		Timestamp: start,
+		Path:      newName,
+		Entries:   sfs.parentEntries(newName, 1),
 	})
-	time.Sleep(opTime - time.Since(start))
 
-	return status
+	return sfs.syncDir(newName, status)
 }
 
-// Mkdir calls the underlying filesystem then sends a MetadataRequest and
+// Mkdir calls the underlying filesystem then sends a DirEntryRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
-	status := sfs.FileSystem.Mkdir(name, mode, context)
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
+	refund, status := sfs.chargeNewEntry(name, context)
+	if status != fuse.OK {
+		return status
+	}
+	status = sfs.FileSystem.Mkdir(name, mode, context)
 	if status != fuse.OK {
+		refund()
 		return status
 	}
+	sfs.ownNewEntry(name, context)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.DirEntryRequest,
 		Timestamp: start,
+		Path:      name,
+		Entries:   sfs.parentEntries(name, 1),
 	})
-	time.Sleep(opTime - time.Since(start))
 
-	return status
+	return sfs.syncDir(name, status)
 }
 
-// Mknod calls the underlying filesystem then sends a MetadataRequest and
+// Mknod calls the underlying filesystem then sends a DirEntryRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
-	status := sfs.FileSystem.Mknod(name, mode, dev, context)
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
+	refund, status := sfs.chargeNewEntry(name, context)
+	if status != fuse.OK {
+		return status
+	}
+	status = sfs.FileSystem.Mknod(name, mode, dev, context)
 	if status != fuse.OK {
+		refund()
 		return status
 	}
+	sfs.ownNewEntry(name, context)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.DirEntryRequest,
 		Timestamp: start,
+		Path:      name,
+		Entries:   sfs.parentEntries(name, 1),
 	})
-	time.Sleep(opTime - time.Since(start))
 
-	return status
+	return sfs.syncDir(name, status)
 }
 
-// Rename calls the underlying filesystem then sends a MetadataRequest and
+// Rename calls the underlying filesystem then sends a DirEntryRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, oldName); status != fuse.OK {
+		return status
+	}
+	if sfs.quotas != nil && !sfs.quotas.SameProjects(oldName, newName) {
+		return fuse.EXDEV
+	}
+	// Renaming over an entry removes it, unless it's another link to the same file.
+	replaced := sfs.quotaAttr(newName, context)
+	if moved := sfs.quotaAttr(oldName, context); replaced != nil && moved != nil && moved.Ino == replaced.Ino {
+		replaced = nil
+	}
+	removed, added := sfs.renameEntries(oldName, newName)
 	status := sfs.FileSystem.Rename(oldName, newName, context)
 	if status != fuse.OK {
 		return status
 	}
+	sfs.releaseQuota(newName, replaced)
+	sfs.scanModified(newName)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.DirEntryRequest,
 		Timestamp: start,
+		Path:      oldName,
+		Entries:   sfs.parentEntries(oldName, -removed),
 	})
-	time.Sleep(opTime - time.Since(start))
-
-	return status
+	sfs.lastOps.move(oldName, newName)
+	sfs.dirSizes.add(parentDir(newName), added)
+	sfs.dirSizes.forget(oldName)
+	sfs.dirSizes.forget(newName)
+
+	// Moving between directories changes both.
+	if filepath.Dir(oldName) != filepath.Dir(newName) {
+		status = sfs.syncDir(oldName, status)
+	}
+	return sfs.syncDir(newName, status)
 }
 
-// Rmdir calls the underlying filesystem then sends a MetadataRequest and
+// Rmdir calls the underlying filesystem then sends a DirEntryRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Rmdir(name string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
+	attr := sfs.quotaAttr(name, context)
 	status := sfs.FileSystem.Rmdir(name, context)
 	if status != fuse.OK {
 		return status
 	}
+	sfs.releaseQuota(name, attr)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.DirEntryRequest,
 		Timestamp: start,
+		Path:      name,
+		Entries:   sfs.parentEntries(name, -1),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.lastOps.forget(name)
+	sfs.dirSizes.forget(name)
 
-	return status
+	return sfs.syncDir(name, status)
 }
 
-// Unlink calls the underlying filesystem then sends a MetadataRequest and
+// Unlink calls the underlying filesystem then sends a DirEntryRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Unlink(name string, context *fuse.Context) fuse.Status {
 	start := time.Now()
-	status := sfs.FileSystem.Unlink(name, context)
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
+	attr, status := sfs.FileSystem.GetAttr(name, context)
+	if status != fuse.OK {
+		attr = nil
+	}
+	status = sfs.FileSystem.Unlink(name, context)
 	if status != fuse.OK {
 		return status
 	}
+	sfs.releaseQuota(name, attr)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.DirEntryRequest,
 		Timestamp: start,
+		Path:      name,
+		Size:      unlinkedBytes(attr),
+		Entries:   sfs.parentEntries(name, -1),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.lastOps.forget(name)
 
-	return status
+	return sfs.syncDir(name, status)
 }
 
 // GetXAttr calls the underlying filesystem then sends a MetadataRequest and
-// waits how long it is told to.
+// waits how long it is told to. LastOpCostXAttr is answered straight away instead.
 func (sfs *SlowFs) GetXAttr(name string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
+	if attribute == LastOpCostXAttr {
+		return sfs.lastOpCost(name)
+	}
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return nil, status
+	}
 	data, status := sfs.FileSystem.GetXAttr(name, attribute, context)
 	if status != fuse.OK {
 		return data, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return data, status
 }
@@ -501,16 +999,19 @@ func (sfs *SlowFs) GetXAttr(name string, attribute string, context *fuse.Context
 // waits how long it is told to.
 func (sfs *SlowFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return nil, status
+	}
 	attributes, status := sfs.FileSystem.ListXAttr(name, context)
 	if status != fuse.OK {
 		return attributes, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return attributes, status
 }
@@ -518,17 +1019,23 @@ func (sfs *SlowFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse
 // RemoveXAttr calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	if attr == LastOpCostXAttr {
+		return fuse.EPERM
+	}
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
 	status := sfs.FileSystem.RemoveXAttr(name, attr, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return status
 }
@@ -536,89 +1043,175 @@ func (sfs *SlowFs) RemoveXAttr(name string, attr string, context *fuse.Context)
 // SetXAttr calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	if attr == LastOpCostXAttr {
+		return fuse.EPERM
+	}
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return status
+	}
 	status := sfs.FileSystem.SetXAttr(name, attr, data, flags, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return status
 }
 
-// Create calls the underlying filesystem then sends a MetadataRequest and
+// Create calls the underlying filesystem then sends a DirEntryRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if status := sfs.handles.acquire(sfs.ctx); status != fuse.OK {
+		return nil, status
+	}
+	return sfs.handles.track(sfs.create(name, flags, mode, context))
+}
+
+// create creates and opens a file.
+func (sfs *SlowFs) create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
 	start := time.Now()
-	file, status := sfs.FileSystem.Create(name, flags, mode, context)
+	if status := sfs.injectFault(faults.OpenOp, name); status != fuse.OK {
+		return nil, status
+	}
+	refund, status := sfs.chargeNewEntry(name, context)
 	if status != fuse.OK {
+		return nil, status
+	}
+	file, status := sfs.FileSystem.Create(name, sfs.openFlags(flags), mode, context)
+	if status == fuse.EPERM && sfs.noAtime {
+		// Only the owner of a file may open it with O_NOATIME.
+		file, status = sfs.FileSystem.Create(name, flags&^oDirect, mode, context)
+	}
+	if status != fuse.OK {
+		refund()
 		return file, status
 	}
+	sfs.ownNewEntry(name, context)
+	sfs.scanModified(name)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.syncDir(name, sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.DirEntryRequest,
 		Timestamp: start,
-	})
-	time.Sleep(opTime - time.Since(start))
+		Path:      name,
+		Entries:   sfs.parentEntries(name, 1),
+	}))
+	if status != fuse.OK {
+		file.Release()
+		return nil, status
+	}
 
-	return file, status
+	return sfs.wrapFile(file, name, flags, context), status
 }
 
-// OpenDir calls the underlying filesystem then sends a MetadataRequest and
-// waits how long it is told to.
+// OpenDir calls the underlying filesystem then sends a ReaddirRequest for the
+// listed entries and waits how long it is told to.
 func (sfs *SlowFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return nil, status
+	}
 	stream, status := sfs.FileSystem.OpenDir(name, context)
 	if status != fuse.OK {
 		return stream, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	entries := sfs.listedEntries(name, len(stream))
+	stream = sfs.perturbListing(name, stream)
+
+	// The whole listing is charged up front, even if the caller only reads part of it.
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.ReaddirRequest,
 		Timestamp: start,
+		Path:      name,
+		Size:      direntBytes(stream),
+		Entries:   entries,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return stream, status
 }
 
-// Symlink calls the underlying filesystem then sends a MetadataRequest and
+// direntBytes computes how many bytes the kernel receives when listing the given entries. Each
+// entry has a 24 byte header followed by its name, padded to a multiple of 8 bytes.
+func direntBytes(entries []fuse.DirEntry) units.NumBytes {
+	var n units.NumBytes
+	for _, e := range entries {
+		n += units.NumBytes((24 + len(e.Name) + 7) &^ 7)
+	}
+	return n
+}
+
+// resizeRequest creates a request for changing the size of the file at path from oldSize to
+// newSize. Shrinking frees blocks and growing may zero them. Leaving the size alone is a truncate of
+// nothing, which the device charges according to its NoOpStrategy.
+func resizeRequest(start time.Time, path string, oldSize, newSize uint64) *scheduler.Request {
+	req := &scheduler.Request{
+		Type:      scheduler.TruncateRequest,
+		Timestamp: start,
+		Path:      path,
+		Start:     units.NumBytes(newSize),
+	}
+	switch {
+	case newSize < oldSize:
+		req.Size = units.NumBytes(oldSize - newSize)
+	case newSize > oldSize:
+		req.Type = scheduler.ExtendRequest
+		req.Start = units.NumBytes(oldSize)
+		req.Size = units.NumBytes(newSize - oldSize)
+	}
+	return req
+}
+
+// Symlink calls the underlying filesystem then sends a DirEntryRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
 	start := time.Now()
-	status := sfs.FileSystem.Symlink(value, linkName, context)
+	if status := sfs.injectFault(faults.MetadataOp, linkName); status != fuse.OK {
+		return status
+	}
+	refund, status := sfs.chargeNewEntry(linkName, context)
 	if status != fuse.OK {
 		return status
 	}
+	status = sfs.FileSystem.Symlink(value, linkName, context)
+	if status != fuse.OK {
+		refund()
+		return status
+	}
+	sfs.ownNewEntry(linkName, context)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
+		Type:      scheduler.DirEntryRequest,
 		Timestamp: start,
+		Path:      linkName,
+		Entries:   sfs.parentEntries(linkName, 1),
 	})
-	time.Sleep(opTime - time.Since(start))
 
-	return status
+	return sfs.syncDir(linkName, status)
 }
 
 // Readlink calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return "", status
+	}
 	f, status := sfs.FileSystem.Readlink(name, context)
 	if status != fuse.OK {
 		return f, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	status = sfs.waitAs(callerOf(context), &scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
 
 	return f, status
 }
@@ -627,13 +1220,20 @@ func (sfs *SlowFs) Readlink(name string, context *fuse.Context) (string, fuse.St
 // waits how long it is told to.
 func (sfs *SlowFs) StatFs(name string) *fuse.StatfsOut {
 	start := time.Now()
+	if status := sfs.injectFault(faults.MetadataOp, name); status != fuse.OK {
+		return nil
+	}
 	out := sfs.FileSystem.StatFs(name)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	if status := sfs.wait(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
-	})
-	time.Sleep(opTime - time.Since(start))
+		Path:      name,
+	}); status != fuse.OK {
+		return nil
+	}
+	sfs.reportCapacity(out)
+	sfs.hideUnreclaimed(out)
 
 	return out
 }
@@ -0,0 +1,173 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// newLoopbackSlowFs creates a SlowFs over a new temporary directory, which is removed when the test
+// ends. Operations take simulated time on an SSD, so they don't sleep.
+func newLoopbackSlowFs(t *testing.T) *SlowFs {
+	root, err := ioutil.TempDir("", "fuselayer_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	config := slowfs.SSDDeviceConfig
+	clock := scheduler.NewVirtualClock(time.Unix(0, 0))
+	s := scheduler.New(&config)
+	s.SetClock(clock)
+	sfs := NewSlowFs(root, s)
+	sfs.SetVirtualClock(clock)
+	return sfs
+}
+
+// createFile creates the file name in sfs and writes data to it, returning the status of the write.
+func createFile(t *testing.T, sfs *SlowFs, name string, data []byte) fuse.Status {
+	file, status := sfs.Create(name, uint32(os.O_WRONLY|os.O_CREATE), 0644, nil)
+	if status != fuse.OK {
+		t.Fatalf("Create(%q) = %v, want OK", name, status)
+	}
+	defer file.Release()
+	_, status = file.Write(data, 0)
+	return status
+}
+
+func TestResizeRequest(t *testing.T) {
+	start := time.Now()
+	cases := []struct {
+		oldSize, newSize uint64
+		want             *scheduler.Request
+	}{
+		{100, 100, &scheduler.Request{Type: scheduler.TruncateRequest, Timestamp: start, Path: "a", Start: 100}},
+		{100, 40, &scheduler.Request{Type: scheduler.TruncateRequest, Timestamp: start, Path: "a", Start: 40, Size: 60}},
+		{100, 0, &scheduler.Request{Type: scheduler.TruncateRequest, Timestamp: start, Path: "a", Start: 0, Size: 100}},
+		{100, 250, &scheduler.Request{Type: scheduler.ExtendRequest, Timestamp: start, Path: "a", Start: 100, Size: 150}},
+	}
+
+	for _, c := range cases {
+		if got, want := resizeRequest(start, "a", c.oldSize, c.newSize), c.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("resizeRequest(%d, %d) = %+v, want %+v", c.oldSize, c.newSize, got, want)
+		}
+	}
+}
+
+func TestSlowFs_Wait(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	config.MetadataOpTime = 100 * time.Millisecond
+
+	cases := []struct {
+		desc          string
+		mode          slowfs.TimeoutMode
+		timeout       time.Duration
+		shutdownAfter time.Duration
+		want          fuse.Status
+		min, max      time.Duration
+	}{
+		{"no timeout", slowfs.HardTimeout, 0, 0, fuse.OK, 100 * time.Millisecond, time.Second},
+		{"hard timeout", slowfs.HardTimeout, 10 * time.Millisecond, 0, fuse.OK, 100 * time.Millisecond, time.Second},
+		{"soft timeout", slowfs.SoftTimeout, 10 * time.Millisecond, 0, fuse.EIO, 10 * time.Millisecond, 90 * time.Millisecond},
+		{"soft timeout not reached", slowfs.SoftTimeout, time.Second, 0, fuse.OK, 100 * time.Millisecond, time.Second},
+		{"shutdown", slowfs.HardTimeout, 0, 10 * time.Millisecond, fuse.Status(syscall.EINTR), 10 * time.Millisecond, 90 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		sfs := NewSlowFs("", scheduler.New(&config))
+		sfs.SetTimeout(c.mode, c.timeout)
+		if c.shutdownAfter > 0 {
+			time.AfterFunc(c.shutdownAfter, sfs.Shutdown)
+		}
+
+		start := time.Now()
+		got := sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: start, Path: "a"})
+		elapsed := time.Since(start)
+		if got != c.want {
+			t.Errorf("%s: wait() = %v, want %v", c.desc, got, c.want)
+		}
+		if elapsed < c.min || elapsed > c.max {
+			t.Errorf("%s: wait() took %s, want between %s and %s", c.desc, elapsed, c.min, c.max)
+		}
+	}
+
+	// Once shut down, operations fail without waiting at all.
+	sfs := NewSlowFs("", scheduler.New(&config))
+	sfs.Shutdown()
+	if got, want := sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Now()}), fuse.Status(syscall.EINTR); got != want {
+		t.Errorf("wait() after Shutdown() = %v, want %v", got, want)
+	}
+}
+
+func TestWritesDirect(t *testing.T) {
+	cases := []struct {
+		flags uint32
+		want  bool
+	}{
+		{syscall.O_RDWR, false},
+		{syscall.O_RDWR | oDirect, oDirect != 0},
+		{syscall.O_WRONLY | syscall.O_SYNC, true},
+		{syscall.O_WRONLY | syscall.O_DSYNC, true},
+		{syscall.O_WRONLY | syscall.O_APPEND, false},
+	}
+
+	for _, c := range cases {
+		if got, want := writesDirect(c.flags), c.want; got != want {
+			t.Errorf("writesDirect(%#o) = %t, want %t", c.flags, got, want)
+		}
+	}
+}
+
+func TestSlowFs_CreateDirect(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+
+	cases := []struct {
+		name  string
+		flags uint32
+		want  bool
+	}{
+		{"buffered", syscall.O_WRONLY, false},
+		{"direct", syscall.O_WRONLY | oDirect, oDirect != 0},
+		{"sync", syscall.O_WRONLY | syscall.O_SYNC, true},
+		{"dsync", syscall.O_WRONLY | syscall.O_DSYNC, true},
+	}
+
+	for _, c := range cases {
+		file, status := sfs.Create(c.name, c.flags|syscall.O_CREAT, 0644, nil)
+		if status != fuse.OK {
+			t.Fatalf("Create(%q, %#o) = %v, want OK", c.name, c.flags, status)
+		}
+		sf, ok := file.(*slowFile)
+		if !ok {
+			t.Fatalf("Create(%q, %#o) returned a %T, want a *slowFile", c.name, c.flags, file)
+		}
+		if got, want := sf.direct, c.want; got != want {
+			t.Errorf("Create(%q, %#o) direct = %t, want %t", c.name, c.flags, got, want)
+		}
+		if _, status := file.Write([]byte("data"), 0); status != fuse.OK {
+			t.Errorf("Write to %q = %v, want OK", c.name, status)
+		}
+		file.Release()
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+// handleLimit limits how many files may be open at once, like a file server running out of
+// descriptors. A nil handleLimit allows any number.
+type handleLimit struct {
+	max int
+	// If set, opens beyond the limit wait for another file to be closed, instead of failing with
+	// EMFILE.
+	block bool
+
+	mu   sync.Mutex
+	open int
+	// Closed, and replaced, whenever a file is closed.
+	released chan struct{}
+}
+
+// SetMaxOpenFiles limits how many files, other than the stats and control files, may be open at
+// once. Opens beyond the limit fail with EMFILE, or with block, wait until another file is closed.
+// A limit of zero removes it. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetMaxOpenFiles(max int, block bool) {
+	if max <= 0 {
+		sfs.handles = nil
+		return
+	}
+	sfs.handles = &handleLimit{
+		max:      max,
+		block:    block,
+		released: make(chan struct{}),
+	}
+}
+
+// OpenFiles returns how many files are open, if their number is limited.
+func (sfs *SlowFs) OpenFiles() int {
+	if sfs.handles == nil {
+		return 0
+	}
+	sfs.handles.mu.Lock()
+	defer sfs.handles.mu.Unlock()
+	return sfs.handles.open
+}
+
+// acquire takes a handle for a file about to be opened, which must be given back with track.
+func (l *handleLimit) acquire(ctx context.Context) fuse.Status {
+	if l == nil {
+		return fuse.OK
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for {
+		l.mu.Lock()
+		if l.open < l.max {
+			l.open++
+			l.mu.Unlock()
+			return fuse.OK
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		if !l.block {
+			return fuse.Status(syscall.EMFILE)
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return contextStatus(ctx.Err())
+		}
+	}
+}
+
+// track gives back the handle taken for file straight away if opening it failed, and otherwise
+// once it is released.
+func (l *handleLimit) track(file nodefs.File, status fuse.Status) (nodefs.File, fuse.Status) {
+	if l == nil {
+		return file, status
+	}
+	if status != fuse.OK {
+		l.release()
+		return file, status
+	}
+	return &limitedFile{File: file, limit: l}, status
+}
+
+func (l *handleLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.open--
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// limitedFile is an open file which holds one of a limited number of handles until it is released.
+type limitedFile struct {
+	nodefs.File
+
+	once  sync.Once
+	limit *handleLimit
+}
+
+func (f *limitedFile) Release() {
+	f.File.Release()
+	f.once.Do(f.limit.release)
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+type releaseFile struct {
+	nodefs.File
+}
+
+func (f *releaseFile) Release() {}
+
+func TestSlowFs_MaxOpenFiles(t *testing.T) {
+	sfs := &SlowFs{}
+	sfs.SetMaxOpenFiles(2, false)
+
+	var files []nodefs.File
+	for i := 0; i < 2; i++ {
+		if status := sfs.handles.acquire(nil); status != fuse.OK {
+			t.Fatalf("acquire() = %v, want OK", status)
+		}
+		file, _ := sfs.handles.track(&releaseFile{}, fuse.OK)
+		files = append(files, file)
+	}
+	if got, want := sfs.handles.acquire(nil), fuse.Status(syscall.EMFILE); got != want {
+		t.Errorf("acquire() past the limit = %v, want %v", got, want)
+	}
+
+	// Releasing a file twice only gives its handle back once, and a failed open gives its handle
+	// back straight away.
+	files[0].Release()
+	files[0].Release()
+	if status := sfs.handles.acquire(nil); status != fuse.OK {
+		t.Fatalf("acquire() after Release = %v, want OK", status)
+	}
+	sfs.handles.track(nil, fuse.ENOENT)
+	if got, want := sfs.OpenFiles(), 1; got != want {
+		t.Errorf("OpenFiles() = %d, want %d", got, want)
+	}
+}
+
+func TestSlowFs_MaxOpenFilesBlock(t *testing.T) {
+	sfs := &SlowFs{}
+	sfs.SetMaxOpenFiles(1, true)
+	if status := sfs.handles.acquire(nil); status != fuse.OK {
+		t.Fatalf("acquire() = %v, want OK", status)
+	}
+	file, _ := sfs.handles.track(&releaseFile{}, fuse.OK)
+
+	done := make(chan fuse.Status)
+	go func() {
+		done <- sfs.handles.acquire(nil)
+	}()
+	select {
+	case status := <-done:
+		t.Fatalf("acquire() past the limit = %v, want it to wait", status)
+	case <-time.After(20 * time.Millisecond):
+	}
+	file.Release()
+	if got, want := <-done, fuse.OK; got != want {
+		t.Errorf("acquire() after Release = %v, want %v", got, want)
+	}
+}
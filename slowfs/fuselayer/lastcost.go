@@ -0,0 +1,104 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"slowfs/slowfs/scheduler"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// LastOpCostXAttr is the name of a virtual extended attribute of every file, which reports the
+// simulated cost of the last operation on it, one "name value" pair per line with durations in
+// nanoseconds, so that tests can assert on modeled costs in band. It isn't stored in the backing
+// directory or listed, and reading it takes no simulated time.
+const LastOpCostXAttr = "user.slowfs.last_op_cost"
+
+// maxLastOps is how many paths the costs of last operations are remembered for. Once there are more,
+// arbitrary ones are forgotten to make room.
+const maxLastOps = 1 << 16
+
+type lastOp struct {
+	op   scheduler.RequestType
+	cost scheduler.Cost
+}
+
+// lastOps remembers the cost of the last operation on each path.
+type lastOps struct {
+	mu  sync.Mutex
+	ops map[string]lastOp
+}
+
+func (l *lastOps) record(path string, op scheduler.RequestType, cost scheduler.Cost) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ops == nil {
+		l.ops = make(map[string]lastOp)
+	}
+	if _, ok := l.ops[path]; !ok && len(l.ops) >= maxLastOps {
+		for p := range l.ops {
+			delete(l.ops, p)
+			break
+		}
+	}
+	l.ops[path] = lastOp{op, cost}
+}
+
+func (l *lastOps) get(path string) (lastOp, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	op, ok := l.ops[path]
+	return op, ok
+}
+
+// forget drops what is remembered about path, once it's been removed.
+func (l *lastOps) forget(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.ops, path)
+}
+
+// move remembers what was remembered about oldPath, and everything under it, for newPath instead,
+// once it's been renamed. Anything remembered about what was at newPath is forgotten.
+func (l *lastOps) move(oldPath, newPath string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	moved := make(map[string]lastOp)
+	for p, op := range l.ops {
+		if p == newPath || strings.HasPrefix(p, newPath+"/") {
+			delete(l.ops, p)
+		}
+		if p == oldPath || strings.HasPrefix(p, oldPath+"/") {
+			delete(l.ops, p)
+			moved[newPath+strings.TrimPrefix(p, oldPath)] = op
+		}
+	}
+	for p, op := range moved {
+		l.ops[p] = op
+	}
+}
+
+// lastOpCost returns the contents of the LastOpCostXAttr of path.
+func (sfs *SlowFs) lastOpCost(path string) ([]byte, fuse.Status) {
+	last, ok := sfs.lastOps.get(path)
+	if !ok {
+		return nil, fuse.Status(syscall.ENODATA)
+	}
+	return []byte(fmt.Sprintf("op %s\n%s", last.op, last.cost.Breakdown())), fuse.OK
+}
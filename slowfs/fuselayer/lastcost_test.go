@@ -0,0 +1,114 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_LastOpCost(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	config.MetadataOpTime = time.Millisecond
+	sfs := NewSlowFs("", scheduler.New(&config))
+
+	if _, got := sfs.GetXAttr("a", LastOpCostXAttr, nil); got != fuse.Status(syscall.ENODATA) {
+		t.Errorf("GetXAttr(%q) before any operation = _, %v, want ENODATA", LastOpCostXAttr, got)
+	}
+
+	sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Now(), Path: "a"})
+	want := "op MetadataRequest\ntotal_ns 1000000\nqueue_ns 0\nwait_ns 0\nlock_ns 0\nseek_ns 0\ntransfer_ns 0\n" +
+		"repair_ns 0\nverify_ns 0\nalignment_ns 0\nfixed_ns 1000000\nupload_ns 0\nnetwork_ns 0\n"
+	if got, status := sfs.GetXAttr("a", LastOpCostXAttr, nil); status != fuse.OK || string(got) != want {
+		t.Errorf("GetXAttr(%q) = %q, %v, want %q, OK", LastOpCostXAttr, got, status, want)
+	}
+	if got, want := sfs.SetXAttr("a", LastOpCostXAttr, nil, 0, nil), fuse.EPERM; got != want {
+		t.Errorf("SetXAttr(%q) = %v, want %v", LastOpCostXAttr, got, want)
+	}
+
+	// Renaming carries the cost over, and removing forgets it.
+	sfs.lastOps.move("a", "b")
+	if _, status := sfs.GetXAttr("b", LastOpCostXAttr, nil); status != fuse.OK {
+		t.Errorf("GetXAttr(%q) after move = _, %v, want OK", LastOpCostXAttr, status)
+	}
+	sfs.lastOps.forget("b")
+	if _, got := sfs.GetXAttr("b", LastOpCostXAttr, nil); got != fuse.Status(syscall.ENODATA) {
+		t.Errorf("GetXAttr(%q) after forget = _, %v, want ENODATA", LastOpCostXAttr, got)
+	}
+}
+
+func TestLastOps_Move(t *testing.T) {
+	var l lastOps
+	for _, p := range []string{"d", "d/a", "d/e/b", "dd", "x/c", "x"} {
+		l.record(p, scheduler.MetadataRequest, scheduler.Cost{})
+	}
+
+	// Everything under the renamed directory moves with it, and what was at the new name is gone.
+	l.move("d", "x")
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"d", false},
+		{"d/a", false},
+		{"x", true},
+		{"x/a", true},
+		{"x/e/b", true},
+		{"x/c", false},
+		{"dd", true},
+	}
+	for _, c := range cases {
+		if _, got := l.get(c.path); got != c.want {
+			t.Errorf("get(%s) after move = _, %t, want _, %t", c.path, got, c.want)
+		}
+	}
+}
+
+func TestLastOps_Max(t *testing.T) {
+	var l lastOps
+	for i := 0; i < maxLastOps+10; i++ {
+		l.record(fmt.Sprint(i), scheduler.MetadataRequest, scheduler.Cost{})
+	}
+	if got, want := len(l.ops), maxLastOps; got != want {
+		t.Errorf("remembering %d paths, want %d", got, want)
+	}
+	if _, ok := l.get(fmt.Sprint(maxLastOps + 9)); !ok {
+		t.Errorf("get() of the last path recorded = _, false, want _, true")
+	}
+}
+
+func TestSlowFs_LastOpCostMkdir(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+
+	// A new directory reports the cost of creating it, until it's removed.
+	if got, want := sfs.Mkdir("d", 0755, nil), fuse.OK; got != want {
+		t.Fatalf("Mkdir() = %v, want %v", got, want)
+	}
+	if _, status := sfs.GetXAttr("d", LastOpCostXAttr, nil); status != fuse.OK {
+		t.Errorf("GetXAttr(%q) after Mkdir = _, %v, want OK", LastOpCostXAttr, status)
+	}
+	if got, want := sfs.Rmdir("d", nil), fuse.OK; got != want {
+		t.Fatalf("Rmdir() = %v, want %v", got, want)
+	}
+	if _, got := sfs.GetXAttr("d", LastOpCostXAttr, nil); got != fuse.Status(syscall.ENODATA) {
+		t.Errorf("GetXAttr(%q) after Rmdir = _, %v, want ENODATA", LastOpCostXAttr, got)
+	}
+}
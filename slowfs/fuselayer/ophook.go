@@ -0,0 +1,58 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/scheduler"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// CompletedOp describes an operation slowfs has finished delaying.
+type CompletedOp struct {
+	Request *scheduler.Request
+	// The simulated cost of the operation, which is zero in passthrough mode.
+	Cost scheduler.Cost
+	// How long the operation actually took, from reaching slowfs until it was done waiting, which
+	// can differ from the cost when the backing directory is slow or timers fire late.
+	Elapsed time.Duration
+	Status  fuse.Status
+}
+
+// OpHook is called once slowfs has finished delaying each operation. Hooks are called from the
+// goroutine serving the operation, so they hold it up for as long as they take.
+type OpHook func(*CompletedOp)
+
+// AddOpHook registers a hook to be called after each operation. This must be called before the
+// filesystem is mounted.
+func (sfs *SlowFs) AddOpHook(hook OpHook) {
+	sfs.opHooks = append(sfs.opHooks, hook)
+}
+
+func (sfs *SlowFs) runOpHooks(req *scheduler.Request, cost scheduler.Cost, start time.Time, status fuse.Status) {
+	if len(sfs.opHooks) == 0 {
+		return
+	}
+	op := &CompletedOp{
+		Request: req,
+		Cost:    cost,
+		Elapsed: time.Since(start),
+		Status:  status,
+	}
+	for _, hook := range sfs.opHooks {
+		hook(op)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate holds operations back while IO is paused.
+type pauseGate struct {
+	mu sync.Mutex
+	// Closed when IO resumes, or nil if IO isn't paused.
+	resumed chan struct{}
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+func (g *pauseGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed != nil
+}
+
+// wait waits until IO isn't paused, or ctx is done. It returns whether it had to wait.
+func (g *pauseGate) wait(ctx context.Context) (bool, error) {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return false, nil
+	}
+	select {
+	case <-resumed:
+		return true, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
+// Pause holds back every operation which takes simulated time until Resume is called, as if the
+// device had stopped responding. Operations already waiting for their scheduled time complete as
+// usual. Operations held back count against soft timeouts, and take their usual time once resumed.
+func (sfs *SlowFs) Pause() {
+	sfs.pause.pause()
+}
+
+// Resume lets operations held back by Pause continue.
+func (sfs *SlowFs) Resume() {
+	sfs.pause.resume()
+}
+
+// Paused returns whether operations are being held back by Pause.
+func (sfs *SlowFs) Paused() bool {
+	return sfs.pause.paused()
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_Pause(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	config.MetadataOpTime = time.Millisecond
+	sfs := NewSlowFs("", scheduler.New(&config))
+
+	sfs.Pause()
+	sfs.Pause()
+	if !sfs.Paused() {
+		t.Fatalf("Paused() = false after Pause, want true")
+	}
+	done := make(chan fuse.Status)
+	go func() {
+		done <- sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Now(), Path: "a"})
+	}()
+	select {
+	case status := <-done:
+		t.Fatalf("wait returned %v while paused", status)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	resumed := time.Now()
+	sfs.Resume()
+	if got, want := <-done, fuse.OK; got != want {
+		t.Errorf("wait after Resume = %v, want %v", got, want)
+	}
+	// The operation starts once resumed, so it still takes its full time.
+	if got, want := time.Since(resumed), time.Millisecond; got < want {
+		t.Errorf("wait took %s after Resume, want at least %s", got, want)
+	}
+	if sfs.Paused() {
+		t.Errorf("Paused() = true after Resume, want false")
+	}
+}
+
+func TestSlowFs_PauseSoftTimeout(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	sfs := NewSlowFs("", scheduler.New(&config))
+	sfs.SetTimeout(slowfs.SoftTimeout, 10*time.Millisecond)
+	sfs.Pause()
+	defer sfs.Resume()
+
+	if got, want := sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Now(), Path: "a"}), fuse.EIO; got != want {
+		t.Errorf("wait while paused = %v, want %v", got, want)
+	}
+}
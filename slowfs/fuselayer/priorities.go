@@ -0,0 +1,117 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"strconv"
+	"strings"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// PriorityRule gives the requests matching it an IO priority class. Exactly one of Path, UID and
+// Op is set: the rule matches requests for paths matching Path, as for slowfs.MatchesPath,
+// requests made by the user UID, or requests of type Op.
+type PriorityRule struct {
+	Path     string
+	UID      *uint32
+	Op       *scheduler.RequestType
+	Priority scheduler.Priority
+}
+
+// ParsePriorityRulesFromString parses comma separated kind:value=priority rules, where kind is
+// path, uid or op, e.g. "path:db/compaction=idle,uid:0=high,op:fsync=high".
+func ParsePriorityRulesFromString(s string) ([]PriorityRule, error) {
+	var rules []PriorityRule
+	for _, r := range strings.Split(s, ",") {
+		i := strings.LastIndexByte(r, '=')
+		j := strings.IndexByte(r, ':')
+		if i < 0 || j < 0 || j > i {
+			return nil, fmt.Errorf("priority rule %q: want kind:value=priority", r)
+		}
+		var rule PriorityRule
+		var err error
+		if rule.Priority, err = scheduler.ParsePriorityFromString(strings.TrimSpace(r[i+1:])); err != nil {
+			return nil, fmt.Errorf("priority rule %q: %s", r, err)
+		}
+		value := strings.TrimSpace(r[j+1 : i])
+		switch kind := strings.TrimSpace(r[:j]); kind {
+		case "path":
+			if _, err := filepath.Match(value, ""); err != nil || value == "" {
+				return nil, fmt.Errorf("priority rule %q: bad path pattern", r)
+			}
+			rule.Path = value
+		case "uid":
+			uid, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("priority rule %q: %s", r, err)
+			}
+			u := uint32(uid)
+			rule.UID = &u
+		case "op":
+			op, err := scheduler.ParseRequestTypeFromString(value)
+			if err != nil {
+				return nil, fmt.Errorf("priority rule %q: %s", r, err)
+			}
+			rule.Op = &op
+		default:
+			return nil, fmt.Errorf("priority rule %q: unknown kind %q, want path, uid or op", r, kind)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matches returns whether the rule matches a request made by caller, which is nil if unknown.
+func (r *PriorityRule) matches(req *scheduler.Request, caller *fuse.Caller) bool {
+	switch {
+	case r.UID != nil:
+		return caller != nil && caller.Uid == *r.UID
+	case r.Op != nil:
+		return req.Type == *r.Op
+	default:
+		return slowfs.MatchesPath(r.Path, req.Path)
+	}
+}
+
+// SetPriorityRules gives each request the priority of the first of rules it matches, or normal
+// priority if none, so that the simulated devices serve, say, foreground reads ahead of background
+// compaction. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetPriorityRules(rules []PriorityRule) {
+	sfs.priorityRules = rules
+}
+
+// priority returns the priority of a request made by caller, which is nil if unknown.
+func (sfs *SlowFs) priority(req *scheduler.Request, caller *fuse.Caller) scheduler.Priority {
+	for i := range sfs.priorityRules {
+		if sfs.priorityRules[i].matches(req, caller) {
+			return sfs.priorityRules[i].Priority
+		}
+	}
+	return scheduler.NormalPriority
+}
+
+// callerOf returns a copy of who made a request, or nil if unknown.
+func callerOf(context *fuse.Context) *fuse.Caller {
+	if context == nil {
+		return nil
+	}
+	caller := context.Caller
+	return &caller
+}
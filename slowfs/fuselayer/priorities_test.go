@@ -0,0 +1,84 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"reflect"
+	"slowfs/slowfs/scheduler"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestParsePriorityRulesFromString(t *testing.T) {
+	uid := uint32(1000)
+	fsync := scheduler.FsyncRequest
+	cases := []struct {
+		s         string
+		want      []PriorityRule
+		shouldErr bool
+	}{
+		{"path:db/compaction=idle", []PriorityRule{{Path: "db/compaction", Priority: scheduler.IdlePriority}}, false},
+		{"uid:1000=high, op: fsync = high", []PriorityRule{
+			{UID: &uid, Priority: scheduler.HighPriority},
+			{Op: &fsync, Priority: scheduler.HighPriority},
+		}, false},
+		{"path:*.sst=normal", []PriorityRule{{Path: "*.sst", Priority: scheduler.NormalPriority}}, false},
+		{"db=idle", nil, true},
+		{"path:db", nil, true},
+		{"path:=idle", nil, true},
+		{"path:[db=idle", nil, true},
+		{"uid:root=idle", nil, true},
+		{"op:compact=idle", nil, true},
+		{"pid:1=idle", nil, true},
+		{"path:db=urgent", nil, true},
+		{"path:db=idle,", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParsePriorityRulesFromString(c.s)
+		if !reflect.DeepEqual(got, c.want) || c.shouldErr != (err != nil) {
+			t.Errorf("ParsePriorityRulesFromString(%q) = %+v, %v, want %+v, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestSlowFs_Priority(t *testing.T) {
+	rules, err := ParsePriorityRulesFromString("uid:0=high,path:db/compaction=idle,op:fsync=high")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfs := &SlowFs{}
+	sfs.SetPriorityRules(rules)
+
+	root, user := &fuse.Caller{}, &fuse.Caller{Owner: fuse.Owner{Uid: 1000}}
+	cases := []struct {
+		req    *scheduler.Request
+		caller *fuse.Caller
+		want   scheduler.Priority
+	}{
+		{&scheduler.Request{Type: scheduler.ReadRequest, Path: "db/compaction/1.sst"}, user, scheduler.IdlePriority},
+		// The first matching rule wins.
+		{&scheduler.Request{Type: scheduler.ReadRequest, Path: "db/compaction/1.sst"}, root, scheduler.HighPriority},
+		{&scheduler.Request{Type: scheduler.FsyncRequest, Path: "db/compaction/1.sst"}, nil, scheduler.IdlePriority},
+		{&scheduler.Request{Type: scheduler.FsyncRequest, Path: "db/wal"}, user, scheduler.HighPriority},
+		{&scheduler.Request{Type: scheduler.ReadRequest, Path: "db/1.sst"}, user, scheduler.NormalPriority},
+	}
+	for _, c := range cases {
+		if got, want := sfs.priority(c.req, c.caller), c.want; got != want {
+			t.Errorf("priority(%+v, %+v) = %s, want %s", c.req, c.caller, got, want)
+		}
+	}
+}
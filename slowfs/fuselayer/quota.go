@@ -0,0 +1,268 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"os"
+	"slowfs/slowfs/quota"
+	"slowfs/slowfs/units"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// SetQuotas makes operations which would take usage past one of q's limits fail with EDQUOT, and
+// renames between q's projects fail with EXDEV. This must be called before the filesystem is
+// mounted.
+func (sfs *SlowFs) SetQuotas(q *quota.Quotas) {
+	sfs.quotas = q
+}
+
+// Quotas returns the quotas set with SetQuotas, or nil if there are none.
+func (sfs *SlowFs) Quotas() *quota.Quotas {
+	return sfs.quotas
+}
+
+// SetCapacity makes the filesystem the size c gives, whatever the backing directory's free space:
+// statfs reports that size, and operations which would take file data past it fail with ENOSPC. This
+// must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetCapacity(c *quota.Capacity) {
+	sfs.capacity = c
+}
+
+// chargesSpace returns whether there are quotas or a capacity to charge operations against.
+func (sfs *SlowFs) chargesSpace() bool {
+	return sfs.quotas != nil || sfs.capacity != nil
+}
+
+// reportCapacity makes out describe a device of the size set with SetCapacity, if there is one,
+// rather than the backing directory's.
+func (sfs *SlowFs) reportCapacity(out *fuse.StatfsOut) {
+	if sfs.capacity == nil || out == nil || out.Bsize == 0 {
+		return
+	}
+	bsize := uint64(out.Bsize)
+	out.Blocks = uint64(sfs.capacity.Bytes()) / bsize
+	used := (uint64(sfs.capacity.Used()) + bsize - 1) / bsize
+	out.Bfree = 0
+	if used < out.Blocks {
+		out.Bfree = out.Blocks - used
+	}
+	out.Bavail = out.Bfree
+}
+
+// noRefund is returned by the charging methods when there is nothing to refund.
+func noRefund() {}
+
+// chargeQuota charges the entry at name owned by owner for growing by numBytes and files, against
+// the device's capacity and then its quotas. It returns a function which refunds the charge, for
+// when the operation then fails.
+func (sfs *SlowFs) chargeQuota(owner quota.Owner, name string, numBytes units.NumBytes, files int64) (func(), fuse.Status) {
+	if !sfs.chargesSpace() || (numBytes == 0 && files == 0) {
+		return noRefund, fuse.OK
+	}
+	if sfs.capacity != nil {
+		if err := sfs.capacity.Charge(numBytes); err != nil {
+			return noRefund, fuse.Status(syscall.ENOSPC)
+		}
+	}
+	if sfs.quotas != nil {
+		if err := sfs.quotas.Charge(owner, name, numBytes, files); err != nil {
+			if sfs.capacity != nil {
+				sfs.capacity.Charge(-numBytes)
+			}
+			return noRefund, fuse.Status(syscall.EDQUOT)
+		}
+	}
+	return func() {
+		if sfs.capacity != nil {
+			sfs.capacity.Charge(-numBytes)
+		}
+		if sfs.quotas != nil {
+			sfs.quotas.Charge(owner, name, -numBytes, -files)
+		}
+	}, fuse.OK
+}
+
+// entryOwners remembers who created entries, by inode, since their backing entries are owned by
+// slowfs's user whoever asks for them. It is safe for concurrent use.
+type entryOwners struct {
+	mu     sync.Mutex
+	owners map[uint64]quota.Owner
+}
+
+// set remembers that the entry with inode ino belongs to owner.
+func (e *entryOwners) set(ino uint64, owner quota.Owner) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.owners == nil {
+		e.owners = make(map[uint64]quota.Owner)
+	}
+	e.owners[ino] = owner
+}
+
+// get returns who the entry with inode ino belongs to, and whether it is known.
+func (e *entryOwners) get(ino uint64) (quota.Owner, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	owner, ok := e.owners[ino]
+	return owner, ok
+}
+
+// forget forgets who the entry with inode ino belongs to, once it has been removed.
+func (e *entryOwners) forget(ino uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.owners, ino)
+}
+
+// creatorOf returns who creates entries on behalf of the caller context gives, or slowfs's own
+// user without one.
+func creatorOf(context *fuse.Context) quota.Owner {
+	if context == nil {
+		return quota.Owner{UID: uint32(os.Geteuid()), GID: uint32(os.Getegid())}
+	}
+	return quota.Owner{UID: context.Uid, GID: context.Gid}
+}
+
+// chargeNewEntry charges the caller context gives for creating a new entry at name.
+func (sfs *SlowFs) chargeNewEntry(name string, context *fuse.Context) (func(), fuse.Status) {
+	return sfs.chargeQuota(creatorOf(context), name, 0, 1)
+}
+
+// ownNewEntry makes the entry just created at name belong to the caller context gives, so that it
+// is charged for the entry growing and shrinking as well as for creating it.
+func (sfs *SlowFs) ownNewEntry(name string, context *fuse.Context) {
+	if sfs.quotas == nil {
+		return
+	}
+	attr, status := sfs.FileSystem.GetAttr(name, context)
+	if status != fuse.OK {
+		return
+	}
+	sfs.owners.set(attr.Ino, creatorOf(context))
+}
+
+// ownerOf returns who the entry attr describes is charged to: whoever created it through slowfs,
+// or else the owner of its backing entry.
+func (sfs *SlowFs) ownerOf(attr *fuse.Attr) quota.Owner {
+	if owner, ok := sfs.owners.get(attr.Ino); ok {
+		return owner
+	}
+	return quota.Owner{UID: attr.Uid, GID: attr.Gid}
+}
+
+// chargeResize charges the file at name, which attr describes, for changing size to newSize bytes.
+// A nil attr, as quotaAttr returns without quotas or a capacity, charges nothing.
+func (sfs *SlowFs) chargeResize(name string, attr *fuse.Attr, newSize uint64) (func(), fuse.Status) {
+	if attr == nil {
+		return noRefund, fuse.OK
+	}
+	return sfs.chargeQuota(sfs.ownerOf(attr), name, units.NumBytes(newSize)-units.NumBytes(attr.Size), 0)
+}
+
+// chargeGrowth is like chargeResize, except that the file is left as it is if it is already
+// at least end bytes long.
+func (sfs *SlowFs) chargeGrowth(name string, attr *fuse.Attr, end uint64) (func(), fuse.Status) {
+	if attr == nil || end <= attr.Size {
+		return noRefund, fuse.OK
+	}
+	return sfs.chargeResize(name, attr, end)
+}
+
+// chargeChown charges for changing the owner of the entry at name, which attr describes, to uid and
+// gid. Either is ^uint32(0) when it isn't changing.
+func (sfs *SlowFs) chargeChown(name string, attr *fuse.Attr, uid uint32, gid uint32) (func(), fuse.Status) {
+	if sfs.quotas == nil || attr == nil {
+		return noRefund, fuse.OK
+	}
+	from := sfs.ownerOf(attr)
+	to := from
+	if uid != ^uint32(0) {
+		to.UID = uid
+	}
+	if gid != ^uint32(0) {
+		to.GID = gid
+	}
+	size := entryBytes(attr)
+	if err := sfs.quotas.Chown(from, to, name, size); err != nil {
+		return noRefund, fuse.Status(syscall.EDQUOT)
+	}
+	_, owned := sfs.owners.get(attr.Ino)
+	if owned {
+		sfs.owners.set(attr.Ino, to)
+	}
+	return func() {
+		sfs.quotas.Chown(to, from, name, size)
+		if owned {
+			sfs.owners.set(attr.Ino, from)
+		}
+	}, fuse.OK
+}
+
+// releaseQuota stops charging for the entry at name, which attr describes, once it has been
+// removed. Removing one of several links to a file frees nothing.
+func (sfs *SlowFs) releaseQuota(name string, attr *fuse.Attr) {
+	if !sfs.chargesSpace() || attr == nil || (isRegular(attr) && attr.Nlink > 1) {
+		return
+	}
+	if sfs.capacity != nil {
+		sfs.capacity.Charge(-entryBytes(attr))
+	}
+	if sfs.quotas != nil {
+		sfs.quotas.Charge(sfs.ownerOf(attr), name, -entryBytes(attr), -1)
+		sfs.owners.forget(attr.Ino)
+	}
+}
+
+// quotaAttr returns the attributes of the entry at name if there are quotas or a capacity to
+// charge it against, and nil otherwise.
+func (sfs *SlowFs) quotaAttr(name string, context *fuse.Context) *fuse.Attr {
+	if !sfs.chargesSpace() {
+		return nil
+	}
+	attr, status := sfs.FileSystem.GetAttr(name, context)
+	if status != fuse.OK {
+		return nil
+	}
+	return attr
+}
+
+// quotaAttr returns the attributes of the file if there are quotas or a capacity to charge it
+// against, and nil otherwise.
+func (sf *slowFile) quotaAttr() *fuse.Attr {
+	if !sf.sfs.chargesSpace() {
+		return nil
+	}
+	var attr fuse.Attr
+	if sf.File.GetAttr(&attr) != fuse.OK {
+		return nil
+	}
+	return &attr
+}
+
+func isRegular(attr *fuse.Attr) bool {
+	return attr.Mode&syscall.S_IFMT == syscall.S_IFREG
+}
+
+// entryBytes returns how many bytes an entry counts against quotas: the size of regular files, and
+// nothing for anything else.
+func entryBytes(attr *fuse.Attr) units.NumBytes {
+	if !isRegular(attr) {
+		return 0
+	}
+	return units.NumBytes(attr.Size)
+}
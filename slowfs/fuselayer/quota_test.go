@@ -0,0 +1,248 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"os"
+	"slowfs/slowfs/quota"
+	"slowfs/slowfs/units"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+func TestSlowFs_ChargeQuota(t *testing.T) {
+	q := quota.New([]quota.Limit{{Kind: quota.UserQuota, ID: 1000, Bytes: 100, Files: 10}})
+	sfs := &SlowFs{}
+	sfs.SetQuotas(q)
+	edquot := fuse.Status(syscall.EDQUOT)
+	file := &fuse.Attr{Mode: syscall.S_IFREG | 0644, Size: 0, Nlink: 1, Owner: fuse.Owner{Uid: 1000}}
+
+	if _, status := sfs.chargeQuota(sfs.ownerOf(file), "f", 0, 1); status != fuse.OK {
+		t.Errorf("chargeQuota() for a new file = %v, want OK", status)
+	}
+	refund, status := sfs.chargeGrowth("f", file, 60)
+	if status != fuse.OK {
+		t.Errorf("chargeGrowth(60) = %v, want OK", status)
+	}
+	// The write failed, so nothing is used.
+	refund()
+	if _, status := sfs.chargeGrowth("f", file, 90); status != fuse.OK {
+		t.Errorf("chargeGrowth(90) after a refund = %v, want OK", status)
+	}
+	file.Size = 90
+	if _, status := sfs.chargeGrowth("f", file, 50); status != fuse.OK {
+		t.Errorf("chargeGrowth(50) within the file = %v, want OK", status)
+	}
+	if _, status := sfs.chargeResize("f", file, 101); status != edquot {
+		t.Errorf("chargeResize(101) = %v, want %v", status, edquot)
+	}
+	if _, status := sfs.chargeChown("f", file, 1001, ^uint32(0)); status != fuse.OK {
+		t.Errorf("chargeChown() to an unlimited user = %v, want OK", status)
+	}
+	if got, want := q.Usages()[0].Bytes, units.NumBytes(0); got != want {
+		t.Errorf("usage after chargeChown() = %d, want %d", got, want)
+	}
+	file.Uid = 1001
+	if _, status := sfs.chargeChown("f", file, 1000, ^uint32(0)); status != fuse.OK {
+		t.Errorf("chargeChown() back = %v, want OK", status)
+	}
+	file.Uid = 1000
+
+	sfs.releaseQuota("f", file)
+	if got, want := q.Usages()[0], (quota.Usage{Limit: q.Usages()[0].Limit}); got != want {
+		t.Errorf("usage after releaseQuota() = %+v, want %+v", got, want)
+	}
+
+	// Without quotas, nothing is charged.
+	if _, status := (&SlowFs{}).chargeResize("f", file, 1<<40); status != fuse.OK {
+		t.Errorf("chargeResize() without quotas = %v, want OK", status)
+	}
+}
+
+func TestSlowFs_ChargeCapacity(t *testing.T) {
+	c := quota.NewCapacity(100)
+	q := quota.New([]quota.Limit{{Kind: quota.UserQuota, ID: 1000, Bytes: 50}})
+	sfs := &SlowFs{}
+	sfs.SetCapacity(c)
+	file := &fuse.Attr{Mode: syscall.S_IFREG | 0644, Size: 0, Nlink: 1, Owner: fuse.Owner{Uid: 1001}}
+
+	if _, status := sfs.chargeGrowth("f", file, 101); status != fuse.Status(syscall.ENOSPC) {
+		t.Errorf("chargeGrowth(101) = %v, want ENOSPC", status)
+	}
+	if _, status := sfs.chargeGrowth("f", file, 80); status != fuse.OK {
+		t.Errorf("chargeGrowth(80) = %v, want OK", status)
+	}
+	file.Size = 80
+	sfs.releaseQuota("f", file)
+	if got, want := c.Used(), units.NumBytes(0); got != want {
+		t.Errorf("Used() after releaseQuota() = %d, want %d", got, want)
+	}
+
+	// Exceeding a quota takes back the charge against the capacity.
+	sfs.SetQuotas(q)
+	file = &fuse.Attr{Mode: syscall.S_IFREG | 0644, Size: 0, Nlink: 1, Owner: fuse.Owner{Uid: 1000}}
+	if _, status := sfs.chargeGrowth("g", file, 60); status != fuse.Status(syscall.EDQUOT) {
+		t.Errorf("chargeGrowth(60) past the quota = %v, want EDQUOT", status)
+	}
+	if got, want := c.Used(), units.NumBytes(0); got != want {
+		t.Errorf("Used() after exceeding the quota = %d, want %d", got, want)
+	}
+}
+
+func TestSlowFs_ReportCapacity(t *testing.T) {
+	c := quota.NewCapacity(10 * 4096)
+	if err := c.Charge(4097); err != nil {
+		t.Fatalf("Charge(4097) = %v, want nil", err)
+	}
+	sfs := &SlowFs{}
+	sfs.SetCapacity(c)
+
+	out := &fuse.StatfsOut{Blocks: 1000, Bfree: 900, Bavail: 800, Bsize: 4096}
+	sfs.reportCapacity(out)
+	if got, want := *out, (fuse.StatfsOut{Blocks: 10, Bfree: 8, Bavail: 8, Bsize: 4096}); got != want {
+		t.Errorf("reportCapacity() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSlowFs_CapacityThroughCreate(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	c := quota.NewCapacity(100)
+	sfs.SetCapacity(c)
+
+	if got, want := createFile(t, sfs, "f", make([]byte, 60)), fuse.OK; got != want {
+		t.Errorf("writing 60 bytes to a new file = %v, want %v", got, want)
+	}
+	if got, want := c.Used(), units.NumBytes(60); got != want {
+		t.Errorf("Used() after writing = %d, want %d", got, want)
+	}
+	if got, want := createFile(t, sfs, "g", make([]byte, 50)), fuse.Status(syscall.ENOSPC); got != want {
+		t.Errorf("writing past the capacity = %v, want %v", got, want)
+	}
+	if status := sfs.Unlink("g", nil); status != fuse.OK {
+		t.Fatalf("Unlink() = %v, want OK", status)
+	}
+	if status := sfs.Unlink("f", nil); status != fuse.OK {
+		t.Fatalf("Unlink() = %v, want OK", status)
+	}
+	if got, want := c.Used(), units.NumBytes(0); got != want {
+		t.Errorf("Used() after unlinking = %d, want %d", got, want)
+	}
+
+	// Renaming over a file frees the file replaced.
+	createFile(t, sfs, "a", make([]byte, 40))
+	createFile(t, sfs, "b", make([]byte, 30))
+	if status := sfs.Rename("a", "b", nil); status != fuse.OK {
+		t.Fatalf("Rename() = %v, want OK", status)
+	}
+	if got, want := c.Used(), units.NumBytes(40); got != want {
+		t.Errorf("Used() after renaming over a file = %d, want %d", got, want)
+	}
+	// Renaming onto another link to the same file removes nothing.
+	if status := sfs.Link("b", "c", nil); status != fuse.OK {
+		t.Fatalf("Link() = %v, want OK", status)
+	}
+	if status := sfs.Rename("b", "c", nil); status != fuse.OK {
+		t.Fatalf("Rename() = %v, want OK", status)
+	}
+	if got, want := c.Used(), units.NumBytes(40); got != want {
+		t.Errorf("Used() after renaming onto a link = %d, want %d", got, want)
+	}
+}
+
+func TestSlowFs_QuotasThroughCreate(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	uid := uint32(os.Getuid())
+	q := quota.New([]quota.Limit{{Kind: quota.UserQuota, ID: uid, Bytes: 100, Files: 10}})
+	sfs.SetQuotas(q)
+
+	if got, want := createFile(t, sfs, "f", make([]byte, 60)), fuse.OK; got != want {
+		t.Errorf("writing 60 bytes to a new file = %v, want %v", got, want)
+	}
+	if got, want := q.Usages()[0].Bytes, units.NumBytes(60); got != want {
+		t.Errorf("bytes used after writing = %d, want %d", got, want)
+	}
+	if got, want := createFile(t, sfs, "g", make([]byte, 50)), fuse.Status(syscall.EDQUOT); got != want {
+		t.Errorf("writing past the quota = %v, want %v", got, want)
+	}
+	for _, name := range []string{"f", "g"} {
+		if status := sfs.Unlink(name, nil); status != fuse.OK {
+			t.Fatalf("Unlink(%q) = %v, want OK", name, status)
+		}
+	}
+	if got, want := q.Usages()[0], (quota.Usage{Limit: q.Usages()[0].Limit}); got != want {
+		t.Errorf("usage after unlinking = %+v, want %+v", got, want)
+	}
+
+	// Renaming over a file frees the file replaced.
+	createFile(t, sfs, "a", make([]byte, 40))
+	createFile(t, sfs, "b", make([]byte, 30))
+	if status := sfs.Rename("a", "b", nil); status != fuse.OK {
+		t.Fatalf("Rename() = %v, want OK", status)
+	}
+	if got, want := q.Usages()[0], (quota.Usage{Limit: q.Usages()[0].Limit, Bytes: 40, Files: 1}); got != want {
+		t.Errorf("usage after renaming over a file = %+v, want %+v", got, want)
+	}
+}
+
+func TestSlowFs_QuotasPerCaller(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	q := quota.New([]quota.Limit{
+		{Kind: quota.UserQuota, ID: 2001, Bytes: 50},
+		{Kind: quota.UserQuota, ID: 2002, Bytes: 50},
+	})
+	sfs.SetQuotas(q)
+
+	// Each caller is charged for the files they create, and for writing to them, whoever owns the
+	// backing files.
+	files := make(map[uint32]nodefs.File)
+	for _, uid := range []uint32{2001, 2002} {
+		context := &fuse.Context{Caller: fuse.Caller{Owner: fuse.Owner{Uid: uid, Gid: uid}}}
+		file, status := sfs.Create(fmt.Sprint(uid), uint32(os.O_WRONLY|os.O_CREATE), 0644, context)
+		if status != fuse.OK {
+			t.Fatalf("Create() as %d = %v, want OK", uid, status)
+		}
+		defer file.Release()
+		if _, status := file.Write(make([]byte, 40), 0); status != fuse.OK {
+			t.Errorf("writing 40 bytes as %d = %v, want OK", uid, status)
+		}
+		files[uid] = file
+	}
+	for i, want := range []quota.Usage{
+		{Limit: q.Usages()[0].Limit, Bytes: 40, Files: 1},
+		{Limit: q.Usages()[1].Limit, Bytes: 40, Files: 1},
+	} {
+		if got := q.Usages()[i]; got != want {
+			t.Errorf("usage after writing = %+v, want %+v", got, want)
+		}
+	}
+	if _, status := files[2001].Write(make([]byte, 20), 40); status != fuse.Status(syscall.EDQUOT) {
+		t.Errorf("writing past 2001's quota = %v, want EDQUOT", status)
+	}
+	if _, status := files[2002].Write(make([]byte, 10), 40); status != fuse.OK {
+		t.Errorf("writing within 2002's quota = %v, want OK", status)
+	}
+
+	// Removing a file frees what it used for whoever created it.
+	if status := sfs.Unlink("2001", nil); status != fuse.OK {
+		t.Fatalf("Unlink() = %v, want OK", status)
+	}
+	if got, want := q.Usages()[0], (quota.Usage{Limit: q.Usages()[0].Limit}); got != want {
+		t.Errorf("usage after unlinking = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/units"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// unlinkedBytes returns how many bytes unlinking the entry attr describes will free: the size of a
+// regular file with no other links, and nothing otherwise.
+func unlinkedBytes(attr *fuse.Attr) units.NumBytes {
+	if attr == nil || attr.Nlink > 1 {
+		return 0
+	}
+	return entryBytes(attr)
+}
+
+// hideUnreclaimed removes the space freed by unlinking files which the simulated devices haven't
+// reclaimed yet from the free space in out.
+func (sfs *SlowFs) hideUnreclaimed(out *fuse.StatfsOut) {
+	var unreclaimed units.NumBytes
+	for _, s := range sfs.schedulers() {
+		unreclaimed += s.UnreclaimedBytes()
+	}
+	hideBytes(out, unreclaimed)
+}
+
+// hideBytes removes numBytes from the free space in out.
+func hideBytes(out *fuse.StatfsOut, numBytes units.NumBytes) {
+	if out == nil || out.Bsize == 0 || numBytes <= 0 {
+		return
+	}
+	blocks := (uint64(numBytes) + uint64(out.Bsize) - 1) / uint64(out.Bsize)
+	if blocks > out.Bfree {
+		blocks = out.Bfree
+	}
+	out.Bfree -= blocks
+	if blocks > out.Bavail {
+		blocks = out.Bavail
+	}
+	out.Bavail -= blocks
+}
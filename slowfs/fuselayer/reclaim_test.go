@@ -0,0 +1,45 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestHideBytes(t *testing.T) {
+	cases := []struct {
+		out      fuse.StatfsOut
+		numBytes units.NumBytes
+		want     fuse.StatfsOut
+	}{
+		{fuse.StatfsOut{Bsize: 4096, Bfree: 100, Bavail: 90}, 0, fuse.StatfsOut{Bsize: 4096, Bfree: 100, Bavail: 90}},
+		{fuse.StatfsOut{Bsize: 4096, Bfree: 100, Bavail: 90}, 4096, fuse.StatfsOut{Bsize: 4096, Bfree: 99, Bavail: 89}},
+		// Partially reclaimed blocks aren't free.
+		{fuse.StatfsOut{Bsize: 4096, Bfree: 100, Bavail: 90}, 4097, fuse.StatfsOut{Bsize: 4096, Bfree: 98, Bavail: 88}},
+		{fuse.StatfsOut{Bsize: 4096, Bfree: 100, Bavail: 90}, 95 * 4096, fuse.StatfsOut{Bsize: 4096, Bfree: 5}},
+		{fuse.StatfsOut{Bsize: 4096, Bfree: 100, Bavail: 90}, units.Gigabyte, fuse.StatfsOut{Bsize: 4096}},
+	}
+
+	for _, c := range cases {
+		got := c.out
+		hideBytes(&got, c.numBytes)
+		if got != c.want {
+			t.Errorf("hideBytes(%+v, %d) gave %+v, want %+v", c.out, c.numBytes, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// replicaFs wraps a FileSystem to keep a read-only replica directory in step with a primary
+// directory, lag behind it, as with asynchronous replication. Changes to the contents, size,
+// permissions and names of files under the primary are applied to the replica, in the order they
+// were made, once they are lag old. Owners, timestamps and extended attributes aren't replicated.
+type replicaFs struct {
+	pathfs.FileSystem
+
+	// The backing directory, and the primary and replica directories within it.
+	root             string
+	primary, replica string
+	lag              time.Duration
+
+	// now tells the time changes are made at, and wait waits until a change is lag old.
+	now  func() time.Time
+	wait func(ctx context.Context, t time.Time) error
+
+	mu      sync.Mutex
+	pending []replicaChange
+	// Signalled when a change is added to an empty queue.
+	wake chan struct{}
+}
+
+// replicaChange is a change made under the primary, waiting to be applied to the replica.
+type replicaChange struct {
+	at   time.Time
+	name string
+
+	// apply makes the change to the file at path in the replica's backing directory.
+	apply func(path string) error
+}
+
+func newReplicaFs(fs pathfs.FileSystem, root, primary, replica string, lag time.Duration) *replicaFs {
+	return &replicaFs{
+		FileSystem: fs,
+		root:       root,
+		primary:    primary,
+		replica:    replica,
+		lag:        lag,
+		now:        time.Now,
+		wait:       sleepUntil,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// SetReplica makes replica, a directory in the mount, a read-only copy of primary which reflects
+// changes to it only after lag. If replica doesn't exist, it starts as a copy of primary, and
+// otherwise as it was left. Changes which haven't been replicated when slowfs exits are lost, as
+// when an asynchronously replicated primary fails. This must be called before the filesystem is
+// mounted. Both directories are relative to the root of the mount, and neither can be inside the
+// other.
+func (sfs *SlowFs) SetReplica(primary, replica string, lag time.Duration) error {
+	primary, replica = mountRelative(primary), mountRelative(replica)
+	if isWithin(primary, replica) || isWithin(replica, primary) {
+		return &os.PathError{Op: "replicate", Path: replica, Err: syscall.EINVAL}
+	}
+	if _, err := os.Lstat(filepath.Join(sfs.root, replica)); os.IsNotExist(err) {
+		if err := copyTree(filepath.Join(sfs.root, primary), filepath.Join(sfs.root, replica)); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	fs := newReplicaFs(sfs.FileSystem, sfs.root, primary, replica, lag)
+	fs.now, fs.wait = sfs.Now, sfs.waitBackground
+	ctx := sfs.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go fs.run(ctx)
+	sfs.FileSystem = fs
+	return nil
+}
+
+// mountRelative returns dir as go-fuse names it, relative to the root of the mount without a
+// leading slash, or "." for the root itself.
+func mountRelative(dir string) string {
+	if dir = strings.TrimPrefix(filepath.Clean("/"+dir), "/"); dir == "" {
+		return "."
+	}
+	return dir
+}
+
+// isWithin returns whether name is dir, or inside dir. Both are relative to the root of the mount.
+func isWithin(dir, name string) bool {
+	return dir == "." || name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// replicaPath returns the path in the backing directory which name, under the primary, is
+// replicated to.
+func (fs *replicaFs) replicaPath(name string) string {
+	return filepath.Join(fs.root, fs.replica, strings.TrimPrefix(name, fs.primary))
+}
+
+// record queues a change to name, under the primary, to be applied to the replica after the lag.
+func (fs *replicaFs) record(name string, apply func(path string) error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.pending = append(fs.pending, replicaChange{at: fs.now(), name: name, apply: apply})
+	if len(fs.pending) == 1 {
+		select {
+		case fs.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run applies changes to the replica as they become lag old, until ctx is done.
+func (fs *replicaFs) run(ctx context.Context) {
+	for {
+		fs.mu.Lock()
+		pending := len(fs.pending) > 0
+		var c replicaChange
+		if pending {
+			c = fs.pending[0]
+		}
+		fs.mu.Unlock()
+
+		if !pending {
+			select {
+			case <-fs.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if fs.wait(ctx, c.at.Add(fs.lag)) != nil {
+			return
+		}
+		if err := c.apply(fs.replicaPath(c.name)); err != nil {
+			log.Printf("couldn't replicate change to %s: %s", c.name, err)
+		}
+
+		fs.mu.Lock()
+		fs.pending = fs.pending[1:]
+		fs.mu.Unlock()
+	}
+}
+
+// backlog returns how many changes haven't been applied to the replica yet.
+func (fs *replicaFs) backlog() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.pending)
+}
+
+// copyFrom returns a change which copies name, as it is when the change is applied, from the
+// primary, for entries which appear in it from elsewhere in the mount.
+func (fs *replicaFs) copyFrom(name string) func(path string) error {
+	return func(path string) error {
+		src := filepath.Join(fs.root, name)
+		if _, err := os.Lstat(src); os.IsNotExist(err) {
+			// It has gone again since.
+			return nil
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		return copyTree(src, path)
+	}
+}
+
+// isWrite returns whether opening a file with flags can change it.
+func isWrite(flags uint32) bool {
+	return flags&syscall.O_ACCMODE != syscall.O_RDONLY || flags&syscall.O_TRUNC != 0
+}
+
+func (fs *replicaFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Chmod(name, mode, context)
+	if status == fuse.OK && isWithin(fs.primary, name) {
+		fs.record(name, func(path string) error {
+			return os.Chmod(path, os.FileMode(mode&07777))
+		})
+	}
+	return status
+}
+
+func (fs *replicaFs) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	return fs.FileSystem.Chown(name, uid, gid, context)
+}
+
+func (fs *replicaFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	return fs.FileSystem.Utimens(name, Atime, Mtime, context)
+}
+
+func (fs *replicaFs) Truncate(name string, size uint64, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Truncate(name, size, context)
+	if status == fuse.OK && isWithin(fs.primary, name) {
+		fs.record(name, func(path string) error {
+			return os.Truncate(path, int64(size))
+		})
+	}
+	return status
+}
+
+func (fs *replicaFs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, oldName) || isWithin(fs.replica, newName) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Link(oldName, newName, context)
+	if status != fuse.OK || !isWithin(fs.primary, newName) {
+		return status
+	}
+	if !isWithin(fs.primary, oldName) {
+		fs.record(newName, fs.copyFrom(newName))
+		return status
+	}
+	oldPath := fs.replicaPath(oldName)
+	fs.record(newName, func(path string) error {
+		return os.Link(oldPath, path)
+	})
+	return status
+}
+
+func (fs *replicaFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Mkdir(name, mode, context)
+	if status == fuse.OK && isWithin(fs.primary, name) {
+		fs.record(name, func(path string) error {
+			return os.Mkdir(path, os.FileMode(mode&07777))
+		})
+	}
+	return status
+}
+
+func (fs *replicaFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Mknod(name, mode, dev, context)
+	if status == fuse.OK && isWithin(fs.primary, name) {
+		fs.record(name, func(path string) error {
+			return syscall.Mknod(path, mode, int(dev))
+		})
+	}
+	return status
+}
+
+func (fs *replicaFs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, oldName) || isWithin(fs.replica, newName) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Rename(oldName, newName, context)
+	if status != fuse.OK {
+		return status
+	}
+	switch oldInPrimary, newInPrimary := isWithin(fs.primary, oldName), isWithin(fs.primary, newName); {
+	case oldInPrimary && newInPrimary:
+		oldPath := fs.replicaPath(oldName)
+		fs.record(newName, func(path string) error {
+			return os.Rename(oldPath, path)
+		})
+	case oldInPrimary:
+		fs.record(oldName, os.RemoveAll)
+	case newInPrimary:
+		fs.record(newName, fs.copyFrom(newName))
+	}
+	return status
+}
+
+func (fs *replicaFs) Rmdir(name string, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Rmdir(name, context)
+	if status == fuse.OK && isWithin(fs.primary, name) {
+		fs.record(name, os.Remove)
+	}
+	return status
+}
+
+func (fs *replicaFs) Unlink(name string, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Unlink(name, context)
+	if status == fuse.OK && isWithin(fs.primary, name) {
+		fs.record(name, os.Remove)
+	}
+	return status
+}
+
+func (fs *replicaFs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	return fs.FileSystem.RemoveXAttr(name, attr, context)
+}
+
+func (fs *replicaFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, name) {
+		return fuse.EROFS
+	}
+	return fs.FileSystem.SetXAttr(name, attr, data, flags, context)
+}
+
+func (fs *replicaFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if isWrite(flags) && isWithin(fs.replica, name) {
+		return nil, fuse.EROFS
+	}
+	file, status := fs.FileSystem.Open(name, flags, context)
+	if status != fuse.OK || !isWrite(flags) || !isWithin(fs.primary, name) {
+		return file, status
+	}
+	if flags&syscall.O_TRUNC != 0 {
+		fs.record(name, func(path string) error {
+			return os.Truncate(path, 0)
+		})
+	}
+	return &replicaFile{File: file, fs: fs, name: name}, status
+}
+
+func (fs *replicaFs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if isWithin(fs.replica, name) {
+		return nil, fuse.EROFS
+	}
+	file, status := fs.FileSystem.Create(name, flags, mode, context)
+	if status != fuse.OK || !isWithin(fs.primary, name) {
+		return file, status
+	}
+	fs.record(name, func(path string) error {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|int(flags&syscall.O_TRUNC), os.FileMode(mode&07777))
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	})
+	return &replicaFile{File: file, fs: fs, name: name}, status
+}
+
+func (fs *replicaFs) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
+	if isWithin(fs.replica, linkName) {
+		return fuse.EROFS
+	}
+	status := fs.FileSystem.Symlink(value, linkName, context)
+	if status == fuse.OK && isWithin(fs.primary, linkName) {
+		fs.record(linkName, func(path string) error {
+			return os.Symlink(value, path)
+		})
+	}
+	return status
+}
+
+// replicaFile is a file under the primary, whose changes are replicated.
+type replicaFile struct {
+	nodefs.File
+
+	fs   *replicaFs
+	name string
+}
+
+func (f *replicaFile) Write(data []byte, off int64) (uint32, fuse.Status) {
+	n, status := f.File.Write(data, off)
+	if status != fuse.OK {
+		return n, status
+	}
+	// go-fuse reuses data's buffer once we return.
+	written := append([]byte(nil), data[:n]...)
+	f.fs.record(f.name, func(path string) error {
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		if _, err := file.WriteAt(written, off); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	})
+	return n, status
+}
+
+func (f *replicaFile) Truncate(size uint64) fuse.Status {
+	status := f.File.Truncate(size)
+	if status == fuse.OK {
+		f.fs.record(f.name, func(path string) error {
+			return os.Truncate(path, int64(size))
+		})
+	}
+	return status
+}
+
+func (f *replicaFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
+	status := f.File.Allocate(off, size, mode)
+	if status == fuse.OK {
+		f.fs.record(f.name, func(path string) error {
+			file, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			if err := fallocate(file, mode, int64(off), int64(size)); err != nil {
+				file.Close()
+				return err
+			}
+			return file.Close()
+		})
+	}
+	return status
+}
+
+func (f *replicaFile) Chmod(perms uint32) fuse.Status {
+	status := f.File.Chmod(perms)
+	if status == fuse.OK {
+		f.fs.record(f.name, func(path string) error {
+			return os.Chmod(path, os.FileMode(perms&07777))
+		})
+	}
+	return status
+}
+
+// copyTree copies the file, symlink or directory at src, and everything in it, to dst.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			value, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(value, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			// Device nodes, sockets and pipes have nothing to copy.
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,240 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// diskFs makes the changes the replica tests need directly on the backing directory.
+type diskFs struct {
+	pathfs.FileSystem
+
+	root string
+}
+
+func (fs *diskFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	return fuse.ToStatus(os.Mkdir(filepath.Join(fs.root, name), os.FileMode(mode)))
+}
+
+func (fs *diskFs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
+	return fuse.ToStatus(os.Rename(filepath.Join(fs.root, oldName), filepath.Join(fs.root, newName)))
+}
+
+func (fs *diskFs) Unlink(name string, context *fuse.Context) fuse.Status {
+	return fuse.ToStatus(os.Remove(filepath.Join(fs.root, name)))
+}
+
+func (fs *diskFs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	f, err := os.OpenFile(filepath.Join(fs.root, name), int(flags)|os.O_CREATE, os.FileMode(mode))
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	return &diskFile{f: f}, fuse.OK
+}
+
+type diskFile struct {
+	nodefs.File
+
+	f *os.File
+}
+
+func (f *diskFile) Write(data []byte, off int64) (uint32, fuse.Status) {
+	n, err := f.f.WriteAt(data, off)
+	return uint32(n), fuse.ToStatus(err)
+}
+
+func (f *diskFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
+	return fuse.ToStatus(fallocate(f.f, mode, int64(off), int64(size)))
+}
+
+func (f *diskFile) Release() {
+	f.f.Close()
+}
+
+// waitForReplica waits for every change made to fs to be replicated.
+func waitForReplica(t *testing.T, fs *replicaFs) {
+	deadline := time.Now().Add(5 * time.Second)
+	for fs.backlog() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d changes still waiting to be replicated", fs.backlog())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplicaFs_Lag(t *testing.T) {
+	root, err := ioutil.TempDir("", "replica_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"primary", "replica"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Mkdir error: %s", err)
+		}
+	}
+
+	const lag = 50 * time.Millisecond
+	fs := newReplicaFs(&diskFs{root: root}, root, "primary", "replica", lag)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fs.run(ctx)
+
+	start := time.Now()
+	if status := fs.Mkdir("primary/dir", 0755, nil); status != fuse.OK {
+		t.Fatalf("Mkdir() = %v, want OK", status)
+	}
+	file, status := fs.Create("primary/dir/a", uint32(os.O_WRONLY), 0644, nil)
+	if status != fuse.OK {
+		t.Fatalf("Create() = _, %v, want _, OK", status)
+	}
+	if _, status := file.Write([]byte("hello"), 0); status != fuse.OK {
+		t.Fatalf("Write() = _, %v, want _, OK", status)
+	}
+	file.Release()
+	if status := fs.Rename("primary/dir/a", "primary/dir/b", nil); status != fuse.OK {
+		t.Fatalf("Rename() = %v, want OK", status)
+	}
+
+	waitForReplica(t, fs)
+	if elapsed := time.Since(start); elapsed < lag {
+		t.Errorf("changes replicated after %s, want at least %s", elapsed, lag)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(root, "replica", "dir", "b"))
+	if err != nil {
+		t.Fatalf("ReadFile error: %s", err)
+	}
+	if got, want := string(data), "hello"; got != want {
+		t.Errorf("replica/dir/b = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(root, "replica", "dir", "a")); !os.IsNotExist(err) {
+		t.Errorf("Stat(replica/dir/a) error = %v, want not exist", err)
+	}
+
+	if status := fs.Unlink("primary/dir/b", nil); status != fuse.OK {
+		t.Fatalf("Unlink() = %v, want OK", status)
+	}
+	waitForReplica(t, fs)
+	if _, err := os.Stat(filepath.Join(root, "replica", "dir", "b")); !os.IsNotExist(err) {
+		t.Errorf("Stat(replica/dir/b) error = %v, want not exist", err)
+	}
+}
+
+func TestReplicaFs_Allocate(t *testing.T) {
+	root, err := ioutil.TempDir("", "replica_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"primary", "replica"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Mkdir error: %s", err)
+		}
+	}
+	fs := newReplicaFs(&diskFs{root: root}, root, "primary", "replica", time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fs.run(ctx)
+
+	file, status := fs.Create("primary/a", uint32(os.O_WRONLY), 0644, nil)
+	if status != fuse.OK {
+		t.Fatalf("Create() = _, %v, want _, OK", status)
+	}
+	defer file.Release()
+	if _, status := file.Write([]byte("hello"), 0); status != fuse.OK {
+		t.Fatalf("Write() = _, %v, want _, OK", status)
+	}
+	// Growing the file and punching a hole in it both reach the replica.
+	if status := file.Allocate(0, 4096, 0); status == fuse.ENOSYS || status == fuse.Status(syscall.EOPNOTSUPP) {
+		t.Skipf("Allocate() = %v, fallocate isn't supported here", status)
+	} else if status != fuse.OK {
+		t.Fatalf("Allocate() = %v, want OK", status)
+	}
+	if status := file.Allocate(0, 2, fallocPunchHole|fallocKeepSize); status != fuse.OK {
+		t.Fatalf("Allocate(punch hole) = %v, want OK", status)
+	}
+
+	waitForReplica(t, fs)
+	data, err := ioutil.ReadFile(filepath.Join(root, "replica", "a"))
+	if err != nil {
+		t.Fatalf("ReadFile error: %s", err)
+	}
+	if got, want := len(data), 4096; got != want {
+		t.Errorf("len(replica/a) = %d, want %d", got, want)
+	}
+	if got, want := string(data[:5]), "\x00\x00llo"; got != want {
+		t.Errorf("replica/a starts %q, want %q", got, want)
+	}
+}
+
+func TestReplicaFs_ReadOnly(t *testing.T) {
+	fs := newReplicaFs(nil, "", "primary", "replica", time.Second)
+
+	_, openStatus := fs.Open("replica/a", uint32(os.O_RDWR), nil)
+	_, truncStatus := fs.Open("replica/a", uint32(os.O_RDONLY|syscall.O_TRUNC), nil)
+	_, createStatus := fs.Create("replica/a", uint32(os.O_WRONLY), 0644, nil)
+	cases := []struct {
+		op     string
+		status fuse.Status
+	}{
+		{"Open(O_RDWR)", openStatus},
+		{"Open(O_TRUNC)", truncStatus},
+		{"Create", createStatus},
+		{"Chmod", fs.Chmod("replica/a", 0600, nil)},
+		{"Mkdir", fs.Mkdir("replica/a", 0755, nil)},
+		{"Rename into", fs.Rename("primary/a", "replica/a", nil)},
+		{"Rename out of", fs.Rename("replica/a", "primary/a", nil)},
+		{"Link", fs.Link("replica/a", "primary/a", nil)},
+		{"Unlink", fs.Unlink("replica/a", nil)},
+		{"Rmdir", fs.Rmdir("replica", nil)},
+	}
+
+	for _, c := range cases {
+		if got, want := c.status, fuse.EROFS; got != want {
+			t.Errorf("%s() = %v, want %v", c.op, got, want)
+		}
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	cases := []struct {
+		dir, name string
+		want      bool
+	}{
+		{"replica", "replica", true},
+		{"replica", "replica/a", true},
+		{"replica", "replicas/a", false},
+		{"replica", "primary/replica", false},
+		{".", "a", true},
+	}
+
+	for _, c := range cases {
+		if got := isWithin(c.dir, c.name); got != c.want {
+			t.Errorf("isWithin(%q, %q) = %t, want %t", c.dir, c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+)
+
+// route sends requests for some set of paths, or all metadata requests, to a scheduler simulating a
+// separate device.
+type route struct {
+	name      string
+	patterns  []string
+	metadata  bool
+	scheduler *scheduler.Scheduler
+}
+
+// RoutePaths sends requests for paths matching any of the given glob patterns to the given
+// scheduler, instead of the default one. This models deployments which place some files, like a
+// journal or write-ahead log, on separate media. Patterns are relative to the root of the mount,
+// and a pattern matching a directory matches everything inside it. Routes are checked in the order
+// they were added. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) RoutePaths(name string, patterns []string, s *scheduler.Scheduler) {
+	sfs.routes = append(sfs.routes, route{
+		name:      name,
+		patterns:  patterns,
+		scheduler: s,
+	})
+}
+
+// RouteMetadata sends metadata requests for every path to the given scheduler, instead of the
+// default one or any path route. This models deployments which keep metadata on separate, usually
+// faster, media, like ZFS special vdevs. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) RouteMetadata(name string, s *scheduler.Scheduler) {
+	sfs.routes = append(sfs.routes, route{
+		name:      name,
+		metadata:  true,
+		scheduler: s,
+	})
+}
+
+// schedulerForRequest returns the scheduler responsible for the given request.
+func (sfs *SlowFs) schedulerForRequest(req *scheduler.Request) *scheduler.Scheduler {
+	if req.Type.IsMetadata() {
+		for _, r := range sfs.routes {
+			if r.metadata {
+				return r.scheduler
+			}
+		}
+	}
+	return sfs.schedulerFor(req.Path)
+}
+
+// routesMetadata returns whether metadata requests for path go to a different device than its data.
+func (sfs *SlowFs) routesMetadata(path string) bool {
+	for _, r := range sfs.routes {
+		if r.metadata {
+			return r.scheduler != sfs.schedulerFor(path)
+		}
+	}
+	return false
+}
+
+// schedulers returns every scheduler requests may be sent to.
+func (sfs *SlowFs) schedulers() []*scheduler.Scheduler {
+	schedulers := []*scheduler.Scheduler{sfs.scheduler}
+	seen := map[*scheduler.Scheduler]bool{sfs.scheduler: true}
+	for _, r := range sfs.routes {
+		if !seen[r.scheduler] {
+			seen[r.scheduler] = true
+			schedulers = append(schedulers, r.scheduler)
+		}
+	}
+	return schedulers
+}
+
+// schedulerFor returns the scheduler responsible for data at the given path.
+func (sfs *SlowFs) schedulerFor(path string) *scheduler.Scheduler {
+	for _, r := range sfs.routes {
+		for _, pattern := range r.patterns {
+			if slowfs.MatchesPath(pattern, path) {
+				return r.scheduler
+			}
+		}
+	}
+	return sfs.scheduler
+}
+
+// Device returns the scheduler simulating the device with the given route name, or the default
+// device if name is empty, so that it can be inspected or reconfigured while mounted.
+func (sfs *SlowFs) Device(name string) (*scheduler.Scheduler, error) {
+	if name == "" {
+		return sfs.scheduler, nil
+	}
+	for _, r := range sfs.routes {
+		if r.name == name {
+			return r.scheduler, nil
+		}
+	}
+	return nil, fmt.Errorf("no device %q", name)
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"os"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_SchedulerForRequest(t *testing.T) {
+	data := scheduler.New(&slowfs.HDD7200RpmDeviceConfig)
+	journal := scheduler.New(&slowfs.HDD7200RpmDeviceConfig)
+	metadata := scheduler.New(&slowfs.HDD7200RpmDeviceConfig)
+	sfs := &SlowFs{scheduler: data}
+	sfs.RoutePaths("journal", []string{"wal"}, journal)
+	sfs.RouteMetadata("metadata", metadata)
+
+	cases := []struct {
+		req      *scheduler.Request
+		want     *scheduler.Scheduler
+		wantName string
+	}{
+		{&scheduler.Request{Type: scheduler.ReadRequest, Path: "a"}, data, "data"},
+		{&scheduler.Request{Type: scheduler.WriteRequest, Path: "wal/1"}, journal, "journal"},
+		{&scheduler.Request{Type: scheduler.CloseRequest, Path: "wal/1"}, journal, "journal"},
+		{&scheduler.Request{Type: scheduler.MetadataRequest, Path: "a"}, metadata, "metadata"},
+		{&scheduler.Request{Type: scheduler.SetAttrRequest, Path: "wal/1"}, metadata, "metadata"},
+		{&scheduler.Request{Type: scheduler.FsyncRequest, Path: "a"}, data, "data"},
+		{&scheduler.Request{Type: scheduler.JournalCommitRequest, Path: "a"}, metadata, "metadata"},
+	}
+
+	for _, c := range cases {
+		if got := sfs.schedulerForRequest(c.req); got != c.want {
+			t.Errorf("schedulerForRequest(%+v) isn't the %s scheduler", c.req, c.wantName)
+		}
+	}
+}
+
+func TestSlowFs_FsyncCommitsJournalOnMetadataDevice(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	clock := sfs.VirtualClock()
+	config := slowfs.SSDDeviceConfig
+	config.JournalCommitTime = time.Second
+	metadata := scheduler.New(&config)
+	metadata.SetClock(clock)
+	sfs.RouteMetadata("metadata", metadata)
+
+	file, status := sfs.Create("a", uint32(os.O_WRONLY|os.O_CREATE), 0644, nil)
+	if status != fuse.OK {
+		t.Fatalf("Create(a) = %v, want OK", status)
+	}
+	defer file.Release()
+
+	// Fsyncs commit the journal on the metadata device, and fdatasyncs leave it.
+	cases := []struct {
+		flags      int
+		wantCommit bool
+	}{
+		{0, true},
+		{fsyncFdatasync, false},
+	}
+
+	for _, c := range cases {
+		before := clock.Elapsed()
+		if got := file.Fsync(c.flags); got != fuse.OK {
+			t.Fatalf("Fsync(%d) = %v, want OK", c.flags, got)
+		}
+		if got, want := clock.Elapsed()-before >= time.Second, c.wantCommit; got != want {
+			t.Errorf("Fsync(%d) took %s, want committing the journal %t", c.flags, clock.Elapsed()-before, want)
+		}
+	}
+}
+
+func TestSlowFs_Device(t *testing.T) {
+	data := scheduler.New(&slowfs.HDD7200RpmDeviceConfig)
+	journal := scheduler.New(&slowfs.HDD7200RpmDeviceConfig)
+	sfs := &SlowFs{scheduler: data}
+	sfs.RoutePaths("journal", []string{"wal"}, journal)
+
+	cases := []struct {
+		name      string
+		want      *scheduler.Scheduler
+		shouldErr bool
+	}{
+		{"", data, false},
+		{"journal", journal, false},
+		{"metadata", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := sfs.Device(c.name)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("Device(%q) = %p, %v, want %p, error %t", c.name, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestSlowFs_PathDevices(t *testing.T) {
+	data := scheduler.New(&slowfs.HDD7200RpmDeviceConfig)
+	ssd := scheduler.New(&slowfs.SSDDeviceConfig)
+	sfs := &SlowFs{scheduler: data}
+	// Rules naming the same config share one device, and the first matching rule wins.
+	sfs.RoutePaths("ssd", []string{"fast"}, ssd)
+	sfs.RoutePaths("hdd", []string{"fast/archive"}, data)
+	sfs.RoutePaths("ssd", []string{"*.db"}, ssd)
+
+	cases := []struct {
+		path string
+		want *scheduler.Scheduler
+	}{
+		{"fast/a", ssd},
+		{"fast/archive/a", ssd},
+		{"x.db", ssd},
+		{"slow/a", data},
+	}
+	for _, c := range cases {
+		if got := sfs.schedulerFor(c.path); got != c.want {
+			t.Errorf("schedulerFor(%q) = %p, want %p", c.path, got, c.want)
+		}
+	}
+
+	if got, want := strings.Count(string(sfs.Stats()), "ssd_queued"), 1; got != want {
+		t.Errorf("stats report ssd_queued %d times, want %d", got, want)
+	}
+}
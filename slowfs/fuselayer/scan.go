@@ -0,0 +1,191 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// scanner simulates an antivirus or indexing service sharing the device: it reads files through
+// once they've been left alone for a while after being created or modified, taking bandwidth from
+// everything else, and holds up opens, as on-access scanners do.
+type scanner struct {
+	// How long after a file was last modified it's scanned, or zero if files aren't scanned.
+	after time.Duration
+	// How long every open is held up for.
+	openDelay time.Duration
+
+	mu sync.Mutex
+	// When each file waiting to be scanned was last modified.
+	modified map[string]time.Time
+	// The file being scanned, if any, and when its scan finishes. Opening it waits for the scan.
+	scanning   string
+	scanDoneAt time.Time
+	// Signalled when a file is modified.
+	wake chan struct{}
+}
+
+// SetScanning simulates an antivirus or indexing service. Files are read through from start to end,
+// on the device storing them, one at a time, once after is up since they were last created or
+// modified, and opening a file waits for its scan to finish. Every open is also held up by
+// openDelay. Either can be zero to disable it. This must be called before the filesystem is
+// mounted.
+func (sfs *SlowFs) SetScanning(after, openDelay time.Duration) {
+	if after <= 0 && openDelay <= 0 {
+		sfs.scanner = nil
+		return
+	}
+	sfs.scanner = &scanner{
+		after:     after,
+		openDelay: openDelay,
+		modified:  make(map[string]time.Time),
+		wake:      make(chan struct{}, 1),
+	}
+	if after > 0 {
+		go sfs.runScanner(sfs.scanner)
+	}
+}
+
+// scanModified notes that path has been created or modified, so needs scanning again.
+func (sfs *SlowFs) scanModified(path string) {
+	s := sfs.scanner
+	if s == nil || s.after <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.modified[path] = sfs.Now()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the file due to be scanned soonest, and when it was last modified.
+func (s *scanner) next() (string, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var path string
+	var modified time.Time
+	for p, t := range s.modified {
+		if path == "" || t.Before(modified) {
+			path, modified = p, t
+		}
+	}
+	return path, modified, path != ""
+}
+
+// take removes path from the files waiting to be scanned, unless it has been modified again since
+// modified, and returns whether it did.
+func (s *scanner) take(path string, modified time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.modified[path]; !ok || !t.Equal(modified) {
+		return false
+	}
+	delete(s.modified, path)
+	return true
+}
+
+// runScanner scans files as they become due until the filesystem shuts down.
+func (sfs *SlowFs) runScanner(s *scanner) {
+	ctx := sfs.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for {
+		path, modified, ok := s.next()
+		if !ok {
+			select {
+			case <-s.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if sfs.waitBackground(ctx, modified.Add(s.after)) != nil {
+			return
+		}
+		if !s.take(path, modified) {
+			continue
+		}
+		if sfs.scan(ctx, s, path) != nil {
+			return
+		}
+	}
+}
+
+// scan reads the file at path through, as it is now, and waits until the device has finished. It
+// returns an error only if ctx is done.
+func (sfs *SlowFs) scan(ctx context.Context, s *scanner, path string) error {
+	info, err := os.Stat(filepath.Join(sfs.root, path))
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || sfs.isPassthrough() {
+		// It's gone again, or there's nothing to read.
+		return nil
+	}
+	req := &scheduler.Request{
+		Type:      scheduler.ReadRequest,
+		Timestamp: sfs.Now(),
+		Path:      path,
+		Size:      units.NumBytes(info.Size()),
+	}
+	cost, err := sfs.schedulerForRequest(req).ScheduleCost(ctx, req)
+	if err != nil {
+		return err
+	}
+	done := req.Timestamp.Add(cost.Total())
+
+	s.mu.Lock()
+	s.scanning, s.scanDoneAt = path, done
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.scanning = ""
+		s.mu.Unlock()
+	}()
+	return sfs.waitBackground(ctx, done)
+}
+
+// holdOpen waits for any scan of path in progress to finish, and then for the open delay. It
+// returns EINTR if the filesystem shuts down first.
+func (sfs *SlowFs) holdOpen(path string) fuse.Status {
+	s := sfs.scanner
+	if s == nil {
+		return fuse.OK
+	}
+	ctx := sfs.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s.mu.Lock()
+	until := sfs.Now()
+	if s.scanning == path && s.scanDoneAt.After(until) {
+		until = s.scanDoneAt
+	}
+	s.mu.Unlock()
+	if err := sfs.waitUntil(ctx, until.Add(s.openDelay)); err != nil {
+		return contextStatus(err)
+	}
+	return fuse.OK
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_ScanModified(t *testing.T) {
+	root, err := ioutil.TempDir("", "scan_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+
+	config := slowfs.SSDDeviceConfig
+	s := scheduler.New(&config)
+	scans := make(chan scheduler.Request, 10)
+	s.AddScheduleHook(func(c *scheduler.ScheduledRequest) {
+		scans <- *c.Request
+	})
+	sfs := NewSlowFs(root, s)
+	defer sfs.Shutdown()
+	const after = 20 * time.Millisecond
+	sfs.SetScanning(after, 0)
+
+	modified := time.Now()
+	sfs.scanModified("a")
+	// Directories and files which have gone again aren't scanned.
+	sfs.scanModified("b")
+	select {
+	case req := <-scans:
+		if got, want := req.Timestamp.Sub(modified), after; got < want {
+			t.Errorf("scan started %s after modification, want at least %s", got, want)
+		}
+		if got, want := req, (scheduler.Request{Type: scheduler.ReadRequest, Timestamp: req.Timestamp, Path: "a", Size: 4096}); got != want {
+			t.Errorf("scan = %+v, want %+v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("file wasn't scanned")
+	}
+	select {
+	case req := <-scans:
+		t.Errorf("unexpected scan %+v", req)
+	case <-time.After(2 * after):
+	}
+}
+
+func TestSlowFs_HoldOpen(t *testing.T) {
+	config := slowfs.SSDDeviceConfig
+	sfs := NewSlowFs("", scheduler.New(&config))
+	defer sfs.Shutdown()
+	const openDelay = 5 * time.Millisecond
+	sfs.SetScanning(0, openDelay)
+
+	sfs.scanner.scanning, sfs.scanner.scanDoneAt = "a", time.Now().Add(30*time.Millisecond)
+	cases := []struct {
+		path string
+		want time.Duration
+	}{
+		{"a", 35 * time.Millisecond},
+		{"b", openDelay},
+	}
+
+	for _, c := range cases {
+		start := time.Now()
+		if status := sfs.holdOpen(c.path); status != fuse.OK {
+			t.Errorf("holdOpen(%q) = %v, want OK", c.path, status)
+		}
+		if got := time.Since(start); got < c.want {
+			t.Errorf("holdOpen(%q) took %s, want at least %s", c.path, got, c.want)
+		}
+	}
+}
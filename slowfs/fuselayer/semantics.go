@@ -0,0 +1,59 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+const (
+	// fatTimestampGranularity is how precisely FAT filesystems store modification times.
+	fatTimestampGranularity = 2 * time.Second
+	// fatMaxFileSize is the largest file FAT filesystems can hold.
+	fatMaxFileSize = 4*units.Gibibyte - 1
+)
+
+// SetSemantics makes the filesystem follow the rules of another filesystem, as well as simulating
+// its timing. This must be called before the filesystem is mounted, and before
+// SetTimestampGranularity or SetMaxFileSize if they should override the semantics' limits.
+func (sfs *SlowFs) SetSemantics(semantics slowfs.Semantics) {
+	switch semantics {
+	case slowfs.FatSemantics:
+		sfs.FileSystem = newFatFs(sfs.FileSystem, sfs.root)
+		sfs.timestampGranularity = fatTimestampGranularity
+		sfs.maxFileSize = fatMaxFileSize
+		sfs.fixedOwnership = true
+	}
+}
+
+// SetMaxFileSize makes writes, truncates and allocations which would grow a file past size bytes fail
+// with EFBIG, as on filesystems with 32 bit offsets. Zero removes the limit. This must be called
+// before the filesystem is mounted.
+func (sfs *SlowFs) SetMaxFileSize(size units.NumBytes) {
+	sfs.maxFileSize = size
+}
+
+// checkFileSize returns EFBIG if a file may not grow to size bytes, and OK otherwise.
+func (sfs *SlowFs) checkFileSize(size uint64) fuse.Status {
+	if sfs.maxFileSize > 0 && size > uint64(sfs.maxFileSize) {
+		return fuse.Status(syscall.EFBIG)
+	}
+	return fuse.OK
+}
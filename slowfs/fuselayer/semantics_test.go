@@ -0,0 +1,97 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"os"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_CheckFileSize(t *testing.T) {
+	sfs := &SlowFs{}
+	sfs.SetSemantics(slowfs.FatSemantics)
+
+	cases := []struct {
+		size uint64
+		want fuse.Status
+	}{
+		{0, fuse.OK},
+		{1<<32 - 1, fuse.OK},
+		{1 << 32, fuse.Status(syscall.EFBIG)},
+	}
+
+	for _, c := range cases {
+		if got := sfs.checkFileSize(c.size); got != c.want {
+			t.Errorf("checkFileSize(%d) = %v, want %v", c.size, got, c.want)
+		}
+	}
+
+	sfs.SetMaxFileSize(2 * units.Gigabyte)
+	if got, want := sfs.checkFileSize(2000000001), fuse.Status(syscall.EFBIG); got != want {
+		t.Errorf("checkFileSize(2000000001) with a 2GB limit = %v, want %v", got, want)
+	}
+
+	sfs.SetMaxFileSize(0)
+	if got := sfs.checkFileSize(1 << 40); got != fuse.OK {
+		t.Errorf("checkFileSize(%d) without a limit = %v, want OK", uint64(1<<40), got)
+	}
+}
+
+func TestSlowFs_MaxFileSizeThroughCreate(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	sfs.SetMaxFileSize(100)
+
+	cases := []struct {
+		name string
+		size int
+		want fuse.Status
+	}{
+		{"a", 100, fuse.OK},
+		{"b", 101, fuse.Status(syscall.EFBIG)},
+	}
+
+	for _, c := range cases {
+		if got := createFile(t, sfs, c.name, make([]byte, c.size)); got != c.want {
+			t.Errorf("writing %d bytes to created file %q = %v, want %v", c.size, c.name, got, c.want)
+		}
+	}
+}
+
+func TestSlowFs_FatSemanticsThroughCreate(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	sfs.SetSemantics(slowfs.FatSemantics)
+	sfs.SetMaxFileSize(100)
+
+	file, status := sfs.Create("a", uint32(os.O_WRONLY|os.O_CREATE), 0644, nil)
+	if status != fuse.OK {
+		t.Fatalf("Create(a) = %v, want OK", status)
+	}
+	defer file.Release()
+
+	if _, got := file.Write(make([]byte, 101), 0); got != fuse.Status(syscall.EFBIG) {
+		t.Errorf("Write of 101 bytes = %v, want %v", got, fuse.Status(syscall.EFBIG))
+	}
+	if got := file.Chmod(0600); got != fuse.EPERM {
+		t.Errorf("Chmod(0600) = %v, want %v", got, fuse.EPERM)
+	}
+	if got := file.Chown(uint32(os.Getuid()), uint32(os.Getgid())); got != fuse.EPERM {
+		t.Errorf("Chown = %v, want %v", got, fuse.EPERM)
+	}
+}
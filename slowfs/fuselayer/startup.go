@@ -0,0 +1,47 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// SetStartupDelay makes the mount take delay to become ready, counting from now, as if the storage
+// behind it were still coming up. Until then, every operation fails with ENOTCONN, except on the
+// stats and control files. This must be called once the filesystem is mounted, before it serves
+// any operations.
+func (sfs *SlowFs) SetStartupDelay(delay time.Duration) {
+	if delay <= 0 {
+		sfs.readyAt = time.Time{}
+		return
+	}
+	sfs.readyAt = time.Now().Add(delay)
+}
+
+// Ready returns whether the mount has finished starting up.
+func (sfs *SlowFs) Ready() bool {
+	return sfs.readyAt.IsZero() || !time.Now().Before(sfs.readyAt)
+}
+
+// checkReady returns ENOTCONN while the mount is starting up, or OK once it is ready.
+func (sfs *SlowFs) checkReady() fuse.Status {
+	if sfs.Ready() {
+		return fuse.OK
+	}
+	return fuse.Status(syscall.ENOTCONN)
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/faults"
+	"slowfs/slowfs/scheduler"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_StartupDelay(t *testing.T) {
+	cases := []struct {
+		delay time.Duration
+		want  fuse.Status
+	}{
+		{0, fuse.OK},
+		{-time.Second, fuse.OK},
+		{time.Hour, fuse.Status(syscall.ENOTCONN)},
+	}
+
+	for _, c := range cases {
+		sfs := NewSlowFs("", scheduler.New(&slowfs.HDD7200RpmDeviceConfig))
+		sfs.SetStartupDelay(c.delay)
+		if got, want := sfs.Ready(), c.want == fuse.OK; got != want {
+			t.Errorf("delay %s: Ready() = %t, want %t", c.delay, got, want)
+		}
+		if got, want := sfs.injectFault(faults.ReadOp, "a"), c.want; got != want {
+			t.Errorf("delay %s: injectFault = %v, want %v", c.delay, got, want)
+		}
+		if _, got := sfs.injectReadFault("a", 10); got != c.want {
+			t.Errorf("delay %s: injectReadFault = %v, want %v", c.delay, got, c.want)
+		}
+		if _, got := sfs.injectWriteFault("a", 10); got != c.want {
+			t.Errorf("delay %s: injectWriteFault = %v, want %v", c.delay, got, c.want)
+		}
+	}
+
+	// Once the delay has passed, the mount is ready.
+	sfs := NewSlowFs("", scheduler.New(&slowfs.HDD7200RpmDeviceConfig))
+	sfs.SetStartupDelay(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if !sfs.Ready() {
+		t.Errorf("Ready() = false after the startup delay, want true")
+	}
+}
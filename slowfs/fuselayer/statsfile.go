@@ -0,0 +1,85 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+// StatsFileName is the name of a virtual, read-only file in the root of the mount which reports
+// statistics about the simulation. It doesn't exist in the backing directory and isn't listed when
+// reading the root directory. Accessing it takes no simulated time.
+const StatsFileName = ".slowfs_stats"
+
+// Stats returns the statistics reported by the stats file, one "name value" pair per line.
+func (sfs *SlowFs) Stats() []byte {
+	var buf bytes.Buffer
+	stats := sfs.scheduler.QueueStats()
+	fmt.Fprintf(&buf, "queued %d\n", stats.Queued)
+	fmt.Fprintf(&buf, "inflight %d\n", stats.InFlight)
+	// Several routes may lead to the same device.
+	seen := make(map[string]bool)
+	for _, r := range sfs.routes {
+		if seen[r.name] {
+			continue
+		}
+		seen[r.name] = true
+		stats := r.scheduler.QueueStats()
+		fmt.Fprintf(&buf, "%s_queued %d\n", r.name, stats.Queued)
+		fmt.Fprintf(&buf, "%s_inflight %d\n", r.name, stats.InFlight)
+	}
+	paused := 0
+	if sfs.Paused() {
+		paused = 1
+	}
+	fmt.Fprintf(&buf, "paused %d\n", paused)
+	drift := sfs.DriftStats()
+	fmt.Fprintf(&buf, "drift_samples %d\n", drift.Samples)
+	fmt.Fprintf(&buf, "drift_mean_ns %d\n", drift.Mean)
+	fmt.Fprintf(&buf, "drift_max_ns %d\n", drift.Max)
+	fmt.Fprintf(&buf, "drift_overruns %d\n", drift.Overruns)
+	fmt.Fprintf(&buf, "drift_compensation_ns %d\n", drift.Compensation)
+	if sfs.clock != nil {
+		fmt.Fprintf(&buf, "simulated_ns %d\n", sfs.clock.Elapsed())
+	}
+	return buf.Bytes()
+}
+
+func (sfs *SlowFs) statsFileAttr() *fuse.Attr {
+	attr := &fuse.Attr{
+		Mode: syscall.S_IFREG | 0444,
+		Size: uint64(len(sfs.Stats())),
+	}
+	now := time.Now()
+	attr.SetTimes(&now, &now, &now)
+	return attr
+}
+
+func (sfs *SlowFs) openStatsFile(flags uint32) (nodefs.File, fuse.Status) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, fuse.EACCES
+	}
+	// The contents change constantly, so bypass the kernel's page cache and size checks.
+	return &nodefs.WithFlags{
+		File:      nodefs.NewDataFile(sfs.Stats()),
+		FuseFlags: fuse.FOPEN_DIRECT_IO,
+	}, fuse.OK
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"path/filepath"
+	"slowfs/slowfs/scheduler"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// SetSync makes every write durable before it returns, as on a mount with the sync option, by
+// following it with an fsync of its file. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetSync(sync bool) {
+	sfs.sync = sync
+}
+
+// SetDirSync makes every change to a directory, like creating or removing an entry, durable before
+// it returns, as on a mount with the dirsync option, by following it with an fsync of the
+// directory. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetDirSync(dirSync bool) {
+	sfs.dirSync = dirSync
+}
+
+// syncWrite makes a successful write to path durable, if writes are synchronous.
+func (sfs *SlowFs) syncWrite(path string, status fuse.Status) fuse.Status {
+	if !sfs.sync || status != fuse.OK {
+		return status
+	}
+	return sfs.waitFsync(nil, &scheduler.Request{
+		Type:      scheduler.FsyncRequest,
+		Timestamp: time.Now(),
+		Path:      path,
+	})
+}
+
+// syncDir makes a successful change to the directory containing path durable, if directory
+// changes are synchronous.
+func (sfs *SlowFs) syncDir(path string, status fuse.Status) fuse.Status {
+	if !sfs.dirSync || status != fuse.OK {
+		return status
+	}
+	dir := filepath.Dir(path)
+	if dir == "." {
+		dir = ""
+	}
+	return sfs.waitFsync(nil, &scheduler.Request{
+		Type:      scheduler.FsyncRequest,
+		Timestamp: time.Now(),
+		Path:      dir,
+	})
+}
+
+// waitFsync waits for req, an fsync or fdatasync made by caller, like waitAs. When metadata is kept
+// on a separate device, an fsync then commits the journal on that device, since its data device
+// only holds the file's data.
+func (sfs *SlowFs) waitFsync(caller *fuse.Caller, req *scheduler.Request) fuse.Status {
+	status := sfs.waitAs(caller, req)
+	if status != fuse.OK || req.Type != scheduler.FsyncRequest || !sfs.routesMetadata(req.Path) {
+		return status
+	}
+	return sfs.waitAs(caller, &scheduler.Request{
+		Type:      scheduler.JournalCommitRequest,
+		Timestamp: time.Now(),
+		Path:      req.Path,
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_SyncAndDirSync(t *testing.T) {
+	cases := []struct {
+		desc     string
+		enabled  bool
+		status   fuse.Status
+		wantSync bool
+	}{
+		{"enabled", true, fuse.OK, true},
+		{"disabled", false, fuse.OK, false},
+		{"failed operation", true, fuse.EIO, false},
+	}
+
+	for _, c := range cases {
+		sfs := NewSlowFs("", scheduler.New(&slowfs.HDD7200RpmDeviceConfig))
+		sfs.SetSync(c.enabled)
+		sfs.SetDirSync(c.enabled)
+
+		if got, want := sfs.syncWrite("dir/file", c.status), c.status; got != want {
+			t.Errorf("%s: syncWrite = %v, want %v", c.desc, got, want)
+		}
+		last, ok := sfs.lastOps.get("dir/file")
+		if got := ok && last.op == scheduler.FsyncRequest; got != c.wantSync {
+			t.Errorf("%s: file fsynced after write = %t, want %t", c.desc, got, c.wantSync)
+		}
+
+		if got, want := sfs.syncDir("dir/file", c.status), c.status; got != want {
+			t.Errorf("%s: syncDir = %v, want %v", c.desc, got, want)
+		}
+		last, ok = sfs.lastOps.get("dir")
+		if got := ok && last.op == scheduler.FsyncRequest; got != c.wantSync {
+			t.Errorf("%s: directory fsynced after change = %t, want %t", c.desc, got, c.wantSync)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits how fast data is read and written across the whole mount, whichever devices
+// and files it goes to. A nil tokenBucket doesn't limit it.
+type tokenBucket struct {
+	// How many bytes per second the bucket refills at, and how many it holds when full.
+	rate, burst units.NumBytes
+
+	mu sync.Mutex
+	// How many bytes can go through without waiting, as of last. Requests which don't fit take the
+	// bucket negative, so that later ones wait behind them.
+	tokens float64
+	last   time.Time
+}
+
+// SetBandwidthLimit limits how many bytes per second can be read and written across the whole
+// mount, on top of each request's own simulated cost, with bursts of up to burst bytes going
+// through at once. A rate of zero removes the limit. This must be called before the filesystem is
+// mounted.
+func (sfs *SlowFs) SetBandwidthLimit(rate, burst units.NumBytes) {
+	if rate <= 0 {
+		sfs.throttle = nil
+		return
+	}
+	sfs.throttle = &tokenBucket{rate: rate, burst: burst}
+}
+
+// delay takes n bytes from the bucket at t, returning how long after t they are available.
+func (b *tokenBucket) delay(t time.Time, n units.NumBytes) time.Duration {
+	if b == nil || n <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if elapsed := t.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * float64(b.rate)
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+		b.last = t
+	}
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// throttledBytes returns how many bytes of data a request with the given cost moves, which the
+// bandwidth limit applies to. Reads served from memory don't count.
+func throttledBytes(req *scheduler.Request, cost scheduler.Cost) units.NumBytes {
+	switch {
+	case req.Type == scheduler.WriteRequest:
+		return req.Size
+	case req.Type == scheduler.ReadRequest && cost.Transfer > 0:
+		return req.Size
+	default:
+		return 0
+	}
+}
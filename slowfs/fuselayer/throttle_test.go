@@ -0,0 +1,70 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Delay(t *testing.T) {
+	start := time.Unix(1000, 0)
+	b := &tokenBucket{rate: 100 * units.Byte, burst: 100 * units.Byte}
+
+	// The bucket starts full, then requests which don't fit wait for it to refill, in turn.
+	cases := []struct {
+		t    time.Time
+		n    units.NumBytes
+		want time.Duration
+	}{
+		{start, 100, 0},
+		{start, 50, 500 * time.Millisecond},
+		{start, 50, time.Second},
+		{start.Add(2 * time.Second), 50, 0},
+		{start.Add(time.Hour), 100, 0},
+		{start.Add(time.Hour), 0, 0},
+		{start.Add(time.Hour), 1, 10 * time.Millisecond},
+	}
+	for _, c := range cases {
+		if got, want := b.delay(c.t, c.n), c.want; got != want {
+			t.Errorf("delay(%s, %d) = %s, want %s", c.t.Sub(start), c.n, got, want)
+		}
+	}
+
+	var unlimited *tokenBucket
+	if got, want := unlimited.delay(start, units.Gibibyte), time.Duration(0); got != want {
+		t.Errorf("nil bucket delay = %s, want %s", got, want)
+	}
+}
+
+func TestThrottledBytes(t *testing.T) {
+	cases := []struct {
+		req  *scheduler.Request
+		cost scheduler.Cost
+		want units.NumBytes
+	}{
+		{&scheduler.Request{Type: scheduler.WriteRequest, Size: 10}, scheduler.Cost{}, 10},
+		{&scheduler.Request{Type: scheduler.ReadRequest, Size: 10}, scheduler.Cost{Transfer: time.Millisecond}, 10},
+		{&scheduler.Request{Type: scheduler.ReadRequest, Size: 10}, scheduler.Cost{Fixed: time.Microsecond}, 0},
+		{&scheduler.Request{Type: scheduler.ReaddirRequest, Size: 10}, scheduler.Cost{Transfer: time.Millisecond}, 0},
+	}
+	for _, c := range cases {
+		if got, want := throttledBytes(c.req, c.cost), c.want; got != want {
+			t.Errorf("throttledBytes(%+v, %+v) = %d, want %d", c.req, c.cost, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// SetTimingTick makes every operation start and finish on a multiple of tick, for reproducible
+// timing. Requests are scheduled as if they arrived at the start of the tick they arrived in, and
+// complete at the end of the tick they're modeled to complete in. So small differences in when
+// requests arrive and how precisely the host's timers fire, which vary between machines and
+// architectures, don't change the simulated timeline, as long as they stay within a tick. A tick of
+// zero disables this. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetTimingTick(tick time.Duration) {
+	sfs.timingTick = tick
+}
+
+// quantizeStart returns when a request arriving at t is scheduled as arriving.
+func (sfs *SlowFs) quantizeStart(t time.Time) time.Time {
+	if sfs.timingTick <= 0 {
+		return t
+	}
+	return t.Truncate(sfs.timingTick)
+}
+
+// quantizeDuration rounds an operation's modeled duration up to a whole number of ticks.
+func (sfs *SlowFs) quantizeDuration(d time.Duration) time.Duration {
+	if sfs.timingTick <= 0 {
+		return d
+	}
+	if r := d % sfs.timingTick; r > 0 {
+		return units.DurationAdd(d, sfs.timingTick-r)
+	}
+	return d
+}
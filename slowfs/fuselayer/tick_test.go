@@ -0,0 +1,49 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestSlowFs_TimingTick(t *testing.T) {
+	start := time.Unix(1000, 0)
+	cases := []struct {
+		tick         time.Duration
+		t            time.Time
+		d            time.Duration
+		wantStart    time.Time
+		wantDuration time.Duration
+	}{
+		{0, start.Add(1234), 5678, start.Add(1234), 5678},
+		{time.Millisecond, start.Add(1234), 5678, start, time.Millisecond},
+		{time.Millisecond, start.Add(time.Millisecond), time.Millisecond, start.Add(time.Millisecond), time.Millisecond},
+		{time.Millisecond, start.Add(2500 * time.Microsecond), 1500 * time.Microsecond, start.Add(2 * time.Millisecond), 2 * time.Millisecond},
+		{time.Millisecond, start, units.MaxDuration, start, units.MaxDuration},
+	}
+
+	for _, c := range cases {
+		sfs := &SlowFs{}
+		sfs.SetTimingTick(c.tick)
+		if got, want := sfs.quantizeStart(c.t), c.wantStart; !got.Equal(want) {
+			t.Errorf("tick %s: quantizeStart(%s) = %s, want %s", c.tick, c.t, got, want)
+		}
+		if got, want := sfs.quantizeDuration(c.d), c.wantDuration; got != want {
+			t.Errorf("tick %s: quantizeDuration(%s) = %s, want %s", c.tick, c.d, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// SetTimestampGranularity makes the filesystem store and report timestamps rounded down to a
+// multiple of granularity, like the 2 seconds of FAT, since tools which compare modification
+// times often misbehave on coarse filesystems. Zero keeps the backing directory's granularity.
+// This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetTimestampGranularity(granularity time.Duration) {
+	sfs.timestampGranularity = granularity
+}
+
+// SetNoAtime makes reading files leave their access times alone where possible, as if mounted with
+// noatime. Backing files not owned by slowfs's user still have their access times updated as the
+// backing directory's mount options say. This must be called before the filesystem is mounted.
+func (sfs *SlowFs) SetNoAtime(noAtime bool) {
+	sfs.noAtime = noAtime
+}
+
+// openFlags returns the flags to open backing files with, given the flags a file was opened with.
+// O_DIRECT is simulated, so it is dropped, sparing the backing filesystem's alignment rules.
+func (sfs *SlowFs) openFlags(flags uint32) uint32 {
+	flags &^= oDirect
+	if sfs.noAtime {
+		flags |= oNoAtime
+	}
+	return flags
+}
+
+// coarsenAttr rounds the timestamps in attr to the configured granularity.
+func (sfs *SlowFs) coarsenAttr(attr *fuse.Attr) {
+	g := sfs.timestampGranularity
+	if g <= 0 || attr == nil {
+		return
+	}
+	attr.Atime, attr.Atimensec = coarsenTimestamp(attr.Atime, attr.Atimensec, g)
+	attr.Mtime, attr.Mtimensec = coarsenTimestamp(attr.Mtime, attr.Mtimensec, g)
+	attr.Ctime, attr.Ctimensec = coarsenTimestamp(attr.Ctime, attr.Ctimensec, g)
+}
+
+// coarsenTime returns t rounded down to the configured granularity. Nil, meaning the time isn't
+// being changed, stays nil.
+func (sfs *SlowFs) coarsenTime(t *time.Time) *time.Time {
+	g := sfs.timestampGranularity
+	if g <= 0 || t == nil {
+		return t
+	}
+	coarse := t.Truncate(g)
+	return &coarse
+}
+
+// coarsenTimestamp rounds a timestamp given as seconds and nanoseconds since the epoch down to a
+// multiple of granularity.
+func coarsenTimestamp(sec uint64, nsec uint32, granularity time.Duration) (uint64, uint32) {
+	t := time.Unix(int64(sec), int64(nsec)).Truncate(granularity)
+	return uint64(t.Unix()), uint32(t.Nanosecond())
+}
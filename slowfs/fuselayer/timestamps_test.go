@@ -0,0 +1,67 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestCoarsenTimestamp(t *testing.T) {
+	cases := []struct {
+		sec         uint64
+		nsec        uint32
+		granularity time.Duration
+		wantSec     uint64
+		wantNsec    uint32
+	}{
+		{1500000001, 999999999, time.Nanosecond, 1500000001, 999999999},
+		{1500000001, 999999999, time.Second, 1500000001, 0},
+		{1500000001, 999999999, 2 * time.Second, 1500000000, 0},
+		{1500000000, 123456789, time.Millisecond, 1500000000, 123000000},
+	}
+
+	for _, c := range cases {
+		gotSec, gotNsec := coarsenTimestamp(c.sec, c.nsec, c.granularity)
+		if gotSec != c.wantSec || gotNsec != c.wantNsec {
+			t.Errorf("coarsenTimestamp(%d, %d, %s) = %d, %d, want %d, %d", c.sec, c.nsec, c.granularity, gotSec, gotNsec, c.wantSec, c.wantNsec)
+		}
+	}
+}
+
+func TestSlowFs_Coarsen(t *testing.T) {
+	sfs := &SlowFs{}
+	attr := &fuse.Attr{Mtime: 1500000001, Mtimensec: 5}
+	sfs.coarsenAttr(attr)
+	if got, want := *attr, (fuse.Attr{Mtime: 1500000001, Mtimensec: 5}); got != want {
+		t.Errorf("coarsenAttr() without granularity gave %+v, want %+v", got, want)
+	}
+	if got := sfs.coarsenTime(nil); got != nil {
+		t.Errorf("coarsenTime(nil) = %s, want nil", got)
+	}
+
+	sfs.SetTimestampGranularity(2 * time.Second)
+	attr = &fuse.Attr{Atime: 1500000003, Atimensec: 5, Mtime: 1500000001, Mtimensec: 5, Ctime: 1500000002}
+	sfs.coarsenAttr(attr)
+	if got, want := *attr, (fuse.Attr{Atime: 1500000002, Mtime: 1500000000, Ctime: 1500000002}); got != want {
+		t.Errorf("coarsenAttr() with 2s granularity gave %+v, want %+v", got, want)
+	}
+	mtime := time.Unix(1500000001, 5)
+	if got, want := sfs.coarsenTime(&mtime), time.Unix(1500000000, 0); !got.Equal(want) {
+		t.Errorf("coarsenTime(%s) = %s, want %s", mtime, got, want)
+	}
+}
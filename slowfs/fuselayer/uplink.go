@@ -0,0 +1,35 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"errors"
+	"time"
+)
+
+// StallUplink stops every simulated cloud gateway uploading for d, as if its connection to the
+// cloud had dropped. It fails if no simulated device uploads.
+func (sfs *SlowFs) StallUplink(d time.Duration) error {
+	stalled := false
+	for _, s := range sfs.schedulers() {
+		if err := s.StallUplink(d); err == nil {
+			stalled = true
+		}
+	}
+	if !stalled {
+		return errors.New("no device uploads, since none sets UploadBytesPerSecond")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestSlowFs_StallUplink(t *testing.T) {
+	sfs := &SlowFs{scheduler: scheduler.New(&slowfs.HDD7200RpmDeviceConfig)}
+	if err := sfs.StallUplink(time.Second); err == nil {
+		t.Errorf("StallUplink() without a gateway = <nil>, want an error")
+	}
+
+	gateway := slowfs.HDD7200RpmDeviceConfig
+	gateway.UploadBytesPerSecond = 10 * units.Megabyte
+	sfs.RoutePaths("gateway", []string{"cloud"}, scheduler.New(&gateway))
+	if err := sfs.StallUplink(time.Second); err != nil {
+		t.Errorf("StallUplink() with a gateway = %s, want <nil>", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"context"
+	"slowfs/slowfs/scheduler"
+	"time"
+)
+
+// SetVirtualClock makes operations advance clock to when they're modeled to complete, instead of
+// sleeping until then, so that workloads run as fast as the backing directory allows while still
+// seeing the modeled order and latencies, in simulated time. The schedulers of the filesystem and
+// its routes must tell the time with clock too. This must be called before the filesystem is
+// mounted.
+func (sfs *SlowFs) SetVirtualClock(clock *scheduler.VirtualClock) {
+	sfs.clock = clock
+}
+
+// VirtualClock returns the clock set with SetVirtualClock, or nil if operations take real time.
+func (sfs *SlowFs) VirtualClock() *scheduler.VirtualClock {
+	return sfs.clock
+}
+
+// Now returns what time it is for the simulated device: simulated time with a virtual clock, and
+// real time otherwise.
+func (sfs *SlowFs) Now() time.Time {
+	if sfs.clock != nil {
+		return sfs.clock.Now()
+	}
+	return time.Now()
+}
+
+// waitUntil waits until t for the simulated device, advancing the virtual clock to t instead of
+// sleeping if there is one. It returns ctx's error if ctx is done first.
+func (sfs *SlowFs) waitUntil(ctx context.Context, t time.Time) error {
+	if sfs.clock == nil {
+		return sleepUntil(ctx, t)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sfs.clock.AdvanceTo(t)
+	return nil
+}
+
+// waitBackground waits until t for background work, like scanning and replication, which happens
+// alongside operations rather than as part of them. With a virtual clock, it waits for operations
+// to advance the clock to t, rather than advancing it and delaying them. It returns ctx's error if
+// ctx is done first.
+func (sfs *SlowFs) waitBackground(ctx context.Context, t time.Time) error {
+	if sfs.clock == nil {
+		return sleepUntil(ctx, t)
+	}
+	select {
+	case <-sfs.clock.Until(t):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/faults"
+	"slowfs/slowfs/scheduler"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSlowFs_VirtualClock(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	config.MetadataOpTime = 100 * time.Millisecond
+	clock := scheduler.NewVirtualClock(time.Unix(0, 0))
+	s := scheduler.New(&config)
+	s.SetClock(clock)
+	sfs := NewSlowFs("", s)
+	sfs.SetVirtualClock(clock)
+
+	// Operations one after another each start when the last finished, without sleeping.
+	began := time.Now()
+	for i := 0; i < 10; i++ {
+		if got, want := sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Now(), Path: "a"}), fuse.OK; got != want {
+			t.Errorf("wait() = %v, want %v", got, want)
+		}
+	}
+	if got, max := time.Since(began), 500*time.Millisecond; got > max {
+		t.Errorf("10 operations took %s, want at most %s", got, max)
+	}
+	if got, want := clock.Elapsed(), time.Second; got != want {
+		t.Errorf("Elapsed() after 10 operations = %s, want %s", got, want)
+	}
+
+	// Soft timeouts cut operations short in simulated time.
+	sfs.SetTimeout(slowfs.SoftTimeout, 10*time.Millisecond)
+	if got, want := sfs.wait(&scheduler.Request{Type: scheduler.MetadataRequest, Timestamp: time.Now(), Path: "a"}), fuse.EIO; got != want {
+		t.Errorf("wait() with a soft timeout = %v, want %v", got, want)
+	}
+	if got, want := clock.Elapsed(), time.Second+10*time.Millisecond; got != want {
+		t.Errorf("Elapsed() after timing out = %s, want %s", got, want)
+	}
+}
+
+func TestSlowFs_VirtualClockOpenDelayAndFaults(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	clock := sfs.VirtualClock()
+	sfs.SetScanning(0, time.Hour)
+	schedule, err := faults.NewSchedule([]faults.ScheduledFault{
+		{At: 30 * time.Minute, Op: faults.MetadataOp, Errno: syscall.EIO},
+	})
+	if err != nil {
+		t.Fatalf("NewSchedule error: %s", err)
+	}
+	schedule.Start(sfs.Now())
+	sfs.SetFaultInjector(schedule)
+
+	if got, want := sfs.injectFault(faults.MetadataOp, "a"), fuse.OK; got != want {
+		t.Errorf("injectFault before the fault is due = %v, want %v", got, want)
+	}
+
+	// The open delay advances simulated time rather than sleeping, which makes the fault due.
+	began := time.Now()
+	if got, want := sfs.holdOpen("a"), fuse.OK; got != want {
+		t.Errorf("holdOpen(a) = %v, want %v", got, want)
+	}
+	if got, max := time.Since(began), time.Second; got > max {
+		t.Errorf("holdOpen(a) took %s, want at most %s", got, max)
+	}
+	if got, want := clock.Elapsed(), time.Hour; got != want {
+		t.Errorf("Elapsed() after holdOpen = %s, want %s", got, want)
+	}
+	if got, want := sfs.injectFault(faults.MetadataOp, "a"), fuse.EIO; got != want {
+		t.Errorf("injectFault once the fault is due = %v, want %v", got, want)
+	}
+}
+
+func TestSlowFs_VirtualClockScanning(t *testing.T) {
+	sfs := newLoopbackSlowFs(t)
+	defer sfs.Shutdown()
+	clock := sfs.VirtualClock()
+	scans := make(chan scheduler.Request, 10)
+	sfs.scheduler.AddScheduleHook(func(c *scheduler.ScheduledRequest) {
+		scans <- *c.Request
+	})
+	if err := ioutil.WriteFile(filepath.Join(sfs.root, "a"), make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+	sfs.SetScanning(time.Minute, 0)
+
+	// The scan waits for operations to move simulated time on, rather than moving it itself.
+	sfs.scanModified("a")
+	select {
+	case req := <-scans:
+		t.Errorf("scan %+v before it was due", req)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got, want := clock.Elapsed(), time.Duration(0); got != want {
+		t.Errorf("Elapsed() while the scan waits = %s, want %s", got, want)
+	}
+
+	clock.AdvanceTo(time.Unix(0, 0).Add(2 * time.Minute))
+	select {
+	case req := <-scans:
+		if got, want := req.Path, "a"; got != want {
+			t.Errorf("scan of %s, want %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("file wasn't scanned once it was due")
+	}
+	if got, want := clock.Elapsed(), 2*time.Minute; got != want {
+		t.Errorf("Elapsed() after the scan = %s, want %s", got, want)
+	}
+}
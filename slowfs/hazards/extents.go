@@ -0,0 +1,99 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hazards
+
+import (
+	"slowfs/slowfs/units"
+)
+
+// extent is the range of bytes [start, end) of a file.
+type extent struct {
+	start, end units.NumBytes
+}
+
+// extents are disjoint extents in order of where they start.
+type extents []extent
+
+// add returns es with [start, end) added, merging any extents it touches.
+func (es extents) add(start, end units.NumBytes) extents {
+	if start >= end {
+		return es
+	}
+	var merged extents
+	for _, e := range es {
+		if e.end < start || e.start > end {
+			merged = append(merged, e)
+			continue
+		}
+		if e.start < start {
+			start = e.start
+		}
+		if e.end > end {
+			end = e.end
+		}
+	}
+	return merged.insert(extent{start, end})
+}
+
+// insert returns es with n inserted in order, which mustn't overlap any extent in es.
+func (es extents) insert(n extent) extents {
+	i := 0
+	for i < len(es) && es[i].start < n.start {
+		i++
+	}
+	es = append(es, extent{})
+	copy(es[i+1:], es[i:])
+	es[i] = n
+	return es
+}
+
+// remove returns es without [start, end), splitting any extent it falls inside.
+func (es extents) remove(start, end units.NumBytes) extents {
+	if start >= end {
+		return es
+	}
+	var kept extents
+	for _, e := range es {
+		if e.end <= start || e.start >= end {
+			kept = append(kept, e)
+			continue
+		}
+		if e.start < start {
+			kept = append(kept, extent{e.start, start})
+		}
+		if e.end > end {
+			kept = append(kept, extent{end, e.end})
+		}
+	}
+	return kept
+}
+
+// overlap returns how many bytes of [start, end) are in es.
+func (es extents) overlap(start, end units.NumBytes) units.NumBytes {
+	var n units.NumBytes
+	for _, e := range es {
+		s, t := e.start, e.end
+		if s < start {
+			s = start
+		}
+		if t > end {
+			t = end
+		}
+		if s < t {
+			n += t - s
+		}
+	}
+	return n
+}
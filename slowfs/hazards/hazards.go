@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hazards finds reads which depend on data not being durable yet: reads of data written
+// since the file was last synced, which a real device might only have in its cache. After a crash,
+// such a read could have seen something else, so an application doing it may be assuming more
+// durability than it has. Reads of data which was synced first are counted too, to show which
+// files are read back safely.
+package hazards
+
+import (
+	"fmt"
+	"io"
+	"slowfs/slowfs/fuselayer"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// FileReport is what a Tracker found for one file.
+type FileReport struct {
+	Path string
+	// Reads of data written but not yet synced, and how much such data they read.
+	UnsyncedReads int64
+	UnsyncedBytes units.NumBytes
+	// When the first read of unsynced data happened, if there was one.
+	FirstUnsyncedRead time.Time
+	// Reads of data which had been written and then synced.
+	SyncedReads int64
+}
+
+// Tracker tracks which parts of each file have been written and whether they've been synced since,
+// and counts the reads of them. It is safe for concurrent use.
+type Tracker struct {
+	mu    sync.Mutex
+	files map[string]*file
+}
+
+// file is what a Tracker knows about one file.
+type file struct {
+	unsynced extents
+	synced   extents
+	report   FileReport
+}
+
+// NewTracker returns a Tracker which hasn't seen any operations.
+func NewTracker() *Tracker {
+	return &Tracker{files: make(map[string]*file)}
+}
+
+// Hook returns an op hook which tracks each operation.
+func (t *Tracker) Hook() fuselayer.OpHook {
+	return func(op *fuselayer.CompletedOp) {
+		if op.Status == fuse.OK {
+			t.Track(op.Request)
+		}
+	}
+}
+
+// Track updates the tracker with a request which succeeded.
+func (t *Tracker) Track(req *scheduler.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.files[req.Path]
+	if f == nil {
+		f = &file{report: FileReport{Path: req.Path}}
+		t.files[req.Path] = f
+	}
+	end := units.NumBytesAdd(req.Start, req.Size)
+
+	switch req.Type {
+	case scheduler.WriteRequest:
+		// Direct and synchronous writes are durable once they complete.
+		if req.Direct {
+			f.unsynced = f.unsynced.remove(req.Start, end)
+			f.synced = f.synced.add(req.Start, end)
+		} else {
+			f.synced = f.synced.remove(req.Start, end)
+			f.unsynced = f.unsynced.add(req.Start, end)
+		}
+	case scheduler.PunchHoleRequest, scheduler.ZeroRangeRequest:
+		// Like buffered writes, zeroing a range is only durable once synced.
+		f.synced = f.synced.remove(req.Start, end)
+		f.unsynced = f.unsynced.add(req.Start, end)
+	case scheduler.FsyncRequest, scheduler.FdatasyncRequest:
+		for _, e := range f.unsynced {
+			f.synced = f.synced.add(e.start, e.end)
+		}
+		f.unsynced = nil
+	case scheduler.ReadRequest:
+		if n := f.unsynced.overlap(req.Start, end); n > 0 {
+			if f.report.UnsyncedReads == 0 {
+				f.report.FirstUnsyncedRead = req.Timestamp
+			}
+			f.report.UnsyncedReads++
+			f.report.UnsyncedBytes += n
+		} else if f.synced.overlap(req.Start, end) > 0 {
+			f.report.SyncedReads++
+		}
+	case scheduler.TruncateRequest:
+		f.unsynced = f.unsynced.remove(req.Start, units.MaxNumBytes)
+		f.synced = f.synced.remove(req.Start, units.MaxNumBytes)
+	case scheduler.DirEntryRequest:
+		// The file was removed or renamed, so whatever is at the path next is a different file.
+		// What was found about it so far is kept.
+		f.unsynced, f.synced = nil, nil
+	}
+}
+
+// Reports returns what was found for each file which has been read after being written, with the
+// most reads of unsynced data first.
+func (t *Tracker) Reports() []FileReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var reports []FileReport
+	for _, f := range t.files {
+		if f.report.UnsyncedReads > 0 || f.report.SyncedReads > 0 {
+			reports = append(reports, f.report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].UnsyncedReads != reports[j].UnsyncedReads {
+			return reports[i].UnsyncedReads > reports[j].UnsyncedReads
+		}
+		return reports[i].Path < reports[j].Path
+	})
+	return reports
+}
+
+// WriteReport writes a table of the files read after being written, with how many reads depended
+// on data which wasn't durable yet.
+func (t *Tracker) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "path\tunsynced reads\tunsynced bytes\tfirst unsynced read\tsynced reads\n")
+	for _, r := range t.Reports() {
+		first := "-"
+		if r.UnsyncedReads > 0 {
+			first = r.FirstUnsyncedRead.Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\n", r.Path, r.UnsyncedReads, r.UnsyncedBytes, first, r.SyncedReads)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hazards
+
+import (
+	"bytes"
+	"reflect"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"strings"
+	"testing"
+	"time"
+)
+
+var startTime = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestExtents(t *testing.T) {
+	cases := []struct {
+		desc string
+		es   extents
+		want extents
+	}{
+		{"add to nothing", extents{}.add(10, 20), extents{{10, 20}}},
+		{"add disjoint", extents{{10, 20}}.add(30, 40).add(0, 5), extents{{0, 5}, {10, 20}, {30, 40}}},
+		{"add touching", extents{{10, 20}}.add(20, 30), extents{{10, 30}}},
+		{"add spanning", extents{{10, 20}, {30, 40}}.add(15, 35), extents{{10, 40}}},
+		{"add empty", extents{{10, 20}}.add(50, 50), extents{{10, 20}}},
+		{"remove middle", extents{{10, 40}}.remove(20, 30), extents{{10, 20}, {30, 40}}},
+		{"remove spanning", extents{{10, 20}, {30, 40}}.remove(15, 35), extents{{10, 15}, {35, 40}}},
+		{"remove all", extents{{10, 20}}.remove(0, units.MaxNumBytes), nil},
+	}
+
+	for _, c := range cases {
+		if got, want := c.es, c.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", c.desc, got, want)
+		}
+	}
+
+	if got, want := (extents{{10, 20}, {30, 40}}).overlap(15, 35), units.NumBytes(10); got != want {
+		t.Errorf("overlap(15, 35) = %d, want %d", got, want)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	cases := []struct {
+		desc string
+		reqs []*scheduler.Request
+		want []FileReport
+	}{
+		{
+			desc: "read of unsynced data",
+			reqs: []*scheduler.Request{
+				{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100},
+				{Type: scheduler.ReadRequest, Timestamp: startTime.Add(time.Second), Path: "a", Start: 50, Size: 100},
+			},
+			want: []FileReport{{Path: "a", UnsyncedReads: 1, UnsyncedBytes: 50, FirstUnsyncedRead: startTime.Add(time.Second)}},
+		},
+		{
+			desc: "read after fsync",
+			reqs: []*scheduler.Request{
+				{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100},
+				{Type: scheduler.FsyncRequest, Timestamp: startTime, Path: "a"},
+				{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100},
+			},
+			want: []FileReport{{Path: "a", SyncedReads: 1}},
+		},
+		{
+			desc: "direct writes are durable",
+			reqs: []*scheduler.Request{
+				{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100, Direct: true},
+				{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100},
+			},
+			want: []FileReport{{Path: "a", SyncedReads: 1}},
+		},
+		{
+			desc: "rewriting synced data makes it unsynced again",
+			reqs: []*scheduler.Request{
+				{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100},
+				{Type: scheduler.FdatasyncRequest, Timestamp: startTime, Path: "a"},
+				{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 10},
+				{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100},
+			},
+			want: []FileReport{{Path: "a", UnsyncedReads: 1, UnsyncedBytes: 10, FirstUnsyncedRead: startTime}},
+		},
+		{
+			desc: "unwritten, truncated and unlinked data isn't counted",
+			reqs: []*scheduler.Request{
+				{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100},
+				{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "b", Start: 0, Size: 100},
+				{Type: scheduler.TruncateRequest, Timestamp: startTime, Path: "b", Start: 0, Size: 100},
+				{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "b", Start: 0, Size: 100},
+				{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "c", Start: 0, Size: 100},
+				{Type: scheduler.DirEntryRequest, Timestamp: startTime, Path: "c", Size: 100},
+				{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "c", Start: 0, Size: 100},
+			},
+			want: nil,
+		},
+	}
+
+	for _, c := range cases {
+		tracker := NewTracker()
+		for _, req := range c.reqs {
+			tracker.Track(req)
+		}
+		if got, want := tracker.Reports(), c.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Reports() = %+v, want %+v", c.desc, got, want)
+		}
+	}
+}
+
+func TestTracker_WriteReport(t *testing.T) {
+	tracker := NewTracker()
+	for _, req := range []*scheduler.Request{
+		{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "safe", Start: 0, Size: 10},
+		{Type: scheduler.FsyncRequest, Timestamp: startTime, Path: "safe"},
+		{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "safe", Start: 0, Size: 10},
+		{Type: scheduler.WriteRequest, Timestamp: startTime, Path: "risky", Start: 0, Size: 10},
+		{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "risky", Start: 0, Size: 10},
+	} {
+		tracker.Track(req)
+	}
+
+	var buf bytes.Buffer
+	if err := tracker.WriteReport(&buf); err != nil {
+		t.Fatalf("WriteReport failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if got, want := len(lines), 3; got != want {
+		t.Fatalf("WriteReport wrote %d lines, want %d:\n%s", got, want, buf.String())
+	}
+	// Files with reads of unsynced data come first.
+	for i, prefix := range []string{"path", "risky", "safe"} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("WriteReport line %d = %q, want it to start with %q", i, lines[i], prefix)
+		}
+	}
+}
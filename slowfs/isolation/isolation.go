@@ -0,0 +1,55 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package isolation shields slowfs from the rest of the host, so that the scheduling jitter of busy
+// machines, like shared CI runners, doesn't add noise to fine-grained latencies: it pins slowfs's
+// threads to chosen CPUs, raises their priority and locks its memory. Each needs privileges slowfs
+// may not have, so callers should carry on without it if it fails.
+package isolation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxCPUs is how many CPUs can be pinned to.
+const maxCPUs = 1024
+
+// ParseCPUListFromString parses a list of CPUs in the format of taskset and cpusets, like "0-3,6",
+// into the CPU numbers it lists.
+func ParseCPUListFromString(s string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		first, last := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+		lo, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return nil, fmt.Errorf("bad CPU list %q", s)
+		}
+		hi, err := strconv.Atoi(strings.TrimSpace(last))
+		if err != nil {
+			return nil, fmt.Errorf("bad CPU list %q", s)
+		}
+		if lo < 0 || hi >= maxCPUs || lo > hi {
+			return nil, fmt.Errorf("bad CPU range %q: CPUs must be between 0 and %d", part, maxCPUs-1)
+		}
+		for c := lo; c <= hi; c++ {
+			cpus = append(cpus, c)
+		}
+	}
+	return cpus, nil
+}
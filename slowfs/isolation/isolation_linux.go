@@ -0,0 +1,118 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package isolation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// rlimitMemlock is RLIMIT_MEMLOCK, which the syscall package doesn't have.
+	rlimitMemlock = 0x8
+	// capIPCLock is the bit of CAP_IPC_LOCK in the capability sets of /proc/self/status.
+	capIPCLock = 14
+)
+
+// PinCPUs restricts every thread of the process to run on cpus. Threads started later inherit it.
+func PinCPUs(cpus []int) error {
+	var mask [maxCPUs / 64]uint64
+	for _, c := range cpus {
+		if c < 0 || c >= maxCPUs {
+			return fmt.Errorf("CPU %d out of range", c)
+		}
+		mask[c/64] |= 1 << uint(c%64)
+	}
+	return forEachThread(func(tid int) error {
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid), unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+// SetNice sets the nice value of every thread of the process, which is negative to raise their
+// priority. Threads started later inherit it.
+func SetNice(nice int) error {
+	return forEachThread(func(tid int) error {
+		return syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice)
+	})
+}
+
+// LockMemory locks the process's memory, and any it maps later, so that it is never paged out.
+// Without root or CAP_IPC_LOCK, RLIMIT_MEMLOCK must be unlimited, since once it is reached, the Go
+// runtime could no longer grow the heap, and would crash the process.
+func LockMemory() error {
+	if os.Geteuid() != 0 && !hasCapability(capIPCLock) {
+		var limit syscall.Rlimit
+		if err := syscall.Getrlimit(rlimitMemlock, &limit); err != nil {
+			return err
+		}
+		if limit.Cur != ^uint64(0) {
+			return fmt.Errorf("RLIMIT_MEMLOCK is %d bytes rather than unlimited (see ulimit -l)", limit.Cur)
+		}
+	}
+	return syscall.Mlockall(syscall.MCL_CURRENT | syscall.MCL_FUTURE)
+}
+
+// hasCapability returns whether the process's effective capabilities include bit, assuming not if
+// they can't be read.
+func hasCapability(bit uint) bool {
+	status, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		return err == nil && caps&(1<<bit) != 0
+	}
+	return false
+}
+
+// forEachThread calls f with the ID of each thread of the process, including those started while
+// it runs, until there are no more it hasn't been called for. Threads which exit first are skipped.
+func forEachThread(f func(tid int) error) error {
+	done := make(map[int]bool)
+	for {
+		entries, err := ioutil.ReadDir("/proc/self/task")
+		if err != nil {
+			return err
+		}
+		started := false
+		for _, e := range entries {
+			tid, err := strconv.Atoi(e.Name())
+			if err != nil || done[tid] {
+				continue
+			}
+			if err := f(tid); err != nil && err != syscall.ESRCH {
+				return err
+			}
+			done[tid] = true
+			started = true
+		}
+		if !started {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package isolation
+
+import "errors"
+
+var errUnsupported = errors.New("not supported on this platform")
+
+// PinCPUs restricts every thread of the process to run on cpus, which is only supported on Linux.
+func PinCPUs(cpus []int) error {
+	return errUnsupported
+}
+
+// SetNice sets the nice value of every thread of the process, which is only supported on Linux.
+func SetNice(nice int) error {
+	return errUnsupported
+}
+
+// LockMemory locks the process's memory, which is only supported on Linux.
+func LockMemory() error {
+	return errUnsupported
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package isolation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUListFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      []int
+		shouldErr bool
+	}{
+		{"0", []int{0}, false},
+		{"0-3,6", []int{0, 1, 2, 3, 6}, false},
+		{"2, 4-5", []int{2, 4, 5}, false},
+		{"", nil, true},
+		{"3-1", nil, true},
+		{"-1", nil, true},
+		{"1024", nil, true},
+		{"a-b", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseCPUListFromString(c.s)
+		if !reflect.DeepEqual(got, c.want) || c.shouldErr != (err != nil) {
+			t.Errorf("ParseCPUListFromString(%q) = %v, %v, want %v, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides a minimal registry of metrics which can be exported over HTTP in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type metric interface {
+	name() string
+	help() string
+	kind() string
+	write(w io.Writer) error
+}
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]metric),
+	}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[m.name()]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", m.name()))
+	}
+	r.metrics[m.name()] = m
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by calling f each time the registry is
+// exported.
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(&gaugeFunc{n: name, h: help, f: f})
+}
+
+// WriteText writes all metrics in the registry to w in the Prometheus text exposition format,
+// sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name(), m.help(), m.name(), m.kind()); err != nil {
+			return err
+		}
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP exports the registry's metrics.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteText(w)
+}
+
+type gaugeFunc struct {
+	n, h string
+	f    func() float64
+}
+
+func (g *gaugeFunc) name() string { return g.n }
+func (g *gaugeFunc) help() string { return g.h }
+func (g *gaugeFunc) kind() string { return "gauge" }
+
+func (g *gaugeFunc) write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s %g\n", g.n, g.f())
+	return err
+}
+
+// Counter is a value which only goes up, like a number of requests.
+type Counter struct {
+	n, h string
+
+	mu    sync.Mutex
+	value float64
+}
+
+// NewCounter registers a counter starting at zero.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{n: name, h: help}
+	r.register(c)
+	return c
+}
+
+// Add adds v, which must not be negative, to the counter.
+func (c *Counter) Add(v float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value += v
+}
+
+func (c *Counter) name() string { return c.n }
+func (c *Counter) help() string { return c.h }
+func (c *Counter) kind() string { return "counter" }
+
+func (c *Counter) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := fmt.Fprintf(w, "%s %g\n", c.n, c.value)
+	return err
+}
+
+// CounterVec is a set of counters distinguished by the value of a label, like the type of request
+// counted.
+type CounterVec struct {
+	n, h, label string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec registers a set of counters with the given label. Counters appear once something
+// is added to them.
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{n: name, h: help, label: label, values: make(map[string]float64)}
+	r.register(c)
+	return c
+}
+
+// Add adds v, which must not be negative, to the counter with the given label value.
+func (c *CounterVec) Add(labelValue string, v float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[labelValue] += v
+}
+
+func (c *CounterVec) name() string { return c.n }
+func (c *CounterVec) help() string { return c.h }
+func (c *CounterVec) kind() string { return "counter" }
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, v := range sortedKeys(c.values) {
+		if _, err := fmt.Fprintf(w, "%s{%s} %g\n", c.n, labelPair(c.label, v), c.values[v]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExponentialBuckets returns n histogram bucket bounds, the first being start and each following
+// one factor times the last.
+func ExponentialBuckets(start, factor float64, n int) []float64 {
+	buckets := make([]float64, n)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// HistogramVec is a set of histograms distinguished by the value of a label, counting how many
+// observations fall at or below each of a fixed set of bucket bounds.
+type HistogramVec struct {
+	n, h, label string
+	buckets     []float64
+
+	mu         sync.Mutex
+	histograms map[string]*histogram
+}
+
+type histogram struct {
+	// counts[i] is how many observations fell in bucket i, but not an earlier one. The last is for
+	// observations above every bound.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a set of histograms with the given label and bucket bounds, which must
+// be in increasing order. Histograms appear once something is observed in them.
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	h := &HistogramVec{
+		n:          name,
+		h:          help,
+		label:      label,
+		buckets:    buckets,
+		histograms: make(map[string]*histogram),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds v to the histogram with the given label value.
+func (h *HistogramVec) Observe(labelValue string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.histograms[labelValue]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.histograms[labelValue] = hist
+	}
+	hist.counts[sort.SearchFloat64s(h.buckets, v)]++
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) name() string { return h.n }
+func (h *HistogramVec) help() string { return h.h }
+func (h *HistogramVec) kind() string { return "histogram" }
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	values := make([]string, 0, len(h.histograms))
+	for v := range h.histograms {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	for _, v := range values {
+		hist, label := h.histograms[v], labelPair(h.label, v)
+		// Prometheus buckets are cumulative.
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			if _, err := fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", h.n, label, bound, cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n%s_sum{%s} %g\n%s_count{%s} %d\n",
+			h.n, label, hist.count, h.n, label, hist.sum, h.n, label, hist.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelPair formats a label as name="value", escaped as the exposition format requires.
+func labelPair(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return fmt.Sprintf("%s=\"%s\"", name, value)
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	value := 3.0
+	r.NewGaugeFunc("b_gauge", "The second gauge.", func() float64 { return value })
+	r.NewGaugeFunc("a_gauge", "The first gauge.", func() float64 { return 0.5 })
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() = %s, want nil", err)
+	}
+
+	want := `# HELP a_gauge The first gauge.
+# TYPE a_gauge gauge
+a_gauge 0.5
+# HELP b_gauge The second gauge.
+# TYPE b_gauge gauge
+b_gauge 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteText() wrote %q, want %q", got, want)
+	}
+}
+
+func TestRegistry_RegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("gauge", "", func() float64 { return 0 })
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering gauge twice did not panic")
+		}
+	}()
+	r.NewGaugeFunc("gauge", "", func() float64 { return 0 })
+}
+
+func TestRegistry_WriteTextCounters(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("bytes_total", "Bytes.")
+	c.Add(10)
+	c.Add(2.5)
+	v := r.NewCounterVec("requests_total", "Requests.", "type")
+	v.Add("write", 1)
+	v.Add("read", 2)
+	v.Add("read", 1)
+	r.NewCounterVec("empty_total", "Nothing.", "type")
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() = %s, want nil", err)
+	}
+
+	want := `# HELP bytes_total Bytes.
+# TYPE bytes_total counter
+bytes_total 12.5
+# HELP empty_total Nothing.
+# TYPE empty_total counter
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{type="read"} 3
+requests_total{type="write"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteText() wrote %q, want %q", got, want)
+	}
+}
+
+func TestRegistry_WriteTextHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", "type", ExponentialBuckets(0.001, 10, 2))
+	for _, v := range []float64{0.0005, 0.001, 0.005, 1} {
+		h.Observe("read", v)
+	}
+	h.Observe(`a"b`, 0.002)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() = %s, want nil", err)
+	}
+
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{type="a\"b",le="0.001"} 0
+latency_seconds_bucket{type="a\"b",le="0.01"} 1
+latency_seconds_bucket{type="a\"b",le="+Inf"} 1
+latency_seconds_sum{type="a\"b"} 0.002
+latency_seconds_count{type="a\"b"} 1
+latency_seconds_bucket{type="read",le="0.001"} 2
+latency_seconds_bucket{type="read",le="0.01"} 3
+latency_seconds_bucket{type="read",le="+Inf"} 4
+latency_seconds_sum{type="read"} 1.0065
+latency_seconds_count{type="read"} 4
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteText() wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MountOptions are the options of a mount(8) style option string which mean something for slowfs.
+type MountOptions struct {
+	// ReadOnly is set by "ro".
+	ReadOnly bool
+
+	// NoAtime is set by "noatime".
+	NoAtime bool
+
+	// Sync is set by "sync", which makes writes durable before they return.
+	Sync bool
+
+	// DirSync is set by "dirsync", and by "sync", which make changes to directories durable before
+	// they return.
+	DirSync bool
+
+	// Kernel is the options the kernel enforces itself, like "ro" and "nosuid", to mount with.
+	Kernel []string
+}
+
+// ParseMountOptionsFromString parses a comma separated option string, as given to mount -o, so that
+// scripts written for regular mounts work unchanged. Options which make no difference to slowfs,
+// like "rw", "relatime" or "_netdev", and those starting with "x-", which are for other programs,
+// are accepted and ignored. Later options override earlier ones, as for mount.
+func ParseMountOptionsFromString(s string) (MountOptions, error) {
+	var opts MountOptions
+	kernel := make(map[string]bool)
+	for _, o := range strings.Split(s, ",") {
+		switch o {
+		case "ro":
+			opts.ReadOnly = true
+		case "rw":
+			opts.ReadOnly = false
+		case "noatime":
+			opts.NoAtime = true
+		case "atime", "relatime", "strictatime":
+			opts.NoAtime = false
+		case "sync":
+			opts.Sync = true
+		case "async":
+			opts.Sync = false
+		case "dirsync":
+			opts.DirSync = true
+		case "nosuid", "nodev", "noexec":
+			kernel[o] = true
+		case "suid", "dev", "exec":
+			delete(kernel, "no"+o)
+		case "", "defaults", "auto", "noauto", "user", "nouser", "users", "owner", "group", "_netdev", "nofail",
+			"diratime", "nodiratime", "lazytime", "nolazytime", "iversion", "noiversion":
+		default:
+			if !strings.HasPrefix(o, "x-") {
+				return MountOptions{}, fmt.Errorf("unknown mount option %q", o)
+			}
+		}
+	}
+	if opts.Sync {
+		opts.DirSync = true
+	}
+	if opts.ReadOnly {
+		opts.Kernel = append(opts.Kernel, "ro")
+	}
+	for _, o := range []string{"nosuid", "nodev", "noexec"} {
+		if kernel[o] {
+			opts.Kernel = append(opts.Kernel, o)
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMountOptionsFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      MountOptions
+		shouldErr bool
+	}{
+		{"", MountOptions{}, false},
+		{"defaults,rw,relatime,_netdev,x-systemd.automount", MountOptions{}, false},
+		{"ro,noatime", MountOptions{ReadOnly: true, NoAtime: true, Kernel: []string{"ro"}}, false},
+		{"ro,rw", MountOptions{}, false},
+		{"sync", MountOptions{Sync: true, DirSync: true}, false},
+		{"dirsync", MountOptions{DirSync: true}, false},
+		{"noexec,nosuid,nodev,dev", MountOptions{Kernel: []string{"nosuid", "noexec"}}, false},
+		{"ro,bogus", MountOptions{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseMountOptionsFromString(c.s)
+		if !reflect.DeepEqual(got, c.want) || c.shouldErr != (err != nil) {
+			t.Errorf("ParseMountOptionsFromString(%q) = %+v, %v, want %+v, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mounts inspects the system mount table to catch mistakes in how slowfs is mounted,
+// such as mounting it somewhere which would make it recurse into itself.
+package mounts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MountInfoPath is where the kernel lists the mounts visible to this process.
+const MountInfoPath = "/proc/self/mountinfo"
+
+// Mount describes a single entry of the mount table.
+type Mount struct {
+	// MountPoint is where the filesystem is mounted.
+	MountPoint string
+
+	// FsType is the type of the filesystem, e.g. ext4 or fuse.slowfs.
+	FsType string
+
+	// Source is filesystem specific, e.g. a device, or the name a FUSE filesystem gave itself.
+	Source string
+}
+
+// IsFuse returns whether the mount is a FUSE filesystem.
+func (m *Mount) IsFuse() bool {
+	return m.FsType == "fuse" || strings.HasPrefix(m.FsType, "fuse.")
+}
+
+// ParseMountInfo parses the format of /proc/self/mountinfo, as described in proc(5).
+func ParseMountInfo(r io.Reader) ([]*Mount, error) {
+	var mounts []*Mount
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		// The line has a variable number of optional fields, terminated by a lone hyphen.
+		fields := strings.Fields(line)
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 5 || len(fields) < sep+3 {
+			return nil, fmt.Errorf("malformed mountinfo line %q", line)
+		}
+
+		mountPoint, err := unescapeOctal(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("malformed mountinfo line %q: %s", line, err)
+		}
+		source, err := unescapeOctal(fields[sep+2])
+		if err != nil {
+			return nil, fmt.Errorf("malformed mountinfo line %q: %s", line, err)
+		}
+
+		mounts = append(mounts, &Mount{
+			MountPoint: mountPoint,
+			FsType:     fields[sep+1],
+			Source:     source,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// ReadMountInfo reads and parses the mount table of the current process.
+func ReadMountInfo() ([]*Mount, error) {
+	f, err := os.Open(MountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMountInfo(f)
+}
+
+// unescapeOctal undoes the kernel's escaping of whitespace and backslashes as \ooo.
+func unescapeOctal(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+4 > len(s) {
+			return "", fmt.Errorf("truncated escape in %q", s)
+		}
+		b, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+		if err != nil {
+			return "", fmt.Errorf("bad escape in %q", s)
+		}
+		out = append(out, byte(b))
+		i += 3
+	}
+	return string(out), nil
+}
+
+// FindMount returns the mount which contains path. Later mounts hide earlier ones on the same
+// mount point, so the last, longest matching mount point wins. The path should be absolute and
+// have no symlinks.
+func FindMount(mounts []*Mount, path string) *Mount {
+	var best *Mount
+	for _, m := range mounts {
+		if !isWithin(m.MountPoint, path) {
+			continue
+		}
+		if best == nil || len(m.MountPoint) >= len(best.MountPoint) {
+			best = m
+		}
+	}
+	return best
+}
+
+// isWithin returns whether path is dir, or inside dir.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../"))
+}
+
+// CheckMountDirs returns an error if mounting slowfs at mountDir, mirroring backingDir, would
+// recurse into itself or otherwise not work. Both paths should be absolute.
+func CheckMountDirs(backingDir, mountDir string, mounts []*Mount) error {
+	realBackingDir, err := filepath.EvalSymlinks(backingDir)
+	if err != nil {
+		return fmt.Errorf("backing directory: %s", err)
+	}
+	realMountDir, err := filepath.EvalSymlinks(mountDir)
+	if err != nil {
+		return fmt.Errorf("mount directory: %s", err)
+	}
+
+	if realBackingDir == realMountDir {
+		return fmt.Errorf("backing directory %s is the same as mount directory %s", backingDir, mountDir)
+	}
+	if isWithin(realMountDir, realBackingDir) {
+		return fmt.Errorf("backing directory %s is inside mount directory %s, so slowfs would recurse into itself", backingDir, mountDir)
+	}
+	if isWithin(realBackingDir, realMountDir) {
+		return fmt.Errorf("mount directory %s is inside backing directory %s, so slowfs would recurse into itself", mountDir, backingDir)
+	}
+
+	// The backing directory could be reachable through the mount directory by some route the
+	// path comparisons above don't catch, such as a bind mount.
+	if m := FindMount(mounts, realBackingDir); m != nil && m.IsFuse() && isWithin(realMountDir, m.MountPoint) {
+		return fmt.Errorf("backing directory %s is on FUSE filesystem %s mounted inside mount directory %s, so slowfs would recurse into itself",
+			backingDir, m.MountPoint, mountDir)
+	}
+
+	for _, m := range mounts {
+		if m.MountPoint == realMountDir {
+			return fmt.Errorf("mount directory %s already has a %s filesystem mounted on it", mountDir, m.FsType)
+		}
+	}
+
+	d, err := os.Open(realMountDir)
+	if err != nil {
+		return fmt.Errorf("mount directory: %s", err)
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("mount directory: %s", err)
+	}
+	if len(names) != 0 {
+		return fmt.Errorf("mount directory %s is not empty", mountDir)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mounts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+const testMountInfo = `23 28 0:22 / /proc rw,relatime - proc proc rw
+28 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+40 28 0:45 / /mnt/my\040disk rw,nosuid,nodev,relatime shared:20 - fuse.slowfs slowfs rw,user_id=0,group_id=0
+41 40 0:46 / /mnt/my\040disk/inner rw - tmpfs tmpfs rw
+`
+
+func TestParseMountInfo(t *testing.T) {
+	cases := []struct {
+		mountInfo string
+		want      []*Mount
+		shouldErr bool
+	}{
+		{"", nil, false},
+		{
+			testMountInfo,
+			[]*Mount{
+				{MountPoint: "/proc", FsType: "proc", Source: "proc"},
+				{MountPoint: "/", FsType: "ext4", Source: "/dev/sda1"},
+				{MountPoint: "/mnt/my disk", FsType: "fuse.slowfs", Source: "slowfs"},
+				{MountPoint: "/mnt/my disk/inner", FsType: "tmpfs", Source: "tmpfs"},
+			},
+			false,
+		},
+		{"23 28 0:22 / /proc rw,relatime proc proc rw", nil, true},
+		{`23 28 0:22 / /pr\04 rw - proc proc rw`, nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseMountInfo(strings.NewReader(c.mountInfo))
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("ParseMountInfo(%q) = %v, should error", c.mountInfo, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMountInfo(%q) error: %s", c.mountInfo, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseMountInfo(%q) = %v, want %v", c.mountInfo, got, c.want)
+		}
+	}
+}
+
+func TestFindMount(t *testing.T) {
+	mounts, err := ParseMountInfo(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatalf("ParseMountInfo error: %s", err)
+	}
+
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/home/user", "/"},
+		{"/proc/self", "/proc"},
+		{"/procfoo", "/"},
+		{"/mnt/my disk/a", "/mnt/my disk"},
+		{"/mnt/my disk/inner/a", "/mnt/my disk/inner"},
+	}
+
+	for _, c := range cases {
+		if got := FindMount(mounts, c.path); got == nil || got.MountPoint != c.want {
+			t.Errorf("FindMount(%s) = %v, want mount point %s", c.path, got, c.want)
+		}
+	}
+}
+
+func TestCheckMountDirs(t *testing.T) {
+	root, err := ioutil.TempDir("", "mounts_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, dir := range []string{"backing", "mount", "backing/mount", "nonempty", "fusemount/backing"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("MkdirAll error: %s", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "nonempty", "file"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+
+	mounts := []*Mount{
+		{MountPoint: "/", FsType: "ext4"},
+		{MountPoint: filepath.Join(root, "fusemount"), FsType: "fuse.slowfs"},
+	}
+
+	cases := []struct {
+		backingDir string
+		mountDir   string
+		shouldErr  bool
+	}{
+		{"backing", "mount", false},
+		{"backing", "backing", true},
+		{"backing", "backing/mount", true},
+		{"backing/mount", "backing", true},
+		{"backing", "nonempty", true},
+		{"backing", "missing", true},
+		{"fusemount/backing", "fusemount", true},
+		{"backing", "fusemount", true},
+	}
+
+	for _, c := range cases {
+		err := CheckMountDirs(filepath.Join(root, c.backingDir), filepath.Join(root, c.mountDir), mounts)
+		if c.shouldErr != (err != nil) {
+			t.Errorf("CheckMountDirs(%s, %s) = %v, want error: %t", c.backingDir, c.mountDir, err, c.shouldErr)
+		}
+	}
+}
+
+func TestIsNotConnected(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{syscall.ENOTCONN, true},
+		{&os.PathError{Op: "stat", Path: "/mnt", Err: syscall.ENOTCONN}, true},
+		{&os.PathError{Op: "stat", Path: "/mnt", Err: syscall.ENOENT}, false},
+	}
+
+	for _, c := range cases {
+		if got, want := isNotConnected(c.err), c.want; got != want {
+			t.Errorf("isNotConnected(%v) = %t, want %t", c.err, got, want)
+		}
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mounts_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if IsStale(dir) {
+		t.Errorf("IsStale(%s) = true for a plain directory, want false", dir)
+	}
+}
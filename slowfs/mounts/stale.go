@@ -0,0 +1,51 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mounts
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// IsStale returns whether dir has a FUSE filesystem mounted on it whose server has gone away, as
+// happens when a previous slowfs crashed without unmounting. Accessing such a mount fails with
+// ENOTCONN.
+func IsStale(dir string) bool {
+	_, err := os.Stat(dir)
+	return isNotConnected(err)
+}
+
+func isNotConnected(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return err == syscall.ENOTCONN
+}
+
+// Unmount lazily unmounts the filesystem mounted at dir. It first tries fusermount, which works
+// without privileges for mounts owned by the current user, then falls back to unmounting directly.
+func Unmount(dir string) error {
+	out, fusermountErr := exec.Command("fusermount", "-u", "-z", dir).CombinedOutput()
+	if fusermountErr == nil {
+		return nil
+	}
+	if err := unmountDetach(dir); err != nil {
+		return fmt.Errorf("fusermount: %s (%s), unmount: %s", fusermountErr, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
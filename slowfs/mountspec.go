@@ -0,0 +1,48 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MountSpec describes a mount of BackingDir at MountDir, simulating the device with the config
+// named Config.
+type MountSpec struct {
+	BackingDir string
+	MountDir   string
+	Config     string
+}
+
+func (m MountSpec) String() string {
+	return m.BackingDir + ":" + m.MountDir + ":" + m.Config
+}
+
+// ParseMountSpecFromString parses a mount written as backing:mount:config, e.g.
+// "/srv/db:/mnt/db:ssd".
+func ParseMountSpecFromString(s string) (MountSpec, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return MountSpec{}, fmt.Errorf("mount %q: want backing:mount:config", s)
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+		if parts[i] == "" {
+			return MountSpec{}, fmt.Errorf("mount %q: want backing:mount:config", s)
+		}
+	}
+	return MountSpec{BackingDir: parts[0], MountDir: parts[1], Config: parts[2]}, nil
+}
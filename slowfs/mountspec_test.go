@@ -0,0 +1,41 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"testing"
+)
+
+func TestParseMountSpecFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      MountSpec
+		shouldErr bool
+	}{
+		{"/srv/db:/mnt/db:ssd", MountSpec{"/srv/db", "/mnt/db", "ssd"}, false},
+		{"src : dst : hdd7200rpm", MountSpec{"src", "dst", "hdd7200rpm"}, false},
+		{"/srv/db:/mnt/db", MountSpec{}, true},
+		{"/srv/db:/mnt/db:ssd:nvme", MountSpec{}, true},
+		{"/srv/db::ssd", MountSpec{}, true},
+		{"", MountSpec{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseMountSpecFromString(c.s)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseMountSpecFromString(%q) = %s, %v, want %s, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nbd exports a file as a network block device, whose requests take as long as a simulated
+// device says, so that any filesystem can be made on it and tested on slow storage, journaling and
+// barriers included. It speaks the fixed newstyle NBD protocol, as the kernel's nbd-client does:
+//
+//	nbd-client -unix /tmp/slowfs.nbd /dev/nbd0 -N disk
+//
+// Reads and writes are costed like those of a file on a slowfs mount, flushes like fsyncs, writes
+// with FUA like direct writes, trims like truncates and zero writes like extends. Requests always
+// take real time, rather than following a virtual clock, since the kernel times them out in real
+// time.
+package nbd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"slowfs/slowfs/delay"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Magic numbers and constants from the NBD protocol.
+const (
+	nbdMagic         = 0x4e42444d41474943 // "NBDMAGIC"
+	optMagic         = 0x49484156454f5054 // "IHAVEOPT"
+	optReplyMagic    = 0x3e889045565a9
+	requestMagic     = 0x25609513
+	simpleReplyMagic = 0x67446698
+
+	flagFixedNewstyle = 1 << 0
+	flagNoZeroes      = 1 << 1
+
+	optExportName = 1
+	optAbort      = 2
+	optList       = 3
+	optInfo       = 6
+	optGo         = 7
+
+	repAck         = 1
+	repServer      = 2
+	repInfo        = 3
+	repErrUnsup    = 1<<31 + 1
+	infoExport     = 0
+	maxOptionBytes = 4096
+
+	transmitHasFlags     = 1 << 0
+	transmitSendFlush    = 1 << 2
+	transmitSendFUA      = 1 << 3
+	transmitRotational   = 1 << 4
+	transmitSendTrim     = 1 << 5
+	transmitWriteZeroes  = 1 << 6
+	transmitCanMultiConn = 1 << 8
+
+	cmdRead        = 0
+	cmdWrite       = 1
+	cmdDisc        = 2
+	cmdFlush       = 3
+	cmdTrim        = 4
+	cmdWriteZeroes = 6
+	cmdFlagFUA     = 1 << 0
+
+	// The largest request accepted, like the reference server's limit.
+	maxRequestBytes = 32 * 1024 * 1024
+)
+
+// Server exports a file as a block device, simulating a device with its scheduler.
+type Server struct {
+	file      *os.File
+	size      int64
+	name      string
+	scheduler *scheduler.Scheduler
+	// Whether to tell clients the device is rotational, so that the kernel schedules it like a
+	// hard drive.
+	rotational bool
+	// How long before they complete requests stop sleeping and spin instead, for precision.
+	spin time.Duration
+}
+
+// NewServer creates a Server which exports file, called name, with the device simulated by s. The
+// device is the size the file is when the server is created.
+func NewServer(file *os.File, name string, s *scheduler.Scheduler) (*Server, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	config := s.Config()
+	return &Server{
+		file:       file,
+		size:       info.Size(),
+		name:       name,
+		scheduler:  s,
+		rotational: config.SeekTime > 0,
+	}, nil
+}
+
+// SetSpin makes requests spin for the last spin before they complete, rather than rely on a
+// timer, for precise sub-millisecond latencies at the cost of CPU time. A spin of zero disables
+// this.
+func (s *Server) SetSpin(spin time.Duration) {
+	s.spin = spin
+}
+
+// Serve accepts connections on l and serves each one until l is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := s.serveConn(conn); err != nil && err != io.EOF {
+				log.Printf("nbd connection from %s: %s", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// serveConn negotiates an export with a client, then serves its requests until it disconnects.
+func (s *Server) serveConn(conn io.ReadWriter) error {
+	noZeroes, err := s.handshake(conn)
+	if err != nil {
+		return err
+	}
+	transmit, err := s.negotiate(conn, noZeroes)
+	if err != nil || !transmit {
+		return err
+	}
+	return s.transmit(conn)
+}
+
+// handshake greets the client, and returns whether it asked for the zeroes after the export to be
+// left out.
+func (s *Server) handshake(conn io.ReadWriter) (bool, error) {
+	if err := write(conn, uint64(nbdMagic), uint64(optMagic), uint16(flagFixedNewstyle|flagNoZeroes)); err != nil {
+		return false, err
+	}
+	var clientFlags uint32
+	if err := binary.Read(conn, binary.BigEndian, &clientFlags); err != nil {
+		return false, err
+	}
+	if clientFlags&flagFixedNewstyle == 0 {
+		return false, errors.New("client doesn't support fixed newstyle negotiation")
+	}
+	return clientFlags&flagNoZeroes != 0, nil
+}
+
+// negotiate answers the client's options until it picks the export, and returns whether it did,
+// rather than aborting.
+func (s *Server) negotiate(conn io.ReadWriter, noZeroes bool) (bool, error) {
+	for {
+		var header struct {
+			Magic  uint64
+			Option uint32
+			Length uint32
+		}
+		if err := binary.Read(conn, binary.BigEndian, &header); err != nil {
+			return false, err
+		}
+		if header.Magic != optMagic {
+			return false, fmt.Errorf("bad option magic %#x", header.Magic)
+		}
+		if header.Length > maxOptionBytes {
+			return false, fmt.Errorf("option %d is too long, at %d bytes", header.Option, header.Length)
+		}
+		data := make([]byte, header.Length)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return false, err
+		}
+
+		switch header.Option {
+		case optExportName:
+			// The old way of picking an export has no reply, just the export's details.
+			if err := write(conn, uint64(s.size), s.transmissionFlags()); err != nil {
+				return false, err
+			}
+			if !noZeroes {
+				if _, err := conn.Write(make([]byte, 124)); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		case optAbort:
+			return false, s.reply(conn, header.Option, repAck, nil)
+		case optList:
+			data := make([]byte, 4+len(s.name))
+			binary.BigEndian.PutUint32(data, uint32(len(s.name)))
+			copy(data[4:], s.name)
+			if err := s.reply(conn, header.Option, repServer, data); err != nil {
+				return false, err
+			}
+			if err := s.reply(conn, header.Option, repAck, nil); err != nil {
+				return false, err
+			}
+		case optInfo, optGo:
+			info := make([]byte, 12)
+			binary.BigEndian.PutUint16(info[0:], infoExport)
+			binary.BigEndian.PutUint64(info[2:], uint64(s.size))
+			binary.BigEndian.PutUint16(info[10:], s.transmissionFlags())
+			if err := s.reply(conn, header.Option, repInfo, info); err != nil {
+				return false, err
+			}
+			if err := s.reply(conn, header.Option, repAck, nil); err != nil {
+				return false, err
+			}
+			if header.Option == optGo {
+				return true, nil
+			}
+		default:
+			if err := s.reply(conn, header.Option, repErrUnsup, nil); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// transmissionFlags returns the flags describing what the export supports.
+func (s *Server) transmissionFlags() uint16 {
+	flags := uint16(transmitHasFlags | transmitSendFlush | transmitSendFUA | transmitSendTrim | transmitWriteZeroes | transmitCanMultiConn)
+	if s.rotational {
+		flags |= transmitRotational
+	}
+	return flags
+}
+
+// reply sends a reply to an option.
+func (s *Server) reply(conn io.Writer, option, replyType uint32, data []byte) error {
+	if err := write(conn, uint64(optReplyMagic), option, replyType, uint32(len(data))); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	_, err := conn.Write(data)
+	return err
+}
+
+// request is a request from the client during transmission.
+type request struct {
+	Magic  uint32
+	Flags  uint16
+	Type   uint16
+	Handle uint64
+	Offset uint64
+	Length uint32
+}
+
+// transmit serves the client's requests until it disconnects. Each request is served in its own
+// goroutine, so that the simulated device sees them queued up like the kernel sends them, and the
+// replies may be sent out of order.
+func (s *Server) transmit(conn io.ReadWriter) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		var req request
+		if err := binary.Read(conn, binary.BigEndian, &req); err != nil {
+			return err
+		}
+		if req.Magic != requestMagic {
+			return fmt.Errorf("bad request magic %#x", req.Magic)
+		}
+		if req.Type == cmdDisc {
+			return nil
+		}
+		if req.Length > maxRequestBytes {
+			return fmt.Errorf("request of %d bytes is too large", req.Length)
+		}
+		var data []byte
+		if req.Type == cmdWrite {
+			data = make([]byte, req.Length)
+			if _, err := io.ReadFull(conn, data); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, errno := s.serve(start, &req, data)
+			mu.Lock()
+			defer mu.Unlock()
+			if err := write(conn, uint32(simpleReplyMagic), uint32(errno), req.Handle); err != nil {
+				return
+			}
+			if errno == 0 && len(reply) > 0 {
+				conn.Write(reply)
+			}
+		}()
+	}
+}
+
+// serve carries out a request, waits as long as the simulated device says, and returns the data to
+// reply with and the error number, if it failed.
+func (s *Server) serve(start time.Time, req *request, data []byte) ([]byte, syscall.Errno) {
+	end := req.Offset + uint64(req.Length)
+	if req.Type != cmdFlush && (end < req.Offset || end > uint64(s.size)) {
+		return nil, syscall.EINVAL
+	}
+	sreq := &scheduler.Request{
+		Timestamp: start,
+		Path:      s.name,
+		Start:     units.NumBytes(req.Offset),
+		Size:      units.NumBytes(req.Length),
+	}
+
+	var reply []byte
+	var err error
+	switch req.Type {
+	case cmdRead:
+		sreq.Type = scheduler.ReadRequest
+		reply = make([]byte, req.Length)
+		_, err = s.file.ReadAt(reply, int64(req.Offset))
+	case cmdWrite:
+		sreq.Type = scheduler.WriteRequest
+		sreq.Direct = req.Flags&cmdFlagFUA != 0
+		if _, err = s.file.WriteAt(data, int64(req.Offset)); err == nil && sreq.Direct {
+			err = s.file.Sync()
+		}
+	case cmdFlush:
+		sreq.Type = scheduler.FsyncRequest
+		sreq.Start, sreq.Size = 0, 0
+		err = s.file.Sync()
+	case cmdTrim:
+		// Trimmed blocks may read back as anything, so leaving them alone is fine.
+		sreq.Type = scheduler.PunchHoleRequest
+	case cmdWriteZeroes:
+		sreq.Type = scheduler.ZeroRangeRequest
+		_, err = s.file.WriteAt(make([]byte, req.Length), int64(req.Offset))
+	default:
+		return nil, syscall.EINVAL
+	}
+	if err != nil {
+		return nil, syscall.EIO
+	}
+
+	d := s.scheduler.Schedule(sreq)
+	delay.Until(context.Background(), start.Add(d), s.spin)
+	return reply, 0
+}
+
+// write writes values to w in network byte order.
+func write(w io.Writer, values ...interface{}) error {
+	for _, v := range values {
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nbd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+// testClient speaks the client side of the protocol, like nbd-client.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (c *testClient) read(v interface{}) {
+	if err := binary.Read(c.conn, binary.BigEndian, v); err != nil {
+		c.t.Fatalf("reading from server: %s", err)
+	}
+}
+
+func (c *testClient) write(values ...interface{}) {
+	if err := write(c.conn, values...); err != nil {
+		c.t.Fatalf("writing to server: %s", err)
+	}
+}
+
+// optionReply reads a reply to an option, and returns its type and data.
+func (c *testClient) optionReply() (uint32, []byte) {
+	var header struct {
+		Magic  uint64
+		Option uint32
+		Type   uint32
+		Length uint32
+	}
+	c.read(&header)
+	if header.Magic != optReplyMagic {
+		c.t.Fatalf("option reply magic = %#x, want %#x", header.Magic, uint64(optReplyMagic))
+	}
+	data := make([]byte, header.Length)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		c.t.Fatalf("reading option reply: %s", err)
+	}
+	return header.Type, data
+}
+
+// request sends a request and returns the error and data replied with.
+func (c *testClient) request(cmd uint16, offset uint64, length uint32, data []byte) (uint32, []byte) {
+	c.write(uint32(requestMagic), uint16(0), cmd, uint64(7), offset, length)
+	if data != nil {
+		c.write(data)
+	}
+	var reply struct {
+		Magic  uint32
+		Error  uint32
+		Handle uint64
+	}
+	c.read(&reply)
+	if reply.Magic != simpleReplyMagic || reply.Handle != 7 {
+		c.t.Fatalf("reply = %+v, want magic %#x and handle 7", reply, simpleReplyMagic)
+	}
+	if cmd != cmdRead || reply.Error != 0 {
+		return reply.Error, nil
+	}
+	out := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, out); err != nil {
+		c.t.Fatalf("reading reply data: %s", err)
+	}
+	return reply.Error, out
+}
+
+// testDeviceConfig describes a device quick enough not to slow tests down.
+var testDeviceConfig = slowfs.DeviceConfig{
+	ReadBytesPerSecond:     units.Gibibyte,
+	WriteBytesPerSecond:    units.Gibibyte,
+	AllocateBytesPerSecond: units.Gibibyte,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+}
+
+func newTestServer(t *testing.T) *Server {
+	return newTestServerWithScheduler(t, scheduler.New(&testDeviceConfig))
+}
+
+// newTestServerWithScheduler is like newTestServer, but simulates the device with s.
+func newTestServerWithScheduler(t *testing.T, s *scheduler.Scheduler) *Server {
+	f, err := ioutil.TempFile("", "nbd_test")
+	if err != nil {
+		t.Fatalf("couldn't create backing file: %s", err)
+	}
+	t.Cleanup(func() {
+		f.Close()
+		os.Remove(f.Name())
+	})
+	if err := f.Truncate(int64(units.Mebibyte)); err != nil {
+		t.Fatalf("couldn't size backing file: %s", err)
+	}
+	server, err := NewServer(f, "disk", s)
+	if err != nil {
+		t.Fatalf("NewServer failed: %s", err)
+	}
+	return server
+}
+
+// connect connects a client to s, negotiating the fixed newstyle handshake.
+func connect(t *testing.T, s *Server) *testClient {
+	server, client := net.Pipe()
+	go func() {
+		defer server.Close()
+		s.serveConn(server)
+	}()
+	t.Cleanup(func() { client.Close() })
+	c := &testClient{t: t, conn: client}
+
+	var greeting struct {
+		Magic, OptMagic uint64
+		Flags           uint16
+	}
+	c.read(&greeting)
+	if greeting.Magic != nbdMagic || greeting.OptMagic != optMagic || greeting.Flags&flagFixedNewstyle == 0 {
+		t.Fatalf("greeting = %+v, want fixed newstyle", greeting)
+	}
+	c.write(uint32(flagFixedNewstyle | flagNoZeroes))
+	return c
+}
+
+func TestServer_List(t *testing.T) {
+	c := connect(t, newTestServer(t))
+	c.write(uint64(optMagic), uint32(optList), uint32(0))
+	if typ, data := c.optionReply(); typ != repServer || string(data[4:]) != "disk" {
+		t.Errorf("list reply = %d, %q, want %d, disk", typ, data, repServer)
+	}
+	if typ, _ := c.optionReply(); typ != repAck {
+		t.Errorf("list reply = %d, want ack", typ)
+	}
+	c.write(uint64(optMagic), uint32(12345), uint32(0))
+	if typ, _ := c.optionReply(); typ != repErrUnsup {
+		t.Errorf("unknown option reply = %#x, want %#x", typ, uint32(repErrUnsup))
+	}
+}
+
+// startTransmission asks for the export, leaving c ready to make requests.
+func startTransmission(t *testing.T, c *testClient) {
+	name := "disk"
+	c.write(uint64(optMagic), uint32(optGo), uint32(4+len(name)+2), uint32(len(name)), []byte(name), uint16(0))
+	typ, info := c.optionReply()
+	if typ != repInfo || len(info) != 12 {
+		t.Fatalf("go reply = %d, %v, want export info", typ, info)
+	}
+	if got, want := binary.BigEndian.Uint64(info[2:]), uint64(units.Mebibyte); got != want {
+		t.Errorf("export size = %d, want %d", got, want)
+	}
+	if typ, _ := c.optionReply(); typ != repAck {
+		t.Fatalf("go reply = %d, want ack", typ)
+	}
+}
+
+func TestServer_Transmission(t *testing.T) {
+	c := connect(t, newTestServer(t))
+	startTransmission(t, c)
+
+	data := []byte("hello, block device")
+	if errno, _ := c.request(cmdWrite, 4096, uint32(len(data)), data); errno != 0 {
+		t.Errorf("write failed with %d", errno)
+	}
+	if errno, _ := c.request(cmdFlush, 0, 0, nil); errno != 0 {
+		t.Errorf("flush failed with %d", errno)
+	}
+	if errno, got := c.request(cmdRead, 4096, uint32(len(data)), nil); errno != 0 || !bytes.Equal(got, data) {
+		t.Errorf("read = %d, %q, want 0, %q", errno, got, data)
+	}
+	if errno, _ := c.request(cmdWriteZeroes, 4096, 5, nil); errno != 0 {
+		t.Errorf("write zeroes failed with %d", errno)
+	}
+	if errno, got := c.request(cmdRead, 4096, 7, nil); errno != 0 || !bytes.Equal(got, []byte("\x00\x00\x00\x00\x00, ")) {
+		t.Errorf("read after write zeroes = %d, %q", errno, got)
+	}
+	// Requests past the end of the device fail.
+	if errno, _ := c.request(cmdRead, uint64(units.Mebibyte), 1, nil); errno != 22 {
+		t.Errorf("read past end = %d, want EINVAL", errno)
+	}
+	c.write(uint32(requestMagic), uint16(0), uint16(cmdDisc), uint64(0), uint64(0), uint32(0))
+}
+
+func TestServer_TrimKeepsCacheElsewhere(t *testing.T) {
+	config := testDeviceConfig
+	config.ReadCacheBytes = units.Mebibyte
+	config.ReadCacheHitTime = time.Microsecond
+	s := scheduler.New(&config)
+	var reads []*scheduler.ScheduledRequest
+	s.AddScheduleHook(func(r *scheduler.ScheduledRequest) {
+		if r.Request.Type == scheduler.ReadRequest {
+			reads = append(reads, r)
+		}
+	})
+	c := connect(t, newTestServerWithScheduler(t, s))
+	startTransmission(t, c)
+
+	// Discarding the start of the device, as mkfs and fstrim do, leaves what's cached past it.
+	offset := uint64(512 * units.Kibibyte)
+	if errno, _ := c.request(cmdRead, offset, 4096, nil); errno != 0 {
+		t.Fatalf("read failed with %d", errno)
+	}
+	if errno, _ := c.request(cmdTrim, 0, 4096, nil); errno != 0 {
+		t.Fatalf("trim failed with %d", errno)
+	}
+	if errno, _ := c.request(cmdWriteZeroes, 4096, 4096, nil); errno != 0 {
+		t.Fatalf("write zeroes failed with %d", errno)
+	}
+	if errno, _ := c.request(cmdRead, offset, 4096, nil); errno != 0 {
+		t.Fatalf("read failed with %d", errno)
+	}
+	if got, want := len(reads), 2; got != want {
+		t.Fatalf("got %d reads, want %d", got, want)
+	}
+	if got, want := reads[1].Cost, (scheduler.Cost{Fixed: time.Microsecond}); got != want {
+		t.Errorf("cost of reading cached data after a trim = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MatchesPath reports whether path, or any directory containing it, matches the glob pattern.
+// Both are relative to the root of the mount, and leading or trailing slashes are ignored.
+func MatchesPath(pattern, path string) bool {
+	pattern = strings.Trim(filepath.Clean(pattern), "/")
+	path = strings.Trim(filepath.Clean(path), "/")
+	for path != "." && path != "" {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		path = filepath.Dir(path)
+	}
+	return false
+}
+
+// PathRule says that paths matching Pattern, as for MatchesPath, are stored on the device with the
+// config named Device.
+type PathRule struct {
+	Pattern string
+	Device  string
+}
+
+// ParsePathRulesFromString parses comma separated pattern=device rules, e.g.
+// "fast=ssd,archive=hdd7200rpm".
+func ParsePathRulesFromString(s string) ([]PathRule, error) {
+	var rules []PathRule
+	for _, r := range strings.Split(s, ",") {
+		i := strings.LastIndexByte(r, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("path rule %q: want pattern=device", r)
+		}
+		rule := PathRule{Pattern: strings.TrimSpace(r[:i]), Device: strings.TrimSpace(r[i+1:])}
+		if rule.Pattern == "" || rule.Device == "" {
+			return nil, fmt.Errorf("path rule %q: want pattern=device", r)
+		}
+		if _, err := filepath.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("path rule %q: %s", r, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
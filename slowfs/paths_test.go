@@ -0,0 +1,68 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchesPath(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"pg_wal", "pg_wal", true},
+		{"pg_wal", "pg_wal/000000010000000000000001", true},
+		{"pg_wal/", "/pg_wal/a/b", true},
+		{"pg_wal", "pg_wal2/a", false},
+		{"pg_wal", "data/pg_wal", false},
+		{"*/journal", "db1/journal/0001", true},
+		{"*.log", "wal.log", true},
+		{"*.log", "dir/wal.log", false},
+		{"dir/*.log", "dir/wal.log", true},
+		{"a", "", false},
+	}
+
+	for _, c := range cases {
+		if got, want := MatchesPath(c.pattern, c.path), c.want; got != want {
+			t.Errorf("MatchesPath(%q, %q) = %t, want %t", c.pattern, c.path, got, want)
+		}
+	}
+}
+
+func TestParsePathRulesFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      []PathRule
+		shouldErr bool
+	}{
+		{"fast=ssd", []PathRule{{"fast", "ssd"}}, false},
+		{"fast=ssd, archive/*.tar = hdd", []PathRule{{"fast", "ssd"}, {"archive/*.tar", "hdd"}}, false},
+		{"fast", nil, true},
+		{"=ssd", nil, true},
+		{"fast=", nil, true},
+		{"fast=ssd,", nil, true},
+		{"[fast=ssd", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParsePathRulesFromString(c.s)
+		if !reflect.DeepEqual(got, c.want) || c.shouldErr != (err != nil) {
+			t.Errorf("ParsePathRulesFromString(%q) = %v, %v, want %v, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
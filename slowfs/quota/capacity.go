@@ -0,0 +1,75 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"errors"
+	"slowfs/slowfs/units"
+	"sync"
+)
+
+// ErrNoSpace is returned when a change would take usage past a device's capacity.
+var ErrNoSpace = errors.New("no space left on device")
+
+// Capacity tracks how much of a device's fixed size files take up, so that it can fill up
+// independently of the backing directory's free space. It is safe for concurrent use.
+type Capacity struct {
+	mu    sync.Mutex
+	bytes units.NumBytes
+	used  units.NumBytes
+}
+
+// NewCapacity creates a Capacity for a device of the given size, with nothing used yet.
+func NewCapacity(bytes units.NumBytes) *Capacity {
+	return &Capacity{bytes: bytes}
+}
+
+// Scan adds the size of the files already in the directory root to what is used, so that usage
+// matches the backing directory. It should be called before the filesystem is mounted.
+func (c *Capacity) Scan(root string) error {
+	return scan(root, func(owner Owner, path string, size units.NumBytes) {
+		c.mu.Lock()
+		c.used += size
+		c.mu.Unlock()
+	})
+}
+
+// Charge records that files grow by numBytes, which is negative when they shrink or are removed. If
+// that would take usage past the capacity, nothing is recorded and ErrNoSpace is returned. Shrinking
+// always succeeds, even if usage is already past it, but never takes usage below zero.
+func (c *Capacity) Charge(numBytes units.NumBytes) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if numBytes > 0 && c.used+numBytes > c.bytes {
+		return ErrNoSpace
+	}
+	c.used += numBytes
+	if c.used < 0 {
+		c.used = 0
+	}
+	return nil
+}
+
+// Bytes returns the size of the device.
+func (c *Capacity) Bytes() units.NumBytes {
+	return c.bytes
+}
+
+// Used returns how many bytes files take up.
+func (c *Capacity) Used() units.NumBytes {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.used
+}
@@ -0,0 +1,376 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quota simulates disk quotas, which limit how much space and how many files each user,
+// group or project directory may use, for testing how multi-tenant applications handle EDQUOT.
+package quota
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ErrExceeded is returned when a change would take usage past a limit.
+var ErrExceeded = errors.New("quota exceeded")
+
+// Kind is what a limit applies to.
+type Kind int
+
+const (
+	// UserQuota limits the files owned by a user.
+	UserQuota Kind = iota
+	// GroupQuota limits the files owned by a group.
+	GroupQuota
+	// ProjectQuota limits the files in a directory, like XFS and ext4 project quotas.
+	ProjectQuota
+)
+
+func (k Kind) String() string {
+	switch k {
+	case UserQuota:
+		return "user"
+	case GroupQuota:
+		return "group"
+	case ProjectQuota:
+		return "project"
+	default:
+		return "unknown quota kind"
+	}
+}
+
+// ParseKindFromString parses a Kind from the given string. This function is case insensitive, and
+// also accepts synonyms for each Kind. For example, uid and user both map to UserQuota.
+func ParseKindFromString(s string) (Kind, error) {
+	switch strings.ToLower(s) {
+	case "userquota", "user", "uid":
+		return UserQuota, nil
+	case "groupquota", "group", "gid":
+		return GroupQuota, nil
+	case "projectquota", "project", "directory":
+		return ProjectQuota, nil
+	default:
+		return 0, fmt.Errorf("unknown quota kind %s", s)
+	}
+}
+
+// Limit limits how much space and how many files some set of files may use.
+type Limit struct {
+	Kind Kind
+	// ID is the user or group ID the limit applies to, for UserQuota and GroupQuota.
+	ID uint32
+	// Project is a glob pattern matching the directories the limit applies to, for ProjectQuota,
+	// relative to the root of the mount. Everything inside them counts against the limit.
+	Project string
+	// Bytes is how many bytes the files may take up. Zero means unlimited.
+	Bytes units.NumBytes
+	// Files is how many files, directories and other entries there may be. Zero means unlimited.
+	Files int64
+}
+
+func (l *Limit) String() string {
+	if l.Kind == ProjectQuota {
+		return fmt.Sprintf("%s %s", l.Kind, l.Project)
+	}
+	return fmt.Sprintf("%s %d", l.Kind, l.ID)
+}
+
+// Owner is who owns a file.
+type Owner struct {
+	UID uint32
+	GID uint32
+}
+
+// appliesTo returns whether the limit applies to the file at path owned by owner.
+func (l *Limit) appliesTo(owner Owner, path string) bool {
+	switch l.Kind {
+	case UserQuota:
+		return owner.UID == l.ID
+	case GroupQuota:
+		return owner.GID == l.ID
+	case ProjectQuota:
+		return slowfs.MatchesPath(l.Project, path)
+	default:
+		return false
+	}
+}
+
+// Usage is how much of a limit is used.
+type Usage struct {
+	Limit
+	Bytes units.NumBytes
+	Files int64
+}
+
+func (u *Usage) String() string {
+	return fmt.Sprintf("%s: %d of %s bytes, %d of %s files", &u.Limit, u.Bytes, maxString(int64(u.Limit.Bytes)), u.Files, maxString(u.Limit.Files))
+}
+
+func maxString(max int64) string {
+	if max == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(max)
+}
+
+// exceededBy returns whether growing by numBytes and files takes the usage past its limit.
+// Shrinking never does, even if the usage is already past it.
+func (u *Usage) exceededBy(numBytes units.NumBytes, files int64) bool {
+	if numBytes > 0 && u.Limit.Bytes > 0 && u.Bytes+numBytes > u.Limit.Bytes {
+		return true
+	}
+	return files > 0 && u.Limit.Files > 0 && u.Files+files > u.Limit.Files
+}
+
+// Quotas tracks how much of each of a set of limits is used. It is safe for concurrent use.
+type Quotas struct {
+	mu     sync.Mutex
+	usages []Usage
+}
+
+// New creates Quotas enforcing the given limits, with nothing used yet.
+func New(limits []Limit) *Quotas {
+	q := &Quotas{}
+	for _, l := range limits {
+		q.usages = append(q.usages, Usage{Limit: l})
+	}
+	return q
+}
+
+// Scan adds what the files already in the directory root use to each limit, so that usage matches
+// the backing directory. It should be called before the filesystem is mounted.
+func (q *Quotas) Scan(root string) error {
+	return scan(root, func(owner Owner, path string, size units.NumBytes) {
+		q.mu.Lock()
+		q.add(owner, path, size, 1)
+		q.mu.Unlock()
+	})
+}
+
+// scan calls add for each entry inside the directory root, with its owner, its path relative to
+// root and its size, which is zero for anything but regular files. A file with several hard links
+// is only added for the first, since they share its blocks.
+func scan(root string, add func(owner Owner, path string, size units.NumBytes)) error {
+	type inode struct{ dev, ino uint64 }
+	linked := make(map[inode]bool)
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		var owner Owner
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			owner = Owner{UID: st.Uid, GID: st.Gid}
+			if !info.IsDir() && st.Nlink > 1 {
+				key := inode{uint64(st.Dev), uint64(st.Ino)}
+				if linked[key] {
+					return nil
+				}
+				linked[key] = true
+			}
+		}
+		var size units.NumBytes
+		if info.Mode().IsRegular() {
+			size = units.NumBytes(info.Size())
+		}
+		add(owner, rel, size)
+		return nil
+	})
+}
+
+// Charge records that the file at path owned by owner grows by numBytes and files, either of which
+// is negative when it shrinks or is removed. If that would take any limit which applies to the file
+// past its maximum, nothing is recorded and ErrExceeded is returned.
+func (q *Quotas) Charge(owner Owner, path string, numBytes units.NumBytes, files int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.usages {
+		u := &q.usages[i]
+		if u.appliesTo(owner, path) && u.exceededBy(numBytes, files) {
+			return ErrExceeded
+		}
+	}
+	q.add(owner, path, numBytes, files)
+	return nil
+}
+
+// Chown records that the file at path, which takes up numBytes, is now owned by to instead of from.
+// If that would take any limit which applies to to past its maximum, nothing is recorded and
+// ErrExceeded is returned.
+func (q *Quotas) Chown(from Owner, to Owner, path string, numBytes units.NumBytes) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.usages {
+		u := &q.usages[i]
+		if u.appliesTo(to, path) && !u.appliesTo(from, path) && u.exceededBy(numBytes, 1) {
+			return ErrExceeded
+		}
+	}
+	for i := range q.usages {
+		u := &q.usages[i]
+		switch from, to := u.appliesTo(from, path), u.appliesTo(to, path); {
+		case to && !from:
+			u.Bytes += numBytes
+			u.Files++
+		case from && !to:
+			u.Bytes -= numBytes
+			u.Files--
+		}
+	}
+	return nil
+}
+
+// SameProjects returns whether the same project limits apply to paths a and b. Like on real
+// filesystems, files can't be renamed between projects.
+func (q *Quotas) SameProjects(a string, b string) bool {
+	for i := range q.usages {
+		l := &q.usages[i].Limit
+		if l.Kind == ProjectQuota && slowfs.MatchesPath(l.Project, a) != slowfs.MatchesPath(l.Project, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// add adds to the usage of every limit which applies to the file at path owned by owner. q.mu must
+// be held.
+func (q *Quotas) add(owner Owner, path string, numBytes units.NumBytes, files int64) {
+	for i := range q.usages {
+		u := &q.usages[i]
+		if u.appliesTo(owner, path) {
+			// Freeing more than is charged, as for files which predate the quota, leaves nothing used.
+			u.Bytes += numBytes
+			if u.Bytes < 0 {
+				u.Bytes = 0
+			}
+			u.Files += files
+			if u.Files < 0 {
+				u.Files = 0
+			}
+		}
+	}
+}
+
+// Usages returns how much of each limit is used, in the order the limits were given.
+func (q *Quotas) Usages() []Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Usage(nil), q.usages...)
+}
+
+// Report returns how much of each limit is used, one limit per line.
+func (q *Quotas) Report() string {
+	var b strings.Builder
+	for _, u := range q.Usages() {
+		fmt.Fprintf(&b, "%s\n", &u)
+	}
+	return b.String()
+}
+
+// LimitSpec is how a Limit is written down, e.g. in JSON. Like device configs, sizes are strings.
+type LimitSpec struct {
+	Kind    string
+	ID      uint32
+	Project string
+	Bytes   string
+	Files   int64
+}
+
+// Parse parses the limit the spec describes.
+func (j *LimitSpec) Parse() (Limit, error) {
+	var l Limit
+	var err error
+	if l.Kind, err = ParseKindFromString(j.Kind); err != nil {
+		return l, fmt.Errorf("Kind: %s", err)
+	}
+	if l.Kind == ProjectQuota && j.Project == "" {
+		return l, errors.New("Project: required for project quotas")
+	}
+	if l.Kind != ProjectQuota && j.Project != "" {
+		return l, fmt.Errorf("Project: not allowed for %s quotas", l.Kind)
+	}
+	if j.Bytes != "" {
+		if l.Bytes, err = units.ParseNumBytesFromString(j.Bytes); err != nil {
+			return l, fmt.Errorf("Bytes: %s", err)
+		}
+	}
+	if l.Bytes < 0 {
+		return l, errors.New("Bytes: cannot be negative")
+	}
+	if j.Files < 0 {
+		return l, errors.New("Files: cannot be negative")
+	}
+	l.ID = j.ID
+	l.Project = j.Project
+	l.Files = j.Files
+	return l, nil
+}
+
+// ParseLimitsFromJSON parses quota limits, either as a JSON array of limits or as one JSON limit
+// per line. For example:
+//
+//	[{"Kind": "user", "ID": 1000, "Bytes": "10GB", "Files": 100000},
+//	 {"Kind": "project", "Project": "tenants/a", "Bytes": "1GB"}]
+func ParseLimitsFromJSON(data []byte) ([]Limit, error) {
+	var specs []LimitSpec
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&specs); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var j LimitSpec
+			dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&j); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			specs = append(specs, j)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	limits := make([]Limit, 0, len(specs))
+	for i, j := range specs {
+		l, err := j.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("limit %d: %s", i, err)
+		}
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
@@ -0,0 +1,279 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slowfs/slowfs/units"
+	"testing"
+)
+
+func TestParseKindFromString(t *testing.T) {
+	cases := []struct {
+		strKind   string
+		want      Kind
+		shouldErr bool
+	}{
+		{"user", UserQuota, false},
+		{"GID", GroupQuota, false},
+		{"ProjectQuota", ProjectQuota, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseKindFromString(c.strKind)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseKindFromString(%s) = %s, %v, want %s, error %t", c.strKind, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestQuotas_Charge(t *testing.T) {
+	q := New([]Limit{
+		{Kind: UserQuota, ID: 1000, Bytes: 100},
+		{Kind: GroupQuota, ID: 100, Files: 2},
+		{Kind: ProjectQuota, Project: "tenants/a", Bytes: 50},
+	})
+	alice := Owner{UID: 1000, GID: 100}
+	bob := Owner{UID: 1001, GID: 101}
+
+	steps := []struct {
+		owner    Owner
+		path     string
+		numBytes units.NumBytes
+		files    int64
+		wantErr  error
+	}{
+		{alice, "a", 0, 1, nil},
+		{alice, "a", 80, 0, nil},
+		// Past the user's byte limit.
+		{alice, "a", 21, 0, ErrExceeded},
+		{alice, "b", 0, 1, nil},
+		// Past the group's file limit.
+		{alice, "c", 0, 1, ErrExceeded},
+		// Shrinking always works.
+		{alice, "a", -80, 0, nil},
+		// Freeing more than is charged leaves nothing used.
+		{alice, "a", -1000, 0, nil},
+		// Past the project's byte limit, whoever owns the file.
+		{bob, "tenants/a/x", 0, 1, nil},
+		{bob, "tenants/a/x", 51, 0, ErrExceeded},
+		{bob, "tenants/b/x", 51, 1, nil},
+	}
+
+	for i, s := range steps {
+		if err := q.Charge(s.owner, s.path, s.numBytes, s.files); err != s.wantErr {
+			t.Errorf("step %d: Charge(%+v, %s, %d, %d) = %v, want %v", i, s.owner, s.path, s.numBytes, s.files, err, s.wantErr)
+		}
+	}
+
+	want := []Usage{
+		{Limit: Limit{Kind: UserQuota, ID: 1000, Bytes: 100}, Bytes: 0, Files: 2},
+		{Limit: Limit{Kind: GroupQuota, ID: 100, Files: 2}, Bytes: 0, Files: 2},
+		{Limit: Limit{Kind: ProjectQuota, Project: "tenants/a", Bytes: 50}, Bytes: 0, Files: 1},
+	}
+	if got := q.Usages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Usages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestQuotas_Chown(t *testing.T) {
+	q := New([]Limit{
+		{Kind: UserQuota, ID: 1000, Bytes: 100},
+		{Kind: UserQuota, ID: 1001, Bytes: 100},
+	})
+	alice := Owner{UID: 1000}
+	bob := Owner{UID: 1001}
+	if err := q.Charge(alice, "a", 60, 1); err != nil {
+		t.Fatalf("Charge() = %v, want nil", err)
+	}
+	if err := q.Charge(bob, "b", 60, 1); err != nil {
+		t.Fatalf("Charge() = %v, want nil", err)
+	}
+
+	if got, want := q.Chown(alice, bob, "a", 60), ErrExceeded; got != want {
+		t.Errorf("Chown() past bob's limit = %v, want %v", got, want)
+	}
+	if err := q.Chown(bob, alice, "b", 60); err != ErrExceeded {
+		t.Errorf("Chown() past alice's limit = %v, want %v", err, ErrExceeded)
+	}
+	if err := q.Charge(bob, "b", -30, 0); err != nil {
+		t.Fatalf("Charge() = %v, want nil", err)
+	}
+	if err := q.Chown(bob, alice, "b", 30); err != nil {
+		t.Errorf("Chown() = %v, want nil", err)
+	}
+
+	usages := q.Usages()
+	if got, want := usages[0].Bytes, units.NumBytes(90); got != want {
+		t.Errorf("alice's usage after Chown() = %d, want %d", got, want)
+	}
+	if got, want := usages[1].Bytes, units.NumBytes(0); got != want {
+		t.Errorf("bob's usage after Chown() = %d, want %d", got, want)
+	}
+}
+
+func TestQuotas_SameProjects(t *testing.T) {
+	q := New([]Limit{
+		{Kind: UserQuota, ID: 1000},
+		{Kind: ProjectQuota, Project: "tenants/a"},
+	})
+
+	cases := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{"x", "y", true},
+		{"tenants/a/x", "tenants/a/y/z", true},
+		{"tenants/a/x", "tenants/b/x", false},
+		{"x", "tenants/a/x", false},
+	}
+
+	for _, c := range cases {
+		if got := q.SameProjects(c.a, c.b); got != c.want {
+			t.Errorf("SameProjects(%s, %s) = %t, want %t", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestQuotas_Scan(t *testing.T) {
+	root, err := ioutil.TempDir("", "quota_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "p", "d"), 0755); err != nil {
+		t.Fatalf("MkdirAll error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "p", "d", "f"), make([]byte, 10), 0644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "g"), make([]byte, 5), 0644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+
+	q := New([]Limit{{Kind: ProjectQuota, Project: "p"}})
+	if err := q.Scan(root); err != nil {
+		t.Fatalf("Scan() = %v, want nil", err)
+	}
+	// p itself, p/d and p/d/f.
+	if got, want := q.Usages()[0], (Usage{Limit: Limit{Kind: ProjectQuota, Project: "p"}, Bytes: 10, Files: 3}); got != want {
+		t.Errorf("Usages()[0] after Scan() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseLimitsFromJSON(t *testing.T) {
+	cases := []struct {
+		desc      string
+		data      string
+		want      []Limit
+		shouldErr bool
+	}{
+		{
+			"array",
+			`[{"Kind": "user", "ID": 1000, "Bytes": "10GB", "Files": 100},
+			  {"Kind": "project", "Project": "tenants/a", "Bytes": "1GB"}]`,
+			[]Limit{
+				{Kind: UserQuota, ID: 1000, Bytes: 10 * units.Gigabyte, Files: 100},
+				{Kind: ProjectQuota, Project: "tenants/a", Bytes: 1 * units.Gigabyte},
+			},
+			false,
+		},
+		{
+			"lines",
+			`{"Kind": "group", "ID": 100, "Files": 5}
+
+			{"Kind": "uid", "ID": 0}`,
+			[]Limit{
+				{Kind: GroupQuota, ID: 100, Files: 5},
+				{Kind: UserQuota, ID: 0},
+			},
+			false,
+		},
+		{"project without path", `[{"Kind": "project", "Bytes": "1GB"}]`, nil, true},
+		{"user with path", `[{"Kind": "user", "Project": "a"}]`, nil, true},
+		{"bad size", `[{"Kind": "user", "Bytes": "lots"}]`, nil, true},
+		{"negative files", `[{"Kind": "user", "Files": -1}]`, nil, true},
+		{"unknown field", `[{"Kind": "user", "Inodes": 5}]`, nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseLimitsFromJSON([]byte(c.data))
+		if c.shouldErr != (err != nil) {
+			t.Errorf("fail (%s): ParseLimitsFromJSON() = _, %v, want error %t", c.desc, err, c.shouldErr)
+			continue
+		}
+		if !c.shouldErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("fail (%s): ParseLimitsFromJSON() = %+v, want %+v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestUsage_String(t *testing.T) {
+	u := Usage{Limit: Limit{Kind: ProjectQuota, Project: "tenants/a", Bytes: 100}, Bytes: 10, Files: 2}
+	if got, want := u.String(), "project tenants/a: 10 of 100 bytes, 2 of unlimited files"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	root, err := ioutil.TempDir("", "quota_test")
+	if err != nil {
+		t.Fatalf("TempDir error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "d"), 0755); err != nil {
+		t.Fatalf("MkdirAll error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "d", "f"), make([]byte, 60), 0644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+	// A second hard link shares the file's blocks, so it doesn't use any more.
+	if err := os.Link(filepath.Join(root, "d", "f"), filepath.Join(root, "g")); err != nil {
+		t.Fatalf("Link error: %s", err)
+	}
+
+	c := NewCapacity(100)
+	if err := c.Scan(root); err != nil {
+		t.Fatalf("Scan() = %v, want nil", err)
+	}
+	if got, want := c.Used(), units.NumBytes(60); got != want {
+		t.Errorf("Used() after Scan() = %d, want %d", got, want)
+	}
+	if got, want := c.Charge(41), ErrNoSpace; got != want {
+		t.Errorf("Charge(41) = %v, want %v", got, want)
+	}
+	if err := c.Charge(40); err != nil {
+		t.Errorf("Charge(40) = %v, want nil", err)
+	}
+	// Shrinking always succeeds.
+	if err := c.Charge(-100); err != nil {
+		t.Errorf("Charge(-100) = %v, want nil", err)
+	}
+	if got, want := c.Used(), units.NumBytes(0); got != want {
+		t.Errorf("Used() = %d, want %d", got, want)
+	}
+	// Freeing more than is used never takes usage below zero.
+	if err := c.Charge(-10); err != nil {
+		t.Errorf("Charge(-10) = %v, want nil", err)
+	}
+	if got, want := c.Used(), units.NumBytes(0); got != want {
+		t.Errorf("Used() after freeing more than is used = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Comparison is how a condition compares a metric with its threshold.
+type Comparison int
+
+// Comparisons which can be used in conditions.
+const (
+	Greater Comparison = iota
+	GreaterOrEqual
+	Less
+	LessOrEqual
+)
+
+// Longer operators come first, so that ">=" isn't taken for ">".
+var comparisonOperators = []struct {
+	operator   string
+	comparison Comparison
+}{
+	{">=", GreaterOrEqual},
+	{"<=", LessOrEqual},
+	{">", Greater},
+	{"<", Less},
+}
+
+func (c Comparison) String() string {
+	for _, o := range comparisonOperators {
+		if o.comparison == c {
+			return o.operator
+		}
+	}
+	return "unknown Comparison"
+}
+
+// Condition compares a metric, like the device's backlog, with a threshold.
+type Condition struct {
+	Metric     string
+	Comparison Comparison
+	Threshold  float64
+}
+
+func (c Condition) String() string {
+	return fmt.Sprintf("%s %s %g", c.Metric, c.Comparison, c.Threshold)
+}
+
+// Holds returns whether the condition holds when the metric has the given value.
+func (c Condition) Holds(value float64) bool {
+	switch c.Comparison {
+	case Greater:
+		return value > c.Threshold
+	case GreaterOrEqual:
+		return value >= c.Threshold
+	case Less:
+		return value < c.Threshold
+	case LessOrEqual:
+		return value <= c.Threshold
+	}
+	return false
+}
+
+// ParseConditionFromString parses a condition written like "backlog > 32".
+func ParseConditionFromString(s string) (Condition, error) {
+	for _, o := range comparisonOperators {
+		i := strings.Index(s, o.operator)
+		if i < 0 {
+			continue
+		}
+		metric := strings.TrimSpace(s[:i])
+		if metric == "" {
+			return Condition{}, fmt.Errorf("condition %q has no metric", s)
+		}
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(s[i+len(o.operator):]), 64)
+		if err != nil {
+			return Condition{}, fmt.Errorf("condition %q: %s", s, err)
+		}
+		return Condition{Metric: metric, Comparison: o.comparison, Threshold: threshold}, nil
+	}
+	return Condition{}, fmt.Errorf("condition %q should compare a metric using one of >, >=, < or <=", s)
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import "testing"
+
+func TestComparison_String(t *testing.T) {
+	cases := []struct {
+		comparison Comparison
+		want       string
+	}{
+		{Greater, ">"},
+		{GreaterOrEqual, ">="},
+		{Less, "<"},
+		{LessOrEqual, "<="},
+		{Comparison(-1), "unknown Comparison"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.comparison.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.comparison, got, want)
+		}
+	}
+}
+
+func TestParseConditionFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      Condition
+		shouldErr bool
+	}{
+		{"backlog > 32", Condition{"backlog", Greater, 32}, false},
+		{"backlog>=32", Condition{"backlog", GreaterOrEqual, 32}, false},
+		{"  queued < 0.5 ", Condition{"queued", Less, 0.5}, false},
+		{"elapsed <= 600", Condition{"elapsed", LessOrEqual, 600}, false},
+		{"backlog = 32", Condition{}, true},
+		{"> 32", Condition{}, true},
+		{"backlog > lots", Condition{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseConditionFromString(c.s)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseConditionFromString(%q) = %+v, %v, want %+v, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestCondition_Holds(t *testing.T) {
+	cases := []struct {
+		condition Condition
+		value     float64
+		want      bool
+	}{
+		{Condition{"backlog", Greater, 32}, 33, true},
+		{Condition{"backlog", Greater, 32}, 32, false},
+		{Condition{"backlog", GreaterOrEqual, 32}, 32, true},
+		{Condition{"backlog", Less, 32}, 32, false},
+		{Condition{"backlog", LessOrEqual, 32}, 32, true},
+		{Condition{"backlog", LessOrEqual, 32}, 33, false},
+	}
+
+	for _, c := range cases {
+		if got, want := c.condition.Holds(c.value), c.want; got != want {
+			t.Errorf("(%s).Holds(%g) = %t, want %t", c.condition, c.value, got, want)
+		}
+	}
+}
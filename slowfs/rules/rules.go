@@ -0,0 +1,263 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rules runs actions when conditions on slowfs's state become true, like stalling the
+// device once its backlog grows past a threshold. This lets scenarios which react to the workload
+// be set up declaratively, without orchestrating slowfs from outside.
+package rules
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slowfs/slowfs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Target is what actions act on. It is satisfied by *scheduler.Scheduler.
+type Target interface {
+	Stall(d time.Duration)
+	UpdateConfig(update func(config *slowfs.DeviceConfig) error) error
+}
+
+// Action is something a rule does when its condition becomes true.
+type Action interface {
+	Run(target Target) error
+	String() string
+}
+
+// LogAction logs a message.
+type LogAction struct {
+	Message string
+}
+
+// Run logs the message.
+func (a *LogAction) Run(Target) error {
+	log.Printf("rule: %s", a.Message)
+	return nil
+}
+
+func (a *LogAction) String() string {
+	return fmt.Sprintf("log %q", a.Message)
+}
+
+// StallAction makes the device stop responding for a while.
+type StallAction struct {
+	Duration time.Duration
+}
+
+// Run stalls the target.
+func (a *StallAction) Run(target Target) error {
+	target.Stall(a.Duration)
+	return nil
+}
+
+func (a *StallAction) String() string {
+	return fmt.Sprintf("stall for %s", a.Duration)
+}
+
+// ConfigAction changes fields of the device config, which are named and written as in config
+// files.
+type ConfigAction struct {
+	Fields map[string]string
+}
+
+// Run updates the target's config.
+func (a *ConfigAction) Run(target Target) error {
+	return target.UpdateConfig(func(config *slowfs.DeviceConfig) error {
+		for name, value := range a.Fields {
+			if err := config.SetField(name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (a *ConfigAction) String() string {
+	names := make([]string, 0, len(a.Fields))
+	for name := range a.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = name + "=" + a.Fields[name]
+	}
+	return "set " + strings.Join(fields, " ")
+}
+
+// Rule runs an action each time its condition becomes true. The action isn't run again until the
+// condition has stopped holding, so that e.g. a stall triggered by a backlog doesn't keep
+// extending itself.
+type Rule struct {
+	When   Condition
+	Action Action
+}
+
+// Engine checks rules against metrics, running their actions when they fire.
+type Engine struct {
+	rules   []Rule
+	metrics map[string]func() float64
+	target  Target
+
+	mu sync.Mutex
+	// Which rules' conditions held when last checked.
+	holding []bool
+}
+
+// NewEngine creates an Engine checking rules against the given metrics, and running actions on
+// target. Every metric a rule uses must be in metrics.
+func NewEngine(rules []Rule, metrics map[string]func() float64, target Target) (*Engine, error) {
+	for i, r := range rules {
+		if _, ok := metrics[r.When.Metric]; !ok {
+			return nil, fmt.Errorf("rule %d: unknown metric %s (want one of %s)", i, r.When.Metric, strings.Join(metricNames(metrics), ", "))
+		}
+	}
+	return &Engine{
+		rules:   rules,
+		metrics: metrics,
+		target:  target,
+		holding: make([]bool, len(rules)),
+	}, nil
+}
+
+func metricNames(metrics map[string]func() float64) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check checks every rule once, running the actions of those whose conditions have become true.
+func (e *Engine) Check() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, r := range e.rules {
+		value := e.metrics[r.When.Metric]()
+		holds := r.When.Holds(value)
+		if holds && !e.holding[i] {
+			log.Printf("rule fired: %s (%s is %g), so %s", r.When, r.When.Metric, value, r.Action)
+			if err := r.Action.Run(e.target); err != nil {
+				log.Printf("rule action %s failed: %s", r.Action, err)
+			}
+		}
+		e.holding[i] = holds
+	}
+}
+
+// Run checks the rules every interval, forever.
+func (e *Engine) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		e.Check()
+	}
+}
+
+// RuleSpec is how a Rule is written down, e.g. in JSON. Do says which action to take: "log" with
+// a Message, "stall" for a Duration, or "config" to Set config fields.
+type RuleSpec struct {
+	When     string
+	Do       string
+	Message  string
+	Duration string
+	Set      map[string]string
+}
+
+// Parse parses the rule the spec describes.
+func (j *RuleSpec) Parse() (Rule, error) {
+	var r Rule
+	var err error
+	if r.When, err = ParseConditionFromString(j.When); err != nil {
+		return r, fmt.Errorf("When: %s", err)
+	}
+	switch strings.ToLower(j.Do) {
+	case "log":
+		r.Action = &LogAction{Message: j.Message}
+	case "stall":
+		d, err := time.ParseDuration(j.Duration)
+		if err != nil {
+			return r, fmt.Errorf("Duration: %s", err)
+		}
+		if d <= 0 {
+			return r, fmt.Errorf("Duration: must be positive")
+		}
+		r.Action = &StallAction{Duration: d}
+	case "config":
+		// Check the fields up front, rather than when the rule first fires.
+		var config slowfs.DeviceConfig
+		for name, value := range j.Set {
+			if err := config.SetField(name, value); err != nil {
+				return r, fmt.Errorf("Set: %s", err)
+			}
+		}
+		if len(j.Set) == 0 {
+			return r, fmt.Errorf("Set: no fields to set")
+		}
+		r.Action = &ConfigAction{Fields: j.Set}
+	default:
+		return r, fmt.Errorf("Do: unknown action %q (want log, stall or config)", j.Do)
+	}
+	return r, nil
+}
+
+// ParseRulesFromJSON parses rules, either as a JSON array or as one JSON rule per line. For
+// example:
+//
+//	[{"When": "backlog > 32", "Do": "stall", "Duration": "2s"},
+//	 {"When": "elapsed >= 600", "Do": "config", "Set": {"ReadBytesPerSecond": "1MiB"}},
+//	 {"When": "queued > 100", "Do": "log", "Message": "queue is very deep"}]
+func ParseRulesFromJSON(data []byte) ([]Rule, error) {
+	var specs []RuleSpec
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&specs); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var j RuleSpec
+			dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&j); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			specs = append(specs, j)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	rules := make([]Rule, 0, len(specs))
+	for i, j := range specs {
+		r, err := j.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
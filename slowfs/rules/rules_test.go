@@ -0,0 +1,122 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+type fakeTarget struct {
+	stalls []time.Duration
+	config slowfs.DeviceConfig
+}
+
+func (t *fakeTarget) Stall(d time.Duration) {
+	t.stalls = append(t.stalls, d)
+}
+
+func (t *fakeTarget) UpdateConfig(update func(config *slowfs.DeviceConfig) error) error {
+	return update(&t.config)
+}
+
+func TestEngine_Check(t *testing.T) {
+	backlog := 0.0
+	target := &fakeTarget{}
+	e, err := NewEngine([]Rule{
+		{Condition{"backlog", Greater, 10}, &StallAction{Duration: time.Second}},
+		{Condition{"backlog", Greater, 20}, &ConfigAction{Fields: map[string]string{"ReadBytesPerSecond": "1KiB"}}},
+	}, map[string]func() float64{
+		"backlog": func() float64 { return backlog },
+	}, target)
+	if err != nil {
+		t.Fatalf("NewEngine() = _, %s", err)
+	}
+
+	// Rules fire when their conditions become true, and again only after they've stopped holding.
+	for _, b := range []float64{5, 11, 15, 25, 8, 12} {
+		backlog = b
+		e.Check()
+	}
+	if got, want := target.stalls, []time.Duration{time.Second, time.Second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stalls = %v, want %v", got, want)
+	}
+	if got, want := target.config.ReadBytesPerSecond, 1*units.Kibibyte; got != want {
+		t.Errorf("ReadBytesPerSecond = %d, want %d", got, want)
+	}
+}
+
+func TestNewEngine_UnknownMetric(t *testing.T) {
+	_, err := NewEngine([]Rule{
+		{Condition{"bakclog", Greater, 10}, &LogAction{Message: "typo"}},
+	}, map[string]func() float64{
+		"backlog": func() float64 { return 0 },
+	}, &fakeTarget{})
+	if err == nil {
+		t.Errorf("NewEngine() with unknown metric = _, nil, want error")
+	}
+}
+
+func TestParseRulesFromJSON(t *testing.T) {
+	cases := []struct {
+		data      string
+		want      []Rule
+		shouldErr bool
+	}{
+		{
+			data: `[{"When": "backlog > 32", "Do": "stall", "Duration": "2s"},
+				{"When": "elapsed >= 600", "Do": "config", "Set": {"ReadBytesPerSecond": "1MiB"}}]`,
+			want: []Rule{
+				{Condition{"backlog", Greater, 32}, &StallAction{Duration: 2 * time.Second}},
+				{Condition{"elapsed", GreaterOrEqual, 600}, &ConfigAction{Fields: map[string]string{"ReadBytesPerSecond": "1MiB"}}},
+			},
+		},
+		{
+			data: "{\"When\": \"queued > 100\", \"Do\": \"log\", \"Message\": \"deep\"}\n\n{\"When\": \"queued < 1\", \"Do\": \"LOG\"}\n",
+			want: []Rule{
+				{Condition{"queued", Greater, 100}, &LogAction{Message: "deep"}},
+				{Condition{"queued", Less, 1}, &LogAction{}},
+			},
+		},
+		{data: `[{"When": "backlog > 32", "Do": "panic"}]`, shouldErr: true},
+		{data: `[{"When": "backlog > 32", "Do": "stall"}]`, shouldErr: true},
+		{data: `[{"When": "backlog > 32", "Do": "stall", "Duration": "-1s"}]`, shouldErr: true},
+		{data: `[{"When": "backlog > 32", "Do": "config"}]`, shouldErr: true},
+		{data: `[{"When": "backlog > 32", "Do": "config", "Set": {"Colour": "blue"}}]`, shouldErr: true},
+		{data: `[{"When": "backlog", "Do": "log"}]`, shouldErr: true},
+		{data: `[{"When": "backlog > 32", "Do": "log", "Mesage": "typo"}]`, shouldErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRulesFromJSON([]byte(c.data))
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseRulesFromJSON(%s) = _, %v, want error %t", c.data, err, c.shouldErr)
+			continue
+		}
+		if !c.shouldErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseRulesFromJSON(%s) = %v, want %v", c.data, got, c.want)
+		}
+	}
+}
+
+func TestConfigAction_String(t *testing.T) {
+	a := &ConfigAction{Fields: map[string]string{"SeekTime": "20ms", "ReadBytesPerSecond": "1MiB"}}
+	if got, want := a.String(), "set ReadBytesPerSecond=1MiB SeekTime=20ms"; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time requests are scheduled against. Schedulers use real time unless given a
+// VirtualClock.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// VirtualClock is simulated time, which stands still until operations advance it to when they're
+// modeled to complete, so that simulations run as fast as requests can be costed rather than in
+// real time. It is safe for concurrent use.
+type VirtualClock struct {
+	mu         sync.Mutex
+	start, now time.Time
+	// Background work waiting for the clock to reach a time, each closed once it does.
+	waiters []clockWaiter
+}
+
+type clockWaiter struct {
+	at   time.Time
+	done chan struct{}
+}
+
+// NewVirtualClock creates a VirtualClock starting at start.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{start: start, now: start}
+}
+
+// Now returns the current simulated time.
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AdvanceTo moves the clock forward to t, if it is later than the current simulated time. The clock
+// never goes backwards.
+func (c *VirtualClock) AdvanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !t.After(c.now) {
+		return
+	}
+	c.now = t
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(t) {
+			waiting = append(waiting, w)
+		} else {
+			close(w.done)
+		}
+	}
+	c.waiters = waiting
+}
+
+// Until returns a channel which is closed once operations advance the clock to t, for background
+// work which happens alongside them rather than making them wait.
+func (c *VirtualClock) Until(t time.Time) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	done := make(chan struct{})
+	if t.After(c.now) {
+		c.waiters = append(c.waiters, clockWaiter{at: t, done: done})
+	} else {
+		close(done)
+	}
+	return done
+}
+
+// Elapsed returns how much simulated time has passed since the clock started.
+func (c *VirtualClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now.Sub(c.start)
+}
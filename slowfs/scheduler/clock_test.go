@@ -0,0 +1,61 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClock(t *testing.T) {
+	c := NewVirtualClock(startTime)
+	if got, want := c.Now(), startTime; !got.Equal(want) {
+		t.Errorf("Now() = %s, want %s", got, want)
+	}
+
+	c.AdvanceTo(startTime.Add(time.Second))
+	// The clock never goes backwards.
+	c.AdvanceTo(startTime.Add(time.Millisecond))
+	if got, want := c.Now(), startTime.Add(time.Second); !got.Equal(want) {
+		t.Errorf("Now() after advancing = %s, want %s", got, want)
+	}
+	if got, want := c.Elapsed(), time.Second; got != want {
+		t.Errorf("Elapsed() = %s, want %s", got, want)
+	}
+}
+
+func TestVirtualClock_Until(t *testing.T) {
+	c := NewVirtualClock(startTime)
+	past, future := c.Until(startTime), c.Until(startTime.Add(time.Second))
+
+	select {
+	case <-past:
+	default:
+		t.Errorf("Until(now) not done, want done")
+	}
+	// Waiting doesn't move the clock; only advancing it past the time does.
+	c.AdvanceTo(startTime.Add(time.Millisecond))
+	select {
+	case <-future:
+		t.Errorf("Until(1s) done at 1ms, want not done")
+	default:
+	}
+	c.AdvanceTo(startTime.Add(2 * time.Second))
+	select {
+	case <-future:
+	default:
+		t.Errorf("Until(1s) not done at 2s, want done")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// Cost is a breakdown of how long a request was scheduled to take.
+type Cost struct {
+	// Queue is how long the request waited for a slot in the device's queue, with QueueDepth
+	// requests already outstanding.
+	Queue time.Duration
+
+	// Wait is how long the request waited for the device to finish earlier requests, and for fsyncs
+	// in a group commit, for the rest of the group.
+	Wait time.Duration
+
+	// Lock is how long the request waited for other requests to release its directory's lock.
+	Lock time.Duration
+
+	// Seek is how long was spent seeking.
+	Seek time.Duration
+
+	// Transfer is how long was spent moving data at the device's throughput.
+	Transfer time.Duration
+
+	// Repair is how long was spent retrying reads of marginal media.
+	Repair time.Duration
+
+	// Verify is how long was spent reading back written data to verify it, with VerifyWrites.
+	Verify time.Duration
+
+	// Alignment is how long was spent on the partial sectors of a read or write not aligned to
+	// AlignmentBytes.
+	Alignment time.Duration
+
+	// Fixed is time that doesn't depend on the device's state or the request's size, such as
+	// MetadataOpTime and BaseLatency.
+	Fixed time.Duration
+
+	// Upload is how long the request waited, after the device was done with it, for its file's data
+	// to be uploaded by a cloud gateway.
+	Upload time.Duration
+
+	// Network is how long the request spent crossing the network to a remote device, including
+	// waiting for other requests' data to finish using the network.
+	Network time.Duration
+}
+
+// Total returns how long the request takes in total.
+func (c Cost) Total() time.Duration {
+	return units.DurationAdd(c.busyTime(), c.Upload, c.Network)
+}
+
+// Breakdown formats the total and each part of the cost in nanoseconds, one "name value" pair per
+// line, like the stats file.
+func (c Cost) Breakdown() string {
+	return fmt.Sprintf("total_ns %d\nqueue_ns %d\nwait_ns %d\nlock_ns %d\nseek_ns %d\ntransfer_ns %d\nrepair_ns %d\nverify_ns %d\nalignment_ns %d\nfixed_ns %d\nupload_ns %d\nnetwork_ns %d\n",
+		c.Total(), c.Queue, c.Wait, c.Lock, c.Seek, c.Transfer, c.Repair, c.Verify, c.Alignment, c.Fixed, c.Upload, c.Network)
+}
+
+// busyTime returns how long until the device is done with the request, which is all of it except
+// waiting for uploads and the network.
+func (c Cost) busyTime() time.Duration {
+	return units.DurationAdd(c.Queue, c.Wait, c.Lock, c.Seek, c.Transfer, c.Repair, c.Verify, c.Alignment, c.Fixed)
+}
+
+// ScheduledRequest describes a request that the scheduler has finished computing the cost of.
+type ScheduledRequest struct {
+	Request *Request
+	Cost    Cost
+
+	// Queue is how many other requests were outstanding when the request was scheduled.
+	Queue QueueStats
+}
+
+// ScheduleHook is a callback invoked for every request once its cost is computed. That is before
+// the caller has waited for the request, and before the operation it is for has succeeded or
+// failed; fuselayer's OpHook is called once operations complete. Hooks are called from the
+// goroutine that called Schedule, so they may block that request but not the scheduler.
+type ScheduleHook func(*ScheduledRequest)
+
+// AddScheduleHook registers a hook to be invoked as each request is scheduled. This is intended
+// for programs embedding slowfs which want to inspect costs inline rather than parsing logs.
+func (s *Scheduler) AddScheduleHook(hook ScheduleHook) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+func (s *Scheduler) runScheduleHooks(scheduled *ScheduledRequest) {
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+	for _, hook := range s.hooks {
+		hook(scheduled)
+	}
+}
@@ -15,10 +15,14 @@
 package scheduler
 
 import (
+	"hash/fnv"
 	"log"
+	"math/rand"
 	"os"
+	"path"
 	"slowfs/slowfs"
 	"slowfs/slowfs/units"
+	"sort"
 	"time"
 )
 
@@ -31,6 +35,75 @@ type deviceContext struct {
 	// Describes the physical media.
 	deviceConfig *slowfs.DeviceConfig
 
+	// The device's actuators, which seek and transfer independently. Most devices have one.
+	actuators []actuator
+
+	logger *log.Logger
+
+	// Makes the device's random choices, like which reads need repairing.
+	random *rand.Rand
+
+	// Holds information about data not yet written back to disk.
+	writeBackCache *writeBackCache
+
+	// Holds information about data not yet uploaded, if the device is a cloud gateway.
+	uplink *uplink
+
+	// When the network to a remote device finishes sending the data it has been given.
+	networkBusyUntil time.Time
+
+	// With FsyncGroupWindow, when the current group commit stops accepting fsyncs, and when the
+	// fsyncs in it so far complete.
+	fsyncGroupCloses time.Time
+	fsyncGroupDone   time.Time
+
+	// Holds information about data cached in memory, which can be read without using the device.
+	readCache *readCache
+
+	// With ReadAheadBytes, where the last read of each file ended, and which of its data has been
+	// prefetched.
+	readAheads map[string]*readAhead
+
+	// With JournaledMetadata, the paths whose attribute changes haven't been committed to the
+	// journal yet, and when the journal will next be committed.
+	uncommittedMetadata map[string]bool
+	nextMetadataCommit  time.Time
+
+	// With DirectoryLockTime, when each recently locked directory's lock is released.
+	directoryLocks map[string]time.Time
+
+	// With ReclaimBytesPerSecond, how many bytes freed by unlinking files still weren't free at
+	// reclaimedAt.
+	unreclaimed units.NumBytes
+	reclaimedAt time.Time
+	// With DeletedRetention, space freed by unlinking files which isn't being reclaimed yet, in the
+	// order its retention ends.
+	retained []retainedSpace
+
+	// When each request the device has been given completes, in order, so that QueueDepth can be
+	// enforced. Requests are forgotten once they have completed.
+	outstanding []time.Time
+
+	// Offered the device's spare time, in order, once the write back cache has used what it needs.
+	spareTimeConsumers []SpareTimeConsumer
+}
+
+// readAhead is the read-ahead state of a file: where the last read of it ended, so that the next
+// read is sequential if it starts there, and the range of it the last sequential read prefetched.
+type readAhead struct {
+	next       units.NumBytes
+	start, end units.NumBytes
+}
+
+// retainedSpace is space freed by unlinking a file which the device starts reclaiming at a later
+// time.
+type retainedSpace struct {
+	size  units.NumBytes
+	until time.Time
+}
+
+// actuator is the state of one set of heads.
+type actuator struct {
 	// For the last accessed file, record the offset of the first byte we have not accessed.
 	// This is used to determine if reads are sequential or not.
 	firstUnseenByte units.NumBytes
@@ -38,120 +111,838 @@ type deviceContext struct {
 	// Accesses to different files are assumed to be non-sequential reads.
 	lastAccessedFile string
 
-	// The device can only execute one request at a time, so record when it is busy until.
+	// An actuator can only execute one request at a time, so record when it is busy until.
 	busyUntil time.Time
 
-	logger *log.Logger
+	// With IO priorities, requests jump ahead of lower priority ones which haven't started, so
+	// record when the actuator finishes the work of at least normal and at least high priority it
+	// has been given, and when it serves each request of lower than high priority not yet finished.
+	normalBusyUntil time.Time
+	highBusyUntil   time.Time
+	spans           []span
+}
 
-	// Holds information about data not yet written back to disk.
-	writeBackCache *writeBackCache
+// span is when an actuator serves a request.
+type span struct {
+	priority   Priority
+	start, end time.Time
+}
+
+// readyFor returns when the actuator can start a request of priority p which is ready for it at t:
+// once it has finished the work of priority p or higher it has been given, and any request it is
+// serving then, since requests aren't preempted.
+func (a *actuator) readyFor(p Priority, t time.Time) time.Time {
+	if !a.hasLowerPriorityWork(p, t) {
+		return latestTime(a.busyUntil, t)
+	}
+	ready := latestTime(a.busyUntilFor(p), t)
+	for _, s := range a.spans {
+		if s.priority < p && s.start.Before(ready) && s.end.After(ready) {
+			return s.end
+		}
+	}
+	return ready
+}
+
+// hasLowerPriorityWork returns whether the actuator has work of lower priority than p unfinished
+// at t.
+func (a *actuator) hasLowerPriorityWork(p Priority, t time.Time) bool {
+	for _, s := range a.spans {
+		if s.priority < p && s.end.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// busyUntilFor returns when the actuator finishes the work of priority p or higher it has been
+// given.
+func (a *actuator) busyUntilFor(p Priority) time.Time {
+	switch {
+	case p >= HighPriority:
+		return a.highBusyUntil
+	case p == NormalPriority:
+		return a.normalBusyUntil
+	default:
+		return a.busyUntil
+	}
+}
+
+// serve records that the actuator serves a request of priority p from start to end, pushing back
+// the lower priority work it has been given which hasn't started by then.
+func (a *actuator) serve(p Priority, start, end time.Time) {
+	d := end.Sub(start)
+	for i := range a.spans {
+		if s := &a.spans[i]; s.priority < p && !s.start.Before(start) {
+			s.start, s.end = s.start.Add(d), s.end.Add(d)
+		}
+	}
+	if p < HighPriority {
+		a.spans = append(a.spans, span{p, start, end})
+	}
+
+	switch {
+	case p >= HighPriority:
+		a.highBusyUntil = latestTime(a.highBusyUntil, end)
+		a.normalBusyUntil = delayedBy(a.normalBusyUntil, start, end)
+		a.busyUntil = delayedBy(a.busyUntil, start, end)
+	case p == NormalPriority:
+		a.normalBusyUntil = latestTime(a.normalBusyUntil, end)
+		a.busyUntil = delayedBy(a.busyUntil, start, end)
+	default:
+		a.busyUntil = latestTime(a.busyUntil, end)
+	}
+}
+
+// delayedBy returns when work due to finish at busyUntil finishes once a request served from
+// start to end has jumped ahead of it, if it hadn't started by then.
+func delayedBy(busyUntil, start, end time.Time) time.Time {
+	if busyUntil.After(start) {
+		return latestTime(busyUntil.Add(end.Sub(start)), end)
+	}
+	return end
+}
+
+// forgetSpans forgets the requests the actuator finished by t.
+func (a *actuator) forgetSpans(t time.Time) {
+	spans := a.spans[:0]
+	for _, s := range a.spans {
+		if s.end.After(t) {
+			spans = append(spans, s)
+		}
+	}
+	a.spans = spans
+}
+
+// stall makes the actuator busy for d from now, or from when it finishes its current work if
+// later, whatever the priority of the requests waiting.
+func (a *actuator) stall(now time.Time, d time.Duration) {
+	a.busyUntil = latestTime(a.busyUntil, now).Add(d)
+	a.normalBusyUntil = latestTime(a.normalBusyUntil, now).Add(d)
+	a.highBusyUntil = latestTime(a.highBusyUntil, now).Add(d)
+}
+
+// forget forgets where the heads last were, so that the next access has to seek.
+func (a *actuator) forget() {
+	a.lastAccessedFile = ""
+	a.firstUnseenByte = 0
+}
+
+func numActuators(config *slowfs.DeviceConfig) int {
+	if config.Actuators > 1 {
+		return config.Actuators
+	}
+	return 1
 }
 
 // NewDeviceContext creates a new context given a DeviceConfig. DeviceContext will use that
 // configuration to compute how long requests take.
 func newDeviceContext(config *slowfs.DeviceConfig) *deviceContext {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
 	var writeBackCache *writeBackCache
 	if config.FsyncStrategy == slowfs.WriteBackCachedFsync {
-		writeBackCache = newWriteBackCache(config)
+		writeBackCache = newWriteBackCache(config, random)
+	}
+	var uplink *uplink
+	if config.UploadBytesPerSecond > 0 {
+		uplink = newUplink(config)
 	}
 	return &deviceContext{
-		deviceConfig:   config,
-		logger:         log.New(os.Stderr, "DeviceContext: ", log.Ldate|log.Ltime|log.Lshortfile),
-		writeBackCache: writeBackCache,
+		deviceConfig:        config,
+		actuators:           make([]actuator, numActuators(config)),
+		logger:              log.New(os.Stderr, "DeviceContext: ", log.Ldate|log.Ltime|log.Lshortfile),
+		random:              random,
+		writeBackCache:      writeBackCache,
+		uplink:              uplink,
+		readCache:           newReadCache(),
+		readAheads:          make(map[string]*readAhead),
+		uncommittedMetadata: make(map[string]bool),
+		directoryLocks:      make(map[string]time.Time),
 	}
 }
 
 // ComputeTime computes how long a request should take given the current state of the device.
 // It does not update the context.
 func (dc *deviceContext) computeTime(req *Request) time.Duration {
-	requestDuration := time.Duration(0)
+	return dc.computeCost(req).Total()
+}
+
+// ComputeCost computes the breakdown of how long a request should take given the current state of
+// the device. It does not update the context.
+func (dc *deviceContext) computeCost(req *Request) Cost {
+	var cost Cost
+
+	// Free no-ops never reach the device.
+	if dc.noOpStrategy(req) == slowfs.FreeNoOps {
+		return cost
+	}
+
+	// With a full queue, the device doesn't see the request until an earlier one completes.
+	if dc.usesQueue(req) {
+		cost.Queue = dc.queueSlotFree(req.Timestamp).Sub(req.Timestamp)
+	}
+	queued := req.Timestamp.Add(cost.Queue)
 
 	switch req.Type {
 	// Handle metadata requests, plus metadata requests that have been factored out because we
 	// need separate handling for them.
 	case MetadataRequest, CloseRequest:
-		requestDuration = dc.deviceConfig.MetadataOpTime
-	case AllocateRequest:
-		requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.AllocateTime(req.Size)
+		cost.Fixed = dc.metadataOpTime(req)
+		dc.addDirectoryScan(&cost, req, (req.Entries+1)/2)
+	case DirEntryRequest:
+		cost.Lock = latestTime(dc.directoryLocks[path.Dir(req.Path)], queued).Sub(queued)
+		cost.Fixed = dc.metadataOpTime(req)
+		cost.Transfer = dc.deviceConfig.FreeTime(req.Size)
+		dc.addDirectoryScan(&cost, req, (req.Entries+1)/2)
+	case ReaddirRequest:
+		cost.Fixed = dc.metadataOpTime(req)
+		cost.Transfer = dc.deviceConfig.MetadataTime(req.Size)
+		dc.addDirectoryScan(&cost, req, req.Entries)
+	case SetAttrRequest:
+		switch dc.deviceConfig.MetadataStrategy {
+		case slowfs.SyncMetadata:
+			cost.Fixed = dc.metadataOpTime(req)
+		case slowfs.JournaledMetadata:
+			// Leave at 0 seconds until the journal is committed.
+		}
+	case TruncateRequest:
+		cost.Fixed = dc.metadataOpTime(req)
+		cost.Transfer = dc.deviceConfig.FreeTime(req.Size)
+	case ExtendRequest:
+		cost.Fixed = dc.metadataOpTime(req)
+		cost.Transfer = dc.deviceConfig.ZeroFillTime(req.Size)
+	case FlushRequest:
+		if dc.deviceConfig.FlushOnClose && dc.writeBackCache != nil {
+			if unwritten := dc.writeBackCache.getUnwrittenBytes(req.Path); unwritten > 0 {
+				cost.Seek = dc.seekTime(req)
+				cost.Transfer = dc.deviceConfig.WriteTime(unwritten)
+				cost.Verify = dc.deviceConfig.VerifyTime(unwritten)
+			}
+		}
+	case PunchHoleRequest:
+		// Punching a hole only changes the file's extents, like truncating it.
+		cost.Fixed = dc.metadataOpTime(req)
+		cost.Transfer = dc.deviceConfig.FreeTime(req.Size)
+	case AllocateRequest, ZeroRangeRequest:
+		// Zeroed ranges are allocated as unwritten extents, which read back as zeroes.
+		cost.Seek = dc.computeSeekTime(req)
+		cost.Transfer = dc.deviceConfig.AllocateTime(req.Size)
 	case ReadRequest:
-		requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.ReadTime(req.Size)
+		if dc.cached(req) {
+			// Cached reads don't touch the device.
+			cost.Fixed = dc.deviceConfig.ReadCacheHitTime
+			break
+		}
+		// Sequential reads fetch the data read ahead of them too.
+		size := req.Size
+		if dc.readsAhead(req) {
+			size = units.NumBytesAdd(size, dc.deviceConfig.ReadAheadBytes)
+		}
+		cost.Seek = dc.computeSeekTime(req)
+		cost.Transfer = dc.deviceConfig.ReadTime(size)
+		if dc.isRandom(req) {
+			cost.Transfer = dc.deviceConfig.RandomReadTime(size)
+		}
+		cost.Alignment = dc.deviceConfig.MisalignmentTime(req.Start, req.Size)
+		if req.needsRepair {
+			cost.Repair = units.DurationMul(dc.seekTime(req), int64(dc.deviceConfig.ReadRepairSeeks))
+		}
 	case WriteRequest:
-		switch dc.deviceConfig.WriteStrategy {
-		case slowfs.FastWrite:
-			// Leave at 0 seconds.
-		case slowfs.SimulateWrite:
-			requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.WriteTime(req.Size)
-		}
-	case FsyncRequest:
-		switch dc.deviceConfig.FsyncStrategy {
+		// Fast writes take 0 seconds, unless they're direct.
+		if dc.writesToDevice(req) {
+			cost.Seek = dc.computeSeekTime(req)
+			cost.Transfer = dc.deviceConfig.WriteTime(req.Size)
+			if dc.isRandom(req) {
+				cost.Transfer = dc.deviceConfig.RandomWriteTime(req.Size)
+			}
+			cost.Verify = dc.deviceConfig.VerifyTime(req.Size)
+			cost.Alignment = dc.deviceConfig.MisalignmentTime(req.Start, req.Size)
+		}
+	case FsyncRequest, FdatasyncRequest:
+		// Fsyncs joining a group commit share its flush.
+		joins := dc.joinsFsyncGroup(req)
+		switch dc.syncStrategy(req) {
 		case slowfs.DumbFsync:
-			requestDuration = dc.deviceConfig.SeekTime * 10
+			if !joins {
+				cost.Seek = units.DurationMul(dc.seekTime(req), 10)
+			}
 		case slowfs.WriteBackCachedFsync:
-			requestDuration = dc.deviceConfig.SeekTime + dc.deviceConfig.WriteTime(dc.writeBackCache.getUnwrittenBytes(req.Path))
+			if !joins {
+				cost.Seek = dc.seekTime(req)
+			}
+			unwritten := dc.writeBackCache.getUnwrittenBytes(req.Path)
+			if dc.deviceConfig.FsyncFlushesAllData {
+				unwritten = dc.writeBackCache.totalUnwrittenBytes()
+			}
+			cost.Transfer = dc.deviceConfig.WriteTime(unwritten)
+			cost.Verify = dc.deviceConfig.VerifyTime(unwritten)
+		}
+		// Making the file's attributes durable means committing the journal first, which with
+		// JournalCommitTime every fsync does. Fdatasyncs leave the attributes for later.
+		if req.Type == FdatasyncRequest {
+			break
+		}
+		if dc.commitsJournal(req) {
+			if !joins {
+				cost.Fixed = dc.deviceConfig.JournalCommitTime
+			}
+		} else if dc.metadataUncommitted(req.Path, req.Timestamp) {
+			cost.Fixed = dc.metadataOpTime(req)
+		}
+	case JournalCommitRequest:
+		// The file's data was flushed on its own device, so only the journal is left.
+		if dc.commitsJournal(req) {
+			cost.Fixed = dc.deviceConfig.JournalCommitTime
+		} else if dc.metadataUncommitted(req.Path, req.Timestamp) {
+			cost.Fixed = dc.metadataOpTime(req)
 		}
 	default:
 		dc.logger.Printf("unknown request type for %+v\n", req)
 	}
+	// No-ops charged as metadata only update timestamps, whatever their type.
+	if dc.noOpStrategy(req) == slowfs.MetadataNoOps {
+		cost = Cost{Queue: cost.Queue, Fixed: dc.metadataOpTime(req)}
+	}
+	// Every request pays its base latency on top.
+	if req.latencies != nil {
+		cost.Fixed = units.DurationAdd(cost.Fixed, req.latencies.base)
+	}
+
+	// Reads served from memory never reach the device, so don't wait for it or the network.
+	if dc.servedFromMemory(req) {
+		return cost
+	}
 
-	return latestTime(dc.busyUntil, req.Timestamp).Add(requestDuration).Sub(req.Timestamp)
+	// The device can only run one request at a time, so wait for it to be free first, once any lock
+	// has been taken.
+	locked := queued.Add(cost.Lock)
+	ready := dc.actuatorFor(req.Path).readyFor(req.Priority, locked)
+	cost.Wait = latestTime(ready, dc.fsyncGroupReady(req)).Sub(locked)
+
+	// A remote device's requests cross the network too. Data takes turns on it, but the latency of
+	// each request overlaps with the others'.
+	cost.Network = units.DurationAdd(dc.deviceConfig.NetworkLatency,
+		latestTime(dc.networkBusyUntil, queued).Sub(queued),
+		dc.deviceConfig.NetworkTime(networkBytes(req)))
+
+	// Then, on a cloud gateway, the request may wait for the file's data to be uploaded too.
+	if dc.waitsForUpload(req) {
+		done := req.Timestamp.Add(cost.Total())
+		cost.Upload = latestTime(dc.uplink.uploadedBy(req.Path), done).Sub(done)
+	}
+	return cost
 }
 
 // Execute executes a given request, applying changes to the device context.
 func (dc *deviceContext) execute(req *Request) {
-	spareTime := req.Timestamp.Sub(dc.busyUntil)
+	if dc.noOpStrategy(req) == slowfs.FreeNoOps {
+		return
+	}
+	a := dc.actuatorFor(req.Path)
+	spareTime := req.Timestamp.Sub(a.busyUntil)
 
-	// Devote spare time to writing back cache.
+	// Devote spare time to writing back cache, and offer what's left to anything else which wants
+	// it. The device hasn't started until its first request.
 	if spareTime > 0 && dc.writeBackCache != nil {
-		dc.writeBackCache.writeBack(spareTime)
+		spareTime = dc.writeBackCache.writeBack(spareTime)
+	}
+	if spareTime > 0 && !a.busyUntil.IsZero() {
+		dc.offerSpareTime(SpareTime{Start: req.Timestamp.Add(-spareTime), End: req.Timestamp})
+	}
+
+	// Journal commits happen in the background, like writing back cache.
+	if !dc.nextMetadataCommit.IsZero() && !req.Timestamp.Before(dc.nextMetadataCommit) {
+		dc.commitMetadata()
 	}
 
-	dc.busyUntil = req.Timestamp.Add(dc.computeTime(req))
+	// The device is free while the request waits for uploads and the network.
+	cost := dc.computeCost(req)
+	done := req.Timestamp.Add(cost.busyTime())
+	a.forgetSpans(req.Timestamp)
+	if !dc.servedFromMemory(req) {
+		a.serve(req.Priority, req.Timestamp.Add(units.DurationAdd(cost.Queue, cost.Lock, cost.Wait)), done)
+		if d := dc.deviceConfig.NetworkTime(networkBytes(req)); d > 0 {
+			dc.networkBusyUntil = latestTime(dc.networkBusyUntil, req.Timestamp.Add(cost.Queue)).Add(d)
+		}
+	}
+	dc.completeQueued(req.Timestamp)
+	if dc.usesQueue(req) {
+		dc.enqueue(req.Timestamp.Add(cost.Total()))
+	}
+	if dc.noOpStrategy(req) == slowfs.MetadataNoOps {
+		return
+	}
 
 	switch req.Type {
-	case MetadataRequest, AllocateRequest:
+	case MetadataRequest, ReaddirRequest, AllocateRequest, ExtendRequest, ZeroRangeRequest:
 		// Do nothing.
+	case TruncateRequest:
+		// Data which is removed is no longer cached or read ahead.
+		dc.readCache.evict(req.Path, req.Start, units.MaxNumBytes-req.Start)
+		delete(dc.readAheads, req.Path)
+	case PunchHoleRequest:
+		dc.readCache.evict(req.Path, req.Start, req.Size)
+		delete(dc.readAheads, req.Path)
+	case DirEntryRequest:
+		dc.readCache.evict(req.Path, 0, units.MaxNumBytes)
+		delete(dc.readAheads, req.Path)
+		if dc.deviceConfig.DirectoryLockTime > 0 {
+			dc.lockDirectory(path.Dir(req.Path), req.Timestamp)
+		}
+		if req.Size > 0 && (dc.deviceConfig.ReclaimBytesPerSecond > 0 || dc.deviceConfig.DeletedRetention > 0) {
+			// Reclaiming starts once the unlink completes and the retention period has passed.
+			dc.retain(req.Size, done.Add(dc.deviceConfig.DeletedRetention))
+		}
+	case SetAttrRequest:
+		if dc.deviceConfig.MetadataStrategy == slowfs.JournaledMetadata {
+			if len(dc.uncommittedMetadata) == 0 {
+				dc.nextMetadataCommit = req.Timestamp.Add(dc.deviceConfig.MetadataCommitInterval)
+			}
+			dc.uncommittedMetadata[req.Path] = true
+		}
 	case CloseRequest:
 		if dc.writeBackCache != nil {
 			dc.writeBackCache.close(req.Path)
 		}
-		if dc.lastAccessedFile == req.Path {
-			dc.lastAccessedFile = ""
-			dc.firstUnseenByte = 0
+		if a.lastAccessedFile == req.Path {
+			a.forget()
 		}
 	case ReadRequest:
-		dc.lastAccessedFile = req.Path
-		dc.firstUnseenByte = req.Start + req.Size
+		if dc.deviceConfig.ReadCacheEviction == slowfs.LRUEviction {
+			dc.readCache.use(req.Path, req.Start, req.Size)
+		}
+		readsAhead := dc.readsAhead(req)
+		if dc.deviceConfig.ReadAheadBytes > 0 {
+			dc.readAheadFor(req.Path).next = units.NumBytesAdd(req.Start, req.Size)
+		}
+		if dc.cached(req) {
+			break
+		}
+		a.lastAccessedFile = req.Path
+		a.firstUnseenByte = units.NumBytesAdd(req.Start, req.Size)
+		if readsAhead {
+			ra := dc.readAheadFor(req.Path)
+			ra.start, ra.end = a.firstUnseenByte, units.NumBytesAdd(a.firstUnseenByte, dc.deviceConfig.ReadAheadBytes)
+			a.firstUnseenByte = ra.end
+		}
+		if dc.deviceConfig.ReadCacheBytes > 0 {
+			dc.readCache.add(req.Path, req.Start, req.Size, dc.deviceConfig.ReadCacheBytes)
+		}
 	case WriteRequest:
-		switch dc.deviceConfig.WriteStrategy {
-		case slowfs.FastWrite:
-			// Fast writes don't affect things here.
-		case slowfs.SimulateWrite:
-			dc.lastAccessedFile = req.Path
-			dc.firstUnseenByte = req.Start + req.Size
+		if dc.writesToDevice(req) {
+			a.lastAccessedFile = req.Path
+			a.firstUnseenByte = units.NumBytesAdd(req.Start, req.Size)
 		}
 
-		if dc.writeBackCache != nil {
-			dc.writeBackCache.write(req.Path, req.Size)
+		// Direct writes are already on the device.
+		if dc.writeBackCache != nil && !req.Direct {
+			dc.writeBackCache.writeAt(req.Path, req.Start, req.Size)
 		}
-	case FsyncRequest:
-		if dc.writeBackCache != nil {
+		if dc.uplink != nil {
+			// Data is uploaded once it has been written locally.
+			dc.uplink.add(req.Path, req.Size, done)
+		}
+	case FlushRequest:
+		if dc.deviceConfig.FlushOnClose && dc.writeBackCache != nil {
 			dc.writeBackCache.writeBackFile(req.Path)
 		}
+	case FsyncRequest, FdatasyncRequest:
+		if dc.groupsFsyncs() && req.Type == FsyncRequest {
+			if !dc.joinsFsyncGroup(req) {
+				dc.fsyncGroupCloses = req.Timestamp.Add(dc.deviceConfig.FsyncGroupWindow)
+			}
+			dc.fsyncGroupDone = latestTime(dc.fsyncGroupDone, done)
+		}
+		// Only syncs modeled with the write back cache write it back, so the next sync pays for it.
+		if dc.writeBackCache != nil && dc.syncStrategy(req) == slowfs.WriteBackCachedFsync {
+			if dc.deviceConfig.FsyncFlushesAllData {
+				dc.writeBackCache.writeBackAll()
+			} else {
+				dc.writeBackCache.writeBackFile(req.Path)
+			}
+		}
+		if dc.commitsJournal(req) || (req.Type == FsyncRequest && dc.uncommittedMetadata[req.Path]) {
+			dc.commitMetadata()
+		}
+	case JournalCommitRequest:
+		if dc.commitsJournal(req) || dc.uncommittedMetadata[req.Path] {
+			dc.commitMetadata()
+		}
 	default:
 		dc.logger.Printf("unknown request type for %+v\n", req)
 	}
 }
 
+// commitsJournal returns whether req is an fsync, or the metadata part of one, which commits the
+// journal whatever has changed, because JournalCommitTime is set.
+func (dc *deviceContext) commitsJournal(req *Request) bool {
+	return (req.Type == FsyncRequest || req.Type == JournalCommitRequest) && dc.deviceConfig.JournalCommitTime > 0 && dc.deviceConfig.FsyncStrategy != slowfs.NoFsync
+}
+
+// writesToDevice returns whether a write is simulated on the device when it is made, rather than
+// taking no time.
+func (dc *deviceContext) writesToDevice(req *Request) bool {
+	return dc.deviceConfig.WriteStrategy == slowfs.SimulateWrite || req.Direct
+}
+
+// syncStrategy returns which strategy models an fsync or fdatasync request.
+func (dc *deviceContext) syncStrategy(req *Request) slowfs.FsyncStrategy {
+	if req.Type == FdatasyncRequest {
+		return dc.deviceConfig.EffectiveFdatasyncStrategy()
+	}
+	return dc.deviceConfig.FsyncStrategy
+}
+
+// groupsFsyncs returns whether fsyncs are grouped into group commits.
+func (dc *deviceContext) groupsFsyncs() bool {
+	return dc.deviceConfig.FsyncGroupWindow > 0 && dc.deviceConfig.FsyncStrategy != slowfs.NoFsync
+}
+
+// joinsFsyncGroup returns whether a request is an fsync joining the group commit in progress,
+// rather than starting a new one.
+func (dc *deviceContext) joinsFsyncGroup(req *Request) bool {
+	return req.Type == FsyncRequest && dc.groupsFsyncs() && req.Timestamp.Before(dc.fsyncGroupCloses)
+}
+
+// fsyncGroupReady returns when a request can start if it is an fsync in a group commit: a new
+// group's first fsync waits for the window to close, and the others wait for the group's flush,
+// adding their own data to it. It returns the zero time for other requests.
+func (dc *deviceContext) fsyncGroupReady(req *Request) time.Time {
+	switch {
+	case req.Type != FsyncRequest || !dc.groupsFsyncs():
+		return time.Time{}
+	case dc.joinsFsyncGroup(req):
+		return dc.fsyncGroupDone
+	default:
+		return req.Timestamp.Add(dc.deviceConfig.FsyncGroupWindow)
+	}
+}
+
+// networkBytes returns how many bytes of data a request sends over the network to a remote device,
+// either way.
+func networkBytes(req *Request) units.NumBytes {
+	switch req.Type {
+	case ReadRequest, WriteRequest, ReaddirRequest:
+		return req.Size
+	default:
+		return 0
+	}
+}
+
+// waitsForUpload returns whether a request waits for its file's data to be uploaded.
+func (dc *deviceContext) waitsForUpload(req *Request) bool {
+	if dc.uplink == nil {
+		return false
+	}
+	switch req.Type {
+	case FsyncRequest, FdatasyncRequest:
+		return dc.deviceConfig.FsyncWaitsForUpload
+	case FlushRequest:
+		return dc.deviceConfig.CloseWaitsForUpload
+	default:
+		return false
+	}
+}
+
+// cached returns whether a read can be served from memory, without touching the device.
+func (dc *deviceContext) cached(req *Request) bool {
+	if dc.readCache.contains(req.Path, req.Start, req.Size) || dc.prefetched(req) {
+		return true
+	}
+	return dc.deviceConfig.ReadWriteBackCache && dc.writeBackCache != nil &&
+		dc.writeBackCache.contains(req.Path, req.Start, req.Size)
+}
+
+// prefetched returns whether all of a read's data has been read ahead.
+func (dc *deviceContext) prefetched(req *Request) bool {
+	ra, ok := dc.readAheads[req.Path]
+	return ok && req.Start >= ra.start && units.NumBytesAdd(req.Start, req.Size) <= ra.end
+}
+
+// readsAhead returns whether a read is sequential, so that it prefetches the data after it, with
+// ReadAheadBytes, if it isn't served from memory.
+func (dc *deviceContext) readsAhead(req *Request) bool {
+	if dc.deviceConfig.ReadAheadBytes <= 0 || dc.cached(req) {
+		return false
+	}
+	ra, ok := dc.readAheads[req.Path]
+	return req.Start == 0 || ok && req.Start == ra.next
+}
+
+// readAheadFor returns the read-ahead state of the file at path, creating it if needed.
+func (dc *deviceContext) readAheadFor(path string) *readAhead {
+	ra, ok := dc.readAheads[path]
+	if !ok {
+		ra = &readAhead{}
+		dc.readAheads[path] = ra
+	}
+	return ra
+}
+
+// noOpStrategy returns how req is charged if it changes nothing, like a zero-length write or a
+// truncate which leaves a file's size alone, and DefaultNoOps otherwise.
+func (dc *deviceContext) noOpStrategy(req *Request) slowfs.NoOpStrategy {
+	switch req.Type {
+	case WriteRequest, AllocateRequest, TruncateRequest, ExtendRequest, PunchHoleRequest, ZeroRangeRequest:
+		if req.Size == 0 {
+			return dc.deviceConfig.NoOpStrategy
+		}
+	}
+	return slowfs.DefaultNoOps
+}
+
+// usesQueue returns whether a request takes a slot in the device's queue, which all requests do
+// except reads served from memory.
+func (dc *deviceContext) usesQueue(req *Request) bool {
+	return !dc.servedFromMemory(req)
+}
+
+// servedFromMemory returns whether a request is a read served from the read cache, data read ahead
+// or the write back cache, without touching the device.
+func (dc *deviceContext) servedFromMemory(req *Request) bool {
+	return req.Type == ReadRequest && dc.cached(req)
+}
+
+// queueSlotFree returns when a request arriving at t gets a slot in the device's queue, which is
+// once all but QueueDepth-1 of the requests outstanding then have completed.
+func (dc *deviceContext) queueSlotFree(t time.Time) time.Time {
+	depth := dc.deviceConfig.QueueDepth
+	outstanding := dc.outstandingAt(t)
+	if depth == 0 || len(outstanding) < depth {
+		return t
+	}
+	return outstanding[len(outstanding)-depth]
+}
+
+// outstandingAt returns when each request outstanding at t completes, in order.
+func (dc *deviceContext) outstandingAt(t time.Time) []time.Time {
+	i := sort.Search(len(dc.outstanding), func(i int) bool {
+		return dc.outstanding[i].After(t)
+	})
+	return dc.outstanding[i:]
+}
+
+// enqueue records that a request the device has been given completes at done.
+func (dc *deviceContext) enqueue(done time.Time) {
+	i := len(dc.outstanding)
+	for i > 0 && dc.outstanding[i-1].After(done) {
+		i--
+	}
+	dc.outstanding = append(dc.outstanding, time.Time{})
+	copy(dc.outstanding[i+1:], dc.outstanding[i:])
+	dc.outstanding[i] = done
+}
+
+// completeQueued forgets the requests which have completed by t.
+func (dc *deviceContext) completeQueued(t time.Time) {
+	dc.outstanding = append(dc.outstanding[:0], dc.outstandingAt(t)...)
+}
+
+// maxDirectoryLocks is how many directory locks are remembered before released ones are forgotten.
+const maxDirectoryLocks = 1024
+
+// lockDirectory takes the lock of directory dir for a request made at t, as soon as it is released
+// by earlier requests.
+func (dc *deviceContext) lockDirectory(dir string, t time.Time) {
+	if len(dc.directoryLocks) >= maxDirectoryLocks {
+		for d, released := range dc.directoryLocks {
+			if !released.After(t) {
+				delete(dc.directoryLocks, d)
+			}
+		}
+	}
+	dc.directoryLocks[dir] = latestTime(dc.directoryLocks[dir], t).Add(dc.deviceConfig.DirectoryLockTime)
+}
+
+// retain records that size bytes freed by unlinking a file start being reclaimed at until.
+func (dc *deviceContext) retain(size units.NumBytes, until time.Time) {
+	i := len(dc.retained)
+	for i > 0 && dc.retained[i-1].until.After(until) {
+		i--
+	}
+	dc.retained = append(dc.retained, retainedSpace{})
+	copy(dc.retained[i+1:], dc.retained[i:])
+	dc.retained[i] = retainedSpace{size: size, until: until}
+}
+
+// reclaim reclaims space freed by unlinking files in the background until time t.
+func (dc *deviceContext) reclaim(t time.Time) {
+	for len(dc.retained) > 0 && !dc.retained[0].until.After(t) {
+		r := dc.retained[0]
+		dc.retained = dc.retained[1:]
+		dc.drain(r.until)
+		dc.unreclaimed = units.NumBytesAdd(dc.unreclaimed, r.size)
+	}
+	dc.drain(t)
+}
+
+// drain reclaims space which is being reclaimed until time t.
+func (dc *deviceContext) drain(t time.Time) {
+	if t.Before(dc.reclaimedAt) {
+		return
+	}
+	if rate := dc.deviceConfig.ReclaimBytesPerSecond; rate > 0 {
+		reclaimed := units.NumBytesFromFloat(float64(rate) * t.Sub(dc.reclaimedAt).Seconds())
+		dc.unreclaimed -= units.NumBytesMin(reclaimed, dc.unreclaimed)
+	} else {
+		dc.unreclaimed = 0
+	}
+	dc.reclaimedAt = t
+}
+
+// unreclaimedBytes returns how many bytes freed by unlinking files still aren't free at time t.
+func (dc *deviceContext) unreclaimedBytes(t time.Time) units.NumBytes {
+	dc.reclaim(t)
+	unreclaimed := dc.unreclaimed
+	for _, r := range dc.retained {
+		unreclaimed = units.NumBytesAdd(unreclaimed, r.size)
+	}
+	return unreclaimed
+}
+
+// metadataUncommitted returns whether attribute changes to path are still uncommitted at time t,
+// meaning they would be lost by a crash.
+func (dc *deviceContext) metadataUncommitted(path string, t time.Time) bool {
+	return dc.uncommittedMetadata[path] && t.Before(dc.nextMetadataCommit)
+}
+
+// commitMetadata commits the journal, making all attribute changes durable. Like on a real
+// journaling filesystem, this commits every file's changes at once.
+func (dc *deviceContext) commitMetadata() {
+	dc.uncommittedMetadata = make(map[string]bool)
+	dc.nextMetadataCommit = time.Time{}
+}
+
+// setConfig switches to simulating a different device config from now on. Cached writes are kept
+// if the new config still caches writes, and forgotten otherwise, and likewise for data waiting to
+// be uploaded. If the number of actuators changes, files may move between them, as if the device
+// had been reformatted.
+func (dc *deviceContext) setConfig(config *slowfs.DeviceConfig, now time.Time) {
+	dc.deviceConfig = config
+	if n := numActuators(config); n != len(dc.actuators) {
+		actuators := make([]actuator, n)
+		copy(actuators, dc.actuators)
+		dc.actuators = actuators
+	}
+	dc.readCache.shrink(config.ReadCacheBytes)
+	switch {
+	case config.FsyncStrategy != slowfs.WriteBackCachedFsync:
+		dc.writeBackCache = nil
+	case dc.writeBackCache == nil:
+		dc.writeBackCache = newWriteBackCache(config, dc.random)
+	default:
+		dc.writeBackCache.deviceConfig = config
+	}
+	switch {
+	case config.UploadBytesPerSecond == 0:
+		dc.uplink = nil
+	case dc.uplink == nil:
+		dc.uplink = newUplink(config)
+	default:
+		// Bring the backlog up to date at the old rate first.
+		dc.uplink.upload(now)
+		dc.uplink.deviceConfig = config
+	}
+}
+
+// stall makes every actuator busy for d from now, or from when it finishes its current work if
+// later.
+func (dc *deviceContext) stall(now time.Time, d time.Duration) {
+	for i := range dc.actuators {
+		dc.actuators[i].stall(now, d)
+	}
+}
+
+// dropCaches forgets the device's clean cached state, meaning the read cache and where the head
+// last was, so that the next access has to seek.
+func (dc *deviceContext) dropCaches() {
+	dc.readCache.drop()
+	dc.readAheads = make(map[string]*readAhead)
+	for i := range dc.actuators {
+		dc.actuators[i].forget()
+	}
+}
+
+// actuatorFor returns the actuator which serves the file at path. Files are spread between
+// actuators by a hash of their path.
+func (dc *deviceContext) actuatorFor(path string) *actuator {
+	if len(dc.actuators) == 1 {
+		return &dc.actuators[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return &dc.actuators[h.Sum32()%uint32(len(dc.actuators))]
+}
+
+// rollReadRepair randomly decides whether a read hits marginal media and needs repairing.
+func (dc *deviceContext) rollReadRepair() bool {
+	p := dc.deviceConfig.ReadRepairProbability
+	return p > 0 && dc.random.Float64() < p
+}
+
+// rollLatencies draws a request's latencies from the device's distributions. It returns nil if the
+// device has none, in which case the request takes the device's constant latencies.
+func (dc *deviceContext) rollLatencies() *latencies {
+	config := dc.deviceConfig
+	if config.SeekTimeDistribution == nil && config.MetadataOpDistribution == nil && config.BaseLatency == nil {
+		return nil
+	}
+	l := &latencies{seek: config.SeekTime, metadataOp: config.MetadataOpTime}
+	if config.SeekTimeDistribution != nil {
+		l.seek = config.SeekTimeDistribution.Sample(dc.random)
+	}
+	if config.MetadataOpDistribution != nil {
+		l.metadataOp = config.MetadataOpDistribution.Sample(dc.random)
+	}
+	if config.BaseLatency != nil {
+		l.base = config.BaseLatency.Sample(dc.random)
+	}
+	return l
+}
+
+// seekTime returns how long a seek takes for the request.
+func (dc *deviceContext) seekTime(req *Request) time.Duration {
+	if req.latencies != nil {
+		return req.latencies.seek
+	}
+	return dc.deviceConfig.SeekTime
+}
+
+// addDirectoryScan charges cost for seeking to the request's directory and scanning the given
+// number of its entries, if the device has a DirectoryEntryTime.
+func (dc *deviceContext) addDirectoryScan(cost *Cost, req *Request, entries int64) {
+	if dc.deviceConfig.DirectoryEntryTime <= 0 || entries <= 0 {
+		return
+	}
+	cost.Seek = units.DurationAdd(cost.Seek, dc.seekTime(req))
+	cost.Transfer = units.DurationAdd(cost.Transfer, dc.deviceConfig.DirectoryScanTime(entries))
+}
+
+// metadataOpTime returns how long the request's metadata operation takes.
+func (dc *deviceContext) metadataOpTime(req *Request) time.Duration {
+	if req.latencies != nil {
+		return req.latencies.metadataOp
+	}
+	return dc.deviceConfig.MetadataOpTime
+}
+
 func (dc *deviceContext) computeSeekTime(req *Request) time.Duration {
+	if dc.isRandom(req) {
+		return dc.seekTime(req)
+	}
+	return time.Duration(0)
+}
+
+// isRandom returns whether the request accesses data away from where the heads are, so it has to
+// seek, rather than continuing sequentially.
+func (dc *deviceContext) isRandom(req *Request) bool {
 	// Seek if:
 	//   1. We're accessing a different file or an unseen one.
 	//   2. We're looking very far ahead compared to last access.
 	//   3. We're going backwards.
-	if dc.lastAccessedFile != req.Path || dc.firstUnseenByte > req.Start ||
-		req.Start-dc.firstUnseenByte >= dc.deviceConfig.SeekWindow {
-		return dc.deviceConfig.SeekTime
-	}
-	return time.Duration(0)
+	a := dc.actuatorFor(req.Path)
+	return a.lastAccessedFile != req.Path || a.firstUnseenByte > req.Start ||
+		req.Start-a.firstUnseenByte >= dc.deviceConfig.SeekWindow
 }
 
 func latestTime(a, b time.Time) time.Time {
@@ -15,7 +15,9 @@
 package scheduler
 
 import (
+	"fmt"
 	"slowfs/slowfs"
+	"slowfs/slowfs/units"
 	"testing"
 	"time"
 )
@@ -429,3 +431,1091 @@ func TestDeviceContext_ComputeTimeAndExecute(t *testing.T) {
 		}
 	}
 }
+
+func TestDeviceContext_ComputeCost(t *testing.T) {
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		requests     []*Request
+		want         Cost
+	}{
+		{
+			desc: "metadata",
+			requests: []*Request{
+				{
+					Type:      MetadataRequest,
+					Timestamp: startTime,
+				},
+			},
+			want: Cost{Fixed: 80 * time.Millisecond},
+		},
+		{
+			desc: "flat readdir",
+			requests: []*Request{
+				{
+					Type:      ReaddirRequest,
+					Timestamp: startTime,
+					Size:      500,
+				},
+			},
+			want: Cost{Fixed: 80 * time.Millisecond},
+		},
+		{
+			desc:         "readdir charged by size",
+			deviceConfig: metadataThroughputDeviceConfig,
+			requests: []*Request{
+				{
+					Type:      ReaddirRequest,
+					Timestamp: startTime,
+					Size:      500,
+				},
+			},
+			want: Cost{Fixed: 80 * time.Millisecond, Transfer: 500 * time.Millisecond},
+		},
+		{
+			desc: "flat truncate",
+			requests: []*Request{
+				{
+					Type:      TruncateRequest,
+					Timestamp: startTime,
+					Size:      500,
+				},
+			},
+			want: Cost{Fixed: 80 * time.Millisecond},
+		},
+		{
+			desc:         "truncate charged by bytes freed",
+			deviceConfig: resizeDeviceConfig,
+			requests: []*Request{
+				{
+					Type:      TruncateRequest,
+					Timestamp: startTime,
+					Size:      500,
+				},
+			},
+			want: Cost{Fixed: 80 * time.Millisecond, Transfer: 50 * time.Millisecond},
+		},
+		{
+			desc:         "extend charged by bytes zeroed",
+			deviceConfig: resizeDeviceConfig,
+			requests: []*Request{
+				{
+					Type:      ExtendRequest,
+					Timestamp: startTime,
+					Size:      500,
+				},
+			},
+			want: Cost{Fixed: 80 * time.Millisecond, Transfer: 5 * time.Second},
+		},
+		{
+			desc: "seeking read",
+			requests: []*Request{
+				{
+					Type:      ReadRequest,
+					Timestamp: startTime,
+					Path:      "a",
+					Start:     0,
+					Size:      100,
+				},
+			},
+			want: Cost{Seek: 10 * time.Millisecond, Transfer: time.Second},
+		},
+		{
+			desc:         "repaired read",
+			deviceConfig: readRepairDeviceConfig,
+			requests: []*Request{
+				{
+					Type:        ReadRequest,
+					Timestamp:   startTime,
+					Path:        "a",
+					Start:       0,
+					Size:        100,
+					needsRepair: true,
+				},
+			},
+			want: Cost{Seek: 10 * time.Millisecond, Transfer: time.Second, Repair: 30 * time.Millisecond},
+		},
+		{
+			desc: "waiting on busy device",
+			requests: []*Request{
+				{
+					Type:      MetadataRequest,
+					Timestamp: startTime,
+				},
+				{
+					Type:      ReadRequest,
+					Timestamp: startTime.Add(30 * time.Millisecond),
+					Path:      "a",
+					Start:     0,
+					Size:      1,
+				},
+			},
+			want: Cost{Wait: 50 * time.Millisecond, Seek: 10 * time.Millisecond, Transfer: 10 * time.Millisecond},
+		},
+	}
+
+	for _, c := range cases {
+		deviceConfig := c.deviceConfig
+		if deviceConfig == nil {
+			deviceConfig = basicDeviceConfig
+		}
+		dc := newDeviceContext(deviceConfig)
+		for _, req := range c.requests[:len(c.requests)-1] {
+			dc.execute(req)
+		}
+		req := c.requests[len(c.requests)-1]
+		if got, want := dc.computeCost(req), c.want; got != want {
+			t.Errorf("fail (%s) computeCost(%+v) = %+v, want %+v", c.desc, req, got, want)
+		}
+	}
+}
+
+func TestDeviceContext_RollReadRepair(t *testing.T) {
+	cases := []struct {
+		deviceConfig *slowfs.DeviceConfig
+		want         bool
+	}{
+		{basicDeviceConfig, false},
+		{readRepairDeviceConfig, true},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		for i := 0; i < 10; i++ {
+			if got, want := dc.rollReadRepair(), c.want; got != want {
+				t.Errorf("rollReadRepair() with probability %g = %t, want %t", c.deviceConfig.ReadRepairProbability, got, want)
+			}
+		}
+	}
+}
+
+func TestDeviceContext_DropCaches(t *testing.T) {
+	dc := newDeviceContext(basicDeviceConfig)
+	dc.execute(&Request{
+		Type:      ReadRequest,
+		Timestamp: startTime,
+		Path:      "a",
+		Start:     0,
+		Size:      1,
+	})
+
+	req := &Request{
+		Type:      ReadRequest,
+		Timestamp: startTime.Add(time.Second),
+		Path:      "a",
+		Start:     1,
+		Size:      1,
+	}
+	if got, want := dc.computeCost(req).Seek, time.Duration(0); got != want {
+		t.Errorf("sequential read seek time before dropCaches = %s, want %s", got, want)
+	}
+
+	dc.dropCaches()
+	if got, want := dc.computeCost(req).Seek, 10*time.Millisecond; got != want {
+		t.Errorf("sequential read seek time after dropCaches = %s, want %s", got, want)
+	}
+}
+
+func TestDeviceContext_CachedRead(t *testing.T) {
+	dc := newDeviceContext(basicDeviceConfig)
+	dc.readCache.warm("a", 100)
+
+	cached := &Request{
+		Type:      ReadRequest,
+		Timestamp: startTime,
+		Path:      "a",
+		Start:     50,
+		Size:      50,
+	}
+	if got, want := dc.computeCost(cached), (Cost{}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", cached, got, want)
+	}
+	dc.execute(cached)
+
+	uncached := &Request{
+		Type:      ReadRequest,
+		Timestamp: startTime,
+		Path:      "a",
+		Start:     100,
+		Size:      1,
+	}
+	// The cached read shouldn't have moved the head, so this still seeks.
+	if got, want := dc.computeCost(uncached), (Cost{Seek: 10 * time.Millisecond, Transfer: 10 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", uncached, got, want)
+	}
+}
+
+func TestDeviceContext_ReadWriteBackCache(t *testing.T) {
+	uncachedCost := Cost{Seek: 10 * time.Millisecond, Transfer: 500 * time.Millisecond}
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		spareTime    time.Duration
+		read         *Request
+		want         Cost
+	}{
+		{"unwritten", readWriteBackCacheDeviceConfig, 0, &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 20, Size: 50}, Cost{}},
+		{"partly unwritten", readWriteBackCacheDeviceConfig, 0, &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 150, Size: 50}, uncachedCost},
+		{"other file", readWriteBackCacheDeviceConfig, 0, &Request{Type: ReadRequest, Timestamp: startTime, Path: "b", Start: 0, Size: 50}, uncachedCost},
+		// Both writes have been written back in spare time.
+		{"written back", readWriteBackCacheDeviceConfig, 2 * time.Second, &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 20, Size: 50}, uncachedCost},
+		{"option off", writeBackCacheDeviceConfig, 0, &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 20, Size: 50}, uncachedCost},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100})
+		dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 100, Size: 60})
+		dc.writeBackCache.writeBack(c.spareTime)
+		if got, want := dc.computeCost(c.read), c.want; got != want {
+			t.Errorf("fail (%s) computeCost(%+v) = %+v, want %+v", c.desc, c.read, got, want)
+		}
+	}
+}
+
+func TestDeviceContext_JournaledMetadata(t *testing.T) {
+	type step struct {
+		req             *Request
+		wantCost        Cost
+		wantUncommitted bool
+	}
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		steps        []step
+	}{
+		{
+			"sync metadata",
+			basicDeviceConfig,
+			[]step{
+				{&Request{Type: SetAttrRequest, Timestamp: startTime, Path: "a"}, Cost{Fixed: 80 * time.Millisecond}, false},
+				{&Request{Type: FsyncRequest, Timestamp: startTime.Add(time.Second), Path: "a"}, Cost{}, false},
+			},
+		},
+		{
+			"fsync commits the journal",
+			journaledMetadataDeviceConfig,
+			[]step{
+				{&Request{Type: SetAttrRequest, Timestamp: startTime, Path: "a"}, Cost{}, true},
+				{&Request{Type: SetAttrRequest, Timestamp: startTime, Path: "b"}, Cost{}, true},
+				{&Request{Type: FsyncRequest, Timestamp: startTime.Add(time.Second), Path: "c"}, Cost{}, false},
+				{&Request{Type: FsyncRequest, Timestamp: startTime.Add(time.Second), Path: "a"}, Cost{Fixed: 80 * time.Millisecond}, false},
+				// Committing the journal for a made b durable too.
+				{&Request{Type: FsyncRequest, Timestamp: startTime.Add(2 * time.Second), Path: "b"}, Cost{}, false},
+			},
+		},
+		{
+			"periodic commit",
+			journaledMetadataDeviceConfig,
+			[]step{
+				{&Request{Type: SetAttrRequest, Timestamp: startTime, Path: "a"}, Cost{}, true},
+				{&Request{Type: SetAttrRequest, Timestamp: startTime.Add(4 * time.Second), Path: "b"}, Cost{}, true},
+				{&Request{Type: FsyncRequest, Timestamp: startTime.Add(5 * time.Second), Path: "b"}, Cost{}, false},
+				{&Request{Type: SetAttrRequest, Timestamp: startTime.Add(6 * time.Second), Path: "a"}, Cost{}, true},
+				{&Request{Type: FsyncRequest, Timestamp: startTime.Add(10 * time.Second), Path: "a"}, Cost{Fixed: 80 * time.Millisecond}, false},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		for i, s := range c.steps {
+			if got, want := dc.computeCost(s.req), s.wantCost; got != want {
+				t.Errorf("fail (%s) step %d: computeCost(%+v) = %+v, want %+v", c.desc, i, s.req, got, want)
+			}
+			dc.execute(s.req)
+			if got, want := dc.metadataUncommitted(s.req.Path, s.req.Timestamp), s.wantUncommitted; got != want {
+				t.Errorf("fail (%s) step %d: metadataUncommitted(%s) = %t, want %t", c.desc, i, s.req.Path, got, want)
+			}
+		}
+	}
+}
+
+func TestDeviceContext_FlushOnClose(t *testing.T) {
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		wantFirst    Cost
+	}{
+		{"free close", writeBackCacheDeviceConfig, Cost{}},
+		{"flush on close", flushOnCloseDeviceConfig, Cost{Seek: 10 * time.Millisecond, Transfer: 500 * time.Millisecond}},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 50})
+
+		flush := &Request{Type: FlushRequest, Timestamp: startTime, Path: "a"}
+		if got, want := dc.computeCost(flush), c.wantFirst; got != want {
+			t.Errorf("fail (%s) first computeCost(%+v) = %+v, want %+v", c.desc, flush, got, want)
+		}
+		dc.execute(flush)
+
+		// Nothing is left to flush, whether or not the first flush wrote it.
+		flush = &Request{Type: FlushRequest, Timestamp: dc.actuatorFor("a").busyUntil, Path: "a"}
+		if got, want := dc.computeCost(flush), (Cost{}); got != want {
+			t.Errorf("fail (%s) second computeCost(%+v) = %+v, want %+v", c.desc, flush, got, want)
+		}
+	}
+}
+
+func TestDeviceContext_Actuators(t *testing.T) {
+	dc := newDeviceContext(dualActuatorDeviceConfig)
+
+	// Find a file on the same actuator as "a", and one on the other actuator.
+	var same, other string
+	for i := 0; same == "" || other == ""; i++ {
+		path := fmt.Sprintf("f%d", i)
+		if dc.actuatorFor(path) == dc.actuatorFor("a") {
+			same = path
+		} else {
+			other = path
+		}
+	}
+
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 10})
+
+	// The other actuator is free, and its seek doesn't move the first actuator's heads.
+	read := &Request{Type: ReadRequest, Timestamp: startTime, Path: other, Start: 0, Size: 10}
+	if got, want := dc.computeCost(read), (Cost{Seek: 10 * time.Millisecond, Transfer: 100 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", read, got, want)
+	}
+	dc.execute(read)
+	read = &Request{Type: ReadRequest, Timestamp: startTime.Add(110 * time.Millisecond), Path: "a", Start: 10, Size: 10}
+	if got, want := dc.computeCost(read), (Cost{Transfer: 100 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", read, got, want)
+	}
+
+	// Files on the same actuator still wait for each other.
+	read = &Request{Type: ReadRequest, Timestamp: startTime, Path: same, Start: 0, Size: 10}
+	if got, want := dc.computeCost(read), (Cost{Wait: 110 * time.Millisecond, Seek: 10 * time.Millisecond, Transfer: 100 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", read, got, want)
+	}
+}
+
+func TestDeviceContext_DirectoryLocks(t *testing.T) {
+	dc := newDeviceContext(directoryLockDeviceConfig)
+
+	cases := []struct {
+		req  *Request
+		want Cost
+	}{
+		{&Request{Type: DirEntryRequest, Timestamp: startTime, Path: "d/a"}, Cost{Fixed: 10 * time.Millisecond}},
+		// Waits for the lock, by which time the device is free.
+		{&Request{Type: DirEntryRequest, Timestamp: startTime, Path: "d/b"}, Cost{Lock: 100 * time.Millisecond, Fixed: 10 * time.Millisecond}},
+		{&Request{Type: DirEntryRequest, Timestamp: startTime, Path: "d/c"}, Cost{Lock: 200 * time.Millisecond, Fixed: 10 * time.Millisecond}},
+		// Other directories have their own locks, but still wait for the device.
+		{&Request{Type: DirEntryRequest, Timestamp: startTime, Path: "e/a"}, Cost{Wait: 210 * time.Millisecond, Fixed: 10 * time.Millisecond}},
+		// Other metadata requests don't take the lock.
+		{&Request{Type: MetadataRequest, Timestamp: startTime.Add(time.Second), Path: "d/a"}, Cost{Fixed: 10 * time.Millisecond}},
+		// The lock is released by now.
+		{&Request{Type: DirEntryRequest, Timestamp: startTime.Add(2 * time.Second), Path: "d/d"}, Cost{Fixed: 10 * time.Millisecond}},
+	}
+
+	for _, c := range cases {
+		if got, want := dc.computeCost(c.req), c.want; got != want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", c.req, got, want)
+		}
+		dc.execute(c.req)
+	}
+}
+
+func TestDeviceContext_Reclaim(t *testing.T) {
+	dc := newDeviceContext(reclaimDeviceConfig)
+
+	// Unlinking takes time proportional to the size of the file.
+	unlink := &Request{Type: DirEntryRequest, Timestamp: startTime, Path: "d/a", Size: 1000}
+	if got, want := dc.computeCost(unlink), (Cost{Fixed: 10 * time.Millisecond, Transfer: 100 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", unlink, got, want)
+	}
+	dc.execute(unlink)
+
+	// Reclaiming starts once the unlink completes, 110ms later.
+	cases := []struct {
+		t    time.Time
+		want units.NumBytes
+	}{
+		{startTime, 1000},
+		{startTime.Add(110 * time.Millisecond), 1000},
+		{startTime.Add(610 * time.Millisecond), 500},
+		{startTime.Add(2 * time.Second), 0},
+	}
+
+	for _, c := range cases {
+		if got := dc.unreclaimedBytes(c.t); got != c.want {
+			t.Errorf("unreclaimedBytes(%s) = %d, want %d", c.t.Sub(startTime), got, c.want)
+		}
+	}
+}
+
+func TestDeviceContext_DeletedRetention(t *testing.T) {
+	dc := newDeviceContext(retentionDeviceConfig)
+	dc.execute(&Request{Type: DirEntryRequest, Timestamp: startTime, Path: "d/a", Size: 1000})
+	dc.execute(&Request{Type: DirEntryRequest, Timestamp: startTime.Add(time.Minute), Path: "d/b", Size: 2000})
+
+	// Each unlink completes 10ms after it starts, and is retained for an hour after that.
+	cases := []struct {
+		t    time.Time
+		want units.NumBytes
+	}{
+		{startTime.Add(time.Minute), 3000},
+		{startTime.Add(time.Hour + 10*time.Millisecond), 3000},
+		{startTime.Add(time.Hour + 510*time.Millisecond), 2500},
+		{startTime.Add(time.Hour + time.Minute + 10*time.Millisecond), 2000},
+		{startTime.Add(time.Hour + time.Minute + 1010*time.Millisecond), 1000},
+		{startTime.Add(2 * time.Hour), 0},
+	}
+
+	for _, c := range cases {
+		if got := dc.unreclaimedBytes(c.t); got != c.want {
+			t.Errorf("unreclaimedBytes(%s) = %d, want %d", c.t.Sub(startTime), got, c.want)
+		}
+	}
+}
+
+func TestDeviceContext_Upload(t *testing.T) {
+	dc := newDeviceContext(uploadDeviceConfig)
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100})
+
+	cases := []struct {
+		req  *Request
+		want Cost
+	}{
+		// At 10 bytes per second, a is uploaded 10s after it was written.
+		{&Request{Type: FsyncRequest, Timestamp: startTime.Add(time.Second), Path: "a"}, Cost{Upload: 9 * time.Second}},
+		{&Request{Type: FlushRequest, Timestamp: startTime.Add(4 * time.Second), Path: "a"}, Cost{Upload: 6 * time.Second}},
+		{&Request{Type: FlushRequest, Timestamp: startTime.Add(time.Second), Path: "b"}, Cost{}},
+		{&Request{Type: FsyncRequest, Timestamp: startTime.Add(11 * time.Second), Path: "a"}, Cost{}},
+		// Other requests don't wait for uploads.
+		{&Request{Type: MetadataRequest, Timestamp: startTime.Add(time.Second), Path: "a"}, Cost{Fixed: 10 * time.Millisecond}},
+	}
+
+	for _, c := range cases {
+		if got := dc.computeCost(c.req); got != c.want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", c.req, got, c.want)
+		}
+	}
+
+	// The device is free while a request waits for uploads.
+	dc.execute(cases[0].req)
+	if got, want := dc.actuators[0].busyUntil, startTime.Add(time.Second); !got.Equal(want) {
+		t.Errorf("busyUntil after fsync = %s, want %s", got, want)
+	}
+}
+
+func TestDeviceContext_Network(t *testing.T) {
+	dc := newDeviceContext(networkDeviceConfig)
+
+	// Small requests only pay the latency, while large ones are limited by the bandwidth.
+	cases := []struct {
+		req  *Request
+		want Cost
+	}{
+		{&Request{Type: MetadataRequest, Timestamp: startTime, Path: "a"}, Cost{Fixed: 10 * time.Millisecond, Network: time.Millisecond}},
+		{&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 1}, Cost{Network: 2 * time.Millisecond}},
+		{&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 1000}, Cost{Network: 1001 * time.Millisecond}},
+	}
+	for _, c := range cases {
+		if got := dc.computeCost(c.req); got != c.want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", c.req, got, c.want)
+		}
+	}
+
+	// Data takes turns on the network, even for files the device could serve in parallel.
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 100})
+	req := &Request{Type: WriteRequest, Timestamp: startTime.Add(40 * time.Millisecond), Path: "b", Size: 100}
+	if got, want := dc.computeCost(req), (Cost{Network: 161 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+}
+
+func TestDeviceContext_FsyncGroup(t *testing.T) {
+	dc := newDeviceContext(fsyncGroupDeviceConfig)
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 10})
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "b", Start: 0, Size: 10})
+
+	cases := []struct {
+		desc string
+		req  *Request
+		want Cost
+	}{
+		{
+			"first fsync waits out the window, then flushes",
+			&Request{Type: FsyncRequest, Timestamp: startTime, Path: "a"},
+			Cost{Wait: 5 * time.Millisecond, Seek: 10 * time.Millisecond, Transfer: 100 * time.Millisecond},
+		},
+		{
+			"fsync within the window shares the flush",
+			&Request{Type: FsyncRequest, Timestamp: startTime.Add(2 * time.Millisecond), Path: "b"},
+			Cost{Wait: 113 * time.Millisecond, Transfer: 100 * time.Millisecond},
+		},
+		{
+			"fsync after the window starts a new group",
+			&Request{Type: FsyncRequest, Timestamp: startTime.Add(10 * time.Millisecond), Path: "a"},
+			Cost{Wait: 205 * time.Millisecond, Seek: 10 * time.Millisecond},
+		},
+	}
+
+	for _, c := range cases {
+		if got := dc.computeCost(c.req); got != c.want {
+			t.Errorf("%s: computeCost(%+v) = %+v, want %+v", c.desc, c.req, got, c.want)
+		}
+		dc.execute(c.req)
+	}
+}
+
+func TestDeviceContext_FlashPresets(t *testing.T) {
+	// Random reads pay the seek time on flash too, so they are much slower than sequential ones.
+	for _, config := range []*slowfs.DeviceConfig{&slowfs.SSDDeviceConfig, &slowfs.NVMeDeviceConfig} {
+		dc := newDeviceContext(config)
+		dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 4 * units.Kibibyte})
+
+		sequential := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 4 * units.Kibibyte, Size: 4 * units.Kibibyte}
+		if got, want := dc.computeCost(sequential).Seek, time.Duration(0); got != want {
+			t.Errorf("%s: computeCost(%+v).Seek = %s, want %s", config.Name, sequential, got, want)
+		}
+		random := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: units.Gibibyte, Size: 4 * units.Kibibyte}
+		if got, want := dc.computeCost(random).Seek, config.SeekTime; got != want {
+			t.Errorf("%s: computeCost(%+v).Seek = %s, want %s", config.Name, random, got, want)
+		}
+		// They also move their data slower.
+		if got, want := dc.computeCost(random).Transfer, config.RandomReadTime(random.Size); got != want {
+			t.Errorf("%s: computeCost(%+v).Transfer = %s, want %s", config.Name, random, got, want)
+		}
+		if random, sequential := dc.computeCost(random).Transfer, dc.computeCost(sequential).Transfer; random <= sequential {
+			t.Errorf("%s: random read transfer %s, want more than sequential %s", config.Name, random, sequential)
+		}
+	}
+}
+
+func TestDeviceContext_Latencies(t *testing.T) {
+	config := *basicDeviceConfig
+	config.SeekTimeDistribution = &slowfs.Distribution{Kind: slowfs.ConstantDistribution, A: 3 * time.Millisecond}
+	config.MetadataOpDistribution = &slowfs.Distribution{Kind: slowfs.ConstantDistribution, A: 2 * time.Millisecond}
+	config.BaseLatency = &slowfs.Distribution{Kind: slowfs.ConstantDistribution, A: time.Millisecond}
+	dc := newDeviceContext(&config)
+
+	cases := []struct {
+		req  *Request
+		want Cost
+	}{
+		{&Request{Type: MetadataRequest, Timestamp: startTime, Path: "a"}, Cost{Fixed: 3 * time.Millisecond}},
+		{&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Size: 100}, Cost{Seek: 3 * time.Millisecond, Transfer: time.Second, Fixed: time.Millisecond}},
+	}
+	for _, c := range cases {
+		c.req.latencies = dc.rollLatencies()
+		if got := dc.computeCost(c.req); got != c.want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", c.req, got, c.want)
+		}
+	}
+
+	// Without distributions, requests take the constant latencies.
+	if got := newDeviceContext(basicDeviceConfig).rollLatencies(); got != nil {
+		t.Errorf("rollLatencies() = %+v, want nil", got)
+	}
+}
+
+func TestDeviceContext_RandomThroughput(t *testing.T) {
+	dc := newDeviceContext(randomThroughputDeviceConfig)
+
+	cases := []struct {
+		desc string
+		req  *Request
+		want Cost
+	}{
+		{
+			"first read seeks, so is random",
+			&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 10},
+			Cost{Seek: 10 * time.Millisecond, Transfer: time.Second},
+		},
+		{
+			"read continuing from the last is sequential",
+			&Request{Type: ReadRequest, Timestamp: startTime.Add(2 * time.Second), Path: "a", Start: 10, Size: 10},
+			Cost{Transfer: 100 * time.Millisecond},
+		},
+		{
+			"read within the seek window is sequential",
+			&Request{Type: ReadRequest, Timestamp: startTime.Add(3 * time.Second), Path: "a", Start: 22, Size: 10},
+			Cost{Transfer: 100 * time.Millisecond},
+		},
+		{
+			"write to another file is random",
+			&Request{Type: WriteRequest, Timestamp: startTime.Add(4 * time.Second), Path: "b", Start: 0, Size: 10},
+			Cost{Seek: 10 * time.Millisecond, Transfer: 500 * time.Millisecond},
+		},
+		{
+			"write continuing from the last is sequential",
+			&Request{Type: WriteRequest, Timestamp: startTime.Add(5 * time.Second), Path: "b", Start: 10, Size: 10},
+			Cost{Transfer: 100 * time.Millisecond},
+		},
+	}
+
+	for _, c := range cases {
+		if got := dc.computeCost(c.req); got != c.want {
+			t.Errorf("%s: computeCost(%+v) = %+v, want %+v", c.desc, c.req, got, c.want)
+		}
+		dc.execute(c.req)
+	}
+}
+
+func TestDeviceContext_QueueDepth(t *testing.T) {
+	dc := newDeviceContext(queueDepthDeviceConfig)
+
+	// Writes only pay the network latency, so the first two overlap, and the third waits for a slot.
+	for _, want := range []Cost{{Network: time.Millisecond}, {Network: time.Millisecond}, {Queue: time.Millisecond, Network: time.Millisecond}} {
+		req := &Request{Type: WriteRequest, Timestamp: startTime, Path: "a"}
+		if got := dc.computeCost(req); got != want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+		}
+		dc.execute(req)
+	}
+	if got, want := dc.state(startTime), (State{DeviceQueue: 2, QueueWaiting: 1}); got.DeviceQueue != want.DeviceQueue || got.QueueWaiting != want.QueueWaiting {
+		t.Errorf("state() = %d in queue and %d waiting, want %d and %d", got.DeviceQueue, got.QueueWaiting, want.DeviceQueue, want.QueueWaiting)
+	}
+
+	// Once the first two complete, a slot is free again.
+	req := &Request{Type: WriteRequest, Timestamp: startTime.Add(time.Millisecond), Path: "a"}
+	if got, want := dc.computeCost(req), (Cost{Network: time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+
+	// With the third and fourth in the queue, reads served from memory still don't need a slot, or
+	// the network.
+	dc.execute(req)
+	dc.readCache.warm("b", 100)
+	req = &Request{Type: ReadRequest, Timestamp: startTime.Add(time.Millisecond), Path: "b", Size: 100}
+	if got, want := dc.computeCost(req), (Cost{}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+}
+
+func TestDeviceContext_ReadCache(t *testing.T) {
+	dc := newDeviceContext(readCacheDeviceConfig)
+
+	// The first read goes to the device, and reading it again comes from memory.
+	req := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100}
+	if got, want := dc.computeCost(req), (Cost{Seek: 10 * time.Millisecond, Transfer: time.Second}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+	dc.execute(req)
+	req = &Request{Type: ReadRequest, Timestamp: startTime.Add(2 * time.Second), Path: "a", Start: 50, Size: 100}
+	if got, want := dc.computeCost(req), (Cost{Fixed: time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+
+	// Reading two other pages' worth evicts it.
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime.Add(2 * time.Second), Path: "b", Start: 0, Size: 2 * readCachePageSize})
+	if got, want := dc.computeCost(req).Fixed, time.Duration(0); got != want {
+		t.Errorf("computeCost(%+v).Fixed after eviction = %s, want %s", req, got, want)
+	}
+	if got, want := dc.state(startTime).ReadCacheBytes, 2*readCachePageSize; got != want {
+		t.Errorf("state().ReadCacheBytes = %d, want %d", got, want)
+	}
+}
+
+func TestDeviceContext_ReadCacheInvalidation(t *testing.T) {
+	config := *readCacheDeviceConfig
+	config.ReadAheadBytes = 8
+	cases := []struct {
+		desc string
+		req  *Request
+	}{
+		{"truncate", &Request{Type: TruncateRequest, Path: "a", Start: 0, Size: 100}},
+		{"punch hole", &Request{Type: PunchHoleRequest, Path: "a", Start: 0, Size: 100}},
+		{"unlink", &Request{Type: DirEntryRequest, Path: "a", Size: 100}},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(&config)
+		dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100})
+		c.req.Timestamp = startTime.Add(time.Hour)
+		dc.execute(c.req)
+
+		// Neither the data read nor what was read ahead after it is served from memory any more.
+		for _, req := range []*Request{
+			{Type: ReadRequest, Timestamp: startTime.Add(2 * time.Hour), Path: "a", Start: 0, Size: 100},
+			{Type: ReadRequest, Timestamp: startTime.Add(2 * time.Hour), Path: "a", Start: 100, Size: 8},
+		} {
+			if dc.cached(req) {
+				t.Errorf("after %s, cached(%+v) = true, want false", c.desc, req)
+			}
+		}
+		if got, want := len(dc.readAheads), 0; got != want {
+			t.Errorf("after %s, %d files read ahead, want %d", c.desc, got, want)
+		}
+	}
+}
+
+func TestDeviceContext_CachedReadsSkipDevice(t *testing.T) {
+	config := *readCacheDeviceConfig
+	config.NetworkLatency = time.Millisecond
+	dc := newDeviceContext(&config)
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Size: 100})
+
+	// While the device is busy reading b until 3.01s, a cached read of a neither waits for it nor
+	// crosses the network, and doesn't hold up the read of c after it.
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime.Add(2 * time.Second), Path: "b", Size: 100})
+	req := &Request{Type: ReadRequest, Timestamp: startTime.Add(2100 * time.Millisecond), Path: "a", Size: 100}
+	if got, want := dc.computeCost(req), (Cost{Fixed: time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+	dc.execute(req)
+	req = &Request{Type: ReadRequest, Timestamp: startTime.Add(2200 * time.Millisecond), Path: "c", Size: 100}
+	if got, want := dc.computeCost(req).Wait, 810*time.Millisecond; got != want {
+		t.Errorf("computeCost(%+v).Wait = %s, want %s", req, got, want)
+	}
+}
+
+func TestDeviceContext_JournalCommit(t *testing.T) {
+	dc := newDeviceContext(journalDeviceConfig)
+
+	// With data=ordered, fsyncing one file writes back every file's cached data, and commits the
+	// journal even though nothing's attributes changed.
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 100})
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "b", Size: 200})
+	req := &Request{Type: FsyncRequest, Timestamp: startTime, Path: "a"}
+	if got, want := dc.computeCost(req), (Cost{Seek: 10 * time.Millisecond, Transfer: 3 * time.Second, Fixed: 5 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+	dc.execute(req)
+
+	// Once it's done, fsyncing the other file only commits the journal.
+	req = &Request{Type: FsyncRequest, Timestamp: startTime.Add(time.Minute), Path: "b"}
+	if got, want := dc.computeCost(req), (Cost{Seek: 10 * time.Millisecond, Fixed: 5 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+}
+
+func TestDeviceContext_Fdatasync(t *testing.T) {
+	dumb := slowfs.DumbFsync
+	config := *journalDeviceConfig
+	config.FsyncFlushesAllData = false
+	config.MetadataStrategy = slowfs.JournaledMetadata
+	config.MetadataCommitInterval = time.Hour
+	dc := newDeviceContext(&config)
+
+	// Fdatasync writes back the file's data like fsync, but leaves its attributes and the journal
+	// uncommitted.
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 100})
+	dc.execute(&Request{Type: SetAttrRequest, Timestamp: startTime, Path: "a"})
+	req := &Request{Type: FdatasyncRequest, Timestamp: startTime.Add(time.Second), Path: "a"}
+	if got, want := dc.computeCost(req), (Cost{Seek: 10 * time.Millisecond, Transfer: time.Second}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+	dc.execute(req)
+	if got, want := dc.writeBackCache.getUnwrittenBytes("a"), units.NumBytes(0); got != want {
+		t.Errorf("getUnwrittenBytes(a) after fdatasync = %d, want %d", got, want)
+	}
+	if !dc.uncommittedMetadata["a"] {
+		t.Errorf("metadata of a committed by fdatasync, want uncommitted")
+	}
+
+	// Fsync still commits the journal.
+	req = &Request{Type: FsyncRequest, Timestamp: startTime.Add(time.Minute), Path: "a"}
+	if got, want := dc.computeCost(req), (Cost{Seek: 10 * time.Millisecond, Fixed: 5 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+
+	// With its own strategy, fdatasync is modeled independently of fsync.
+	config.FdatasyncStrategy = &dumb
+	req = &Request{Type: FdatasyncRequest, Timestamp: startTime.Add(time.Minute), Path: "a"}
+	if got, want := dc.computeCost(req), (Cost{Seek: 100 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) with DumbFsync = %+v, want %+v", req, got, want)
+	}
+
+	// Then it leaves the write back cache alone, so the next fsync still writes the data back.
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime.Add(time.Hour), Path: "a", Size: 100})
+	dc.execute(&Request{Type: FdatasyncRequest, Timestamp: startTime.Add(time.Hour), Path: "a"})
+	if got, want := dc.writeBackCache.getUnwrittenBytes("a"), units.NumBytes(100); got != want {
+		t.Errorf("getUnwrittenBytes(a) after a DumbFsync fdatasync = %d, want %d", got, want)
+	}
+	req = &Request{Type: FsyncRequest, Timestamp: startTime.Add(time.Hour), Path: "a"}
+	if got, want := dc.computeCost(req).Transfer, time.Second; got != want {
+		t.Errorf("computeCost(%+v).Transfer after a DumbFsync fdatasync = %s, want %s", req, got, want)
+	}
+}
+
+func TestDeviceContext_JournalCommitRequest(t *testing.T) {
+	config := *journalDeviceConfig
+	config.MetadataStrategy = slowfs.JournaledMetadata
+	config.MetadataCommitInterval = time.Hour
+	dc := newDeviceContext(&config)
+
+	// On a metadata device, the metadata part of an fsync only commits the journal, without seeking
+	// or writing back data.
+	dc.execute(&Request{Type: SetAttrRequest, Timestamp: startTime, Path: "a"})
+	req := &Request{Type: JournalCommitRequest, Timestamp: startTime.Add(time.Second), Path: "a"}
+	if got, want := dc.computeCost(req), (Cost{Fixed: 5 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+	dc.execute(req)
+	if dc.uncommittedMetadata["a"] {
+		t.Errorf("metadata of a uncommitted after a journal commit, want committed")
+	}
+}
+
+func TestDeviceContext_DirectWrite(t *testing.T) {
+	dc := newDeviceContext(writeBackCacheDeviceConfig)
+
+	// Direct writes pay the device's full cost, even with fast writes, and sequential ones don't
+	// seek.
+	cases := []struct {
+		req  *Request
+		want Cost
+	}{
+		{&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 100, Direct: true}, Cost{Seek: 10 * time.Millisecond, Transfer: time.Second}},
+		{&Request{Type: WriteRequest, Timestamp: startTime.Add(2 * time.Second), Path: "a", Start: 100, Size: 100, Direct: true}, Cost{Transfer: time.Second}},
+		{&Request{Type: WriteRequest, Timestamp: startTime.Add(time.Minute), Path: "a", Start: 200, Size: 100}, Cost{}},
+	}
+	for _, c := range cases {
+		if got, want := dc.computeCost(c.req), c.want; got != want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", c.req, got, want)
+		}
+		dc.execute(c.req)
+	}
+
+	// Only the cached write is left for fsync to write back.
+	if got, want := dc.writeBackCache.getUnwrittenBytes("a"), units.NumBytes(100); got != want {
+		t.Errorf("getUnwrittenBytes(a) = %d, want %d", got, want)
+	}
+}
+
+func TestDeviceContext_VerifyWrites(t *testing.T) {
+	config := *basicDeviceConfig
+	config.VerifyWrites = true
+	dc := newDeviceContext(&config)
+
+	// Each write is read back at the read rate.
+	req := &Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 100}
+	if got, want := dc.computeCost(req), (Cost{Seek: 10 * time.Millisecond, Transfer: time.Second, Verify: time.Second}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+
+	// So is data written back from the write back cache, whether by fsync or in spare time.
+	config = *writeBackCacheDeviceConfig
+	config.VerifyWrites = true
+	dc = newDeviceContext(&config)
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 100})
+	req = &Request{Type: FsyncRequest, Timestamp: startTime, Path: "a"}
+	if got, want := dc.computeCost(req), (Cost{Seek: 10 * time.Millisecond, Transfer: time.Second, Verify: time.Second}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+	dc.execute(&Request{Type: MetadataRequest, Timestamp: startTime.Add(1010 * time.Millisecond), Path: "b"})
+	if got, want := dc.writeBackCache.getUnwrittenBytes("a"), units.NumBytes(50); got != want {
+		t.Errorf("getUnwrittenBytes(a) after writing back for 1s = %d, want %d", got, want)
+	}
+}
+
+func TestDeviceContext_PMEMPreset(t *testing.T) {
+	// Writes are cheap stores anywhere in the file, and fsync pays for flushing them.
+	dc := newDeviceContext(&slowfs.PMEMDeviceConfig)
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 64})
+
+	write := &Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: units.Gibibyte, Size: 64}
+	if got, want := dc.computeCost(write).Total(), time.Duration(0); got != want {
+		t.Errorf("computeCost(%+v).Total() = %s, want %s", write, got, want)
+	}
+	dc.execute(write)
+
+	fsync := &Request{Type: FsyncRequest, Timestamp: startTime, Path: "a"}
+	cost := dc.computeCost(fsync)
+	if got, want := cost.Seek, time.Duration(0); got != want {
+		t.Errorf("computeCost(%+v).Seek = %s, want %s", fsync, got, want)
+	}
+	if got, want := cost.Transfer, slowfs.PMEMDeviceConfig.WriteTime(128); got != want {
+		t.Errorf("computeCost(%+v).Transfer = %s, want %s", fsync, got, want)
+	}
+}
+
+func TestDeviceContext_Priority(t *testing.T) {
+	dc := newDeviceContext(basicDeviceConfig)
+
+	// Each request takes 80ms. Requests jump ahead of lower priority ones which haven't started, so
+	// the second idle request is pushed back by everything after it, and the last waits for all.
+	cases := []struct {
+		at       time.Duration
+		priority Priority
+		wantWait time.Duration
+	}{
+		{0, IdlePriority, 0},
+		{0, IdlePriority, 80 * time.Millisecond},
+		// The first idle request has started, so this waits for it, then goes before the second.
+		{10 * time.Millisecond, NormalPriority, 70 * time.Millisecond},
+		// Likewise, but this also goes before the normal one.
+		{20 * time.Millisecond, HighPriority, 60 * time.Millisecond},
+		// The high and normal requests before go first, then this, before the second idle request.
+		{30 * time.Millisecond, NormalPriority, 210 * time.Millisecond},
+		{40 * time.Millisecond, IdlePriority, 360 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		req := &Request{Type: MetadataRequest, Timestamp: startTime.Add(c.at), Path: "a", Priority: c.priority}
+		if got, want := dc.computeCost(req).Wait, c.wantWait; got != want {
+			t.Errorf("computeCost(%+v).Wait = %s, want %s", req, got, want)
+		}
+		dc.execute(req)
+	}
+}
+
+func TestDeviceContext_ReadAhead(t *testing.T) {
+	config := *basicDeviceConfig
+	config.ReadAheadBytes = 8
+	dc := newDeviceContext(&config)
+
+	cases := []struct {
+		start, size units.NumBytes
+		want        Cost
+	}{
+		// The first read fetches the 8 bytes after it too, so the reads of them which follow are free.
+		{0, 2, Cost{Seek: 10 * time.Millisecond, Transfer: 100 * time.Millisecond}},
+		{2, 2, Cost{}},
+		{4, 6, Cost{}},
+		// Reading on sequentially reads ahead again, without seeking past what was prefetched.
+		{10, 2, Cost{Transfer: 100 * time.Millisecond}},
+		// Random reads don't read ahead.
+		{100, 2, Cost{Seek: 10 * time.Millisecond, Transfer: 20 * time.Millisecond}},
+	}
+	for i, c := range cases {
+		req := &Request{Type: ReadRequest, Timestamp: startTime.Add(time.Duration(i) * time.Second), Path: "a", Start: c.start, Size: c.size}
+		if got := dc.computeCost(req); got != c.want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, c.want)
+		}
+		dc.execute(req)
+	}
+
+	// Prefetched data is dropped with the rest of the cache.
+	dc.dropCaches()
+	req := &Request{Type: ReadRequest, Timestamp: startTime.Add(time.Hour), Path: "a", Start: 104, Size: 2}
+	if got, want := dc.computeCost(req).Transfer, 20*time.Millisecond; got != want {
+		t.Errorf("after dropCaches, computeCost(%+v).Transfer = %s, want %s", req, got, want)
+	}
+}
+
+func TestDeviceContext_NoOpStrategy(t *testing.T) {
+	cases := []struct {
+		desc     string
+		strategy slowfs.NoOpStrategy
+		req      *Request
+		want     Cost
+	}{
+		{"default write", slowfs.DefaultNoOps, &Request{Type: WriteRequest, Path: "a", Start: 50}, Cost{Seek: 10 * time.Millisecond}},
+		{"default truncate", slowfs.DefaultNoOps, &Request{Type: TruncateRequest, Path: "a", Start: 50}, Cost{Fixed: 80 * time.Millisecond}},
+		{"free write", slowfs.FreeNoOps, &Request{Type: WriteRequest, Path: "a", Start: 50}, Cost{}},
+		{"free truncate", slowfs.FreeNoOps, &Request{Type: TruncateRequest, Path: "a", Start: 50}, Cost{}},
+		{"metadata write", slowfs.MetadataNoOps, &Request{Type: WriteRequest, Path: "a", Start: 50}, Cost{Fixed: 80 * time.Millisecond}},
+		{"metadata allocate", slowfs.MetadataNoOps, &Request{Type: AllocateRequest, Path: "a", Start: 50}, Cost{Fixed: 80 * time.Millisecond}},
+		// Operations which do change something are charged as usual.
+		{"free nonempty write", slowfs.FreeNoOps, &Request{Type: WriteRequest, Path: "a", Start: 50, Size: 10}, Cost{Seek: 10 * time.Millisecond, Transfer: 100 * time.Millisecond}},
+	}
+
+	for _, c := range cases {
+		config := *basicDeviceConfig
+		config.NoOpStrategy = c.strategy
+		dc := newDeviceContext(&config)
+		c.req.Timestamp = startTime
+		if got := dc.computeCost(c.req); got != c.want {
+			t.Errorf("%s: computeCost(%+v) = %+v, want %+v", c.desc, c.req, got, c.want)
+		}
+	}
+
+	// A free no-op leaves the device as it was, so the read which follows it is still sequential.
+	config := *basicDeviceConfig
+	config.NoOpStrategy = slowfs.FreeNoOps
+	dc := newDeviceContext(&config)
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Size: 10})
+	dc.execute(&Request{Type: WriteRequest, Timestamp: startTime.Add(time.Second), Path: "b", Start: 50})
+	req := &Request{Type: ReadRequest, Timestamp: startTime.Add(2 * time.Second), Path: "a", Start: 10, Size: 10}
+	if got, want := dc.computeCost(req).Seek, time.Duration(0); got != want {
+		t.Errorf("after a free no-op, computeCost(%+v).Seek = %s, want %s", req, got, want)
+	}
+}
+
+func TestDeviceContext_Misalignment(t *testing.T) {
+	config := *basicDeviceConfig
+	config.AlignmentBytes = 4
+	config.MisalignmentPenalty = 5 * time.Millisecond
+	dc := newDeviceContext(&config)
+
+	cases := []struct {
+		req  *Request
+		want time.Duration
+	}{
+		{&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100}, 0},
+		{&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 2, Size: 100}, 5 * time.Millisecond},
+		{&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 8, Size: 8}, 0},
+		{&Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 8, Size: 7}, 5 * time.Millisecond},
+		// Only reads and writes are charged for misalignment.
+		{&Request{Type: AllocateRequest, Timestamp: startTime, Path: "a", Start: 1, Size: 1}, 0},
+	}
+
+	for _, c := range cases {
+		if got, want := dc.computeCost(c.req).Alignment, c.want; got != want {
+			t.Errorf("computeCost(%+v).Alignment = %s, want %s", c.req, got, want)
+		}
+	}
+
+	// Writes absorbed by the cache never reach the device, so they are never misaligned.
+	config = *fastWriteDeviceConfig
+	config.AlignmentBytes = 4
+	config.MisalignmentPenalty = 5 * time.Millisecond
+	dc = newDeviceContext(&config)
+	req := &Request{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 1, Size: 1}
+	if got, want := dc.computeCost(req).Alignment, time.Duration(0); got != want {
+		t.Errorf("computeCost(%+v).Alignment = %s, want %s", req, got, want)
+	}
+}
+
+func TestDeviceContext_FallocateModes(t *testing.T) {
+	config := *basicDeviceConfig
+	config.FreeBytesPerSecond = 1000
+	dc := newDeviceContext(&config)
+
+	cases := []struct {
+		req  *Request
+		want Cost
+	}{
+		// Punching a hole is charged like truncating the range away.
+		{&Request{Type: PunchHoleRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100}, Cost{Fixed: 80 * time.Millisecond, Transfer: 100 * time.Millisecond}},
+		// Zeroing a range allocates it.
+		{&Request{Type: ZeroRangeRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100}, Cost{Seek: 10 * time.Millisecond, Transfer: 100 * time.Millisecond}},
+		{&Request{Type: AllocateRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100}, Cost{Seek: 10 * time.Millisecond, Transfer: 100 * time.Millisecond}},
+	}
+
+	for _, c := range cases {
+		if got, want := dc.computeCost(c.req), c.want; got != want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", c.req, got, want)
+		}
+	}
+}
+
+func TestDeviceContext_DirectorySize(t *testing.T) {
+	config := *basicDeviceConfig
+	config.DirectoryEntryTime = time.Millisecond
+	dc := newDeviceContext(&config)
+
+	cases := []struct {
+		req  *Request
+		want Cost
+	}{
+		// Listing a directory scans all of its entries.
+		{&Request{Type: ReaddirRequest, Timestamp: startTime, Path: "d", Entries: 100}, Cost{Fixed: 80 * time.Millisecond, Seek: 10 * time.Millisecond, Transfer: 100 * time.Millisecond}},
+		// Looking up or changing an entry scans half of them on average.
+		{&Request{Type: MetadataRequest, Timestamp: startTime, Path: "d/a", Entries: 100}, Cost{Fixed: 80 * time.Millisecond, Seek: 10 * time.Millisecond, Transfer: 50 * time.Millisecond}},
+		{&Request{Type: DirEntryRequest, Timestamp: startTime, Path: "d/a", Entries: 3}, Cost{Fixed: 80 * time.Millisecond, Seek: 10 * time.Millisecond, Transfer: 2 * time.Millisecond}},
+		// Directories of unknown size cost what they always have.
+		{&Request{Type: ReaddirRequest, Timestamp: startTime, Path: "d"}, Cost{Fixed: 80 * time.Millisecond}},
+	}
+
+	for _, c := range cases {
+		if got, want := dc.computeCost(c.req), c.want; got != want {
+			t.Errorf("computeCost(%+v) = %+v, want %+v", c.req, got, want)
+		}
+	}
+
+	// Without a DirectoryEntryTime, size doesn't matter.
+	dc = newDeviceContext(basicDeviceConfig)
+	req := &Request{Type: ReaddirRequest, Timestamp: startTime, Path: "d", Entries: 100}
+	if got, want := dc.computeCost(req), (Cost{Fixed: 80 * time.Millisecond}); got != want {
+		t.Errorf("computeCost(%+v) = %+v, want %+v", req, got, want)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"time"
+)
+
+// priorityQueue holds requests of less than high priority which arrive while their actuator is
+// busy, until it is free, so that requests of higher priority arriving in the meantime go first.
+// Requests are only costed once they leave the queue, so ones which are jumped really do finish
+// later, rather than the device serving two requests at once.
+type priorityQueue struct {
+	dc    *deviceContext
+	timer *time.Timer
+	queue []*requestData
+}
+
+func newPriorityQueue(dc *deviceContext) *priorityQueue {
+	// As for the read/write queue, stop the timer until a request is waiting.
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+	return &priorityQueue{
+		dc:    dc,
+		timer: t,
+	}
+}
+
+// holds returns whether a request arriving at now has to wait in the queue: one of less than high
+// priority which needs the device while its actuator is busy, or while other requests are already
+// waiting for it.
+func (pq *priorityQueue) holds(req *Request, now time.Time) bool {
+	if req.Priority >= HighPriority || pq.dc.servedFromMemory(req) {
+		return false
+	}
+	a := pq.dc.actuatorFor(req.Path)
+	if a.busyUntil.After(now) {
+		return true
+	}
+	for _, data := range pq.queue {
+		if pq.dc.actuatorFor(data.req.Path) == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (pq *priorityQueue) push(data *requestData) {
+	pq.queue = append(pq.queue, data)
+}
+
+// pop removes and returns the request of highest priority, and of those the earliest, whose actuator
+// is free at now, or nil if there isn't one.
+func (pq *priorityQueue) pop(now time.Time) *requestData {
+	best := -1
+	for i, data := range pq.queue {
+		if pq.dc.actuatorFor(data.req.Path).busyUntil.After(now) {
+			continue
+		}
+		if best < 0 || data.req.Priority > pq.queue[best].req.Priority {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	data := pq.queue[best]
+	pq.queue = append(pq.queue[:best], pq.queue[best+1:]...)
+	return data
+}
+
+// scheduleResponse sets the timer to fire when the first actuator a request is waiting for is free.
+func (pq *priorityQueue) scheduleResponse(now time.Time) {
+	if len(pq.queue) == 0 {
+		return
+	}
+	free := pq.dc.actuatorFor(pq.queue[0].req.Path).busyUntil
+	for _, data := range pq.queue[1:] {
+		if t := pq.dc.actuatorFor(data.req.Path).busyUntil; t.Before(free) {
+			free = t
+		}
+	}
+	pq.timer.Reset(free.Sub(now))
+}
+
+func (pq *priorityQueue) responseChannel() <-chan time.Time {
+	return pq.timer.C
+}
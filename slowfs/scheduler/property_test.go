@@ -0,0 +1,271 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"flag"
+	"math/rand"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+var (
+	propertySeed   = flag.Int64("property_seed", 0, "seed for property tests, or 0 to pick one from the clock")
+	propertyRounds = flag.Int("property_rounds", 200, "how many random device configs property tests try")
+)
+
+// propertyRand returns a random source for property tests, logging its seed so that a failure can
+// be reproduced with --property_seed.
+func propertyRand(t *testing.T) *rand.Rand {
+	seed := *propertySeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("using --property_seed=%d", seed)
+	return rand.New(rand.NewSource(seed))
+}
+
+func randomDuration(r *rand.Rand, max time.Duration) time.Duration {
+	return time.Duration(r.Int63n(int64(max) + 1))
+}
+
+func randomBytes(r *rand.Rand, max units.NumBytes) units.NumBytes {
+	return units.NumBytes(r.Int63n(int64(max) + 1))
+}
+
+// randomDeviceConfig returns a random valid device config, within the bounds of real devices.
+func randomDeviceConfig(r *rand.Rand) *slowfs.DeviceConfig {
+	config := &slowfs.DeviceConfig{
+		SeekWindow:             randomBytes(r, units.Mebibyte),
+		SeekTime:               randomDuration(r, 100*time.Millisecond),
+		ReadBytesPerSecond:     1 + randomBytes(r, 10*units.Gibibyte),
+		WriteBytesPerSecond:    1 + randomBytes(r, 10*units.Gibibyte),
+		AllocateBytesPerSecond: 1 + randomBytes(r, 10*units.Gibibyte),
+		RequestReorderMaxDelay: randomDuration(r, 500*time.Microsecond),
+		FsyncStrategy:          slowfs.FsyncStrategy(r.Intn(int(slowfs.WriteBackCachedFsync) + 1)),
+		WriteStrategy:          slowfs.FastWrite,
+		MetadataOpTime:         randomDuration(r, 100*time.Millisecond),
+		ReadRepairProbability:  r.Float64(),
+		ReadRepairSeeks:        r.Intn(10),
+		Actuators:              r.Intn(5),
+		DirectoryLockTime:      randomDuration(r, 100*time.Millisecond),
+	}
+	// Rates of 0 turn the matching cost off, so leave some of them there.
+	if r.Intn(2) == 0 {
+		config.MetadataBytesPerSecond = randomBytes(r, units.Gibibyte)
+	}
+	if r.Intn(2) == 0 {
+		config.FreeBytesPerSecond = randomBytes(r, 10*units.Gibibyte)
+	}
+	if r.Intn(2) == 0 {
+		config.ZeroFillBytesPerSecond = randomBytes(r, 10*units.Gibibyte)
+	}
+	if r.Intn(2) == 0 {
+		config.ReclaimBytesPerSecond = randomBytes(r, 10*units.Gibibyte)
+	}
+	if r.Intn(2) == 0 {
+		config.DeletedRetention = randomDuration(r, time.Minute)
+	}
+	if r.Intn(2) == 0 {
+		config.FsyncGroupWindow = randomDuration(r, 10*time.Millisecond)
+	}
+	if r.Intn(2) == 0 {
+		config.RandomReadBytesPerSecond = randomBytes(r, units.Gibibyte)
+		config.RandomWriteBytesPerSecond = randomBytes(r, units.Gibibyte)
+	}
+	if r.Intn(2) == 0 {
+		config.QueueDepth = 1 + r.Intn(32)
+	}
+	if r.Intn(2) == 0 {
+		config.ReadCacheBytes = randomBytes(r, 4*units.Mebibyte)
+		config.ReadCacheEviction = slowfs.EvictionPolicy(r.Intn(int(slowfs.FIFOEviction) + 1))
+		config.ReadCacheHitTime = randomDuration(r, time.Millisecond)
+	}
+	if r.Intn(2) == 0 {
+		config.VerifyWrites = true
+	}
+	if r.Intn(2) == 0 {
+		config.ReadAheadBytes = randomBytes(r, units.Mebibyte)
+	}
+	if r.Intn(2) == 0 {
+		config.NoOpStrategy = slowfs.NoOpStrategy(r.Intn(int(slowfs.MetadataNoOps) + 1))
+	}
+	if r.Intn(2) == 0 {
+		config.AlignmentBytes = 512 << uint(r.Intn(4))
+		config.MisalignmentPenalty = randomDuration(r, time.Millisecond)
+	}
+	if r.Intn(2) == 0 {
+		config.DirectoryEntryTime = randomDuration(r, 10*time.Microsecond)
+	}
+	if r.Intn(2) == 0 {
+		config.JournalCommitTime = randomDuration(r, 10*time.Millisecond)
+	}
+	if r.Intn(2) == 0 {
+		config.NetworkLatency = randomDuration(r, 10*time.Millisecond)
+		config.NetworkBytesPerSecond = randomBytes(r, 10*units.Gibibyte)
+	}
+	if r.Intn(2) == 0 {
+		config.UploadBytesPerSecond = 1 + randomBytes(r, units.Gibibyte)
+		config.FsyncWaitsForUpload = r.Intn(2) == 0
+		config.CloseWaitsForUpload = r.Intn(2) == 0
+	}
+	if r.Intn(2) == 0 {
+		config.MetadataStrategy = slowfs.JournaledMetadata
+		config.MetadataCommitInterval = 1 + randomDuration(r, 10*time.Second)
+	}
+	if r.Intn(2) == 0 {
+		strategy := slowfs.FsyncStrategy(r.Intn(int(slowfs.DumbFsync) + 1))
+		if config.FsyncStrategy == slowfs.WriteBackCachedFsync && r.Intn(2) == 0 {
+			strategy = slowfs.WriteBackCachedFsync
+		}
+		config.FdatasyncStrategy = &strategy
+	}
+	// Only combine options the way Validate doesn't warn about.
+	if config.FsyncStrategy == slowfs.WriteBackCachedFsync {
+		config.FlushOnClose = r.Intn(2) == 0
+		config.ReadWriteBackCache = r.Intn(2) == 0
+		config.FsyncFlushesAllData = r.Intn(2) == 0
+	} else if r.Intn(2) == 0 {
+		config.WriteStrategy = slowfs.SimulateWrite
+	}
+	return config
+}
+
+var propertyPaths = []string{"/a/1", "/a/2", "/a/b/3", "/c/4", "/c/5"}
+
+// randomRequests returns n random requests on a handful of paths, in timestamp order.
+func randomRequests(r *rand.Rand, n int) []*Request {
+	reqs := make([]*Request, n)
+	t := startTime
+	for i := range reqs {
+		// Leave requests back to back often enough that they queue behind each other.
+		if r.Intn(2) == 0 {
+			t = t.Add(randomDuration(r, 50*time.Millisecond))
+		}
+		reqs[i] = &Request{
+			Type:        RequestType(r.Intn(int(FdatasyncRequest) + 1)),
+			Timestamp:   t,
+			Path:        propertyPaths[r.Intn(len(propertyPaths))],
+			Start:       randomBytes(r, units.Mebibyte),
+			Size:        randomBytes(r, units.Mebibyte),
+			Entries:     r.Int63n(1000000),
+			Direct:      r.Intn(4) == 0,
+			Priority:    Priority(r.Intn(3) - 1),
+			needsRepair: r.Intn(2) == 0,
+		}
+		// Now and then, go far enough past the end of any real device to overflow.
+		if r.Intn(20) == 0 {
+			reqs[i].Start = randomBytes(r, units.MaxNumBytes-1)
+		}
+		if r.Intn(20) == 0 {
+			reqs[i].Size = randomBytes(r, units.MaxNumBytes-1)
+		}
+	}
+	return reqs
+}
+
+// unwrittenTotal returns how many bytes the write back cache holds, checking that no file has a
+// negative amount.
+func unwrittenTotal(t *testing.T, wbc *writeBackCache) units.NumBytes {
+	total := wbc.orphanedUnwrittenBytes
+	if total < 0 {
+		t.Errorf("orphanedUnwrittenBytes = %d, want >= 0", total)
+	}
+	for p, n := range wbc.unwrittenBytes {
+		if n < 0 {
+			t.Errorf("unwrittenBytes[%s] = %d, want >= 0", p, n)
+		}
+		total += n
+	}
+	return total
+}
+
+func TestDeviceContext_Properties(t *testing.T) {
+	r := propertyRand(t)
+	for round := 0; round < *propertyRounds; round++ {
+		config := randomDeviceConfig(r)
+		if err := config.Validate(); err != nil {
+			t.Fatalf("randomDeviceConfig() = %+v, which is invalid: %s", config, err)
+		}
+
+		dc := newDeviceContext(config)
+		busyUntil := make(map[*actuator]time.Time)
+		var written, freed units.NumBytes
+		for _, req := range randomRequests(r, 100) {
+			cost := dc.computeCost(req)
+			for _, c := range []struct {
+				name string
+				d    time.Duration
+			}{
+				{"Queue", cost.Queue},
+				{"Wait", cost.Wait},
+				{"Lock", cost.Lock},
+				{"Seek", cost.Seek},
+				{"Transfer", cost.Transfer},
+				{"Repair", cost.Repair},
+				{"Fixed", cost.Fixed},
+			} {
+				if c.d < 0 {
+					t.Errorf("config %+v: computeCost(%+v).%s = %s, want >= 0", config, req, c.name, c.d)
+				}
+			}
+
+			fromMemory := dc.servedFromMemory(req)
+			dc.execute(req)
+			if req.Type == WriteRequest {
+				written = units.NumBytesAdd(written, req.Size)
+			}
+			if req.Type == DirEntryRequest {
+				freed = units.NumBytesAdd(freed, req.Size)
+			}
+
+			// An actuator never finishes its work sooner than before a request, nor before one it
+			// serves arrives, even if it jumped ahead.
+			a := dc.actuatorFor(req.Path)
+			if !fromMemory && a.busyUntil.Before(req.Timestamp) {
+				t.Errorf("config %+v: after %+v, actuator busy until %s, before the request arrived",
+					config, req, a.busyUntil)
+			}
+			if a.busyUntil.Before(busyUntil[a]) {
+				t.Errorf("config %+v: after %+v, actuator busy until %s, before its previous request finished at %s",
+					config, req, a.busyUntil, busyUntil[a])
+			}
+			busyUntil[a] = a.busyUntil
+
+			// The write back cache can't hold more than was written, and fsync empties it for a file.
+			if dc.writeBackCache != nil {
+				if got := unwrittenTotal(t, dc.writeBackCache); got > written {
+					t.Errorf("config %+v: after %+v, write back cache holds %d bytes, more than the %d written",
+						config, req, got, written)
+				}
+				if got := dc.writeBackCache.getUnwrittenBytes(req.Path); req.Type == FsyncRequest && got != 0 {
+					t.Errorf("config %+v: after %+v, %d bytes of %s unwritten, want 0", config, req, got, req.Path)
+				}
+			}
+
+			if got := dc.readCache.pageBytes(); got > config.ReadCacheBytes {
+				t.Errorf("config %+v: after %+v, read cache holds %d bytes, more than ReadCacheBytes",
+					config, req, got)
+			}
+
+			if got := dc.unreclaimedBytes(req.Timestamp); got < 0 || got > freed {
+				t.Errorf("config %+v: after %+v, unreclaimedBytes() = %d, want between 0 and %d",
+					config, req, got, freed)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"container/list"
+	"slowfs/slowfs/units"
+)
+
+// readCachePageSize is the granularity at which data read from the device is cached, like the
+// kernel's pages.
+const readCachePageSize = 4 * units.Kibibyte
+
+// readCache records which file data is cached in memory, so reading it doesn't touch the device.
+type readCache struct {
+	// For each cached file, how many bytes from the start of the file are cached. This is data that
+	// was explicitly warmed, which stays cached until the cache is dropped.
+	cachedBytes map[string]units.NumBytes
+
+	// The pages cached by reads, in the order they are evicted in, and where each is in that order.
+	pages     *list.List
+	pageIndex map[cachePage]*list.Element
+}
+
+// cachePage identifies one page of a file's data.
+type cachePage struct {
+	path  string
+	index int64
+}
+
+func newReadCache() *readCache {
+	return &readCache{
+		cachedBytes: make(map[string]units.NumBytes),
+		pages:       list.New(),
+		pageIndex:   make(map[cachePage]*list.Element),
+	}
+}
+
+// warm caches the first numBytes of the file at path.
+func (rc *readCache) warm(path string, numBytes units.NumBytes) {
+	if cached, ok := rc.cachedBytes[path]; !ok || numBytes > cached {
+		rc.cachedBytes[path] = numBytes
+	}
+}
+
+// contains returns whether all of the given range of the file at path is cached.
+func (rc *readCache) contains(path string, start, size units.NumBytes) bool {
+	if cached, ok := rc.cachedBytes[path]; ok && start >= 0 && start+size <= cached {
+		return true
+	}
+	first, last := pageRange(start, size)
+	if first > last || last-first >= int64(len(rc.pageIndex)) {
+		return false
+	}
+	for i := first; i <= last; i++ {
+		if _, ok := rc.pageIndex[cachePage{path, i}]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// add caches the pages holding the given range of the file at path, evicting the pages first in
+// line until no more than capacity bytes of pages are cached.
+func (rc *readCache) add(path string, start, size, capacity units.NumBytes) {
+	first, last := pageRange(start, size)
+	// Only the end of a range larger than the cache can stay cached.
+	if fit := int64(capacity / readCachePageSize); last-first >= fit {
+		first = last - fit + 1
+	}
+	for i := first; i <= last; i++ {
+		p := cachePage{path, i}
+		if _, ok := rc.pageIndex[p]; !ok {
+			rc.pageIndex[p] = rc.pages.PushBack(p)
+		}
+	}
+	rc.shrink(capacity)
+}
+
+// shrink evicts the pages first in line until no more than capacity bytes of pages are cached.
+func (rc *readCache) shrink(capacity units.NumBytes) {
+	for rc.pageBytes() > capacity {
+		delete(rc.pageIndex, rc.pages.Remove(rc.pages.Front()).(cachePage))
+	}
+}
+
+// use records that the given range of the file at path was read, so that with LRU eviction its
+// cached pages are evicted last.
+func (rc *readCache) use(path string, start, size units.NumBytes) {
+	first, last := pageRange(start, size)
+	if last-first < int64(len(rc.pageIndex)) {
+		for i := first; i <= last; i++ {
+			if e, ok := rc.pageIndex[cachePage{path, i}]; ok {
+				rc.pages.MoveToBack(e)
+			}
+		}
+		return
+	}
+	// The range has more pages than are cached, so look through the cached ones instead.
+	var used []*list.Element
+	for e := rc.pages.Front(); e != nil; e = e.Next() {
+		if p := e.Value.(cachePage); p.path == path && p.index >= first && p.index <= last {
+			used = append(used, e)
+		}
+	}
+	for _, e := range used {
+		rc.pages.MoveToBack(e)
+	}
+}
+
+// evict drops the given range of the file at path from the cache, once it has been changed on the
+// device, along with the rest of the pages holding it.
+func (rc *readCache) evict(path string, start, size units.NumBytes) {
+	if cached, ok := rc.cachedBytes[path]; ok && start < cached {
+		if start <= 0 {
+			delete(rc.cachedBytes, path)
+		} else {
+			rc.cachedBytes[path] = start
+		}
+	}
+	first, last := pageRange(start, size)
+	if last-first < int64(len(rc.pageIndex)) {
+		for i := first; i <= last; i++ {
+			if e, ok := rc.pageIndex[cachePage{path, i}]; ok {
+				delete(rc.pageIndex, rc.pages.Remove(e).(cachePage))
+			}
+		}
+		return
+	}
+	// The range has more pages than are cached, so look through the cached ones instead.
+	var evicted []*list.Element
+	for e := rc.pages.Front(); e != nil; e = e.Next() {
+		if p := e.Value.(cachePage); p.path == path && p.index >= first && p.index <= last {
+			evicted = append(evicted, e)
+		}
+	}
+	for _, e := range evicted {
+		delete(rc.pageIndex, rc.pages.Remove(e).(cachePage))
+	}
+}
+
+// pageBytes returns how many bytes of pages reads have cached.
+func (rc *readCache) pageBytes() units.NumBytes {
+	return units.NumBytes(rc.pages.Len()) * readCachePageSize
+}
+
+// drop empties the cache.
+func (rc *readCache) drop() {
+	rc.cachedBytes = make(map[string]units.NumBytes)
+	rc.pages.Init()
+	rc.pageIndex = make(map[cachePage]*list.Element)
+}
+
+// pageRange returns the first and last pages holding the given range, with first after last if the
+// range is empty.
+func pageRange(start, size units.NumBytes) (int64, int64) {
+	if start < 0 || size <= 0 {
+		return 0, -1
+	}
+	return int64(start / readCachePageSize), int64((units.NumBytesAdd(start, size) - 1) / readCachePageSize)
+}
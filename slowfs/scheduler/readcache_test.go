@@ -0,0 +1,158 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"reflect"
+	"slowfs/slowfs/units"
+	"testing"
+)
+
+func TestReadCache_Contains(t *testing.T) {
+	rc := newReadCache()
+	rc.warm("a", 100)
+	rc.warm("a", 50)
+	rc.warm("b", 0)
+
+	cases := []struct {
+		path  string
+		start units.NumBytes
+		size  units.NumBytes
+		want  bool
+	}{
+		{"a", 0, 100, true},
+		{"a", 99, 1, true},
+		{"a", 99, 2, false},
+		{"a", 100, 0, true},
+		{"b", 0, 0, true},
+		{"b", 0, 1, false},
+		{"c", 0, 0, false},
+	}
+
+	for _, c := range cases {
+		if got, want := rc.contains(c.path, c.start, c.size), c.want; got != want {
+			t.Errorf("contains(%s, %d, %d) = %t, want %t", c.path, c.start, c.size, got, want)
+		}
+	}
+
+	rc.drop()
+	if rc.contains("a", 0, 1) {
+		t.Errorf("contains(a, 0, 1) = true after drop, want false")
+	}
+}
+
+func TestReadCache_Pages(t *testing.T) {
+	rc := newReadCache()
+	rc.add("a", 100, 5000, 4*readCachePageSize)
+
+	cases := []struct {
+		path  string
+		start units.NumBytes
+		size  units.NumBytes
+		want  bool
+	}{
+		// Whole pages are cached, so data around what was read is too.
+		{"a", 0, 2 * readCachePageSize, true},
+		{"a", 0, 2*readCachePageSize + 1, false},
+		{"a", 0, 0, false},
+		{"b", 0, 1, false},
+	}
+
+	for _, c := range cases {
+		if got, want := rc.contains(c.path, c.start, c.size), c.want; got != want {
+			t.Errorf("contains(%s, %d, %d) = %t, want %t", c.path, c.start, c.size, got, want)
+		}
+	}
+	if got, want := rc.pageBytes(), 2*readCachePageSize; got != want {
+		t.Errorf("pageBytes() = %d, want %d", got, want)
+	}
+}
+
+func TestReadCache_Eviction(t *testing.T) {
+	cases := []struct {
+		lru  bool
+		want []string
+	}{
+		// Reading "a" again keeps it cached with LRU eviction, but not with FIFO.
+		{true, []string{"a", "c"}},
+		{false, []string{"b", "c"}},
+	}
+
+	for _, c := range cases {
+		rc := newReadCache()
+		rc.add("a", 0, 1, 2*readCachePageSize)
+		rc.add("b", 0, 1, 2*readCachePageSize)
+		if c.lru {
+			rc.use("a", 0, 1)
+		}
+		rc.add("c", 0, 1, 2*readCachePageSize)
+
+		var got []string
+		for _, path := range []string{"a", "b", "c"} {
+			if rc.contains(path, 0, 1) {
+				got = append(got, path)
+			}
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("with lru %t, cached files = %v, want %v", c.lru, got, c.want)
+		}
+	}
+}
+
+func TestReadCache_LargeRange(t *testing.T) {
+	rc := newReadCache()
+	rc.add("a", 0, units.Tebibyte, 2*readCachePageSize)
+	rc.use("a", 0, units.Tebibyte)
+
+	// Only the end of the range fits.
+	if got, want := rc.contains("a", units.Tebibyte-2*readCachePageSize, 2*readCachePageSize), true; got != want {
+		t.Errorf("contains(end of range) = %t, want %t", got, want)
+	}
+	if got, want := rc.contains("a", 0, units.Tebibyte), false; got != want {
+		t.Errorf("contains(whole range) = %t, want %t", got, want)
+	}
+}
+
+func TestReadCache_Evict(t *testing.T) {
+	rc := newReadCache()
+	rc.warm("a", 3*readCachePageSize)
+	rc.add("b", 0, 3*readCachePageSize, 8*readCachePageSize)
+	rc.evict("a", readCachePageSize, readCachePageSize)
+	rc.evict("b", readCachePageSize, units.MaxNumBytes-readCachePageSize)
+
+	cases := []struct {
+		path  string
+		start units.NumBytes
+		size  units.NumBytes
+		want  bool
+	}{
+		// Warmed data stays cached up to the start of what was evicted, and pages outside it stay.
+		{"a", 0, readCachePageSize, true},
+		{"a", readCachePageSize, 1, false},
+		{"a", 2 * readCachePageSize, 1, false},
+		{"b", 0, readCachePageSize, true},
+		{"b", readCachePageSize, 1, false},
+		{"b", 2 * readCachePageSize, 1, false},
+	}
+
+	for _, c := range cases {
+		if got, want := rc.contains(c.path, c.start, c.size), c.want; got != want {
+			t.Errorf("contains(%s, %d, %d) = %t, want %t", c.path, c.start, c.size, got, want)
+		}
+	}
+	if got, want := rc.pageBytes(), readCachePageSize; got != want {
+		t.Errorf("pageBytes() = %d, want %d", got, want)
+	}
+}
@@ -42,13 +42,13 @@ func newReadWriteQueue(dc *deviceContext) *readWriteQueue {
 
 func (rwq *readWriteQueue) push(data *requestData) {
 	req := data.req
-	reqByteEnd := req.Start + req.Size
+	reqByteEnd := units.NumBytesAdd(req.Start, req.Size)
 	var bestDiff units.NumBytes = math.MaxInt64
 	bestIdx := len(rwq.queue)
 	for i := len(rwq.queue) - 1; i >= 0; i-- {
 		otherReq := rwq.queue[i].req
 
-		otherReqByteEnd := otherReq.Start + otherReq.Size
+		otherReqByteEnd := units.NumBytesAdd(otherReq.Start, otherReq.Size)
 		if otherReq.Path == req.Path && req.Start >= otherReqByteEnd {
 			// Place after request other.
 			diff := req.Start - otherReqByteEnd
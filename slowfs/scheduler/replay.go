@@ -0,0 +1,106 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayedOp is an operation recorded in a trace, whose latency is to be replayed.
+type ReplayedOp struct {
+	Type    RequestType
+	Path    string
+	Latency time.Duration
+}
+
+// Replay assigns requests the latencies of previously recorded operations instead of modeling a
+// device, so that a particular pattern of latencies can be reproduced exactly. Each recorded
+// operation is used once, in the order they were recorded: a request takes the latency of the next
+// operation of its type on the same path, or failing that of the next operation of its type on any
+// path. It is safe for concurrent use, so one Replay can be shared by several schedulers.
+type Replay struct {
+	mu  sync.Mutex
+	ops []ReplayedOp
+	// Which ops have been used.
+	used []bool
+	// The indices of the ops of each type, and of each type on each path, in order, from which used
+	// ops are dropped lazily.
+	byType map[RequestType][]int
+	byPath map[replayKey][]int
+	// How many ops haven't been used yet.
+	remaining int
+}
+
+type replayKey struct {
+	op   RequestType
+	path string
+}
+
+// NewReplay returns a Replay of ops, in the order they were recorded.
+func NewReplay(ops []ReplayedOp) *Replay {
+	r := &Replay{
+		ops:       ops,
+		used:      make([]bool, len(ops)),
+		byType:    make(map[RequestType][]int),
+		byPath:    make(map[replayKey][]int),
+		remaining: len(ops),
+	}
+	for i, op := range ops {
+		r.byType[op.Type] = append(r.byType[op.Type], i)
+		key := replayKey{op.Type, op.Path}
+		r.byPath[key] = append(r.byPath[key], i)
+	}
+	return r
+}
+
+// next returns the latency of the recorded operation req takes, or false if there are no more
+// operations of its type, in which case it should be modeled as usual.
+func (r *Replay) next(req *Request) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := replayKey{req.Type, req.Path}
+	var i int
+	var ok bool
+	if r.byPath[key], i, ok = pop(r.byPath[key], r.used); !ok {
+		r.byType[req.Type], i, ok = pop(r.byType[req.Type], r.used)
+	}
+	if !ok {
+		return 0, false
+	}
+	r.used[i] = true
+	r.remaining--
+	return r.ops[i].Latency, true
+}
+
+// pop returns the first index in indices of an op which hasn't been used, and indices without it
+// and any before it.
+func pop(indices []int, used []bool) ([]int, int, bool) {
+	for len(indices) > 0 {
+		i := indices[0]
+		indices = indices[1:]
+		if !used[i] {
+			return indices, i, true
+		}
+	}
+	return indices, 0, false
+}
+
+// Remaining returns how many recorded operations haven't been replayed yet.
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remaining
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"slowfs/slowfs"
+	"testing"
+	"time"
+)
+
+func TestReplay_Next(t *testing.T) {
+	replay := NewReplay([]ReplayedOp{
+		{Type: ReadRequest, Path: "a", Latency: 1 * time.Millisecond},
+		{Type: ReadRequest, Path: "b", Latency: 2 * time.Millisecond},
+		{Type: WriteRequest, Path: "a", Latency: 3 * time.Millisecond},
+		{Type: ReadRequest, Path: "a", Latency: 4 * time.Millisecond},
+	})
+	cases := []struct {
+		req    Request
+		want   time.Duration
+		wantOk bool
+	}{
+		// Operations on the same path are replayed first, in order.
+		{Request{Type: ReadRequest, Path: "b"}, 2 * time.Millisecond, true},
+		{Request{Type: ReadRequest, Path: "b"}, 1 * time.Millisecond, true},
+		{Request{Type: ReadRequest, Path: "a"}, 4 * time.Millisecond, true},
+		{Request{Type: ReadRequest, Path: "a"}, 0, false},
+		{Request{Type: FsyncRequest, Path: "a"}, 0, false},
+		{Request{Type: WriteRequest, Path: "c"}, 3 * time.Millisecond, true},
+	}
+
+	for i, c := range cases {
+		if got, ok := replay.next(&c.req); got != c.want || ok != c.wantOk {
+			t.Errorf("%d: next(%s on %s) = %s, %t, want %s, %t", i, c.req.Type, c.req.Path, got, ok, c.want, c.wantOk)
+		}
+	}
+	if got := replay.Remaining(); got != 0 {
+		t.Errorf("Remaining() = %d, want 0", got)
+	}
+}
+
+func TestScheduler_Replay(t *testing.T) {
+	s := New(&slowfs.HDD7200RpmDeviceConfig)
+	s.SetReplay(NewReplay([]ReplayedOp{{Type: ReadRequest, Path: "a", Latency: 123 * time.Microsecond}}))
+
+	req := &Request{Type: ReadRequest, Timestamp: time.Now(), Path: "a", Size: 4096}
+	cost, err := s.ScheduleCost(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ScheduleCost() error: %s", err)
+	}
+	if got, want := cost, (Cost{Fixed: 123 * time.Microsecond}); got != want {
+		t.Errorf("ScheduleCost() = %+v, want %+v", got, want)
+	}
+
+	// Once the replay has run out, requests are modeled as usual.
+	req = &Request{Type: ReadRequest, Timestamp: time.Now(), Path: "a", Size: 4096}
+	if got := s.Schedule(req); got <= 123*time.Microsecond {
+		t.Errorf("Schedule() after the replay ran out = %s, want the modeled cost", got)
+	}
+}
@@ -15,7 +15,9 @@
 package scheduler
 
 import (
+	"fmt"
 	"slowfs/slowfs/units"
+	"strings"
 	"time"
 )
 
@@ -31,8 +33,140 @@ const (
 	FsyncRequest
 	AllocateRequest
 	MetadataRequest
+	// ReaddirRequest is a metadata request listing Size bytes of directory entries.
+	ReaddirRequest
+	// SetAttrRequest is a metadata request changing attributes, like chmod, chown and utimens.
+	SetAttrRequest
+	// FlushRequest is sent each time a file descriptor is closed, unlike CloseRequest which is sent
+	// once the file is no longer open at all.
+	FlushRequest
+	// TruncateRequest is a request shrinking a file to Start bytes, freeing the Size bytes after.
+	TruncateRequest
+	// ExtendRequest is a request growing a file from Start bytes by Size bytes.
+	ExtendRequest
+	// DirEntryRequest is a metadata request adding or removing an entry in the directory containing
+	// Path, like creating, linking or unlinking a file, which holds that directory's lock. Size is
+	// how many bytes it frees, when it unlinks the last link to a file.
+	DirEntryRequest
+	// FdatasyncRequest is like FsyncRequest, but only makes the file's data durable, not its
+	// metadata.
+	FdatasyncRequest
+	// PunchHoleRequest is a request deallocating the Size bytes at Start, leaving a hole in the file
+	// without changing its size, like fallocate with FALLOC_FL_PUNCH_HOLE.
+	PunchHoleRequest
+	// ZeroRangeRequest is a request zeroing the Size bytes at Start by allocating unwritten extents
+	// for them, like fallocate with FALLOC_FL_ZERO_RANGE.
+	ZeroRangeRequest
+	// JournalCommitRequest is the metadata part of an fsync of Path, sent to a separate metadata
+	// device to commit the journal there while the data part goes to the data device.
+	JournalCommitRequest
 )
 
+func (r RequestType) String() string {
+	switch r {
+	case ReadRequest:
+		return "ReadRequest"
+	case WriteRequest:
+		return "WriteRequest"
+	case OpenRequest:
+		return "OpenRequest"
+	case CloseRequest:
+		return "CloseRequest"
+	case FsyncRequest:
+		return "FsyncRequest"
+	case AllocateRequest:
+		return "AllocateRequest"
+	case MetadataRequest:
+		return "MetadataRequest"
+	case ReaddirRequest:
+		return "ReaddirRequest"
+	case SetAttrRequest:
+		return "SetAttrRequest"
+	case FlushRequest:
+		return "FlushRequest"
+	case TruncateRequest:
+		return "TruncateRequest"
+	case ExtendRequest:
+		return "ExtendRequest"
+	case DirEntryRequest:
+		return "DirEntryRequest"
+	case FdatasyncRequest:
+		return "FdatasyncRequest"
+	case PunchHoleRequest:
+		return "PunchHoleRequest"
+	case ZeroRangeRequest:
+		return "ZeroRangeRequest"
+	case JournalCommitRequest:
+		return "JournalCommitRequest"
+	default:
+		return "unknown request type"
+	}
+}
+
+// ParseRequestTypeFromString parses a request type, ignoring case and the "Request" suffix, so
+// that e.g. "read" and "ReadRequest" both give ReadRequest.
+func ParseRequestTypeFromString(s string) (RequestType, error) {
+	name := strings.TrimSuffix(strings.ToLower(s), "request")
+	for r := ReadRequest; r <= JournalCommitRequest; r++ {
+		if strings.TrimSuffix(strings.ToLower(r.String()), "request") == name {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown request type %s", s)
+}
+
+// IsMetadata returns whether requests of this type only touch metadata, not file data. Closing and
+// flushing count as data requests, since they affect data cached for the file.
+func (r RequestType) IsMetadata() bool {
+	switch r {
+	case MetadataRequest, ReaddirRequest, SetAttrRequest, DirEntryRequest, JournalCommitRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// Priority denotes a request's IO priority class, like ionice's, which decides which of the
+// requests waiting for the device it serves first.
+type Priority int
+
+// Enumeration of priority classes, from lowest to highest.
+const (
+	// IdlePriority requests are only served when no other requests are waiting.
+	IdlePriority Priority = iota - 1
+	// NormalPriority requests are served in the order they arrive. This is the default.
+	NormalPriority
+	// HighPriority requests are served before any others waiting.
+	HighPriority
+)
+
+func (p Priority) String() string {
+	switch p {
+	case IdlePriority:
+		return "idle"
+	case NormalPriority:
+		return "normal"
+	case HighPriority:
+		return "high"
+	default:
+		return "unknown priority"
+	}
+}
+
+// ParsePriorityFromString parses a priority class, ignoring case.
+func ParsePriorityFromString(s string) (Priority, error) {
+	switch strings.ToLower(s) {
+	case "idle":
+		return IdlePriority, nil
+	case "normal", "best-effort", "be":
+		return NormalPriority, nil
+	case "high", "realtime", "rt":
+		return HighPriority, nil
+	default:
+		return 0, fmt.Errorf("unknown priority %s", s)
+	}
+}
+
 // Request contains information for all types of requests.
 type Request struct {
 	Type      RequestType
@@ -40,4 +174,31 @@ type Request struct {
 	Path      string
 	Start     units.NumBytes
 	Size      units.NumBytes
+
+	// Entries is how many entries the directory the request scans has: the one listed by a
+	// ReaddirRequest, or the parent of the path looked up by a MetadataRequest or changed by a
+	// DirEntryRequest. Zero if unknown.
+	Entries int64
+
+	// Direct is set for writes which go straight to the device, bypassing the write back cache and
+	// paying its full cost whatever the WriteStrategy, like those to files opened with O_DIRECT or
+	// O_SYNC.
+	Direct bool
+
+	// Priority is the request's IO priority class. Requests jump ahead of those with a lower
+	// priority still waiting for the device, but not one it has started.
+	Priority Priority
+
+	// Whether this read hit marginal media and needs to be retried. This is decided once when the
+	// request is scheduled, so that its cost is consistent however many times it is computed.
+	needsRepair bool
+
+	// Latencies drawn for this request from the device's distributions, if it has any. Like
+	// needsRepair, these are decided once when the request is scheduled.
+	latencies *latencies
+}
+
+// latencies holds the durations drawn for a request from a device's latency distributions.
+type latencies struct {
+	seek, metadataOp, base time.Duration
 }
@@ -0,0 +1,101 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"testing"
+)
+
+func TestRequestType_IsMetadata(t *testing.T) {
+	cases := []struct {
+		requestType RequestType
+		want        bool
+	}{
+		{ReadRequest, false},
+		{WriteRequest, false},
+		{CloseRequest, false},
+		{FsyncRequest, false},
+		{FdatasyncRequest, false},
+		{FlushRequest, false},
+		{TruncateRequest, false},
+		{ExtendRequest, false},
+		{PunchHoleRequest, false},
+		{ZeroRangeRequest, false},
+		{MetadataRequest, true},
+		{ReaddirRequest, true},
+		{SetAttrRequest, true},
+		{DirEntryRequest, true},
+		{JournalCommitRequest, true},
+	}
+
+	for _, c := range cases {
+		if got, want := c.requestType.IsMetadata(), c.want; got != want {
+			t.Errorf("%s.IsMetadata() = %t, want %t", c.requestType, got, want)
+		}
+	}
+}
+
+func TestParseRequestTypeFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      RequestType
+		shouldErr bool
+	}{
+		{"ReadRequest", ReadRequest, false},
+		{"read", ReadRequest, false},
+		{"FSYNC", FsyncRequest, false},
+		{"setattr", SetAttrRequest, false},
+		{"flushrequest", FlushRequest, false},
+		{"truncate", TruncateRequest, false},
+		{"ExtendRequest", ExtendRequest, false},
+		{"direntry", DirEntryRequest, false},
+		{"fdatasync", FdatasyncRequest, false},
+		{"punchhole", PunchHoleRequest, false},
+		{"ZeroRangeRequest", ZeroRangeRequest, false},
+		{"journalcommit", JournalCommitRequest, false},
+		{"request", 0, true},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRequestTypeFromString(c.s)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParseRequestTypeFromString(%s) = %s, %v, want %s, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
+
+func TestParsePriorityFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      Priority
+		shouldErr bool
+	}{
+		{"idle", IdlePriority, false},
+		{"Normal", NormalPriority, false},
+		{"best-effort", NormalPriority, false},
+		{"HIGH", HighPriority, false},
+		{"rt", HighPriority, false},
+		{"", 0, true},
+		{"urgent", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParsePriorityFromString(c.s)
+		if got != c.want || c.shouldErr != (err != nil) {
+			t.Errorf("ParsePriorityFromString(%s) = %s, %v, want %s, error %t", c.s, got, err, c.want, c.shouldErr)
+		}
+	}
+}
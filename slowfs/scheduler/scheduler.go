@@ -17,7 +17,12 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,7 +30,37 @@ import (
 type Scheduler struct {
 	dc             *deviceContext
 	readWriteQueue *readWriteQueue
+	priorityQueue  *priorityQueue
 	requests       chan *requestData
+
+	// Functions to run on the scheduler goroutine, so that they can safely access its state.
+	calls chan func()
+
+	hooksMu sync.RWMutex
+	hooks   []ScheduleHook
+
+	// If set, requests take recorded latencies instead of being modeled, while there are any.
+	replay *Replay
+
+	// What time it is, for requests made without a timestamp, like stalls, and for deciding when
+	// queued reads and writes are served. If it is a VirtualClock, virtual is set.
+	clock   Clock
+	virtual bool
+
+	// Counts of requests waiting to be scheduled, and scheduled but not yet completed. These are
+	// accessed atomically.
+	queued   int64
+	inFlight int64
+}
+
+// QueueStats describes how many requests the scheduler currently has outstanding.
+type QueueStats struct {
+	// Queued is how many requests are waiting for the scheduler to decide how long they take.
+	Queued int64
+
+	// InFlight is how many requests have been scheduled but have not yet reached their completion
+	// time.
+	InFlight int64
 }
 
 // New creates a new Scheduler using the given DeviceConfig to help compute how long requests
@@ -35,7 +70,10 @@ func New(config *slowfs.DeviceConfig) *Scheduler {
 	scheduler := &Scheduler{
 		dc:             dc,
 		readWriteQueue: newReadWriteQueue(dc),
+		priorityQueue:  newPriorityQueue(dc),
 		requests:       make(chan *requestData, 10),
+		calls:          make(chan func()),
+		clock:          realClock{},
 	}
 	go scheduler.serveRequests()
 	return scheduler
@@ -43,15 +81,200 @@ func New(config *slowfs.DeviceConfig) *Scheduler {
 
 type requestData struct {
 	req             *Request
-	responseChannel chan time.Duration
+	responseChannel chan Cost
 }
 
 // Schedule schedules a new request and returns how long the request should take.
 // N.B. this can block.
 func (s *Scheduler) Schedule(req *Request) time.Duration {
-	ch := make(chan time.Duration, 1)
-	s.requests <- &requestData{req, ch}
-	return <-ch
+	d, _ := s.ScheduleContext(context.Background(), req)
+	return d
+}
+
+// ScheduleContext is like Schedule, but gives up waiting for the scheduler to accept the request
+// once ctx is done, returning ctx's error. Once the request has been accepted, the device has
+// started on it, so it is costed as usual even if ctx is done before the cost is known.
+func (s *Scheduler) ScheduleContext(ctx context.Context, req *Request) (time.Duration, error) {
+	cost, err := s.ScheduleCost(ctx, req)
+	return cost.Total(), err
+}
+
+// ScheduleCost is like ScheduleContext, but returns the breakdown of how long the request should
+// take.
+func (s *Scheduler) ScheduleCost(ctx context.Context, req *Request) (Cost, error) {
+	if err := ctx.Err(); err != nil {
+		return Cost{}, err
+	}
+
+	var cost Cost
+	var queue QueueStats
+	if latency, ok := s.replayed(req); ok {
+		// Replayed requests don't touch the device, so there's nothing to queue for.
+		cost.Fixed = latency
+		queue = s.QueueStats()
+	} else {
+		ch := make(chan Cost, 1)
+		atomic.AddInt64(&s.queued, 1)
+		select {
+		case s.requests <- &requestData{req, ch}:
+		case <-ctx.Done():
+			atomic.AddInt64(&s.queued, -1)
+			return Cost{}, ctx.Err()
+		}
+		cost = <-ch
+		atomic.AddInt64(&s.queued, -1)
+		queue = s.QueueStats()
+	}
+
+	// Simulated time doesn't pass while the request is in flight, so it completes straight away.
+	if !s.virtual {
+		atomic.AddInt64(&s.inFlight, 1)
+		time.AfterFunc(req.Timestamp.Add(cost.Total()).Sub(time.Now()), func() {
+			atomic.AddInt64(&s.inFlight, -1)
+		})
+	}
+
+	s.runScheduleHooks(&ScheduledRequest{Request: req, Cost: cost, Queue: queue})
+	return cost, nil
+}
+
+// SetSeed makes the scheduler's random choices, like which reads need repairing, the latencies drawn
+// from the device's distributions and which files are written back first, follow seed, so that
+// scheduling the same requests in the same order gives the same costs.
+func (s *Scheduler) SetSeed(seed int64) {
+	s.call(func() {
+		s.dc.random.Seed(seed)
+	})
+}
+
+// SetClock makes the scheduler tell the time with clock, instead of real time, which callers should
+// also timestamp requests with. With a VirtualClock, queued reads and writes are served as soon as
+// they can be, rather than waiting for others which could be reordered ahead of them. This must be
+// called before any requests are scheduled.
+func (s *Scheduler) SetClock(clock Clock) {
+	s.clock = clock
+	_, s.virtual = clock.(*VirtualClock)
+}
+
+// SetReplay makes requests take the latencies of the operations recorded in replay, instead of
+// modeling the device, until it has none left of their type. This must be called before any
+// requests are scheduled.
+func (s *Scheduler) SetReplay(replay *Replay) {
+	s.replay = replay
+}
+
+func (s *Scheduler) replayed(req *Request) (time.Duration, bool) {
+	if s.replay == nil {
+		return 0, false
+	}
+	return s.replay.next(req)
+}
+
+// QueueStats returns how many requests are currently queued and in flight. This can be used to
+// check whether an application generates enough concurrency to benefit from a deeper device queue.
+func (s *Scheduler) QueueStats() QueueStats {
+	return QueueStats{
+		Queued:   atomic.LoadInt64(&s.queued),
+		InFlight: atomic.LoadInt64(&s.inFlight),
+	}
+}
+
+// call runs f on the scheduler goroutine and waits for it to finish.
+func (s *Scheduler) call(f func()) {
+	done := make(chan struct{})
+	s.calls <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// DropCaches discards the device's simulated clean cached state, so that following requests
+// behave as if the device were cold. Like the kernel's drop_caches, this doesn't affect dirty data
+// waiting to be written back.
+func (s *Scheduler) DropCaches() {
+	s.call(s.dc.dropCaches)
+}
+
+// WarmCache marks the first numBytes of the file at path as cached in memory, so that reading them
+// doesn't touch the device until the cache is dropped.
+func (s *Scheduler) WarmCache(path string, numBytes units.NumBytes) {
+	s.call(func() {
+		s.dc.readCache.warm(path, numBytes)
+	})
+}
+
+// UnreclaimedBytes returns how many bytes freed by unlinking files the device hasn't made free
+// again yet.
+func (s *Scheduler) UnreclaimedBytes() units.NumBytes {
+	var unreclaimed units.NumBytes
+	s.call(func() {
+		unreclaimed = s.dc.unreclaimedBytes(s.clock.Now())
+	})
+	return unreclaimed
+}
+
+// Stall makes the device busy for d from now, on top of any work it already has, as if it had
+// stopped responding. Requests arriving meanwhile queue up behind the stall.
+func (s *Scheduler) Stall(d time.Duration) {
+	s.call(func() {
+		s.dc.stall(s.clock.Now(), d)
+	})
+}
+
+// StallUplink stops a cloud gateway uploading for d from now, on top of any stall already in
+// progress, as if its connection to the cloud had dropped. Writes keep landing on the device
+// meanwhile, so the upload backlog grows.
+func (s *Scheduler) StallUplink(d time.Duration) error {
+	var err error
+	s.call(func() {
+		if s.dc.uplink == nil {
+			err = errors.New("device has no uplink, since UploadBytesPerSecond isn't set")
+			return
+		}
+		s.dc.uplink.stall(s.clock.Now(), d)
+	})
+	return err
+}
+
+// Config returns a copy of the config the scheduler is simulating.
+func (s *Scheduler) Config() slowfs.DeviceConfig {
+	var config slowfs.DeviceConfig
+	s.call(func() {
+		config = *s.dc.deviceConfig
+	})
+	return config
+}
+
+// UpdateConfig changes the simulated device while it is running. update is called with a copy of
+// the current config, and the copy is used from then on if update succeeds and the result is
+// valid.
+func (s *Scheduler) UpdateConfig(update func(config *slowfs.DeviceConfig) error) error {
+	var err error
+	s.call(func() {
+		config := *s.dc.deviceConfig
+		if err = update(&config); err != nil {
+			return
+		}
+		if err = config.Validate(); err != nil {
+			return
+		}
+		s.dc.setConfig(&config, s.clock.Now())
+	})
+	return err
+}
+
+// endOfTime is later than any request is ready.
+var endOfTime = time.Unix(1<<62, 0)
+
+// queueTime returns the time by which the read/write queue decides which requests are ready. A
+// virtual clock stands still while requests wait there, so rather than wait in real time for it to
+// pass their cutoff, every request is ready at once.
+func (s *Scheduler) queueTime() time.Time {
+	if s.virtual {
+		return endOfTime
+	}
+	return time.Now()
 }
 
 // Main event loop to serve requests.
@@ -59,24 +282,49 @@ func (s *Scheduler) serveRequests() {
 	for {
 		select {
 		case reqData := <-s.requests:
-			req, resp := reqData.req, reqData.responseChannel
+			req := reqData.req
+			req.latencies = s.dc.rollLatencies()
 			switch req.Type {
-			case ReadRequest, WriteRequest:
+			case ReadRequest:
+				req.needsRepair = s.dc.rollReadRepair()
+				s.readWriteQueue.push(reqData)
+			case WriteRequest:
 				s.readWriteQueue.push(reqData)
 			default:
-				resp <- s.dc.computeTime(req)
-				s.dc.execute(req)
+				s.dispatch(reqData)
 			}
+		case f := <-s.calls:
+			f()
 		case <-s.readWriteQueue.responseChannel():
-			reqData := s.readWriteQueue.pop(time.Now())
+			reqData := s.readWriteQueue.pop(s.queueTime())
 			if reqData != nil {
-				reqData.responseChannel <- s.dc.computeTime(reqData.req)
-				s.dc.execute(reqData.req)
+				s.dispatch(reqData)
+			}
+		case <-s.priorityQueue.responseChannel():
+			for reqData := s.priorityQueue.pop(s.queueTime()); reqData != nil; reqData = s.priorityQueue.pop(s.queueTime()) {
+				s.serve(reqData)
 			}
 		}
 
 		// This needs to be called every loop, since executing a request can change how long a
-		// read or write request on the front of the queue would take.
-		s.readWriteQueue.scheduleResponse(time.Now())
+		// read or write request on the front of the queue would take, and when the device is free.
+		s.readWriteQueue.scheduleResponse(s.queueTime())
+		s.priorityQueue.scheduleResponse(s.queueTime())
 	}
 }
+
+// dispatch serves a request, unless it has to wait for higher priority requests first. A virtual
+// clock stands still while requests wait, so with one, requests never wait for priority.
+func (s *Scheduler) dispatch(reqData *requestData) {
+	if s.priorityQueue.holds(reqData.req, s.queueTime()) {
+		s.priorityQueue.push(reqData)
+		return
+	}
+	s.serve(reqData)
+}
+
+// serve costs a request and executes it on the device.
+func (s *Scheduler) serve(reqData *requestData) {
+	reqData.responseChannel <- s.dc.computeCost(reqData.req)
+	s.dc.execute(reqData.req)
+}
@@ -58,6 +58,19 @@ var writeBackCacheDeviceConfig = &slowfs.DeviceConfig{
 	MetadataOpTime:         80 * time.Millisecond,
 }
 
+var readWriteBackCacheDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	ReadWriteBackCache:     true,
+}
+
 var readWriteAsymmetricDeviceConfig = &slowfs.DeviceConfig{
 	SeekWindow:             4 * units.Byte,
 	SeekTime:               10 * time.Millisecond,
@@ -81,3 +94,223 @@ var notNiceNumbersDeviceConfig = &slowfs.DeviceConfig{
 	WriteStrategy:          slowfs.SimulateWrite,
 	MetadataOpTime:         80 * time.Millisecond,
 }
+
+var readRepairDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	ReadRepairProbability:  1,
+	ReadRepairSeeks:        3,
+}
+
+var metadataThroughputDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	MetadataBytesPerSecond: 1000 * units.Byte,
+}
+
+var journaledMetadataDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	MetadataStrategy:       slowfs.JournaledMetadata,
+	MetadataCommitInterval: 5 * time.Second,
+}
+
+var flushOnCloseDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	FlushOnClose:           true,
+}
+
+var dualActuatorDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	Actuators:              2,
+}
+
+var resizeDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	FreeBytesPerSecond:     10000 * units.Byte,
+	ZeroFillBytesPerSecond: 100 * units.Byte,
+}
+
+var directoryLockDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	DirectoryLockTime:      100 * time.Millisecond,
+}
+
+var reclaimDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	FreeBytesPerSecond:     10000 * units.Byte,
+	ReclaimBytesPerSecond:  1000 * units.Byte,
+}
+
+var retentionDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	ReclaimBytesPerSecond:  1000 * units.Byte,
+	DeletedRetention:       time.Hour,
+}
+
+var uploadDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	UploadBytesPerSecond:   10 * units.Byte,
+	FsyncWaitsForUpload:    true,
+	CloseWaitsForUpload:    true,
+}
+
+var networkDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	NetworkLatency:         time.Millisecond,
+	NetworkBytesPerSecond:  1000 * units.Byte,
+}
+
+var fsyncGroupDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	FsyncGroupWindow:       5 * time.Millisecond,
+}
+
+var randomThroughputDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:                4 * units.Byte,
+	SeekTime:                  10 * time.Millisecond,
+	ReadBytesPerSecond:        100 * units.Byte,
+	WriteBytesPerSecond:       100 * units.Byte,
+	AllocateBytesPerSecond:    1000 * units.Byte,
+	RequestReorderMaxDelay:    10 * time.Millisecond,
+	FsyncStrategy:             slowfs.NoFsync,
+	WriteStrategy:             slowfs.SimulateWrite,
+	MetadataOpTime:            10 * time.Millisecond,
+	RandomReadBytesPerSecond:  10 * units.Byte,
+	RandomWriteBytesPerSecond: 20 * units.Byte,
+}
+
+var queueDepthDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	NetworkLatency:         time.Millisecond,
+	QueueDepth:             2,
+}
+
+var readCacheDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	ReadCacheBytes:         8 * units.Kibibyte,
+	ReadCacheHitTime:       time.Millisecond,
+}
+
+var journalDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	JournalCommitTime:      5 * time.Millisecond,
+	FsyncFlushesAllData:    true,
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestScheduler_ScheduleHooks(t *testing.T) {
+	s := New(basicDeviceConfig)
+
+	var scheduled []*ScheduledRequest
+	s.AddScheduleHook(func(c *ScheduledRequest) {
+		scheduled = append(scheduled, c)
+	})
+
+	req := &Request{
+		Type:      MetadataRequest,
+		Timestamp: time.Now(),
+	}
+	if got, want := s.Schedule(req), 80*time.Millisecond; got != want {
+		t.Errorf("Schedule(%+v) = %s, want %s", req, got, want)
+	}
+
+	if got, want := len(scheduled), 1; got != want {
+		t.Fatalf("got %d scheduled requests, want %d", got, want)
+	}
+	if got, want := scheduled[0].Request, req; got != want {
+		t.Errorf("scheduled request = %+v, want %+v", got, want)
+	}
+	if got, want := scheduled[0].Cost, (Cost{Fixed: 80 * time.Millisecond}); got != want {
+		t.Errorf("scheduled cost = %+v, want %+v", got, want)
+	}
+	if got, want := scheduled[0].Queue, (QueueStats{}); got != want {
+		t.Errorf("scheduled queue = %+v, want %+v", got, want)
+	}
+}
+
+func TestScheduler_QueueStats(t *testing.T) {
+	s := New(basicDeviceConfig)
+
+	if got, want := s.QueueStats(), (QueueStats{}); got != want {
+		t.Errorf("QueueStats() before scheduling = %+v, want %+v", got, want)
+	}
+
+	s.Schedule(&Request{
+		Type:      MetadataRequest,
+		Timestamp: time.Now(),
+	})
+	if got, want := s.QueueStats(), (QueueStats{InFlight: 1}); got != want {
+		t.Errorf("QueueStats() after scheduling = %+v, want %+v", got, want)
+	}
+
+	// The request takes 80ms, so it should have completed well before this.
+	time.Sleep(200 * time.Millisecond)
+	if got, want := s.QueueStats(), (QueueStats{}); got != want {
+		t.Errorf("QueueStats() after completion = %+v, want %+v", got, want)
+	}
+}
+
+func TestScheduler_ScheduleContext(t *testing.T) {
+	s := New(basicDeviceConfig)
+
+	req := &Request{
+		Type:      MetadataRequest,
+		Timestamp: time.Now(),
+	}
+	if got, err := s.ScheduleContext(context.Background(), req); got != 80*time.Millisecond || err != nil {
+		t.Errorf("ScheduleContext(%+v) = %s, %v, want %s, <nil>", req, got, err, 80*time.Millisecond)
+	}
+
+	// A request given up on before the scheduler accepts it doesn't keep the device busy.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req = &Request{
+		Type:      MetadataRequest,
+		Timestamp: time.Now(),
+	}
+	if got, err := s.ScheduleContext(ctx, req); got != 0 || err != context.Canceled {
+		t.Errorf("ScheduleContext(%+v) after cancelling = %s, %v, want 0s, %v", req, got, err, context.Canceled)
+	}
+	if got, want := s.QueueStats(), (QueueStats{InFlight: 1}); got != want {
+		t.Errorf("QueueStats() after cancelling = %+v, want %+v", got, want)
+	}
+}
+
+func TestScheduler_Stall(t *testing.T) {
+	s := New(basicDeviceConfig)
+	s.Stall(500 * time.Millisecond)
+
+	// The request has to wait for whatever remains of the stall, which is nearly all of it.
+	got := s.Schedule(&Request{
+		Type:      MetadataRequest,
+		Timestamp: time.Now(),
+	})
+	if min, max := 570*time.Millisecond, 580*time.Millisecond; got < min || got > max {
+		t.Errorf("Schedule() after stalling = %s, want between %s and %s", got, min, max)
+	}
+}
+
+func TestScheduler_StallUplink(t *testing.T) {
+	if err := New(basicDeviceConfig).StallUplink(time.Second); err == nil {
+		t.Errorf("StallUplink() without an uplink = <nil>, want an error")
+	}
+
+	s := New(uploadDeviceConfig)
+	if err := s.StallUplink(time.Second); err != nil {
+		t.Fatalf("StallUplink() = %s", err)
+	}
+	// Nothing is uploaded for a second, then 10 bytes take another second.
+	now := time.Now()
+	s.Schedule(&Request{Type: WriteRequest, Timestamp: now, Path: "a", Start: 0, Size: 10})
+	got := s.Schedule(&Request{Type: FsyncRequest, Timestamp: now, Path: "a"})
+	if min, max := 1990*time.Millisecond, 2*time.Second; got < min || got > max {
+		t.Errorf("fsync after stalling the uplink took %s, want between %s and %s", got, min, max)
+	}
+}
+
+func TestScheduler_Priority(t *testing.T) {
+	s := New(basicDeviceConfig)
+
+	// Each request takes 80ms. The idle request arrives while the device is busy, so it waits to be
+	// costed, and the high priority request arriving after it goes first and really delays it.
+	now := time.Now()
+	s.Schedule(&Request{Type: MetadataRequest, Timestamp: now})
+	idle := make(chan time.Duration)
+	go func() {
+		idle <- s.Schedule(&Request{Type: MetadataRequest, Timestamp: now, Priority: IdlePriority})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	high := s.Schedule(&Request{Type: MetadataRequest, Timestamp: now.Add(20 * time.Millisecond), Priority: HighPriority})
+	if got, want := high, 140*time.Millisecond; got != want {
+		t.Errorf("high priority request took %s, want %s", got, want)
+	}
+	if got, want := <-idle, 240*time.Millisecond; got != want {
+		t.Errorf("idle request took %s, want %s", got, want)
+	}
+}
+
+func TestScheduler_VirtualClock(t *testing.T) {
+	clock := NewVirtualClock(startTime)
+	s := New(basicDeviceConfig)
+	s.SetClock(clock)
+
+	// Stalls are measured from simulated time, which hasn't moved.
+	s.Stall(500 * time.Millisecond)
+	if got, want := s.Schedule(&Request{Type: MetadataRequest, Timestamp: clock.Now()}), 580*time.Millisecond; got != want {
+		t.Errorf("Schedule() after stalling = %s, want %s", got, want)
+	}
+
+	// Reads are served without waiting in real time for others to reorder ahead of them, though
+	// each takes over a second.
+	began := time.Now()
+	for i := 0; i < 3; i++ {
+		s.Schedule(&Request{Type: ReadRequest, Timestamp: clock.Now(), Path: "a", Start: units.NumBytes(i) * 100, Size: 100})
+	}
+	if got, max := time.Since(began), 500*time.Millisecond; got > max {
+		t.Errorf("scheduling reads took %s, want at most %s", got, max)
+	}
+	if got, want := s.QueueStats(), (QueueStats{}); got != want {
+		t.Errorf("QueueStats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestScheduler_UpdateConfig(t *testing.T) {
+	s := New(basicDeviceConfig)
+
+	if err := s.UpdateConfig(func(config *slowfs.DeviceConfig) error {
+		return config.SetField("MetadataOpTime", "40ms")
+	}); err != nil {
+		t.Fatalf("UpdateConfig() = %s", err)
+	}
+	if got, want := s.Config().MetadataOpTime, 40*time.Millisecond; got != want {
+		t.Errorf("MetadataOpTime after update = %s, want %s", got, want)
+	}
+	if got, want := basicDeviceConfig.MetadataOpTime, 80*time.Millisecond; got != want {
+		t.Errorf("original MetadataOpTime after update = %s, want %s", got, want)
+	}
+	req := &Request{
+		Type:      MetadataRequest,
+		Timestamp: time.Now(),
+	}
+	if got, want := s.Schedule(req), 40*time.Millisecond; got != want {
+		t.Errorf("Schedule(%+v) = %s, want %s", req, got, want)
+	}
+
+	// Invalid configs are rejected, leaving the config as it was.
+	if err := s.UpdateConfig(func(config *slowfs.DeviceConfig) error {
+		return config.SetField("SeekTime", "-1s")
+	}); err == nil {
+		t.Errorf("UpdateConfig() with negative SeekTime = nil, want error")
+	}
+	if got, want := s.Config().SeekTime, 10*time.Millisecond; got != want {
+		t.Errorf("SeekTime after failed update = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"time"
+)
+
+// SpareTime is an interval during which the device, or one of its actuators, had nothing to do.
+type SpareTime struct {
+	Start, End time.Time
+}
+
+// Duration returns how long the interval is.
+func (s SpareTime) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// SpareTimeConsumer is offered spare time on the device, and returns how much of it, from its
+// start, it used, e.g. for tiering, scrubbing or other background work, which then isn't available
+// to consumers after it. Like writing back cached data, which has first call on spare time, the
+// work doesn't hold up requests. Spare time is only known about once the next request arrives, so
+// it is offered after the fact.
+//
+// Consumers are called on the scheduler's goroutine, so they hold up every request on the device
+// while they run, and mustn't call the scheduler.
+type SpareTimeConsumer func(spare SpareTime) time.Duration
+
+// AddSpareTimeConsumer registers a consumer to be offered spare time after those already added.
+// This may be called while the scheduler is serving requests.
+func (s *Scheduler) AddSpareTimeConsumer(consumer SpareTimeConsumer) {
+	s.call(func() {
+		s.dc.spareTimeConsumers = append(s.dc.spareTimeConsumers, consumer)
+	})
+}
+
+// IdleSince returns when the device last finished the requests it has been given, or the zero time
+// if it is still busy with them at now, or hasn't been given any.
+func (s *Scheduler) IdleSince(now time.Time) time.Time {
+	var since time.Time
+	s.call(func() {
+		since = s.dc.idleSince(now)
+	})
+	return since
+}
+
+// offerSpareTime offers spare to each consumer in turn, until it has been used up.
+func (dc *deviceContext) offerSpareTime(spare SpareTime) {
+	for _, consumer := range dc.spareTimeConsumers {
+		if !spare.End.After(spare.Start) {
+			return
+		}
+		if used := consumer(spare); used > 0 {
+			spare.Start = spare.Start.Add(used)
+		}
+	}
+}
+
+// idleSince returns when every actuator became free, or the zero time if any is busy at now.
+func (dc *deviceContext) idleSince(now time.Time) time.Time {
+	var since time.Time
+	for i := range dc.actuators {
+		busyUntil := dc.actuators[i].busyUntil
+		if busyUntil.After(now) {
+			return time.Time{}
+		}
+		since = latestTime(since, busyUntil)
+	}
+	return since
+}
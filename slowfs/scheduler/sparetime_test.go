@@ -0,0 +1,77 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"testing"
+	"time"
+)
+
+func TestScheduler_SpareTimeConsumers(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	config.FsyncStrategy = slowfs.NoFsync
+	s := New(&config)
+
+	// Consumers are called on the scheduler's goroutine.
+	offered := make(chan SpareTime, 10)
+	s.AddSpareTimeConsumer(func(spare SpareTime) time.Duration {
+		offered <- spare
+		return 100 * time.Millisecond
+	})
+	s.AddSpareTimeConsumer(func(spare SpareTime) time.Duration {
+		offered <- spare
+		return 0
+	})
+
+	start := time.Unix(1500000000, 0)
+	if got := s.IdleSince(start); !got.IsZero() {
+		t.Errorf("IdleSince() before any requests = %s, want zero", got)
+	}
+	busy := s.Schedule(&Request{Type: ReadRequest, Timestamp: start, Path: "a", Size: 4096})
+	idle := start.Add(busy)
+	if got := s.IdleSince(start); !got.IsZero() {
+		t.Errorf("IdleSince() while busy = %s, want zero", got)
+	}
+	if got, want := s.IdleSince(idle.Add(time.Second)), idle; !got.Equal(want) {
+		t.Errorf("IdleSince() after the read = %s, want %s", got, want)
+	}
+
+	next := idle.Add(time.Second)
+	s.Schedule(&Request{Type: ReadRequest, Timestamp: next, Path: "b", Size: 4096})
+	want := []SpareTime{
+		{Start: idle, End: next},
+		// The second consumer is offered what the first left.
+		{Start: idle.Add(100 * time.Millisecond), End: next},
+	}
+	for i := range want {
+		select {
+		case got := <-offered:
+			if !got.Start.Equal(want[i].Start) || !got.End.Equal(want[i].End) {
+				t.Errorf("offer %d = %v, want %v", i, got, want[i])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("offer %d never made, want %v", i, want[i])
+		}
+	}
+	// Offers are made as each request is executed, so this one has been by the time the scheduler
+	// answers.
+	s.IdleSince(next)
+	select {
+	case got := <-offered:
+		t.Errorf("unexpected offer %v", got)
+	default:
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"sort"
+	"time"
+)
+
+// State is a snapshot of the simulated device's internal state, so that tests can assert on how
+// the model changes in response to requests, rather than only on how long requests take. Fields
+// may be added, but their meaning won't change.
+type State struct {
+	// Queue is how many requests are outstanding.
+	Queue QueueStats
+
+	// DeviceQueue is how many requests are in the device's queue, which QueueDepth limits, and
+	// QueueWaiting how many more are waiting for a slot in it.
+	DeviceQueue  int
+	QueueWaiting int
+
+	// Actuators is the state of each of the device's actuators. Most devices have one.
+	Actuators []ActuatorState
+
+	// UnwrittenBytes is how many bytes of each open file are waiting in the write back cache.
+	UnwrittenBytes map[string]units.NumBytes
+
+	// OrphanedUnwrittenBytes is how many bytes of closed files are waiting in the write back cache.
+	OrphanedUnwrittenBytes units.NumBytes
+
+	// CachedBytes is how many bytes from the start of each file have been warmed into the read
+	// cache.
+	CachedBytes map[string]units.NumBytes
+
+	// ReadCacheBytes is how many bytes reads have cached, which ReadCacheBytes in the config limits.
+	ReadCacheBytes units.NumBytes
+
+	// UncommittedMetadata is the paths whose attribute changes haven't been committed to the journal
+	// yet, in sorted order.
+	UncommittedMetadata []string
+
+	// UnreclaimedBytes is how many bytes freed by unlinking files aren't free again yet.
+	UnreclaimedBytes units.NumBytes
+
+	// UploadBacklog is how many bytes of each file a cloud gateway has yet to upload.
+	UploadBacklog map[string]units.NumBytes
+}
+
+// ActuatorState is the state of one actuator.
+type ActuatorState struct {
+	// LastAccessedFile and FirstUnseenByte are where the heads are: just after the last byte read or
+	// written. Accesses elsewhere seek.
+	LastAccessedFile string
+	FirstUnseenByte  units.NumBytes
+
+	// BusyUntil is when the actuator finishes the requests it has been given.
+	BusyUntil time.Time
+}
+
+// State returns a snapshot of the simulated device's internal state.
+func (s *Scheduler) State() State {
+	var state State
+	s.call(func() {
+		state = s.dc.state(s.clock.Now())
+	})
+	state.Queue = s.QueueStats()
+	return state
+}
+
+// state returns a snapshot of the context's state at time t.
+func (dc *deviceContext) state(t time.Time) State {
+	state := State{
+		UnwrittenBytes:   make(map[string]units.NumBytes),
+		CachedBytes:      make(map[string]units.NumBytes),
+		UnreclaimedBytes: dc.unreclaimedBytes(t),
+		UploadBacklog:    make(map[string]units.NumBytes),
+	}
+	state.DeviceQueue = len(dc.outstandingAt(t))
+	if depth := dc.deviceConfig.QueueDepth; depth > 0 && state.DeviceQueue > depth {
+		state.DeviceQueue, state.QueueWaiting = depth, state.DeviceQueue-depth
+	}
+	for _, a := range dc.actuators {
+		state.Actuators = append(state.Actuators, ActuatorState{
+			LastAccessedFile: a.lastAccessedFile,
+			FirstUnseenByte:  a.firstUnseenByte,
+			BusyUntil:        a.busyUntil,
+		})
+	}
+	if dc.writeBackCache != nil {
+		for path, n := range dc.writeBackCache.unwrittenBytes {
+			state.UnwrittenBytes[path] = n
+		}
+		state.OrphanedUnwrittenBytes = dc.writeBackCache.orphanedUnwrittenBytes
+	}
+	if dc.uplink != nil {
+		state.UploadBacklog = dc.uplink.backlogBytes(t)
+	}
+	state.ReadCacheBytes = dc.readCache.pageBytes()
+	for path, n := range dc.readCache.cachedBytes {
+		state.CachedBytes[path] = n
+	}
+	for path := range dc.uncommittedMetadata {
+		state.UncommittedMetadata = append(state.UncommittedMetadata, path)
+	}
+	sort.Strings(state.UncommittedMetadata)
+	return state
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"reflect"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestScheduler_State(t *testing.T) {
+	s := New(writeBackCacheDeviceConfig)
+	s.Schedule(&Request{Type: WriteRequest, Timestamp: time.Now(), Path: "a", Start: 0, Size: 100})
+	s.WarmCache("b", 10)
+
+	state := s.State()
+	if got, want := state.UnwrittenBytes, map[string]units.NumBytes{"a": 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("State().UnwrittenBytes = %v, want %v", got, want)
+	}
+	if got, want := state.CachedBytes, map[string]units.NumBytes{"b": 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("State().CachedBytes = %v, want %v", got, want)
+	}
+	if got, want := len(state.Actuators), 1; got != want {
+		t.Errorf("len(State().Actuators) = %d, want %d", got, want)
+	}
+}
+
+func TestDeviceContext_State(t *testing.T) {
+	dc := newDeviceContext(journaledMetadataDeviceConfig)
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 50})
+	dc.execute(&Request{Type: SetAttrRequest, Timestamp: startTime, Path: "c"})
+	dc.execute(&Request{Type: SetAttrRequest, Timestamp: startTime, Path: "b"})
+
+	want := State{
+		// The attribute changes wait for the read, so all three are still in the queue.
+		DeviceQueue: 3,
+		Actuators: []ActuatorState{{
+			LastAccessedFile: "a",
+			FirstUnseenByte:  50,
+			// 10ms seeking and 500ms reading.
+			BusyUntil: startTime.Add(510 * time.Millisecond),
+		}},
+		UnwrittenBytes:      map[string]units.NumBytes{},
+		CachedBytes:         map[string]units.NumBytes{},
+		UncommittedMetadata: []string{"b", "c"},
+		UploadBacklog:       map[string]units.NumBytes{},
+	}
+	if got := dc.state(startTime); !reflect.DeepEqual(got, want) {
+		t.Errorf("state() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// uplink records data written to a cloud gateway which hasn't been uploaded to the cloud yet. Data
+// is uploaded in the order it was written, at the configured rate, whatever the device is doing.
+type uplink struct {
+	// Data waiting to be uploaded, oldest first.
+	backlog []pendingUpload
+
+	// When the backlog was last brought up to date.
+	uploadedAt time.Time
+
+	// Nothing is uploaded until this time.
+	stalledUntil time.Time
+
+	deviceConfig *slowfs.DeviceConfig
+}
+
+// pendingUpload is written data waiting to be uploaded.
+type pendingUpload struct {
+	path string
+	size units.NumBytes
+}
+
+func newUplink(config *slowfs.DeviceConfig) *uplink {
+	return &uplink{
+		deviceConfig: config,
+	}
+}
+
+// add queues numBytes written to the file at path at time t for uploading.
+func (u *uplink) add(path string, numBytes units.NumBytes, t time.Time) {
+	if numBytes <= 0 {
+		return
+	}
+	u.upload(t)
+	if n := len(u.backlog); n > 0 && u.backlog[n-1].path == path {
+		// Sequential writes to one file are common, so merge them.
+		u.backlog[n-1].size = units.NumBytesAdd(u.backlog[n-1].size, numBytes)
+		return
+	}
+	u.backlog = append(u.backlog, pendingUpload{path: path, size: numBytes})
+}
+
+// upload removes whatever has been uploaded by time t from the backlog.
+func (u *uplink) upload(t time.Time) {
+	from := latestTime(u.uploadedAt, u.stalledUntil)
+	if !t.After(from) {
+		return
+	}
+	u.uploadedAt = t
+	uploaded := u.deviceConfig.UploadableBytes(t.Sub(from))
+	for len(u.backlog) > 0 && uploaded > 0 {
+		if u.backlog[0].size > uploaded {
+			u.backlog[0].size -= uploaded
+			break
+		}
+		uploaded -= u.backlog[0].size
+		u.backlog = u.backlog[1:]
+	}
+	if len(u.backlog) == 0 {
+		u.backlog = nil
+	}
+}
+
+// uploadedBy returns when all of the data written to the file at path so far will have been
+// uploaded, or the zero time if it already has been.
+func (u *uplink) uploadedBy(path string) time.Time {
+	var ahead, last units.NumBytes
+	for _, p := range u.backlog {
+		ahead = units.NumBytesAdd(ahead, p.size)
+		if p.path == path {
+			last = ahead
+		}
+	}
+	if last == 0 {
+		return time.Time{}
+	}
+	return latestTime(u.uploadedAt, u.stalledUntil).Add(u.deviceConfig.UploadTime(last))
+}
+
+// stall stops uploading for d from now, or from the end of the current stall if later.
+func (u *uplink) stall(now time.Time, d time.Duration) {
+	u.upload(now)
+	u.stalledUntil = latestTime(u.stalledUntil, now).Add(d)
+}
+
+// backlogBytes returns how many bytes of each file are waiting to be uploaded at time t.
+func (u *uplink) backlogBytes(t time.Time) map[string]units.NumBytes {
+	u.upload(t)
+	backlog := make(map[string]units.NumBytes)
+	for _, p := range u.backlog {
+		backlog[p.path] = units.NumBytesAdd(backlog[p.path], p.size)
+	}
+	return backlog
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"reflect"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestUplink(t *testing.T) {
+	u := newUplink(uploadDeviceConfig)
+	u.add("a", 60, startTime)
+	u.add("a", 40, startTime)
+	u.add("b", 50, startTime)
+
+	// At 10 bytes per second, a is uploaded first, then b.
+	for _, c := range []struct {
+		path string
+		want time.Time
+	}{
+		{"a", startTime.Add(10 * time.Second)},
+		{"b", startTime.Add(15 * time.Second)},
+		{"c", time.Time{}},
+	} {
+		if got := u.uploadedBy(c.path); !got.Equal(c.want) {
+			t.Errorf("uploadedBy(%s) = %s, want %s", c.path, got, c.want)
+		}
+	}
+
+	if got, want := u.backlogBytes(startTime.Add(12*time.Second)), map[string]units.NumBytes{"b": 30}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backlogBytes() after 12s = %v, want %v", got, want)
+	}
+
+	// Nothing is uploaded while stalled, so the rest of b takes 5s longer.
+	u.stall(startTime.Add(12*time.Second), 5*time.Second)
+	if got, want := u.uploadedBy("b"), startTime.Add(20*time.Second); !got.Equal(want) {
+		t.Errorf("uploadedBy(b) after stalling = %s, want %s", got, want)
+	}
+	if got, want := u.backlogBytes(startTime.Add(16*time.Second)), map[string]units.NumBytes{"b": 30}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backlogBytes() during stall = %v, want %v", got, want)
+	}
+	if got, want := u.backlogBytes(startTime.Add(20*time.Second)), map[string]units.NumBytes{}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backlogBytes() after stall = %v, want %v", got, want)
+	}
+}
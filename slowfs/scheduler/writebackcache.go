@@ -18,6 +18,7 @@ import (
 	"math/rand"
 	"slowfs/slowfs"
 	"slowfs/slowfs/units"
+	"sort"
 	"time"
 )
 
@@ -30,43 +31,117 @@ type writeBackCache struct {
 	// will take up spare IO time that would otherwise be used for other files getting written back.
 	orphanedUnwrittenBytes units.NumBytes
 
+	// For open files, which ranges were written by the writes in unwrittenBytes, oldest first.
+	// Writes are written back in the order they were made.
+	unwrittenRanges map[string][]byteRange
+
 	deviceConfig *slowfs.DeviceConfig
+
+	// Chooses which files to write back first.
+	random *rand.Rand
+}
+
+// byteRange is size bytes of a file, from offset start.
+type byteRange struct {
+	start units.NumBytes
+	size  units.NumBytes
 }
 
-func newWriteBackCache(config *slowfs.DeviceConfig) *writeBackCache {
+func newWriteBackCache(config *slowfs.DeviceConfig, random *rand.Rand) *writeBackCache {
 	return &writeBackCache{
-		unwrittenBytes: make(map[string]units.NumBytes),
-		deviceConfig:   config,
+		unwrittenBytes:  make(map[string]units.NumBytes),
+		unwrittenRanges: make(map[string][]byteRange),
+		deviceConfig:    config,
+		random:          random,
 	}
 }
 
 func (wbc *writeBackCache) close(path string) {
-	wbc.orphanedUnwrittenBytes += wbc.unwrittenBytes[path]
+	wbc.orphanedUnwrittenBytes = units.NumBytesAdd(wbc.orphanedUnwrittenBytes, wbc.unwrittenBytes[path])
 	delete(wbc.unwrittenBytes, path)
+	delete(wbc.unwrittenRanges, path)
 }
 
 func (wbc *writeBackCache) write(path string, numBytes units.NumBytes) {
 	if numBytes > 0 {
-		wbc.unwrittenBytes[path] += numBytes
+		wbc.unwrittenBytes[path] = units.NumBytesAdd(wbc.unwrittenBytes[path], numBytes)
+	}
+}
+
+// writeAt is like write, but also records which range of the file was written, so that reads of it
+// can be served from the cache.
+func (wbc *writeBackCache) writeAt(path string, start, numBytes units.NumBytes) {
+	if numBytes <= 0 {
+		return
 	}
+	wbc.write(path, numBytes)
+	ranges := wbc.unwrittenRanges[path]
+	if n := len(ranges); n > 0 && units.NumBytesAdd(ranges[n-1].start, ranges[n-1].size) == start {
+		// Sequential writes are common, so merge them.
+		ranges[n-1].size = units.NumBytesAdd(ranges[n-1].size, numBytes)
+	} else {
+		ranges = append(ranges, byteRange{start: start, size: numBytes})
+	}
+	wbc.unwrittenRanges[path] = ranges
 }
 
 func (wbc *writeBackCache) getUnwrittenBytes(path string) units.NumBytes {
 	return wbc.unwrittenBytes[path]
 }
 
+// contains returns whether all of the given range of the file at path is still waiting in the
+// cache to be written back.
+func (wbc *writeBackCache) contains(path string, start, size units.NumBytes) bool {
+	ranges := wbc.unwrittenRanges[path]
+	end := units.NumBytesAdd(start, size)
+	for start < end {
+		found := false
+		for _, r := range ranges {
+			if r.start <= start && start < r.start+r.size {
+				start = units.NumBytesAdd(r.start, r.size)
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func (wbc *writeBackCache) writeBackFile(path string) {
 	delete(wbc.unwrittenBytes, path)
+	delete(wbc.unwrittenRanges, path)
+}
+
+// totalUnwrittenBytes returns how much data, of every file, is waiting to be written back.
+func (wbc *writeBackCache) totalUnwrittenBytes() units.NumBytes {
+	total := wbc.orphanedUnwrittenBytes
+	for _, numBytes := range wbc.unwrittenBytes {
+		total = units.NumBytesAdd(total, numBytes)
+	}
+	return total
+}
+
+// writeBackAll marks all data, of every file, as written back.
+func (wbc *writeBackCache) writeBackAll() {
+	wbc.unwrittenBytes = make(map[string]units.NumBytes)
+	wbc.unwrittenRanges = make(map[string][]byteRange)
+	wbc.orphanedUnwrittenBytes = 0
 }
 
-func (wbc *writeBackCache) writeBack(duration time.Duration) {
+// writeBack spends up to duration of spare time writing back cached data, and returns how much of
+// it is left.
+func (wbc *writeBackCache) writeBack(duration time.Duration) time.Duration {
 	// Choose random files to write back bytes for.
 	paths := make([]string, 0, len(wbc.unwrittenBytes))
 	for path := range wbc.unwrittenBytes {
 		paths = append(paths, path)
 	}
 
-	sliceShuffle(paths)
+	// Sort first, so that the order only depends on the random source and not on the map's.
+	sort.Strings(paths)
+	sliceShuffle(wbc.random, paths)
 	for _, path := range paths {
 		duration -= wbc.writeBackBytesForFile(path, duration)
 
@@ -75,10 +150,15 @@ func (wbc *writeBackCache) writeBack(duration time.Duration) {
 		}
 	}
 
-	if duration >= wbc.deviceConfig.SeekTime {
-		wbc.orphanedUnwrittenBytes -= units.NumBytesMin(wbc.orphanedUnwrittenBytes, wbc.computeWritableBytes(duration))
+	if duration >= wbc.deviceConfig.SeekTime && wbc.orphanedUnwrittenBytes > 0 {
+		written := units.NumBytesMin(wbc.orphanedUnwrittenBytes, wbc.computeWritableBytes(duration))
+		wbc.orphanedUnwrittenBytes -= written
+		duration -= wbc.writeBackTime(written)
 	}
-
+	if duration < 0 {
+		return 0
+	}
+	return duration
 }
 
 func (wbc *writeBackCache) writeBackBytesForFile(path string, duration time.Duration) time.Duration {
@@ -86,25 +166,53 @@ func (wbc *writeBackCache) writeBackBytesForFile(path string, duration time.Dura
 	bytesToWrite := units.NumBytesMin(wbc.unwrittenBytes[path], wbc.computeWritableBytes(duration))
 
 	if bytesToWrite != 0 {
-		timeTaken = wbc.deviceConfig.SeekTime + wbc.deviceConfig.WriteTime(bytesToWrite)
+		timeTaken = wbc.writeBackTime(bytesToWrite)
 	}
 
 	wbc.unwrittenBytes[path] -= bytesToWrite
 	if wbc.unwrittenBytes[path] == 0 {
 		delete(wbc.unwrittenBytes, path)
+		delete(wbc.unwrittenRanges, path)
+	} else {
+		wbc.writeBackRanges(path, bytesToWrite)
 	}
 	return timeTaken
 }
 
+// writeBackRanges forgets the ranges of the oldest numBytes of writes to the file at path.
+func (wbc *writeBackCache) writeBackRanges(path string, numBytes units.NumBytes) {
+	ranges := wbc.unwrittenRanges[path]
+	for len(ranges) > 0 && numBytes > 0 {
+		if ranges[0].size > numBytes {
+			ranges[0].start += numBytes
+			ranges[0].size -= numBytes
+			break
+		}
+		numBytes -= ranges[0].size
+		ranges = ranges[1:]
+	}
+	if len(ranges) == 0 {
+		delete(wbc.unwrittenRanges, path)
+	} else {
+		wbc.unwrittenRanges[path] = ranges
+	}
+}
+
 // We assume a seek before we can begin writing back data, so if we don't have time for that seek
 // we can't write any bytes back.
+// writeBackTime returns how long writing back numBytes of one file takes, including verifying them
+// with VerifyWrites.
+func (wbc *writeBackCache) writeBackTime(numBytes units.NumBytes) time.Duration {
+	return units.DurationAdd(wbc.deviceConfig.SeekTime, wbc.deviceConfig.WriteTime(numBytes), wbc.deviceConfig.VerifyTime(numBytes))
+}
+
 func (wbc *writeBackCache) computeWritableBytes(duration time.Duration) units.NumBytes {
 	return wbc.deviceConfig.WritableBytes(duration - wbc.deviceConfig.SeekTime)
 }
 
-func sliceShuffle(arr []string) {
+func sliceShuffle(random *rand.Rand, arr []string) {
 	for i := 0; i < len(arr); i++ {
-		idx := i + rand.Intn(len(arr)-i)
+		idx := i + random.Intn(len(arr)-i)
 		arr[i], arr[idx] = arr[idx], arr[i]
 	}
 }
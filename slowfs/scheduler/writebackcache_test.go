@@ -15,6 +15,7 @@
 package scheduler
 
 import (
+	"math/rand"
 	"reflect"
 	"slowfs/slowfs"
 	"slowfs/slowfs/units"
@@ -30,7 +31,7 @@ func TestWriteBackCache_Write(t *testing.T) {
 		want     units.NumBytes
 	}{{"a", 101, 101}, {"b", 102, 102}, {"c", 0, 0}, {"c", 0, 0}, {"c", 1, 1}, {"c", 5, 6}, {"a", 1, 102}, {"b", 102, 204}}
 
-	writeBackCache := newWriteBackCache(basicDeviceConfig)
+	writeBackCache := newWriteBackCache(basicDeviceConfig, rand.New(rand.NewSource(1)))
 	for _, c := range cases {
 		writeBackCache.write(c.path, c.numBytes)
 		if got, want := writeBackCache.getUnwrittenBytes(c.path), c.want; got != want {
@@ -46,7 +47,7 @@ func TestWriteBackCache_Close(t *testing.T) {
 		want     units.NumBytes
 	}{{"a", 101, 101}, {"b", 102, 203}, {"c", 0, 203}, {"c", 0, 203}, {"c", 1, 204}, {"c", 5, 209}, {"a", 1, 210}, {"b", 102, 312}}
 
-	writeBackCache := newWriteBackCache(basicDeviceConfig)
+	writeBackCache := newWriteBackCache(basicDeviceConfig, rand.New(rand.NewSource(1)))
 	for _, c := range cases {
 		writeBackCache.write(c.path, c.numBytes)
 		writeBackCache.close(c.path)
@@ -124,7 +125,7 @@ func TestWriteBackCache_WriteBack(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		writeBackCache := newWriteBackCache(basicDeviceConfig)
+		writeBackCache := newWriteBackCache(basicDeviceConfig, rand.New(rand.NewSource(1)))
 		for _, write := range c.writes {
 			writeBackCache.write(write.path, write.numBytes)
 			if write.shouldClose {
@@ -221,7 +222,7 @@ func TestWriteBackCache_WriteBackBytesForFile(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		writeBackCache := newWriteBackCache(c.deviceConfig)
+		writeBackCache := newWriteBackCache(c.deviceConfig, rand.New(rand.NewSource(1)))
 		writeBackCache.write("a", c.numBytes)
 
 		if got, want := writeBackCache.writeBackBytesForFile("a", c.duration), c.wantDuration; got != want {
@@ -254,7 +255,7 @@ func TestComputeWritableBytes(t *testing.T) {
 		deviceConfig := *basicDeviceConfig
 		deviceConfig.WriteBytesPerSecond = c.bytesPerSecond
 		deviceConfig.SeekTime = c.seekTime
-		writeBackCache := newWriteBackCache(&deviceConfig)
+		writeBackCache := newWriteBackCache(&deviceConfig, rand.New(rand.NewSource(1)))
 		if got, want := writeBackCache.computeWritableBytes(c.duration), c.want; got != want {
 			t.Errorf("computeWritableBytes(%s, %d, %s) = %d, want %d", c.duration, c.bytesPerSecond, c.seekTime, got, want)
 		}
@@ -266,9 +267,51 @@ func TestSliceShuffle(t *testing.T) {
 	acopy := make([]string, len(a))
 	copy(acopy, a)
 
-	sliceShuffle(acopy)
+	sliceShuffle(rand.New(rand.NewSource(1)), acopy)
 	sort.Strings(acopy)
 	if !reflect.DeepEqual(a, acopy) {
 		t.Errorf("sliceShuffle failed: %v -> %v", a, acopy)
 	}
 }
+
+func TestWriteBackCache_Contains(t *testing.T) {
+	writeBackCache := newWriteBackCache(basicDeviceConfig, rand.New(rand.NewSource(1)))
+	writeBackCache.writeAt("a", 0, 100)
+	writeBackCache.writeAt("a", 100, 50)
+	writeBackCache.writeAt("a", 300, 100)
+	writeBackCache.writeAt("a", 350, 100)
+
+	cases := []struct {
+		desc        string
+		path        string
+		start, size units.NumBytes
+		want        bool
+	}{
+		{"within a write", "a", 10, 20, true},
+		{"across sequential writes", "a", 50, 100, true},
+		{"across overlapping writes", "a", 320, 100, true},
+		{"past the end", "a", 100, 60, false},
+		{"in a gap", "a", 150, 10, false},
+		{"other file", "b", 0, 10, false},
+	}
+
+	for _, c := range cases {
+		if got := writeBackCache.contains(c.path, c.start, c.size); got != c.want {
+			t.Errorf("fail (%s) contains(%s, %d, %d) = %t, want %t", c.desc, c.path, c.start, c.size, got, c.want)
+		}
+	}
+
+	// Writes are written back oldest first.
+	writeBackCache.writeBackRanges("a", 120)
+	if got, want := writeBackCache.contains("a", 0, 10), false; got != want {
+		t.Errorf("contains(a, 0, 10) after writing back 120 bytes = %t, want %t", got, want)
+	}
+	if got, want := writeBackCache.contains("a", 120, 30), true; got != want {
+		t.Errorf("contains(a, 120, 30) after writing back 120 bytes = %t, want %t", got, want)
+	}
+
+	writeBackCache.close("a")
+	if got, want := writeBackCache.contains("a", 300, 10), false; got != want {
+		t.Errorf("contains(a, 300, 10) after close = %t, want %t", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Semantics indicates which filesystem's rules, beyond its timing, a mount follows.
+type Semantics int
+
+const (
+	// PosixSemantics means the backing directory's rules apply unchanged.
+	PosixSemantics Semantics = iota
+	// FatSemantics means names are case insensitive, timestamps have 2 second granularity, files
+	// can't have permissions, hard links or symlinks, and files can't grow past 4GiB, as on the
+	// FAT and exFAT filesystems of cameras and USB sticks.
+	FatSemantics
+)
+
+func (s Semantics) String() string {
+	switch s {
+	case PosixSemantics:
+		return "PosixSemantics"
+	case FatSemantics:
+		return "FatSemantics"
+	default:
+		return "unknown semantics"
+	}
+}
+
+// ParseSemanticsFromString parses a Semantics from the given string. This function is case
+// insensitive, and also accepts synonyms for each Semantics. For example, vfat and removable both
+// map to FatSemantics.
+func ParseSemanticsFromString(s string) (Semantics, error) {
+	switch strings.ToLower(s) {
+	case "posixsemantics", "posix":
+		return PosixSemantics, nil
+	case "fatsemantics", "fat", "vfat", "exfat", "removable":
+		return FatSemantics, nil
+	default:
+		return 0, fmt.Errorf("unknown semantics %s", s)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSemantics_String(t *testing.T) {
+	cases := []struct {
+		semantics Semantics
+		want      string
+	}{
+		{PosixSemantics, "PosixSemantics"},
+		{FatSemantics, "FatSemantics"},
+		{12345, "unknown semantics"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.semantics.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.semantics, got, want)
+		}
+	}
+}
+
+func TestParseSemanticsFromString(t *testing.T) {
+	cases := []struct {
+		strSemantics string
+		want         Semantics
+		shouldErr    bool
+	}{
+		{"POSIX", PosixSemantics, false},
+		{"fat", FatSemantics, false},
+		{"exFAT", FatSemantics, false},
+		{"removable", FatSemantics, false},
+		{"FatSemantics", FatSemantics, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseSemanticsFromString(c.strSemantics)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseSemanticsFromString(%s) = %s, want %s", c.strSemantics, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseSemanticsFromString(%s) = _, %v, want _, %v", c.strSemantics, err, expectedErr)
+		}
+	}
+}
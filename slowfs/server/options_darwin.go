@@ -0,0 +1,24 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "path/filepath"
+
+// platformOptions returns the mount options macFUSE and fuse-t are always given for a mount at
+// mountDir: a volume name for Finder, and noappledouble, so that Finder and Spotlight don't create
+// ._ and .DS_Store files, whose requests would otherwise be scheduled with the application's.
+func platformOptions(mountDir string) []string {
+	return []string{"volname=" + filepath.Base(mountDir), "noappledouble"}
+}
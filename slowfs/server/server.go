@@ -0,0 +1,166 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server serves a slow filesystem: a FUSE mount of a backing directory whose operations take
+// as long as a simulated device says they should. It is what the slowfs command runs, and can be
+// embedded directly, e.g. in integration tests:
+//
+//	s, err := server.New("/tmp/backing", "/tmp/slow", &slowfs.HDD7200RpmDeviceConfig)
+//	if err != nil {
+//		...
+//	}
+//	if err := s.Start(); err != nil {
+//		...
+//	}
+//	defer s.Stop()
+//
+// SlowFs and Scheduler give access to the filesystem and its device, e.g. to change timeouts or add
+// hooks called as operations complete.
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/fuselayer"
+	"slowfs/slowfs/quota"
+	"slowfs/slowfs/scheduler"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// Server is a slow filesystem, mounted at one directory and serving another.
+type Server struct {
+	backingDir string
+	mountDir   string
+	scheduler  *scheduler.Scheduler
+	slowFs     *fuselayer.SlowFs
+
+	server *fuse.Server
+	// Closed once the server stops serving.
+	done chan struct{}
+}
+
+// New creates a Server which serves backingDir at mountDir, simulating a device described by
+// config. Nothing is mounted until Mount or Start.
+func New(backingDir, mountDir string, config *slowfs.DeviceConfig) (*Server, error) {
+	var err error
+	if backingDir, err = filepath.Abs(backingDir); err != nil {
+		return nil, fmt.Errorf("invalid backing directory: %s", err)
+	}
+	if mountDir, err = filepath.Abs(mountDir); err != nil {
+		return nil, fmt.Errorf("invalid mount directory: %s", err)
+	}
+	if backingDir == mountDir {
+		return nil, errors.New("backing directory may not be the same as mount directory")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("error validating config: %s", err)
+	}
+	s := scheduler.New(config)
+	slowFs := fuselayer.NewSlowFs(backingDir, s)
+	slowFs.SetCountEntries(config.DirectoryEntryTime > 0)
+	if config.DeviceCapacity > 0 {
+		c := quota.NewCapacity(config.DeviceCapacity)
+		if err := c.Scan(backingDir); err != nil {
+			return nil, fmt.Errorf("couldn't add up space used in %s: %s", backingDir, err)
+		}
+		slowFs.SetCapacity(c)
+	}
+	return &Server{
+		backingDir: backingDir,
+		mountDir:   mountDir,
+		scheduler:  s,
+		slowFs:     slowFs,
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// BackingDir returns the absolute path of the directory being served.
+func (s *Server) BackingDir() string {
+	return s.backingDir
+}
+
+// MountDir returns the absolute path of the directory the filesystem is mounted at.
+func (s *Server) MountDir() string {
+	return s.mountDir
+}
+
+// SlowFs returns the filesystem being served.
+func (s *Server) SlowFs() *fuselayer.SlowFs {
+	return s.slowFs
+}
+
+// Scheduler returns the scheduler simulating the filesystem's device.
+func (s *Server) Scheduler() *scheduler.Scheduler {
+	return s.scheduler
+}
+
+// Mount mounts the filesystem, ready to serve, passing options such as "allow_other" to the kernel,
+// after any the platform needs.
+func (s *Server) Mount(options ...string) error {
+	options = append(platformOptions(s.mountDir), options...)
+	fs := pathfs.NewPathNodeFs(s.slowFs, nil)
+	conn := nodefs.NewFileSystemConnector(fs.Root(), nil)
+	server, err := fuse.NewServer(conn.RawFS(), s.mountDir, &fuse.MountOptions{Options: options})
+	if err != nil {
+		return fmt.Errorf("mounting %s: %s", s.mountDir, err)
+	}
+	s.server = server
+	return nil
+}
+
+// Serve serves the mounted filesystem until it is unmounted.
+func (s *Server) Serve() {
+	s.server.Serve()
+	close(s.done)
+}
+
+// WaitMount waits until the kernel has finished mounting the filesystem, once it is being served.
+func (s *Server) WaitMount() error {
+	return s.server.WaitMount()
+}
+
+// Start mounts the filesystem and serves it in the background, returning once it is ready for
+// use.
+func (s *Server) Start(options ...string) error {
+	if err := s.Mount(options...); err != nil {
+		return err
+	}
+	go s.Serve()
+	if err := s.server.WaitMount(); err != nil {
+		s.server.Unmount()
+		return fmt.Errorf("waiting for mount of %s: %s", s.mountDir, err)
+	}
+	return nil
+}
+
+// Unmount unmounts the filesystem, without waiting for it to stop serving. Operations waiting for
+// the simulated device fail straight away, so that the mount isn't busy.
+func (s *Server) Unmount() error {
+	s.slowFs.Shutdown()
+	return s.server.Unmount()
+}
+
+// Stop unmounts the filesystem and waits for it to stop serving.
+func (s *Server) Stop() error {
+	if err := s.Unmount(); err != nil {
+		return fmt.Errorf("unmounting %s: %s", s.mountDir, err)
+	}
+	<-s.done
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	invalid := config
+	invalid.SeekTime = -time.Second
+
+	cases := []struct {
+		desc                 string
+		backingDir, mountDir string
+		config               *slowfs.DeviceConfig
+		shouldErr            bool
+	}{
+		{"valid", "/tmp/backing", "/tmp/mount", &config, false},
+		{"same directory", "/tmp/backing", "/tmp/../tmp/backing", &config, true},
+		{"invalid config", "/tmp/backing", "/tmp/mount", &invalid, true},
+	}
+
+	for _, c := range cases {
+		s, err := New(c.backingDir, c.mountDir, c.config)
+		if got, want := err != nil, c.shouldErr; got != want {
+			t.Errorf("%s: New(%s, %s) error = %v, want error %t", c.desc, c.backingDir, c.mountDir, err, want)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if s.SlowFs() == nil || s.Scheduler() == nil {
+			t.Errorf("%s: New(%s, %s) has no filesystem or scheduler", c.desc, c.backingDir, c.mountDir)
+		}
+	}
+}
+
+func TestNew_AbsolutePaths(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	s, err := New("backing", "mount", &config)
+	if err != nil {
+		t.Fatalf("New(backing, mount) failed: %s", err)
+	}
+	for _, dir := range []string{s.BackingDir(), s.MountDir()} {
+		if dir == "" || dir[0] != '/' {
+			t.Errorf("New(backing, mount) has directory %q, want an absolute path", dir)
+		}
+	}
+}
+
+func TestNew_DeviceCapacity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatalf("couldn't create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), make([]byte, 8192), 0644); err != nil {
+		t.Fatalf("couldn't write file: %s", err)
+	}
+
+	config := slowfs.HDD7200RpmDeviceConfig
+	config.DeviceCapacity = units.Mebibyte
+	s, err := New(dir, dir+"-mount", &config)
+	if err != nil {
+		t.Fatalf("New(%s) failed: %s", dir, err)
+	}
+	s.SlowFs().SetPassthrough(true)
+	out := s.SlowFs().StatFs("")
+	if out == nil {
+		t.Fatalf("StatFs() failed")
+	}
+	if got, want := units.NumBytes(out.Blocks*uint64(out.Bsize)), config.DeviceCapacity; got != want {
+		t.Errorf("StatFs() reports %d bytes, want %d", got, want)
+	}
+	if got, want := units.NumBytes((out.Blocks-out.Bfree)*uint64(out.Bsize)), units.NumBytes(8192); got != want {
+		t.Errorf("StatFs() reports %d bytes used, want %d", got, want)
+	}
+}
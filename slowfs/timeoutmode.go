@@ -0,0 +1,56 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TimeoutMode indicates what happens to operations which take longer than the configured timeout.
+// This mirrors the soft and hard mount options of NFS.
+type TimeoutMode int
+
+const (
+	// HardTimeout means operations run for as long as they take, however long that is.
+	HardTimeout TimeoutMode = iota
+	// SoftTimeout means operations fail with EIO once the timeout has elapsed.
+	SoftTimeout
+)
+
+func (t TimeoutMode) String() string {
+	switch t {
+	case HardTimeout:
+		return "HardTimeout"
+	case SoftTimeout:
+		return "SoftTimeout"
+	default:
+		return "unknown timeout mode"
+	}
+}
+
+// ParseTimeoutModeFromString parses a TimeoutMode from the given string. This function is case
+// insensitive, and also accepts synonyms for each TimeoutMode. For example, hardtimeout and hard
+// both map to the HardTimeout mode.
+func ParseTimeoutModeFromString(s string) (TimeoutMode, error) {
+	switch strings.ToLower(s) {
+	case "hardtimeout", "hard":
+		return HardTimeout, nil
+	case "softtimeout", "soft":
+		return SoftTimeout, nil
+	default:
+		return 0, fmt.Errorf("unknown timeout mode %s", s)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTimeoutMode_String(t *testing.T) {
+	cases := []struct {
+		timeoutMode TimeoutMode
+		want        string
+	}{
+		{HardTimeout, "HardTimeout"},
+		{SoftTimeout, "SoftTimeout"},
+		{12345, "unknown timeout mode"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.timeoutMode.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.timeoutMode, got, want)
+		}
+	}
+}
+
+func TestParseTimeoutModeFromString(t *testing.T) {
+	cases := []struct {
+		strTimeoutMode string
+		want           TimeoutMode
+		shouldErr      bool
+	}{
+		{"hArdTimeout", HardTimeout, false},
+		{"hard", HardTimeout, false},
+		{"SOFT", SoftTimeout, false},
+		{"softtimeout", SoftTimeout, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseTimeoutModeFromString(c.strTimeoutMode)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseTimeoutModeFromString(%s) = %s, want %s", c.strTimeoutMode, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseTimeoutModeFromString(%s) = _, %v, want _, %v", c.strTimeoutMode, err, expectedErr)
+		}
+	}
+}
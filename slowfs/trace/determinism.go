@@ -0,0 +1,89 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"fmt"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"sort"
+)
+
+// Step is an operation of a trace, and what a simulation of the trace modeled it to cost.
+type Step struct {
+	Record *Record
+	Cost   scheduler.Cost
+}
+
+// Simulate schedules the operations in records, in the order they started, on a new device
+// simulated with config, whose random choices follow seed, and returns what each cost. Failed
+// operations are skipped, since slowfs doesn't schedule them. Operations are scheduled one at a time,
+// so nothing but the scheduler itself can make simulations of the same trace differ.
+func Simulate(records []*Record, config *slowfs.DeviceConfig, seed int64) ([]Step, error) {
+	var steps []Step
+	for _, r := range records {
+		if r.Error == "" {
+			steps = append(steps, Step{Record: r})
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Record.Time.Before(steps[j].Record.Time)
+	})
+
+	s := scheduler.New(config)
+	s.SetSeed(seed)
+	for i := range steps {
+		r := steps[i].Record
+		req := &scheduler.Request{
+			Timestamp: r.Time,
+			Path:      r.Path,
+			Start:     units.NumBytes(r.Offset),
+			Size:      units.NumBytes(r.Length),
+		}
+		var err error
+		if req.Type, err = scheduler.ParseRequestTypeFromString(r.Op); err != nil {
+			return nil, fmt.Errorf("record at %s: %s", r.Time, err)
+		}
+		if steps[i].Cost, err = s.ScheduleCost(context.Background(), req); err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+
+// Difference is an operation which two simulations of a trace modeled differently.
+type Difference struct {
+	Record *Record
+	A, B   scheduler.Cost
+}
+
+func (d *Difference) String() string {
+	return fmt.Sprintf("%s %s %s [%d+%d] took %s, then %s", d.Record.Time.Format("15:04:05.000000"), d.Record.Op,
+		d.Record.Path, d.Record.Offset, d.Record.Length, d.A.Total(), d.B.Total())
+}
+
+// Diff returns the operations whose costs differ between a and b, which must be simulations of the
+// same trace.
+func Diff(a, b []Step) []Difference {
+	var diffs []Difference
+	for i := range a {
+		if a[i].Cost != b[i].Cost {
+			diffs = append(diffs, Difference{Record: a[i].Record, A: a[i].Cost, B: b[i].Cost})
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"fmt"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	seekTimes, err := slowfs.ParseDistributionFromString("lognormal(10ms,5ms)")
+	if err != nil {
+		t.Fatalf("ParseDistributionFromString() = %v, want nil", err)
+	}
+	config := &slowfs.DeviceConfig{
+		Name:                   "random",
+		SeekWindow:             4 * units.Kibibyte,
+		SeekTime:               10 * time.Millisecond,
+		ReadBytesPerSecond:     100 * units.Mebibyte,
+		WriteBytesPerSecond:    100 * units.Mebibyte,
+		AllocateBytesPerSecond: 1 * units.Gibibyte,
+		FsyncStrategy:          slowfs.WriteBackCachedFsync,
+		WriteStrategy:          slowfs.FastWrite,
+		MetadataOpTime:         time.Millisecond,
+		ReadRepairProbability:  0.5,
+		ReadRepairSeeks:        2,
+		SeekTimeDistribution:   seekTimes,
+	}
+	start := time.Unix(1500000000, 0)
+	var records []*Record
+	for i := 0; i < 50; i++ {
+		path := fmt.Sprintf("f%d", i%5)
+		records = append(records,
+			&Record{Time: start.Add(time.Duration(2*i) * time.Millisecond), Op: "write", Path: path, Offset: int64(i) * 1 << 20, Length: 1 << 20},
+			&Record{Time: start.Add(time.Duration(2*i+1) * time.Millisecond), Op: "read", Path: path, Offset: int64(i) * 1 << 22, Length: 4096})
+	}
+	// Failed operations aren't scheduled.
+	records = append(records, &Record{Time: start, Op: "read", Path: "missing", Error: "no such file or directory"})
+
+	a, err := Simulate(records, config, 1)
+	if err != nil {
+		t.Fatalf("Simulate() = %v, want nil", err)
+	}
+	if got, want := len(a), 100; got != want {
+		t.Errorf("len(Simulate()) = %d, want %d", got, want)
+	}
+	b, err := Simulate(records, config, 1)
+	if err != nil {
+		t.Fatalf("Simulate() = %v, want nil", err)
+	}
+	if diffs := Diff(a, b); len(diffs) != 0 {
+		t.Errorf("Diff() of simulations with the same seed = %v, want none", diffs)
+	}
+
+	c, err := Simulate(records, config, 2)
+	if err != nil {
+		t.Fatalf("Simulate() = %v, want nil", err)
+	}
+	if diffs := Diff(a, c); len(diffs) == 0 {
+		t.Errorf("Diff() of simulations with different seeds is empty, want differences")
+	}
+
+	if _, err := Simulate([]*Record{{Op: "frobnicate"}}, config, 1); err == nil {
+		t.Errorf("Simulate() of an unknown op = nil, want error")
+	}
+}
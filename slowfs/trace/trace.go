@@ -0,0 +1,184 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace records every operation slowfs serves as a line of JSON, with both the latency
+// slowfs simulated for it and how long it actually took, so that runs can be compared against a
+// real device's and the differences tracked down to individual operations, e.g. with jq. Traces,
+// including those converted from other tools' output, can also be replayed, so that operations
+// take the latencies recorded in them.
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slowfs/slowfs/fuselayer"
+	"slowfs/slowfs/scheduler"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// Record is one line of a trace.
+type Record struct {
+	// When the operation reached slowfs.
+	Time time.Time `json:"time"`
+	// The operation's request type, in lower case, e.g. "read" or "fsync".
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	// The simulated latency, and how long the operation actually took, in nanoseconds.
+	SimulatedNs int64 `json:"simulated_ns"`
+	ElapsedNs   int64 `json:"elapsed_ns"`
+	// Why the operation failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// NewRecord returns the record of a completed operation.
+func NewRecord(op *fuselayer.CompletedOp) *Record {
+	r := &Record{
+		Time:        op.Request.Timestamp,
+		Op:          strings.TrimSuffix(strings.ToLower(op.Request.Type.String()), "request"),
+		Path:        op.Request.Path,
+		Offset:      int64(op.Request.Start),
+		Length:      int64(op.Request.Size),
+		SimulatedNs: op.Cost.Total().Nanoseconds(),
+		ElapsedNs:   op.Elapsed.Nanoseconds(),
+	}
+	if op.Status != fuse.OK {
+		r.Error = syscall.Errno(op.Status).Error()
+	}
+	return r
+}
+
+// Writer writes records to a trace. It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+	err error
+}
+
+// NewWriter starts a trace written to w.
+func NewWriter(w io.Writer) *Writer {
+	bw := bufio.NewWriter(w)
+	return &Writer{w: bw, enc: json.NewEncoder(bw)}
+}
+
+// Hook returns an op hook which records every operation. Errors writing the trace are reported by
+// Flush.
+func (w *Writer) Hook() fuselayer.OpHook {
+	return w.SampledHook(nil)
+}
+
+// SampledHook is like Hook, but only records the operations s samples. A nil Sampler samples every
+// operation.
+func (w *Writer) SampledHook(s *Sampler) fuselayer.OpHook {
+	return func(op *fuselayer.CompletedOp) {
+		if s.samples(op) {
+			w.Write(NewRecord(op))
+		}
+	}
+}
+
+// Sampler decides which operations a trace records, so that tracing can stay on in long runs
+// without the trace growing unmanageably. Operations taking at least SlowerThan, if it is set, are
+// always recorded, and one in Every of the rest, or none if Every is zero. With neither set, every
+// operation is recorded.
+type Sampler struct {
+	Every      int
+	SlowerThan time.Duration
+
+	// How many operations Every has been applied to. This is accessed atomically.
+	seen uint64
+}
+
+// samples returns whether op is recorded.
+func (s *Sampler) samples(op *fuselayer.CompletedOp) bool {
+	switch {
+	case s == nil:
+		return true
+	case s.SlowerThan > 0 && op.Elapsed >= s.SlowerThan:
+		return true
+	case s.Every > 0:
+		return (atomic.AddUint64(&s.seen, 1)-1)%uint64(s.Every) == 0
+	default:
+		return s.SlowerThan == 0
+	}
+}
+
+// Write records an operation. Records may be written slightly out of order, since they're written
+// by the goroutines which served the operations.
+func (w *Writer) Write(r *Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(r); err != nil && w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// Flush writes any buffered records to the underlying writer, and returns the first error writing
+// the trace, if there has been one.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.w.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// ReadRecords reads every record of a trace.
+func ReadRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	dec := json.NewDecoder(r)
+	for {
+		var record Record
+		if err := dec.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %s", len(records)+1, err)
+		}
+		records = append(records, &record)
+	}
+}
+
+// NewReplay returns a replay of the operations in records, which take how long the operations
+// actually took, or their simulated latency if that wasn't recorded. Only the op, path and
+// latencies of records are needed.
+func NewReplay(records []*Record) (*scheduler.Replay, error) {
+	ops := make([]scheduler.ReplayedOp, len(records))
+	for i, r := range records {
+		op, err := scheduler.ParseRequestTypeFromString(r.Op)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %s", i+1, err)
+		}
+		latency := r.ElapsedNs
+		if latency == 0 {
+			latency = r.SimulatedNs
+		}
+		if latency < 0 {
+			return nil, fmt.Errorf("record %d: latency cannot be negative", i+1)
+		}
+		ops[i] = scheduler.ReplayedOp{Type: op, Path: r.Path, Latency: time.Duration(latency)}
+	}
+	return scheduler.NewReplay(ops), nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"reflect"
+	"slowfs/slowfs/fuselayer"
+	"slowfs/slowfs/scheduler"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestWriter(t *testing.T) {
+	ops := []*fuselayer.CompletedOp{
+		{
+			Request: &scheduler.Request{Type: scheduler.ReadRequest, Timestamp: time.Unix(1500000000, 123).UTC(), Path: "db/index", Start: 4096, Size: 8192},
+			Cost:    scheduler.Cost{Seek: 10 * time.Millisecond, Transfer: 80 * time.Millisecond},
+			Elapsed: 93 * time.Millisecond,
+			Status:  fuse.OK,
+		},
+		{
+			Request: &scheduler.Request{Type: scheduler.FsyncRequest, Timestamp: time.Unix(1500000001, 0).UTC(), Path: "db/log"},
+			Cost:    scheduler.Cost{Fixed: time.Second},
+			Elapsed: 500 * time.Millisecond,
+			Status:  fuse.EIO,
+		},
+	}
+	want := []Record{
+		{Time: time.Unix(1500000000, 123).UTC(), Op: "read", Path: "db/index", Offset: 4096, Length: 8192, SimulatedNs: 90000000, ElapsedNs: 93000000},
+		{Time: time.Unix(1500000001, 0).UTC(), Op: "fsync", Path: "db/log", SimulatedNs: 1000000000, ElapsedNs: 500000000, Error: "input/output error"},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	hook := w.Hook()
+	for _, op := range ops {
+		hook(op)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() = %s", err)
+	}
+
+	records, err := ReadRecords(&buf)
+	if err != nil {
+		t.Fatalf("ReadRecords() error: %s", err)
+	}
+	var got []Record
+	for _, r := range records {
+		got = append(got, *r)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trace = %+v, want %+v", got, want)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	fast := &fuselayer.CompletedOp{Elapsed: time.Millisecond}
+	slow := &fuselayer.CompletedOp{Elapsed: time.Second}
+	cases := []struct {
+		sampler *Sampler
+		ops     []*fuselayer.CompletedOp
+		want    []bool
+	}{
+		{nil, []*fuselayer.CompletedOp{fast, slow}, []bool{true, true}},
+		{&Sampler{}, []*fuselayer.CompletedOp{fast, slow}, []bool{true, true}},
+		{&Sampler{Every: 3}, []*fuselayer.CompletedOp{fast, fast, slow, fast}, []bool{true, false, false, true}},
+		{&Sampler{SlowerThan: time.Second}, []*fuselayer.CompletedOp{fast, slow, fast}, []bool{false, true, false}},
+		// Slow operations are always recorded, and don't count towards Every.
+		{&Sampler{Every: 2, SlowerThan: time.Second}, []*fuselayer.CompletedOp{fast, slow, fast, fast}, []bool{true, true, false, true}},
+	}
+
+	for _, c := range cases {
+		for i, op := range c.ops {
+			if got, want := c.sampler.samples(op), c.want[i]; got != want {
+				t.Errorf("%+v: samples(op %d taking %s) = %t, want %t", c.sampler, i, op.Elapsed, got, want)
+			}
+		}
+	}
+}
+
+func TestReadRecords_Errors(t *testing.T) {
+	if _, err := ReadRecords(strings.NewReader(`{"op": "read"}` + "\n" + `{"op": `)); err == nil {
+		t.Errorf("ReadRecords(truncated trace) succeeded, want error")
+	}
+}
+
+func TestNewReplay(t *testing.T) {
+	cases := []struct {
+		trace     string
+		shouldErr bool
+	}{
+		{`{"op": "read", "path": "a", "elapsed_ns": 5000000}`, false},
+		{`{"op": "fsync", "path": "a", "simulated_ns": 5000000}`, false},
+		{`{"op": "scribble", "path": "a", "elapsed_ns": 5000000}`, true},
+		{`{"op": "read", "path": "a", "elapsed_ns": -1}`, true},
+	}
+
+	for _, c := range cases {
+		records, err := ReadRecords(strings.NewReader(c.trace))
+		if err != nil {
+			t.Fatalf("ReadRecords(%s) error: %s", c.trace, err)
+		}
+		replay, err := NewReplay(records)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("NewReplay(%s) succeeded, should error", c.trace)
+			}
+		} else if err != nil {
+			t.Errorf("NewReplay(%s) error: %s", c.trace, err)
+		} else if got, want := replay.Remaining(), 1; got != want {
+			t.Errorf("NewReplay(%s).Remaining() = %d, want %d", c.trace, got, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package units
+
+import (
+	"math"
+	"time"
+)
+
+// MaxDuration is the longest time.Duration. Computed durations saturate at it rather than
+// overflowing into negative ones.
+const MaxDuration = time.Duration(math.MaxInt64)
+
+// DurationAdd returns the sum of the durations, saturating at MaxDuration or its negative rather than
+// overflowing.
+func DurationAdd(ds ...time.Duration) time.Duration {
+	var sum time.Duration
+	for _, d := range ds {
+		sum = time.Duration(addInt64(int64(sum), int64(d)))
+	}
+	return sum
+}
+
+// DurationMul returns d * n, saturating at MaxDuration or its negative rather than overflowing.
+func DurationMul(d time.Duration, n int64) time.Duration {
+	return DurationFromFloat(float64(d) * float64(n))
+}
+
+// DurationFromFloat converts a float number of nanoseconds to a time.Duration, saturating at
+// MaxDuration or its negative when it is out of range. NaN gives 0.
+func DurationFromFloat(ns float64) time.Duration {
+	return time.Duration(int64FromFloat(ns))
+}
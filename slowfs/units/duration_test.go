@@ -0,0 +1,81 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package units
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDurationAdd(t *testing.T) {
+	cases := []struct {
+		ds   []time.Duration
+		want time.Duration
+	}{
+		{nil, 0},
+		{[]time.Duration{time.Second}, time.Second},
+		{[]time.Duration{time.Second, time.Millisecond, -time.Second}, time.Millisecond},
+		{[]time.Duration{MaxDuration, time.Nanosecond}, MaxDuration},
+		{[]time.Duration{MaxDuration, MaxDuration, time.Second}, MaxDuration},
+		{[]time.Duration{-MaxDuration, -time.Second}, math.MinInt64},
+	}
+
+	for _, c := range cases {
+		if got, want := DurationAdd(c.ds...), c.want; got != want {
+			t.Errorf("DurationAdd(%v) = %s, want %s", c.ds, got, want)
+		}
+	}
+}
+
+func TestDurationMul(t *testing.T) {
+	cases := []struct {
+		d    time.Duration
+		n    int64
+		want time.Duration
+	}{
+		{time.Second, 0, 0},
+		{time.Second, 10, 10 * time.Second},
+		{-time.Second, 10, -10 * time.Second},
+		{time.Hour, math.MaxInt64, MaxDuration},
+		{time.Hour, math.MinInt64, math.MinInt64},
+	}
+
+	for _, c := range cases {
+		if got, want := DurationMul(c.d, c.n), c.want; got != want {
+			t.Errorf("DurationMul(%s, %d) = %s, want %s", c.d, c.n, got, want)
+		}
+	}
+}
+
+func TestDurationFromFloat(t *testing.T) {
+	cases := []struct {
+		ns   float64
+		want time.Duration
+	}{
+		{0, 0},
+		{1e9, time.Second},
+		{1e30, MaxDuration},
+		{math.Inf(1), MaxDuration},
+		{math.Inf(-1), math.MinInt64},
+		{math.NaN(), 0},
+	}
+
+	for _, c := range cases {
+		if got, want := DurationFromFloat(c.ns), c.want; got != want {
+			t.Errorf("DurationFromFloat(%g) = %s, want %s", c.ns, got, want)
+		}
+	}
+}
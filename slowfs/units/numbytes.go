@@ -17,6 +17,7 @@ package units
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -35,6 +36,10 @@ const (
 	Mebibyte          = 1024 * Kibibyte
 	Gibibyte          = 1024 * Mebibyte
 	Tebibyte          = 1024 * Gibibyte
+
+	// MaxNumBytes and MinNumBytes are the largest and smallest values a NumBytes can hold.
+	MaxNumBytes NumBytes = math.MaxInt64
+	MinNumBytes NumBytes = math.MinInt64
 )
 
 // NumBytesMin returns the smaller of the two passed NumBytes values.
@@ -45,6 +50,17 @@ func NumBytesMin(a, b NumBytes) NumBytes {
 	return a
 }
 
+// NumBytesAdd returns a + b, saturating at MaxNumBytes or MinNumBytes rather than overflowing.
+func NumBytesAdd(a, b NumBytes) NumBytes {
+	return NumBytes(addInt64(int64(a), int64(b)))
+}
+
+// NumBytesFromFloat converts a float to NumBytes, saturating at MaxNumBytes or MinNumBytes when it
+// is out of range. NaN gives 0.
+func NumBytesFromFloat(f float64) NumBytes {
+	return NumBytes(int64FromFloat(f))
+}
+
 func (n NumBytes) String() string {
 	var base NumBytes
 	var suffix string
@@ -113,5 +129,9 @@ func ParseNumBytesFromString(s string) (NumBytes, error) {
 	if err != nil {
 		return 0, err
 	}
-	return NumBytes(num * float64(suffix)), nil
+	n := num * float64(suffix)
+	if math.IsNaN(n) || n >= math.MaxInt64 || n <= math.MinInt64 {
+		return 0, fmt.Errorf("size %s is out of range", s)
+	}
+	return NumBytes(n), nil
 }
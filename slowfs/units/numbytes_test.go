@@ -17,6 +17,7 @@ package units
 import (
 	"errors"
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -39,6 +40,50 @@ func TestNumBytesMin(t *testing.T) {
 	}
 }
 
+func TestNumBytesAdd(t *testing.T) {
+	cases := []struct {
+		a    NumBytes
+		b    NumBytes
+		want NumBytes
+	}{
+		{1, 1, 2},
+		{100, -12, 88},
+		{MaxNumBytes, -1, MaxNumBytes - 1},
+		{MaxNumBytes, 1, MaxNumBytes},
+		{MaxNumBytes, MaxNumBytes, MaxNumBytes},
+		{MinNumBytes, -1, MinNumBytes},
+		{MinNumBytes, MaxNumBytes, -1},
+	}
+
+	for _, c := range cases {
+		if got, want := NumBytesAdd(c.a, c.b), c.want; got != want {
+			t.Errorf("NumBytesAdd(%d, %d) = %d, want %d", c.a, c.b, got, want)
+		}
+	}
+}
+
+func TestNumBytesFromFloat(t *testing.T) {
+	cases := []struct {
+		f    float64
+		want NumBytes
+	}{
+		{0, 0},
+		{1.5, 1},
+		{-1.5, -1},
+		{1e30, MaxNumBytes},
+		{-1e30, MinNumBytes},
+		{math.Inf(1), MaxNumBytes},
+		{math.Inf(-1), MinNumBytes},
+		{math.NaN(), 0},
+	}
+
+	for _, c := range cases {
+		if got, want := NumBytesFromFloat(c.f), c.want; got != want {
+			t.Errorf("NumBytesFromFloat(%g) = %d, want %d", c.f, got, want)
+		}
+	}
+}
+
 func TestNumBytes_String(t *testing.T) {
 	cases := []struct {
 		numBytes NumBytes
@@ -105,6 +150,10 @@ func TestParseNumBytesFromString(t *testing.T) {
 		{"", 0, true},
 		{"!@#", 0, true},
 		{"432", 0, true},
+		{"10000000 TB", 0, true},
+		{"-10000000 TB", 0, true},
+		{"1e400 B", 0, true},
+		{"nan B", 0, true},
 	}
 
 	for _, c := range cases {